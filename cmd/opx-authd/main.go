@@ -2,43 +2,202 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/zach-source/opx/internal/audit"
 	"github.com/zach-source/opx/internal/backend"
 	"github.com/zach-source/opx/internal/cache"
+	"github.com/zach-source/opx/internal/config"
 	"github.com/zach-source/opx/internal/policy"
+	"github.com/zach-source/opx/internal/preflight"
 	"github.com/zach-source/opx/internal/server"
 	"github.com/zach-source/opx/internal/session"
+	"github.com/zach-source/opx/internal/util"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "generate-config":
+			if err := runGenerateConfig(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "generate-config: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "issue-client-cert":
+			if err := runIssueClientCert(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "issue-client-cert: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "migrate":
+			if err := runMigrate(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	// daemon.json supplies flag defaults; explicit flags still win
+	daemonConfig, daemonPath, daemonErr := config.Load()
+	if daemonErr != nil {
+		daemonConfig = config.DefaultDaemon()
+	}
+
 	var ttlSec int
 	var sock string
+	var lockFile string
 	var verbose bool
 	var backendName string
 	var sessionTimeout int
 	var enableSessionLock bool
 	var lockOnAuthFailure bool
+	var sessionUseCountLimit int
 	var enableAuditLog bool
 	var auditLogRetentionDays int
+	var auditLogMaxBytes int64
+	var auditTamperEvident bool
+	var compressMinBytes int
+	var refreshInterval time.Duration
+	var refreshMaxEntries int
+	var auditIncludeCmdline bool
+	var auditCmdlineMax int
+	var readTimeout, readsTimeout, resolveTimeout, backendReadTimeout, opApprovalTimeout time.Duration
+	var tlsKeyType string
+	var tlsMinKeyBits int
+	var allowDebug bool
+	var maxRequestBytes int64
+	var maxRefsPerRequest int
+	var maxValueBytes int64
+	var trackSecretChanges bool
+	var expandRefVars bool
+	var expectedAccount string
+	var redactAccountEmail bool
+	var readyFile string
+	var readyWaitBackend bool
+	var refHistoryDays int
+	var disableRefHistory bool
+	var approvalTimeout time.Duration
+	var approvalHook, approvalWebhook string
+	var persistApprovals bool
+	var denialMessage string
+	var auditRequired bool
+	var listenTCP string
+	var checkConfig bool
 
-	flag.IntVar(&ttlSec, "ttl", 120, "cache TTL seconds")
-	flag.StringVar(&sock, "sock", "", "unix socket path (default: XDG data dir or ~/.op-authd/socket.sock)")
-	flag.BoolVar(&verbose, "verbose", true, "verbose logging")
-	flag.StringVar(&backendName, "backend", "opcli", "backend: opcli|fake|vault|bao|multi")
-	flag.IntVar(&sessionTimeout, "session-timeout", int(session.DefaultIdleTimeout.Hours()), "session idle timeout in hours (0 to disable)")
-	flag.BoolVar(&enableSessionLock, "enable-session-lock", true, "enable session idle timeout and locking")
-	flag.BoolVar(&lockOnAuthFailure, "lock-on-auth-failure", true, "lock session on authentication failures")
-	flag.BoolVar(&enableAuditLog, "enable-audit-log", false, "enable structured audit logging to file")
-	flag.IntVar(&auditLogRetentionDays, "audit-log-retention-days", 30, "number of days to keep audit logs (0 = keep all)")
+	flag.IntVar(&ttlSec, "ttl", daemonConfig.TTLSeconds, "cache TTL seconds")
+	flag.StringVar(&sock, "sock", "", "unix socket path, recorded for clients (default: $OPX_SOCKET, else XDG data dir or ~/.op-authd/socket.sock)")
+	flag.StringVar(&lockFile, "lock-file", daemonConfig.LockFile, "single-instance lockfile (default: opx-authd.lock in the runtime dir)")
+	flag.BoolVar(&verbose, "verbose", daemonConfig.Verbose, "verbose logging")
+	flag.StringVar(&backendName, "backend", daemonConfig.Backend, "backend: opcli|fake|vault|bao|multi")
+	flag.IntVar(&sessionTimeout, "session-timeout", daemonConfig.SessionTimeoutHours, "session idle timeout in hours (0 to disable)")
+	flag.BoolVar(&enableSessionLock, "enable-session-lock", daemonConfig.EnableSessionLock, "enable session idle timeout and locking")
+	flag.BoolVar(&lockOnAuthFailure, "lock-on-auth-failure", daemonConfig.LockOnAuthFailure, "lock session on authentication failures")
+	flag.IntVar(&sessionUseCountLimit, "session-use-count-limit", daemonConfig.SessionUseCountLimit, "lock the session after serving this many reads (0 = no limit)")
+	flag.BoolVar(&enableAuditLog, "enable-audit-log", daemonConfig.EnableAuditLog, "enable structured audit logging to file")
+	flag.IntVar(&auditLogRetentionDays, "audit-log-retention-days", daemonConfig.AuditLogRetentionDays, "number of days to keep audit logs (0 = keep all)")
+	flag.Int64Var(&auditLogMaxBytes, "audit-log-max-bytes", daemonConfig.AuditLogMaxBytes, "also rotate the day's audit log once it reaches this size (0 = rotate daily only)")
+	flag.BoolVar(&auditTamperEvident, "audit-tamper-evident", daemonConfig.AuditTamperEvident, "seal each audit log line with an HMAC chained to the previous one (check with opx audit verify)")
+	flag.IntVar(&compressMinBytes, "compress-min-bytes", daemonConfig.CompressMinBytes, "gzip read/resolve responses at least this many bytes (0 to disable)")
+	flag.DurationVar(&refreshInterval, "refresh-interval", time.Duration(daemonConfig.RefreshIntervalSeconds)*time.Second, "proactively refresh hot cache entries this often, before they expire (0 to disable)")
+	flag.IntVar(&refreshMaxEntries, "refresh-max-entries", daemonConfig.RefreshMaxEntries, "maximum number of most-read entries refreshed per pass")
+	flag.BoolVar(&auditIncludeCmdline, "audit-include-cmdline", daemonConfig.AuditIncludeCmdline, "record peer command lines (password=/token=/secret= values redacted) in audit events")
+	flag.IntVar(&auditCmdlineMax, "audit-cmdline-max", daemonConfig.AuditCmdlineMaxBytes, "truncate recorded command lines to this many bytes")
+	flag.DurationVar(&readTimeout, "read-timeout", time.Duration(daemonConfig.ReadTimeoutSeconds)*time.Second, "give up on a single read after this long (0 to disable)")
+	flag.DurationVar(&readsTimeout, "reads-timeout", time.Duration(daemonConfig.ReadsTimeoutSeconds)*time.Second, "give up on a batch read after this long (0 to disable)")
+	flag.DurationVar(&resolveTimeout, "resolve-timeout", time.Duration(daemonConfig.ResolveTimeoutSeconds)*time.Second, "give up on an env resolve after this long (0 to disable)")
+	flag.DurationVar(&backendReadTimeout, "backend-read-timeout", time.Duration(daemonConfig.BackendReadTimeoutSeconds)*time.Second, "give up on a backend read after this long, even once its requests have timed out (0 to disable)")
+	flag.DurationVar(&opApprovalTimeout, "op-approval-timeout", time.Duration(daemonConfig.OpApprovalTimeoutSeconds)*time.Second, "fail an op call with approval_required once it has waited this long on a 1Password app approval prompt (0 to wait for the read timeouts)")
+	flag.StringVar(&tlsKeyType, "tls-key-type", daemonConfig.TLSKeyType, "required daemon certificate key type: rsa|ecdsa (a cert of another type is regenerated)")
+	flag.IntVar(&tlsMinKeyBits, "tls-min-key-bits", daemonConfig.TLSMinKeyBits, "regenerate the daemon certificate if its key is smaller (0 = 2048 for rsa, 256 for ecdsa)")
+	flag.Int64Var(&maxRequestBytes, "max-request-bytes", daemonConfig.MaxRequestBytes, "reject request bodies larger than this with 413 (0 = 1 MiB)")
+	flag.IntVar(&maxRefsPerRequest, "max-refs-per-request", daemonConfig.MaxRefsPerRequest, "reject batch reads and resolves with more refs than this with 400 (0 = 1000)")
+	flag.Int64Var(&maxValueBytes, "max-value-bytes", daemonConfig.MaxValueBytes, "refuse to cache or return secret values larger than this (0 = 1 MiB)")
+	flag.BoolVar(&allowDebug, "allow-debug", daemonConfig.AllowDebug, "include underlying error details in responses to clients that pass opx --debug")
+	flag.BoolVar(&trackSecretChanges, "track-secret-changes", daemonConfig.TrackSecretChanges, "keep a SHA-256 of each cached value and audit SECRET_CHANGED when a refresh reads a different one")
+	flag.BoolVar(&expandRefVars, "expand-ref-vars", daemonConfig.ExpandRefVars, "fill ${VAR} in refs from the vars a request sends (never from the daemon's environment)")
+	flag.StringVar(&expectedAccount, "expected-account", daemonConfig.ExpectedAccount, "lock the session when op whoami reports a different account (UUID, email or sign-in URL)")
+	flag.BoolVar(&redactAccountEmail, "redact-account-email", daemonConfig.RedactAccountEmail, "hide the local part of the signed-in account's email in status and logs")
+	flag.StringVar(&readyFile, "ready-file", daemonConfig.ReadyFile, "write this file atomically once the daemon is ready and remove it on shutdown")
+	flag.BoolVar(&readyWaitBackend, "ready-wait-backend", daemonConfig.ReadyWaitBackend, "hold readiness (--ready-file and systemd READY=1) until the backend answers a ping")
+	flag.IntVar(&refHistoryDays, "ref-history-days", daemonConfig.RefHistoryDays, "offer refs read in the last N days to opx completion (0 = until the 1000-ref cap evicts them)")
+	flag.BoolVar(&disableRefHistory, "disable-ref-history", daemonConfig.DisableRefHistory, "keep no history of the refs clients read, deleting any saved one")
+	flag.DurationVar(&approvalTimeout, "approval-timeout", time.Duration(daemonConfig.ApprovalTimeoutSeconds)*time.Second, "how long a request held by a require_approval rule waits for opx approve, and then for its retry")
+	flag.StringVar(&approvalHook, "approval-hook", daemonConfig.ApprovalHook, "shell command run with OPX_APPROVAL_ID, OPX_APPROVAL_REF and friends when a request starts waiting for approval")
+	flag.StringVar(&approvalWebhook, "approval-webhook", daemonConfig.ApprovalWebhook, "URL each new approval is POSTed to as JSON")
+	flag.BoolVar(&persistApprovals, "persist-approvals", daemonConfig.PersistApprovals, "keep approvals across daemon restarts instead of only in memory")
+	flag.BoolVar(&auditRequired, "audit-required", daemonConfig.AuditRequired, "refuse secret reads with audit_unavailable while audit events can't be written (needs --enable-audit-log)")
+	flag.StringVar(&denialMessage, "denial-message", daemonConfig.DenialMessage, "hint sent to denied clients on how to request access, when neither the rule nor policy.json has one")
+	flag.StringVar(&listenTCP, "listen-tcp", daemonConfig.ListenTCP, "also serve the API on this loopback address (e.g. 127.0.0.1:7070) to clients with a certificate from opx-authd issue-client-cert")
+	flag.BoolVar(&checkConfig, "check-config", false, "validate the configuration, backend health and TLS material, print the effective settings and exit 0 (ok) or 1, without binding the socket")
 	flag.Parse()
 
+	if checkConfig {
+		effective := daemonConfig
+		effective.Backend = backendName
+		effective.TTLSeconds = ttlSec
+		effective.LockFile = lockFile
+		effective.Verbose = verbose
+		effective.SessionTimeoutHours = sessionTimeout
+		effective.EnableSessionLock = enableSessionLock
+		effective.LockOnAuthFailure = lockOnAuthFailure
+		effective.SessionUseCountLimit = sessionUseCountLimit
+		effective.EnableAuditLog = enableAuditLog
+		effective.AuditLogRetentionDays = auditLogRetentionDays
+		effective.AuditLogMaxBytes = auditLogMaxBytes
+		effective.AuditTamperEvident = auditTamperEvident
+		effective.CompressMinBytes = compressMinBytes
+		effective.MaxRequestBytes = maxRequestBytes
+		effective.MaxRefsPerRequest = maxRefsPerRequest
+		effective.MaxValueBytes = maxValueBytes
+		effective.RefreshIntervalSeconds = int(refreshInterval.Seconds())
+		effective.RefreshMaxEntries = refreshMaxEntries
+		effective.AuditIncludeCmdline = auditIncludeCmdline
+		effective.AuditCmdlineMaxBytes = auditCmdlineMax
+		effective.ReadTimeoutSeconds = int(readTimeout.Seconds())
+		effective.ReadsTimeoutSeconds = int(readsTimeout.Seconds())
+		effective.ResolveTimeoutSeconds = int(resolveTimeout.Seconds())
+		effective.BackendReadTimeoutSeconds = int(backendReadTimeout.Seconds())
+		effective.OpApprovalTimeoutSeconds = int(opApprovalTimeout.Seconds())
+		effective.TLSKeyType = tlsKeyType
+		effective.TLSMinKeyBits = tlsMinKeyBits
+		effective.AllowDebug = allowDebug
+		effective.TrackSecretChanges = trackSecretChanges
+		effective.ExpandRefVars = expandRefVars
+		effective.ExpectedAccount = expectedAccount
+		effective.RedactAccountEmail = redactAccountEmail
+		effective.ReadyFile = readyFile
+		effective.ReadyWaitBackend = readyWaitBackend
+		effective.RefHistoryDays = refHistoryDays
+		effective.DisableRefHistory = disableRefHistory
+		effective.ApprovalTimeoutSeconds = int(approvalTimeout.Seconds())
+		effective.ApprovalHook = approvalHook
+		effective.ApprovalWebhook = approvalWebhook
+		effective.PersistApprovals = persistApprovals
+		effective.DenialMessage = denialMessage
+		effective.AuditRequired = auditRequired
+		effective.ListenTCP = listenTCP
+		os.Exit(runCheckConfig(preflight.Options{Daemon: effective, DaemonPath: daemonPath, DaemonErr: daemonErr}))
+	}
+
+	if refreshInterval > 0 && refreshInterval >= time.Duration(ttlSec)*time.Second {
+		log.Printf("Warning: --refresh-interval %s is not shorter than --ttl %ds; hot entries will be refreshed every pass", refreshInterval, ttlSec)
+	}
+
+	if daemonErr != nil {
+		log.Printf("Warning: failed to load daemon config from %s: %v, using defaults", daemonPath, daemonErr)
+	}
+
 	// Load session configuration from environment/file, then override with flags
 	sessionConfig, err := session.LoadConfig()
 	if err != nil {
@@ -46,10 +205,17 @@ func main() {
 		sessionConfig = session.DefaultConfig()
 	}
 
-	// Override config with command-line flags
-	sessionConfig.SessionIdleTimeout = time.Duration(sessionTimeout) * time.Hour
+	// Override config with command-line flags; an idle timeout saved with
+	// `opx config session set` stands unless --session-timeout is given
+	if saved, err := session.LoadFileConfig(); err != nil || saved.SessionIdleTimeout <= 0 || flagPassed("session-timeout") {
+		sessionConfig.SessionIdleTimeout = time.Duration(sessionTimeout) * time.Hour
+	}
 	sessionConfig.EnableSessionLock = enableSessionLock
 	sessionConfig.LockOnAuthFailure = lockOnAuthFailure
+	// A use count limit from config.json or OPX_SESSION_USE_COUNT_LIMIT stands unless one is set here
+	if sessionUseCountLimit > 0 || flagPassed("session-use-count-limit") {
+		sessionConfig.UseCountLimit = sessionUseCountLimit
+	}
 
 	// Create session manager
 	var sessionManager *session.Manager
@@ -61,49 +227,22 @@ func main() {
 	}
 
 	// Create backend (potentially session-aware)
-	var be backend.Backend
-	switch backendName {
-	case "opcli":
-		if sessionManager != nil {
-			be = backend.NewSessionAwareOpCLI(sessionManager)
-		} else {
-			be = backend.OpCLI{}
-		}
-	case "fake":
-		if sessionManager != nil {
-			be = backend.NewSessionAwareFake(sessionManager)
-		} else {
-			be = backend.Fake{}
-		}
-	case "vault":
-		// TODO: Load vault config from file
-		vaultConfig := backend.VaultConfig{
-			Address:    "http://localhost:8200", // Default local Vault
-			AuthMethod: "token",
-		}
-		be = backend.NewVault(vaultConfig)
-	case "bao":
-		// TODO: Load bao config from file
-		baoConfig := backend.VaultConfig{
-			Address:    "http://localhost:8300", // Default local Bao
-			AuthMethod: "token",
-		}
-		be = backend.NewBao(baoConfig)
-	case "multi":
-		// Create multi-backend with all backends available
-		opBe := backend.OpCLI{}
-		vaultBe := backend.NewVault(backend.VaultConfig{
-			Address:    "http://localhost:8200",
-			AuthMethod: "token",
-		})
-		baoBe := backend.NewBao(backend.VaultConfig{
-			Address:    "http://localhost:8300",
-			AuthMethod: "token",
-		})
-		be = backend.NewMultiBackend(opBe, vaultBe, baoBe, "op")
-	default:
-		log.Fatalf("unknown backend: %s", backendName)
+	baoConfig := backend.DefaultBaoConfig()
+	if backendName == "bao" || backendName == "multi" {
+		baoConfig = loadBaoConfig(verbose)
 	}
+	backend.SetOpEnvPassthrough(daemonConfig.OpEnvPassthrough)
+	be, err := backend.New(backendName, sessionManager, baoConfig, backend.OpCLI{ApprovalTimeout: opApprovalTimeout})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Instrument outermost so hooks see every call, named by the backend that served it
+	var hooks backend.Hooks
+	if sessionManager != nil {
+		hooks = backend.SessionActivityHooks(sessionManager)
+	}
+	be = backend.Instrument(be, hooks)
 
 	// Load access policy
 	accessPolicy, policyPath, err := policy.Load()
@@ -113,6 +252,13 @@ func main() {
 	} else if verbose {
 		log.Printf("Loaded access policy from %s", policyPath)
 	}
+	if daemonConfig.PolicyDefaultDeny != nil {
+		accessPolicy.DefaultDeny = *daemonConfig.PolicyDefaultDeny
+	}
+
+	if auditRequired && !enableAuditLog {
+		log.Fatalf("--audit-required needs --enable-audit-log")
+	}
 
 	// Create audit logger with rotation configuration
 	var auditLogger *audit.Logger
@@ -122,6 +268,10 @@ func main() {
 			CompressOld:   false,
 			RotateOnStart: true,
 			FlushInterval: 5 * time.Second,
+			MaxFileBytes:  auditLogMaxBytes,
+		}
+		if auditTamperEvident {
+			rollerConfig.MACKey = loadAuditKey()
 		}
 		auditLogger, err = audit.NewLoggerWithConfig(true, rollerConfig)
 		if err != nil {
@@ -139,8 +289,19 @@ func main() {
 		log.Printf("Audit logging enabled")
 	}
 
+	refHistoryPath, err := util.RecentRefsPath()
+	if err != nil {
+		log.Printf("Warning: ref history will not be saved: %v", err)
+	}
+	var approvalsPath string
+	if persistApprovals {
+		if approvalsPath, err = util.ApprovalsPath(); err != nil {
+			log.Printf("Warning: approvals will not be saved: %v", err)
+		}
+	}
 	srv := &server.Server{
 		SockPath:    sock,
+		LockPath:    lockFile,
 		Backend:     be,
 		Cache:       cache.New(time.Duration(ttlSec) * time.Second),
 		Session:     sessionManager,
@@ -148,12 +309,218 @@ func main() {
 		PolicyPath:  policyPath,
 		AuditLogger: auditLogger,
 		Verbose:     verbose,
+
+		CompressMinBytes:   compressMinBytes,
+		MaxRequestBytes:    maxRequestBytes,
+		MaxRefsPerRequest:  maxRefsPerRequest,
+		MaxValueBytes:      maxValueBytes,
+		RefreshInterval:    refreshInterval,
+		RefreshMaxEntries:  refreshMaxEntries,
+		ReadTimeout:        readTimeout,
+		ReadsTimeout:       readsTimeout,
+		ResolveTimeout:     resolveTimeout,
+		BackendReadTimeout: backendReadTimeout,
+		AllowDebug:         allowDebug,
+		TrackSecretChanges: trackSecretChanges,
+		ExpandRefVars:      expandRefVars,
+		AdminPaths:         server.DefaultAdminPaths(),
+		PeerInfoRequired:   daemonConfig.PeerInfoRequired,
+		PolicyDefaultDeny:  daemonConfig.PolicyDefaultDeny,
+		VaultAccounts:      daemonConfig.VaultAccounts,
+		AllowedOpFlags:     daemonConfig.AllowedOpFlags,
+		ExpectedAccount:    expectedAccount,
+		RedactAccountEmail: redactAccountEmail,
+		CertPolicy:         util.CertPolicy{KeyType: tlsKeyType, MinBits: tlsMinKeyBits},
+		ReadyFile:          readyFile,
+		ReadyWaitBackend:   readyWaitBackend,
+		RefHistoryPath:     refHistoryPath,
+		RefHistoryMaxAge:   time.Duration(refHistoryDays) * 24 * time.Hour,
+		DisableRefHistory:  disableRefHistory,
+		ApprovalTimeout:    approvalTimeout,
+		ApprovalHook:       approvalHook,
+		ApprovalWebhook:    approvalWebhook,
+		ApprovalsPath:      approvalsPath,
+		DenialMessage:      denialMessage,
+		AuditRequired:      auditRequired,
+		ListenTCP:          listenTCP,
+	}
+	if auditIncludeCmdline {
+		if auditCmdlineMax <= 0 {
+			log.Fatalf("--audit-cmdline-max must be positive when --audit-include-cmdline is set")
+		}
+		srv.AuditCmdlineMax = auditCmdlineMax
 	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
 	if err := srv.Serve(ctx); err != nil {
+		var running *util.AlreadyRunningError
+		if errors.As(err, &running) {
+			log.Fatalf("%v; stop it first or pass a different --lock-file and --sock", err)
+		}
 		log.Fatalf("server error: %v", err)
 	}
 }
+
+// flagPassed reports whether the named flag was set on the command line
+func flagPassed(name string) bool {
+	passed := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			passed = true
+		}
+	})
+	return passed
+}
+
+// loadAuditKey reads the audit MAC key, creating it on first use
+func loadAuditKey() []byte {
+	path, err := util.AuditKeyPath()
+	if err != nil {
+		log.Fatalf("Failed to locate audit key: %v", err)
+	}
+	key, err := util.EnsureToken(path)
+	if err != nil {
+		log.Fatalf("Failed to load audit key %s: %v", path, err)
+	}
+	return []byte(key)
+}
+
+// runCheckConfig prints a preflight report and returns the process exit code
+func runCheckConfig(opts preflight.Options) int {
+	report := preflight.Run(context.Background(), opts)
+	fmt.Print(report.Format())
+	if !report.OK() {
+		return 1
+	}
+	return 0
+}
+
+// loadBaoConfig loads backends/bao.json, falling back to defaults on error
+func loadBaoConfig(verbose bool) backend.BaoConfig {
+	baoConfig, baoPath, err := backend.LoadBaoConfig()
+	if err != nil {
+		log.Printf("Warning: failed to load bao config from %s: %v, using defaults", baoPath, err)
+		return backend.DefaultBaoConfig()
+	}
+	if verbose {
+		log.Printf("Using bao config from %s (address=%s)", baoPath, baoConfig.Address)
+	}
+	return baoConfig
+}
+
+// runGenerateConfig implements `opx-authd generate-config [--output=FILE] [--non-interactive]`
+func runGenerateConfig(args []string) error {
+	fs := flag.NewFlagSet("generate-config", flag.ExitOnError)
+	output := fs.String("output", "", "write the config to FILE instead of stdout")
+	nonInteractive := fs.Bool("non-interactive", false, "skip questions and use all defaults")
+	_ = fs.Parse(args)
+
+	cfg := config.DefaultDaemon()
+	if !*nonInteractive {
+		// Prompts go to stderr so stdout can be redirected to a file
+		var err error
+		if cfg, err = config.Prompt(os.Stdin, os.Stderr); err != nil {
+			return err
+		}
+	}
+
+	if *output == "" {
+		return config.Generate(os.Stdout, cfg, time.Now())
+	}
+
+	var buf strings.Builder
+	if err := config.Generate(&buf, cfg, time.Now()); err != nil {
+		return err
+	}
+	if err := util.WriteFileAtomic(*output, []byte(buf.String()), 0o600); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s\n", *output)
+	return nil
+}
+
+// runIssueClientCert implements `opx-authd issue-client-cert --out FILE [--cn NAME] [--days N]`
+func runIssueClientCert(args []string) error {
+	fs := flag.NewFlagSet("issue-client-cert", flag.ExitOnError)
+	out := fs.String("out", "", "write the bundle to FILE (required)")
+	cn := fs.String("cn", "opx-client", "certificate common name that policy rules match with cert_cn")
+	days := fs.Int("days", 365, "days until the certificate expires")
+	_ = fs.Parse(args)
+
+	if *out == "" {
+		return errors.New("--out is required")
+	}
+	if *days <= 0 {
+		return errors.New("--days must be positive")
+	}
+	ca, err := util.LoadClientCA()
+	if err != nil {
+		return err
+	}
+	tokPath, err := util.TokenPath()
+	if err != nil {
+		return err
+	}
+	tok, err := util.EnsureToken(tokPath)
+	if err != nil {
+		return err
+	}
+	bundle, err := ca.ClientBundle(*cn, time.Duration(*days)*24*time.Hour, tok)
+	if err != nil {
+		return err
+	}
+	if err := util.WriteFileAtomic(*out, bundle, 0o600); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s for cert_cn %q, valid %d days. It holds the daemon token; keep it private.\n", *out, *cn, *days)
+	endpoint := "127.0.0.1:7070"
+	if cfg, _, err := config.Load(); err == nil && cfg.ListenTCP != "" {
+		endpoint = cfg.ListenTCP
+	}
+	fmt.Fprintf(os.Stderr, "On the client: export %s=%s %s=/path/to/%s\n", util.TCPEndpointEnv, endpoint, util.ClientCertEnv, filepath.Base(*out))
+	return nil
+}
+
+// runMigrate implements `opx-authd migrate [--dry-run] [--force]`
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "only print what would be copied")
+	force := fs.Bool("force", false, "overwrite files that already exist in the XDG directories")
+	_ = fs.Parse(args)
+
+	plan, err := util.PlanMigration(*force)
+	if errors.Is(err, util.ErrNoLegacyDir) {
+		fmt.Println("Nothing to migrate: ~/.op-authd does not exist.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	verb := "copy"
+	if *dryRun {
+		verb = "would copy"
+	}
+	for _, step := range plan.Steps {
+		if step.Skip != "" {
+			fmt.Printf("skip  %s (%s)\n", step.Src, step.Skip)
+			continue
+		}
+		fmt.Printf("%s  %s -> %s\n", verb, step.Src, step.Dst)
+	}
+
+	if *dryRun {
+		return nil
+	}
+	if err := plan.Apply(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nMigration complete. opx-authd keeps using %s while it exists;\n", plan.Source)
+	fmt.Printf("once you've checked the copies, stop the daemon and remove it manually:\n  rm -rf %s\n", plan.Source)
+	fmt.Println("Stop an op-authd still serving ~/.op-authd/socket.sock too, or opx keeps using it instead of")
+	fmt.Println("starting a daemon on the XDG socket; opx doctor --sockets shows which daemons are live.")
+	return nil
+}
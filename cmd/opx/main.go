@@ -1,50 +1,175 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
-	"strconv"
+	"os/signal"
+	"slices"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/zach-source/opx/internal/audit"
 	"github.com/zach-source/opx/internal/client"
+	"github.com/zach-source/opx/internal/config"
+	"github.com/zach-source/opx/internal/envfile"
+	"github.com/zach-source/opx/internal/policy"
+	"github.com/zach-source/opx/internal/preflight"
+	"github.com/zach-source/opx/internal/protocol"
+	"github.com/zach-source/opx/internal/session"
+	"github.com/zach-source/opx/internal/util"
 )
 
 func usage() {
 	fmt.Fprintf(os.Stderr, `opx - client for opx-authd
 
 Usage:
-  opx [--account=ACCOUNT] read REF [REF...]
-  opx [--account=ACCOUNT] resolve NAME=REF [NAME=REF ...]
-  opx [--account=ACCOUNT] run --env NAME=REF [--env NAME=REF ...] -- CMD [ARGS...]
-  opx status
-  opx audit [--since=24h] [--interactive]
+  opx [--account=ACCOUNT] [--debug] [--quiet] [--expand-env] [--timing] [--socket-timeout=2s] read [--backend=TYPE] [--format=text|raw|json|base64|tsv] [--labeled] [--retry-on-lock] REF [REF...]
+  opx [--account=ACCOUNT] read --watch=INTERVAL [--count=N] [--format=text|json] [--on-change=CMD] REF
+  opx [--account=ACCOUNT] read --checksum-only [--backend=TYPE] REF
+  opx [--account=ACCOUNT] resolve [--export-file=PATH] [--verbose] NAME=REF [NAME=REF ...]
+  opx [--account=ACCOUNT] resolve --checksums NAME=REF [NAME=REF ...]
+  opx [--account=ACCOUNT] run [--keep-session-alive] [--exit-on-secret-change [--poll=30s]] [--resolve-args] [--verbose] --env NAME=REF [--env NAME=REF ...] -- CMD [ARGS...]
+  opx [--account=ACCOUNT] run [FLAGS] NAME=REF [NAME=REF ...] -- CMD [ARGS...]
+  opx [--account=ACCOUNT] create --vault=VAULT --title=TITLE [--category=Login] [--dry-run] FIELD=VALUE [FIELD=VALUE ...]
+  opx run --dump-refs [--resolve-args] --env NAME=REF [--env NAME=REF ...] [-- CMD [ARGS...]]
+  opx status [--backend] [--json]
+  opx why --ref=REF [--path=PATH] [--pid=PID] [--container-path=PATH] [--container-id=ID] [--cert-cn=NAME] [--action=read]
+  opx approvals [--json]
+  opx approve [--deny] ID
+  opx cache expiring [--within=5m]
+  opx cache refresh [--within=5m] [REF...]
+  opx audit [--since=24h] [--interactive] [--follow] [--path=TEXT|GLOB] [--ref-prefix=PREFIX] [--min-count=N] [--cmdline-contains=TEXT]
+  opx audit stats [--since=24h]
+  opx audit verify [FILE...]
+  opx audit apply (--allow=INDEX:LEVEL,... | --decisions=FILE) [--dry-run] [--json] [AUDIT FLAGS]
+  opx audit export [--since=24h] [--format=csv|jsonl] [--aggregate=daily] [--out=FILE]
+  opx audit query --operation=ID [--since=24h] [--json]
   opx login [--account=ACCOUNT]
   opx vault-login [--address=URL] [--method=userpass]
+  opx config session set idle-timeout DURATION
+  opx policy grant --path=PATH --ref=REF [--ref=REF ...] [--action=read] --ttl=1h
+  opx policy list [--usage]
+  opx policy reload
+  opx doctor --daemon-config
+  opx doctor --sockets
+  opx paths [--json]
+  opx completion bash
 
 Commands:
   read                  # Read secret references (op://, vault://, bao://)
   resolve              # Resolve environment variables  
   run                  # Run command with resolved env vars
+  create               # Create a 1Password item (VALUE op://generate generates a password)
   status               # Check daemon status
+  why                  # Explain how the access policy decides a ref, rule by rule (admin only)
+  approvals            # List requests require_approval policy rules are holding (admin only)
+  approve              # Let the held request's next retry through once, or --deny it (admin only)
+  cache                # List soon-expiring cache entries or re-read them early
   audit                # Manage access control policies
   login                # Login to 1Password account
   vault-login          # Login to HashiCorp Vault or OpenBao
+  config               # Save the session idle timeout to config.json and reload it in a running daemon
+  policy               # Add a temporary allow rule to policy.json that expires after --ttl, list
+                       # the rules (--usage adds read-quota counts) or reload it into the daemon
+  doctor               # Validate daemon.json, policy, TLS and backend health like opx-authd -check-config,
+                       # or with --sockets show which sockets have a live daemon
+  paths                # Print the state, data, config and runtime dirs, socket and token opx uses,
+                       # and whether XDG variables, defaults or the legacy ~/.op-authd chose each
+  completion           # Print a bash completion script; read completes refs this machine recently read
 
 Global Flags:
   --account=ACCOUNT     # 1Password account to use
+  --debug               # Show the daemon's underlying error details (needs opx-authd --allow-debug), and a denial's ref and audit log
+  --quiet               # Don't print error details to stderr; the exit code still tells what failed
+  --socket-timeout=2s   # How long connecting to the daemon socket may take before it counts as
+                        # unreachable (a stale or hung socket triggers autostart)
+  --expand-env          # Expand ${VAR} and $VAR in refs given to read, resolve and run from
+                        # opx's own environment before sending them (unset variables are an error)
+  --timing              # Print a latency breakdown to stderr: daemon check/autostart, connect and
+                        # TLS handshake, round trips, and the daemon's cache, queue and backend time
+
+Read Flags:
+  --backend=TYPE       # Force op|vault|bao|awssm|azurekv|gcpsm on a multi-backend daemon
+  --watch=30s          # Re-read a single ref every interval until Ctrl-C
+  --count=N            # With --watch, stop after N reads
+  --format=FORMAT      # text (default), raw (exact bytes, one ref), json (map keyed by ref
+                       # for several refs), base64 or tsv (REF<TAB>VALUE with \t, \n, \r
+                       # and \\ escaped); with --watch, text or json per read. Lines
+                       # follow the order refs were given
+  --on-change=CMD      # With --watch, run CMD via /bin/sh when the value changes
+  --labeled            # Print FIELD=VALUE (fields of one item) or REF=VALUE; text output
+                       # for several refs is labeled by default, a single ref stays bare
+  --retry-on-lock      # If the session is locked, unlock it (running op signin on a terminal
+                       # when the daemon can't) and retry each ref once
+  --checksum-only      # Print the value's SHA-256 (hex) instead of the value, to detect changes;
+                       # the daemon hashes it, so the value never reaches opx
+
+Resolve Flags:
+  --export-file=PATH   # Write a 0600 dotenv file atomically instead of printing
+  --verbose            # Print cache/backend freshness per name to stderr (never values)
+  --only-missing       # Skip mappings whose NAME is already set in the environment (also for run)
+  --checksums          # Print NAME=SHA256 per mapping instead of the values, which stay in the daemon
+
+Run Flags:
+  --keep-session-alive     # Keep the daemon session from idling out while CMD runs
+  --exit-on-secret-change  # Stop CMD and exit 75 when a resolved value changes
+  --poll=30s               # How often --exit-on-secret-change re-resolves
+  --inherit-env-file=FILE  # Load NAME=REF lines from FILE; "include PATH" pulls in another
+                           # file relative to it, later lines and includes win, --env wins last
+  --print-env              # Print the final NAME=REF mappings with where each was defined, then exit
+  --only-missing           # Leave variables that are already set alone; only resolve the others
+
+Create Flags:
+  --vault=VAULT        # Vault to create the item in (required)
+  --title=TITLE        # Item title (required)
+  --category=Login     # 1Password item category
+  --dry-run            # Validate and check the policy, then show what would be created without creating it
+
+Cache Flags:
+  --within=5m          # expiring: window to list; refresh: also re-read entries
+                       # expiring this soon (refresh needs REFs or --within)
 
 Audit Flags:
-  --since=24h          # Show denials from last 24 hours (default)
+  --since=24h          # Show denials from last 24 hours (default); 7d for days
   --interactive        # Interactive policy management
+  --follow             # Stream audit events live (requires --enable-audit-log)
+  --group-by=path      # Group denials by path (default), vault or ref
+  --top=N              # Only show the N most denied groups
+  --path=TEXT|GLOB     # Only show denials whose executable path contains TEXT or matches GLOB
+  --ref-prefix=PREFIX  # Only show denials of refs starting with PREFIX
+  --min-count=N        # Only show denials that happened at least N times
+  --cmdline-contains=S # Only show events whose peer command line contains S
+                       # (requires opx-authd --audit-include-cmdline)
+  verify [FILE...]     # Check the MAC chain of opx-authd --audit-tamper-evident logs
+                       # (default: all of them); exits 1 if a line was edited or removed
+  apply                # Add the rules --interactive would without prompting, for automation:
+                       # --allow=1:exact,3:vault,g2:any (LEVEL is exact, vault, any or the
+                       # interactive choice number) or --decisions=FILE ('-' for stdin);
+                       # the audit flags must match the opx audit run that was reviewed
+  --dry-run            # With apply, print the policy diff without writing it
+  query                # Every event of one resolve or run: its RESOLVE summary of
+                       # NAME=REF pairs and each read's decision, by --operation=ID
+
+Exit Codes:
+  0 success, 1 other error, 2 usage, 3 daemon unreachable, 4 unauthorized,
+  5 policy denied, 6 not found or deleted, 7 backend error or timeout,
+  8 session locked, 75 secret changed (run --exit-on-secret-change);
+  run exits with the command's own status once it has started
 
 Environment:
   OPX_AUTOSTART=0       # disable daemon autostart
+  OPX_SOCKET=PATH       # daemon socket (default: the path opx-authd recorded, else the data dir)
+  OPX_TCP_ENDPOINT=ADDR # dial a daemon's --listen-tcp address instead of a socket (needs OPX_CLIENT_CERT)
+  OPX_CLIENT_CERT=FILE  # client certificate bundle from opx-authd issue-client-cert
 
 Examples:
   opx --account=YOPUYSOQIRHYVGIV3IQ5CS627Y read op://Private/ClaudeCodeLongLiveCreds/credential
@@ -52,13 +177,94 @@ Examples:
   opx resolve DB_PASSWORD=op://vault/database/password
 
 `)
-	os.Exit(2)
+	os.Exit(client.ExitUsage)
+}
+
+// quiet suppresses error detail on stderr; exit codes are unchanged
+var quiet bool
+
+// debug asks the daemon for error details and shows a denial's ref and audit log
+var debug bool
+
+// expandEnv expands variables in refs from opx's environment before they reach the daemon
+var expandEnv bool
+
+// expandRefs applies --expand-env to refs, exiting with a usage error on an unset variable
+func expandRefs(refs []string) []string {
+	if !expandEnv {
+		return refs
+	}
+	expanded, err := client.ExpandRefs(refs, client.EnvVars())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(client.ExitUsage)
+	}
+	return expanded
+}
+
+// expandEnvMappings applies --expand-env to the refs of NAME=REF mappings
+func expandEnvMappings(env map[string]string) map[string]string {
+	if !expandEnv {
+		return env
+	}
+	expanded, err := client.ExpandEnvMappings(env, client.EnvVars())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(client.ExitUsage)
+	}
+	return expanded
+}
+
+// timing is set by --timing and measured from process start
+var (
+	timing      *client.Timing
+	timingStart = time.Now()
+	timingOnce  sync.Once
+)
+
+// reportTiming prints the --timing breakdown to stderr, once
+func reportTiming() {
+	if timing == nil {
+		return
+	}
+	timingOnce.Do(func() {
+		fmt.Fprintln(os.Stderr, "opx "+timing.Summary(time.Since(timingStart)))
+	})
+}
+
+// fail reports err with prefix unless --quiet and exits with its stable exit code
+func fail(prefix string, err error) {
+	if !quiet {
+		if denial := client.FormatDenial(prefix, err, debug, todaysAuditLog()); denial != "" {
+			fmt.Fprint(os.Stderr, denial)
+		} else if prefix != "" {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", prefix, err)
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	reportTiming()
+	os.Exit(client.ExitCode(err))
+}
+
+// todaysAuditLog is where the daemon is recording today's decisions, or "" if it isn't
+func todaysAuditLog() string {
+	roller, err := audit.NewRoller(audit.RollerConfig{})
+	if err != nil {
+		return ""
+	}
+	path := roller.GetLogForDate(time.Now())
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
 }
 
 func main() {
 	// Parse global flags
 	var account string
 	var opFlags []string
+	var socketTimeout time.Duration
 
 	// Find the subcommand position (first non-flag argument)
 	cmdPos := -1
@@ -74,6 +280,21 @@ func main() {
 				opFlags = append(opFlags, "--account="+account)
 			}
 			i++ // skip the next argument
+		} else if arg == "--debug" {
+			debug = true
+		} else if arg == "--quiet" {
+			quiet = true
+		} else if arg == "--expand-env" {
+			expandEnv = true
+		} else if arg == "--timing" {
+			timing = &client.Timing{}
+		} else if strings.HasPrefix(arg, "--socket-timeout=") {
+			d, err := time.ParseDuration(strings.TrimPrefix(arg, "--socket-timeout="))
+			if err != nil || d <= 0 {
+				fmt.Fprintf(os.Stderr, "invalid --socket-timeout %q: want a positive duration like 2s\n", strings.TrimPrefix(arg, "--socket-timeout="))
+				os.Exit(client.ExitUsage)
+			}
+			socketTimeout = d
 		} else if !strings.HasPrefix(arg, "--") {
 			cmdPos = i + 1 // +1 because we're iterating over os.Args[1:]
 			break
@@ -90,15 +311,54 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
+	// Review what a wrapped command would be given without contacting the daemon
+	if cmd == "run" {
+		opts := parseRunArgs(cmdArgs)
+		if opts.PrintEnv {
+			fmt.Print(envfile.Format(opts.Mappings))
+			return
+		}
+		if opts.DumpRefs {
+			var args map[int]string
+			if opts.ResolveArgs {
+				args = client.ArgRefs(opts.ExecArgs)
+			}
+			fmt.Print(client.FormatRefDump(opts.Env, args))
+			return
+		}
+	}
+
+	if cmd == "completion" {
+		if len(cmdArgs) != 1 || cmdArgs[0] != "bash" {
+			fmt.Fprintln(os.Stderr, "usage: opx completion bash")
+			os.Exit(client.ExitUsage)
+		}
+		fmt.Print(client.BashCompletion)
+		return
+	}
+
+	// The config check runs locally, so it works before the daemon or its certificate exist
+	if cmd == "doctor" {
+		handleDoctorCommand(cmdArgs)
+		return
+	}
+	if cmd == "paths" {
+		handlePathsCommand(cmdArgs)
+		return
+	}
+
 	cli, err := client.New()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "client init:", err)
-		os.Exit(1)
+		fail("client init", err)
 	}
+	cli.Debug = debug
+	cli.SocketTimeout = socketTimeout
+	cli.Timing = timing
+	defer reportTiming()
 	// Handle commands that don't need daemon connection
 	switch cmd {
 	case "audit":
-		handleAuditCommand(cmdArgs)
+		handleAuditCommand(cli, cmdArgs)
 		return
 	case "login":
 		handleLoginCommand(opFlags)
@@ -106,154 +366,816 @@ func main() {
 	case "vault-login":
 		handleVaultLoginCommand(cmdArgs)
 		return
+	case "config":
+		handleConfigCommand(ctx, cli, cmdArgs)
+		return
+	case "policy":
+		handlePolicyCommand(ctx, cli, cmdArgs)
+		return
+	case "__complete-ref":
+		// Completion must stay fast and quiet: no autostart, no errors, a short deadline
+		cctx, ccancel := context.WithTimeout(ctx, 5*time.Second)
+		defer ccancel()
+		prefix := ""
+		if len(cmdArgs) > 0 {
+			prefix = cmdArgs[0]
+		}
+		for _, ref := range cli.CompleteRef(cctx, prefix, opFlags) {
+			fmt.Println(ref)
+		}
+		return
 	}
 
 	if err := cli.EnsureReady(ctx); err != nil {
-		fmt.Fprintln(os.Stderr, "daemon:", err)
-		os.Exit(1)
+		fail("daemon", err)
 	}
 
 	switch cmd {
 	case "status":
+		fs := flag.NewFlagSet("status", flag.ExitOnError)
+		var probe, asJSON bool
+		fs.BoolVar(&probe, "backend", false, "probe and show each sub-backend of a multi-backend daemon")
+		fs.BoolVar(&asJSON, "json", false, "print the daemon's full status as JSON, including per-scheme and per-vault counters")
+		_ = fs.Parse(cmdArgs)
 		if err := cli.Ping(ctx); err != nil {
-			fmt.Fprintln(os.Stderr, "status:", err)
-			os.Exit(1)
+			fail("status", err)
+		}
+		if asJSON {
+			status := cli.Status
+			if probe {
+				status = cli.ProbeBackends
+			}
+			st, err := status(ctx)
+			if err != nil {
+				fail("status", err)
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(st)
+			return
 		}
 		fmt.Println("ok")
+		if warning := cli.SplitDaemonsWarning(); warning != "" {
+			fmt.Fprintln(os.Stderr, "warning:", warning)
+		}
+		if probe {
+			st, err := cli.ProbeBackends(ctx)
+			if err != nil {
+				fail("status", err)
+			}
+			fmt.Print(client.UptimeSummary(st))
+			fmt.Print(client.BackendSummary(st))
+			fmt.Print(client.CacheSummary(st))
+			return
+		}
+		if st, err := cli.Status(ctx); err == nil {
+			fmt.Print(client.UptimeSummary(st))
+			fmt.Print(client.CacheSummary(st))
+			fmt.Print(client.AuditSummary(st))
+			fmt.Print(client.SessionSummary(st))
+			if warning := client.SocketMismatch(st, cli.SocketPath()); warning != "" {
+				fmt.Fprintln(os.Stderr, "warning:", warning)
+			}
+		}
+	case "cache":
+		handleCacheCommand(ctx, cli, cmdArgs)
 	case "read":
-		if len(cmdArgs) < 1 {
+		fs := flag.NewFlagSet("read", flag.ExitOnError)
+		var secretType string
+		var watch time.Duration
+		var count int
+		var format string
+		var onChange string
+		var labeled, retryLocked, checksumOnly bool
+		fs.StringVar(&secretType, "backend", "", "force a backend on a multi-backend daemon: "+strings.Join(protocol.SecretTypes, "|"))
+		fs.DurationVar(&watch, "watch", 0, "re-read a single ref every interval until interrupted")
+		fs.IntVar(&count, "count", 0, "with --watch, stop after N reads (0 = until interrupted)")
+		fs.StringVar(&format, "format", client.FormatText, "output format: "+strings.Join(client.ReadFormats, "|")+" (text|json with --watch)")
+		fs.StringVar(&onChange, "on-change", "", "with --watch, run this shell command whenever the value changes")
+		fs.BoolVar(&labeled, "labeled", false, "prefix each value with its field name (fields of one item) or ref; the default for several refs")
+		fs.BoolVar(&retryLocked, "retry-on-lock", false, "if the session is locked, unlock it (signing in with op when on a terminal) and retry each ref once")
+		fs.BoolVar(&checksumOnly, "checksum-only", false, "print the SHA-256 of the value instead of the value, which never leaves the daemon")
+		_ = fs.Parse(cmdArgs)
+		refs := expandRefs(fs.Args())
+		if len(refs) < 1 {
 			usage()
 		}
-		refs := cmdArgs
-		if len(refs) == 1 {
-			rr, err := cli.ReadWithFlags(ctx, refs[0], opFlags)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-				os.Exit(1)
+		if checksumOnly && (len(refs) != 1 || watch > 0 || labeled) {
+			fmt.Fprintln(os.Stderr, "--checksum-only takes exactly one ref and can't be combined with --watch or --labeled")
+			os.Exit(2)
+		}
+		if watch > 0 {
+			if len(refs) != 1 || secretType != "" {
+				fmt.Fprintln(os.Stderr, "--watch takes exactly one ref and can't be combined with --backend")
+				os.Exit(2)
 			}
-			fmt.Print(rr.Value)
-			if !strings.HasSuffix(rr.Value, "\n") {
-				fmt.Print("\n")
+			if format != "text" && format != "json" {
+				fmt.Fprintf(os.Stderr, "unknown --format %q (want text or json)\n", format)
+				os.Exit(2)
 			}
+			watchRead(cli, refs[0], opFlags, watch, count, format, onChange)
 			return
 		}
-		rrs, err := cli.ReadsWithFlags(ctx, refs, opFlags)
+		if !protocol.ValidSecretType(secretType) {
+			fmt.Fprintf(os.Stderr, "unknown --backend %q (want %s)\n", secretType, strings.Join(protocol.SecretTypes, ", "))
+			os.Exit(2)
+		}
+		if !slices.Contains(client.ReadFormats, format) {
+			fmt.Fprintf(os.Stderr, "unknown --format %q (want %s)\n", format, strings.Join(client.ReadFormats, ", "))
+			os.Exit(2)
+		}
+		if format == client.FormatRaw && len(refs) != 1 {
+			fmt.Fprintln(os.Stderr, "--format raw takes exactly one ref")
+			os.Exit(2)
+		}
+		if format == client.FormatRaw && labeled {
+			fmt.Fprintln(os.Stderr, "--format raw can't be combined with --labeled")
+			os.Exit(2)
+		}
+		if retryLocked {
+			cli.RetryOnLock = true
+			if isTerminal(os.Stdin) {
+				cli.SignIn = func(ctx context.Context) error {
+					fmt.Fprintln(os.Stderr, "Session is locked; signing in to 1Password...")
+					signin := opSignin(ctx, opFlags)
+					signin.Stdout = os.Stderr // keep stdout for the secret
+					return signin.Run()
+				}
+			}
+		}
+		if checksumOnly {
+			sum, err := cli.ReadChecksum(ctx, refs[0], opFlags, secretType)
+			if err != nil {
+				fail("", err)
+			}
+			fmt.Println(sum)
+			return
+		}
+		results := make(map[string]protocol.ReadResponse, len(refs))
+		// Batch reads report per-ref errors inline, so a locked session is only seen ref by ref
+		if len(refs) == 1 || secretType != "" || retryLocked {
+			for _, ref := range refs {
+				rr, err := cli.ReadWithSecretType(ctx, ref, opFlags, secretType)
+				if err != nil {
+					fail("", err)
+				}
+				results[ref] = rr
+			}
+		} else {
+			rrs, err := cli.ReadsWithFlags(ctx, refs, opFlags)
+			if err != nil {
+				fail("", err)
+			}
+			results = rrs.Results
+		}
+		out, err := client.FormatReads(format, labeled, refs, results)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
+			os.Exit(2)
+		}
+		_, _ = os.Stdout.Write(out)
+	case "create":
+		fs := flag.NewFlagSet("create", flag.ExitOnError)
+		var req protocol.CreateRequest
+		fs.StringVar(&req.Vault, "vault", "", "vault to create the item in")
+		fs.StringVar(&req.Title, "title", "", "item title")
+		fs.StringVar(&req.Category, "category", "", "item category (default Login)")
+		fs.BoolVar(&req.DryRun, "dry-run", false, "validate and check the policy, then show what would be created without creating it")
+		_ = fs.Parse(cmdArgs)
+		if req.Vault == "" || req.Title == "" || fs.NArg() < 1 {
+			usage()
+		}
+		fields, err := client.ParseItemFields(fs.Args())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		req.Fields = fields
+		req.Flags = opFlags
+		resp, err := cli.Create(ctx, req)
+		if err != nil {
+			fail("create", err)
+		}
+		if resp.DryRun {
+			fmt.Print(client.FormatCreatePlan(resp))
+			return
+		}
+		fmt.Println(resp.Ref)
+	case "why":
+		fs := flag.NewFlagSet("why", flag.ExitOnError)
+		var req protocol.PolicyExplainRequest
+		fs.StringVar(&req.Ref, "ref", "", "ref to explain the policy decision for")
+		fs.StringVar(&req.Path, "path", "", "explain for this binary path instead of the calling process")
+		fs.IntVar(&req.PID, "pid", 0, "explain for this PID instead of the calling process")
+		fs.StringVar(&req.ContainerPath, "container-path", "", "explain for a caller running this binary path inside a container")
+		fs.StringVar(&req.ContainerID, "container-id", "", "explain for a caller in the container with this ID")
+		fs.StringVar(&req.CertCN, "cert-cn", "", "explain for a TCP client whose certificate has this common name")
+		fs.StringVar(&req.Action, "action", "read", "action to check: read|write|create")
+		_ = fs.Parse(cmdArgs)
+		if req.Ref == "" && fs.NArg() == 1 {
+			req.Ref = fs.Arg(0)
+		}
+		if req.Ref == "" {
+			usage()
 		}
-		for _, ref := range refs {
-			rr := rrs.Results[ref]
-			fmt.Println(rr.Value)
+		resp, err := cli.ExplainPolicy(ctx, req)
+		if err != nil {
+			fail("why", err)
+		}
+		fmt.Print(client.FormatExplanation(resp))
+	case "approvals":
+		fs := flag.NewFlagSet("approvals", flag.ExitOnError)
+		var asJSON bool
+		fs.BoolVar(&asJSON, "json", false, "print the approvals as JSON")
+		_ = fs.Parse(cmdArgs)
+		approvals, err := cli.Approvals(ctx)
+		if err != nil {
+			fail("approvals", err)
+		}
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(approvals)
+			return
+		}
+		fmt.Print(client.FormatApprovals(approvals, time.Now()))
+	case "approve":
+		fs := flag.NewFlagSet("approve", flag.ExitOnError)
+		var deny bool
+		fs.BoolVar(&deny, "deny", false, "deny the request instead; retries fail until the approval expires")
+		_ = fs.Parse(cmdArgs)
+		if fs.NArg() != 1 {
+			usage()
 		}
+		ap, err := cli.DecideApproval(ctx, fs.Arg(0), deny)
+		if err != nil {
+			fail("approve", err)
+		}
+		if deny {
+			fmt.Printf("denied %s: %s for %s\n", ap.ID, ap.Ref, ap.PeerPath)
+			return
+		}
+		fmt.Printf("approved %s: %s may %s %s once before %s\n", ap.ID, ap.PeerPath, ap.Action, ap.Ref, time.Unix(ap.ExpiresAt, 0).Format(time.Kitchen))
 	case "resolve":
-		if len(cmdArgs) < 1 {
+		fs := flag.NewFlagSet("resolve", flag.ExitOnError)
+		var exportFile string
+		var verbose, onlyMissing, checksums bool
+		fs.StringVar(&exportFile, "export-file", "", "write a 0600 dotenv file instead of printing")
+		fs.BoolVar(&verbose, "verbose", false, "print where each value came from (cache or backend) to stderr")
+		fs.BoolVar(&onlyMissing, "only-missing", false, "skip mappings whose NAME is already set in the environment")
+		fs.BoolVar(&checksums, "checksums", false, "print NAME=SHA256 of each value instead of the values, which never leave the daemon")
+		_ = fs.Parse(cmdArgs)
+		mappings := fs.Args()
+		if len(mappings) < 1 {
 			usage()
 		}
-		envmap := map[string]string{}
-		for _, kv := range cmdArgs {
-			parts := strings.SplitN(kv, "=", 2)
-			if len(parts) != 2 {
-				fmt.Fprintf(os.Stderr, "bad mapping: %s\n", kv)
-				os.Exit(1)
-			}
-			envmap[parts[0]] = parts[1]
+		if checksums && exportFile != "" {
+			fmt.Fprintln(os.Stderr, "--checksums can't be combined with --export-file")
+			os.Exit(client.ExitUsage)
 		}
-		resp, err := cli.ResolveWithFlags(ctx, envmap, opFlags)
+		envmap, err := client.ParseEnvMappings(mappings)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
-		}
-		for k, v := range resp.Env {
-			fmt.Printf("%s=%s\n", k, v)
+			os.Exit(client.ExitUsage)
 		}
-	case "run":
-		// parse flags until --
-		fs := flag.NewFlagSet("run", flag.ExitOnError)
-		var envs multiFlag
-		fs.Var(&envs, "env", "NAME=REF mapping (repeatable)")
-		// find -- in the remaining cmdArgs
-		sep := -1
-		for i, a := range cmdArgs {
-			if a == "--" {
-				sep = i
-				break
+		if onlyMissing {
+			var skipped []string
+			envmap, skipped = client.OnlyMissing(envmap, client.EnvVars())
+			if verbose && len(skipped) > 0 {
+				fmt.Fprintf(os.Stderr, "opx: --only-missing kept the environment's %s\n", strings.Join(skipped, ", "))
 			}
 		}
-		if sep == -1 {
-			usage()
+		envmap = expandEnvMappings(envmap)
+		if checksums {
+			sums, err := cli.ResolveChecksums(ctx, envmap, opFlags)
+			if err != nil {
+				fail("", err)
+			}
+			for _, name := range client.EnvNames(mappings) {
+				if sum, ok := sums[name]; ok {
+					fmt.Printf("%s=%s\n", name, sum)
+				}
+			}
+			return
 		}
-		_ = fs.Parse(cmdArgs[:sep])
-		execArgs := cmdArgs[sep+1:]
-		if len(execArgs) == 0 {
-			usage()
+		secrets, err := resolveEnv(ctx, cli, envmap, opFlags, verbose)
+		if err != nil {
+			fail("", err)
 		}
-		envmap := map[string]string{}
-		for _, kv := range envs {
-			parts := strings.SplitN(kv, "=", 2)
-			if len(parts) != 2 {
-				fmt.Fprintf(os.Stderr, "bad mapping: %s\n", kv)
-				os.Exit(1)
+		defer secrets.Zero()
+		if exportFile != "" {
+			content, err := util.FormatDotenv(secrets.Strings())
+			if err != nil {
+				fail("export", err)
 			}
-			envmap[parts[0]] = parts[1]
+			if err := util.WriteFileAtomic(exportFile, []byte(content), 0o600); err != nil {
+				fail("export", err)
+			}
+			fmt.Fprintf(os.Stderr, "Wrote %d variables to %s\n", len(secrets), exportFile)
+			return
+		}
+		// Print in the order the mappings were given, not map order
+		if err := secrets.WriteLines(os.Stdout, client.EnvNames(mappings)); err != nil {
+			fail("", err)
 		}
-		resp, err := cli.ResolveWithFlags(ctx, envmap, opFlags)
+	case "run":
+		opts := parseRunArgs(cmdArgs)
+		secrets, err := resolveEnv(ctx, cli, opts.Env, opFlags, opts.Verbose)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
+			fail("", err)
+		}
+		argv := opts.ExecArgs
+		if opts.ResolveArgs {
+			if argv, err = resolveArgRefs(ctx, cli, argv, opFlags); err != nil {
+				fail("", err)
+			}
 		}
-		// Exec locally with injected env
-		cmdExec := exec.CommandContext(ctx, execArgs[0], execArgs[1:]...)
+		// The child's own runtime is not part of opx's latency
+		reportTiming()
+		// Exec locally with injected env. The child is not bound to the request timeout.
+		cmdExec := exec.Command(argv[0], argv[1:]...)
 		cmdExec.Stdout = os.Stdout
 		cmdExec.Stderr = os.Stderr
 		cmdExec.Stdin = os.Stdin
-		cmdExec.Env = os.Environ()
-		for k, v := range resp.Env {
-			cmdExec.Env = append(cmdExec.Env, fmt.Sprintf("%s=%s", k, v))
+		// Only fingerprints outlive the child's start; the values are zeroed right after
+		var baseline map[string][sha256.Size]byte
+		if opts.ExitOnChange {
+			baseline = secrets.Fingerprints()
+		}
+		env, zeroEnv := secrets.Environ(os.Environ())
+		cmdExec.Env = env
+		err = cmdExec.Start()
+		zeroEnv()
+		secrets.Zero()
+		cmdExec.Env = nil
+		if err != nil {
+			fail("", err)
+		}
+		stopKeepAlive := func() {}
+		if opts.KeepSessionAlive {
+			stopKeepAlive = startKeepAlive(cli)
 		}
-		if err := cmdExec.Run(); err != nil {
-			if ee, ok := err.(*exec.ExitError); ok {
-				os.Exit(ee.ExitCode())
+		if opts.ExitOnChange {
+			err = waitOrSecretChange(cli, cmdExec, opts.Env, opFlags, baseline, opts.Poll)
+		} else {
+			err = cmdExec.Wait()
+		}
+		stopKeepAlive()
+		if err != nil {
+			var ee *exec.ExitError
+			if errors.As(err, &ee) {
+				os.Exit(client.ExitCode(err))
 			}
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
+			fail("opx", err)
 		}
 	default:
 		usage()
 	}
 }
 
-type multiFlag []string
+// watchRead prints ref every interval until count reads or SIGINT, running onChange when the value changes
+func watchRead(cli *client.Client, ref string, flags []string, interval time.Duration, count int, format, onChange string) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	enc := json.NewEncoder(os.Stdout)
+	err := cli.WatchRead(ctx, ref, flags, interval, count, func(u client.ReadUpdate) {
+		ts := u.Time.Format(time.RFC3339)
+		switch {
+		case format == "json":
+			out := map[string]any{"time": ts, "ref": ref, "changed": u.Changed}
+			if u.Err != nil {
+				out["error"] = u.Err.Error()
+			} else {
+				out["value"] = u.Response.Value
+				out["from_cache"] = u.Response.FromCache
+			}
+			_ = enc.Encode(out)
+		case u.Err != nil:
+			fmt.Fprintf(os.Stderr, "%s  error: %v\n", ts, u.Err)
+		default:
+			marker := ""
+			if u.Changed {
+				marker = "  (changed)"
+			}
+			fmt.Printf("%s  %s%s\n", ts, strings.TrimRight(u.Response.Value, "\n"), marker)
+		}
+
+		if u.Changed && onChange != "" {
+			hook := exec.CommandContext(ctx, "/bin/sh", "-c", onChange)
+			hook.Stdout = os.Stderr
+			hook.Stderr = os.Stderr
+			if err := hook.Run(); err != nil && ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "opx: --on-change command failed: %v\n", err)
+			}
+		}
+	})
+	if err != nil {
+		fail("", err)
+	}
+}
+
+// handleDoctorCommand implements `opx doctor --daemon-config|--sockets`, exiting 1 if a check fails
+func handleDoctorCommand(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	var daemonConfig, sockets bool
+	fs.BoolVar(&daemonConfig, "daemon-config", false, "check the configuration opx-authd would start with, as opx-authd -check-config does")
+	fs.BoolVar(&sockets, "sockets", false, "show which default sockets have a live daemon and how to consolidate them")
+	_ = fs.Parse(args)
+	if sockets {
+		handleDoctorSockets()
+		return
+	}
+	if !daemonConfig {
+		usage()
+	}
+
+	cfg, path, err := config.Load()
+	if err != nil {
+		cfg = config.DefaultDaemon()
+	}
+	report := preflight.Run(context.Background(), preflight.Options{Daemon: cfg, DaemonPath: path, DaemonErr: err})
+	fmt.Print(report.Format())
+	if !report.OK() {
+		os.Exit(client.ExitFailure)
+	}
+}
+
+// handlePolicyCommand edits, lists or reloads policy.json: grant adds a rule
+// that expires after --ttl, list shows the rules and reload applies the file
+// to a running daemon
+func handlePolicyCommand(ctx context.Context, cli *client.Client, args []string) {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	switch args[0] {
+	case "grant":
+		handlePolicyGrant(ctx, cli, args[1:])
+	case "list":
+		handlePolicyList(ctx, cli, args[1:])
+	case "reload":
+		reloadPolicy(ctx, cli, true)
+	default:
+		fmt.Fprintln(os.Stderr, "usage: opx policy grant --path=PATH --ref=REF [--ref=REF ...] [--action=read] --ttl=1h")
+		fmt.Fprintln(os.Stderr, "       opx policy list [--usage]")
+		fmt.Fprintln(os.Stderr, "       opx policy reload")
+		os.Exit(client.ExitUsage)
+	}
+}
+
+// handlePolicyList prints the allow rules in policy.json, with --usage adding
+// the read-quota counters of the running daemon
+func handlePolicyList(ctx context.Context, cli *client.Client, args []string) {
+	fs := flag.NewFlagSet("policy list", flag.ExitOnError)
+	var withUsage bool
+	fs.BoolVar(&withUsage, "usage", false, "show reads counted against each max_reads rule (needs a running daemon and admin access)")
+	_ = fs.Parse(args)
+
+	pol, policyPath, err := policy.Load()
+	if err != nil {
+		fail("Failed to load policy from "+policyPath, err)
+	}
+	var usage []protocol.QuotaUsage
+	if withUsage {
+		if err := cli.EnsureReady(ctx); err != nil {
+			fail("daemon", err)
+		}
+		if usage, err = cli.PolicyUsage(ctx); err != nil {
+			fail("policy usage", err)
+		}
+	}
+	fmt.Printf("%s\n", policyPath)
+	fmt.Print(client.FormatPolicyList(pol, usage, withUsage))
+}
+
+// reloadPolicy applies policy.json to a running daemon. Unless required, a
+// daemon that isn't running is fine: it reads the file when it starts.
+func reloadPolicy(ctx context.Context, cli *client.Client, required bool) {
+	resp, err := cli.ReloadPolicy(ctx)
+	switch {
+	case err == nil:
+		fmt.Printf("Daemon reloaded %s: %d rules, default_deny %v", resp.PolicyPath, resp.Rules, resp.DefaultDeny)
+		if resp.QuotasKept+resp.QuotasDropped > 0 {
+			fmt.Printf(", kept %d and reset %d read-quota counters", resp.QuotasKept, resp.QuotasDropped)
+		}
+		fmt.Println()
+	case !required && client.ExitCode(err) == client.ExitUnreachable:
+		fmt.Println("Daemon not running; the policy applies when it starts")
+	default:
+		fail("policy reload", err)
+	}
+}
+
+// handlePolicyGrant adds a temporary allow rule to policy.json and reloads the daemon
+func handlePolicyGrant(ctx context.Context, cli *client.Client, args []string) {
+	fs := flag.NewFlagSet("policy grant", flag.ExitOnError)
+	var path string
+	var refs, actions []string
+	var ttl time.Duration
+	fs.StringVar(&path, "path", "", "absolute path of the binary being granted access")
+	fs.Func("ref", "ref to grant, or a prefix ending in * (repeatable)", func(v string) error {
+		refs = append(refs, v)
+		return nil
+	})
+	fs.Func("action", "action to grant: read, write or create (repeatable; default read)", func(v string) error {
+		if !slices.Contains(policy.Actions, strings.ToLower(v)) {
+			return fmt.Errorf("want one of %s", strings.Join(policy.Actions, ", "))
+		}
+		actions = append(actions, strings.ToLower(v))
+		return nil
+	})
+	fs.DurationVar(&ttl, "ttl", 0, "how long the grant lasts, e.g. 1h")
+	_ = fs.Parse(args)
+	if !strings.HasPrefix(path, "/") || len(refs) == 0 || ttl <= 0 {
+		fmt.Fprintln(os.Stderr, "opx policy grant needs an absolute --path, at least one --ref and a positive --ttl")
+		os.Exit(client.ExitUsage)
+	}
+
+	pol, policyPath, err := policy.Load()
+	if err != nil {
+		fail("Failed to load policy from "+policyPath, err)
+	}
+	expires := time.Now().Add(ttl).UTC().Truncate(time.Second)
+	rule := policy.Rule{Path: path, Refs: refs, Actions: actions, ExpiresAt: &expires}
+	pol.Allow = append(pol.Allow, rule)
+	if _, err := policy.Save(policyPath, pol); err != nil {
+		fail("Failed to save policy", err)
+	}
+
+	fmt.Printf("Granted %s\n", rule)
+	if !pol.DefaultDeny {
+		fmt.Println("Note: default_deny is off, so the policy already allows this; the grant only matters once it is on")
+	}
+	fmt.Println("The daemon removes it from policy.json once it expires")
+	reloadPolicy(ctx, cli, false)
+}
+
+// handlePathsCommand prints the paths opx resolves and the rule behind each
+func handlePathsCommand(args []string) {
+	fs := flag.NewFlagSet("paths", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the paths as JSON")
+	_ = fs.Parse(args)
+
+	paths, err := util.ResolvePaths()
+	if err != nil {
+		fail("paths", err)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(paths)
+		return
+	}
+	fmt.Print(util.FormatPaths(paths))
+}
+
+// handleDoctorSockets probes the configured and default sockets, exiting 1 if
+// daemons are split across several
+func handleDoctorSockets() {
+	cli, err := client.New()
+	if err != nil {
+		fail("client init", err)
+	}
+	if endpoint := cli.TCPEndpoint(); endpoint != "" {
+		fmt.Printf("opx dials %s over TCP ($%s); unset it to probe sockets\n", endpoint, util.TCPEndpointEnv)
+		return
+	}
+	probes := cli.ProbeSockets(context.Background())
+	live := 0
+	for _, p := range probes {
+		state := "no daemon"
+		if p.Alive {
+			state = "live"
+			live++
+		}
+		fmt.Printf("%-9s %s\n", state, p.Path)
+	}
+	if advice := client.ConsolidationAdvice(probes); advice != "" {
+		fmt.Print("\n" + advice)
+	}
+	if live > 1 {
+		os.Exit(client.ExitFailure)
+	}
+}
+
+// parseRunArgs parses `opx run` arguments, exiting with a targeted error on bad input
+func parseRunArgs(cmdArgs []string) client.RunOptions {
+	opts, err := client.ParseRunArgs(cmdArgs)
+	if errors.Is(err, flag.ErrHelp) {
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "run:", err)
+		os.Exit(2)
+	}
+	if opts.OnlyMissing {
+		skipped := opts.DropSet(client.EnvVars())
+		if opts.Verbose && len(skipped) > 0 {
+			fmt.Fprintf(os.Stderr, "opx: --only-missing kept the environment's %s\n", strings.Join(skipped, ", "))
+		}
+	}
+	opts.Env = expandEnvMappings(opts.Env)
+	if opts.ResolveArgs {
+		for i, ref := range client.ArgRefs(opts.ExecArgs) {
+			opts.ExecArgs[i] = expandRefs([]string{ref})[0]
+		}
+	}
+	return opts
+}
+
+// resolveEnv resolves env, printing a freshness table (never the values) to stderr when verbose
+func resolveEnv(ctx context.Context, cli *client.Client, env map[string]string, flags []string, verbose bool) (client.SecretEnv, error) {
+	if len(env) == 0 {
+		// Everything was skipped, e.g. by --only-missing
+		return client.SecretEnv{}, nil
+	}
+	secrets, meta, err := cli.ResolveSecrets(ctx, env, flags, verbose)
+	if err != nil {
+		return nil, err
+	}
+	if verbose {
+		fmt.Fprint(os.Stderr, client.FormatResolveMeta(meta))
+	}
+	return secrets, nil
+}
+
+// resolveArgRefs replaces arguments of argv that are secret refs with their values
+func resolveArgRefs(ctx context.Context, cli *client.Client, argv []string, flags []string) ([]string, error) {
+	refs := client.ArgRefs(argv)
+	if len(refs) == 0 {
+		return argv, nil
+	}
+	list := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		list = append(list, ref)
+	}
+	resp, err := cli.ReadsWithFlags(ctx, list, flags)
+	if err != nil {
+		return nil, err
+	}
+	return client.SubstituteArgRefs(argv, refs, resp.Results)
+}
+
+// secretChangeGrace is how long a child gets to exit after SIGTERM before it is killed
+const secretChangeGrace = 10 * time.Second
 
-func (m *multiFlag) String() string     { return strings.Join(*m, ",") }
-func (m *multiFlag) Set(v string) error { *m = append(*m, v); return nil }
+// waitOrSecretChange waits for cmd while re-resolving env every poll. If a value
+// changes first, cmd is stopped and the *client.SecretsChangedError is returned.
+func waitOrSecretChange(cli *client.Client, cmd *exec.Cmd, env map[string]string, flags []string, baseline map[string][sha256.Size]byte, poll time.Duration) error {
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan error, 1)
+	go func() {
+		changed <- cli.WatchSecretFingerprints(ctx, env, flags, baseline, poll, func(err error) {
+			fmt.Fprintln(os.Stderr, "opx: re-resolve failed:", err)
+		})
+	}()
+
+	select {
+	case err := <-exited:
+		return err
+	case err := <-changed:
+		if err == nil {
+			return <-exited
+		}
+		_ = cmd.Process.Signal(syscall.SIGTERM)
+		select {
+		case <-exited:
+		case <-time.After(secretChangeGrace):
+			_ = cmd.Process.Kill()
+			<-exited
+		}
+		return err
+	}
+}
+
+// keepAliveInterval is how often `opx run --keep-session-alive` touches the session
+const keepAliveInterval = time.Minute
+
+// startKeepAlive touches the daemon session in the background; the returned func stops it and waits
+func startKeepAlive(cli *client.Client) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := cli.KeepAlive(ctx, keepAliveInterval); err != nil {
+			fmt.Fprintln(os.Stderr, "opx: keep-alive stopped:", err)
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// handleCacheCommand lists soon-expiring cache entries or refreshes them ahead of time
+func handleCacheCommand(ctx context.Context, cli *client.Client, args []string) {
+	if len(args) < 1 || (args[0] != "expiring" && args[0] != "refresh") {
+		usage()
+	}
+	fs := flag.NewFlagSet("cache "+args[0], flag.ExitOnError)
+	var within time.Duration
+	fs.DurationVar(&within, "within", 0, "window for entries about to expire (expiring defaults to 5m)")
+	_ = fs.Parse(args[1:])
+
+	if args[0] == "expiring" {
+		if within <= 0 {
+			within = 5 * time.Minute
+		}
+		resp, err := cli.CacheExpiring(ctx, within)
+		if err != nil {
+			fail("cache expiring", err)
+		}
+		fmt.Print(client.FormatCacheEntries(resp.Entries))
+		return
+	}
+
+	if fs.NArg() == 0 && within <= 0 {
+		fmt.Fprintln(os.Stderr, "cache refresh needs REFs or --within")
+		os.Exit(2)
+	}
+	resp, err := cli.CacheRefresh(ctx, fs.Args(), within)
+	if err != nil {
+		fail("cache refresh", err)
+	}
+	fmt.Print(client.FormatCacheEntries(resp.Refreshed))
+	if len(resp.Errors) > 0 {
+		fmt.Fprint(os.Stderr, client.FormatCacheErrors(resp.Errors))
+		os.Exit(1)
+	}
+}
+
+func handleAuditCommand(cli *client.Client, args []string) {
+	if len(args) > 0 && args[0] == "stats" {
+		handleAuditStats(args[1:])
+		return
+	}
+	if len(args) > 0 && args[0] == "verify" {
+		handleAuditVerify(args[1:])
+		return
+	}
+	if len(args) > 0 && args[0] == "apply" {
+		handleAuditApply(args[1:])
+		return
+	}
+	if len(args) > 0 && args[0] == "export" {
+		handleAuditExport(args[1:])
+		return
+	}
+	if len(args) > 0 && args[0] == "query" {
+		handleAuditQuery(args[1:])
+		return
+	}
 
-func handleAuditCommand(args []string) {
 	var since string
 	var interactive bool
+	var follow bool
+	var groupBy string
+	var top int
+	var filter audit.DenialFilter
 
 	// Parse audit-specific flags
 	auditFlags := flag.NewFlagSet("audit", flag.ExitOnError)
-	auditFlags.StringVar(&since, "since", "24h", "show denials from last duration (e.g., 1h, 24h, 7d)")
+	denialFlags(auditFlags, &since, &groupBy, &top, &filter)
 	auditFlags.BoolVar(&interactive, "interactive", false, "interactive policy management")
+	auditFlags.BoolVar(&follow, "follow", false, "stream audit events live from the daemon")
 	auditFlags.Parse(args)
 
+	if follow {
+		followAuditEvents(cli, filter.CmdlineContains)
+		return
+	}
+
+	if interactive && !isTerminal(os.Stdin) {
+		fmt.Fprintln(os.Stderr, "opx audit --interactive needs a terminal on stdin.")
+		fmt.Fprintln(os.Stderr, "Run 'opx audit' to list denials, or edit policy.json directly.")
+		os.Exit(1)
+	}
+
 	// Parse duration
-	sinceData, err := time.ParseDuration(since)
+	sinceData, err := audit.ParseSince(since)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Invalid duration %s: %v\n", since, err)
-		os.Exit(1)
+		os.Exit(client.ExitUsage)
 	}
 
 	// Scan for recent denials
 	fmt.Printf("Scanning audit log for denials in the last %s...\n", since)
 	denials, err := audit.ScanRecentDenials(sinceData)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to scan audit log: %v\n", err)
-		os.Exit(1)
+		fail("Failed to scan audit log", err)
 	}
 
+	denials = filter.Apply(denials)
+
 	if len(denials) == 0 {
+		if filter.Active() {
+			fmt.Printf("No access denials in the last %s match the filters.\n", since)
+			return
+		}
 		fmt.Printf("No access denials found in the last %s.\n", since)
 		if interactive {
 			fmt.Println("Your access control policy appears to be working correctly!")
@@ -261,12 +1183,19 @@ func handleAuditCommand(args []string) {
 		return
 	}
 
-	fmt.Printf("\nFound %d unique access denials:\n\n", len(denials))
+	groups, err := audit.GroupDenials(denials, groupBy)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --group-by: %v\n", err)
+		os.Exit(client.ExitUsage)
+	}
+	shown := audit.TopGroups(groups, top)
 
-	// Display all denials
-	for i, denial := range denials {
-		fmt.Print(audit.FormatDenialForDisplay(i, denial))
+	fmt.Printf("\nFound %d unique access denials (%d total) in %d groups (by %s):\n\n", len(denials), audit.TotalDenials(denials), len(groups), groupBy)
+	if len(shown) < len(groups) {
+		fmt.Printf("Showing the top %d groups.\n\n", len(shown))
 	}
+	fmt.Print(audit.RenderDenialGroups(shown, groupBy))
+	fmt.Println()
 
 	if !interactive {
 		fmt.Println("Use --interactive to manage policy rules for these denials.")
@@ -274,114 +1203,346 @@ func handleAuditCommand(args []string) {
 	}
 
 	// Interactive mode - let user select denials to allow
-	fmt.Println("\nInteractive Policy Management")
-	fmt.Println("Select denials to create allow rules for (comma-separated numbers, or 'q' to quit):")
-	fmt.Print("> ")
+	_, policyPath, err := policy.Load()
+	if err != nil {
+		fail("Failed to load policy from "+policyPath, err)
+	}
+	added, err := audit.RunInteractive(os.Stdin, os.Stdout, shown, policyPath)
+	if err != nil {
+		fail("Failed to read input", err)
+	}
+	if added == 0 {
+		return
+	}
+
+	fmt.Println("\n🎉 Policy updated! Restart opx-authd to apply changes:")
+	fmt.Println("  sudo systemctl --user restart opx-authd")
+	fmt.Println("  # or kill and restart manually")
+}
+
+// denialFlags registers the flags that choose and number the denials opx audit
+// lists, shared with opx audit apply so its indexes mean the same denials
+func denialFlags(fs *flag.FlagSet, since, groupBy *string, top *int, filter *audit.DenialFilter) {
+	fs.StringVar(since, "since", "24h", "show denials from last duration (e.g., 1h, 24h, 7d)")
+	fs.StringVar(groupBy, "group-by", audit.GroupByPath, "group denials by path, vault or ref")
+	fs.IntVar(top, "top", 0, "only show the N most denied groups (0 = all)")
+	fs.StringVar(&filter.CmdlineContains, "cmdline-contains", "", "only show events whose recorded peer command line contains this text")
+	fs.StringVar(&filter.Path, "path", "", "only show denials whose executable path contains this text or matches this glob")
+	fs.StringVar(&filter.RefPrefix, "ref-prefix", "", "only show denials of refs starting with this prefix")
+	fs.IntVar(&filter.MinCount, "min-count", 0, "only show denials that happened at least this many times")
+}
 
-	reader := bufio.NewReader(os.Stdin)
-	input, err := reader.ReadString('\n')
+// handleAuditApply adds the allow rules opx audit --interactive would for a
+// spec of decisions such as "1:exact,g2:vault", without prompting
+func handleAuditApply(args []string) {
+	var since, groupBy, allow, decisionsFile string
+	var top int
+	var filter audit.DenialFilter
+	var dryRun, asJSON bool
+	fs := flag.NewFlagSet("audit apply", flag.ExitOnError)
+	denialFlags(fs, &since, &groupBy, &top, &filter)
+	fs.StringVar(&allow, "allow", "", "decisions as INDEX:LEVEL,... (e.g. 1:exact,3:vault,g2:any)")
+	fs.StringVar(&decisionsFile, "decisions", "", "read decisions from a file, one or more per line ('-' for stdin)")
+	fs.BoolVar(&dryRun, "dry-run", false, "print the policy diff without writing it")
+	fs.BoolVar(&asJSON, "json", false, "print the rules added as JSON")
+	fs.Parse(args)
+
+	if (allow == "") == (decisionsFile == "") {
+		fmt.Fprintln(os.Stderr, "opx audit apply needs exactly one of --allow or --decisions")
+		os.Exit(client.ExitUsage)
+	}
+	spec := allow
+	if decisionsFile != "" {
+		var b []byte
+		var err error
+		if decisionsFile == "-" {
+			b, err = io.ReadAll(os.Stdin)
+		} else {
+			b, err = os.ReadFile(decisionsFile)
+		}
+		if err != nil {
+			fail("Failed to read decisions", err)
+		}
+		spec = string(b)
+	}
+	decisions, err := audit.ParseDecisions(spec)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to read input: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Invalid decisions: %v\n", err)
+		os.Exit(client.ExitUsage)
 	}
 
-	input = strings.TrimSpace(input)
-	if input == "q" || input == "quit" {
-		fmt.Println("Exiting without changes.")
-		return
+	sinceData, err := audit.ParseSince(since)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid duration %s: %v\n", since, err)
+		os.Exit(client.ExitUsage)
+	}
+	denials, err := audit.ScanRecentDenials(sinceData)
+	if err != nil {
+		fail("Failed to scan audit log", err)
+	}
+	groups, err := audit.GroupDenials(filter.Apply(denials), groupBy)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --group-by: %v\n", err)
+		os.Exit(client.ExitUsage)
 	}
 
-	// Parse selection
-	indices := parseSelection(input)
-	if len(indices) == 0 {
-		fmt.Println("No valid selections made.")
+	// Number denials and groups exactly as opx audit shows them with the same flags
+	rules, err := audit.PlanDecisions(audit.TopGroups(groups, top), decisions)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid decisions: %v\n", err)
+		fmt.Fprintln(os.Stderr, "Run opx audit with the same --since, --group-by, --top and filter flags to see the numbering.")
+		os.Exit(client.ExitUsage)
+	}
+
+	_, policyPath, err := policy.Load()
+	if err != nil {
+		fail("Failed to load policy from "+policyPath, err)
+	}
+	before, after, err := audit.ApplyRules(policyPath, rules, dryRun)
+	if err != nil {
+		fail("Failed to update policy", err)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(audit.ApplyResult{PolicyPath: policyPath, DryRun: dryRun, Rules: rules})
+		return
+	}
+	for _, r := range rules {
+		fmt.Printf("%-10s %s -> %s\n", r.Decision, r.Path, strings.Join(r.Refs, ", "))
+	}
+	fmt.Println()
+	fmt.Print(audit.PolicyDiff(before, after))
+	if dryRun {
+		fmt.Printf("\nDry run: %s was not changed.\n", policyPath)
 		return
 	}
+	fmt.Printf("\nAdded %d rules to %s. Apply them with: opx policy reload\n", len(rules), policyPath)
+}
+
+// handleAuditExport writes the access decisions in the audit log as a CSV or
+// JSON lines report, one row per event or per day and ref
+func handleAuditExport(args []string) {
+	var since, format, out, aggregate string
+	fs := flag.NewFlagSet("audit export", flag.ExitOnError)
+	fs.StringVar(&since, "since", "24h", "export decisions from last duration (e.g., 24h, 90d)")
+	fs.StringVar(&format, "format", "csv", "output format: csv|jsonl")
+	fs.StringVar(&out, "out", "", "write the report to this file instead of stdout")
+	fs.StringVar(&aggregate, "aggregate", "", "daily: one row per day and ref with allowed and denied counts")
+	fs.Parse(args)
+
+	sinceData, err := audit.ParseSince(since)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid duration %s: %v\n", since, err)
+		os.Exit(client.ExitUsage)
+	}
+	if !slices.Contains(audit.ExportFormats, format) || (aggregate != "" && aggregate != "daily") {
+		fmt.Fprintln(os.Stderr, "opx audit export needs --format=csv|jsonl and, if given, --aggregate=daily")
+		os.Exit(client.ExitUsage)
+	}
 
-	// Process each selected denial
-	for _, idx := range indices {
-		if idx < 0 || idx >= len(denials) {
-			fmt.Printf("Invalid selection: %d\n", idx+1)
-			continue
+	w := io.Writer(os.Stdout)
+	if out != "" {
+		f, err := os.OpenFile(out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			fail("Failed to create report", err)
 		}
+		defer f.Close()
+		w = f
+	}
+	rows, err := audit.ExportAccessDecisions(w, sinceData, audit.ExportOptions{Format: format, Aggregate: aggregate})
+	if err != nil {
+		fail("Failed to export audit log", err)
+	}
+	if out != "" {
+		fmt.Fprintf(os.Stderr, "Exported %d rows to %s\n", rows, out)
+	}
+}
 
-		denial := denials[idx]
-		fmt.Printf("\nCreating allow rule for: %s -> %s\n", denial.Path, denial.Reference)
+// handleAuditQuery prints the audit events of one resolve or run invocation
+func handleAuditQuery(args []string) {
+	var since, operation string
+	var jsonOut bool
+	fs := flag.NewFlagSet("audit query", flag.ExitOnError)
+	fs.StringVar(&operation, "operation", "", "operation ID of a RESOLVE event (also sent as X-Operation-ID)")
+	fs.StringVar(&since, "since", "24h", "search events from last duration (e.g., 24h, 7d)")
+	fs.BoolVar(&jsonOut, "json", false, "print the events as JSON lines")
+	fs.Parse(args)
 
-		// Suggest patterns
-		patterns := audit.SuggestAllowPattern(denial.Reference)
-		fmt.Println("Select permission level:")
-		for i, pattern := range patterns {
-			fmt.Printf("  [%d] %s\n", i+1, pattern)
+	if operation == "" {
+		fmt.Fprintln(os.Stderr, "opx audit query needs --operation=ID")
+		os.Exit(client.ExitUsage)
+	}
+	sinceData, err := audit.ParseSince(since)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid duration %s: %v\n", since, err)
+		os.Exit(client.ExitUsage)
+	}
+	events, err := audit.QueryOperation(sinceData, operation)
+	if err != nil {
+		fail("Failed to query audit log", err)
+	}
+	if len(events) == 0 {
+		fmt.Fprintf(os.Stderr, "No audit events for operation %s in the last %s\n", operation, since)
+		os.Exit(1)
+	}
+	if jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		for _, event := range events {
+			_ = enc.Encode(event)
 		}
-		fmt.Print("Choice (1-3): ")
+		return
+	}
+	color := useColor()
+	for _, event := range events {
+		fmt.Print(audit.FormatEventCompact(event, color))
+	}
+}
+
+// handleAuditVerify checks the MAC chain of the given audit logs, or all of them,
+// exiting 1 if any line was edited or removed
+func handleAuditVerify(files []string) {
+	path, err := util.AuditKeyPath()
+	if err != nil {
+		fail("audit verify", err)
+	}
+	key, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "No audit key at %s; is opx-authd running with --audit-tamper-evident? (%v)\n", path, err)
+		os.Exit(client.ExitFailure)
+	}
 
-		choiceInput, err := reader.ReadString('\n')
+	var results []audit.VerifyResult
+	if len(files) == 0 {
+		if results, err = audit.VerifyLogs(key); err != nil {
+			fail("audit verify", err)
+		}
+	}
+	for _, file := range files {
+		result, err := audit.VerifyFile(file, key)
 		if err != nil {
-			fmt.Printf("Failed to read choice: %v\n", err)
-			continue
+			fail("audit verify", err)
 		}
+		results = append(results, result)
+	}
 
-		choice, err := strconv.Atoi(strings.TrimSpace(choiceInput))
-		if err != nil || choice < 1 || choice > len(patterns) {
-			fmt.Printf("Invalid choice, skipping %s\n", denial.Reference)
-			continue
+	fmt.Print(audit.FormatVerifyResults(results))
+	for _, r := range results {
+		if !r.OK() {
+			os.Exit(client.ExitFailure)
 		}
+	}
+}
 
-		selectedPattern := patterns[choice-1]
-		rule := audit.CreatePolicyRuleFromDenial(denial, selectedPattern)
-
-		// Add rule to policy
-		if err := audit.AddRuleToPolicy(rule); err != nil {
-			fmt.Printf("Failed to add rule: %v\n", err)
-			continue
-		}
+// handleAuditStats prints aggregate denial counts for a time window
+func handleAuditStats(args []string) {
+	var since string
+	statsFlags := flag.NewFlagSet("audit stats", flag.ExitOnError)
+	statsFlags.StringVar(&since, "since", "24h", "summarize denials from last duration (e.g., 1h, 24h, 7d)")
+	statsFlags.Parse(args)
 
-		fmt.Printf("✅ Added rule: %s can access %s\n", denial.Path, selectedPattern)
+	sinceData, err := audit.ParseSince(since)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid duration %s: %v\n", since, err)
+		os.Exit(client.ExitUsage)
+	}
+	denials, err := audit.ScanRecentDenials(sinceData)
+	if err != nil {
+		fail("Failed to scan audit log", err)
 	}
 
-	fmt.Println("\n🎉 Policy updated! Restart opx-authd to apply changes:")
-	fmt.Println("  sudo systemctl --user restart opx-authd")
-	fmt.Println("  # or kill and restart manually")
+	stats := audit.SummarizeDenials(denials)
+	fmt.Printf("Access denials in the last %s:\n", since)
+	fmt.Printf("  Total denials:      %d\n", stats.Total)
+	fmt.Printf("  Unique path/refs:   %d\n", stats.Unique)
+	fmt.Printf("  Executables:        %d\n", stats.Executables)
+	fmt.Printf("  References:         %d\n", stats.References)
+	if top, ok := audit.FindMostFrequentDenial(denials); ok {
+		fmt.Printf("  Most denied:        %s -> %s (%d)\n", top.Path, top.Reference, top.Count)
+	}
 }
 
-func parseSelection(input string) []int {
-	var indices []int
-	parts := strings.Split(input, ",")
+// followAuditEvents prints live audit events from the daemon until interrupted
+func followAuditEvents(cli *client.Client, cmdlineContains string) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	for _, part := range parts {
-		part = strings.TrimSpace(part)
-		if part == "" {
-			continue
-		}
+	if err := cli.EnsureReady(ctx); err != nil {
+		fail("daemon", err)
+	}
 
-		// Parse number (1-based) and convert to 0-based index
-		num, err := strconv.Atoi(part)
-		if err != nil {
-			continue
-		}
-		if num > 0 {
-			indices = append(indices, num-1)
+	color := useColor()
+	fmt.Fprintln(os.Stderr, "Following audit events (Ctrl-C to stop)...")
+	err := cli.StreamAudit(ctx, func(event audit.AuditEvent) {
+		if cmdlineContains != "" && !strings.Contains(event.PeerCmdline, cmdlineContains) {
+			return
 		}
+		fmt.Print(audit.FormatEventCompact(event, color))
+	})
+	if err != nil {
+		fail("audit stream", err)
+	}
+	if ctx.Err() == nil {
+		fmt.Fprintln(os.Stderr, "audit stream closed by daemon")
 	}
+}
 
-	return indices
+// useColor reports whether stdout is a terminal and NO_COLOR is unset
+func useColor() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return isTerminal(os.Stdout)
 }
 
-func handleLoginCommand(opFlags []string) {
-	fmt.Println("Logging into 1Password...")
+// isTerminal reports whether f is a character device (a TTY)
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
 
-	// Build op signin command with optional account flag
-	args := []string{"signin"}
-	args = append(args, opFlags...)
+// handleConfigCommand saves a session setting to config.json and applies it to a running daemon
+func handleConfigCommand(ctx context.Context, cli *client.Client, args []string) {
+	if len(args) != 4 || args[0] != "session" || args[1] != "set" || args[2] != "idle-timeout" {
+		fmt.Fprintln(os.Stderr, "usage: opx config session set idle-timeout DURATION")
+		os.Exit(client.ExitUsage)
+	}
+	timeout, err := time.ParseDuration(args[3])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid idle timeout %q: want a duration like 4h\n", args[3])
+		os.Exit(client.ExitUsage)
+	}
 
-	// Execute op signin interactively
-	cmd := exec.Command("op", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
+	cfg, err := session.LoadFileConfig()
+	if errors.Is(err, os.ErrNotExist) {
+		cfg, err = session.DefaultConfig(), nil
+	}
+	if err != nil {
+		fail("config", err)
+	}
+	cfg.SessionIdleTimeout = timeout
+	if err := cfg.SaveConfig(); err != nil {
+		fail("config", err)
+	}
+	fmt.Printf("Session idle timeout set to %s\n", timeout)
 
-	if err := cmd.Run(); err != nil {
+	// Reload rather than autostart: a daemon that isn't running reads the file when it starts
+	resp, err := cli.ReloadSession(ctx)
+	switch {
+	case err == nil:
+		fmt.Printf("Daemon reloaded: sessions lock after %s idle\n", time.Duration(resp.IdleTimeout)*time.Second)
+	case client.ExitCode(err) == client.ExitUnreachable:
+		fmt.Println("Daemon not running; the timeout applies when it starts")
+	default:
+		fail("daemon reload", err)
+	}
+}
+
+func handleLoginCommand(opFlags []string) {
+	fmt.Println("Logging into 1Password...")
+
+	if err := opSignin(context.Background(), opFlags).Run(); err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			fmt.Fprintf(os.Stderr, "1Password signin failed with exit code %d\n", exitErr.ExitCode())
 			os.Exit(exitErr.ExitCode())
@@ -395,6 +1556,15 @@ func handleLoginCommand(opFlags []string) {
 	fmt.Println("  opx read 'op://vault/item/field'")
 }
 
+// opSignin builds an interactive `op signin` with the global op flags (such as --account)
+func opSignin(ctx context.Context, opFlags []string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "op", append([]string{"signin"}, opFlags...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+	return cmd
+}
+
 func handleVaultLoginCommand(args []string) {
 	var address string
 	var method string
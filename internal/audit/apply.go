@@ -0,0 +1,186 @@
+package audit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/zach-source/opx/internal/policy"
+)
+
+// Named permission levels for `opx audit apply`; a number picks the interactive choice instead
+const (
+	LevelExact = "exact" // the denied refs themselves
+	LevelVault = "vault" // every ref in their op:// vaults
+	LevelAny   = "any"   // "*"
+)
+
+// Decision is one entry of an `opx audit apply` spec such as "3:vault" or
+// "g2:1": a denial or group, numbered as `opx audit` shows them, and the
+// permission level to allow it at
+type Decision struct {
+	Index int // 0-based denial or group index
+	Group bool
+	Level string
+}
+
+// String renders the decision as it is written in a spec
+func (d Decision) String() string {
+	target := strconv.Itoa(d.Index + 1)
+	if d.Group {
+		target = "g" + target
+	}
+	return target + ":" + d.Level
+}
+
+// ParseDecisions parses a spec of INDEX:LEVEL entries separated by commas or
+// newlines, where INDEX is a denial number or gN for a group and LEVEL is
+// exact, vault, any or the 1-based choice `opx audit --interactive` would
+// offer. Blank lines and lines starting with '#' are ignored, so a decisions
+// file can be annotated.
+func ParseDecisions(spec string) ([]Decision, error) {
+	var decisions []Decision
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(spec, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for _, entry := range strings.Split(line, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			d, err := parseDecision(entry)
+			if err != nil {
+				return nil, err
+			}
+			target, _, _ := strings.Cut(d.String(), ":")
+			if seen[target] {
+				return nil, fmt.Errorf("%s is decided more than once", target)
+			}
+			seen[target] = true
+			decisions = append(decisions, d)
+		}
+	}
+	if len(decisions) == 0 {
+		return nil, fmt.Errorf("no decisions given (want INDEX:LEVEL, e.g. 3:vault or g2:exact)")
+	}
+	return decisions, nil
+}
+
+func parseDecision(entry string) (Decision, error) {
+	target, level, found := strings.Cut(entry, ":")
+	if !found {
+		return Decision{}, fmt.Errorf("decision %q: want INDEX:LEVEL", entry)
+	}
+	var d Decision
+	target = strings.TrimSpace(target)
+	if len(target) > 1 && (target[0] == 'g' || target[0] == 'G') {
+		d.Group = true
+		target = target[1:]
+	}
+	n, err := strconv.Atoi(target)
+	if err != nil || n < 1 {
+		return Decision{}, fmt.Errorf("decision %q: index must be a denial number or gN", entry)
+	}
+	d.Index = n - 1
+
+	d.Level = strings.ToLower(strings.TrimSpace(level))
+	switch d.Level {
+	case LevelExact, LevelVault, LevelAny:
+	default:
+		if n, err := strconv.Atoi(d.Level); err != nil || n < 1 {
+			return Decision{}, fmt.Errorf("decision %q: level must be exact, vault, any or a choice number", entry)
+		}
+	}
+	return d, nil
+}
+
+// AppliedRule is a rule `opx audit apply` adds, with the decision that chose it
+type AppliedRule struct {
+	Decision string   `json:"decision"`
+	Path     string   `json:"path"`
+	Refs     []string `json:"refs"`
+}
+
+// PlanDecisions turns decisions into allow rules using the same suggestions
+// RunInteractive offers: a denial becomes one rule, a group one consolidated
+// rule per executable. groups must be numbered as `opx audit` showed them.
+func PlanDecisions(groups []DenialGroup, decisions []Decision) ([]AppliedRule, error) {
+	denials := FlattenGroups(groups)
+	var rules []AppliedRule
+	for _, d := range decisions {
+		var candidates []ruleCandidate
+		switch {
+		case d.Group && d.Index < len(groups):
+			candidates = groupCandidates(fmt.Sprintf("g%d", d.Index+1), groups[d.Index])
+		case !d.Group && d.Index < len(denials):
+			candidates = []ruleCandidate{denialCandidate(denials[d.Index])}
+		case d.Group:
+			return nil, fmt.Errorf("%s: there are only %d groups", d, len(groups))
+		default:
+			return nil, fmt.Errorf("%s: there are only %d denials", d, len(denials))
+		}
+
+		for _, c := range candidates {
+			refs, err := c.level(d.Level)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", d, err)
+			}
+			rule := policy.Rule{Path: c.path, Refs: refs}
+			if !d.Group {
+				rule = CreatePolicyRuleFromDenial(denials[d.Index], refs[0])
+			}
+			rules = append(rules, AppliedRule{Decision: d.String(), Path: rule.Path, Refs: rule.Refs})
+		}
+	}
+	return rules, nil
+}
+
+// level returns the refs the candidate allows at a named or numbered level
+func (c ruleCandidate) level(level string) ([]string, error) {
+	switch level {
+	case LevelExact:
+		return c.options[0], nil
+	case LevelAny:
+		return c.options[len(c.options)-1], nil
+	case LevelVault:
+		// Only op:// refs widen to their vault, which adds the middle option
+		if len(c.options) != 3 {
+			return nil, fmt.Errorf("%s has no vault-level pattern", c.label)
+		}
+		return c.options[1], nil
+	}
+	n, _ := strconv.Atoi(level)
+	if n < 1 || n > len(c.options) {
+		return nil, fmt.Errorf("choice %d for %s is not between 1 and %d", n, c.label, len(c.options))
+	}
+	return c.options[n-1], nil
+}
+
+// ApplyRules appends rules to the policy at policyPath, saving once (with a
+// backup) unless dryRun is set, and returns the policy before and after
+func ApplyRules(policyPath string, rules []AppliedRule, dryRun bool) (before, after policy.Policy, err error) {
+	before, err = policy.LoadFile(policyPath)
+	if err != nil {
+		return before, after, fmt.Errorf("failed to load current policy: %w", err)
+	}
+	after = before
+	for _, r := range rules {
+		after = withRule(after, policy.Rule{Path: r.Path, Refs: r.Refs})
+	}
+	if dryRun || len(rules) == 0 {
+		return before, after, nil
+	}
+	if _, err := policy.Save(policyPath, after); err != nil {
+		return before, after, err
+	}
+	return before, after, nil
+}
+
+// ApplyResult is what `opx audit apply --json` prints
+type ApplyResult struct {
+	PolicyPath string        `json:"policy_path"`
+	DryRun     bool          `json:"dry_run"`
+	Rules      []AppliedRule `json:"rules"`
+}
@@ -0,0 +1,156 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zach-source/opx/internal/policy"
+)
+
+func TestParseDecisions(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		expected []Decision
+		err      string
+	}{
+		{name: "single", spec: "1:exact", expected: []Decision{{Index: 0, Level: LevelExact}}},
+		{name: "mixed", spec: "3:vault, g2:any,1:2", expected: []Decision{
+			{Index: 2, Level: LevelVault},
+			{Index: 1, Group: true, Level: LevelAny},
+			{Index: 0, Level: "2"},
+		}},
+		{name: "trailing comment", spec: "# reviewed by ops\n2:EXACT\n\nG1:vault # not a comment\n", err: "level must be"},
+		{name: "file comments", spec: "# reviewed by ops\n2:EXACT\n\n  # g1 is too broad\nG1:1\n", expected: []Decision{
+			{Index: 1, Level: LevelExact},
+			{Index: 0, Group: true, Level: "1"},
+		}},
+		{name: "empty", spec: " \n# nothing\n", err: "no decisions"},
+		{name: "no level", spec: "1", err: "want INDEX:LEVEL"},
+		{name: "zero index", spec: "0:exact", err: "index must be"},
+		{name: "bad index", spec: "gx:exact", err: "index must be"},
+		{name: "bare g", spec: "g:exact", err: "index must be"},
+		{name: "bad level", spec: "1:team", err: "level must be"},
+		{name: "zero choice", spec: "1:0", err: "level must be"},
+		{name: "duplicate", spec: "1:exact,1:any", err: "1 is decided more than once"},
+		{name: "group and denial", spec: "1:exact,g1:any", expected: []Decision{
+			{Index: 0, Level: LevelExact},
+			{Index: 0, Group: true, Level: LevelAny},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decisions, err := ParseDecisions(tt.spec)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("Expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDecisions failed: %v", err)
+			}
+			if !reflect.DeepEqual(decisions, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, decisions)
+			}
+		})
+	}
+}
+
+func TestPlanDecisions(t *testing.T) {
+	groups, err := GroupDenials([]DenialEvent{
+		{Path: "/usr/bin/app", Reference: "op://prod/db/password", Count: 3},
+		{Path: "/usr/bin/app", Reference: "op://prod/api/key"},
+		{Path: "/usr/bin/tool", Reference: "vault://secret/data/x#y"},
+	}, GroupByPath)
+	if err != nil {
+		t.Fatalf("GroupDenials failed: %v", err)
+	}
+	denials := FlattenGroups(groups)
+
+	tests := []struct {
+		spec     string
+		expected []AppliedRule
+		err      string
+	}{
+		{spec: "1:exact", expected: []AppliedRule{
+			{Decision: "1:exact", Path: denials[0].Path, Refs: []string{denials[0].Reference}},
+		}},
+		{spec: "1:vault", expected: []AppliedRule{
+			{Decision: "1:vault", Path: "/usr/bin/app", Refs: []string{"op://prod/*"}},
+		}},
+		{spec: "1:3", expected: []AppliedRule{
+			{Decision: "1:3", Path: "/usr/bin/app", Refs: []string{"*"}},
+		}},
+		{spec: "3:any", expected: []AppliedRule{
+			{Decision: "3:any", Path: "/usr/bin/tool", Refs: []string{"*"}},
+		}},
+		{spec: "g1:exact", expected: []AppliedRule{
+			{Decision: "g1:exact", Path: "/usr/bin/app", Refs: []string{"op://prod/api/key", "op://prod/db/password"}},
+		}},
+		{spec: "g1:vault,g2:1", expected: []AppliedRule{
+			{Decision: "g1:vault", Path: "/usr/bin/app", Refs: []string{"op://prod/*"}},
+			{Decision: "g2:1", Path: "/usr/bin/tool", Refs: []string{"vault://secret/data/x#y"}},
+		}},
+		{spec: "3:vault", err: "3:vault: vault://secret/data/x#y has no vault-level pattern"},
+		{spec: "3:3", err: "choice 3 for vault://secret/data/x#y is not between 1 and 2"},
+		{spec: "4:exact", err: "there are only 3 denials"},
+		{spec: "g3:exact", err: "there are only 2 groups"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			decisions, err := ParseDecisions(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseDecisions failed: %v", err)
+			}
+			rules, err := PlanDecisions(groups, decisions)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("Expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PlanDecisions failed: %v", err)
+			}
+			if !reflect.DeepEqual(rules, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, rules)
+			}
+		})
+	}
+}
+
+func TestApplyRules(t *testing.T) {
+	policyPath := filepath.Join(t.TempDir(), "policy.json")
+	rules := []AppliedRule{
+		{Decision: "1:vault", Path: "/usr/bin/app", Refs: []string{"op://prod/*"}},
+		{Decision: "2:exact", Path: "/usr/bin/tool", Refs: []string{"op://dev/x/y"}},
+	}
+
+	before, after, err := ApplyRules(policyPath, rules, true)
+	if err != nil {
+		t.Fatalf("ApplyRules dry run failed: %v", err)
+	}
+	if len(before.Allow) != 0 || len(after.Allow) != 2 || !after.DefaultDeny {
+		t.Errorf("Expected the dry run to plan 2 rules with default_deny, got %+v", after)
+	}
+	if _, err := os.Stat(policyPath); !os.IsNotExist(err) {
+		t.Errorf("Expected a dry run not to write the policy, got %v", err)
+	}
+
+	if _, _, err := ApplyRules(policyPath, rules, false); err != nil {
+		t.Fatalf("ApplyRules failed: %v", err)
+	}
+	pol, err := policy.LoadFile(policyPath)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if !reflect.DeepEqual(pol.Allow, after.Allow) || !pol.DefaultDeny {
+		t.Errorf("Expected the saved policy to match the dry run, got %+v", pol)
+	}
+}
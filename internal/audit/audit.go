@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/zach-source/opx/internal/policy"
 	"github.com/zach-source/opx/internal/security"
 )
 
@@ -16,15 +18,42 @@ type AuditEvent struct {
 	Event      string            `json:"event"`
 	PeerInfo   security.PeerInfo `json:"peer_info"`
 	Reference  string            `json:"reference,omitempty"`
+	Action     string            `json:"action,omitempty"` // read, write or create for ACCESS_DECISION events
 	Decision   string            `json:"decision"`
 	PolicyPath string            `json:"policy_path,omitempty"`
 	Details    map[string]string `json:"details,omitempty"`
+	// RequestID correlates the event with the daemon request (X-Request-ID)
+	RequestID string `json:"request_id,omitempty"`
+	// PeerCmdline is the peer's redacted command line, present only with --audit-include-cmdline
+	PeerCmdline string `json:"peer_cmdline,omitempty"`
+	// Env maps variable names to the refs a RESOLVE event read them from; values are never logged
+	Env map[string]string `json:"env,omitempty"`
 }
 
+// OperationIDDetail is the details key tying a resolve's ACCESS_DECISION events to its RESOLVE event
+const OperationIDDetail = "operation_id"
+
 // Logger handles audit event logging with rotation
 type Logger struct {
 	enabled bool
 	roller  *Roller
+	hub     *Hub
+
+	mu       sync.Mutex
+	dropped  uint64 // events that could not be written
+	failures int    // consecutive failed writes; 0 once one succeeds
+	lastErr  error
+}
+
+// Health describes whether audit events are reaching the log file
+type Health struct {
+	// Failing is true from a failed write until the next successful one
+	Failing bool
+	// ConsecutiveFailures counts the failed writes since the last successful one
+	ConsecutiveFailures int
+	// Dropped counts every event that could not be written since startup
+	Dropped   uint64
+	LastError string
 }
 
 // NewLogger creates a new audit logger with configurable rotation
@@ -46,37 +75,109 @@ func NewLoggerWithConfig(enabled bool, config RollerConfig) (*Logger, error) {
 	return &Logger{
 		enabled: true,
 		roller:  roller,
+		hub:     NewHub(),
 	}, nil
 }
 
-// LogEvent records an audit event
-func (l *Logger) LogEvent(event AuditEvent) {
+// Enabled reports whether events are actually being recorded
+func (l *Logger) Enabled() bool {
+	return l != nil && l.enabled
+}
+
+// LogEvent records an audit event, returning the error if it could not be
+// written to the log file; live subscribers still receive it
+func (l *Logger) LogEvent(event AuditEvent) error {
 	if !l.enabled {
-		return
+		return nil
 	}
 
 	event.Timestamp = time.Now()
+	if event.PeerCmdline == "" {
+		event.PeerCmdline = event.PeerInfo.Cmdline
+	}
 
 	// Log to structured audit file with rotation
+	var werr error
 	if l.roller != nil {
 		data, err := json.Marshal(event)
 		if err == nil {
-			l.roller.Write(append(data, '\n'))
+			err = l.roller.Write(append(data, '\n'))
 		}
+		werr = l.recordWrite(err)
+	}
+
+	// Fan out to live subscribers (opx audit --follow)
+	if l.hub != nil {
+		l.hub.Publish(event)
 	}
 
 	// Also log to standard logger for immediate visibility
-	log.Printf("[AUDIT] %s: %s (PID:%d Path:%s) -> %s: %s",
+	log.Printf("[AUDIT] %s: %s (PID:%d Path:%s) -> %s%s: %s",
 		event.Event,
 		event.Decision,
 		event.PeerInfo.PID,
 		event.PeerInfo.Path,
 		event.Reference,
+		formatAction(event.Action),
 		formatDetails(event.Details))
+	return werr
+}
+
+// recordWrite tracks the outcome of a log file write, warning when writes
+// start failing and when they recover, and returns err
+func (l *Logger) recordWrite(err error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err == nil {
+		if l.failures > 0 {
+			log.Printf("Audit log is writable again after %d failed writes", l.failures)
+		}
+		l.failures = 0
+		return nil
+	}
+	if l.failures == 0 {
+		log.Printf("Warning: audit event not written, events are being dropped: %v", err)
+	}
+	l.failures++
+	l.dropped++
+	l.lastErr = err
+	return fmt.Errorf("failed to write audit event: %w", err)
+}
+
+// Health reports whether recent events reached the log file and how many were dropped
+func (l *Logger) Health() Health {
+	if !l.Enabled() {
+		return Health{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	h := Health{Failing: l.failures > 0, ConsecutiveFailures: l.failures, Dropped: l.dropped}
+	if l.failures > 0 && l.lastErr != nil {
+		h.LastError = l.lastErr.Error()
+	}
+	return h
+}
+
+// LogAuditUnavailable records a read refused because earlier events could not
+// be written; writing it is also how a required audit log is found to work again
+func (l *Logger) LogAuditUnavailable(requestID string, peerInfo security.PeerInfo, reference string) error {
+	return l.LogEvent(AuditEvent{
+		Event:     "AUDIT_UNAVAILABLE",
+		PeerInfo:  peerInfo,
+		Reference: reference,
+		Action:    policy.ActionRead,
+		Decision:  "DENY",
+		RequestID: requestID,
+	})
 }
 
 // LogAccessDecision records a policy access decision
 func (l *Logger) LogAccessDecision(peerInfo security.PeerInfo, reference string, allowed bool, policyPath string, details map[string]string) {
+	l.LogAccessDecisionForRequest("", peerInfo, reference, policy.ActionRead, allowed, policyPath, details)
+}
+
+// LogAccessDecisionForRequest records a policy decision on action, tagged with the daemon request ID
+func (l *Logger) LogAccessDecisionForRequest(requestID string, peerInfo security.PeerInfo, reference, action string, allowed bool, policyPath string, details map[string]string) {
 	decision := "ALLOW"
 	if !allowed {
 		decision = "DENY"
@@ -86,9 +187,68 @@ func (l *Logger) LogAccessDecision(peerInfo security.PeerInfo, reference string,
 		Event:      "ACCESS_DECISION",
 		PeerInfo:   peerInfo,
 		Reference:  reference,
+		Action:     action,
+		Decision:   decision,
+		PolicyPath: policyPath,
+		Details:    details,
+		RequestID:  requestID,
+	}
+
+	l.LogEvent(event)
+}
+
+// LogResolve records one resolve or run invocation: the NAME -> REF pairs it
+// asked for, never their values, under the operation ID its ACCESS_DECISION
+// events carry. failed names the variable that failed the request, if any.
+func (l *Logger) LogResolve(requestID, operationID string, peerInfo security.PeerInfo, env map[string]string, failed string) {
+	decision := "SUCCESS"
+	details := map[string]string{OperationIDDetail: operationID}
+	if failed != "" {
+		decision = "FAILURE"
+		details["failed_var"] = failed
+	}
+
+	event := AuditEvent{
+		Event:     "RESOLVE",
+		PeerInfo:  peerInfo,
+		Decision:  decision,
+		Details:   details,
+		RequestID: requestID,
+		Env:       env,
+	}
+
+	l.LogEvent(event)
+}
+
+// LogAdminDecision records whether a peer was let through to an admin endpoint
+func (l *Logger) LogAdminDecision(requestID string, peerInfo security.PeerInfo, endpoint string, allowed bool, policyPath string, details map[string]string) {
+	decision := "ALLOW"
+	if !allowed {
+		decision = "DENY"
+	}
+
+	event := AuditEvent{
+		Event:      "ADMIN_ACCESS",
+		PeerInfo:   peerInfo,
+		Reference:  endpoint,
 		Decision:   decision,
 		PolicyPath: policyPath,
 		Details:    details,
+		RequestID:  requestID,
+	}
+
+	l.LogEvent(event)
+}
+
+// LogPeerUnavailable records a request rejected because the caller's process could not be identified
+func (l *Logger) LogPeerUnavailable(requestID, endpoint, policyPath string) {
+	event := AuditEvent{
+		Event:      "PEER_INFO_UNAVAILABLE",
+		Reference:  endpoint,
+		Decision:   "DENY",
+		PolicyPath: policyPath,
+		Details:    map[string]string{"reason": "peer information unavailable"},
+		RequestID:  requestID,
 	}
 
 	l.LogEvent(event)
@@ -106,6 +266,19 @@ func (l *Logger) LogSessionEvent(eventType string, peerInfo security.PeerInfo, d
 	l.LogEvent(event)
 }
 
+// LogSecretChanged records that a refresh read a different value for reference
+// than the one it replaced. Neither value nor hash is logged.
+func (l *Logger) LogSecretChanged(reference string, details map[string]string) {
+	event := AuditEvent{
+		Event:     "SECRET_CHANGED",
+		Reference: reference,
+		Decision:  "CHANGED",
+		Details:   details,
+	}
+
+	l.LogEvent(event)
+}
+
 // LogAuthenticationEvent records authentication attempts
 func (l *Logger) LogAuthenticationEvent(peerInfo security.PeerInfo, success bool, reason string) {
 	decision := "SUCCESS"
@@ -125,6 +298,22 @@ func (l *Logger) LogAuthenticationEvent(peerInfo security.PeerInfo, success bool
 	l.LogEvent(event)
 }
 
+// Subscribe registers a live event subscriber; returns nil when logging is disabled
+func (l *Logger) Subscribe(buffer int) *Subscription {
+	if !l.Enabled() || l.hub == nil {
+		return nil
+	}
+	return l.hub.Subscribe(buffer)
+}
+
+// Unsubscribe removes a live event subscriber
+func (l *Logger) Unsubscribe(sub *Subscription) {
+	if l == nil || l.hub == nil || sub == nil {
+		return
+	}
+	l.hub.Unsubscribe(sub)
+}
+
 // Close closes the audit logger
 func (l *Logger) Close() error {
 	if l.roller != nil {
@@ -145,3 +334,11 @@ func formatDetails(details map[string]string) string {
 
 	return "[" + strings.Join(result, ", ") + "]"
 }
+
+// formatAction labels non-read actions in log lines; reads stay unlabelled as before
+func formatAction(action string) string {
+	if action == "" || action == policy.ActionRead {
+		return ""
+	}
+	return " [" + action + "]"
+}
@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// blockDir stops files being created in dir until the returned func restores
+// it: a read-only directory, or for root, who ignores permissions, a file in its place
+func blockDir(t *testing.T, dir string) func() {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		if err := os.Chmod(dir, 0o500); err != nil {
+			t.Fatal(err)
+		}
+		return func() { os.Chmod(dir, 0o700) }
+	}
+	moved := dir + ".moved"
+	if err := os.Rename(dir, moved); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dir, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		os.Remove(dir)
+		os.Rename(moved, dir)
+	}
+}
+
+func TestLogger_WriteFailures(t *testing.T) {
+	dataHome := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dataHome)
+	logger, err := NewLoggerWithConfig(true, RollerConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create audit logger: %v", err)
+	}
+	defer logger.Close()
+	sub := logger.Subscribe(4)
+	defer logger.Unsubscribe(sub)
+
+	restore := blockDir(t, filepath.Join(dataHome, "op-authd"))
+	for i := 0; i < 2; i++ {
+		if err := logger.LogEvent(AuditEvent{Event: "ACCESS_DECISION", Decision: "ALLOW"}); err == nil {
+			t.Fatal("Expected the write to an unwritable audit directory to fail")
+		}
+	}
+	h := logger.Health()
+	if !h.Failing || h.ConsecutiveFailures != 2 || h.Dropped != 2 || h.LastError == "" {
+		t.Errorf("Expected 2 consecutive failures and 2 dropped events, got %+v", h)
+	}
+	if len(sub.C) != 2 {
+		t.Errorf("Expected live subscribers to still get the events, got %d", len(sub.C))
+	}
+
+	restore()
+	if err := logger.LogEvent(AuditEvent{Event: "ACCESS_DECISION", Decision: "ALLOW"}); err != nil {
+		t.Fatalf("Expected the write to succeed once the directory is writable, got %v", err)
+	}
+	h = logger.Health()
+	if h.Failing || h.ConsecutiveFailures != 0 || h.Dropped != 2 || h.LastError != "" {
+		t.Errorf("Expected a recovered logger that still counts 2 dropped events, got %+v", h)
+	}
+}
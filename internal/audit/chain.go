@@ -0,0 +1,178 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// macMember is the JSON member a tamper-evident roller appends to each event line
+const macMember = `,"mac":"`
+
+// macHexLen is the length of a hex HMAC-SHA256
+const macHexLen = sha256.Size * 2
+
+// maxVerifyLine bounds the lines VerifyFile reads; longer lines fail verification
+const maxVerifyLine = 1 << 20
+
+// chainMAC is the hex HMAC-SHA256 over the previous line's MAC and this event
+func chainMAC(key []byte, prev string, event []byte) string {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(prev))
+	m.Write(event)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// sealLine appends the chained MAC to a JSON object line, returning the sealed line and its MAC
+func sealLine(key []byte, prev string, event []byte) ([]byte, string, error) {
+	if len(event) < 2 || event[len(event)-1] != '}' {
+		return nil, "", fmt.Errorf("audit event is not a JSON object")
+	}
+	mac := chainMAC(key, prev, event)
+	sealed := make([]byte, 0, len(event)+len(macMember)+macHexLen+2)
+	sealed = append(sealed, event[:len(event)-1]...)
+	sealed = append(sealed, macMember...)
+	sealed = append(sealed, mac...)
+	sealed = append(sealed, `"}`...)
+	return sealed, mac, nil
+}
+
+// splitMAC separates a sealed line into the event it covers and its MAC; ok is false for an unsealed line
+func splitMAC(line []byte) (event []byte, mac string, ok bool) {
+	cut := len(line) - len(`"}`) - macHexLen - len(macMember)
+	if cut < 1 || !bytes.HasSuffix(line, []byte(`"}`)) || !bytes.HasPrefix(line[cut:], []byte(macMember)) {
+		return nil, "", false
+	}
+	mac = string(line[cut+len(macMember) : len(line)-2])
+	if _, err := hex.DecodeString(mac); err != nil {
+		return nil, "", false
+	}
+	event = append(bytes.Clone(line[:cut]), '}')
+	return event, mac, true
+}
+
+// lastMAC returns the MAC of the last sealed line in path, so a reopened log continues its chain
+func lastMAC(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var last string
+	err = readBoundedLines(bufio.NewReaderSize(file, 64<<10), maxVerifyLine, func(line []byte) {
+		if _, mac, ok := splitMAC(line); ok {
+			last = mac
+		}
+	})
+	return last, err
+}
+
+// VerifyProblem is a line of a log that breaks the MAC chain
+type VerifyProblem struct {
+	Line   int
+	Reason string
+}
+
+// VerifyResult is the outcome of checking one log file's MAC chain
+type VerifyResult struct {
+	Path     string
+	Sealed   int // lines carrying a MAC
+	Unsealed int // lines written before the chain started
+	Problems []VerifyProblem
+}
+
+// OK reports whether the whole chain verified
+func (r VerifyResult) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// VerifyFile checks the MAC chain of one audit log. Unsealed lines are allowed
+// only before the first sealed one; after a broken link verification resumes
+// from that line's MAC so each edit or removal is reported where it happened.
+// Removing lines from the end of a file can't be detected.
+func VerifyFile(path string, key []byte) (VerifyResult, error) {
+	result := VerifyResult{Path: path}
+	file, err := os.Open(path)
+	if err != nil {
+		return result, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxVerifyLine)
+	prev := ""
+	started := false
+	for n := 1; scanner.Scan(); n++ {
+		event, mac, ok := splitMAC(scanner.Bytes())
+		if !ok {
+			if started {
+				result.Problems = append(result.Problems, VerifyProblem{Line: n, Reason: "missing MAC"})
+			} else {
+				result.Unsealed++
+			}
+			continue
+		}
+		started = true
+		result.Sealed++
+		if !hmac.Equal([]byte(mac), []byte(chainMAC(key, prev, event))) {
+			result.Problems = append(result.Problems, VerifyProblem{Line: n, Reason: "MAC mismatch: line edited, or lines before it removed or reordered"})
+		}
+		prev = mac
+	}
+	if err := scanner.Err(); err != nil {
+		return result, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return result, nil
+}
+
+// VerifyLogs checks the MAC chain of every audit log in the data directory, oldest first
+func VerifyLogs(key []byte) ([]VerifyResult, error) {
+	roller, err := NewRoller(RollerConfig{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create roller: %w", err)
+	}
+	defer roller.Close()
+
+	files, err := roller.ListLogFiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list log files: %w", err)
+	}
+	slices.Reverse(files)
+
+	results := make([]VerifyResult, 0, len(files))
+	for _, path := range files {
+		result, err := VerifyFile(path, key)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// FormatVerifyResults renders one line per file plus one per problem
+func FormatVerifyResults(results []VerifyResult) string {
+	var b strings.Builder
+	for _, r := range results {
+		status := "ok  "
+		if !r.OK() {
+			status = "FAIL"
+		}
+		fmt.Fprintf(&b, "%s %s: %d sealed", status, r.Path, r.Sealed)
+		if r.Unsealed > 0 {
+			fmt.Fprintf(&b, ", %d unsealed before the chain started", r.Unsealed)
+		}
+		b.WriteByte('\n')
+		for _, p := range r.Problems {
+			fmt.Fprintf(&b, "     line %d: %s\n", p.Line, p.Reason)
+		}
+	}
+	return b.String()
+}
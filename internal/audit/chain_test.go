@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// writeSealedLog writes events through a tamper-evident roller, reopening it
+// midway like a daemon restart, and returns the log's path and lines
+func writeSealedLog(t *testing.T, key []byte, events []string) (string, [][]byte) {
+	t.Helper()
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	half := len(events) / 2
+	var path string
+	for _, batch := range [][]string{events[:half], events[half:]} {
+		roller, err := NewRoller(RollerConfig{RotateOnStart: true, MACKey: key})
+		if err != nil {
+			t.Fatalf("Failed to create roller: %v", err)
+		}
+		for _, e := range batch {
+			if err := roller.Write([]byte(e + "\n")); err != nil {
+				t.Fatalf("Failed to write: %v", err)
+			}
+		}
+		path = roller.GetCurrentLogPath()
+		roller.Close()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+}
+
+func TestVerifyFile(t *testing.T) {
+	key := []byte("test-key")
+	events := []string{`{"event":"A","decision":"ALLOW"}`, `{"event":"B","decision":"DENY"}`, `{"event":"C","decision":"ALLOW"}`, `{"event":"D","decision":"DENY"}`}
+	path, lines := writeSealedLog(t, key, events)
+
+	for i, line := range lines {
+		event, _, ok := splitMAC(line)
+		if !ok || string(event) != events[i] {
+			t.Fatalf("Line %d: expected a sealed %s, got %s", i+1, events[i], line)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		lines    [][]byte
+		key      []byte
+		unsealed int
+		problems []int
+	}{
+		{name: "valid chain across a restart", lines: lines, key: key},
+		{name: "edited line", lines: [][]byte{lines[0], bytes.Replace(lines[1], []byte("DENY"), []byte("ALLOW"), 1), lines[2], lines[3]}, key: key, problems: []int{2}},
+		{name: "removed line", lines: [][]byte{lines[0], lines[2], lines[3]}, key: key, problems: []int{2}},
+		{name: "removed first line", lines: lines[1:], key: key, problems: []int{1}},
+		{name: "reordered lines", lines: [][]byte{lines[0], lines[2], lines[1], lines[3]}, key: key, problems: []int{2, 3, 4}},
+		{name: "inserted unsealed line", lines: [][]byte{lines[0], []byte(`{"event":"X"}`), lines[1], lines[2], lines[3]}, key: key, problems: []int{2}},
+		{name: "unsealed lines before the chain", lines: append([][]byte{[]byte(`{"event":"old"}`)}, lines...), key: key, unsealed: 1},
+		{name: "wrong key", lines: lines, key: []byte("other-key"), problems: []int{1, 2, 3, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(path, append(bytes.Join(tt.lines, []byte("\n")), '\n'), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			result, err := VerifyFile(path, tt.key)
+			if err != nil {
+				t.Fatalf("VerifyFile failed: %v", err)
+			}
+			var got []int
+			for _, p := range result.Problems {
+				got = append(got, p.Line)
+			}
+			if !reflect.DeepEqual(got, tt.problems) {
+				t.Errorf("Expected problems on lines %v, got %v", tt.problems, got)
+			}
+			if result.Unsealed != tt.unsealed {
+				t.Errorf("Expected %d unsealed lines, got %d", tt.unsealed, result.Unsealed)
+			}
+			if result.OK() != (len(tt.problems) == 0) {
+				t.Errorf("Expected OK %t, got %t", len(tt.problems) == 0, result.OK())
+			}
+		})
+	}
+}
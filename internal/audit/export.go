@@ -0,0 +1,248 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ExportFormats lists the formats ExportAccessDecisions writes
+var ExportFormats = []string{"csv", "jsonl"}
+
+// ExportOptions selects what ExportAccessDecisions writes
+type ExportOptions struct {
+	Format string // "csv" or "jsonl"
+	// Aggregate is "" for one row per event or "daily" for per-day-per-ref counts
+	Aggregate string
+}
+
+// ExportRow is one ACCESS_DECISION event in an export
+type ExportRow struct {
+	Timestamp time.Time `json:"timestamp"`
+	Path      string    `json:"path"`
+	UID       uint32    `json:"uid"`
+	Reference string    `json:"reference"`
+	Decision  string    `json:"decision"`
+	Rule      int       `json:"rule,omitempty"`
+	// FromCache and LatencyMS are set only for events whose details record them
+	FromCache *bool    `json:"from_cache,omitempty"`
+	LatencyMS *float64 `json:"latency_ms,omitempty"`
+}
+
+// DailyCount is how often a ref was allowed and denied on one UTC day
+type DailyCount struct {
+	Date      string `json:"date"`
+	Reference string `json:"reference"`
+	Allowed   int    `json:"allowed"`
+	Denied    int    `json:"denied"`
+}
+
+var (
+	exportHeader = []string{"timestamp", "path", "uid", "ref", "decision", "rule", "from_cache", "latency_ms"}
+	dailyHeader  = []string{"date", "ref", "allowed", "denied"}
+)
+
+// ExportAccessDecisions writes the ACCESS_DECISION events logged in the last
+// since to w, oldest first, and returns how many rows it wrote. Events are
+// streamed, so only one day's counts are held in memory when aggregating.
+func ExportAccessDecisions(w io.Writer, since time.Duration, opts ExportOptions) (int, error) {
+	roller, err := NewRoller(RollerConfig{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create roller: %w", err)
+	}
+	defer roller.Close()
+
+	logFiles, err := roller.ListLogFiles()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list log files: %w", err)
+	}
+	return exportFiles(w, logFiles, time.Now().Add(-since), opts)
+}
+
+// exportFiles exports from files (newest first, as returned by ListLogFiles)
+func exportFiles(w io.Writer, files []string, cutoff time.Time, opts ExportOptions) (int, error) {
+	if !slices.Contains(ExportFormats, opts.Format) {
+		return 0, fmt.Errorf("unknown export format %q (want csv or jsonl)", opts.Format)
+	}
+	if opts.Aggregate != "" && opts.Aggregate != "daily" {
+		return 0, fmt.Errorf("unknown aggregation %q (want daily)", opts.Aggregate)
+	}
+
+	out := newExportWriter(w, opts.Format)
+	header := exportHeader
+	if opts.Aggregate == "daily" {
+		header = dailyHeader
+	}
+	if err := out.header(header); err != nil {
+		return 0, err
+	}
+
+	var daily *dailyCounter
+	if opts.Aggregate == "daily" {
+		daily = &dailyCounter{out: out, counts: make(map[string]*DailyCount)}
+	}
+	var werr error
+	for i := len(files) - 1; i >= 0 && werr == nil; i-- {
+		if date, ok := logFileDate(files[i]); ok && !date.AddDate(0, 0, 1).After(cutoff) {
+			continue // The whole day predates the cutoff
+		}
+		// Files we can't read are skipped, as when scanning for denials
+		_ = scanEventFile(files[i], cutoff, func(event AuditEvent) {
+			if werr != nil || event.Event != "ACCESS_DECISION" {
+				return
+			}
+			if daily != nil {
+				werr = daily.add(event)
+				return
+			}
+			row := exportRowOf(event)
+			werr = out.write(row.record(), row)
+		})
+	}
+	if werr == nil && daily != nil {
+		werr = daily.flush()
+	}
+	if werr != nil {
+		return out.rows, fmt.Errorf("failed to write export: %w", werr)
+	}
+	if err := out.close(); err != nil {
+		return out.rows, fmt.Errorf("failed to write export: %w", err)
+	}
+	return out.rows, nil
+}
+
+// exportRowOf flattens an ACCESS_DECISION event into an export row
+func exportRowOf(event AuditEvent) ExportRow {
+	row := ExportRow{
+		Timestamp: event.Timestamp.UTC(),
+		Path:      event.PeerInfo.Path,
+		UID:       event.PeerInfo.UID,
+		Reference: event.Reference,
+		Decision:  event.Decision,
+	}
+	if row.Path == "" {
+		row.Path = event.PeerInfo.ContainerPath
+	}
+	if rule, err := strconv.Atoi(event.Details["matched_rule"]); err == nil {
+		row.Rule = rule
+	}
+	if fromCache, err := strconv.ParseBool(event.Details["from_cache"]); err == nil {
+		row.FromCache = &fromCache
+	}
+	if latency, err := strconv.ParseFloat(event.Details["latency_ms"], 64); err == nil {
+		row.LatencyMS = &latency
+	}
+	return row
+}
+
+// record is the row's CSV fields, in exportHeader order
+func (r ExportRow) record() []string {
+	rec := []string{r.Timestamp.Format(time.RFC3339Nano), r.Path, strconv.FormatUint(uint64(r.UID), 10), r.Reference, r.Decision, "", "", ""}
+	if r.Rule > 0 {
+		rec[5] = strconv.Itoa(r.Rule)
+	}
+	if r.FromCache != nil {
+		rec[6] = strconv.FormatBool(*r.FromCache)
+	}
+	if r.LatencyMS != nil {
+		rec[7] = strconv.FormatFloat(*r.LatencyMS, 'f', -1, 64)
+	}
+	return rec
+}
+
+// dailyCounter counts one day's decisions per ref, writing them out when the
+// next day's first event arrives
+type dailyCounter struct {
+	out    *exportWriter
+	day    string
+	counts map[string]*DailyCount
+}
+
+func (d *dailyCounter) add(event AuditEvent) error {
+	day := event.Timestamp.UTC().Format("2006-01-02")
+	if day != d.day {
+		if err := d.flush(); err != nil {
+			return err
+		}
+		d.day = day
+	}
+	c := d.counts[event.Reference]
+	if c == nil {
+		c = &DailyCount{Date: day, Reference: event.Reference}
+		d.counts[event.Reference] = c
+	}
+	if event.Decision == "ALLOW" {
+		c.Allowed++
+	} else {
+		c.Denied++
+	}
+	return nil
+}
+
+// flush writes the current day's counts sorted by ref
+func (d *dailyCounter) flush() error {
+	refs := make([]string, 0, len(d.counts))
+	for ref := range d.counts {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	for _, ref := range refs {
+		c := d.counts[ref]
+		rec := []string{c.Date, c.Reference, strconv.Itoa(c.Allowed), strconv.Itoa(c.Denied)}
+		if err := d.out.write(rec, c); err != nil {
+			return err
+		}
+	}
+	clear(d.counts)
+	return nil
+}
+
+// exportWriter writes rows as CSV records or JSON lines through one buffer
+type exportWriter struct {
+	buf  *bufio.Writer
+	csv  *csv.Writer
+	json *json.Encoder
+	rows int
+}
+
+func newExportWriter(w io.Writer, format string) *exportWriter {
+	e := &exportWriter{buf: bufio.NewWriter(w)}
+	if format == "csv" {
+		e.csv = csv.NewWriter(e.buf)
+	} else {
+		e.json = json.NewEncoder(e.buf)
+	}
+	return e
+}
+
+// header writes the CSV header row; JSON lines have none
+func (e *exportWriter) header(fields []string) error {
+	if e.csv == nil {
+		return nil
+	}
+	return e.csv.Write(fields)
+}
+
+func (e *exportWriter) write(record []string, v any) error {
+	e.rows++
+	if e.csv != nil {
+		return e.csv.Write(record)
+	}
+	return e.json.Encode(v)
+}
+
+func (e *exportWriter) close() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return e.buf.Flush()
+}
@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/security"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// exportLogs writes two days of audit logs and returns them newest first
+func exportLogs(t *testing.T) []string {
+	t.Helper()
+	dir := t.TempDir()
+	day1 := time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	app := security.PeerInfo{PID: 42, UID: 1000, Path: "/usr/bin/app"}
+	odd := security.PeerInfo{PID: 43, UID: 1001, Path: `/opt/tools, "beta"/run`}
+	decision := func(ts time.Time, peer security.PeerInfo, ref, verdict string, details map[string]string) AuditEvent {
+		return AuditEvent{Timestamp: ts, Event: "ACCESS_DECISION", PeerInfo: peer, Reference: ref, Decision: verdict, Details: details}
+	}
+
+	first := writeAuditLog(t, dir, day1, []AuditEvent{
+		decision(day1.Add(-time.Hour), app, "op://prod/old/password", "ALLOW", nil),
+		decision(day1, app, "op://prod/db/password", "ALLOW", map[string]string{"matched_rule": "2", "from_cache": "false", "latency_ms": "41.5"}),
+		decision(day1.Add(time.Minute), app, "op://prod/db/password", "ALLOW", map[string]string{"matched_rule": "2", "from_cache": "true", "latency_ms": "0.2"}),
+		{Timestamp: day1.Add(2 * time.Minute), Event: "SESSION_UNLOCK", Decision: "ALLOW"},
+		decision(day1.Add(3*time.Minute), odd, `op://prod/item, "quoted"/field`, "DENY", nil),
+	}, "not json")
+	second := writeAuditLog(t, dir, day2, []AuditEvent{
+		decision(day2, app, "op://prod/db/password", "DENY", map[string]string{"deny_reason": "quota_exceeded", "matched_rule": "2"}),
+		decision(day2.Add(time.Minute), odd, `op://prod/item, "quoted"/field`, "ALLOW", map[string]string{"matched_rule": "1"}),
+	})
+	return []string{second, first}
+}
+
+func TestExportFiles_Golden(t *testing.T) {
+	files := exportLogs(t)
+	cutoff := time.Date(2026, 10, 14, 8, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		golden string
+		opts   ExportOptions
+		rows   int
+	}{
+		{golden: "export.csv", opts: ExportOptions{Format: "csv"}, rows: 5},
+		{golden: "export.jsonl", opts: ExportOptions{Format: "jsonl"}, rows: 5},
+		{golden: "export_daily.csv", opts: ExportOptions{Format: "csv", Aggregate: "daily"}, rows: 4},
+		{golden: "export_daily.jsonl", opts: ExportOptions{Format: "jsonl", Aggregate: "daily"}, rows: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			var b bytes.Buffer
+			rows, err := exportFiles(&b, files, cutoff, tt.opts)
+			if err != nil {
+				t.Fatalf("Export failed: %v", err)
+			}
+			if rows != tt.rows {
+				t.Errorf("Expected %d rows, got %d", tt.rows, rows)
+			}
+			path := filepath.Join("testdata", tt.golden)
+			if *updateGolden {
+				if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+					t.Fatalf("Failed to update golden file: %v", err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read golden file: %v", err)
+			}
+			if b.String() != string(want) {
+				t.Errorf("Expected %s:\n%s\ngot:\n%s", path, want, b.String())
+			}
+		})
+	}
+}
+
+func TestExportFiles_InvalidOptions(t *testing.T) {
+	for _, opts := range []ExportOptions{{Format: "xlsx"}, {Format: "csv", Aggregate: "weekly"}} {
+		if _, err := exportFiles(&bytes.Buffer{}, nil, time.Time{}, opts); err == nil {
+			t.Errorf("Expected an error for %+v", opts)
+		}
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{input: "24h", expected: 24 * time.Hour},
+		{input: "90d", expected: 90 * 24 * time.Hour},
+		{input: "0d", expected: 0},
+		{input: "1.5d", wantErr: true},
+		{input: "-1d", wantErr: true},
+		{input: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSince(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected error %v, got %v", tt.input, tt.wantErr, err)
+			continue
+		}
+		if !tt.wantErr && got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.input, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package audit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zach-source/opx/internal/policy"
+	"github.com/zach-source/opx/internal/util"
+)
+
+// Supported --group-by modes
+const (
+	GroupByPath  = "path"
+	GroupByVault = "vault"
+	GroupByRef   = "ref"
+)
+
+// noVault labels refs whose vault can't be determined
+const noVault = "(no vault)"
+
+// DenialGroup is a set of denials sharing a key, optionally split into subgroups.
+// Denials lists every member in display order (subgroup by subgroup).
+type DenialGroup struct {
+	Key       string
+	Count     int // total times denied across the group
+	Denials   []DenialEvent
+	Subgroups []DenialGroup
+}
+
+// VaultFromRef extracts the vault (op://VAULT/...) or mount (vault://MOUNT/...) from a ref
+func VaultFromRef(ref string) string {
+	_, rest, found := strings.Cut(ref, "://")
+	if !found {
+		return ""
+	}
+	vault, _, _ := strings.Cut(rest, "/")
+	return vault
+}
+
+// GroupDenials groups denials by path (subgrouped by vault), by vault (subgrouped
+// by path) or by ref. Groups are ordered by total count, most denied first.
+func GroupDenials(denials []DenialEvent, by string) ([]DenialGroup, error) {
+	vaultKey := func(d DenialEvent) string {
+		if v := VaultFromRef(d.Reference); v != "" {
+			return v
+		}
+		return noVault
+	}
+	pathKey := func(d DenialEvent) string { return d.Path }
+	refKey := func(d DenialEvent) string { return d.Reference }
+
+	switch by {
+	case GroupByPath, "":
+		return buildGroups(GroupDenialsByPath(denials), vaultKey), nil
+	case GroupByVault:
+		return buildGroups(util.GroupBy(denials, vaultKey), pathKey), nil
+	case GroupByRef:
+		return buildGroups(util.GroupBy(denials, refKey), nil), nil
+	default:
+		return nil, fmt.Errorf("unknown group-by %q (want path, vault or ref)", by)
+	}
+}
+
+// buildGroups turns a grouping into sorted DenialGroups, splitting each by subKey when set
+func buildGroups(grouped map[string][]DenialEvent, subKey func(DenialEvent) string) []DenialGroup {
+	groups := make([]DenialGroup, 0, len(grouped))
+	for key, members := range grouped {
+		group := DenialGroup{Key: key}
+		if subKey == nil {
+			group.Denials = sortDenials(members)
+		} else {
+			group.Subgroups = buildGroups(util.GroupBy(members, subKey), nil)
+			for _, sub := range group.Subgroups {
+				group.Denials = append(group.Denials, sub.Denials...)
+			}
+		}
+		group.Count = TotalDenials(group.Denials)
+		groups = append(groups, group)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].Key < groups[j].Key
+	})
+	return groups
+}
+
+func sortDenials(denials []DenialEvent) []DenialEvent {
+	sorted := append([]DenialEvent{}, denials...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		if sorted[i].Path != sorted[j].Path {
+			return sorted[i].Path < sorted[j].Path
+		}
+		return sorted[i].Reference < sorted[j].Reference
+	})
+	return sorted
+}
+
+// TopGroups keeps the first n groups (n <= 0 keeps all)
+func TopGroups(groups []DenialGroup, n int) []DenialGroup {
+	if n <= 0 || n >= len(groups) {
+		return groups
+	}
+	return groups[:n]
+}
+
+// FlattenGroups returns every denial in display order; denial [i+1] in
+// RenderDenialGroups output is element i
+func FlattenGroups(groups []DenialGroup) []DenialEvent {
+	var all []DenialEvent
+	for _, g := range groups {
+		all = append(all, g.Denials...)
+	}
+	return all
+}
+
+// RenderDenialGroups formats groups with per-group counts. Groups are labelled
+// [g1], [g2]... and denials numbered [1], [2]... across all groups.
+func RenderDenialGroups(groups []DenialGroup, by string) string {
+	var sb strings.Builder
+	n := 0
+	entry := func(indent string, d DenialEvent) {
+		n++
+		label := d.Reference
+		if by == GroupByRef {
+			label = d.Path
+		}
+		fmt.Fprintf(&sb, "%s[%d] %s  (%s, last %s)\n", indent, n, label, pluralize(d.Count, "denial"), d.Timestamp.Format("2006-01-02 15:04:05"))
+		if d.Cmdline != "" {
+			fmt.Fprintf(&sb, "%s    cmd: %s\n", indent, d.Cmdline)
+		}
+	}
+
+	for i, g := range groups {
+		fmt.Fprintf(&sb, "[g%d] %s: %s\n", i+1, g.Key, pluralize(g.Count, "denial"))
+		if len(g.Subgroups) == 0 {
+			for _, d := range g.Denials {
+				entry("    ", d)
+			}
+			continue
+		}
+		for _, sub := range g.Subgroups {
+			fmt.Fprintf(&sb, "    %s: %s\n", sub.Key, pluralize(sub.Count, "denial"))
+			for _, d := range sub.Denials {
+				entry("        ", d)
+			}
+		}
+	}
+	return sb.String()
+}
+
+func pluralize(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+// ConsolidateRules builds one rule per executable path covering every ref it was
+// denied, so a whole group can be allowed at once. Rules are ordered by path.
+func ConsolidateRules(denials []DenialEvent) []policy.Rule {
+	byPath := GroupDenialsByPath(denials)
+	paths := make([]string, 0, len(byPath))
+	for path := range byPath {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	rules := make([]policy.Rule, 0, len(paths))
+	for _, path := range paths {
+		var refs []string
+		for _, d := range byPath[path] {
+			if !util.Contains(refs, d.Reference) {
+				refs = append(refs, d.Reference)
+			}
+		}
+		sort.Strings(refs)
+		rules = append(rules, policy.Rule{Path: path, Refs: refs})
+	}
+	return rules
+}
@@ -0,0 +1,170 @@
+package audit
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/policy"
+)
+
+// groupFixture has two executables reading across two vaults plus a non-op ref
+func groupFixture() []DenialEvent {
+	ts := time.Date(2025, 1, 2, 15, 4, 5, 0, time.Local)
+	return []DenialEvent{
+		{Timestamp: ts, Path: "/usr/bin/app", Reference: "op://prod/db/password", Count: 5},
+		{Timestamp: ts, Path: "/usr/bin/app", Reference: "op://prod/api/token", Count: 2},
+		{Timestamp: ts, Path: "/usr/bin/app", Reference: "op://dev/db/password", Count: 1},
+		{Timestamp: ts, Path: "/usr/bin/cron", Reference: "op://prod/db/password", Count: 3},
+		{Timestamp: ts, Path: "/usr/bin/cron", Reference: "env-secret", Count: 1},
+	}
+}
+
+func TestVaultFromRef(t *testing.T) {
+	tests := []struct {
+		ref   string
+		vault string
+	}{
+		{"op://prod/db/password", "prod"},
+		{"vault://secret/data/app#key", "secret"},
+		{"op://prod", "prod"},
+		{"env-secret", ""},
+	}
+
+	for _, tt := range tests {
+		if got := VaultFromRef(tt.ref); got != tt.vault {
+			t.Errorf("VaultFromRef(%q): expected %q, got %q", tt.ref, tt.vault, got)
+		}
+	}
+}
+
+func TestRenderDenialGroups(t *testing.T) {
+	tests := []struct {
+		by       string
+		top      int
+		expected string
+	}{
+		{
+			by: GroupByPath,
+			expected: "" +
+				"[g1] /usr/bin/app: 8 denials\n" +
+				"    prod: 7 denials\n" +
+				"        [1] op://prod/db/password  (5 denials, last 2025-01-02 15:04:05)\n" +
+				"        [2] op://prod/api/token  (2 denials, last 2025-01-02 15:04:05)\n" +
+				"    dev: 1 denial\n" +
+				"        [3] op://dev/db/password  (1 denial, last 2025-01-02 15:04:05)\n" +
+				"[g2] /usr/bin/cron: 4 denials\n" +
+				"    prod: 3 denials\n" +
+				"        [4] op://prod/db/password  (3 denials, last 2025-01-02 15:04:05)\n" +
+				"    (no vault): 1 denial\n" +
+				"        [5] env-secret  (1 denial, last 2025-01-02 15:04:05)\n",
+		},
+		{
+			by: GroupByVault,
+			expected: "" +
+				"[g1] prod: 10 denials\n" +
+				"    /usr/bin/app: 7 denials\n" +
+				"        [1] op://prod/db/password  (5 denials, last 2025-01-02 15:04:05)\n" +
+				"        [2] op://prod/api/token  (2 denials, last 2025-01-02 15:04:05)\n" +
+				"    /usr/bin/cron: 3 denials\n" +
+				"        [3] op://prod/db/password  (3 denials, last 2025-01-02 15:04:05)\n" +
+				"[g2] (no vault): 1 denial\n" +
+				"    /usr/bin/cron: 1 denial\n" +
+				"        [4] env-secret  (1 denial, last 2025-01-02 15:04:05)\n" +
+				"[g3] dev: 1 denial\n" +
+				"    /usr/bin/app: 1 denial\n" +
+				"        [5] op://dev/db/password  (1 denial, last 2025-01-02 15:04:05)\n",
+		},
+		{
+			by:  GroupByRef,
+			top: 2,
+			expected: "" +
+				"[g1] op://prod/db/password: 8 denials\n" +
+				"    [1] /usr/bin/app  (5 denials, last 2025-01-02 15:04:05)\n" +
+				"    [2] /usr/bin/cron  (3 denials, last 2025-01-02 15:04:05)\n" +
+				"[g2] op://prod/api/token: 2 denials\n" +
+				"    [3] /usr/bin/app  (2 denials, last 2025-01-02 15:04:05)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.by, func(t *testing.T) {
+			groups, err := GroupDenials(groupFixture(), tt.by)
+			if err != nil {
+				t.Fatalf("GroupDenials failed: %v", err)
+			}
+			got := RenderDenialGroups(TopGroups(groups, tt.top), tt.by)
+			if got != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestGroupDenials_UnknownMode(t *testing.T) {
+	if _, err := GroupDenials(groupFixture(), "account"); err == nil {
+		t.Error("Expected error for unknown group-by mode")
+	}
+}
+
+func TestTopGroups(t *testing.T) {
+	groups, _ := GroupDenials(groupFixture(), GroupByRef)
+	tests := []struct {
+		n        int
+		expected int
+	}{
+		{0, 4},
+		{-1, 4},
+		{1, 1},
+		{10, 4},
+	}
+
+	for _, tt := range tests {
+		if got := len(TopGroups(groups, tt.n)); got != tt.expected {
+			t.Errorf("TopGroups(%d): expected %d groups, got %d", tt.n, tt.expected, got)
+		}
+	}
+}
+
+func TestConsolidateRules(t *testing.T) {
+	groups, err := GroupDenials(groupFixture(), GroupByVault)
+	if err != nil {
+		t.Fatalf("GroupDenials failed: %v", err)
+	}
+
+	// The "prod" vault group spans both executables
+	rules := ConsolidateRules(groups[0].Denials)
+	expected := []policy.Rule{
+		{Path: "/usr/bin/app", Refs: []string{"op://prod/api/token", "op://prod/db/password"}},
+		{Path: "/usr/bin/cron", Refs: []string{"op://prod/db/password"}},
+	}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("Expected rules %+v, got %+v", expected, rules)
+	}
+
+	// Duplicate refs for the same path are merged
+	merged := ConsolidateRules([]DenialEvent{
+		{Path: "/usr/bin/app", Reference: "op://a/x/y"},
+		{Path: "/usr/bin/app", Reference: "op://a/x/y"},
+		{Path: "/usr/bin/app", Reference: "op://a/b/c"},
+	})
+	expected = []policy.Rule{{Path: "/usr/bin/app", Refs: []string{"op://a/b/c", "op://a/x/y"}}}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("Expected rules %+v, got %+v", expected, merged)
+	}
+}
+
+func TestRenderDenialGroups_Cmdline(t *testing.T) {
+	ts := time.Date(2025, 1, 2, 15, 4, 5, 0, time.Local)
+	groups, _ := GroupDenials([]DenialEvent{
+		{Timestamp: ts, Path: "/usr/bin/app", Reference: "op://prod/db/password", Count: 1, Cmdline: "app --token=[REDACTED] serve"},
+	}, GroupByRef)
+
+	expected := "" +
+		"[g1] op://prod/db/password: 1 denial\n" +
+		"    [1] /usr/bin/app  (1 denial, last 2025-01-02 15:04:05)\n" +
+		"        cmd: app --token=[REDACTED] serve\n"
+	if got := RenderDenialGroups(groups, GroupByRef); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
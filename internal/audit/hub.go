@@ -0,0 +1,72 @@
+package audit
+
+import "sync"
+
+// Hub fans out audit events to live subscribers. Subscribers that fall behind
+// (full buffer) are dropped rather than allowed to block logging.
+type Hub struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// Subscription receives events on C until it is unsubscribed or dropped, at which point C is closed
+type Subscription struct {
+	C  <-chan AuditEvent
+	ch chan AuditEvent
+}
+
+// NewHub creates an empty broadcast hub
+func NewHub() *Hub {
+	return &Hub{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe registers a new subscriber with the given channel buffer size
+func (h *Hub) Subscribe(buffer int) *Subscription {
+	if buffer < 1 {
+		buffer = 1
+	}
+	ch := make(chan AuditEvent, buffer)
+	sub := &Subscription{C: ch, ch: ch}
+
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+	return sub
+}
+
+// Unsubscribe removes a subscriber and closes its channel. Safe to call more than once.
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(sub)
+}
+
+// Publish delivers an event to all subscribers without blocking
+func (h *Hub) Publish(event AuditEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subs {
+		select {
+		case sub.ch <- event:
+		default:
+			// Slow subscriber: drop it so logging never blocks
+			h.remove(sub)
+		}
+	}
+}
+
+// Len returns the number of active subscribers
+func (h *Hub) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+// remove must be called with h.mu held
+func (h *Hub) remove(sub *Subscription) {
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.ch)
+	}
+}
@@ -0,0 +1,67 @@
+package audit
+
+import (
+	"testing"
+)
+
+func TestHub_SubscribeReceives(t *testing.T) {
+	hub := NewHub()
+	sub1 := hub.Subscribe(4)
+	sub2 := hub.Subscribe(4)
+
+	hub.Publish(AuditEvent{Event: "ACCESS_DECISION", Decision: "DENY"})
+
+	for i, sub := range []*Subscription{sub1, sub2} {
+		select {
+		case ev := <-sub.C:
+			if ev.Decision != "DENY" {
+				t.Errorf("Subscriber %d: expected DENY, got %s", i, ev.Decision)
+			}
+		default:
+			t.Errorf("Subscriber %d: expected an event", i)
+		}
+	}
+}
+
+func TestHub_Unsubscribe(t *testing.T) {
+	hub := NewHub()
+	sub := hub.Subscribe(4)
+	hub.Unsubscribe(sub)
+
+	if hub.Len() != 0 {
+		t.Errorf("Expected no subscribers, got %d", hub.Len())
+	}
+	if _, ok := <-sub.C; ok {
+		t.Error("Expected channel to be closed after unsubscribe")
+	}
+
+	// Publishing and unsubscribing again must not panic
+	hub.Publish(AuditEvent{Event: "AUTHENTICATION"})
+	hub.Unsubscribe(sub)
+}
+
+func TestHub_DropsSlowSubscriber(t *testing.T) {
+	hub := NewHub()
+	slow := hub.Subscribe(1)
+	fast := hub.Subscribe(8)
+
+	for i := 0; i < 3; i++ {
+		hub.Publish(AuditEvent{Event: "ACCESS_DECISION"})
+	}
+
+	if hub.Len() != 1 {
+		t.Fatalf("Expected slow subscriber to be dropped, %d remain", hub.Len())
+	}
+
+	// The slow subscriber sees its buffered event, then a closed channel
+	if _, ok := <-slow.C; !ok {
+		t.Error("Expected buffered event before close")
+	}
+	if _, ok := <-slow.C; ok {
+		t.Error("Expected slow subscriber channel to be closed")
+	}
+
+	if len(fast.C) != 3 {
+		t.Errorf("Expected fast subscriber to receive all 3 events, got %d", len(fast.C))
+	}
+}
@@ -0,0 +1,304 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zach-source/opx/internal/policy"
+	"github.com/zach-source/opx/internal/util"
+)
+
+// ParseSelection parses 1-based selections like "1-3,5" or "all" into sorted,
+// de-duplicated 0-based indices below n. Unparseable or out-of-range entries
+// are returned separately so the caller can report them.
+func ParseSelection(input string, n int) (indices []int, invalid []string) {
+	input = strings.TrimSpace(input)
+	if strings.EqualFold(input, "all") {
+		for i := 0; i < n; i++ {
+			indices = append(indices, i)
+		}
+		return indices, nil
+	}
+
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(input, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		lo, hi, ok := parseRange(part)
+		if !ok || lo < 1 || hi > n || lo > hi {
+			invalid = append(invalid, part)
+			continue
+		}
+		for num := lo; num <= hi; num++ {
+			if !seen[num-1] {
+				seen[num-1] = true
+				indices = append(indices, num-1)
+			}
+		}
+	}
+
+	sort.Ints(indices)
+	return indices, invalid
+}
+
+// parseRange parses "N" or "N-M"
+func parseRange(s string) (lo, hi int, ok bool) {
+	from, to, isRange := strings.Cut(s, "-")
+	lo, err := strconv.Atoi(strings.TrimSpace(from))
+	if err != nil {
+		return 0, 0, false
+	}
+	if !isRange {
+		return lo, lo, true
+	}
+	hi, err = strconv.Atoi(strings.TrimSpace(to))
+	if err != nil {
+		return 0, 0, false
+	}
+	return lo, hi, true
+}
+
+// PolicyDiff renders a line diff between two policies' JSON forms, prefixing
+// removed lines with "-", added lines with "+" and unchanged lines with " "
+func PolicyDiff(before, after policy.Policy) string {
+	a := policyLines(before)
+	b := policyLines(after)
+
+	// Longest common subsequence table; policies are small
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var sb strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			sb.WriteString("  " + a[i] + "\n")
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			sb.WriteString("- " + a[i] + "\n")
+			i++
+		default:
+			sb.WriteString("+ " + b[j] + "\n")
+			j++
+		}
+	}
+	return sb.String()
+}
+
+func policyLines(pol policy.Policy) []string {
+	if pol.Allow == nil {
+		pol.Allow = []policy.Rule{}
+	}
+	data, _ := json.MarshalIndent(pol, "", "  ")
+	return strings.Split(string(data), "\n")
+}
+
+// ParseGroupedSelection splits input into denial selections ("1-3,5", "all") and
+// group selections ("g2", "g1-2"), returning sorted 0-based indices for each
+func ParseGroupedSelection(input string, nDenials, nGroups int) (denials, groups []int, invalid []string) {
+	var denialParts, groupParts []string
+	for _, part := range strings.Split(input, ",") {
+		part = strings.TrimSpace(part)
+		if len(part) > 1 && (part[0] == 'g' || part[0] == 'G') && part[1] >= '0' && part[1] <= '9' {
+			idx, bad := ParseSelection(part[1:], nGroups)
+			if len(bad) > 0 {
+				invalid = append(invalid, part)
+			}
+			groupParts = append(groupParts, joinInts(idx)...)
+			continue
+		}
+		denialParts = append(denialParts, part)
+	}
+
+	denials, badDenials := ParseSelection(strings.Join(denialParts, ","), nDenials)
+	invalid = append(invalid, badDenials...)
+	groups, _ = ParseSelection(strings.Join(groupParts, ","), nGroups)
+	return denials, groups, invalid
+}
+
+// joinInts renders 0-based indices back as 1-based selection entries
+func joinInts(indices []int) []string {
+	parts := make([]string, len(indices))
+	for i, idx := range indices {
+		parts[i] = strconv.Itoa(idx + 1)
+	}
+	return parts
+}
+
+// ruleCandidate is one rule the user is asked to approve, with alternative ref sets
+type ruleCandidate struct {
+	path    string
+	title   string
+	label   string // short name used when the candidate is skipped
+	options [][]string
+}
+
+func denialCandidate(d DenialEvent) ruleCandidate {
+	c := ruleCandidate{path: d.Path, title: fmt.Sprintf("%s -> %s", d.Path, d.Reference), label: d.Reference}
+	for _, pattern := range SuggestAllowPattern(d.Reference) {
+		c.options = append(c.options, []string{pattern})
+	}
+	return c
+}
+
+// groupCandidates offers one consolidated rule per executable path in the group
+func groupCandidates(label string, g DenialGroup) []ruleCandidate {
+	var candidates []ruleCandidate
+	for _, rule := range ConsolidateRules(g.Denials) {
+		c := ruleCandidate{
+			path:    rule.Path,
+			title:   fmt.Sprintf("%s (group %s: %s)", rule.Path, label, pluralize(len(rule.Refs), "ref")),
+			label:   fmt.Sprintf("group %s (%s)", label, rule.Path),
+			options: [][]string{rule.Refs},
+		}
+
+		// Widen op:// refs to their vaults
+		var vaults []string
+		for _, ref := range rule.Refs {
+			pattern := ref
+			if suggestions := SuggestAllowPattern(ref); len(suggestions) == 3 {
+				pattern = suggestions[1]
+			}
+			if !util.Contains(vaults, pattern) {
+				vaults = append(vaults, pattern)
+			}
+		}
+		if !slices.Equal(vaults, rule.Refs) {
+			c.options = append(c.options, vaults)
+		}
+		c.options = append(c.options, []string{"*"})
+		candidates = append(candidates, c)
+	}
+	return candidates
+}
+
+// RunInteractive walks the user through turning denials into allow rules for
+// the policy at policyPath. Denials are numbered as in RenderDenialGroups; a
+// whole group ("g2") becomes one consolidated rule per executable. Each change
+// is previewed as a diff before it is written, and can be undone right after.
+// Returns the number of rules kept.
+func RunInteractive(in io.Reader, out io.Writer, groups []DenialGroup, policyPath string) (int, error) {
+	denials := FlattenGroups(groups)
+	scanner := bufio.NewScanner(in)
+	readLine := func(prompt string) (string, bool) {
+		fmt.Fprint(out, prompt)
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return "", false
+		}
+		return strings.TrimSpace(scanner.Text()), true
+	}
+
+	fmt.Fprintln(out, "\nInteractive Policy Management")
+	fmt.Fprintln(out, "Select denials to create allow rules for (e.g. 1-3,5, g2 for a whole group, or 'all'; 'q' to quit):")
+
+	var candidates []ruleCandidate
+	for len(candidates) == 0 {
+		input, ok := readLine("> ")
+		if !ok {
+			fmt.Fprintln(out, "No selection made.")
+			return 0, scanner.Err()
+		}
+		if input == "q" || input == "quit" {
+			fmt.Fprintln(out, "Exiting without changes.")
+			return 0, nil
+		}
+
+		denialIdx, groupIdx, invalid := ParseGroupedSelection(input, len(denials), len(groups))
+		for _, entry := range invalid {
+			fmt.Fprintf(out, "Invalid selection: %s (choose 1-%d or g1-g%d)\n", entry, len(denials), len(groups))
+		}
+		for _, idx := range groupIdx {
+			candidates = append(candidates, groupCandidates(fmt.Sprintf("g%d", idx+1), groups[idx])...)
+		}
+		for _, idx := range denialIdx {
+			candidates = append(candidates, denialCandidate(denials[idx]))
+		}
+		if len(candidates) == 0 {
+			fmt.Fprintln(out, "No valid selections made, try again.")
+		}
+	}
+
+	added := 0
+	for _, c := range candidates {
+		fmt.Fprintf(out, "\nCreating allow rule for: %s\n", c.title)
+
+		// Suggest patterns
+		fmt.Fprintln(out, "Select permission level:")
+		for i, refs := range c.options {
+			fmt.Fprintf(out, "  [%d] %s\n", i+1, strings.Join(refs, ", "))
+		}
+
+		choiceInput, ok := readLine(fmt.Sprintf("Choice (1-%d): ", len(c.options)))
+		if !ok {
+			break
+		}
+		choice, err := strconv.Atoi(choiceInput)
+		if err != nil || choice < 1 || choice > len(c.options) {
+			fmt.Fprintf(out, "Invalid choice, skipping %s\n", c.label)
+			continue
+		}
+		refs := c.options[choice-1]
+
+		current, err := policy.LoadFile(policyPath)
+		if err != nil {
+			return added, fmt.Errorf("failed to load current policy: %w", err)
+		}
+		updated := withRule(current, policy.Rule{Path: c.path, Refs: refs})
+
+		fmt.Fprintf(out, "\nPolicy change (%s):\n%s", policyPath, PolicyDiff(current, updated))
+		confirm, ok := readLine("Write this change? (y/n) [y]: ")
+		if !ok {
+			break
+		}
+		if confirm != "" && !strings.EqualFold(confirm, "y") && !strings.EqualFold(confirm, "yes") {
+			fmt.Fprintln(out, "Skipped.")
+			continue
+		}
+
+		backup, err := policy.Save(policyPath, updated)
+		if err != nil {
+			fmt.Fprintf(out, "Failed to add rule: %v\n", err)
+			continue
+		}
+		added++
+		fmt.Fprintf(out, "✅ Added rule: %s can access %s\n", c.path, strings.Join(refs, ", "))
+
+		answer, ok := readLine("Type 'undo' to revert it, or press Enter to continue: ")
+		if ok && strings.EqualFold(answer, "undo") {
+			if err := policy.RestoreBackup(policyPath, backup); err != nil {
+				fmt.Fprintf(out, "Failed to undo: %v\n", err)
+				continue
+			}
+			added--
+			fmt.Fprintln(out, "↩️  Reverted.")
+		}
+		if !ok {
+			break
+		}
+	}
+
+	return added, scanner.Err()
+}
@@ -0,0 +1,294 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zach-source/opx/internal/policy"
+)
+
+func TestParseSelection(t *testing.T) {
+	tests := []struct {
+		input   string
+		n       int
+		indices []int
+		invalid []string
+	}{
+		{input: "1", n: 3, indices: []int{0}},
+		{input: "1,3", n: 3, indices: []int{0, 2}},
+		{input: "1-3,5", n: 5, indices: []int{0, 1, 2, 4}},
+		{input: " 2 - 3 , 1 ", n: 3, indices: []int{0, 1, 2}},
+		{input: "3,1-3", n: 3, indices: []int{0, 1, 2}},
+		{input: "all", n: 3, indices: []int{0, 1, 2}},
+		{input: "ALL", n: 2, indices: []int{0, 1}},
+		{input: "0,4,x,3-1", n: 3, invalid: []string{"0", "4", "x", "3-1"}},
+		{input: "2,9", n: 3, indices: []int{1}, invalid: []string{"9"}},
+		{input: "1-", n: 3, invalid: []string{"1-"}},
+		{input: "", n: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			indices, invalid := ParseSelection(tt.input, tt.n)
+			if !reflect.DeepEqual(indices, tt.indices) {
+				t.Errorf("Expected indices %v, got %v", tt.indices, indices)
+			}
+			if !reflect.DeepEqual(invalid, tt.invalid) {
+				t.Errorf("Expected invalid %v, got %v", tt.invalid, invalid)
+			}
+		})
+	}
+}
+
+func TestPolicyDiff(t *testing.T) {
+	before := policy.Policy{}
+	after := withRule(before, policy.Rule{Path: "/usr/bin/tool", Refs: []string{"op://vault/*"}})
+
+	diff := PolicyDiff(before, after)
+	for _, want := range []string{
+		`+ "path": "/usr/bin/tool",`,
+		`- "allow": [],`,
+		`- "default_deny": false`,
+		`+ "default_deny": true`,
+		`  {`,
+	} {
+		if !hasDiffLine(diff, want) {
+			t.Errorf("Expected diff line %q, got:\n%s", want, diff)
+		}
+	}
+	if strings.Contains(PolicyDiff(after, after), "+") {
+		t.Error("Expected no additions when diffing identical policies")
+	}
+}
+
+// hasDiffLine matches a diff line by marker and content, ignoring JSON indentation
+func hasDiffLine(diff, want string) bool {
+	marker, content := want[:1], strings.TrimSpace(want[1:])
+	for _, line := range strings.Split(diff, "\n") {
+		if strings.HasPrefix(line, marker) && strings.TrimSpace(line[1:]) == content {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRunInteractive(t *testing.T) {
+	denials := []DenialEvent{
+		{Path: "/usr/bin/a", Reference: "op://vault/item/one"},
+		{Path: "/usr/bin/b", Reference: "op://vault/item/two"},
+		{Path: "/usr/bin/c", Reference: "op://other/item/three"},
+	}
+
+	tests := []struct {
+		name      string
+		input     string
+		added     int
+		paths     []string
+		expectOut []string
+	}{
+		{
+			name:      "range selection",
+			input:     "1-2\n1\n\n\n2\ny\n\n",
+			added:     2,
+			paths:     []string{"/usr/bin/a", "/usr/bin/b"},
+			expectOut: []string{"Policy change", "op://vault/*"},
+		},
+		{
+			name:      "invalid entries are reported and re-asked",
+			input:     "7,x\n3\n3\n\n\n",
+			added:     1,
+			paths:     []string{"/usr/bin/c"},
+			expectOut: []string{"Invalid selection: 7", "Invalid selection: x", "No valid selections"},
+		},
+		{
+			name:      "invalid choice skips denial",
+			input:     "1,2\n9\n1\n\n\n",
+			added:     1,
+			paths:     []string{"/usr/bin/b"},
+			expectOut: []string{"Invalid choice, skipping op://vault/item/one"},
+		},
+		{
+			name:      "undo restores previous policy",
+			input:     "all\n1\n\n\n1\n\nundo\n1\nn\n",
+			added:     1,
+			paths:     []string{"/usr/bin/a"},
+			expectOut: []string{"Reverted", "Skipped."},
+		},
+		{
+			name:      "quit",
+			input:     "q\n",
+			expectOut: []string{"Exiting without changes."},
+		},
+		{
+			name:      "EOF does not hang",
+			input:     "",
+			expectOut: []string{"No selection made."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policyPath := filepath.Join(t.TempDir(), "policy.json")
+			var out strings.Builder
+
+			groups, err := GroupDenials(denials, GroupByPath)
+			if err != nil {
+				t.Fatalf("GroupDenials failed: %v", err)
+			}
+			added, err := RunInteractive(strings.NewReader(tt.input), &out, groups, policyPath)
+			if err != nil {
+				t.Fatalf("RunInteractive failed: %v", err)
+			}
+			if added != tt.added {
+				t.Errorf("Expected %d rules added, got %d", tt.added, added)
+			}
+			for _, want := range tt.expectOut {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("Expected output to contain %q, got:\n%s", want, out.String())
+				}
+			}
+
+			pol, err := policy.LoadFile(policyPath)
+			if err != nil {
+				t.Fatalf("Failed to load policy: %v", err)
+			}
+			var paths []string
+			for _, rule := range pol.Allow {
+				paths = append(paths, rule.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.paths) {
+				t.Errorf("Expected rules for %v, got %v", tt.paths, paths)
+			}
+			if len(tt.paths) == 0 {
+				if _, err := os.Stat(policyPath); !os.IsNotExist(err) {
+					t.Error("Expected no policy file to be written")
+				}
+			}
+		})
+	}
+}
+
+func TestRunInteractive_GroupSelection(t *testing.T) {
+	groups, err := GroupDenials([]DenialEvent{
+		{Path: "/usr/bin/a", Reference: "op://vault/item/one", Count: 3},
+		{Path: "/usr/bin/a", Reference: "op://vault/item/two", Count: 2},
+		{Path: "/usr/bin/b", Reference: "op://other/item/three", Count: 1},
+	}, GroupByPath)
+	if err != nil {
+		t.Fatalf("GroupDenials failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		choice string
+		refs   []string
+	}{
+		{name: "exact refs", choice: "1", refs: []string{"op://vault/item/one", "op://vault/item/two"}},
+		{name: "vault wildcard", choice: "2", refs: []string{"op://vault/*"}},
+		{name: "any ref", choice: "3", refs: []string{"*"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policyPath := filepath.Join(t.TempDir(), "policy.json")
+			var out strings.Builder
+
+			input := "g1\n" + tt.choice + "\ny\n\n"
+			added, err := RunInteractive(strings.NewReader(input), &out, groups, policyPath)
+			if err != nil {
+				t.Fatalf("RunInteractive failed: %v", err)
+			}
+			if added != 1 {
+				t.Errorf("Expected 1 rule added, got %d", added)
+			}
+
+			pol, err := policy.LoadFile(policyPath)
+			if err != nil {
+				t.Fatalf("Failed to load policy: %v", err)
+			}
+			want := []policy.Rule{{Path: "/usr/bin/a", Refs: tt.refs}}
+			if !reflect.DeepEqual(pol.Allow, want) {
+				t.Errorf("Expected rules %+v, got %+v", want, pol.Allow)
+			}
+		})
+	}
+}
+
+func TestParseGroupedSelection(t *testing.T) {
+	tests := []struct {
+		input   string
+		denials []int
+		groups  []int
+		invalid []string
+	}{
+		{input: "1,3", denials: []int{0, 2}},
+		{input: "g2", groups: []int{1}},
+		{input: "G1-2, 4", denials: []int{3}, groups: []int{0, 1}},
+		{input: "all", denials: []int{0, 1, 2, 3}},
+		{input: "g3,g0,9", invalid: []string{"g3", "g0", "9"}},
+		{input: "g", invalid: []string{"g"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			denials, groups, invalid := ParseGroupedSelection(tt.input, 4, 2)
+			if !reflect.DeepEqual(denials, tt.denials) {
+				t.Errorf("Expected denials %v, got %v", tt.denials, denials)
+			}
+			if !reflect.DeepEqual(groups, tt.groups) {
+				t.Errorf("Expected groups %v, got %v", tt.groups, groups)
+			}
+			if !reflect.DeepEqual(invalid, tt.invalid) {
+				t.Errorf("Expected invalid %v, got %v", tt.invalid, invalid)
+			}
+		})
+	}
+}
+
+func TestRunInteractive_FilteredNumbering(t *testing.T) {
+	denials := []DenialEvent{
+		{Path: "/usr/bin/a", Reference: "op://vault/item/one", Count: 4},
+		{Path: "/usr/bin/b", Reference: "op://vault/item/two", Count: 1},
+		{Path: "/usr/bin/c", Reference: "op://other/item/three", Count: 2},
+	}
+
+	// Filtering out /usr/bin/a leaves /usr/bin/c as the first numbered denial
+	filtered := DenialFilter{RefPrefix: "op://", MinCount: 2, Path: "/usr/bin/c"}.Apply(denials)
+	groups, err := GroupDenials(filtered, GroupByPath)
+	if err != nil {
+		t.Fatalf("GroupDenials failed: %v", err)
+	}
+	if rendered := RenderDenialGroups(groups, GroupByPath); !strings.Contains(rendered, "[1] op://other/item/three") {
+		t.Fatalf("Expected the filtered denial to be numbered 1, got:\n%s", rendered)
+	}
+
+	policyPath := filepath.Join(t.TempDir(), "policy.json")
+	var out strings.Builder
+	added, err := RunInteractive(strings.NewReader("1\n1\ny\n\n"), &out, groups, policyPath)
+	if err != nil {
+		t.Fatalf("RunInteractive failed: %v", err)
+	}
+	if added != 1 {
+		t.Fatalf("Expected 1 rule added, got %d", added)
+	}
+	pol, err := policy.LoadFile(policyPath)
+	if err != nil {
+		t.Fatalf("Failed to load policy: %v", err)
+	}
+	want := []policy.Rule{{Path: "/usr/bin/c", Refs: []string{"op://other/item/three"}}}
+	if !reflect.DeepEqual(pol.Allow, want) {
+		t.Errorf("Expected selection 1 to map to the filtered denial, got %+v", pol.Allow)
+	}
+
+	// Indices beyond the filtered view are rejected rather than mapped to hidden denials
+	out.Reset()
+	if _, err := RunInteractive(strings.NewReader("2\nq\n"), &out, groups, policyPath); err != nil {
+		t.Fatalf("RunInteractive failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Invalid selection: 2") {
+		t.Errorf("Expected selection 2 to be invalid in the filtered view, got:\n%s", out.String())
+	}
+}
@@ -1,12 +1,10 @@
 package audit
 
 import (
-	"bufio"
-	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
+	"path"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,13 +18,14 @@ type DenialEvent struct {
 	PID       int       `json:"pid"`
 	Path      string    `json:"path"`
 	Reference string    `json:"reference"`
-	Count     int       `json:"count"` // How many times this combination was denied
+	Count     int       `json:"count"`             // How many times this combination was denied
+	Cmdline   string    `json:"cmdline,omitempty"` // Most recent peer command line, if recorded
 }
 
 // ScanRecentDenials reads audit logs and returns recent denial events
 func ScanRecentDenials(since time.Duration) ([]DenialEvent, error) {
-	// Create a roller to find log files
-	roller, err := NewRoller(DefaultRollerConfig())
+	// Create a roller to find log files; scanning must not rotate or flush
+	roller, err := NewRoller(RollerConfig{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create roller: %w", err)
 	}
@@ -38,76 +37,19 @@ func ScanRecentDenials(since time.Duration) ([]DenialEvent, error) {
 		return nil, fmt.Errorf("failed to list log files: %w", err)
 	}
 
-	if len(logFiles) == 0 {
-		return []DenialEvent{}, nil // No audit logs exist yet
-	}
-
-	// Parse denial events from all relevant log files
-	denials := make(map[string]*DenialEvent)
-	cutoff := time.Now().Add(-since)
-
-	for _, logFile := range logFiles {
-		file, err := os.Open(logFile)
-		if err != nil {
-			continue // Skip files we can't open
-		}
-
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			line := scanner.Text()
-			if line == "" {
-				continue
-			}
-
-			var event AuditEvent
-			if err := json.Unmarshal([]byte(line), &event); err != nil {
-				continue // Skip malformed lines
-			}
-
-			// Only interested in recent access denials
-			if event.Event != "ACCESS_DECISION" || event.Decision != "DENY" || event.Timestamp.Before(cutoff) {
-				continue
-			}
-
-			// Create unique key for this process+reference combination
-			key := fmt.Sprintf("%s|%s", event.PeerInfo.Path, event.Reference)
-
-			if existing, exists := denials[key]; exists {
-				existing.Count++
-				// Keep the most recent timestamp
-				if event.Timestamp.After(existing.Timestamp) {
-					existing.Timestamp = event.Timestamp
-				}
-			} else {
-				denials[key] = &DenialEvent{
-					Timestamp: event.Timestamp,
-					PID:       event.PeerInfo.PID,
-					Path:      event.PeerInfo.Path,
-					Reference: event.Reference,
-					Count:     1,
-				}
-			}
-		}
+	return scanDenials(logFiles, time.Now().Add(-since))
+}
 
-		if err := scanner.Err(); err != nil {
-			// Log error but continue with other files
-			continue
+// ParseSince parses a --since duration, which may also be a whole number of days such as 90d
+func ParseSince(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number of days in %q", s)
 		}
-
-		file.Close()
-	}
-
-	// Convert to slice and sort by count (most frequent first)
-	var result []DenialEvent
-	for _, denial := range denials {
-		result = append(result, *denial)
+		return time.Duration(n) * 24 * time.Hour, nil
 	}
-
-	sort.Slice(result, func(i, j int) bool {
-		return result[i].Count > result[j].Count
-	})
-
-	return result, nil
+	return time.ParseDuration(s)
 }
 
 // CreatePolicyRuleFromDenial creates a policy rule that would allow the denied access
@@ -140,37 +82,27 @@ func SuggestAllowPattern(reference string) []string {
 // AddRuleToPolicy adds a rule to an existing policy and saves it
 func AddRuleToPolicy(rule policy.Rule) error {
 	// Load current policy
-	pol, _, err := policy.Load()
+	pol, policyFile, err := policy.Load()
 	if err != nil {
 		return fmt.Errorf("failed to load current policy: %w", err)
 	}
 
-	// Add the new rule
-	pol.Allow = append(pol.Allow, rule)
+	if _, err := policy.Save(policyFile, withRule(pol, rule)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// withRule returns a copy of pol with rule appended
+func withRule(pol policy.Policy, rule policy.Rule) policy.Policy {
+	pol.Allow = append(append([]policy.Rule{}, pol.Allow...), rule)
 
 	// If this is the first rule and default_deny isn't set, set it to true
 	// to ensure the policy actually takes effect
 	if len(pol.Allow) == 1 && !pol.DefaultDeny {
 		pol.DefaultDeny = true
 	}
-
-	// Save the updated policy
-	configDir, err := util.ConfigDir()
-	if err != nil {
-		return fmt.Errorf("failed to get config directory: %w", err)
-	}
-
-	policyFile := filepath.Join(configDir, "policy.json")
-	data, err := json.MarshalIndent(pol, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal policy: %w", err)
-	}
-
-	if err := os.WriteFile(policyFile, data, 0600); err != nil {
-		return fmt.Errorf("failed to write policy file: %w", err)
-	}
-
-	return nil
+	return pol
 }
 
 // FormatDenialForDisplay formats a denial event for user display
@@ -183,10 +115,72 @@ func FormatDenialForDisplay(i int, denial DenialEvent) string {
 		denial.Timestamp.Format("2006-01-02 15:04:05"))
 }
 
-// FilterDenialsByPath filters denials for a specific executable path using generics
-func FilterDenialsByPath(denials []DenialEvent, path string) []DenialEvent {
+// FilterDenialsByPath keeps denials whose executable path contains pattern, or
+// matches it as a glob (against the full path or its base name) when pattern
+// has glob characters
+func FilterDenialsByPath(denials []DenialEvent, pattern string) []DenialEvent {
+	if !strings.ContainsAny(pattern, "*?[") {
+		return util.Filter(denials, func(d DenialEvent) bool {
+			return strings.Contains(d.Path, pattern)
+		})
+	}
+	return util.Filter(denials, func(d DenialEvent) bool {
+		if ok, _ := path.Match(pattern, d.Path); ok {
+			return true
+		}
+		ok, _ := path.Match(pattern, path.Base(d.Path))
+		return ok
+	})
+}
+
+// FilterDenialsByRefPrefix keeps denials whose reference starts with prefix
+func FilterDenialsByRefPrefix(denials []DenialEvent, prefix string) []DenialEvent {
+	return util.Filter(denials, func(d DenialEvent) bool {
+		return strings.HasPrefix(d.Reference, prefix)
+	})
+}
+
+// FilterDenialsByMinCount keeps denials that happened at least n times
+func FilterDenialsByMinCount(denials []DenialEvent, n int) []DenialEvent {
+	return util.Filter(denials, func(d DenialEvent) bool {
+		return d.Count >= n
+	})
+}
+
+// DenialFilter narrows the denials shown by `opx audit`; zero fields don't filter
+type DenialFilter struct {
+	Path            string // substring or glob of the executable path
+	RefPrefix       string
+	MinCount        int
+	CmdlineContains string
+}
+
+// Apply returns the denials matching every set field, keeping their order
+func (f DenialFilter) Apply(denials []DenialEvent) []DenialEvent {
+	if f.Path != "" {
+		denials = FilterDenialsByPath(denials, f.Path)
+	}
+	if f.RefPrefix != "" {
+		denials = FilterDenialsByRefPrefix(denials, f.RefPrefix)
+	}
+	if f.MinCount > 0 {
+		denials = FilterDenialsByMinCount(denials, f.MinCount)
+	}
+	if f.CmdlineContains != "" {
+		denials = FilterDenialsByCmdline(denials, f.CmdlineContains)
+	}
+	return denials
+}
+
+// Active reports whether any field narrows the denials
+func (f DenialFilter) Active() bool {
+	return f != DenialFilter{}
+}
+
+// FilterDenialsByCmdline keeps denials whose recorded command line contains substr
+func FilterDenialsByCmdline(denials []DenialEvent, substr string) []DenialEvent {
 	return util.Filter(denials, func(d DenialEvent) bool {
-		return d.Path == path
+		return strings.Contains(d.Cmdline, substr)
 	})
 }
 
@@ -204,3 +198,69 @@ func FindMostFrequentDenial(denials []DenialEvent) (DenialEvent, bool) {
 		return true
 	})
 }
+
+// TotalDenials sums how many times each denial occurred using generics
+func TotalDenials(denials []DenialEvent) int {
+	return util.Reduce(denials, 0, func(acc int, d DenialEvent) int {
+		return acc + d.Count
+	})
+}
+
+// DenialStats summarizes a set of denials for `opx audit stats`
+type DenialStats struct {
+	Unique      int // distinct path/ref combinations
+	Total       int // times denied across all combinations
+	Executables int
+	References  int
+}
+
+// SummarizeDenials aggregates counts across denials
+func SummarizeDenials(denials []DenialEvent) DenialStats {
+	refs := util.GroupBy(denials, func(d DenialEvent) string {
+		return d.Reference
+	})
+	return DenialStats{
+		Unique:      len(denials),
+		Total:       TotalDenials(denials),
+		Executables: len(GroupDenialsByPath(denials)),
+		References:  len(refs),
+	}
+}
+
+// ANSI escape codes used for live event rendering
+const (
+	colorRed   = "\033[31m"
+	colorReset = "\033[0m"
+)
+
+// FormatEventCompact renders an audit event on a single line for live tailing.
+// When color is true, DENY decisions are highlighted in red.
+func FormatEventCompact(event AuditEvent, color bool) string {
+	decision := fmt.Sprintf("%-7s", event.Decision)
+	if color && (event.Decision == "DENY" || event.Decision == "FAILURE") {
+		decision = colorRed + decision + colorReset
+	}
+
+	line := fmt.Sprintf("%s %s %s pid=%d", event.Timestamp.Format("15:04:05"), decision, event.Event, event.PeerInfo.PID)
+	if event.PeerInfo.Path != "" {
+		line += " " + event.PeerInfo.Path
+	}
+	if pi := event.PeerInfo; pi.ContainerID != "" || pi.ContainerPath != "" {
+		line += fmt.Sprintf(" container=%.12s %s", pi.ContainerID, pi.ContainerPath)
+	}
+	if event.Reference != "" {
+		line += " -> " + event.Reference + formatAction(event.Action)
+	}
+	if op := event.Details[OperationIDDetail]; op != "" {
+		line += " op=" + op
+	}
+	names := make([]string, 0, len(event.Env))
+	for name := range event.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		line += " " + name + "=" + event.Env[name]
+	}
+	return line + "\n"
+}
@@ -0,0 +1,158 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/security"
+)
+
+func TestFormatEventCompact(t *testing.T) {
+	event := AuditEvent{
+		Timestamp: time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC),
+		Event:     "ACCESS_DECISION",
+		PeerInfo:  security.PeerInfo{PID: 42, Path: "/usr/bin/curl"},
+		Reference: "op://vault/item/field",
+		Decision:  "DENY",
+	}
+
+	plain := FormatEventCompact(event, false)
+	expected := "15:04:05 DENY    ACCESS_DECISION pid=42 /usr/bin/curl -> op://vault/item/field\n"
+	if plain != expected {
+		t.Errorf("Expected %q, got %q", expected, plain)
+	}
+
+	colored := FormatEventCompact(event, true)
+	if !strings.Contains(colored, colorRed+"DENY") {
+		t.Errorf("Expected DENY to be colored, got %q", colored)
+	}
+
+	event.Decision = "ALLOW"
+	if strings.Contains(FormatEventCompact(event, true), colorRed) {
+		t.Error("Expected ALLOW to be rendered without color")
+	}
+
+	event.PeerInfo = security.PeerInfo{PID: 42, ContainerPath: "/usr/local/bin/app", ContainerID: "4f1c6a7be4a95dd0c4bd20f4f4b0c63c"}
+	expected = "15:04:05 ALLOW   ACCESS_DECISION pid=42 container=4f1c6a7be4a9 /usr/local/bin/app -> op://vault/item/field\n"
+	if got := FormatEventCompact(event, false); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestAuditEvent_ContainerPeerJSON(t *testing.T) {
+	event := AuditEvent{Event: "ACCESS_DECISION", PeerInfo: security.PeerInfo{PID: 42, ContainerPath: "/usr/local/bin/app", ContainerID: "4f1c"}}
+	b, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	for _, want := range []string{`"ContainerPath":"/usr/local/bin/app"`, `"ContainerID":"4f1c"`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("Expected %s in %s", want, b)
+		}
+	}
+
+	b, _ = json.Marshal(AuditEvent{PeerInfo: security.PeerInfo{PID: 42, Path: "/usr/bin/curl"}})
+	if strings.Contains(string(b), "Container") {
+		t.Errorf("Expected no container fields for a host peer, got %s", b)
+	}
+}
+
+func TestFormatEventCompact_Action(t *testing.T) {
+	event := AuditEvent{
+		Timestamp: time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC),
+		Event:     "ACCESS_DECISION",
+		PeerInfo:  security.PeerInfo{PID: 42, Path: "/usr/bin/tool"},
+		Reference: "op://dev/MyApp",
+		Action:    "create",
+		Decision:  "DENY",
+	}
+
+	expected := "15:04:05 DENY    ACCESS_DECISION pid=42 /usr/bin/tool -> op://dev/MyApp [create]\n"
+	if got := FormatEventCompact(event, false); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	event.Action = "read"
+	if got := FormatEventCompact(event, false); strings.Contains(got, "[read]") {
+		t.Errorf("Expected reads to stay unlabelled, got %q", got)
+	}
+}
+
+func TestFormatEventCompact_NoReference(t *testing.T) {
+	event := AuditEvent{
+		Timestamp: time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC),
+		Event:     "AUTHENTICATION",
+		PeerInfo:  security.PeerInfo{PID: 7},
+		Decision:  "SUCCESS",
+	}
+
+	got := FormatEventCompact(event, false)
+	if strings.Contains(got, "->") {
+		t.Errorf("Expected no reference arrow, got %q", got)
+	}
+}
+
+func TestSummarizeDenials(t *testing.T) {
+	if stats := SummarizeDenials(nil); stats != (DenialStats{}) {
+		t.Errorf("Expected zero stats for no denials, got %+v", stats)
+	}
+
+	stats := SummarizeDenials([]DenialEvent{
+		{Path: "/usr/bin/a", Reference: "op://v/i/one", Count: 4},
+		{Path: "/usr/bin/a", Reference: "op://v/i/two", Count: 1},
+		{Path: "/usr/bin/b", Reference: "op://v/i/one", Count: 2},
+	})
+	expected := DenialStats{Unique: 3, Total: 7, Executables: 2, References: 2}
+	if stats != expected {
+		t.Errorf("Expected %+v, got %+v", expected, stats)
+	}
+}
+
+func TestDenialFilter_Apply(t *testing.T) {
+	denials := []DenialEvent{
+		{Path: "/usr/bin/node", Reference: "op://Production/db/password", Count: 5, Cmdline: "node deploy.js"},
+		{Path: "/usr/local/bin/node", Reference: "op://Staging/db/password", Count: 1},
+		{Path: "/usr/bin/python3", Reference: "op://Production/api/key", Count: 3},
+		{Path: "/opt/tools/nodemon", Reference: "op://Production/db/password", Count: 2},
+	}
+
+	tests := []struct {
+		name     string
+		filter   DenialFilter
+		expected []string // paths, in order
+	}{
+		{name: "no filters", expected: []string{"/usr/bin/node", "/usr/local/bin/node", "/usr/bin/python3", "/opt/tools/nodemon"}},
+		{name: "path substring", filter: DenialFilter{Path: "node"}, expected: []string{"/usr/bin/node", "/usr/local/bin/node", "/opt/tools/nodemon"}},
+		{name: "path glob on full path", filter: DenialFilter{Path: "/usr/*/node"}, expected: []string{"/usr/bin/node"}},
+		{name: "path glob on base name", filter: DenialFilter{Path: "python*"}, expected: []string{"/usr/bin/python3"}},
+		{name: "ref prefix", filter: DenialFilter{RefPrefix: "op://Production/"}, expected: []string{"/usr/bin/node", "/usr/bin/python3", "/opt/tools/nodemon"}},
+		{name: "min count", filter: DenialFilter{MinCount: 3}, expected: []string{"/usr/bin/node", "/usr/bin/python3"}},
+		{name: "combined", filter: DenialFilter{Path: "node", RefPrefix: "op://Production/", MinCount: 2}, expected: []string{"/usr/bin/node", "/opt/tools/nodemon"}},
+		{name: "combined with cmdline", filter: DenialFilter{Path: "node", CmdlineContains: "deploy"}, expected: []string{"/usr/bin/node"}},
+		{name: "nothing matches", filter: DenialFilter{Path: "ruby", MinCount: 1}, expected: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, d := range tt.filter.Apply(denials) {
+				got = append(got, d.Path)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDenialFilter_Active(t *testing.T) {
+	if (DenialFilter{}).Active() {
+		t.Error("Expected the zero filter to be inactive")
+	}
+	if !(DenialFilter{MinCount: 2}).Active() {
+		t.Error("Expected a filter with a field set to be active")
+	}
+}
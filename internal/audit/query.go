@@ -0,0 +1,39 @@
+package audit
+
+import (
+	"fmt"
+	"time"
+)
+
+// QueryOperation returns the events logged in the last since that carry
+// operationID, oldest first: a resolve's RESOLVE summary and the
+// ACCESS_DECISION event of every read it made
+func QueryOperation(since time.Duration, operationID string) ([]AuditEvent, error) {
+	roller, err := NewRoller(RollerConfig{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create roller: %w", err)
+	}
+	defer roller.Close()
+
+	logFiles, err := roller.ListLogFiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list log files: %w", err)
+	}
+	return queryOperationFiles(logFiles, time.Now().Add(-since), operationID), nil
+}
+
+// queryOperationFiles scans files (newest first, as returned by ListLogFiles)
+func queryOperationFiles(files []string, cutoff time.Time, operationID string) []AuditEvent {
+	var events []AuditEvent
+	for i := len(files) - 1; i >= 0; i-- {
+		if date, ok := logFileDate(files[i]); ok && !date.AddDate(0, 0, 1).After(cutoff) {
+			continue
+		}
+		_ = scanEventFile(files[i], cutoff, func(event AuditEvent) {
+			if event.Details[OperationIDDetail] == operationID {
+				events = append(events, event)
+			}
+		})
+	}
+	return events
+}
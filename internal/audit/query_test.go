@@ -0,0 +1,56 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/security"
+)
+
+func TestQueryOperationFiles(t *testing.T) {
+	dir := t.TempDir()
+	day1 := time.Date(2026, 10, 14, 23, 59, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	peer := security.PeerInfo{PID: 42, Path: "/usr/bin/opx"}
+	op := func(id string) map[string]string { return map[string]string{OperationIDDetail: id} }
+
+	// One operation's events spread over two daily files, between other events
+	first := writeAuditLog(t, dir, day1, []AuditEvent{
+		{Timestamp: day1, Event: "ACCESS_DECISION", PeerInfo: peer, Reference: "op://dev/db/password", Decision: "ALLOW", Details: op("aaaa")},
+		{Timestamp: day1.Add(time.Second), Event: "ACCESS_DECISION", PeerInfo: peer, Reference: "op://dev/other", Decision: "ALLOW", Details: op("bbbb")},
+		{Timestamp: day1.Add(2 * time.Second), Event: "ACCESS_DECISION", PeerInfo: peer, Reference: "op://dev/plain", Decision: "ALLOW"},
+	})
+	second := writeAuditLog(t, dir, day2, []AuditEvent{
+		{Timestamp: day2, Event: "ACCESS_DECISION", PeerInfo: peer, Reference: "op://dev/api/token", Decision: "DENY", Details: op("aaaa")},
+		{Timestamp: day2.Add(time.Second), Event: "RESOLVE", PeerInfo: peer, Decision: "FAILURE", Details: map[string]string{OperationIDDetail: "aaaa", "failed_var": "API_TOKEN"},
+			Env: map[string]string{"DB_PASSWORD": "op://dev/db/password", "API_TOKEN": "op://dev/api/token"}},
+	})
+
+	events := queryOperationFiles([]string{second, first}, day1.Add(-time.Hour), "aaaa")
+	expected := []string{"op://dev/db/password", "op://dev/api/token", ""}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %+v", len(expected), events)
+	}
+	for i, ref := range expected {
+		if events[i].Reference != ref || events[i].Details[OperationIDDetail] != "aaaa" {
+			t.Errorf("Expected event %d for %q in operation aaaa, got %+v", i, ref, events[i])
+		}
+	}
+	summary := events[2]
+	if summary.Event != "RESOLVE" || summary.Env["API_TOKEN"] != "op://dev/api/token" || summary.Details["failed_var"] != "API_TOKEN" {
+		t.Errorf("Expected the RESOLVE summary last, got %+v", summary)
+	}
+
+	line := FormatEventCompact(summary, false)
+	expectedLine := summary.Timestamp.Format("15:04:05") + " FAILURE RESOLVE pid=42 /usr/bin/opx op=aaaa API_TOKEN=op://dev/api/token DB_PASSWORD=op://dev/db/password\n"
+	if line != expectedLine {
+		t.Errorf("Expected %q, got %q", expectedLine, line)
+	}
+
+	if events := queryOperationFiles([]string{second, first}, day2, "aaaa"); len(events) != 2 {
+		t.Errorf("Expected only the events after the cutoff, got %+v", events)
+	}
+	if events := queryOperationFiles([]string{second, first}, day1.Add(-time.Hour), "cccc"); len(events) != 0 {
+		t.Errorf("Expected no events for an unknown operation, got %+v", events)
+	}
+}
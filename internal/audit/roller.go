@@ -1,11 +1,13 @@
 package audit
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
-	"strings"
 	"sync"
 	"time"
 
@@ -18,6 +20,13 @@ type RollerConfig struct {
 	CompressOld   bool          `json:"compress_old"`    // Whether to compress old log files
 	RotateOnStart bool          `json:"rotate_on_start"` // Whether to rotate logs on startup
 	FlushInterval time.Duration `json:"-"`               // How often to flush logs to disk
+	// MACKey, when set, seals each line with an HMAC chained to the previous line (see VerifyFile)
+	MACKey []byte `json:"-"`
+	// MaxFileBytes also rotates the day's log once a write would take it past
+	// this size (0 = rotate only when the date changes)
+	MaxFileBytes int64 `json:"max_file_bytes"`
+	// Clock dates log files; nil uses the system clock
+	Clock util.Clock `json:"-"`
 }
 
 // DefaultRollerConfig returns sensible defaults for log rotation
@@ -36,8 +45,11 @@ type Roller struct {
 	baseDir     string
 	currentFile *os.File
 	currentDate string
+	currentSize int64
+	clock       util.Clock
 	mu          sync.Mutex
 	flushTimer  *time.Timer
+	prevMAC     string // MAC of the last sealed line in currentFile
 }
 
 // NewRoller creates a new audit log roller
@@ -50,6 +62,10 @@ func NewRoller(config RollerConfig) (*Roller, error) {
 	roller := &Roller{
 		config:  config,
 		baseDir: dataDir,
+		clock:   config.Clock,
+	}
+	if roller.clock == nil {
+		roller.clock = util.RealClock{}
 	}
 
 	// Rotate on startup if configured
@@ -76,19 +92,88 @@ func (r *Roller) Write(data []byte) error {
 	if err := r.rotateIfNeeded(); err != nil {
 		return fmt.Errorf("log rotation failed: %w", err)
 	}
+	// Or a full file; a line bigger than MaxFileBytes still goes into a fresh file
+	if limit := r.config.MaxFileBytes; limit > 0 && r.currentSize > 0 && r.currentSize+int64(len(data)) > limit {
+		if err := r.rotateFile(); err != nil {
+			return fmt.Errorf("log rotation failed: %w", err)
+		}
+	}
 
 	// Write to current file
 	if r.currentFile == nil {
 		return fmt.Errorf("no current log file available")
 	}
 
-	_, err := r.currentFile.Write(data)
-	return err
+	if len(r.config.MACKey) == 0 {
+		n, err := r.currentFile.Write(data)
+		r.currentSize += int64(n)
+		return err
+	}
+
+	sealed, mac, err := sealLine(r.config.MACKey, r.prevMAC, bytes.TrimSuffix(data, []byte("\n")))
+	if err != nil {
+		return err
+	}
+	n, err := r.currentFile.Write(append(sealed, '\n'))
+	r.currentSize += int64(n)
+	if err != nil {
+		return err
+	}
+	r.prevMAC = mac
+	return nil
+}
+
+// Rotate moves the day's log aside under the next sequence number and starts
+// a new one, whatever its date or size
+func (r *Roller) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.rotateIfNeeded(); err != nil {
+		return fmt.Errorf("log rotation failed: %w", err)
+	}
+	if err := r.rotateFile(); err != nil {
+		return fmt.Errorf("log rotation failed: %w", err)
+	}
+	return nil
+}
+
+// rotateFile renames the current day's log to audit-DATE.N.log, N one past the
+// day's highest, and opens a new audit-DATE.log. The caller holds r.mu.
+func (r *Roller) rotateFile() error {
+	if r.currentFile != nil {
+		r.currentFile.Close()
+		r.currentFile = nil
+	}
+	seq, err := r.lastSequence(r.currentDate)
+	if err != nil {
+		return err
+	}
+	logPath := filepath.Join(r.baseDir, logFileName(r.currentDate, 0))
+	if err := os.Rename(logPath, filepath.Join(r.baseDir, logFileName(r.currentDate, seq+1))); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to rotate %s: %w", logPath, err)
+	}
+	return r.openLog(r.currentDate)
+}
+
+// lastSequence returns the highest sequence number among date's rotated logs, or 0
+func (r *Roller) lastSequence(date string) (int, error) {
+	files, err := filepath.Glob(filepath.Join(r.baseDir, "audit-"+date+".*.log"))
+	if err != nil {
+		return 0, err
+	}
+	last := 0
+	for _, file := range files {
+		if d, seq, ok := parseLogFileName(file); ok && d == date {
+			last = max(last, seq)
+		}
+	}
+	return last, nil
 }
 
 // rotateIfNeeded rotates the log if we're on a new day
 func (r *Roller) rotateIfNeeded() error {
-	currentDate := time.Now().Format("2006-01-02")
+	currentDate := r.clock.Now().Format("2006-01-02")
 
 	// If we're still on the same day and have a file, nothing to do
 	if currentDate == r.currentDate && r.currentFile != nil {
@@ -101,16 +186,10 @@ func (r *Roller) rotateIfNeeded() error {
 		r.currentFile = nil
 	}
 
-	// Open new log file for current date
-	logPath := filepath.Join(r.baseDir, fmt.Sprintf("audit-%s.log", currentDate))
-	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
-	if err != nil {
-		return fmt.Errorf("failed to open log file %s: %w", logPath, err)
+	if err := r.openLog(currentDate); err != nil {
+		return err
 	}
 
-	r.currentFile = file
-	r.currentDate = currentDate
-
 	// Clean up old log files if retention is configured
 	if r.config.MaxDays > 0 {
 		go r.cleanupOldLogs() // Run in background to avoid blocking
@@ -119,9 +198,37 @@ func (r *Roller) rotateIfNeeded() error {
 	return nil
 }
 
+// openLog opens (or reopens after a restart) the active log for date
+func (r *Roller) openLog(date string) error {
+	logPath := filepath.Join(r.baseDir, logFileName(date, 0))
+	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open log file %s: %w", logPath, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open log file %s: %w", logPath, err)
+	}
+
+	// Continue the chain of a log reopened after a restart
+	r.prevMAC = ""
+	if len(r.config.MACKey) > 0 {
+		if r.prevMAC, err = lastMAC(logPath); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to read MAC chain of %s: %w", logPath, err)
+		}
+	}
+
+	r.currentFile = file
+	r.currentDate = date
+	r.currentSize = info.Size()
+	return nil
+}
+
 // cleanupOldLogs removes log files older than MaxDays
 func (r *Roller) cleanupOldLogs() {
-	cutoffDate := time.Now().AddDate(0, 0, -r.config.MaxDays)
+	cutoffDate := r.clock.Now().AddDate(0, 0, -r.config.MaxDays)
 
 	// Find all audit log files
 	files, err := filepath.Glob(filepath.Join(r.baseDir, "audit-*.log"))
@@ -131,15 +238,8 @@ func (r *Roller) cleanupOldLogs() {
 
 	for _, file := range files {
 		// Extract date from filename (audit-2006-01-02.log)
-		base := filepath.Base(file)
-		if !strings.HasPrefix(base, "audit-") || !strings.HasSuffix(base, ".log") {
-			continue
-		}
-
-		// Extract date part
-		dateStr := strings.TrimSuffix(strings.TrimPrefix(base, "audit-"), ".log")
-		fileDate, err := time.Parse("2006-01-02", dateStr)
-		if err != nil {
+		fileDate, ok := logFileDate(file)
+		if !ok {
 			continue // Skip files with invalid date format
 		}
 
@@ -189,27 +289,52 @@ func (r *Roller) GetCurrentLogPath() string {
 	defer r.mu.Unlock()
 
 	if r.currentDate == "" {
-		r.currentDate = time.Now().Format("2006-01-02")
+		r.currentDate = r.clock.Now().Format("2006-01-02")
 	}
 
-	return filepath.Join(r.baseDir, fmt.Sprintf("audit-%s.log", r.currentDate))
+	return filepath.Join(r.baseDir, logFileName(r.currentDate, 0))
 }
 
-// ListLogFiles returns all available audit log files sorted by date (newest first)
+// ListLogFiles returns all available audit log files newest first: by date,
+// then the day's active log before its rotated ones, highest sequence first
 func (r *Roller) ListLogFiles() ([]string, error) {
 	files, err := filepath.Glob(filepath.Join(r.baseDir, "audit-*.log"))
 	if err != nil {
 		return nil, err
 	}
 
-	// Sort by filename (which contains date) in reverse order (newest first)
-	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+	// The active log is the newest of its day, so it ranks above every sequence
+	rank := func(path string) (string, int) {
+		date, seq, ok := parseLogFileName(path)
+		if !ok {
+			return filepath.Base(path), 0
+		}
+		if seq == 0 {
+			seq = math.MaxInt
+		}
+		return date, seq
+	}
+	sort.Slice(files, func(i, j int) bool {
+		di, si := rank(files[i])
+		dj, sj := rank(files[j])
+		if di != dj {
+			return di > dj
+		}
+		return si > sj
+	})
 
 	return files, nil
 }
 
 // GetLogForDate returns the log file path for a specific date
 func (r *Roller) GetLogForDate(date time.Time) string {
-	dateStr := date.Format("2006-01-02")
-	return filepath.Join(r.baseDir, fmt.Sprintf("audit-%s.log", dateStr))
+	return filepath.Join(r.baseDir, logFileName(date.Format("2006-01-02"), 0))
+}
+
+// logFileName names date's active log (seq 0) or one rotated out of it
+func logFileName(date string, seq int) string {
+	if seq == 0 {
+		return fmt.Sprintf("audit-%s.log", date)
+	}
+	return fmt.Sprintf("audit-%s.%d.log", date, seq)
 }
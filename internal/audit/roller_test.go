@@ -3,11 +3,14 @@ package audit
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/zach-source/opx/internal/security"
+	"github.com/zach-source/opx/internal/util"
 )
 
 func TestDefaultRollerConfig(t *testing.T) {
@@ -195,3 +198,173 @@ func TestNewLoggerWithRoller(t *testing.T) {
 		t.Error("Expected logger to have roller")
 	}
 }
+
+func TestParseLogFileName(t *testing.T) {
+	tests := []struct {
+		path string
+		date string
+		seq  int
+		ok   bool
+	}{
+		{"/tmp/audit-2026-10-16.log", "2026-10-16", 0, true},
+		{"audit-2026-10-16.3.log", "2026-10-16", 3, true},
+		{"audit-2026-10-16.12.log", "2026-10-16", 12, true},
+		{"audit-2026-10-16.0.log", "", 0, false},
+		{"audit-2026-10-16.x.log", "", 0, false},
+		{"audit-2026-13-16.log", "", 0, false},
+		{"audit.log", "", 0, false},
+	}
+	for _, tt := range tests {
+		date, seq, ok := parseLogFileName(tt.path)
+		if date != tt.date || seq != tt.seq || ok != tt.ok {
+			t.Errorf("parseLogFileName(%q) = %q, %d, %v; expected %q, %d, %v", tt.path, date, seq, ok, tt.date, tt.seq, tt.ok)
+		}
+	}
+}
+
+// newTestRoller returns a roller writing to a temp data dir on clock
+func newTestRoller(t *testing.T, clock util.Clock, maxFileBytes int64, key []byte) *Roller {
+	t.Helper()
+	roller, err := NewRoller(RollerConfig{RotateOnStart: true, MaxFileBytes: maxFileBytes, Clock: clock, MACKey: key})
+	if err != nil {
+		t.Fatalf("Failed to create roller: %v", err)
+	}
+	t.Cleanup(func() { roller.Close() })
+	return roller
+}
+
+// logLines maps each log file's base name to its line count
+func logLines(t *testing.T, roller *Roller) ([]string, map[string]int) {
+	t.Helper()
+	files, err := roller.ListLogFiles()
+	if err != nil {
+		t.Fatalf("ListLogFiles failed: %v", err)
+	}
+	names := make([]string, len(files))
+	lines := make(map[string]int, len(files))
+	for i, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names[i] = filepath.Base(file)
+		lines[names[i]] = strings.Count(string(data), "\n")
+	}
+	return names, lines
+}
+
+func TestRoller_DateRotation(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	clock := util.NewManualClock(time.Date(2026, 10, 16, 23, 59, 0, 0, time.Local))
+	roller := newTestRoller(t, clock, 0, nil)
+
+	if err := roller.Write([]byte("before midnight\n")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	clock.Advance(2 * time.Minute)
+	if err := roller.Write([]byte("after midnight\n")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	names, lines := logLines(t, roller)
+	expected := []string{"audit-2026-10-17.log", "audit-2026-10-16.log"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Expected %v, got %v", expected, names)
+	}
+	for _, name := range expected {
+		if lines[name] != 1 {
+			t.Errorf("Expected one line in %s, got %d", name, lines[name])
+		}
+	}
+	if path := roller.GetCurrentLogPath(); filepath.Base(path) != expected[0] {
+		t.Errorf("Expected the current log to be %s, got %s", expected[0], path)
+	}
+}
+
+func TestRoller_SizeRotation(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	clock := util.NewManualClock(time.Date(2026, 10, 16, 9, 0, 0, 0, time.Local))
+	key := []byte("0123456789abcdef0123456789abcdef")
+	roller := newTestRoller(t, clock, 400, key)
+
+	line := []byte(`{"event":"ACCESS_DECISION","decision":"ALLOW"}` + "\n")
+	for i := 0; i < 10; i++ {
+		if err := roller.Write(line); err != nil {
+			t.Fatalf("Write %d failed: %v", i, err)
+		}
+	}
+	// A line bigger than the limit gets a file of its own
+	if err := roller.Write([]byte(`{"event":"` + strings.Repeat("x", 500) + `"}` + "\n")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := roller.Rotate(); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if err := roller.Write(line); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	names, lines := logLines(t, roller)
+	// Three sealed lines fit in 400 bytes before the next would pass it
+	expected := []string{"audit-2026-10-16.log", "audit-2026-10-16.5.log", "audit-2026-10-16.4.log", "audit-2026-10-16.3.log", "audit-2026-10-16.2.log", "audit-2026-10-16.1.log"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Expected %v, got %v", expected, names)
+	}
+	expectedLines := map[string]int{expected[0]: 1, expected[1]: 1, expected[2]: 1, expected[3]: 3, expected[4]: 3, expected[5]: 3}
+	if !reflect.DeepEqual(lines, expectedLines) {
+		t.Errorf("Expected line counts %v, got %v", expectedLines, lines)
+	}
+
+	// Each file's chain stands on its own
+	for _, name := range expected {
+		result, err := VerifyFile(filepath.Join(roller.baseDir, name), key)
+		if err != nil || !result.OK() {
+			t.Errorf("Expected %s to verify, got %+v (%v)", name, result, err)
+		}
+	}
+
+	// A restarted daemon counts the size already written and continues the sequence
+	roller.Close()
+	restarted := newTestRoller(t, clock, 400, key)
+	for i := 0; i < 3; i++ {
+		if err := restarted.Write(line); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if names, _ := logLines(t, restarted); names[1] != "audit-2026-10-16.6.log" {
+		t.Errorf("Expected the sequence to continue at 6, got %v", names)
+	}
+}
+
+func TestRoller_ConcurrentSizeRotation(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	roller := newTestRoller(t, util.NewManualClock(time.Date(2026, 10, 16, 9, 0, 0, 0, time.Local)), 256, nil)
+
+	line := []byte(strings.Repeat("x", 31) + "\n")
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				if err := roller.Write(line); err != nil {
+					t.Errorf("Write failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	_, lines := logLines(t, roller)
+	total := 0
+	for name, n := range lines {
+		total += n
+		if n > 8 {
+			t.Errorf("Expected at most 8 lines of 32 bytes in %s, got %d", name, n)
+		}
+	}
+	if total != 200 {
+		t.Errorf("Expected all 200 lines across %d files, got %d", len(lines), total)
+	}
+}
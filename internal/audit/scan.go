@@ -0,0 +1,257 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxAuditLineBytes bounds memory per line; longer lines are skipped, not fatal
+	maxAuditLineBytes = 1 << 20
+	// cutoffProbeBytes is how much is read at each binary-search probe
+	cutoffProbeBytes = 64 << 10
+	// linearScanBytes is the span below which the cutoff search falls back to streaming
+	linearScanBytes = 256 << 10
+)
+
+// logFileDate extracts the local date from an audit-2006-01-02.log or
+// audit-2006-01-02.N.log filename
+func logFileDate(path string) (time.Time, bool) {
+	dateStr, _, ok := parseLogFileName(path)
+	if !ok {
+		return time.Time{}, false
+	}
+	date, err := time.ParseInLocation("2006-01-02", dateStr, time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// parseLogFileName splits an audit log filename into its date and rotation
+// sequence number, 0 for the day's active log
+func parseLogFileName(path string) (date string, seq int, ok bool) {
+	base := filepath.Base(path)
+	if !strings.HasPrefix(base, "audit-") || !strings.HasSuffix(base, ".log") {
+		return "", 0, false
+	}
+	date = strings.TrimSuffix(strings.TrimPrefix(base, "audit-"), ".log")
+	if d, n, found := strings.Cut(date, "."); found {
+		var err error
+		if seq, err = strconv.Atoi(n); err != nil || seq < 1 {
+			return "", 0, false
+		}
+		date = d
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return "", 0, false
+	}
+	return date, seq, true
+}
+
+// scanDenials aggregates DENY decisions at or after cutoff from files (newest first,
+// as returned by ListLogFiles). Files dated entirely before the cutoff are never opened.
+func scanDenials(files []string, cutoff time.Time) ([]DenialEvent, error) {
+	denials := make(map[string]*DenialEvent)
+
+	for _, logFile := range files {
+		if date, ok := logFileDate(logFile); ok && !date.AddDate(0, 0, 1).After(cutoff) {
+			continue // The whole day predates the cutoff
+		}
+		if err := scanDenialFile(logFile, cutoff, denials); err != nil {
+			continue // Skip files we can't read
+		}
+	}
+
+	// Convert to slice and sort by count (most frequent first)
+	result := make([]DenialEvent, 0, len(denials))
+	for _, denial := range denials {
+		result = append(result, *denial)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Count > result[j].Count
+	})
+	return result, nil
+}
+
+// scanDenialFile streams one log file's DENY decisions at or after cutoff into denials
+func scanDenialFile(path string, cutoff time.Time, denials map[string]*DenialEvent) error {
+	return scanEventFile(path, cutoff, func(event AuditEvent) {
+		// Only interested in recent access denials
+		if event.Event != "ACCESS_DECISION" || event.Decision != "DENY" {
+			return
+		}
+
+		// Create unique key for this process+reference combination
+		key := fmt.Sprintf("%s|%s", event.PeerInfo.Path, event.Reference)
+
+		if existing, exists := denials[key]; exists {
+			existing.Count++
+			// Keep the most recent timestamp
+			if event.Timestamp.After(existing.Timestamp) {
+				existing.Timestamp = event.Timestamp
+				if event.PeerCmdline != "" {
+					existing.Cmdline = event.PeerCmdline
+				}
+			}
+		} else {
+			denials[key] = &DenialEvent{
+				Timestamp: event.Timestamp,
+				PID:       event.PeerInfo.PID,
+				Path:      event.PeerInfo.Path,
+				Reference: event.Reference,
+				Count:     1,
+				Cmdline:   event.PeerCmdline,
+			}
+		}
+	})
+}
+
+// scanEventFile streams the events of one log file stamped at or after cutoff
+// to fn, starting near the first of them since events are appended chronologically
+func scanEventFile(path string, cutoff time.Time, fn func(AuditEvent)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	start := findCutoffOffset(file, info.Size(), cutoff)
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReaderSize(file, 64<<10)
+	if start > 0 {
+		// We landed mid-line; that line predates the cutoff
+		if err := discardLine(reader); err != nil {
+			return nil
+		}
+	}
+
+	return readBoundedLines(reader, maxAuditLineBytes, func(line []byte) {
+		if ts, ok := lineTimestamp(line); ok && ts.Before(cutoff) {
+			return // Cheap skip without decoding the whole event
+		}
+
+		var event AuditEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			return // Skip malformed lines
+		}
+		if event.Timestamp.Before(cutoff) {
+			return
+		}
+		fn(event)
+	})
+}
+
+// findCutoffOffset binary-searches a chronological log for an offset at or before
+// the first line stamped at or after cutoff. Unreadable probes err toward scanning more.
+func findCutoffOffset(r io.ReaderAt, size int64, cutoff time.Time) int64 {
+	lo, hi := int64(0), size
+	for hi-lo > linearScanBytes {
+		mid := lo + (hi-lo)/2
+		ts, ok := timestampAfter(r, mid)
+		if !ok || !ts.Before(cutoff) {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return lo
+}
+
+// timestampAfter returns the timestamp of the first complete line starting after offset
+func timestampAfter(r io.ReaderAt, offset int64) (time.Time, bool) {
+	buf := make([]byte, cutoffProbeBytes)
+	n, err := r.ReadAt(buf, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return time.Time{}, false
+	}
+	buf = buf[:n]
+
+	nl := bytes.IndexByte(buf, '\n')
+	if nl < 0 {
+		return time.Time{}, false
+	}
+	return lineTimestamp(buf[nl+1:])
+}
+
+// lineTimestamp reads the leading "timestamp" field of an encoded AuditEvent
+// without decoding the rest of the line
+func lineTimestamp(line []byte) (time.Time, bool) {
+	const prefix = `{"timestamp":"`
+	if !bytes.HasPrefix(line, []byte(prefix)) {
+		return time.Time{}, false
+	}
+	rest := line[len(prefix):]
+	end := bytes.IndexByte(rest, '"')
+	if end < 0 {
+		return time.Time{}, false
+	}
+	ts, err := time.Parse(time.RFC3339Nano, string(rest[:end]))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return ts, true
+}
+
+// readBoundedLines calls fn for each non-empty line. Lines longer than max bytes
+// are dropped instead of aborting the scan (bufio.Scanner stops at its limit).
+func readBoundedLines(r *bufio.Reader, max int, fn func([]byte)) error {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(chunk) > 0 && !tooLong {
+			if len(line)+len(chunk) > max+1 {
+				tooLong = true
+				line = line[:0]
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue // Rest of the line is still coming
+		case err != nil && !errors.Is(err, io.EOF):
+			return err
+		}
+
+		if !tooLong {
+			if trimmed := bytes.TrimRight(line, "\r\n"); len(trimmed) > 0 {
+				fn(trimmed)
+			}
+		}
+		line = line[:0]
+		tooLong = false
+
+		if err != nil {
+			return nil // EOF
+		}
+	}
+}
+
+func discardLine(r *bufio.Reader) error {
+	for {
+		_, err := r.ReadSlice('\n')
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return err
+		}
+	}
+}
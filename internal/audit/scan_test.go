@@ -0,0 +1,242 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/security"
+)
+
+func denyEvent(ts time.Time, path, ref string) AuditEvent {
+	return AuditEvent{
+		Timestamp: ts,
+		Event:     "ACCESS_DECISION",
+		PeerInfo:  security.PeerInfo{PID: 42, Path: path},
+		Reference: ref,
+		Decision:  "DENY",
+	}
+}
+
+// writeAuditLog writes events (and raw lines) to audit-<date>.log in dir
+func writeAuditLog(tb testing.TB, dir string, date time.Time, events []AuditEvent, raw ...string) string {
+	tb.Helper()
+	path := filepath.Join(dir, fmt.Sprintf("audit-%s.log", date.Format("2006-01-02")))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer f.Close()
+	for _, event := range events {
+		data, _ := json.Marshal(event)
+		f.Write(append(data, '\n'))
+	}
+	for _, line := range raw {
+		f.WriteString(line + "\n")
+	}
+	return path
+}
+
+func TestLogFileDate(t *testing.T) {
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{"/tmp/audit-2025-01-02.log", true},
+		{"audit-2025-13-02.log", false},
+		{"/tmp/other-2025-01-02.log", false},
+		{"/tmp/audit-2025-01-02.log.gz", false},
+	}
+	for _, tt := range tests {
+		date, ok := logFileDate(tt.path)
+		if ok != tt.ok {
+			t.Errorf("%s: expected ok=%v, got %v", tt.path, tt.ok, ok)
+		}
+		if ok && date.Format("2006-01-02") != "2025-01-02" {
+			t.Errorf("%s: unexpected date %v", tt.path, date)
+		}
+	}
+}
+
+func TestScanDenials_SkipsFilesBeforeCutoff(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	today := writeAuditLog(t, dir, now, []AuditEvent{denyEvent(now, "/usr/bin/a", "op://v/i/today")})
+	// An old file is never opened, even if it (incorrectly) holds a recent event
+	old := writeAuditLog(t, dir, now.AddDate(0, 0, -10), []AuditEvent{denyEvent(now, "/usr/bin/a", "op://v/i/old-file")})
+	// Yesterday's file straddles a 36h window
+	yesterday := writeAuditLog(t, dir, now.AddDate(0, 0, -1), []AuditEvent{
+		denyEvent(now.Add(-48*time.Hour), "/usr/bin/a", "op://v/i/too-old"),
+		denyEvent(now.Add(-30*time.Hour), "/usr/bin/a", "op://v/i/yesterday"),
+	})
+
+	denials, err := scanDenials([]string{today, yesterday, old}, now.Add(-36*time.Hour))
+	if err != nil {
+		t.Fatalf("scanDenials failed: %v", err)
+	}
+
+	refs := map[string]bool{}
+	for _, d := range denials {
+		refs[d.Reference] = true
+	}
+	if !refs["op://v/i/today"] || !refs["op://v/i/yesterday"] {
+		t.Errorf("Expected denials from today and yesterday, got %v", refs)
+	}
+	if refs["op://v/i/old-file"] {
+		t.Error("Expected file dated before the cutoff to be skipped")
+	}
+	if refs["op://v/i/too-old"] {
+		t.Error("Expected events before the cutoff to be ignored")
+	}
+}
+
+func TestScanDenials_LongLines(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	// 200KB of details is past bufio.Scanner's 64KB default
+	big := denyEvent(now, "/usr/bin/big", "op://v/i/big")
+	big.Details = map[string]string{"blob": strings.Repeat("x", 200<<10)}
+	// Past the per-line limit: skipped, but must not stop the scan
+	huge := `{"timestamp":"` + now.Format(time.RFC3339Nano) + `","event":"ACCESS_DECISION","details":{"blob":"` + strings.Repeat("y", maxAuditLineBytes) + `"}}`
+
+	path := writeAuditLog(t, dir, now, []AuditEvent{big}, huge, "not json")
+	writeAuditLog(t, dir, now, []AuditEvent{denyEvent(now, "/usr/bin/after", "op://v/i/after")})
+
+	denials, err := scanDenials([]string{path}, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("scanDenials failed: %v", err)
+	}
+	refs := map[string]bool{}
+	for _, d := range denials {
+		refs[d.Reference] = true
+	}
+	if !refs["op://v/i/big"] {
+		t.Error("Expected the 200KB line to be parsed")
+	}
+	if !refs["op://v/i/after"] {
+		t.Error("Expected lines after an oversized line to still be scanned")
+	}
+	if len(denials) != 2 {
+		t.Errorf("Expected 2 denials, got %d", len(denials))
+	}
+}
+
+func TestScanDenials_CutoffWithinLargeFile(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-20 * time.Hour)
+
+	// Several MB of chronological events, one per second
+	var events []AuditEvent
+	for i := 0; i < 20000; i++ {
+		events = append(events, denyEvent(start.Add(time.Duration(i)*time.Second), "/usr/bin/tool", fmt.Sprintf("op://v/item%03d/f", i%100)))
+	}
+	path := writeAuditLog(t, dir, time.Now(), events)
+
+	cutoff := start.Add(15000 * time.Second)
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, _ := f.Stat()
+	offset := findCutoffOffset(f, info.Size(), cutoff)
+	f.Close()
+	if offset == 0 {
+		t.Error("Expected the cutoff search to skip the start of the file")
+	}
+
+	denials, err := scanDenials([]string{path}, cutoff)
+	if err != nil {
+		t.Fatalf("scanDenials failed: %v", err)
+	}
+	total := 0
+	for _, d := range denials {
+		total += d.Count
+	}
+	if total != 5000 {
+		t.Errorf("Expected exactly the 5000 events at or after the cutoff, got %d", total)
+	}
+}
+
+// writeFixtureDays generates days of logs with perDay denials each
+func writeFixtureDays(b *testing.B, days, perDay int) []string {
+	b.Helper()
+	dir := b.TempDir()
+	now := time.Now()
+	var files []string
+	for d := 0; d < days; d++ {
+		day := now.AddDate(0, 0, -d)
+		dayStart := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+		events := make([]AuditEvent, perDay)
+		for i := range events {
+			events[i] = denyEvent(dayStart.Add(time.Duration(i)*(24*time.Hour/time.Duration(perDay))), "/usr/bin/tool", fmt.Sprintf("op://v/item%03d/f", i%50))
+		}
+		files = append(files, writeAuditLog(b, dir, day, events))
+	}
+	return files // newest first
+}
+
+func BenchmarkScanDenials_Last24hOf30Days(b *testing.B) {
+	files := writeFixtureDays(b, 30, 5000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := scanDenials(files, time.Now().Add(-24*time.Hour)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkScanDenials_Last1hOf30Days(b *testing.B) {
+	files := writeFixtureDays(b, 30, 5000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := scanDenials(files, time.Now().Add(-time.Hour)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkScanDenials_All30Days(b *testing.B) {
+	files := writeFixtureDays(b, 30, 5000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := scanDenials(files, time.Now().AddDate(0, 0, -31)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestScanDenials_KeepsLatestCmdline(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	older := denyEvent(now.Add(-2*time.Minute), "/usr/bin/a", "op://v/i/x")
+	older.PeerCmdline = "a --first"
+	newer := denyEvent(now.Add(-time.Minute), "/usr/bin/a", "op://v/i/x")
+	newer.PeerCmdline = "a --second"
+	path := writeAuditLog(t, dir, now, []AuditEvent{newer, older})
+
+	denials, err := scanDenials([]string{path}, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("scanDenials failed: %v", err)
+	}
+	if len(denials) != 1 {
+		t.Fatalf("Expected 1 aggregated denial, got %d", len(denials))
+	}
+	if denials[0].Cmdline != "a --second" {
+		t.Errorf("Expected latest cmdline %q, got %q", "a --second", denials[0].Cmdline)
+	}
+
+	if got := FilterDenialsByCmdline(denials, "--second"); len(got) != 1 {
+		t.Errorf("Expected --cmdline-contains match, got %d denials", len(got))
+	}
+	if got := FilterDenialsByCmdline(denials, "--first"); len(got) != 0 {
+		t.Errorf("Expected no match on a superseded cmdline, got %d denials", len(got))
+	}
+}
@@ -0,0 +1,141 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrApprovalRequired matches op failures caused by a 1Password desktop app
+// approval prompt that nobody answered, dismissed or that timed out
+var ErrApprovalRequired = errors.New("approval required in the 1Password app")
+
+// approvalError marks err as ErrApprovalRequired and says what to do about it
+type approvalError struct {
+	err    error
+	waited time.Duration // how long op waited on the prompt before we gave up, or 0
+}
+
+func (e approvalError) Error() string {
+	msg := "op needs approval in the 1Password app: unlock the app and approve its prompt, then retry"
+	if e.waited > 0 {
+		msg += fmt.Sprintf(" (gave up after %s)", e.waited)
+	}
+	return msg + ": " + e.err.Error()
+}
+
+func (e approvalError) Unwrap() error        { return e.err }
+func (e approvalError) Is(target error) bool { return target == ErrApprovalRequired }
+
+// approvalMarkers are what op prints to stderr, lowercased, while a desktop
+// app authorization prompt is open or after one was dismissed or timed out
+var approvalMarkers = []string{
+	"authorization prompt",
+	"authorization timeout",
+	"waiting for authorization",
+	"approve in the 1password app",
+}
+
+// awaitingApproval reports whether op's stderr shows a desktop app approval prompt
+func awaitingApproval(stderr string) bool {
+	lower := strings.ToLower(stderr)
+	for _, m := range approvalMarkers {
+		if strings.Contains(lower, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// approvalWatcher collects op's stderr and closes prompted the first time it shows an approval prompt
+type approvalWatcher struct {
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	prompted chan struct{}
+	once     sync.Once
+}
+
+func newApprovalWatcher() *approvalWatcher {
+	return &approvalWatcher{prompted: make(chan struct{})}
+}
+
+func (w *approvalWatcher) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Write(p)
+	if awaitingApproval(w.buf.String()) {
+		w.once.Do(func() { close(w.prompted) })
+	}
+	return len(p), nil
+}
+
+func (w *approvalWatcher) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+// approvalRequired marks err as ErrApprovalRequired when op's stderr shows an
+// approval prompt; waited is how long run let the prompt stay open, or 0
+func approvalRequired(err error, stderr string, waited time.Duration) error {
+	if !awaitingApproval(stderr) {
+		return err
+	}
+	return approvalError{err: err, waited: waited}
+}
+
+// opWaitDelay bounds how long op's output is drained after it was killed
+const opWaitDelay = time.Second
+
+// run executes op with args and optional stdin, returning stdout and trimmed
+// stderr. Once stderr shows an approval prompt, op is killed after
+// ApprovalTimeout (when set) instead of blocking until ctx expires, and waited
+// reports that timeout.
+func (o OpCLI) run(ctx context.Context, args []string, stdin []byte) (stdout []byte, stderr string, waited time.Duration, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd := opCommand(ctx, args...)
+	cmd.WaitDelay = opWaitDelay
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var out bytes.Buffer
+	errw := newApprovalWatcher()
+	cmd.Stdout = &out
+	cmd.Stderr = errw
+	if err := cmd.Start(); err != nil {
+		return nil, "", 0, err
+	}
+
+	done := make(chan struct{})
+	gaveUp := make(chan time.Duration, 1)
+	if o.ApprovalTimeout > 0 {
+		go func() {
+			select {
+			case <-errw.prompted:
+			case <-done:
+				return
+			}
+			timer := time.NewTimer(o.ApprovalTimeout)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+				gaveUp <- o.ApprovalTimeout
+				cancel()
+			case <-done:
+			}
+		}()
+	}
+	err = cmd.Wait()
+	close(done)
+	select {
+	case waited = <-gaveUp:
+	default:
+	}
+	return out.Bytes(), strings.TrimSpace(errw.String()), waited, err
+}
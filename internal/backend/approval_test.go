@@ -0,0 +1,132 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeOp puts an executable op script with body first on PATH
+func fakeOp(t *testing.T, body string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "op"), []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestAwaitingApproval(t *testing.T) {
+	tests := []struct {
+		stderr   string
+		expected bool
+	}{
+		{stderr: "[ERROR] 2026/10/16 09:00:00 authorization prompt dismissed, please try again", expected: true},
+		{stderr: "[ERROR] 2026/10/16 09:00:00 error initializing client: Authorization timeout", expected: true},
+		{stderr: "Waiting for authorization in the 1Password app...", expected: true},
+		{stderr: `[ERROR] 2026/10/16 09:00:00 "nope" isn't a vault in this account`, expected: false},
+		{stderr: "", expected: false},
+	}
+	for _, tt := range tests {
+		if got := awaitingApproval(tt.stderr); got != tt.expected {
+			t.Errorf("Expected %t for %q, got %t", tt.expected, tt.stderr, got)
+		}
+	}
+}
+
+func TestOpCLI_ApprovalRequired(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		timeout  time.Duration
+		ctxLimit time.Duration
+		approval bool
+		message  string
+	}{
+		{
+			name:     "blocked on prompt gives up after the approval timeout",
+			script:   "echo 'Waiting for authorization in the 1Password app...' >&2\nexec sleep 30",
+			timeout:  100 * time.Millisecond,
+			ctxLimit: 10 * time.Second,
+			approval: true,
+			message:  "gave up after 100ms",
+		},
+		{
+			name:     "dismissed prompt",
+			script:   "echo '[ERROR] 2026/10/16 09:00:00 authorization prompt dismissed, please try again' >&2\nexit 1",
+			ctxLimit: 10 * time.Second,
+			approval: true,
+			message:  "approve its prompt",
+		},
+		{
+			name:     "prompt without an approval timeout waits for ctx",
+			script:   "echo 'Waiting for authorization in the 1Password app...' >&2\nexec sleep 30",
+			ctxLimit: 200 * time.Millisecond,
+			approval: true,
+		},
+		{
+			name:     "slow op without a prompt is not an approval failure",
+			script:   "exec sleep 30",
+			timeout:  50 * time.Millisecond,
+			ctxLimit: 300 * time.Millisecond,
+		},
+		{
+			name:     "other failures keep their error",
+			script:   "echo '[ERROR] 2026/10/16 09:00:00 You are not currently signed in.' >&2\nexit 1",
+			timeout:  50 * time.Millisecond,
+			ctxLimit: 10 * time.Second,
+			message:  "not currently signed in",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeOp(t, tt.script)
+			ctx, cancel := context.WithTimeout(context.Background(), tt.ctxLimit)
+			defer cancel()
+
+			start := time.Now()
+			_, err := OpCLI{ApprovalTimeout: tt.timeout}.ReadRef(ctx, "op://vault/item/field")
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			if errors.Is(err, ErrApprovalRequired) != tt.approval {
+				t.Errorf("Expected ErrApprovalRequired %t, got %v", tt.approval, err)
+			}
+			if !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("Expected error containing %q, got %v", tt.message, err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("Expected op to be stopped promptly, took %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestOpCLI_ApprovalRequiredItemCalls(t *testing.T) {
+	fakeOp(t, "echo 'Waiting for authorization in the 1Password app...' >&2\nexec sleep 30")
+	op := OpCLI{ApprovalTimeout: 50 * time.Millisecond}
+	ctx := context.Background()
+
+	if _, err := op.ReadItemFields(ctx, "vault", "item", []string{"password"}, nil); !errors.Is(err, ErrApprovalRequired) {
+		t.Errorf("Expected ReadItemFields to return ErrApprovalRequired, got %v", err)
+	}
+	item := NewItem{Vault: "vault", Title: "app", Fields: []ItemField{{Name: "password", Value: "x"}}}
+	if _, err := op.CreateItem(ctx, item, nil); !errors.Is(err, ErrApprovalRequired) {
+		t.Errorf("Expected CreateItem to return ErrApprovalRequired, got %v", err)
+	}
+}
+
+func TestOpCLI_ReadRefThroughFakeOp(t *testing.T) {
+	fakeOp(t, `[ "$1" = read ] && [ "$3" = op://vault/item/field ] && printf 's3cret\n'`)
+	value, err := OpCLI{ApprovalTimeout: time.Second}.ReadRef(context.Background(), "op://vault/item/field")
+	if err != nil {
+		t.Fatalf("ReadRef failed: %v", err)
+	}
+	if value != "s3cret" {
+		t.Errorf("Expected %q, got %q", "s3cret", value)
+	}
+}
@@ -1,9 +1,107 @@
 package backend
 
-import "context"
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
 
 type Backend interface {
 	ReadRef(ctx context.Context, ref string) (string, error)
 	ReadRefWithFlags(ctx context.Context, ref string, flags []string) (string, error)
 	Name() string
 }
+
+// SecretResult is a value with the metadata its backend knows about it; zero
+// fields are unknown
+type SecretResult struct {
+	Value string
+	// TTL is how long the value stays valid, e.g. a Vault lease
+	TTL       time.Duration
+	Version   string
+	UpdatedAt time.Time
+}
+
+// MetadataReader is implemented by backends that can return metadata with a value
+type MetadataReader interface {
+	ReadRefWithContext(ctx context.Context, ref string, flags []string) (SecretResult, error)
+}
+
+// ReadResult reads ref with its metadata when b is a MetadataReader, and just its value otherwise
+func ReadResult(ctx context.Context, b Backend, ref string, flags []string) (SecretResult, error) {
+	if reader, ok := b.(MetadataReader); ok {
+		return reader.ReadRefWithContext(ctx, ref, flags)
+	}
+	v, err := b.ReadRefWithFlags(ctx, ref, flags)
+	if err != nil {
+		return SecretResult{}, err
+	}
+	return SecretResult{Value: v}, nil
+}
+
+// Pinger is implemented by backends that can check their server is reachable
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// ErrCreateUnsupported is returned when the configured backend cannot create items
+var ErrCreateUnsupported = errors.New("backend does not support creating items")
+
+// ErrNotFound matches errors for refs whose secret, item or field does not exist
+var ErrNotFound = errors.New("secret not found")
+
+// notFoundError marks err as ErrNotFound without changing its message
+type notFoundError struct{ err error }
+
+func (e notFoundError) Error() string        { return e.err.Error() }
+func (e notFoundError) Unwrap() error        { return e.err }
+func (e notFoundError) Is(target error) bool { return target == ErrNotFound }
+
+// NotFound marks err so errors.Is(err, ErrNotFound) reports true
+func NotFound(err error) error {
+	return notFoundError{err: err}
+}
+
+// ItemField is one field of a new item; Generate asks the backend to generate the value
+type ItemField struct {
+	Name     string
+	Value    string
+	Generate bool
+}
+
+// NewItem describes an item to create in a vault
+type NewItem struct {
+	Vault    string
+	Title    string
+	Category string
+	Fields   []ItemField
+}
+
+// ItemCreator is implemented by backends that can create items. CreateItem
+// returns the ref of the new item.
+type ItemCreator interface {
+	CreateItem(ctx context.Context, item NewItem, flags []string) (string, error)
+}
+
+// ErrItemFieldsUnsupported is returned when the configured backend cannot read several fields at once
+var ErrItemFieldsUnsupported = errors.New("backend does not support reading item fields")
+
+// ItemFieldsReader is implemented by backends that can read several fields of one
+// item in a single call. Fields the item doesn't have are left out of the result.
+type ItemFieldsReader interface {
+	ReadItemFields(ctx context.Context, vault, item string, fields []string, flags []string) (map[string]string, error)
+}
+
+// SplitItemRef splits an op://vault/item/field ref; refs with a section or query are not split
+func SplitItemRef(ref string) (vault, item, field string, ok bool) {
+	rest, found := strings.CutPrefix(ref, "op://")
+	if !found || strings.Contains(rest, "?") {
+		return "", "", "", false
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", "", false
+	}
+	return parts[0], parts[1], parts[2], true
+}
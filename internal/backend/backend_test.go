@@ -527,3 +527,172 @@ func TestOpCLI_ValidationSecurity(t *testing.T) {
 		})
 	}
 }
+
+func TestOpCLI_CreateItemArgs(t *testing.T) {
+	tests := []struct {
+		name         string
+		item         NewItem
+		flags        []string
+		expectedArgs []string
+		expectedTmpl string
+		wantErrText  string
+	}{
+		{
+			name:         "literal value goes over stdin",
+			item:         NewItem{Vault: "dev", Title: "MyApp", Fields: []ItemField{{Name: "api_key", Value: "s3cret"}}},
+			flags:        []string{"--account=work"},
+			expectedArgs: []string{"--account=work", "item", "create", "--vault", "dev", "--title", "MyApp", "--category", "Login", "--format", "json"},
+			expectedTmpl: `{"fields":[{"label":"api_key","type":"CONCEALED","value":"s3cret"}]}`,
+		},
+		{
+			name:         "generated password",
+			item:         NewItem{Vault: "dev", Title: "MyApp", Category: "Password", Fields: []ItemField{{Name: "password", Generate: true}}},
+			expectedArgs: []string{"item", "create", "--vault", "dev", "--title", "MyApp", "--category", "Password", "--format", "json", "--generate-password"},
+			expectedTmpl: `{"fields":null}`,
+		},
+		{name: "missing vault", item: NewItem{Title: "MyApp", Fields: []ItemField{{Name: "a", Value: "b"}}}, wantErrText: "empty vault"},
+		{name: "title flag injection", item: NewItem{Vault: "dev", Title: "--help", Fields: []ItemField{{Name: "a", Value: "b"}}}, wantErrText: "cannot start with dash"},
+		{name: "title with slash", item: NewItem{Vault: "dev", Title: "a/b", Fields: []ItemField{{Name: "a", Value: "b"}}}, wantErrText: "contain /"},
+		{name: "no fields", item: NewItem{Vault: "dev", Title: "MyApp"}, wantErrText: "no fields"},
+		{name: "generate other field", item: NewItem{Vault: "dev", Title: "MyApp", Fields: []ItemField{{Name: "token", Generate: true}}}, wantErrText: "only password"},
+		{name: "unsafe flag", item: NewItem{Vault: "dev", Title: "MyApp", Fields: []ItemField{{Name: "a", Value: "b"}}}, flags: []string{"--account=x;id"}, wantErrText: "unsafe characters"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, tmpl, err := createItemArgs(tt.item, tt.flags)
+			if tt.wantErrText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrText) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantErrText, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if strings.Join(args, " ") != strings.Join(tt.expectedArgs, " ") {
+				t.Errorf("Expected args %v, got %v", tt.expectedArgs, args)
+			}
+			if string(tmpl) != tt.expectedTmpl {
+				t.Errorf("Expected template %s, got %s", tt.expectedTmpl, tmpl)
+			}
+			for _, arg := range args {
+				if strings.Contains(arg, "s3cret") {
+					t.Error("Expected secret value to stay out of argv")
+				}
+			}
+		})
+	}
+}
+
+func TestSplitItemRef(t *testing.T) {
+	tests := []struct {
+		ref      string
+		expected []string
+		ok       bool
+	}{
+		{ref: "op://dev/db/password", expected: []string{"dev", "db", "password"}, ok: true},
+		{ref: "op://dev/db/section/password", ok: false},
+		{ref: "op://dev/db/password?attribute=otp", ok: false},
+		{ref: "op://dev/db", ok: false},
+		{ref: "op://dev//password", ok: false},
+		{ref: "vault://secret/db/password", ok: false},
+	}
+
+	for _, tt := range tests {
+		vault, item, field, ok := SplitItemRef(tt.ref)
+		if ok != tt.ok {
+			t.Errorf("%s: expected ok=%t, got %t", tt.ref, tt.ok, ok)
+			continue
+		}
+		if ok && (vault != tt.expected[0] || item != tt.expected[1] || field != tt.expected[2]) {
+			t.Errorf("%s: expected %v, got [%s %s %s]", tt.ref, tt.expected, vault, item, field)
+		}
+	}
+}
+
+func TestOpCLI_ItemFieldsArgs(t *testing.T) {
+	args, err := itemFieldsArgs("dev", "db", []string{"username", "password"}, []string{"--account=work"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "--account=work item get db --vault dev --fields label=username,label=password --reveal --format json"
+	if strings.Join(args, " ") != expected {
+		t.Errorf("Expected args %q, got %q", expected, strings.Join(args, " "))
+	}
+
+	for _, bad := range [][]string{{"a,b"}, {""}} {
+		if _, err := itemFieldsArgs("dev", "db", bad, nil); err == nil {
+			t.Errorf("Expected error for fields %q", bad)
+		}
+	}
+	if _, err := itemFieldsArgs("dev", "--help", []string{"a"}, nil); err == nil {
+		t.Error("Expected error for item starting with a dash")
+	}
+}
+
+func TestOpCLI_ParseItemFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		out      string
+		fields   []string
+		expected map[string]string
+	}{
+		{
+			name:     "several fields",
+			out:      `[{"id":"username","label":"username","value":"admin"},{"id":"p1","label":"password","value":"s3cret"}]`,
+			fields:   []string{"username", "password"},
+			expected: map[string]string{"username": "admin", "password": "s3cret"},
+		},
+		{
+			name:     "single field object",
+			out:      `{"id":"p1","label":"password","value":"s3cret"}`,
+			fields:   []string{"password"},
+			expected: map[string]string{"password": "s3cret"},
+		},
+		{
+			name:     "missing field left out",
+			out:      `[{"id":"username","label":"username","value":"admin"}]`,
+			fields:   []string{"username", "token"},
+			expected: map[string]string{"username": "admin"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := parseItemFields([]byte(tt.out), tt.fields)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(values) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, values)
+			}
+			for field, v := range tt.expected {
+				if values[field] != v {
+					t.Errorf("Expected %s=%q, got %q", field, v, values[field])
+				}
+			}
+		})
+	}
+
+	if _, err := parseItemFields([]byte("not json"), []string{"a"}); err == nil {
+		t.Error("Expected error for unparseable output")
+	}
+}
+
+func TestFake_ReadItemFieldsMatchesReadRef(t *testing.T) {
+	f := NewFake()
+	values, err := f.ReadItemFields(context.Background(), "dev", "db", []string{"username", "password"}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, field := range []string{"username", "password"} {
+		want, _ := f.ReadRef(context.Background(), "op://dev/db/"+field)
+		if values[field] != want {
+			t.Errorf("Expected %s=%q, got %q", field, want, values[field])
+		}
+	}
+	if f.Calls() != 3 {
+		t.Errorf("Expected 3 calls (one for the item, two single reads), got %d", f.Calls())
+	}
+}
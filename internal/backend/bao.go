@@ -0,0 +1,122 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zach-source/opx/internal/util"
+)
+
+// BaoConfig holds OpenBao configuration on top of the shared Vault settings
+type BaoConfig struct {
+	VaultConfig
+	BaoSpecificPath string   `json:"bao_specific_path,omitempty"` // Full health URL path, overriding api_paths.health
+	TokenHeader     string   `json:"token_header,omitempty"`      // Header carrying the auth token (default: X-Vault-Token)
+	APIPaths        APIPaths `json:"api_paths,omitzero"`          // Endpoints where OpenBao diverges from Vault
+}
+
+// DefaultBaoConfig returns the configuration used when no bao.json exists
+func DefaultBaoConfig() BaoConfig {
+	return BaoConfig{
+		VaultConfig: VaultConfig{
+			Address:    "http://localhost:8300", // Default local Bao
+			AuthMethod: "token",
+		},
+	}
+}
+
+// LoadBaoConfig reads backends/bao.json from the XDG config directory if present; otherwise returns defaults.
+func LoadBaoConfig() (BaoConfig, string, error) {
+	configDir, err := util.ConfigDir()
+	if err != nil {
+		return BaoConfig{}, "", err
+	}
+	p := filepath.Join(configDir, "backends", "bao.json")
+	b, err := os.ReadFile(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return DefaultBaoConfig(), p, nil
+		}
+		return BaoConfig{}, p, err
+	}
+	cfg := DefaultBaoConfig()
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return BaoConfig{}, p, err
+	}
+	return cfg, p, nil
+}
+
+// Bao backend for OpenBao: the Vault HTTP client and API handling on its own endpoints
+type Bao struct {
+	*Vault
+	baoConfig BaoConfig
+}
+
+// NewBao creates a new Bao backend from plain Vault settings
+func NewBao(config VaultConfig) *Bao {
+	return NewBaoWithConfig(BaoConfig{VaultConfig: config})
+}
+
+// NewBaoWithConfig creates a new Bao backend with OpenBao-specific settings
+func NewBaoWithConfig(config BaoConfig) *Bao {
+	v := NewVault(config.VaultConfig)
+	if config.TokenHeader != "" {
+		v.tokenHeader = config.TokenHeader
+	}
+	v.paths = config.APIPaths.withDefaults()
+	v.scheme = "bao"
+	return &Bao{
+		Vault:     v,
+		baoConfig: config,
+	}
+}
+
+func (b *Bao) Name() string {
+	return "bao"
+}
+
+// ReadRef reads a secret from Bao using bao:// URI scheme
+func (b *Bao) ReadRef(ctx context.Context, ref string) (string, error) {
+	return b.ReadRefWithFlags(ctx, ref, nil)
+}
+
+// ReadRefWithFlags reads a bao:// ref, authenticating through Authenticate so errors name OpenBao
+func (b *Bao) ReadRefWithFlags(ctx context.Context, ref string, flags []string) (string, error) {
+	return b.readRef(ctx, b.baoRef(ref), flags, b.Authenticate)
+}
+
+// ReadRefWithContext reads a bao:// ref with its lease, KV version and when that version was written
+func (b *Bao) ReadRefWithContext(ctx context.Context, ref string, flags []string) (SecretResult, error) {
+	return b.readResult(ctx, b.baoRef(ref), flags, b.Authenticate)
+}
+
+// baoRef rewrites vault:// refs, still accepted for servers shared with a Vault setup, to bao://
+func (b *Bao) baoRef(ref string) string {
+	if strings.HasPrefix(ref, "vault://") {
+		return "bao://" + strings.TrimPrefix(ref, "vault://")
+	}
+	return ref
+}
+
+// Authenticate performs OpenBao authentication using the configured method
+func (b *Bao) Authenticate(ctx context.Context) error {
+	if err := b.Vault.authenticate(ctx); err != nil {
+		return fmt.Errorf("openbao authentication failed (%s via %s): %w", b.config.AuthMethod, b.config.Address, err)
+	}
+	return nil
+}
+
+// Ping checks OpenBao's health endpoint; active (200) and standby (429) nodes are healthy
+func (b *Bao) Ping(ctx context.Context) error {
+	url := b.apiURL(b.paths.Health)
+	if b.baoConfig.BaoSpecificPath != "" {
+		url = b.config.Address + b.baoConfig.BaoSpecificPath
+	}
+	return b.ping(ctx, url, "openbao", http.StatusOK, http.StatusTooManyRequests)
+}
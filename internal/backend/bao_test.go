@@ -0,0 +1,427 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBao_Ping(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		expectError bool
+	}{
+		{name: "active node", status: http.StatusOK, expectError: false},
+		{name: "standby node", status: http.StatusTooManyRequests, expectError: false},
+		{name: "sealed", status: http.StatusServiceUnavailable, expectError: true},
+		{name: "not initialized", status: http.StatusNotImplemented, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/sys/health" {
+					t.Errorf("Expected health path /v1/sys/health, got %s", r.URL.Path)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			bao := NewBao(VaultConfig{Address: srv.URL})
+			err := bao.Ping(context.Background())
+
+			if tt.expectError && err == nil {
+				t.Error("Expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestBao_PingSpecificPath(t *testing.T) {
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	bao := NewBaoWithConfig(BaoConfig{
+		VaultConfig:     VaultConfig{Address: srv.URL},
+		BaoSpecificPath: "/v1/sys/bao-health",
+	})
+	if err := bao.Ping(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if gotPath != "/v1/sys/bao-health" {
+		t.Errorf("Expected Bao-specific path, got %s", gotPath)
+	}
+}
+
+func TestBao_AuthenticateTokenHeader(t *testing.T) {
+	var gotHeader string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Get("Bao-Token")
+		if gotHeader != "s.test" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	bao := NewBaoWithConfig(BaoConfig{
+		VaultConfig: VaultConfig{Address: srv.URL, AuthMethod: "token", Token: "s.test"},
+		TokenHeader: "Bao-Token",
+	})
+	if err := bao.Authenticate(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if gotHeader != "s.test" {
+		t.Errorf("Expected token in Bao-Token header, got %q", gotHeader)
+	}
+}
+
+func TestBao_AuthenticateErrorMessage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	bao := NewBao(VaultConfig{Address: srv.URL, AuthMethod: "token", Token: "bad"})
+	err := bao.Authenticate(context.Background())
+	if err == nil {
+		t.Fatal("Expected authentication error")
+	}
+	if !strings.Contains(err.Error(), "openbao") {
+		t.Errorf("Expected Bao-specific error message, got %v", err)
+	}
+}
+
+func TestBao_AuthenticateAppRoleAndRenew(t *testing.T) {
+	t.Setenv("VAULT_ROLE_ID", "role")
+	t.Setenv("VAULT_SECRET_ID", "secret")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/approle/login":
+			var body map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			if body["role_id"] != "role" || body["secret_id"] != "secret" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(`{"auth":{"client_token":"s.login","lease_duration":60}}`))
+		case "/v1/auth/token/renew-self":
+			if r.Header.Get("X-Vault-Token") != "s.login" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_, _ = w.Write([]byte(`{"auth":{"client_token":"s.login","lease_duration":3600}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	bao := NewBao(VaultConfig{Address: srv.URL, AuthMethod: "approle"})
+	if err := bao.Authenticate(context.Background()); err != nil {
+		t.Fatalf("Unexpected login error: %v", err)
+	}
+	if bao.config.Token != "s.login" {
+		t.Errorf("Expected token from approle login, got %q", bao.config.Token)
+	}
+
+	if err := bao.RenewToken(context.Background()); err != nil {
+		t.Fatalf("Unexpected renew error: %v", err)
+	}
+	if bao.config.TokenTTL.Seconds() != 3600 {
+		t.Errorf("Expected renewed TTL of 3600s, got %v", bao.config.TokenTTL)
+	}
+}
+
+func TestLoadBaoConfig(t *testing.T) {
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+
+	// Missing file returns defaults
+	cfg, path, err := LoadBaoConfig()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Address != "http://localhost:8300" {
+		t.Errorf("Expected default address, got %q", cfg.Address)
+	}
+	if path != filepath.Join(configHome, "op-authd", "backends", "bao.json") {
+		t.Errorf("Unexpected config path %q", path)
+	}
+
+	// Present file overrides defaults
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	data := `{"address":"https://bao.example:8200","auth_method":"approle","bao_specific_path":"/v1/sys/health?standbyok=true"}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, _, err = LoadBaoConfig()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Address != "https://bao.example:8200" || cfg.AuthMethod != "approle" {
+		t.Errorf("Expected file values, got %+v", cfg.VaultConfig)
+	}
+	if cfg.BaoSpecificPath != "/v1/sys/health?standbyok=true" {
+		t.Errorf("Expected bao_specific_path from file, got %q", cfg.BaoSpecificPath)
+	}
+}
+
+// leaseServer is an AppRole-backed secret server that counts logins and renewals
+type leaseServer struct {
+	logins, renewals int
+	renewStatus      int
+}
+
+func (s *leaseServer) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/approle/login":
+			s.logins++
+			_, _ = fmt.Fprintf(w, `{"auth":{"client_token":"s.login%d","lease_duration":60}}`, s.logins)
+		case "/v1/auth/token/renew-self":
+			s.renewals++
+			if s.renewStatus != 0 {
+				w.WriteHeader(s.renewStatus)
+				return
+			}
+			_, _ = w.Write([]byte(`{"auth":{"client_token":"` + r.Header.Get("X-Vault-Token") + `","lease_duration":60}}`))
+		case "/v1/secret/data/app":
+			if !strings.HasPrefix(r.Header.Get("X-Vault-Token"), "s.login") {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_, _ = w.Write([]byte(`{"data":{"data":{"password":"pw"}}}`))
+		default:
+			t.Errorf("Unexpected path %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+}
+
+func TestVault_ReadRenewsAndReauthenticatesAsLeaseRunsOut(t *testing.T) {
+	t.Setenv("VAULT_ROLE_ID", "role")
+	t.Setenv("VAULT_SECRET_ID", "secret")
+
+	tests := []struct {
+		name        string
+		renewStatus int
+		advance     []time.Duration
+		logins      int
+		renewals    int
+	}{
+		{name: "fresh lease", advance: []time.Duration{0, 30 * time.Second}, logins: 1, renewals: 0},
+		{name: "renewed near expiry", advance: []time.Duration{0, 45 * time.Second}, logins: 1, renewals: 1},
+		{name: "renewal refused", renewStatus: http.StatusForbidden, advance: []time.Duration{0, 45 * time.Second}, logins: 2, renewals: 1},
+		{name: "lease expired", advance: []time.Duration{0, 2 * time.Minute}, logins: 2, renewals: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ls := &leaseServer{renewStatus: tt.renewStatus}
+			srv := httptest.NewServer(ls.handler(t))
+			defer srv.Close()
+
+			now := time.Unix(1700000000, 0)
+			v := NewVault(VaultConfig{Address: srv.URL, AuthMethod: "approle"})
+			v.clock = func() time.Time { return now }
+
+			for _, d := range tt.advance {
+				now = now.Add(d)
+				value, err := v.ReadRef(context.Background(), "vault://secret/data/app")
+				if err != nil || value != `{"password":"pw"}` {
+					t.Fatalf("Expected the secret, got %q (%v)", value, err)
+				}
+			}
+			if ls.logins != tt.logins || ls.renewals != tt.renewals {
+				t.Errorf("Expected %d logins and %d renewals, got %d and %d", tt.logins, tt.renewals, ls.logins, ls.renewals)
+			}
+		})
+	}
+}
+
+func TestBao_ReadRefAuthErrorNamesOpenBao(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	bao := NewBao(VaultConfig{Address: srv.URL, AuthMethod: "token"})
+	_, err := bao.ReadRef(context.Background(), "bao://secret/data/app#password")
+	if err == nil || !strings.Contains(err.Error(), "openbao authentication failed") {
+		t.Errorf("Expected OpenBao authentication error from the read path, got %v", err)
+	}
+}
+
+func TestBao_DivergentAPIPaths(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/bao/v2/sys/status":
+			w.WriteHeader(http.StatusOK)
+		case "/bao/v2/token/self":
+			w.WriteHeader(http.StatusOK)
+		case "/bao/v2/kv/data/app":
+			_, _ = w.Write([]byte(`{"data":{"data":{"password":"pw"}}}`))
+		case "/bao/v2/token/renew":
+			_, _ = w.Write([]byte(`{"auth":{"client_token":"s.test","lease_duration":60}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	bao := NewBaoWithConfig(BaoConfig{
+		VaultConfig: VaultConfig{Address: srv.URL, AuthMethod: "token", Token: "s.test"},
+		APIPaths: APIPaths{
+			Prefix:      "/bao/v2/",
+			Mount:       "kv/data",
+			Health:      "sys/status",
+			TokenLookup: "token/self",
+			TokenRenew:  "token/renew",
+		},
+	})
+	ctx := context.Background()
+	if err := bao.Ping(ctx); err != nil {
+		t.Fatalf("Unexpected ping error: %v", err)
+	}
+	if err := bao.Authenticate(ctx); err != nil {
+		t.Fatalf("Unexpected authentication error: %v", err)
+	}
+	value, err := bao.ReadRef(ctx, "bao://app")
+	if err != nil || value != `{"password":"pw"}` {
+		t.Fatalf("Expected the secret, got %q (%v)", value, err)
+	}
+	if err := bao.RenewToken(ctx); err != nil {
+		t.Fatalf("Unexpected renew error: %v", err)
+	}
+
+	expected := []string{"/bao/v2/sys/status", "/bao/v2/token/self", "/bao/v2/kv/data/app", "/bao/v2/token/renew"}
+	if strings.Join(paths, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected requests to %v, got %v", expected, paths)
+	}
+}
+
+func TestVault_DefaultAPIPaths(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/v1/secret/data/app" {
+			_, _ = w.Write([]byte(`{"data":{"data":{"password":"pw"}}}`))
+		}
+	}))
+	defer srv.Close()
+
+	v := NewVault(VaultConfig{Address: srv.URL, AuthMethod: "token", Token: "s.test"})
+	ctx := context.Background()
+	if err := v.Ping(ctx); err != nil {
+		t.Fatalf("Unexpected ping error: %v", err)
+	}
+	if err := v.login(ctx); err != nil {
+		t.Fatalf("Unexpected authentication error: %v", err)
+	}
+	if _, err := v.ReadRef(ctx, "vault://secret/data/app"); err != nil {
+		t.Fatalf("Unexpected read error: %v", err)
+	}
+
+	expected := []string{"/v1/sys/health", "/v1/auth/token/lookup-self", "/v1/secret/data/app"}
+	if strings.Join(paths, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected requests to %v, got %v", expected, paths)
+	}
+	if _, err := v.ReadRef(ctx, "bao://secret/data/app"); err == nil {
+		t.Error("Expected the vault backend to reject bao:// refs")
+	}
+}
+
+func TestVault_ReadRefWithContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/secret/data/app":
+			_, _ = w.Write([]byte(`{"lease_duration":0,"data":{"data":{"password":"pw"},"metadata":{"version":3,"created_time":"2025-06-01T12:00:00.123456Z"}}}`))
+		case "/v1/database/creds/app":
+			_, _ = w.Write([]byte(`{"lease_duration":300,"data":{"data":{"password":"dynamic"}}}`))
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		backend  MetadataReader
+		ref      string
+		expected SecretResult
+	}{
+		{
+			name:     "kv v2 version",
+			backend:  NewVault(VaultConfig{Address: srv.URL, AuthMethod: "token", Token: "s.test"}),
+			ref:      "vault://secret/data/app",
+			expected: SecretResult{Value: `{"password":"pw"}`, Version: "3", UpdatedAt: time.Date(2025, 6, 1, 12, 0, 0, 123456000, time.UTC)},
+		},
+		{
+			name:     "lease",
+			backend:  NewVault(VaultConfig{Address: srv.URL, AuthMethod: "token", Token: "s.test"}),
+			ref:      "vault://database/creds/app",
+			expected: SecretResult{Value: `{"password":"dynamic"}`, TTL: 5 * time.Minute},
+		},
+		{
+			name:     "bao accepts vault refs",
+			backend:  NewBao(VaultConfig{Address: srv.URL, AuthMethod: "token", Token: "s.test"}),
+			ref:      "vault://secret/data/app",
+			expected: SecretResult{Value: `{"password":"pw"}`, Version: "3", UpdatedAt: time.Date(2025, 6, 1, 12, 0, 0, 123456000, time.UTC)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.backend.ReadRefWithContext(context.Background(), tt.ref, nil)
+			if err != nil {
+				t.Fatalf("Unexpected read error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestReadResult(t *testing.T) {
+	ctx := context.Background()
+	plain := &mockBackend{name: "test", readRefResult: "secret-value"}
+	if result, err := ReadResult(ctx, plain, "op://vault/item/field", nil); err != nil || result != (SecretResult{Value: "secret-value"}) {
+		t.Errorf("Expected just the value from a backend without metadata, got %+v (%v)", result, err)
+	}
+
+	// Wrappers pass metadata through from the backend that serves the ref
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"lease_duration":60,"data":{"data":{"password":"pw"}}}`))
+	}))
+	defer srv.Close()
+	vault := NewVault(VaultConfig{Address: srv.URL, AuthMethod: "token", Token: "s.test"})
+	wrapped := Instrument(NewMultiBackend(plain, vault, nil, "op"), Hooks{})
+	result, err := ReadResult(ctx, wrapped, "vault://secret/app", nil)
+	if err != nil || result != (SecretResult{Value: `{"password":"pw"}`, TTL: time.Minute}) {
+		t.Errorf("Expected the lease through the wrappers, got %+v (%v)", result, err)
+	}
+	if result, err := ReadResult(ctx, wrapped, "op://vault/item/field", nil); err != nil || result.Value != "secret-value" {
+		t.Errorf("Expected op refs to route to the plain backend, got %+v (%v)", result, err)
+	}
+}
@@ -0,0 +1,46 @@
+package backend
+
+import (
+	"fmt"
+
+	"github.com/zach-source/opx/internal/session"
+)
+
+// Names lists the backends New can build
+var Names = []string{"opcli", "fake", "vault", "bao", "multi"}
+
+// defaultVaultConfig is the Vault the vault and multi backends talk to
+func defaultVaultConfig() VaultConfig {
+	return VaultConfig{
+		Address:    "http://localhost:8200", // Default local Vault
+		AuthMethod: "token",
+	}
+}
+
+// New builds the named backend as opx-authd runs it. A non-nil mgr makes the
+// opcli and fake backends session-aware; bao configures the bao and multi
+// backends and op the opcli and multi ones.
+func New(name string, mgr *session.Manager, bao BaoConfig, op OpCLI) (Backend, error) {
+	switch name {
+	case "opcli":
+		if mgr != nil {
+			return NewSessionAwareOpCLI(mgr, op), nil
+		}
+		return op, nil
+	case "fake":
+		if mgr != nil {
+			return NewSessionAwareFake(mgr), nil
+		}
+		return Fake{}, nil
+	case "vault":
+		// TODO: Load vault config from file
+		return NewVault(defaultVaultConfig()), nil
+	case "bao":
+		return NewBaoWithConfig(bao), nil
+	case "multi":
+		// Create multi-backend with all backends available
+		return NewMultiBackend(op, NewVault(defaultVaultConfig()), NewBaoWithConfig(bao), "op"), nil
+	default:
+		return nil, fmt.Errorf("unknown backend: %s", name)
+	}
+}
@@ -4,18 +4,137 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
 )
 
-type Fake struct{}
+// Fake returns deterministic values for any ref. The zero value always
+// succeeds instantly; NewFake adds simulated latency, errors and session expiry.
+type Fake struct {
+	sim *fakeSim
+}
+
+// FakeErrorClass selects the kind of error a Fake injects
+type FakeErrorClass string
+
+const (
+	FakeNotFound FakeErrorClass = "not-found"
+	FakeAuth     FakeErrorClass = "auth"
+	FakeTimeout  FakeErrorClass = "timeout"
+)
+
+var (
+	// ErrFakeNotFound is returned for refs a Fake is told don't exist
+	ErrFakeNotFound = errors.New("fake: item not found")
+	// ErrFakeAuth is returned for injected auth failures and after the simulated session expires
+	ErrFakeAuth = errors.New("fake: not signed in")
+)
+
+// err builds the error for class, wrapping context.DeadlineExceeded for timeouts
+func (c FakeErrorClass) err(ref string) error {
+	switch c {
+	case FakeNotFound:
+		return NotFound(fmt.Errorf("%w: %s", ErrFakeNotFound, ref))
+	case FakeAuth:
+		return fmt.Errorf("%w: %s", ErrFakeAuth, ref)
+	case FakeTimeout:
+		return fmt.Errorf("fake: read %s: %w", ref, context.DeadlineExceeded)
+	}
+	return fmt.Errorf("fake: unknown error class %q for %s", c, ref)
+}
+
+// FakeOption configures a Fake built by NewFake
+type FakeOption func(*fakeSim)
+
+// WithLatency delays reads of refs matching pattern by d; * matches any run of characters
+func WithLatency(pattern string, d time.Duration) FakeOption {
+	return func(s *fakeSim) {
+		s.latency = append(s.latency, fakeLatency{match: globRegexp(pattern), delay: d})
+	}
+}
+
+// WithError fails reads of refs matching pattern with class
+func WithError(pattern string, class FakeErrorClass) FakeOption {
+	return func(s *fakeSim) {
+		s.errs = append(s.errs, fakeError{match: globRegexp(pattern), class: class})
+	}
+}
+
+// WithFailAfter lets the first n reads succeed and fails every later one with class
+func WithFailAfter(n int, class FakeErrorClass) FakeOption {
+	return func(s *fakeSim) {
+		s.failAfter = n
+		s.failClass = class
+	}
+}
+
+// WithSessionExpiry returns auth errors once d has passed since the last ValidateSession
+func WithSessionExpiry(d time.Duration) FakeOption {
+	return func(s *fakeSim) { s.sessionTTL = d }
+}
+
+// WithFakeClock replaces time.Now for session expiry
+func WithFakeClock(now func() time.Time) FakeOption {
+	return func(s *fakeSim) { s.now = now }
+}
+
+type fakeLatency struct {
+	match *regexp.Regexp
+	delay time.Duration
+}
+
+type fakeError struct {
+	match *regexp.Regexp
+	class FakeErrorClass
+}
+
+// fakeSim holds the knobs and call state shared by copies of a Fake
+type fakeSim struct {
+	latency    []fakeLatency
+	errs       []fakeError
+	failAfter  int
+	failClass  FakeErrorClass
+	sessionTTL time.Duration
+	now        func() time.Time
+
+	mu        sync.Mutex
+	calls     int
+	validated time.Time
+}
+
+// NewFake creates a Fake with the given simulation options
+func NewFake(opts ...FakeOption) Fake {
+	s := &fakeSim{now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.validated = s.now()
+	return Fake{sim: s}
+}
+
+// globRegexp compiles a ref pattern where * matches any run of characters
+func globRegexp(pattern string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(pattern)
+	return regexp.MustCompile("^" + strings.ReplaceAll(quoted, `\*`, ".*") + "$")
+}
 
 func (Fake) Name() string { return "fake" }
 
-func (Fake) ReadRef(ctx context.Context, ref string) (string, error) {
-	return Fake{}.ReadRefWithFlags(ctx, ref, nil)
+func (f Fake) ReadRef(ctx context.Context, ref string) (string, error) {
+	return f.ReadRefWithFlags(ctx, ref, nil)
 }
 
-func (Fake) ReadRefWithFlags(ctx context.Context, ref string, flags []string) (string, error) {
+func (f Fake) ReadRefWithFlags(ctx context.Context, ref string, flags []string) (string, error) {
+	if f.sim != nil {
+		if err := f.sim.read(ctx, ref); err != nil {
+			return "", err
+		}
+	}
+
 	// For fake backend, we ignore flags but include them in the hash for determinism
 	input := ref
 	for _, flag := range flags {
@@ -24,3 +143,74 @@ func (Fake) ReadRefWithFlags(ctx context.Context, ref string, flags []string) (s
 	sum := sha256.Sum256([]byte(input))
 	return fmt.Sprintf("fake_%s", hex.EncodeToString(sum[:8])), nil
 }
+
+// ReadItemFields returns the values ReadRefWithFlags would for each field, as one simulated call
+func (f Fake) ReadItemFields(ctx context.Context, vault, item string, fields []string, flags []string) (map[string]string, error) {
+	if f.sim != nil {
+		if err := f.sim.read(ctx, "op://"+vault+"/"+item); err != nil {
+			return nil, err
+		}
+	}
+	values := make(map[string]string, len(fields))
+	for _, field := range fields {
+		values[field], _ = Fake{}.ReadRefWithFlags(ctx, "op://"+vault+"/"+item+"/"+field, flags)
+	}
+	return values, nil
+}
+
+// Calls returns how many reads the Fake has served, including failed ones
+func (f Fake) Calls() int {
+	if f.sim == nil {
+		return 0
+	}
+	f.sim.mu.Lock()
+	defer f.sim.mu.Unlock()
+	return f.sim.calls
+}
+
+// ValidateSession renews the simulated session after WithSessionExpiry
+func (f Fake) ValidateSession(ctx context.Context) error {
+	if f.sim == nil {
+		return nil
+	}
+	f.sim.mu.Lock()
+	defer f.sim.mu.Unlock()
+	f.sim.validated = f.sim.now()
+	return nil
+}
+
+// read applies the simulated latency and failures for one read of ref
+func (s *fakeSim) read(ctx context.Context, ref string) error {
+	s.mu.Lock()
+	s.calls++
+	calls := s.calls
+	expired := s.sessionTTL > 0 && s.now().Sub(s.validated) >= s.sessionTTL
+	s.mu.Unlock()
+
+	for _, l := range s.latency {
+		if !l.match.MatchString(ref) {
+			continue
+		}
+		timer := time.NewTimer(l.delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		break
+	}
+
+	if expired {
+		return FakeAuth.err(ref)
+	}
+	for _, e := range s.errs {
+		if e.match.MatchString(ref) {
+			return e.class.err(ref)
+		}
+	}
+	if s.failClass != "" && calls > s.failAfter {
+		return s.failClass.err(ref)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFake_Latency(t *testing.T) {
+	fake := NewFake(WithLatency("op://slow/*", 50*time.Millisecond))
+
+	start := time.Now()
+	if _, err := fake.ReadRef(context.Background(), "op://fast/item/field"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 50*time.Millisecond {
+		t.Errorf("Expected unmatched ref to be instant, took %v", elapsed)
+	}
+
+	start = time.Now()
+	if _, err := fake.ReadRef(context.Background(), "op://slow/item/field"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected at least 50ms latency, took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := fake.ReadRef(ctx, "op://slow/item/field"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected latency to honour the context deadline, got %v", err)
+	}
+}
+
+func TestFake_ErrorInjection(t *testing.T) {
+	fake := NewFake(
+		WithError("op://vault/missing/*", FakeNotFound),
+		WithError("op://locked/*", FakeAuth),
+		WithError("*/hang", FakeTimeout),
+	)
+
+	tests := []struct {
+		ref      string
+		expected error
+	}{
+		{ref: "op://vault/missing/password", expected: ErrFakeNotFound},
+		{ref: "op://locked/item/password", expected: ErrFakeAuth},
+		{ref: "op://vault/item/hang", expected: context.DeadlineExceeded},
+		{ref: "op://vault/item/password"},
+	}
+
+	for _, tt := range tests {
+		_, err := fake.ReadRef(context.Background(), tt.ref)
+		if tt.expected == nil {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.ref, err)
+			}
+			continue
+		}
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.ref, tt.expected, err)
+		}
+	}
+}
+
+func TestFake_FailAfter(t *testing.T) {
+	fake := NewFake(WithFailAfter(2, FakeAuth))
+
+	for i := 1; i <= 4; i++ {
+		_, err := fake.ReadRef(context.Background(), "op://vault/item/field")
+		if i <= 2 && err != nil {
+			t.Errorf("Read %d: unexpected error: %v", i, err)
+		}
+		if i > 2 && !errors.Is(err, ErrFakeAuth) {
+			t.Errorf("Read %d: expected auth error, got %v", i, err)
+		}
+	}
+	if calls := fake.Calls(); calls != 4 {
+		t.Errorf("Expected 4 calls, got %d", calls)
+	}
+}
+
+func TestFake_SessionExpiry(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	fake := NewFake(WithSessionExpiry(time.Minute), WithFakeClock(func() time.Time { return now }))
+	ref := "op://vault/item/field"
+
+	if _, err := fake.ReadRef(context.Background(), ref); err != nil {
+		t.Fatalf("Expected fresh session to read, got %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := fake.ReadRef(context.Background(), ref); !errors.Is(err, ErrFakeAuth) {
+		t.Errorf("Expected auth error after expiry, got %v", err)
+	}
+	if _, err := fake.ReadRef(context.Background(), ref); !errors.Is(err, ErrFakeAuth) {
+		t.Errorf("Expected auth errors until ValidateSession, got %v", err)
+	}
+
+	if err := fake.ValidateSession(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := fake.ReadRef(context.Background(), ref); err != nil {
+		t.Errorf("Expected renewed session to read, got %v", err)
+	}
+}
+
+func TestFake_ZeroValueUnchanged(t *testing.T) {
+	simulated := NewFake()
+	for _, ref := range []string{"op://vault/item/field", "op://other/item/field"} {
+		want, err := Fake{}.ReadRef(context.Background(), ref)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		got, err := simulated.ReadRef(context.Background(), ref)
+		if err != nil || got != want {
+			t.Errorf("Expected NewFake() to match the zero value %q, got %q (%v)", want, got, err)
+		}
+	}
+	if calls := (Fake{}).Calls(); calls != 0 {
+		t.Errorf("Expected zero-value Fake to report 0 calls, got %d", calls)
+	}
+}
@@ -0,0 +1,172 @@
+package backend
+
+import (
+	"context"
+	"time"
+
+	"github.com/zach-source/opx/internal/session"
+)
+
+// Hooks observe backend calls. OnStart gets the name of the innermost backend
+// serving ref; OnFinish gets the call's error and duration. Either may be nil.
+type Hooks struct {
+	OnStart  func(ctx context.Context, ref, backend string)
+	OnFinish func(ctx context.Context, ref string, err error, d time.Duration, fromRetry bool)
+}
+
+// Unwrapper is implemented by decorators that wrap a single backend
+type Unwrapper interface {
+	Unwrap() Backend
+}
+
+// Router is implemented by backends that pick a different backend per ref
+type Router interface {
+	Route(ctx context.Context, ref string) Backend
+}
+
+// Innermost follows Unwrap and Route down to the backend that actually serves ref
+func Innermost(ctx context.Context, b Backend, ref string) Backend {
+	for b != nil {
+		switch d := b.(type) {
+		case Router:
+			next := d.Route(ctx, ref)
+			if next == nil {
+				return b
+			}
+			b = next
+		case Unwrapper:
+			b = d.Unwrap()
+		default:
+			return b
+		}
+	}
+	return b
+}
+
+// As finds the first backend of type T in the Unwrap chain starting at b
+func As[T any](b Backend) (T, bool) {
+	for b != nil {
+		if t, ok := b.(T); ok {
+			return t, true
+		}
+		u, ok := b.(Unwrapper)
+		if !ok {
+			break
+		}
+		b = u.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
+
+type retryKey struct{}
+
+// WithRetry marks ctx as a retry of an earlier failed call, reported to OnFinish as fromRetry
+func WithRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryKey{}, true)
+}
+
+func isRetry(ctx context.Context) bool {
+	retry, _ := ctx.Value(retryKey{}).(bool)
+	return retry
+}
+
+// instrumented calls Hooks around every read and create of the wrapped backend
+type instrumented struct {
+	backend Backend
+	hooks   Hooks
+}
+
+// Instrument wraps b so hooks see every call; the daemon applies it once, outermost
+func Instrument(b Backend, hooks Hooks) Backend {
+	return &instrumented{backend: b, hooks: hooks}
+}
+
+func (i *instrumented) Name() string {
+	return i.backend.Name()
+}
+
+// Unwrap returns the instrumented backend
+func (i *instrumented) Unwrap() Backend {
+	return i.backend
+}
+
+func (i *instrumented) ReadRef(ctx context.Context, ref string) (string, error) {
+	return i.ReadRefWithFlags(ctx, ref, nil)
+}
+
+func (i *instrumented) ReadRefWithFlags(ctx context.Context, ref string, flags []string) (string, error) {
+	var value string
+	err := i.observe(ctx, ref, func() error {
+		var err error
+		value, err = i.backend.ReadRefWithFlags(ctx, ref, flags)
+		return err
+	})
+	return value, err
+}
+
+// ReadRefWithContext reads ref with its metadata through the wrapped backend
+func (i *instrumented) ReadRefWithContext(ctx context.Context, ref string, flags []string) (SecretResult, error) {
+	var result SecretResult
+	err := i.observe(ctx, ref, func() error {
+		var err error
+		result, err = ReadResult(ctx, i.backend, ref, flags)
+		return err
+	})
+	return result, err
+}
+
+// CreateItem creates an item through the wrapped backend; the hooks see the item's vault/title ref
+func (i *instrumented) CreateItem(ctx context.Context, item NewItem, flags []string) (string, error) {
+	creator, ok := i.backend.(ItemCreator)
+	if !ok {
+		return "", ErrCreateUnsupported
+	}
+	var created string
+	err := i.observe(ctx, "op://"+item.Vault+"/"+item.Title, func() error {
+		var err error
+		created, err = creator.CreateItem(ctx, item, flags)
+		return err
+	})
+	return created, err
+}
+
+// ReadItemFields reads fields through the wrapped backend; the hooks see the item's vault/item ref
+func (i *instrumented) ReadItemFields(ctx context.Context, vault, item string, fields []string, flags []string) (map[string]string, error) {
+	reader, ok := i.backend.(ItemFieldsReader)
+	if !ok {
+		return nil, ErrItemFieldsUnsupported
+	}
+	var values map[string]string
+	err := i.observe(ctx, "op://"+vault+"/"+item, func() error {
+		var err error
+		values, err = reader.ReadItemFields(ctx, vault, item, fields, flags)
+		return err
+	})
+	return values, err
+}
+
+// observe runs call between OnStart and OnFinish
+func (i *instrumented) observe(ctx context.Context, ref string, call func() error) error {
+	if i.hooks.OnStart != nil {
+		i.hooks.OnStart(ctx, ref, Innermost(ctx, i.backend, ref).Name())
+	}
+	start := time.Now()
+	err := call()
+	if i.hooks.OnFinish != nil {
+		i.hooks.OnFinish(ctx, ref, err, time.Since(start), isRetry(ctx))
+	}
+	return err
+}
+
+// SessionActivityHooks extend the session after each successful client call;
+// background reads don't count as activity
+func SessionActivityHooks(m *session.Manager) Hooks {
+	return Hooks{
+		OnFinish: func(ctx context.Context, ref string, err error, d time.Duration, fromRetry bool) {
+			if err == nil && !isBackgroundRead(ctx) {
+				m.UpdateActivity()
+			}
+		},
+	}
+}
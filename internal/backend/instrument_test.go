@@ -0,0 +1,114 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/session"
+)
+
+func TestInstrument_HookOrder(t *testing.T) {
+	var events []string
+	hooks := Hooks{
+		OnStart: func(ctx context.Context, ref, backend string) {
+			events = append(events, fmt.Sprintf("start %s %s", ref, backend))
+		},
+		OnFinish: func(ctx context.Context, ref string, err error, d time.Duration, fromRetry bool) {
+			events = append(events, fmt.Sprintf("finish %s err=%v retry=%t", ref, err, fromRetry))
+		},
+	}
+	failure := errors.New("backend failure")
+	ok := Instrument(&mockBackend{name: "test", readRefResult: "secret"}, hooks)
+	failing := Instrument(&mockBackend{name: "test", readRefError: failure}, hooks)
+
+	if _, err := ok.ReadRef(context.Background(), "op://v/i/f"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := failing.ReadRef(WithRetry(context.Background()), "op://v/i/g"); !errors.Is(err, failure) {
+		t.Fatalf("Expected the backend error, got %v", err)
+	}
+
+	expected := []string{
+		"start op://v/i/f test",
+		"finish op://v/i/f err=<nil> retry=false",
+		"start op://v/i/g test",
+		"finish op://v/i/g err=backend failure retry=true",
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %v", len(expected), events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("Event %d: expected %q, got %q", i, expected[i], events[i])
+		}
+	}
+}
+
+func TestInstrument_Duration(t *testing.T) {
+	var got time.Duration
+	be := Instrument(NewFake(WithLatency("*", 20*time.Millisecond)), Hooks{
+		OnFinish: func(ctx context.Context, ref string, err error, d time.Duration, fromRetry bool) { got = d },
+	})
+	if _, err := be.ReadRef(context.Background(), "op://v/i/f"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got < 20*time.Millisecond {
+		t.Errorf("Expected duration of at least 20ms, got %v", got)
+	}
+}
+
+func TestInnermost_FullStack(t *testing.T) {
+	vault := &mockBackend{name: "vault"}
+	multi := NewMultiBackend(Fake{}, vault, nil, "op")
+	mgr := session.NewManager(session.DefaultConfig())
+	stack := Instrument(NewSessionAwareBackend(multi, mgr), Hooks{})
+
+	tests := []struct {
+		ctx      context.Context
+		ref      string
+		expected string
+	}{
+		{ctx: context.Background(), ref: "op://v/i/f", expected: "fake"},
+		{ctx: context.Background(), ref: "vault://secret/app", expected: "vault"},
+		{ctx: context.Background(), ref: "v/i/f", expected: "fake"},
+		{ctx: WithSecretType(context.Background(), "vault"), ref: "secret/app", expected: "vault"},
+		{ctx: context.Background(), ref: "bao://secret/app", expected: "multi"},
+	}
+	for _, tt := range tests {
+		if got := Innermost(tt.ctx, stack, tt.ref).Name(); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.ref, tt.expected, got)
+		}
+	}
+
+	if found, ok := As[*MultiBackend](stack); !ok || found != multi {
+		t.Error("Expected As to find the multi backend through the stack")
+	}
+	if _, ok := As[*Vault](stack); ok {
+		t.Error("Expected As not to look past a router")
+	}
+}
+
+func TestInstrument_ReportsInnermostName(t *testing.T) {
+	var names []string
+	multi := NewMultiBackend(Fake{}, &mockBackend{name: "vault"}, nil, "op")
+	mgr := session.NewManager(session.DefaultConfig())
+	mgr.SetCallbacks(func() error { return nil }, func(ctx context.Context) error { return nil })
+	be := Instrument(NewSessionAwareBackend(multi, mgr), Hooks{
+		OnStart: func(ctx context.Context, ref, backend string) { names = append(names, backend) },
+	})
+
+	for _, ref := range []string{"op://v/i/f", "vault://secret/app"} {
+		if _, err := be.ReadRef(context.Background(), ref); err != nil {
+			t.Fatalf("%s: unexpected error: %v", ref, err)
+		}
+	}
+	if len(names) != 2 || names[0] != "fake" || names[1] != "vault" {
+		t.Errorf("Expected [fake vault], got %v", names)
+	}
+	if be.Name() != "multi+session" {
+		t.Errorf("Expected outer name to be unchanged, got %q", be.Name())
+	}
+}
@@ -2,10 +2,22 @@ package backend
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 )
 
+// ErrNoBackend matches reads of a scheme or secret type the multi backend has no backend for
+var ErrNoBackend = errors.New("no backend configured")
+
+// noBackendError marks err as ErrNoBackend without changing its message
+type noBackendError struct{ err error }
+
+func (e noBackendError) Error() string        { return e.err.Error() }
+func (e noBackendError) Unwrap() error        { return e.err }
+func (e noBackendError) Is(target error) bool { return target == ErrNoBackend }
+
 // MultiBackend routes requests to different backends based on URI scheme
 type MultiBackend struct {
 	opBackend     Backend
@@ -17,13 +29,22 @@ type MultiBackend struct {
 // NewMultiBackend creates a new multi-backend router
 func NewMultiBackend(opBackend, vaultBackend, baoBackend Backend, defaultScheme string) *MultiBackend {
 	return &MultiBackend{
-		opBackend:     opBackend,
-		vaultBackend:  vaultBackend,
-		baoBackend:    baoBackend,
+		opBackend:     orNil(opBackend),
+		vaultBackend:  orNil(vaultBackend),
+		baoBackend:    orNil(baoBackend),
 		defaultScheme: defaultScheme,
 	}
 }
 
+// orNil turns a typed nil such as (*Vault)(nil) into a nil Backend, so
+// an unconfigured scheme is reported rather than dereferenced
+func orNil(b Backend) Backend {
+	if v := reflect.ValueOf(b); v.Kind() == reflect.Pointer && v.IsNil() {
+		return nil
+	}
+	return b
+}
+
 func (m *MultiBackend) Name() string {
 	return "multi"
 }
@@ -33,35 +54,136 @@ func (m *MultiBackend) ReadRef(ctx context.Context, ref string) (string, error)
 	return m.ReadRefWithFlags(ctx, ref, nil)
 }
 
-// ReadRefWithFlags routes the request with flags to the appropriate backend
+// ReadRefWithFlags routes the request with flags to the appropriate backend.
+// A secret type attached with WithSecretType overrides URI-based routing.
 func (m *MultiBackend) ReadRefWithFlags(ctx context.Context, ref string, flags []string) (string, error) {
-	backend := m.getBackendForRef(ref)
-	if backend == nil {
-		return "", fmt.Errorf("no backend available for reference: %s", ref)
+	backend, ref, err := m.backendFor(ctx, ref)
+	if err != nil {
+		return "", err
 	}
-
 	return backend.ReadRefWithFlags(ctx, ref, flags)
 }
 
-// getBackendForRef determines which backend to use for a given reference
-func (m *MultiBackend) getBackendForRef(ref string) Backend {
-	switch {
-	case strings.HasPrefix(ref, "op://"):
+// ReadRefWithContext routes the request like ReadRefWithFlags, returning the value's metadata
+func (m *MultiBackend) ReadRefWithContext(ctx context.Context, ref string, flags []string) (SecretResult, error) {
+	backend, ref, err := m.backendFor(ctx, ref)
+	if err != nil {
+		return SecretResult{}, err
+	}
+	return ReadResult(ctx, backend, ref, flags)
+}
+
+// backendFor picks the backend for ref, returning ref with the scheme a secret type implies
+func (m *MultiBackend) backendFor(ctx context.Context, ref string) (Backend, string, error) {
+	if secretType := SecretTypeFromContext(ctx); secretType != "" {
+		backend := m.getBackendForType(secretType)
+		if backend == nil {
+			return nil, "", noBackendError{fmt.Errorf("no %s backend configured for reference: %s", secretType, ref)}
+		}
+		// Backends parse their own scheme, so give scheme-less refs the requested one
+		if !strings.Contains(ref, "://") {
+			ref = secretType + "://" + ref
+		}
+		return backend, ref, nil
+	}
+
+	backend, err := m.getBackendForRef(ref)
+	if err != nil {
+		return nil, "", err
+	}
+	return backend, ref, nil
+}
+
+// CreateItem creates 1Password items through the op backend
+func (m *MultiBackend) CreateItem(ctx context.Context, item NewItem, flags []string) (string, error) {
+	creator, ok := m.opBackend.(ItemCreator)
+	if !ok {
+		return "", ErrCreateUnsupported
+	}
+	return creator.CreateItem(ctx, item, flags)
+}
+
+// ReadItemFields reads several fields of a 1Password item through the op backend
+func (m *MultiBackend) ReadItemFields(ctx context.Context, vault, item string, fields []string, flags []string) (map[string]string, error) {
+	reader, ok := m.opBackend.(ItemFieldsReader)
+	if !ok {
+		return nil, ErrItemFieldsUnsupported
+	}
+	return reader.ReadItemFields(ctx, vault, item, fields, flags)
+}
+
+// Route returns the backend that serves ref, or nil if its scheme isn't configured
+func (m *MultiBackend) Route(ctx context.Context, ref string) Backend {
+	if secretType := SecretTypeFromContext(ctx); secretType != "" {
+		return m.getBackendForType(secretType)
+	}
+	backend, _ := m.getBackendForRef(ref)
+	return backend
+}
+
+// getBackendForType returns the backend registered for an explicit secret type
+func (m *MultiBackend) getBackendForType(secretType string) Backend {
+	switch secretType {
+	case "op":
 		return m.opBackend
-	case strings.HasPrefix(ref, "vault://"):
+	case "vault":
 		return m.vaultBackend
-	case strings.HasPrefix(ref, "bao://"):
+	case "bao":
 		return m.baoBackend
-	default:
-		// For references without scheme, use default
-		switch m.defaultScheme {
-		case "op":
-			return m.opBackend
-		case "vault":
-			return m.vaultBackend
-		case "bao":
-			return m.baoBackend
-		}
 	}
 	return nil
 }
+
+// SubBackend is one backend behind a MultiBackend; Backend is nil when the scheme isn't configured
+type SubBackend struct {
+	Scheme  string
+	Backend Backend
+	Default bool
+}
+
+// Backends lists the sub-backends in routing order
+func (m *MultiBackend) Backends() []SubBackend {
+	subs := make([]SubBackend, 0, 3)
+	for _, scheme := range []string{"op", "vault", "bao"} {
+		subs = append(subs, SubBackend{
+			Scheme:  scheme,
+			Backend: m.getBackendForType(scheme),
+			Default: scheme == m.defaultScheme,
+		})
+	}
+	return subs
+}
+
+// getBackendForRef determines which backend to use for a given reference,
+// failing with ErrNoBackend when its scheme has none configured
+func (m *MultiBackend) getBackendForRef(ref string) (Backend, error) {
+	// For references without a known scheme, use the default
+	scheme := m.defaultScheme
+	for _, s := range []string{"op", "vault", "bao"} {
+		if strings.HasPrefix(ref, s+"://") {
+			scheme = s
+			break
+		}
+	}
+	backend := m.getBackendForType(scheme)
+	if backend == nil {
+		return nil, noBackendError{fmt.Errorf("no backend configured for scheme %q", scheme)}
+	}
+	return backend, nil
+}
+
+type secretTypeKey struct{}
+
+// WithSecretType attaches an explicit backend hint to ctx for MultiBackend routing
+func WithSecretType(ctx context.Context, secretType string) context.Context {
+	if secretType == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, secretTypeKey{}, secretType)
+}
+
+// SecretTypeFromContext returns the hint set by WithSecretType, or "" for auto
+func SecretTypeFromContext(ctx context.Context) string {
+	t, _ := ctx.Value(secretTypeKey{}).(string)
+	return t
+}
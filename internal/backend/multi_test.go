@@ -0,0 +1,97 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMultiBackend_SecretTypeOverride(t *testing.T) {
+	opBe := NewMock("op")
+	vaultBe := NewMock("vault")
+	opBe.SetResponse("some/path", "from-op")
+	vaultBe.SetResponse("vault://some/path", "from-vault")
+
+	multi := NewMultiBackend(opBe, vaultBe, nil, "op")
+
+	// Without a hint, scheme-less refs go to the default backend
+	got, err := multi.ReadRefWithFlags(context.Background(), "some/path", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got != "from-op" {
+		t.Errorf("Expected default op backend, got %q", got)
+	}
+
+	// An explicit type routes to that backend regardless of the ref
+	ctx := WithSecretType(context.Background(), "vault")
+	got, err = multi.ReadRefWithFlags(ctx, "some/path", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got != "from-vault" {
+		t.Errorf("Expected vault backend, got %q", got)
+	}
+	if calls := vaultBe.GetCalls(); len(calls) != 1 || calls[0] != "vault://some/path" {
+		t.Errorf("Expected vault backend to receive vault://some/path, got %v", calls)
+	}
+	if calls := opBe.GetCalls(); len(calls) != 1 {
+		t.Errorf("Expected op backend to be called only once, got %v", calls)
+	}
+}
+
+func TestMultiBackend_SecretTypeNotConfigured(t *testing.T) {
+	multi := NewMultiBackend(NewMock("op"), NewMock("vault"), nil, "op")
+
+	for _, secretType := range []string{"bao", "awssm"} {
+		ctx := WithSecretType(context.Background(), secretType)
+		_, err := multi.ReadRefWithFlags(ctx, "some/path", nil)
+		if err == nil || !strings.Contains(err.Error(), "no "+secretType+" backend configured") {
+			t.Errorf("Expected missing %s backend error, got %v", secretType, err)
+		}
+	}
+}
+
+func TestSecretTypeFromContext(t *testing.T) {
+	if got := SecretTypeFromContext(context.Background()); got != "" {
+		t.Errorf("Expected empty secret type, got %q", got)
+	}
+	ctx := WithSecretType(context.Background(), "")
+	if got := SecretTypeFromContext(ctx); got != "" {
+		t.Errorf("Expected empty secret type, got %q", got)
+	}
+	ctx = WithSecretType(context.Background(), "bao")
+	if got := SecretTypeFromContext(ctx); got != "bao" {
+		t.Errorf("Expected bao, got %q", got)
+	}
+}
+
+func TestMultiBackend_SchemeNotConfigured(t *testing.T) {
+	tests := []struct {
+		name     string
+		multi    *MultiBackend
+		ref      string
+		expected string
+	}{
+		{name: "op", multi: NewMultiBackend(nil, NewMock("vault"), NewMock("bao"), "vault"), ref: "op://v/i/f", expected: `no backend configured for scheme "op"`},
+		{name: "vault", multi: NewMultiBackend(NewMock("op"), nil, NewMock("bao"), "op"), ref: "vault://secret/app#key", expected: `no backend configured for scheme "vault"`},
+		{name: "bao", multi: NewMultiBackend(NewMock("op"), NewMock("vault"), nil, "op"), ref: "bao://secret/app#key", expected: `no backend configured for scheme "bao"`},
+		{name: "default for scheme-less refs", multi: NewMultiBackend(nil, NewMock("vault"), nil, "op"), ref: "some/path", expected: `no backend configured for scheme "op"`},
+		{name: "typed nil", multi: NewMultiBackend(NewMock("op"), (*Vault)(nil), nil, "op"), ref: "vault://secret/app#key", expected: `no backend configured for scheme "vault"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.multi.ReadRefWithFlags(context.Background(), tt.ref, nil)
+			if !errors.Is(err, ErrNoBackend) {
+				t.Fatalf("Expected ErrNoBackend, got %v", err)
+			}
+			if err.Error() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, err.Error())
+			}
+			if b := tt.multi.Route(context.Background(), tt.ref); b != nil {
+				t.Errorf("Expected no route, got %T", b)
+			}
+		})
+	}
+}
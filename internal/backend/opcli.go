@@ -1,26 +1,30 @@
 package backend
 
 import (
-	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"os/exec"
 	"strings"
 	"time"
 )
 
-type OpCLI struct{}
+// OpCLI reads and creates 1Password items by shelling out to op
+type OpCLI struct {
+	// ApprovalTimeout kills op once it has waited this long on a desktop app
+	// approval prompt, failing with ErrApprovalRequired (0 waits for ctx)
+	ApprovalTimeout time.Duration
+}
 
 func (OpCLI) Name() string { return "opcli" }
 
 // ReadRef shells out to `op read <ref>` and trims trailing newlines.
-func (OpCLI) ReadRef(ctx context.Context, ref string) (string, error) {
-	return OpCLI{}.ReadRefWithFlags(ctx, ref, nil)
+func (o OpCLI) ReadRef(ctx context.Context, ref string) (string, error) {
+	return o.ReadRefWithFlags(ctx, ref, nil)
 }
 
 // ReadRefWithFlags shells out to `op read` with additional flags and trims trailing newlines.
-func (OpCLI) ReadRefWithFlags(ctx context.Context, ref string, flags []string) (string, error) {
+func (o OpCLI) ReadRefWithFlags(ctx context.Context, ref string, flags []string) (string, error) {
 	if strings.TrimSpace(ref) == "" {
 		return "", errors.New("empty ref")
 	}
@@ -36,17 +40,8 @@ func (OpCLI) ReadRefWithFlags(ctx context.Context, ref string, flags []string) (
 	}
 
 	// Validate flags: each flag must start with dash and contain safe characters
-	for _, flag := range flags {
-		if flag == "" {
-			continue
-		}
-		if !strings.HasPrefix(flag, "-") {
-			return "", errors.New("invalid flag format: must start with dash")
-		}
-		// Check for command injection attempts in flags
-		if strings.ContainsAny(flag, ";&|`$()") {
-			return "", errors.New("invalid flag format: contains unsafe characters")
-		}
+	if err := validFlags(flags); err != nil {
+		return "", err
 	}
 
 	// Build command args: op [global-flags] read --no-color ref
@@ -62,19 +57,202 @@ func (OpCLI) ReadRefWithFlags(ctx context.Context, ref string, flags []string) (
 	// Add the read subcommand and its flags
 	args = append(args, "read", "--no-color", ref)
 
-	cmd := exec.CommandContext(ctx, "op", args...)
-	var out, errb bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &errb
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("op read failed: %w; stderr=%s", err, strings.TrimSpace(errb.String()))
+	out, stderr, waited, err := o.run(ctx, args, nil)
+	if err != nil {
+		err = fmt.Errorf("op read failed: %w; stderr=%s", err, stderr)
+		if opNotFound(stderr) {
+			return "", NotFound(err)
+		}
+		return "", approvalRequired(err, stderr, waited)
 	}
 	// Trim one trailing newline without nuking legitimate whitespace
-	s := out.String()
+	s := string(out)
 	s = strings.TrimRight(s, "\n")
 	return s, nil
 }
 
+// opItemField is one entry of `op item get --fields ... --format json` output
+type opItemField struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// itemFieldsArgs builds the `op item get` arguments that read fields of one item
+func itemFieldsArgs(vault, item string, fields, flags []string) ([]string, error) {
+	if vault == "" || item == "" || strings.HasPrefix(vault, "-") || strings.HasPrefix(item, "-") {
+		return nil, errors.New("invalid item reference")
+	}
+	if err := validFlags(flags); err != nil {
+		return nil, err
+	}
+	selectors := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if field == "" || strings.Contains(field, ",") {
+			return nil, fmt.Errorf("invalid field name %q", field)
+		}
+		selectors = append(selectors, "label="+field)
+	}
+
+	args := []string{}
+	for _, flag := range flags {
+		if flag != "" {
+			args = append(args, flag)
+		}
+	}
+	return append(args, "item", "get", item, "--vault", vault, "--fields", strings.Join(selectors, ","), "--reveal", "--format", "json"), nil
+}
+
+// parseItemFields maps the requested fields to values in `op item get` JSON,
+// which is a single object for one field and an array for several
+func parseItemFields(out []byte, fields []string) (map[string]string, error) {
+	var entries []opItemField
+	if err := json.Unmarshal(out, &entries); err != nil {
+		var one opItemField
+		if err := json.Unmarshal(out, &one); err != nil {
+			return nil, fmt.Errorf("parse op item get output: %w", err)
+		}
+		entries = []opItemField{one}
+	}
+	values := make(map[string]string, len(fields))
+	for _, field := range fields {
+		for _, e := range entries {
+			if e.Label == field || e.ID == field {
+				values[field] = e.Value
+				break
+			}
+		}
+	}
+	return values, nil
+}
+
+// ReadItemFields shells out to `op item get` once for several fields of one item
+func (o OpCLI) ReadItemFields(ctx context.Context, vault, item string, fields []string, flags []string) (map[string]string, error) {
+	args, err := itemFieldsArgs(vault, item, fields, flags)
+	if err != nil {
+		return nil, err
+	}
+	out, stderr, waited, err := o.run(ctx, args, nil)
+	if err != nil {
+		err = fmt.Errorf("op item get failed: %w; stderr=%s", err, stderr)
+		if opNotFound(stderr) {
+			return nil, NotFound(err)
+		}
+		return nil, approvalRequired(err, stderr, waited)
+	}
+	return parseItemFields(out, fields)
+}
+
+// opNotFound reports whether op's stderr says the vault, item or field doesn't exist
+func opNotFound(stderr string) bool {
+	for _, msg := range []string{"isn't a vault", "isn't an item", "isn't a field", "could not find"} {
+		if strings.Contains(stderr, msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultItemCategory is the category used when NewItem.Category is empty
+const defaultItemCategory = "Login"
+
+// opItemTemplate is the JSON item template `op item create` reads from stdin
+type opItemTemplate struct {
+	Fields []opTemplateField `json:"fields"`
+}
+
+type opTemplateField struct {
+	Label string `json:"label"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// validFlags rejects flags that don't start with a dash or contain shell metacharacters
+func validFlags(flags []string) error {
+	for _, flag := range flags {
+		if flag == "" {
+			continue
+		}
+		if !strings.HasPrefix(flag, "-") {
+			return errors.New("invalid flag format: must start with dash")
+		}
+		if strings.ContainsAny(flag, ";&|`$()") {
+			return errors.New("invalid flag format: contains unsafe characters")
+		}
+	}
+	return nil
+}
+
+// createItemArgs builds the `op item create` arguments for item and the JSON
+// template holding its literal values, which go over stdin rather than argv
+func createItemArgs(item NewItem, flags []string) ([]string, []byte, error) {
+	for _, part := range []struct{ name, value string }{{"vault", item.Vault}, {"title", item.Title}} {
+		if strings.TrimSpace(part.value) == "" {
+			return nil, nil, fmt.Errorf("empty %s", part.name)
+		}
+		if strings.HasPrefix(part.value, "-") || strings.Contains(part.value, "/") {
+			return nil, nil, fmt.Errorf("invalid %s %q: cannot start with dash or contain /", part.name, part.value)
+		}
+	}
+	if len(item.Fields) == 0 {
+		return nil, nil, errors.New("no fields")
+	}
+	if err := validFlags(flags); err != nil {
+		return nil, nil, err
+	}
+	category := item.Category
+	if category == "" {
+		category = defaultItemCategory
+	}
+
+	var tmpl opItemTemplate
+	generate := false
+	for _, f := range item.Fields {
+		if f.Name == "" {
+			return nil, nil, errors.New("empty field name")
+		}
+		if f.Generate {
+			// op can only generate the built-in password field
+			if f.Name != "password" {
+				return nil, nil, fmt.Errorf("field %q: only password can be generated", f.Name)
+			}
+			generate = true
+			continue
+		}
+		tmpl.Fields = append(tmpl.Fields, opTemplateField{Label: f.Name, Type: "CONCEALED", Value: f.Value})
+	}
+	template, err := json.Marshal(tmpl)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	args := []string{}
+	for _, flag := range flags {
+		if flag != "" {
+			args = append(args, flag)
+		}
+	}
+	args = append(args, "item", "create", "--vault", item.Vault, "--title", item.Title, "--category", category, "--format", "json")
+	if generate {
+		args = append(args, "--generate-password")
+	}
+	return args, template, nil
+}
+
+// CreateItem shells out to `op item create` and returns the op://vault/title ref of the new item
+func (o OpCLI) CreateItem(ctx context.Context, item NewItem, flags []string) (string, error) {
+	args, template, err := createItemArgs(item, flags)
+	if err != nil {
+		return "", err
+	}
+
+	_, stderr, waited, err := o.run(ctx, args, template)
+	if err != nil {
+		return "", approvalRequired(fmt.Errorf("op item create failed: %w; stderr=%s", err, stderr), stderr, waited)
+	}
+	return "op://" + item.Vault + "/" + item.Title, nil
+}
+
 func WithTimeout(parent context.Context, d time.Duration) (context.Context, context.CancelFunc) {
 	if d <= 0 {
 		return parent, func() {}
@@ -0,0 +1,40 @@
+package backend
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/zach-source/opx/internal/util"
+)
+
+var (
+	opEnvMu    sync.RWMutex
+	opEnvExtra []string
+)
+
+// SetOpEnvPassthrough sets the variables op inherits on top of util.OpEnvPassthrough;
+// an exact name, a prefix ending in *, or * to pass the whole environment
+func SetOpEnvPassthrough(extra []string) {
+	opEnvMu.Lock()
+	defer opEnvMu.Unlock()
+	opEnvExtra = append([]string(nil), extra...)
+}
+
+// opEnviron builds op's environment from environ, or returns nil (inherit everything) for *
+func opEnviron(environ []string) []string {
+	opEnvMu.RLock()
+	defer opEnvMu.RUnlock()
+	if util.EnvPassesAll(opEnvExtra) {
+		return nil
+	}
+	return util.FilterEnv(environ, append(append([]string(nil), util.OpEnvPassthrough...), opEnvExtra...))
+}
+
+// opCommand is exec.CommandContext for op with the scrubbed environment
+func opCommand(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "op", args...)
+	cmd.Env = opEnviron(os.Environ())
+	return cmd
+}
@@ -0,0 +1,65 @@
+package backend
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// envNames returns the variable names of NAME=value entries
+func envNames(env []string) []string {
+	names := make([]string, 0, len(env))
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestOpEnviron(t *testing.T) {
+	defer SetOpEnvPassthrough(nil)
+	environ := []string{
+		"HOME=/home/me", "PATH=/usr/bin", "XDG_CONFIG_HOME=/home/me/.config", "LANG=en_US.UTF-8",
+		"OP_ACCOUNT=acme", "OP_SESSION_acme=stale", "AWS_SECRET_ACCESS_KEY=x", "HTTPS_PROXY=http://proxy", "AWS_PROFILE=dev",
+	}
+	tests := []struct {
+		name     string
+		extra    []string
+		expected []string
+	}{
+		{name: "defaults", expected: []string{"HOME", "PATH", "XDG_CONFIG_HOME", "LANG", "OP_ACCOUNT"}},
+		{name: "extra names and prefixes", extra: []string{"AWS_PROFILE", "OP_SESSION_*"}, expected: []string{"HOME", "PATH", "XDG_CONFIG_HOME", "LANG", "OP_ACCOUNT", "OP_SESSION_acme", "AWS_PROFILE"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetOpEnvPassthrough(tt.extra)
+			if got := envNames(opEnviron(environ)); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestOpCommand_Environment(t *testing.T) {
+	defer SetOpEnvPassthrough(nil)
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "x")
+	t.Setenv("OP_ACCOUNT", "acme")
+
+	cmd := opCommand(context.Background(), "whoami")
+	names := envNames(cmd.Env)
+	for _, name := range names {
+		if name == "AWS_SECRET_ACCESS_KEY" {
+			t.Errorf("Expected AWS_SECRET_ACCESS_KEY to be scrubbed, got %v", names)
+		}
+	}
+	if !strings.Contains(strings.Join(cmd.Env, "\n"), "OP_ACCOUNT=acme") {
+		t.Errorf("Expected OP_ACCOUNT to pass through, got %v", names)
+	}
+
+	SetOpEnvPassthrough([]string{"*"})
+	if cmd := opCommand(context.Background(), "whoami"); cmd.Env != nil {
+		t.Errorf("Expected * to inherit the whole environment, got %v", envNames(cmd.Env))
+	}
+}
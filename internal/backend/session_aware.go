@@ -2,13 +2,19 @@ package backend
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os/exec"
+	"strings"
 
 	"github.com/zach-source/opx/internal/session"
 )
 
-// SessionAwareBackend wraps another backend and adds session validation
+// ErrSessionInvalid is returned when the session is locked or could not be unlocked
+var ErrSessionInvalid = errors.New("session validation failed")
+
+// SessionAwareBackend wraps another backend and adds session validation. Activity
+// tracking is done by Instrument with SessionActivityHooks.
 type SessionAwareBackend struct {
 	backend Backend
 	session *session.Manager
@@ -27,6 +33,18 @@ func (s *SessionAwareBackend) Name() string {
 	return s.backend.Name() + "+session"
 }
 
+type backgroundReadKey struct{}
+
+// WithBackgroundRead marks ctx as a daemon-initiated read that must neither unlock nor extend the session
+func WithBackgroundRead(ctx context.Context) context.Context {
+	return context.WithValue(ctx, backgroundReadKey{}, true)
+}
+
+func isBackgroundRead(ctx context.Context) bool {
+	background, _ := ctx.Value(backgroundReadKey{}).(bool)
+	return background
+}
+
 // ReadRef reads a secret reference with session validation
 func (s *SessionAwareBackend) ReadRef(ctx context.Context, ref string) (string, error) {
 	return s.ReadRefWithFlags(ctx, ref, nil)
@@ -34,39 +52,161 @@ func (s *SessionAwareBackend) ReadRef(ctx context.Context, ref string) (string,
 
 // ReadRefWithFlags reads a secret reference with flags and session validation
 func (s *SessionAwareBackend) ReadRefWithFlags(ctx context.Context, ref string, flags []string) (string, error) {
-	// Validate session state before attempting to read secrets
-	if err := s.session.ValidateSession(ctx); err != nil {
-		return "", fmt.Errorf("session validation failed: %w", err)
+	if err := s.validate(ctx); err != nil {
+		return "", err
+	}
+	v, err := s.backend.ReadRefWithFlags(ctx, ref, flags)
+	if err == nil {
+		s.countReads(ctx, 1)
 	}
+	return v, err
+}
 
-	// Perform the actual read operation
-	value, err := s.backend.ReadRefWithFlags(ctx, ref, flags)
-	if err != nil {
-		return "", err
+// ReadRefWithContext reads a secret reference with its metadata and session validation
+func (s *SessionAwareBackend) ReadRefWithContext(ctx context.Context, ref string, flags []string) (SecretResult, error) {
+	if err := s.validate(ctx); err != nil {
+		return SecretResult{}, err
+	}
+	return ReadResult(ctx, s.backend, ref, flags)
+}
+
+// ReadItemFields reads several fields of one item with session validation
+func (s *SessionAwareBackend) ReadItemFields(ctx context.Context, vault, item string, fields []string, flags []string) (map[string]string, error) {
+	reader, ok := s.backend.(ItemFieldsReader)
+	if !ok {
+		return nil, ErrItemFieldsUnsupported
+	}
+	if err := s.validate(ctx); err != nil {
+		return nil, err
+	}
+	values, err := reader.ReadItemFields(ctx, vault, item, fields, flags)
+	if err == nil {
+		s.countReads(ctx, len(values))
+	}
+	return values, err
+}
+
+// countReads counts successful client reads toward the session's use count
+// limit; background refreshes serve no client, so they don't count
+func (s *SessionAwareBackend) countReads(ctx context.Context, n int) {
+	if !isBackgroundRead(ctx) {
+		s.session.CountReads(n)
+	}
+}
+
+// validate checks the session before a read; background reads only run against
+// an already-authenticated session
+func (s *SessionAwareBackend) validate(ctx context.Context) error {
+	if isBackgroundRead(ctx) {
+		if state := s.session.GetInfo().State; !state.IsActive() {
+			return fmt.Errorf("%w: session is %s", ErrSessionInvalid, state)
+		}
+	} else if err := s.session.ValidateSession(ctx); err != nil {
+		return fmt.Errorf("%w: %w", ErrSessionInvalid, err)
+	}
+	return nil
+}
+
+// CreateItem creates an item through the wrapped backend with session validation
+func (s *SessionAwareBackend) CreateItem(ctx context.Context, item NewItem, flags []string) (string, error) {
+	creator, ok := s.backend.(ItemCreator)
+	if !ok {
+		return "", ErrCreateUnsupported
+	}
+	if err := s.session.ValidateSession(ctx); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrSessionInvalid, err)
 	}
 
-	// Update activity timestamp on successful operation
-	s.session.UpdateActivity()
+	return creator.CreateItem(ctx, item, flags)
+}
 
-	return value, nil
+// Unwrap returns the backend behind session validation
+func (s *SessionAwareBackend) Unwrap() Backend {
+	return s.backend
 }
 
 // ValidateCurrentSession checks if the current 1Password CLI session is valid
 // This is used as the unlock callback for session validation
 func ValidateCurrentSession(ctx context.Context) error {
-	// Use `op whoami` to check if there's an active session
-	cmd := exec.CommandContext(ctx, "op", "whoami")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("1Password CLI session invalid or expired: %w", err)
+	_, err := CurrentAccount(ctx, "")
+	return err
+}
+
+// whoami is the JSON `op whoami --format json` prints
+type whoami struct {
+	URL         string `json:"url"`
+	Email       string `json:"email"`
+	UserUUID    string `json:"user_uuid"`
+	AccountUUID string `json:"account_uuid"`
+}
+
+// runWhoami runs `op whoami --format json`; a var so tests can stub the CLI
+var runWhoami = func(ctx context.Context) ([]byte, error) {
+	return opCommand(ctx, "whoami", "--format", "json").Output()
+}
+
+// parseWhoami reads the account from whoami output
+func parseWhoami(out []byte) (session.Account, error) {
+	var w whoami
+	if err := json.Unmarshal(out, &w); err != nil {
+		return session.Account{}, fmt.Errorf("failed to parse op whoami output: %w", err)
+	}
+	if w.AccountUUID == "" && w.Email == "" {
+		return session.Account{}, errors.New("op whoami output names no account")
+	}
+	return session.Account{UUID: w.AccountUUID, Email: w.Email, URL: w.URL}, nil
+}
+
+// accountMatches reports whether expected names account by UUID, email, sign-in URL or its host
+func accountMatches(account session.Account, expected string) bool {
+	host := strings.TrimSuffix(strings.TrimPrefix(account.URL, "https://"), "/")
+	for _, id := range []string{account.UUID, account.Email, account.URL, host} {
+		if id != "" && strings.EqualFold(id, expected) {
+			return true
+		}
+	}
+	return false
+}
+
+// CurrentAccount checks the 1Password CLI session with `op whoami` and returns
+// its account. With expected set, a session on any other account is an error,
+// as is output that can't be parsed; without it the account is best effort.
+func CurrentAccount(ctx context.Context, expected string) (session.Account, error) {
+	out, err := runWhoami(ctx)
+	if err != nil {
+		return session.Account{}, fmt.Errorf("1Password CLI session invalid or expired: %w", err)
+	}
+	account, err := parseWhoami(out)
+	if err != nil {
+		if expected != "" {
+			return session.Account{}, fmt.Errorf("cannot confirm the session is on account %s: %w", expected, err)
+		}
+		return session.Account{}, nil
+	}
+	if expected != "" && !accountMatches(account, expected) {
+		return account, fmt.Errorf("1Password CLI is signed in to %s, not the expected account %s", account, expected)
+	}
+	return account, nil
+}
+
+// SessionValidator is an unlock callback that checks the CLI session with
+// `op whoami`, records its account on m and rejects any account but expected
+// ("" accepts any)
+func SessionValidator(m *session.Manager, expected string) session.UnlockCallback {
+	return func(ctx context.Context) error {
+		account, err := CurrentAccount(ctx, expected)
+		if account != (session.Account{}) {
+			m.SetAccount(account)
+		}
+		return err
 	}
-	return nil
 }
 
 // ClearCLISession clears the current 1Password CLI session
 // This is used as the lock callback to secure secrets when session locks
 func ClearCLISession() error {
 	// Use `op signout --forget` to clear the session
-	cmd := exec.Command("op", "signout", "--forget")
+	cmd := opCommand(context.Background(), "signout", "--forget")
 	if err := cmd.Run(); err != nil {
 		// Don't return error if signout fails - session might already be cleared
 		// Just log that we attempted to clear it
@@ -76,11 +216,11 @@ func ClearCLISession() error {
 }
 
 // NewSessionAwareOpCLI creates a new OpCLI backend with session management
-func NewSessionAwareOpCLI(sessionManager *session.Manager) Backend {
+func NewSessionAwareOpCLI(sessionManager *session.Manager, op OpCLI) Backend {
 	// Set up session callbacks
-	sessionManager.SetCallbacks(ClearCLISession, ValidateCurrentSession)
+	sessionManager.SetCallbacks(ClearCLISession, SessionValidator(sessionManager, ""))
 
-	return NewSessionAwareBackend(OpCLI{}, sessionManager)
+	return NewSessionAwareBackend(op, sessionManager)
 }
 
 // NewSessionAwareFake creates a new Fake backend with session management for testing
@@ -1,15 +1,52 @@
 package backend
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+// defaultTokenHeader is the header Vault (and API-compatible servers) expect the token in
+const defaultTokenHeader = "X-Vault-Token"
+
+// APIPaths are the endpoints a Vault-compatible server is called on. Empty
+// fields keep Vault's layout, so OpenBao can diverge one endpoint at a time.
+type APIPaths struct {
+	Prefix      string `json:"prefix,omitempty"`       // API prefix (default: /v1)
+	Mount       string `json:"mount,omitempty"`        // Prepended to every ref path, e.g. "secret/data" (default: none)
+	Health      string `json:"health,omitempty"`       // Health endpoint (default: sys/health)
+	TokenLookup string `json:"token_lookup,omitempty"` // Token verification (default: auth/token/lookup-self)
+	TokenRenew  string `json:"token_renew,omitempty"`  // Token renewal (default: auth/token/renew-self)
+}
+
+// withDefaults fills empty fields with Vault's endpoints
+func (p APIPaths) withDefaults() APIPaths {
+	if p.Prefix = strings.Trim(p.Prefix, "/"); p.Prefix == "" {
+		p.Prefix = "v1"
+	}
+	p.Prefix = "/" + p.Prefix
+	p.Mount = strings.Trim(p.Mount, "/")
+	if p.Health == "" {
+		p.Health = "sys/health"
+	}
+	if p.TokenLookup == "" {
+		p.TokenLookup = "auth/token/lookup-self"
+	}
+	if p.TokenRenew == "" {
+		p.TokenRenew = "auth/token/renew-self"
+	}
+	return p
+}
+
 // VaultConfig holds Vault/Bao connection configuration
 type VaultConfig struct {
 	Address    string        `json:"address"`     // Vault server address
@@ -17,13 +54,29 @@ type VaultConfig struct {
 	AuthPath   string        `json:"auth_path"`   // Authentication path (e.g., "auth/userpass")
 	AuthMethod string        `json:"auth_method"` // Authentication method ("userpass", "token", etc.)
 	Token      string        `json:"-"`           // Current auth token (runtime only)
-	TokenTTL   time.Duration `json:"-"`           // Token expiration (runtime only)
+	TokenTTL   time.Duration `json:"-"`           // Lease duration of the current token (runtime only)
+	// TokenExpiry is when the current token's lease ends; zero means no lease (runtime only)
+	TokenExpiry time.Time `json:"-"`
 }
 
 // Vault backend for HashiCorp Vault
 type Vault struct {
-	config VaultConfig
-	client *http.Client
+	config      VaultConfig
+	client      *http.Client
+	tokenHeader string
+	paths       APIPaths
+	scheme      string       // ref scheme, without "://"
+	mu          sync.RWMutex // guards config.Token, config.TokenTTL and config.TokenExpiry
+	// clock overrides time.Now for lease checks in tests
+	clock func() time.Time
+}
+
+// now returns the current time from clock, or time.Now when unset
+func (v *Vault) now() time.Time {
+	if v.clock != nil {
+		return v.clock()
+	}
+	return time.Now()
 }
 
 // NewVault creates a new Vault backend with the given configuration
@@ -33,7 +86,43 @@ func NewVault(config VaultConfig) *Vault {
 		client: &http.Client{
 			Timeout: 10 * time.Second,
 		},
+		tokenHeader: defaultTokenHeader,
+		paths:       APIPaths{}.withDefaults(),
+		scheme:      "vault",
+	}
+}
+
+// apiURL is the address of an API endpoint under the configured prefix
+func (v *Vault) apiURL(endpoint string) string {
+	return v.config.Address + v.paths.Prefix + "/" + strings.TrimPrefix(endpoint, "/")
+}
+
+// Ping checks Vault's health endpoint; active (200), standby (429) and
+// performance standby (473) nodes are healthy
+func (v *Vault) Ping(ctx context.Context) error {
+	return v.ping(ctx, v.apiURL(v.paths.Health), "vault", http.StatusOK, http.StatusTooManyRequests, 473)
+}
+
+// ping GETs a health URL, naming the server in errors; healthy lists the status codes that pass
+func (v *Vault) ping(ctx context.Context, url, server string, healthy ...int) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	if v.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.config.Namespace)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s health check failed: %w", server, err)
+	}
+	defer resp.Body.Close()
+
+	if slices.Contains(healthy, resp.StatusCode) {
+		return nil
 	}
+	return fmt.Errorf("%s health check returned status %d", server, resp.StatusCode)
 }
 
 func (v *Vault) Name() string {
@@ -47,60 +136,108 @@ func (v *Vault) ReadRef(ctx context.Context, ref string) (string, error) {
 
 // ReadRefWithFlags reads a secret from Vault with optional flags
 func (v *Vault) ReadRefWithFlags(ctx context.Context, ref string, flags []string) (string, error) {
-	// Parse vault:// URI
-	vaultPath, field, err := parseVaultURI(ref)
+	return v.readRef(ctx, ref, flags, v.login)
+}
+
+// ReadRefWithContext reads a secret from Vault with its lease, KV version and when that version was written
+func (v *Vault) ReadRefWithContext(ctx context.Context, ref string, flags []string) (SecretResult, error) {
+	return v.readResult(ctx, ref, flags, v.login)
+}
+
+// login authenticates with the configured method, wrapping failures for Vault
+func (v *Vault) login(ctx context.Context) error {
+	if err := v.authenticate(ctx); err != nil {
+		return fmt.Errorf("vault authentication failed: %w", err)
+	}
+	return nil
+}
+
+// readRef reads a vault:// ref, calling login when no usable token is held
+func (v *Vault) readRef(ctx context.Context, ref string, flags []string, login func(context.Context) error) (string, error) {
+	result, err := v.readResult(ctx, ref, flags, login)
+	return result.Value, err
+}
+
+// readResult reads a vault:// ref with its metadata, calling login when no usable token is held
+func (v *Vault) readResult(ctx context.Context, ref string, flags []string, login func(context.Context) error) (SecretResult, error) {
+	vaultPath, field, err := parseSecretURI(ref, v.scheme)
 	if err != nil {
-		return "", fmt.Errorf("invalid vault reference %s: %w", ref, err)
+		return SecretResult{}, fmt.Errorf("invalid %s reference %s: %w", v.scheme, ref, err)
 	}
 
 	// Ensure we have a valid authentication token
-	if err := v.ensureAuthenticated(ctx); err != nil {
-		return "", fmt.Errorf("vault authentication failed: %w", err)
+	if err := v.ensureAuthenticated(ctx, login); err != nil {
+		return SecretResult{}, err
 	}
 
 	// Read the secret from Vault
 	secret, err := v.readSecret(ctx, vaultPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to read vault secret: %w", err)
+		return SecretResult{}, fmt.Errorf("failed to read vault secret: %w", err)
 	}
+	result := secret.result()
 
 	// Extract the specific field if specified
 	if field != "" {
 		if data, ok := secret.Data["data"].(map[string]interface{}); ok {
 			if value, exists := data[field]; exists {
 				if str, ok := value.(string); ok {
-					return str, nil
+					result.Value = str
+				} else {
+					result.Value = fmt.Sprintf("%v", value)
 				}
-				return fmt.Sprintf("%v", value), nil
+				return result, nil
 			}
-			return "", fmt.Errorf("field %s not found in secret", field)
+			return SecretResult{}, NotFound(fmt.Errorf("field %s not found in secret", field))
 		}
-		return "", fmt.Errorf("secret does not contain data field")
+		return SecretResult{}, fmt.Errorf("secret does not contain data field")
 	}
 
 	// If no specific field requested, return JSON representation
 	data, err := json.Marshal(secret.Data)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal secret data: %w", err)
+		return SecretResult{}, fmt.Errorf("failed to marshal secret data: %w", err)
 	}
-
-	return string(data), nil
+	result.Value = string(data)
+	return result, nil
 }
 
 // VaultSecret represents a Vault secret response
 type VaultSecret struct {
 	Data     map[string]interface{} `json:"data"`
 	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	// LeaseDuration is the response's lease, outside its data (0 = none)
+	LeaseDuration time.Duration `json:"-"`
+}
+
+// result is the secret's metadata without a value: its lease, and the KV v2
+// version and when it was created
+func (s *VaultSecret) result() SecretResult {
+	result := SecretResult{TTL: s.LeaseDuration}
+	if version, ok := s.Metadata["version"].(float64); ok {
+		result.Version = strconv.FormatFloat(version, 'f', -1, 64)
+	}
+	if created, ok := s.Metadata["created_time"].(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, created); err == nil {
+			result.UpdatedAt = t
+		}
+	}
+	return result
 }
 
 // parseVaultURI parses a vault:// URI into path and field components
 func parseVaultURI(ref string) (path, field string, err error) {
-	if !strings.HasPrefix(ref, "vault://") {
-		return "", "", fmt.Errorf("reference must start with vault://")
+	return parseSecretURI(ref, "vault")
+}
+
+// parseSecretURI parses a scheme:// URI into path and field components
+func parseSecretURI(ref, scheme string) (path, field string, err error) {
+	prefix := scheme + "://"
+	if !strings.HasPrefix(ref, prefix) {
+		return "", "", fmt.Errorf("reference must start with %s", prefix)
 	}
 
-	// Remove vault:// prefix
-	trimmed := strings.TrimPrefix(ref, "vault://")
+	trimmed := strings.TrimPrefix(ref, prefix)
 
 	// Split on # to separate path from field
 	parts := strings.SplitN(trimmed, "#", 2)
@@ -111,21 +248,32 @@ func parseVaultURI(ref string) (path, field string, err error) {
 	}
 
 	if path == "" {
-		return "", "", fmt.Errorf("vault path cannot be empty")
+		return "", "", fmt.Errorf("%s path cannot be empty", scheme)
 	}
 
 	return path, field, nil
 }
 
-// ensureAuthenticated ensures we have a valid Vault token
-func (v *Vault) ensureAuthenticated(ctx context.Context) error {
-	// Check if current token is still valid
-	if v.config.Token != "" && time.Now().Before(time.Now().Add(v.config.TokenTTL)) {
-		return nil
+// ensureAuthenticated keeps a usable token: it renews once less than a third of
+// the lease remains and calls login when there is no token or renewal fails
+func (v *Vault) ensureAuthenticated(ctx context.Context, login func(context.Context) error) error {
+	v.mu.RLock()
+	token, ttl, expiry := v.config.Token, v.config.TokenTTL, v.config.TokenExpiry
+	v.mu.RUnlock()
+
+	if token != "" {
+		now := v.now()
+		// Tokens without a lease (e.g. root tokens) don't expire
+		if expiry.IsZero() || now.Before(expiry.Add(-ttl/3)) {
+			return nil
+		}
+		if now.Before(expiry) && v.RenewToken(ctx) == nil {
+			return nil
+		}
 	}
 
-	// Token expired or missing, need to authenticate
-	return v.authenticate(ctx)
+	// Token missing, expired or not renewable: log in again
+	return login(ctx)
 }
 
 // authenticate performs Vault authentication
@@ -136,6 +284,8 @@ func (v *Vault) authenticate(ctx context.Context) error {
 		return v.verifyToken(ctx)
 	case "userpass":
 		return v.authenticateUserpass(ctx)
+	case "approle":
+		return v.authenticateAppRole(ctx)
 	default:
 		return fmt.Errorf("authentication method %s not yet implemented", v.config.AuthMethod)
 	}
@@ -148,17 +298,113 @@ func (v *Vault) authenticateUserpass(ctx context.Context) error {
 	return fmt.Errorf("userpass authentication requires environment variables VAULT_USERNAME and VAULT_PASSWORD")
 }
 
-// verifyToken checks if the current token is valid
-func (v *Vault) verifyToken(ctx context.Context) error {
-	req, err := http.NewRequestWithContext(ctx, "GET", v.config.Address+"/v1/auth/token/lookup-self", nil)
+// authenticateAppRole logs in with an AppRole role_id/secret_id pair taken from the environment
+func (v *Vault) authenticateAppRole(ctx context.Context) error {
+	roleID := os.Getenv("VAULT_ROLE_ID")
+	secretID := os.Getenv("VAULT_SECRET_ID")
+	if roleID == "" || secretID == "" {
+		return fmt.Errorf("approle authentication requires environment variables VAULT_ROLE_ID and VAULT_SECRET_ID")
+	}
+
+	authPath := strings.Trim(v.config.AuthPath, "/")
+	if authPath == "" {
+		authPath = "auth/approle"
+	}
+
+	body, err := json.Marshal(map[string]string{"role_id": roleID, "secret_id": secretID})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", v.apiURL(authPath+"/login"), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if v.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.config.Namespace)
+	}
+
+	return v.doAuthRequest(req, "approle login")
+}
+
+// RenewToken extends the lease of the current token via auth/token/renew-self
+func (v *Vault) RenewToken(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", v.apiURL(v.paths.TokenRenew), bytes.NewReader([]byte("{}")))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	v.setHeaders(req)
+
+	return v.doAuthRequest(req, "token renewal")
+}
+
+// doAuthRequest executes a request returning an auth block and stores the resulting token
+func (v *Vault) doAuthRequest(req *http.Request, action string) error {
+	resp, err := v.client.Do(req)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s failed with status %d: %s", action, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var authResp struct {
+		Auth *struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int    `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", action, err)
+	}
+	if authResp.Auth == nil || authResp.Auth.ClientToken == "" {
+		return fmt.Errorf("%s response missing auth token", action)
+	}
+
+	ttl := time.Duration(authResp.Auth.LeaseDuration) * time.Second
+	var expiry time.Time
+	if ttl > 0 {
+		expiry = v.now().Add(ttl)
+	}
+
+	v.mu.Lock()
+	v.config.Token = authResp.Auth.ClientToken
+	v.config.TokenTTL = ttl
+	v.config.TokenExpiry = expiry
+	v.mu.Unlock()
 
-	req.Header.Set("X-Vault-Token", v.config.Token)
+	return nil
+}
+
+// setHeaders adds the token and namespace headers to an outgoing request
+func (v *Vault) setHeaders(req *http.Request) {
+	v.mu.RLock()
+	token := v.config.Token
+	v.mu.RUnlock()
+
+	header := v.tokenHeader
+	if header == "" {
+		header = defaultTokenHeader
+	}
+	req.Header.Set(header, token)
 	if v.config.Namespace != "" {
 		req.Header.Set("X-Vault-Namespace", v.config.Namespace)
 	}
+}
+
+// verifyToken checks if the current token is valid
+func (v *Vault) verifyToken(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", v.apiURL(v.paths.TokenLookup), nil)
+	if err != nil {
+		return err
+	}
+
+	v.setHeaders(req)
 
 	resp, err := v.client.Do(req)
 	if err != nil {
@@ -175,17 +421,16 @@ func (v *Vault) verifyToken(ctx context.Context) error {
 
 // readSecret reads a secret from the specified Vault path
 func (v *Vault) readSecret(ctx context.Context, path string) (*VaultSecret, error) {
-	// Construct Vault API URL
-	apiPath := "/v1/" + path
-	req, err := http.NewRequestWithContext(ctx, "GET", v.config.Address+apiPath, nil)
+	endpoint := path
+	if v.paths.Mount != "" {
+		endpoint = v.paths.Mount + "/" + path
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", v.apiURL(endpoint), nil)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("X-Vault-Token", v.config.Token)
-	if v.config.Namespace != "" {
-		req.Header.Set("X-Vault-Namespace", v.config.Namespace)
-	}
+	v.setHeaders(req)
 
 	resp, err := v.client.Do(req)
 	if err != nil {
@@ -194,7 +439,7 @@ func (v *Vault) readSecret(ctx context.Context, path string) (*VaultSecret, erro
 	defer resp.Body.Close()
 
 	if resp.StatusCode == 404 {
-		return nil, fmt.Errorf("secret not found at path %s", path)
+		return nil, NotFound(fmt.Errorf("secret not found at path %s", path))
 	}
 
 	if resp.StatusCode != 200 {
@@ -203,7 +448,8 @@ func (v *Vault) readSecret(ctx context.Context, path string) (*VaultSecret, erro
 	}
 
 	var vaultResp struct {
-		Data *VaultSecret `json:"data"`
+		Data          *VaultSecret `json:"data"`
+		LeaseDuration int          `json:"lease_duration"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&vaultResp); err != nil {
@@ -214,38 +460,6 @@ func (v *Vault) readSecret(ctx context.Context, path string) (*VaultSecret, erro
 		return nil, fmt.Errorf("vault response missing data field")
 	}
 
+	vaultResp.Data.LeaseDuration = time.Duration(vaultResp.LeaseDuration) * time.Second
 	return vaultResp.Data, nil
 }
-
-// Bao backend for OpenBao (same as Vault but different name)
-type Bao struct {
-	*Vault
-}
-
-// NewBao creates a new Bao backend (same as Vault)
-func NewBao(config VaultConfig) *Bao {
-	return &Bao{
-		Vault: NewVault(config),
-	}
-}
-
-func (b *Bao) Name() string {
-	return "bao"
-}
-
-// ReadRef reads a secret from Bao using bao:// URI scheme
-func (b *Bao) ReadRef(ctx context.Context, ref string) (string, error) {
-	// Convert bao:// to vault:// for processing
-	if strings.HasPrefix(ref, "bao://") {
-		ref = "vault://" + strings.TrimPrefix(ref, "bao://")
-	}
-	return b.Vault.ReadRef(ctx, ref)
-}
-
-func (b *Bao) ReadRefWithFlags(ctx context.Context, ref string, flags []string) (string, error) {
-	// Convert bao:// to vault:// for processing
-	if strings.HasPrefix(ref, "bao://") {
-		ref = "vault://" + strings.TrimPrefix(ref, "bao://")
-	}
-	return b.Vault.ReadRefWithFlags(ctx, ref, flags)
-}
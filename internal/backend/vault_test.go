@@ -165,7 +165,10 @@ func TestMultiBackend_GetBackendForRef(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			backend := multi.getBackendForRef(tt.ref)
+			backend, err := multi.getBackendForRef(tt.ref)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
 			if backend != tt.expectedBackend {
 				t.Errorf("Expected backend %T, got %T", tt.expectedBackend, backend)
 			}
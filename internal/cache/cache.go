@@ -1,17 +1,47 @@
 package cache
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
 	"github.com/zach-source/opx/internal/safestring"
+	"github.com/zach-source/opx/internal/util"
 )
 
+// ErrTombstone is returned by Set when the key was soft-deleted and its tombstone has not expired
+var ErrTombstone = errors.New("cache key has been deleted")
+
+// ErrValueTooLarge is returned by Set for values over the SetMaxValueBytes limit
+var ErrValueTooLarge = errors.New("value is larger than the cache's value size limit")
+
 type entry struct {
-	v      *safestring.SafeString
-	exp    time.Time
-	cached time.Time
+	v         *safestring.SafeString
+	exp       time.Time
+	cached    time.Time
+	tombstone bool
+	access    *accessStats
+	hash      [sha256.Size]byte // value fingerprint, set with SetTrackChanges or by Checksum
+	// version and updatedAt are what the backend reported about the value, if anything
+	version   string
+	updatedAt time.Time
+}
+
+// accessStats tracks how hot an entry is; shared across value refreshes of the same key
+type accessStats struct {
+	last  atomic.Int64 // unix nanos of the most recent hit
+	count atomic.Int64
+}
+
+func (a *accessStats) touch(now time.Time) {
+	a.last.Store(now.UnixNano())
+	a.count.Add(1)
 }
 
 type Cache struct {
@@ -21,38 +51,343 @@ type Cache struct {
 	hits     int64
 	misses   int64
 	inflight int
+	// trackChanges keeps a SHA-256 of each value so Refresh can report rotations
+	trackChanges bool
+	// maxValueBytes is the largest value Set and Refresh store (0 = no limit)
+	maxValueBytes int64
+
+	// Expiry statistics: reads that found an entry past its TTL, entries
+	// removed by CleanupExpired and when it last ran
+	expiredHits    int64
+	cleanupRemoved int64
+	lastCleanup    time.Time
+
+	// clock decides when entries expire; tests swap in a util.ManualClock
+	clock util.Clock
 }
 
 func New(ttl time.Duration) *Cache {
 	return &Cache{
-		data: make(map[string]entry),
-		ttl:  ttl,
+		data:  make(map[string]entry),
+		ttl:   ttl,
+		clock: util.RealClock{},
+	}
+}
+
+// SetClock replaces the time source used for expiry and access times
+func (c *Cache) SetClock(clock util.Clock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clock = clock
+}
+
+// SetTrackChanges enables keeping a hash of each value so Refresh can tell when it changed
+func (c *Cache) SetTrackChanges(on bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.trackChanges = on
+}
+
+// SetMaxValueBytes limits the size of values the cache stores (0 = no limit).
+// Entries already over a lowered limit are zeroed and removed.
+func (c *Cache) SetMaxValueBytes(limit int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxValueBytes = max(limit, 0)
+	for key, e := range c.data {
+		if c.tooLarge(e.v.Len()) {
+			e.v.Zero()
+			delete(c.data, key)
+		}
+	}
+}
+
+// MaxValueBytes returns the value size limit (0 = no limit)
+func (c *Cache) MaxValueBytes() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.maxValueBytes
+}
+
+// tooLarge reports whether a value of size bytes is over the limit; the caller holds c.mu
+func (c *Cache) tooLarge(size int) bool {
+	return c.maxValueBytes > 0 && int64(size) > c.maxValueBytes
+}
+
+// fingerprint hashes val when change tracking is on
+func (c *Cache) fingerprint(val string) [sha256.Size]byte {
+	if !c.trackChanges {
+		return [sha256.Size]byte{}
+	}
+	return sha256.Sum256([]byte(val))
+}
+
+// Checksum returns the hex SHA-256 of a live entry's value, hashing it on first
+// use and keeping the hash with the entry until its value is replaced
+func (c *Cache) Checksum(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.data[key]
+	if !ok || e.tombstone || c.clock.Now().After(e.exp) {
+		return "", false
 	}
+	if e.hash == ([sha256.Size]byte{}) {
+		e.v.Use(func(b []byte) { e.hash = sha256.Sum256(b) })
+		c.data[key] = e
+	}
+	return hex.EncodeToString(e.hash[:]), true
+}
+
+// Meta is when a cached value was stored and when it expires, and the version
+// and update time its backend reported (empty when unknown)
+type Meta struct {
+	CachedAt  time.Time
+	ExpiresAt time.Time
+	Version   string
+	UpdatedAt time.Time
+}
+
+// Source is what a backend reported about a value: how long it stays valid
+// (0 = unknown) and which version it is
+type Source struct {
+	TTL       time.Duration
+	Version   string
+	UpdatedAt time.Time
 }
 
 func (c *Cache) Get(key string) (string, bool, time.Time, time.Time) {
+	v, meta, ok := c.GetMeta(key)
+	return v, ok, meta.ExpiresAt, meta.CachedAt
+}
+
+// GetMeta returns a live value with when it was cached and expires, counting an access
+func (c *Cache) GetMeta(key string) (string, Meta, bool) {
 	c.mu.RLock()
 	e, ok := c.data[key]
+	clock := c.clock
 	c.mu.RUnlock()
-	if !ok || time.Now().After(e.exp) {
-		if ok {
-			// treat expired as miss
+	// Expired entries and tombstones are treated as misses
+	now := clock.Now()
+	if ok && !e.tombstone && now.After(e.exp) {
+		c.removeExpired(key, now)
+		return "", Meta{}, false
+	}
+	if !ok || e.tombstone {
+		return "", Meta{}, false
+	}
+	e.access.touch(now)
+	return e.v.String(), Meta{CachedAt: e.cached, ExpiresAt: e.exp, Version: e.version, UpdatedAt: e.updatedAt}, true
+}
+
+// baseRef strips the "|..." signature the server appends to keys of typed or flagged reads
+func baseRef(key string) string {
+	if i := strings.LastIndexByte(key, '|'); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+// removeExpired zeroes and deletes key if it is still expired, counting an expired hit
+func (c *Cache) removeExpired(key string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expiredHits++
+	if e, ok := c.data[key]; ok && !e.tombstone && now.After(e.exp) {
+		e.v.Zero()
+		delete(c.data, key)
+	}
+}
+
+// Set stores a value, returning ErrTombstone if the key or the ref it was read
+// from is soft-deleted and ErrValueTooLarge if val is over the size limit
+func (c *Cache) Set(key, val string) error {
+	return c.SetFrom(key, val, Source{})
+}
+
+// SetFrom stores a value like Set with its backend's metadata, expiring it when
+// the backend's TTL runs out if that is sooner than the cache TTL
+func (c *Cache) SetFrom(key, val string, src Source) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.tooLarge(len(val)) {
+		return ErrValueTooLarge
+	}
+	now := c.clock.Now()
+	if base := baseRef(key); base != key {
+		if e, ok := c.data[base]; ok && e.tombstone && now.Before(e.exp) {
+			return ErrTombstone
+		}
+	}
+
+	// Zero any existing entry before replacing; access history carries over
+	access := &accessStats{}
+	if existing, exists := c.data[key]; exists {
+		if existing.tombstone && now.Before(existing.exp) {
+			return ErrTombstone
+		}
+		existing.v.Zero()
+		if existing.access != nil {
+			access = existing.access
 		}
-		return "", false, time.Time{}, time.Time{}
 	}
-	return e.v.String(), true, e.exp, e.cached
+
+	access.touch(now) // the read that populated the entry counts as an access
+	ttl := c.ttl
+	if src.TTL > 0 {
+		ttl = min(ttl, src.TTL)
+	}
+	c.data[key] = entry{v: safestring.New(val), exp: now.Add(ttl), cached: now, access: access, hash: c.fingerprint(val), version: src.Version, updatedAt: src.UpdatedAt}
+	return nil
+}
+
+// Refresh replaces the value of a live entry and restarts its TTL without counting
+// an access; a TTL shortened by SetFrom stays as short, and the backend's
+// version is dropped. It reports false (and stores nothing) if the key was removed,
+// cleared or soft-deleted in the meantime, or if val is over the size limit, in
+// which case the old value is removed too. With SetTrackChanges, changed
+// reports whether val differs from the value it replaced.
+func (c *Cache) Refresh(key, val string) (refreshed, changed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	existing, exists := c.data[key]
+	if !exists || existing.tombstone {
+		return false, false
+	}
+	existing.v.Zero()
+	if c.tooLarge(len(val)) {
+		delete(c.data, key)
+		return false, false
+	}
+
+	now := c.clock.Now()
+	hash := c.fingerprint(val)
+	ttl := min(c.ttl, existing.exp.Sub(existing.cached))
+	c.data[key] = entry{v: safestring.New(val), exp: now.Add(ttl), cached: now, access: existing.access, hash: hash}
+	return true, c.trackChanges && existing.hash != [sha256.Size]byte{} && hash != existing.hash
+}
+
+// ExpiringEntry describes a live cache entry without its value
+type ExpiringEntry struct {
+	Key       string
+	ExpiresAt time.Time
+	CachedAt  time.Time
+}
+
+// Expiring returns live entries that expire before expiresBefore, soonest first.
+// Unlike Get it does not count as an access.
+func (c *Cache) Expiring(expiresBefore time.Time) []ExpiringEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := c.clock.Now()
+	var out []ExpiringEntry
+	for key, e := range c.data {
+		if e.tombstone || now.After(e.exp) || !e.exp.Before(expiresBefore) {
+			continue
+		}
+		out = append(out, ExpiringEntry{Key: key, ExpiresAt: e.exp, CachedAt: e.cached})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].ExpiresAt.Equal(out[j].ExpiresAt) {
+			return out[i].ExpiresAt.Before(out[j].ExpiresAt)
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out
+}
+
+// HotKeys returns up to limit live keys that were read at or after accessedSince
+// and expire before expiresBefore, most frequently read first
+func (c *Cache) HotKeys(accessedSince, expiresBefore time.Time, limit int) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	type hot struct {
+		key   string
+		count int64
+	}
+	now := c.clock.Now()
+	var candidates []hot
+	for key, e := range c.data {
+		if e.tombstone || now.After(e.exp) || !e.exp.Before(expiresBefore) {
+			continue
+		}
+		if time.Unix(0, e.access.last.Load()).Before(accessedSince) {
+			continue
+		}
+		candidates = append(candidates, hot{key: key, count: e.access.count.Load()})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].count != candidates[j].count {
+			return candidates[i].count > candidates[j].count
+		}
+		return candidates[i].key < candidates[j].key
+	})
+	if limit > 0 && len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	keys := make([]string, len(candidates))
+	for i, h := range candidates {
+		keys[i] = h.key
+	}
+	return keys
 }
 
-func (c *Cache) Set(key, val string) {
+// SoftDelete zeroes any cached value for key and leaves a tombstone that blocks
+// re-caching until tombstoneTTL elapses. A non-positive TTL just removes the entry.
+func (c *Cache) SoftDelete(key string, tombstoneTTL time.Duration) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	// Zero any existing entry before replacing
 	if existing, exists := c.data[key]; exists {
 		existing.v.Zero()
+		delete(c.data, key)
 	}
+	if tombstoneTTL <= 0 {
+		return
+	}
+
+	now := c.clock.Now()
+	c.data[key] = entry{v: safestring.New(""), exp: now.Add(tombstoneTTL), cached: now, tombstone: true, access: &accessStats{}}
+}
+
+// Has reports whether key holds a live value, without counting an access
+func (c *Cache) Has(key string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, ok := c.data[key]
+	return ok && !e.tombstone && c.clock.Now().Before(e.exp)
+}
 
-	c.data[key] = entry{v: safestring.New(val), exp: time.Now().Add(c.ttl), cached: time.Now()}
+// Tombstoned reports whether key is currently soft-deleted
+func (c *Cache) Tombstoned(key string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, ok := c.data[key]
+	return ok && e.tombstone && c.clock.Now().Before(e.exp)
+}
+
+// RemovePrefix zeroes and removes all non-tombstone entries whose key starts with prefix
+func (c *Cache) RemovePrefix(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for key, entry := range c.data {
+		if entry.tombstone || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		entry.v.Zero()
+		delete(c.data, key)
+		removed++
+	}
+	return removed
 }
 
 func (c *Cache) Stats() (size int, hits, misses int64, inflight int) {
@@ -61,6 +396,31 @@ func (c *Cache) Stats() (size int, hits, misses int64, inflight int) {
 	return len(c.data), c.hits, c.misses, c.inflight
 }
 
+// ValueStats reports the largest live value and the approximate bytes held by
+// live entries, counting each key and value
+func (c *Cache) ValueStats() (largest int, total int64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := c.clock.Now()
+	for key, e := range c.data {
+		if e.tombstone || now.After(e.exp) {
+			continue
+		}
+		size := e.v.Len()
+		largest = max(largest, size)
+		total += int64(len(key) + size)
+	}
+	return largest, total
+}
+
+// ExpiryStats reports reads that found an expired entry, the total removed by
+// CleanupExpired and when it last ran (zero if never)
+func (c *Cache) ExpiryStats() (expiredHits, cleanupRemoved int64, lastCleanup time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.expiredHits, c.cleanupRemoved, c.lastCleanup
+}
+
 func (c *Cache) IncHit()      { c.mu.Lock(); c.hits++; c.mu.Unlock() }
 func (c *Cache) IncMiss()     { c.mu.Lock(); c.misses++; c.mu.Unlock() }
 func (c *Cache) IncInFlight() { c.mu.Lock(); c.inflight++; c.mu.Unlock() }
@@ -77,13 +437,11 @@ func ZeroizeString(s *string) {
 	if s == nil {
 		return
 	}
-	hdr := (*[2]uintptr)(unsafe.Pointer(s))
-	p := (*byte)(unsafe.Pointer(hdr[0]))
+	p := unsafe.StringData(*s)
 	if p == nil {
 		return
 	}
-	l := int(hdr[1])
-	b := unsafe.Slice(p, l)
+	b := unsafe.Slice(p, len(*s))
 	for i := range b {
 		b[i] = 0
 	}
@@ -100,7 +458,7 @@ func (c *Cache) CleanupExpired() int {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	now := time.Now()
+	now := c.clock.Now()
 	removed := 0
 	for key, entry := range c.data {
 		if now.After(entry.exp) {
@@ -110,19 +468,26 @@ func (c *Cache) CleanupExpired() int {
 			removed++
 		}
 	}
+	c.cleanupRemoved += int64(removed)
+	c.lastCleanup = now
 	return removed
 }
 
-// Clear removes all entries from the cache with secure zeroization
+// Clear removes all entries from the cache with secure zeroization; live tombstones are kept
 func (c *Cache) Clear() int {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	removed := len(c.data)
+	now := c.clock.Now()
+	removed := 0
 	for key, entry := range c.data {
+		if entry.tombstone && now.Before(entry.exp) {
+			continue
+		}
 		// Securely zero the SafeString before removal
 		entry.v.Zero()
 		delete(c.data, key)
+		removed++
 	}
 	return removed
 }
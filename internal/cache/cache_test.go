@@ -1,10 +1,13 @@
 package cache
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/zach-source/opx/internal/util"
 )
 
 func TestNew(t *testing.T) {
@@ -86,21 +89,88 @@ func TestCache_SetAndGet(t *testing.T) {
 	}
 }
 
+func TestCache_GetMeta(t *testing.T) {
+	c := New(time.Minute)
+	if _, meta, ok := c.GetMeta("k"); ok || !meta.CachedAt.IsZero() || !meta.ExpiresAt.IsZero() {
+		t.Errorf("Expected a miss with zero meta, got %+v", meta)
+	}
+
+	c.Set("k", "v")
+	val, meta, ok := c.GetMeta("k")
+	if !ok || val != "v" {
+		t.Fatalf("Expected hit with %q, got %q (%v)", "v", val, ok)
+	}
+	if ttl := meta.ExpiresAt.Sub(meta.CachedAt); ttl != time.Minute {
+		t.Errorf("Expected ExpiresAt to be CachedAt+TTL, got %v apart", ttl)
+	}
+	if _, _, exp, cached := c.Get("k"); !exp.Equal(meta.ExpiresAt) || !cached.Equal(meta.CachedAt) {
+		t.Error("Expected Get and GetMeta to agree")
+	}
+	if _, hits, _, _ := c.Stats(); hits != 0 {
+		t.Errorf("Expected GetMeta to leave hit counting to the caller, got %d", hits)
+	}
+}
+
+func TestCache_SetFrom(t *testing.T) {
+	updated := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		src      Source
+		expected time.Duration
+	}{
+		{"unknown ttl keeps the cache ttl", Source{}, time.Minute},
+		{"shorter lease wins", Source{TTL: 10 * time.Second, Version: "3", UpdatedAt: updated}, 10 * time.Second},
+		{"longer lease is capped", Source{TTL: time.Hour}, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(time.Minute)
+			if err := c.SetFrom("k", "v", tt.src); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			_, meta, ok := c.GetMeta("k")
+			if !ok {
+				t.Fatal("Expected a hit")
+			}
+			if ttl := meta.ExpiresAt.Sub(meta.CachedAt); ttl != tt.expected {
+				t.Errorf("Expected ttl %v, got %v", tt.expected, ttl)
+			}
+			if meta.Version != tt.src.Version || !meta.UpdatedAt.Equal(tt.src.UpdatedAt) {
+				t.Errorf("Expected version %q updated %v, got %q %v", tt.src.Version, tt.src.UpdatedAt, meta.Version, meta.UpdatedAt)
+			}
+
+			// A refresh keeps the lifetime but the new value's version is unknown
+			if refreshed, _ := c.Refresh("k", "v2"); !refreshed {
+				t.Fatal("Expected the refresh to apply")
+			}
+			_, meta, _ = c.GetMeta("k")
+			if ttl := meta.ExpiresAt.Sub(meta.CachedAt); ttl != tt.expected {
+				t.Errorf("Expected refresh to keep ttl %v, got %v", tt.expected, ttl)
+			}
+			if meta.Version != "" {
+				t.Errorf("Expected refresh to drop the version, got %q", meta.Version)
+			}
+		})
+	}
+}
+
 func TestCache_Expiration(t *testing.T) {
-	c := New(50 * time.Millisecond) // Very short TTL for testing
+	clock := util.NewManualClock(time.Now())
+	c := New(50 * time.Millisecond)
+	c.SetClock(clock)
 	key := "test-key"
 	value := "test-value"
 
 	c.Set(key, value)
 
-	// Should be available immediately
+	// Should be available until the TTL has passed
+	clock.Advance(50 * time.Millisecond)
 	val, ok, _, _ := c.Get(key)
 	if !ok || val != value {
-		t.Error("Value should be available immediately after set")
+		t.Error("Value should be available until its TTL has passed")
 	}
 
-	// Wait for expiration
-	time.Sleep(100 * time.Millisecond)
+	clock.Advance(time.Nanosecond)
 
 	// Should be expired now
 	val, ok, _, _ = c.Get(key)
@@ -112,6 +182,56 @@ func TestCache_Expiration(t *testing.T) {
 	}
 }
 
+func TestCache_GetRemovesExpiredEntry(t *testing.T) {
+	clock := util.NewManualClock(time.Now())
+	c := New(20 * time.Millisecond)
+	c.SetClock(clock)
+	c.Set("key", "value")
+	clock.Advance(30 * time.Millisecond)
+
+	if _, ok, _, _ := c.Get("key"); ok {
+		t.Fatal("Expected miss for expired entry")
+	}
+	if size, _, _, _ := c.Stats(); size != 0 {
+		t.Errorf("Expected Get to remove the expired entry, got size %d", size)
+	}
+	if expiredHits, _, _ := c.ExpiryStats(); expiredHits != 1 {
+		t.Errorf("Expected 1 expired hit, got %d", expiredHits)
+	}
+
+	// A second read finds nothing and is a plain miss
+	c.Get("key")
+	c.Get("never-set")
+	if expiredHits, _, _ := c.ExpiryStats(); expiredHits != 1 {
+		t.Errorf("Expected expired hits to stay at 1, got %d", expiredHits)
+	}
+}
+
+func TestCache_CleanupStats(t *testing.T) {
+	c := New(20 * time.Millisecond)
+	if _, removed, last := c.ExpiryStats(); removed != 0 || !last.IsZero() {
+		t.Errorf("Expected no cleanup stats before the first sweep, got %d at %v", removed, last)
+	}
+
+	clock := util.NewManualClock(time.Now())
+	c.SetClock(clock)
+	c.Set("a", "1")
+	c.Set("b", "2")
+	clock.Advance(30 * time.Millisecond)
+	c.Set("c", "3")
+
+	c.CleanupExpired()
+	c.CleanupExpired()
+
+	_, removed, last := c.ExpiryStats()
+	if removed != 2 {
+		t.Errorf("Expected 2 entries removed in total, got %d", removed)
+	}
+	if !last.Equal(clock.Now()) {
+		t.Errorf("Expected last cleanup at %v, got %v", clock.Now(), last)
+	}
+}
+
 func TestCache_Stats(t *testing.T) {
 	c := New(5 * time.Minute)
 
@@ -417,3 +537,335 @@ func TestCache_ClearEmptyCache(t *testing.T) {
 		t.Errorf("Expected cache size 0, got %d", size)
 	}
 }
+
+func TestCache_SoftDeleteBlocksSet(t *testing.T) {
+	c := New(5 * time.Minute)
+	c.Set("key", "personal-data")
+
+	c.SoftDelete("key", time.Hour)
+
+	if _, ok, _, _ := c.Get("key"); ok {
+		t.Error("Expected miss for tombstoned key")
+	}
+	if !c.Tombstoned("key") {
+		t.Error("Expected key to be tombstoned")
+	}
+	if err := c.Set("key", "personal-data"); err != ErrTombstone {
+		t.Errorf("Expected ErrTombstone from Set, got %v", err)
+	}
+	if _, ok, _, _ := c.Get("key"); ok {
+		t.Error("Expected tombstone to prevent re-caching")
+	}
+}
+
+func TestCache_SoftDeleteBlocksDerivedKeys(t *testing.T) {
+	c := New(5 * time.Minute)
+	c.SoftDelete("op://vault/item/field", time.Hour)
+
+	for _, key := range []string{
+		"op://vault/item/field|flags:--account=work",
+		"op://vault/item/field|type:password",
+	} {
+		if err := c.Set(key, "personal-data"); err != ErrTombstone {
+			t.Errorf("Expected ErrTombstone for %s, got %v", key, err)
+		}
+		if c.Has(key) {
+			t.Errorf("Expected %s not to be cached", key)
+		}
+	}
+
+	if err := c.Set("op://vault/item/field-other|flags:x", "v"); err != nil {
+		t.Errorf("Expected unrelated ref to be cacheable, got %v", err)
+	}
+}
+
+func TestCache_ClearKeepsTombstones(t *testing.T) {
+	c := New(5 * time.Minute)
+	c.Set("live", "value")
+	c.SoftDelete("deleted", time.Hour)
+	c.SoftDelete("expired", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	if removed := c.Clear(); removed != 2 {
+		t.Errorf("Expected 2 entries removed, got %d", removed)
+	}
+	if !c.Tombstoned("deleted") {
+		t.Error("Expected tombstone to survive Clear")
+	}
+	if err := c.Set("deleted", "personal-data"); err != ErrTombstone {
+		t.Errorf("Expected ErrTombstone after Clear, got %v", err)
+	}
+}
+
+func TestCache_SoftDeleteTombstoneExpires(t *testing.T) {
+	clock := util.NewManualClock(time.Now())
+	c := New(5 * time.Minute)
+	c.SetClock(clock)
+	c.SoftDelete("key", 20*time.Millisecond)
+
+	clock.Advance(30 * time.Millisecond)
+
+	if c.Tombstoned("key") {
+		t.Error("Expected tombstone to have expired")
+	}
+	if err := c.Set("key", "fresh"); err != nil {
+		t.Fatalf("Expected Set to succeed after tombstone expiry, got %v", err)
+	}
+	if v, ok, _, _ := c.Get("key"); !ok || v != "fresh" {
+		t.Errorf("Expected re-cached value, got %q (ok=%v)", v, ok)
+	}
+}
+
+func TestCache_SoftDeleteWithoutTombstone(t *testing.T) {
+	c := New(5 * time.Minute)
+	c.Set("key", "value")
+	c.SoftDelete("key", 0)
+
+	if c.Tombstoned("key") {
+		t.Error("Expected no tombstone for zero TTL")
+	}
+	if err := c.Set("key", "value"); err != nil {
+		t.Errorf("Expected Set to succeed, got %v", err)
+	}
+}
+
+func TestCache_RemovePrefix(t *testing.T) {
+	c := New(5 * time.Minute)
+	c.Set("op://v/i/f|flags:--account=a", "1")
+	c.Set("op://v/i/f|flags:--account=b", "2")
+	c.Set("op://v/other/f", "3")
+
+	if removed := c.RemovePrefix("op://v/i/f|flags:"); removed != 2 {
+		t.Errorf("Expected 2 removed, got %d", removed)
+	}
+	if _, ok, _, _ := c.Get("op://v/other/f"); !ok {
+		t.Error("Expected unrelated key to remain")
+	}
+}
+
+func TestCache_HotKeys(t *testing.T) {
+	c := New(time.Minute)
+	now := time.Now()
+
+	_ = c.Set("warm", "w")
+	_ = c.Set("hot", "h")
+	for i := 0; i < 3; i++ {
+		c.Get("hot")
+	}
+	c.SoftDelete("gone", time.Minute)
+
+	keys := c.HotKeys(now.Add(-time.Second), now.Add(2*time.Minute), 0)
+	if len(keys) != 2 || keys[0] != "hot" || keys[1] != "warm" {
+		t.Errorf("Expected [hot warm] ordered by access count, got %v", keys)
+	}
+
+	if keys := c.HotKeys(now.Add(-time.Second), now.Add(2*time.Minute), 1); len(keys) != 1 || keys[0] != "hot" {
+		t.Errorf("Expected limit to keep only the hottest key, got %v", keys)
+	}
+
+	// Entries not expiring within the window are left alone
+	if keys := c.HotKeys(now.Add(-time.Second), now.Add(30*time.Second), 0); len(keys) != 0 {
+		t.Errorf("Expected no keys expiring within 30s, got %v", keys)
+	}
+
+	// Entries not read since the cutoff are cold
+	if keys := c.HotKeys(time.Now().Add(time.Second), now.Add(2*time.Minute), 0); len(keys) != 0 {
+		t.Errorf("Expected no keys accessed in the future, got %v", keys)
+	}
+}
+
+func TestCache_Refresh(t *testing.T) {
+	c := New(time.Minute)
+
+	if ok, _ := c.Refresh("missing", "v"); ok {
+		t.Error("Expected refresh of a missing key to fail")
+	}
+	if c.Has("missing") {
+		t.Error("Expected refresh not to create entries")
+	}
+
+	_ = c.Set("key", "old")
+	c.Get("key")
+	_, _, _, cachedBefore := c.Get("key")
+	time.Sleep(2 * time.Millisecond)
+
+	if ok, _ := c.Refresh("key", "new"); !ok {
+		t.Fatal("Expected refresh of a live key to succeed")
+	}
+	v, ok, _, cachedAfter := c.Get("key")
+	if !ok || v != "new" {
+		t.Errorf("Expected refreshed value 'new', got %q (ok=%v)", v, ok)
+	}
+	if !cachedAfter.After(cachedBefore) {
+		t.Error("Expected refresh to restart the entry's TTL")
+	}
+
+	// Access history survives the refresh: Set + 3 Gets
+	keys := c.HotKeys(time.Now().Add(-time.Minute), time.Now().Add(2*time.Minute), 0)
+	if len(keys) != 1 {
+		t.Fatalf("Expected key to stay hot, got %v", keys)
+	}
+
+	c.SoftDelete("key", time.Minute)
+	if ok, _ := c.Refresh("key", "resurrected"); ok {
+		t.Error("Expected refresh not to overwrite a tombstone")
+	}
+}
+
+func TestCache_Expiring(t *testing.T) {
+	c := New(time.Minute)
+	_ = c.Set("first", "1")
+	time.Sleep(10 * time.Millisecond)
+	_ = c.Set("second|flags:--reveal", "2")
+	c.SoftDelete("gone", time.Minute)
+	now := time.Now()
+
+	entries := c.Expiring(now.Add(2 * time.Minute))
+	if len(entries) != 2 || entries[0].Key != "first" || entries[1].Key != "second|flags:--reveal" {
+		t.Fatalf("Expected [first second|flags:--reveal] soonest first, got %+v", entries)
+	}
+	if !entries[0].ExpiresAt.Before(entries[1].ExpiresAt) || entries[0].CachedAt.IsZero() {
+		t.Errorf("Expected expiry and cached times, got %+v", entries)
+	}
+
+	// Entries not expiring within the window are left out
+	if entries := c.Expiring(now.Add(30 * time.Second)); len(entries) != 0 {
+		t.Errorf("Expected no entries expiring within 30s, got %+v", entries)
+	}
+
+	// Listing is not an access
+	if keys := c.HotKeys(now, now.Add(2*time.Minute), 0); len(keys) != 0 {
+		t.Errorf("Expected Expiring not to mark entries as read, got %v", keys)
+	}
+}
+
+func TestCache_RefreshReportsChanges(t *testing.T) {
+	c := New(time.Minute)
+	_ = c.Set("untracked", "old")
+	if _, changed := c.Refresh("untracked", "new"); changed {
+		t.Error("Expected no change reports without SetTrackChanges")
+	}
+
+	c.SetTrackChanges(true)
+	_ = c.Set("key", "old")
+
+	tests := []struct {
+		value   string
+		changed bool
+	}{
+		{value: "old", changed: false},
+		{value: "new", changed: true},
+		{value: "new", changed: false},
+	}
+	for _, tt := range tests {
+		refreshed, changed := c.Refresh("key", tt.value)
+		if !refreshed || changed != tt.changed {
+			t.Errorf("Refresh to %q: expected changed=%v, got refreshed=%v changed=%v", tt.value, tt.changed, refreshed, changed)
+		}
+	}
+
+	// Entries cached before tracking started have no hash to compare against
+	if _, changed := c.Refresh("untracked", "newer"); changed {
+		t.Error("Expected no change report for an entry cached before tracking")
+	}
+}
+
+func TestCache_Checksum(t *testing.T) {
+	clock := util.NewManualClock(time.Now())
+	c := New(time.Minute)
+	c.SetClock(clock)
+	_ = c.Set("key", "hunter2")
+
+	// echo -n hunter2 | sha256sum
+	expected := "f52fbd32b2b3b86ff88ef6c490628285f482af15ddcb29541f94bcf526a3f6c7"
+	sum, ok := c.Checksum("key")
+	if !ok || sum != expected {
+		t.Fatalf("Expected checksum %s, got %q (ok=%v)", expected, sum, ok)
+	}
+	if c.data["key"].hash == [32]byte{} {
+		t.Error("Expected the hash to be kept with the entry")
+	}
+	if again, _ := c.Checksum("key"); again != sum {
+		t.Errorf("Expected a stable checksum, got %s then %s", sum, again)
+	}
+
+	// A new value gets a new checksum
+	_ = c.Set("key", "hunter3")
+	if changed, _ := c.Checksum("key"); changed == sum {
+		t.Error("Expected the checksum to change with the value")
+	}
+	c.Refresh("key", "hunter2")
+	if refreshed, _ := c.Checksum("key"); refreshed != sum {
+		t.Errorf("Expected %s after refreshing to the old value, got %s", sum, refreshed)
+	}
+
+	if _, ok := c.Checksum("missing"); ok {
+		t.Error("Expected no checksum for a missing key")
+	}
+	c.SoftDelete("key", time.Minute)
+	if _, ok := c.Checksum("key"); ok {
+		t.Error("Expected no checksum for a tombstone")
+	}
+	_ = c.Set("expiring", "value")
+	clock.Advance(2 * time.Minute)
+	if _, ok := c.Checksum("expiring"); ok {
+		t.Error("Expected no checksum for an expired entry")
+	}
+}
+
+func TestCache_MaxValueBytes(t *testing.T) {
+	c := New(time.Minute)
+	c.SetMaxValueBytes(8)
+
+	if err := c.Set("exact", "12345678"); err != nil {
+		t.Fatalf("Expected a value at the limit to be stored, got %v", err)
+	}
+	if err := c.Set("over", "123456789"); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("Expected ErrValueTooLarge, got %v", err)
+	}
+	if c.Has("over") {
+		t.Error("Expected the over-limit value not to be stored")
+	}
+
+	// Refreshing to an over-limit value drops the entry instead
+	if refreshed, _ := c.Refresh("exact", "123456789"); refreshed || c.Has("exact") {
+		t.Errorf("Expected the refresh to be refused and the entry removed, got refreshed=%v", refreshed)
+	}
+
+	// Lowering the limit evicts entries over it
+	_ = c.Set("short", "1234")
+	_ = c.Set("long", "12345678")
+	c.SetMaxValueBytes(4)
+	if !c.Has("short") || c.Has("long") {
+		t.Errorf("Expected only the entry within the new limit to stay, got short=%v long=%v", c.Has("short"), c.Has("long"))
+	}
+	if c.MaxValueBytes() != 4 {
+		t.Errorf("Expected limit 4, got %d", c.MaxValueBytes())
+	}
+}
+
+func TestCache_ValueStats(t *testing.T) {
+	clock := util.NewManualClock(time.Now())
+	c := New(time.Minute)
+	c.SetClock(clock)
+
+	if largest, total := c.ValueStats(); largest != 0 || total != 0 {
+		t.Errorf("Expected no bytes in an empty cache, got %d, %d", largest, total)
+	}
+	_ = c.Set("a", "12345")
+	_ = c.Set("bb", "123")
+	c.SoftDelete("tomb", time.Minute)
+	if largest, total := c.ValueStats(); largest != 5 || total != 1+5+2+3 {
+		t.Errorf("Expected largest 5 and 11 bytes, got %d, %d", largest, total)
+	}
+
+	// Replaced values count once, and expired entries not at all
+	_ = c.Set("a", "1")
+	if largest, total := c.ValueStats(); largest != 3 || total != 1+1+2+3 {
+		t.Errorf("Expected largest 3 and 7 bytes, got %d, %d", largest, total)
+	}
+	clock.Advance(2 * time.Minute)
+	if largest, total := c.ValueStats(); largest != 0 || total != 0 {
+		t.Errorf("Expected expired entries not to count, got %d, %d", largest, total)
+	}
+}
@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+// Approvals lists the daemon's pending and decided approvals (needs admin access)
+func (c *Client) Approvals(ctx context.Context) ([]protocol.Approval, error) {
+	var resp protocol.ApprovalsResponse
+	if err := c.doJSON(ctx, "GET", "/v1/approvals", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Approvals, nil
+}
+
+// DecideApproval approves, or with deny denies, a pending approval (needs admin access)
+func (c *Client) DecideApproval(ctx context.Context, id string, deny bool) (protocol.Approval, error) {
+	var resp protocol.Approval
+	if err := c.doJSON(ctx, "POST", "/v1/approvals/decide", protocol.ApprovalDecisionRequest{ID: id, Deny: deny}, &resp); err != nil {
+		return protocol.Approval{}, err
+	}
+	return resp, nil
+}
+
+// FormatApprovals renders approvals for `opx approvals` as a table, with how
+// long each has left measured from now
+func FormatApprovals(approvals []protocol.Approval, now time.Time) string {
+	if len(approvals) == 0 {
+		return "no approvals\n"
+	}
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATE\tACTION\tREF\tPEER\tEXPIRES IN")
+	for _, ap := range approvals {
+		left := time.Unix(ap.ExpiresAt, 0).Sub(now).Round(time.Second)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s (pid %d)\t%s\n", ap.ID, ap.State, ap.Action, ap.Ref, orUnknown(ap.PeerPath), ap.PeerPID, max(left, 0))
+	}
+	_ = tw.Flush()
+	return b.String()
+}
@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+func TestClient_Approvals(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/v1/approvals":
+			_ = json.NewEncoder(w).Encode(protocol.ApprovalsResponse{Approvals: []protocol.Approval{{ID: "abc123", State: protocol.ApprovalPending}}})
+		case r.Method == "POST" && r.URL.Path == "/v1/approvals/decide":
+			var req protocol.ApprovalDecisionRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if req.ID != "abc123" {
+				http.Error(w, "no such approval", http.StatusNotFound)
+				return
+			}
+			state := protocol.ApprovalApproved
+			if req.Deny {
+				state = protocol.ApprovalDenied
+			}
+			_ = json.NewEncoder(w).Encode(protocol.Approval{ID: req.ID, State: state})
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+	cli := newTestClient(ts)
+	ctx := context.Background()
+
+	list, err := cli.Approvals(ctx)
+	if err != nil || len(list) != 1 || list[0].ID != "abc123" {
+		t.Fatalf("Expected one approval, got %+v %v", list, err)
+	}
+	if ap, err := cli.DecideApproval(ctx, "abc123", true); err != nil || ap.State != protocol.ApprovalDenied {
+		t.Errorf("Expected a denied approval, got %+v %v", ap, err)
+	}
+	if _, err := cli.DecideApproval(ctx, "nope", false); err == nil {
+		t.Error("Expected an error for an unknown approval")
+	}
+}
+
+func TestFormatApprovals(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	approvals := []protocol.Approval{
+		{ID: "abc123", State: protocol.ApprovalPending, Action: "read", Ref: "op://breakglass/root/password", PeerPath: "/usr/bin/deploy", PeerPID: 42, ExpiresAt: now.Unix() + 90},
+		{ID: "def456", State: protocol.ApprovalApproved, Action: "read", Ref: "op://breakglass/db/password", PeerPID: 7, ExpiresAt: now.Unix() - 1},
+	}
+	expected := `ID      STATE     ACTION  REF                            PEER                      EXPIRES IN
+abc123  pending   read    op://breakglass/root/password  /usr/bin/deploy (pid 42)  1m30s
+def456  approved  read    op://breakglass/db/password    (unknown) (pid 7)         0s
+`
+	if got := FormatApprovals(approvals, now); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+	if got := FormatApprovals(nil, now); got != "no approvals\n" {
+		t.Errorf("Expected no approvals, got %q", got)
+	}
+}
+
+func TestExitCode_ApprovalRequired(t *testing.T) {
+	policyBody := `{"code":"approval_required","message":"approval required","approval_id":"abc123"}`
+	if code := ExitCode(&StatusError{Code: http.StatusForbidden, Body: policyBody}); code != ExitPolicyDenied {
+		t.Errorf("Expected a policy approval to exit %d, got %d", ExitPolicyDenied, code)
+	}
+	appBody := `{"code":"approval_required","message":"approval required in the 1Password app"}`
+	if code := ExitCode(&StatusError{Code: http.StatusServiceUnavailable, Body: appBody}); code != ExitBackend {
+		t.Errorf("Expected a 1Password app approval to exit %d, got %d", ExitBackend, code)
+	}
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+// CacheExpiring lists cached entries that expire within the window
+func (c *Client) CacheExpiring(ctx context.Context, within time.Duration) (protocol.CacheExpiringResponse, error) {
+	var resp protocol.CacheExpiringResponse
+	path := fmt.Sprintf("/v1/cache/expiring?within=%d", int(within.Seconds()))
+	if err := c.doJSON(ctx, "GET", path, nil, &resp); err != nil {
+		return protocol.CacheExpiringResponse{}, err
+	}
+	return resp, nil
+}
+
+// CacheRefresh re-reads refs, and every entry expiring within the window when within > 0
+func (c *Client) CacheRefresh(ctx context.Context, refs []string, within time.Duration) (protocol.CacheRefreshResponse, error) {
+	var resp protocol.CacheRefreshResponse
+	req := protocol.CacheRefreshRequest{Refs: refs, WithinSeconds: int(within.Seconds())}
+	if err := c.doJSON(ctx, "POST", "/v1/cache/refresh", req, &resp); err != nil {
+		return protocol.CacheRefreshResponse{}, err
+	}
+	return resp, nil
+}
+
+// FormatCacheEntries renders cache entries as a table for `opx cache expiring/refresh`
+func FormatCacheEntries(entries []protocol.CacheEntry) string {
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ENTRY\tEXPIRES IN\tRESOLVED AT")
+	for _, e := range entries {
+		name := e.Descriptor
+		if name == "" {
+			name = e.Key
+		}
+		resolved := time.Unix(e.ResolvedAt, 0).UTC().Format(time.RFC3339)
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", name, time.Duration(e.ExpiresIn)*time.Second, resolved)
+	}
+	_ = tw.Flush()
+	return b.String()
+}
+
+// FormatCacheErrors renders per-key refresh failures sorted by key
+func FormatCacheErrors(errs map[string]string) string {
+	keys := make([]string, 0, len(errs))
+	for key := range errs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s: %s\n", key, errs[key])
+	}
+	return b.String()
+}
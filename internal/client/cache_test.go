@@ -0,0 +1,33 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+func TestFormatCacheEntries(t *testing.T) {
+	entries := []protocol.CacheEntry{
+		{Key: "op://v/old/f", Ref: "op://v/old/f", ExpiresIn: 120, ResolvedAt: 1700000000},
+		{Key: "op://v/new/f|0f3c", Ref: "op://v/new/f", Descriptor: "op://v/new/f (flags=--account=***)", ExpiresIn: 300, ResolvedAt: 1700000180},
+	}
+
+	expected := "ENTRY                               EXPIRES IN  RESOLVED AT\n" +
+		"op://v/old/f                        2m0s        2023-11-14T22:13:20Z\n" +
+		"op://v/new/f (flags=--account=***)  5m0s        2023-11-14T22:16:20Z\n"
+	if got := FormatCacheEntries(entries); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestFormatCacheErrors(t *testing.T) {
+	errs := map[string]string{
+		"op://prod/db/password": "access denied by policy",
+		"op://dev/api/key":      "failed to read secret",
+	}
+
+	expected := "op://dev/api/key: failed to read secret\nop://prod/db/password: access denied by policy\n"
+	if got := FormatCacheErrors(errs); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
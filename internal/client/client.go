@@ -10,22 +10,79 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"os"
 	"os/exec"
+	"strings"
 	"time"
 
+	"github.com/zach-source/opx/internal/audit"
+	"github.com/zach-source/opx/internal/config"
 	"github.com/zach-source/opx/internal/protocol"
+	"github.com/zach-source/opx/internal/safestring"
 	"github.com/zach-source/opx/internal/util"
 )
 
+// ErrSessionLocked is returned when the daemon session is locked and cannot be kept alive
+var ErrSessionLocked = errors.New("session is locked; run `opx login` or unlock it")
+
+// StatusError is returned for non-2xx daemon responses
+type StatusError struct {
+	Code   int
+	Status string
+	Body   string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("server error: %s: %s", e.Status, e.Body)
+}
+
+// SessionInfo is the typed view of the daemon's session status
+type SessionInfo struct {
+	State         string
+	Enabled       bool
+	IdleTimeout   time.Duration
+	TimeUntilLock time.Duration
+}
+
 type Client struct {
-	http  *http.Client
-	base  string
-	token string
-	sock  string
+	http   *http.Client
+	stream *http.Client // no overall timeout, for long-lived responses
+	base   string
+	token  string
+	sock   string
+	// tcp is the daemon's TCP endpoint ($OPX_TCP_ENDPOINT), dialed instead of sock
+	tcp string
+	// tls and alternates let ensureDaemon find a daemon on another default socket
+	tls          *tls.Config
+	alternates   []string
+	splitWarning string
+	// Debug asks the daemon for underlying error details (needs opx-authd --allow-debug)
+	Debug bool
+	// Vars are sent with reads and resolves for the daemon to expand ${VAR} in refs
+	// (needs opx-authd --expand-ref-vars)
+	Vars map[string]string
+	// RefFlags are sent with resolves to give refs their own op flags, e.g. a
+	// different --account, in place of the batch's flags
+	RefFlags map[string][]string
+	// SocketTimeout bounds connecting to the daemon socket and the TLS handshake
+	// that proves a daemon is serving it (0 uses DefaultSocketTimeout)
+	SocketTimeout time.Duration
+	// Timing, when set, records client phases and asks the daemon for its own (opx --timing)
+	Timing *Timing
+	// RetryOnLock makes single reads that find the session locked unlock it and retry once
+	RetryOnLock bool
+	// SignIn, when set, runs if the daemon can't unlock the session itself, before it tries again
+	SignIn func(ctx context.Context) error
 }
 
+// DefaultSocketTimeout is how long a dial and handshake may take before the daemon counts as unreachable
+const DefaultSocketTimeout = 2 * time.Second
+
 func New() (*Client, error) {
+	if endpoint := os.Getenv(util.TCPEndpointEnv); endpoint != "" {
+		return newTCP(endpoint, os.Getenv(util.ClientCertEnv))
+	}
 	sock, err := util.SocketPath()
 	if err != nil {
 		return nil, err
@@ -42,37 +99,82 @@ func New() (*Client, error) {
 		return nil, fmt.Errorf("failed to setup client TLS: %w", err)
 	}
 
+	c := &Client{base: "https://unix", token: string(tok), sock: sock, tls: tlsConfig, alternates: alternateSockets(sock)}
+	// Compression is left enabled: the transport sends Accept-Encoding: gzip and
+	// transparently decompresses large batch responses from the daemon.
 	tr := &http.Transport{
 		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			var d net.Dialer
-			conn, err := d.DialContext(ctx, "unix", sock)
-			if err != nil {
-				return nil, err
-			}
-			// Wrap the Unix socket connection with TLS
-			tlsConn := tls.Client(conn, tlsConfig)
-			if err := tlsConn.HandshakeContext(ctx); err != nil {
-				conn.Close()
-				return nil, fmt.Errorf("TLS handshake failed: %w", err)
-			}
-			return tlsConn, nil
+			start := time.Now()
+			conn, err := dialDaemon(ctx, c.sock, tlsConfig, c.socketTimeout())
+			c.Timing.addConnect(time.Since(start))
+			return conn, err
 		},
 	}
-	return &Client{
-		http:  &http.Client{Transport: tr, Timeout: 30 * time.Second},
-		base:  "https://unix",
-		token: string(tok),
-		sock:  sock,
-	}, nil
+	c.http = &http.Client{Transport: tr, Timeout: 30 * time.Second}
+	c.stream = &http.Client{Transport: tr}
+	return c, nil
+}
+
+func (c *Client) socketTimeout() time.Duration {
+	if c.SocketTimeout > 0 {
+		return c.SocketTimeout
+	}
+	return DefaultSocketTimeout
+}
+
+// dialDaemon connects to sock and completes a TLS handshake within timeout. A
+// stale socket file refuses the dial and a listener with no live daemon never
+// answers the handshake; both are reported as ErrDaemonUnreachable.
+func dialDaemon(ctx context.Context, sock string, tlsConfig *tls.Config, timeout time.Duration) (net.Conn, error) {
+	return dialEndpoint(ctx, "unix", sock, tlsConfig, timeout)
+}
+
+// dialEndpoint is dialDaemon for any network, such as the daemon's TCP listener
+func dialEndpoint(ctx context.Context, network, addr string, tlsConfig *tls.Config, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDaemonUnreachable, err)
+	}
+	// Wrap the connection with TLS
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%w: no response on %s within %v", ErrDaemonUnreachable, addr, timeout)
+		}
+		return nil, fmt.Errorf("TLS handshake failed: %w", err)
+	}
+	return tlsConn, nil
 }
 
 func (c *Client) ensureDaemon(ctx context.Context) error {
 	// Try quick ping
-	if err := c.Ping(ctx); err == nil {
+	err := c.Ping(ctx)
+	if c.tcp != "" {
+		// A daemon reached over TCP runs elsewhere and can't be autostarted
+		if err != nil {
+			return fmt.Errorf("daemon on %s: %w", c.tcp, err)
+		}
+		return nil
+	}
+	if err == nil {
+		c.useLiveSocket(ctx, true)
+		return nil
+	}
+	// Never start a second daemon while one serves another default socket,
+	// such as an op-authd still on ~/.op-authd/socket.sock
+	if c.useLiveSocket(ctx, false) {
+		if err := c.Ping(ctx); err != nil {
+			return fmt.Errorf("daemon on %s: %w", c.sock, err)
+		}
 		return nil
 	}
 	if os.Getenv("OPX_AUTOSTART") == "0" {
-		return errors.New("daemon not reachable and autostart disabled (OPX_AUTOSTART=0)")
+		return fmt.Errorf("%w and autostart disabled (OPX_AUTOSTART=0)", ErrDaemonUnreachable)
 	}
 	// Attempt to start: call opx-authd binary from configured path or PATH
 	exe := getDaemonPath()
@@ -80,27 +182,37 @@ func (c *Client) ensureDaemon(ctx context.Context) error {
 		var err error
 		exe, err = exec.LookPath("opx-authd")
 		if err != nil {
-			return fmt.Errorf("opx-authd not found in PATH: %w", err)
+			return fmt.Errorf("%w: opx-authd not found in PATH: %w", ErrDaemonUnreachable, err)
 		}
 	}
-	cmd := exec.CommandContext(ctx, exe)
+	cmd := daemonCommand(ctx, exe, c.sock)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to launch opx-authd: %w", err)
+		return fmt.Errorf("%w: failed to launch opx-authd: %w", ErrDaemonUnreachable, err)
 	}
 	// Give it a moment
 	deadline := time.Now().Add(3 * time.Second)
 	for time.Now().Before(deadline) {
 		if err := c.Ping(ctx); err == nil {
+			if st, err := c.Status(ctx); err == nil {
+				if warning := SocketMismatch(st, c.sock); warning != "" {
+					fmt.Fprintln(os.Stderr, "opx: warning:", warning)
+				}
+			}
 			return nil
 		}
 		time.Sleep(150 * time.Millisecond)
 	}
-	return errors.New("failed to connect to opx-authd after autostart")
+	return fmt.Errorf("%w: failed to connect to opx-authd after autostart", ErrDaemonUnreachable)
 }
 
 func (c *Client) doJSON(ctx context.Context, method, path string, req any, resp any) error {
+	return c.doJSONWith(ctx, c.http, method, path, req, resp)
+}
+
+// doJSONWith is doJSON over hc, so long-polls can use the client without an overall timeout
+func (c *Client) doJSONWith(ctx context.Context, hc *http.Client, method, path string, req any, resp any) error {
 	var body *bytes.Reader
 	if req != nil {
 		b, _ := json.Marshal(req)
@@ -115,17 +227,45 @@ func (c *Client) doJSON(ctx context.Context, method, path string, req any, resp
 	if c.token != "" {
 		httpReq.Header.Set("X-OpAuthd-Token", c.token)
 	}
-	r, err := c.http.Do(httpReq)
+	if c.Debug {
+		httpReq.Header.Set(protocol.DebugHeader, "1")
+	}
+	if c.Timing != nil {
+		httpReq.Header.Set(protocol.TimingHeader, "1")
+		// Time from getting a connection, not from the call: the transport may
+		// dial in the background and then hand the request an idle connection
+		var gotConn time.Time
+		trace := &httptrace.ClientTrace{GotConn: func(httptrace.GotConnInfo) { gotConn = time.Now() }}
+		err := c.send(hc, httpReq.WithContext(httptrace.WithClientTrace(ctx, trace)), resp)
+		c.Timing.addRoundTrip(gotConn)
+		return err
+	}
+	return c.send(hc, httpReq, resp)
+}
+
+// send performs httpReq and decodes a successful response into resp
+func (c *Client) send(hc *http.Client, httpReq *http.Request, resp any) error {
+	r, err := hc.Do(httpReq)
 	if err != nil {
 		return err
 	}
 	defer r.Body.Close()
+	c.Timing.addResponse(r.Header)
 	if r.StatusCode == 401 {
-		return errors.New("unauthorized (token mismatch). Remove ~/.op-authd/token and restart daemon if needed")
+		return fmt.Errorf("%w (token mismatch). Remove ~/.op-authd/token and restart daemon if needed", ErrUnauthorized)
 	}
 	if r.StatusCode >= 400 {
 		b, _ := io.ReadAll(r.Body)
-		return fmt.Errorf("server error: %s: %s", r.Status, string(b))
+		return &StatusError{Code: r.StatusCode, Status: r.Status, Body: string(b)}
+	}
+	if _, ok := resp.(zeroingResponse); ok {
+		// Secret-bearing bodies are decoded from a buffer we can zero, not the decoder's own
+		b, err := readZeroing(r.Body)
+		defer safestring.ZeroBytes(b)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(b, resp)
 	}
 	if resp != nil {
 		return json.NewDecoder(r.Body).Decode(resp)
@@ -144,7 +284,7 @@ func (c *Client) Ping(ctx context.Context) error {
 	}
 	r.Body.Close()
 	if r.StatusCode == 401 {
-		return errors.New("unauthorized")
+		return ErrUnauthorized
 	}
 	if r.StatusCode >= 400 {
 		return fmt.Errorf("status %s", r.Status)
@@ -152,6 +292,44 @@ func (c *Client) Ping(ctx context.Context) error {
 	return nil
 }
 
+// daemonCommand starts exe on the socket the client will dial, so an
+// autostarted daemon never listens somewhere else
+func daemonCommand(ctx context.Context, exe, sock string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, exe, "--sock", sock)
+	cfg, _, err := config.Load()
+	if err != nil {
+		cfg = config.DefaultDaemon() // the daemon reports the bad file itself
+	}
+	cmd.Env = daemonEnviron(os.Environ(), cfg.OpEnvPassthrough)
+	return cmd
+}
+
+// daemonEnvPassthrough is what an autostarted opx-authd keeps from the client's
+// environment: what op needs, the daemon's OPX_* settings and Vault credentials
+var daemonEnvPassthrough = append(append([]string(nil), util.OpEnvPassthrough...), "OPX_*", "VAULT_*")
+
+// daemonEnviron scrubs environ for an autostarted daemon, also keeping the
+// op_env_passthrough it will hand on to op; nil (inherit everything) for *
+func daemonEnviron(environ, opExtra []string) []string {
+	if util.EnvPassesAll(opExtra) {
+		return nil
+	}
+	return util.FilterEnv(environ, append(append([]string(nil), daemonEnvPassthrough...), opExtra...))
+}
+
+// SocketPath returns the socket the client dials, or "" when it dials a TCP endpoint
+func (c *Client) SocketPath() string {
+	return c.sock
+}
+
+// SocketMismatch describes a daemon that reports a socket other than sock, or "" if they match
+func SocketMismatch(st protocol.Status, sock string) string {
+	if st.SocketPath == "" || sock == "" || st.SocketPath == sock {
+		return ""
+	}
+	return fmt.Sprintf("daemon reports socket %s but the client dials %s; set %s or restart the daemon", st.SocketPath, sock, util.SocketEnv)
+}
+
 // getDaemonPath returns the configured path to the opx-authd binary
 func getDaemonPath() string {
 	// Check environment variable first
@@ -174,11 +352,32 @@ func (c *Client) Read(ctx context.Context, ref string) (protocol.ReadResponse, e
 }
 
 func (c *Client) ReadWithFlags(ctx context.Context, ref string, flags []string) (protocol.ReadResponse, error) {
-	var resp protocol.ReadResponse
-	if err := c.doJSON(ctx, "POST", "/v1/read", protocol.ReadRequest{Ref: ref, Flags: flags}, &resp); err != nil {
-		return protocol.ReadResponse{}, err
-	}
-	return resp, nil
+	return c.ReadWithSecretType(ctx, ref, flags, "")
+}
+
+// ReadWithSecretType reads ref, asking a multi-backend daemon to use the given
+// backend ("op", "vault", ...) instead of routing on the URI scheme. "" means auto.
+func (c *Client) ReadWithSecretType(ctx context.Context, ref string, flags []string, secretType string) (protocol.ReadResponse, error) {
+	req := protocol.ReadRequest{Ref: ref, Flags: flags, SecretType: secretType, Vars: c.Vars}
+	return retryOnLock(ctx, c, func() (protocol.ReadResponse, error) {
+		var resp protocol.ReadResponse
+		if err := c.doJSON(ctx, "POST", "/v1/read", req, &resp); err != nil {
+			return protocol.ReadResponse{}, err
+		}
+		return resp, nil
+	})
+}
+
+// ReadChecksum returns the hex SHA-256 of ref's value; the value itself never leaves the daemon
+func (c *Client) ReadChecksum(ctx context.Context, ref string, flags []string, secretType string) (string, error) {
+	req := protocol.ReadRequest{Ref: ref, Flags: flags, SecretType: secretType, Vars: c.Vars, ChecksumOnly: true}
+	return retryOnLock(ctx, c, func() (string, error) {
+		var resp protocol.ReadResponse
+		if err := c.doJSON(ctx, "POST", "/v1/read", req, &resp); err != nil {
+			return "", err
+		}
+		return resp.ValueSHA256, nil
+	})
 }
 
 func (c *Client) Reads(ctx context.Context, refs []string) (protocol.ReadsResponse, error) {
@@ -187,7 +386,7 @@ func (c *Client) Reads(ctx context.Context, refs []string) (protocol.ReadsRespon
 
 func (c *Client) ReadsWithFlags(ctx context.Context, refs []string, flags []string) (protocol.ReadsResponse, error) {
 	var resp protocol.ReadsResponse
-	if err := c.doJSON(ctx, "POST", "/v1/reads", protocol.ReadsRequest{Refs: refs, Flags: flags}, &resp); err != nil {
+	if err := c.doJSON(ctx, "POST", "/v1/reads", protocol.ReadsRequest{Refs: refs, Flags: flags, Vars: c.Vars}, &resp); err != nil {
 		return protocol.ReadsResponse{}, err
 	}
 	return resp, nil
@@ -198,13 +397,302 @@ func (c *Client) Resolve(ctx context.Context, env map[string]string) (protocol.R
 }
 
 func (c *Client) ResolveWithFlags(ctx context.Context, env map[string]string, flags []string) (protocol.ResolveResponse, error) {
+	return c.resolve(ctx, protocol.ResolveRequest{Env: env, Flags: flags})
+}
+
+// ResolveWithMeta resolves env and also returns per-name freshness metadata
+func (c *Client) ResolveWithMeta(ctx context.Context, env map[string]string, flags []string) (protocol.ResolveResponse, error) {
+	return c.resolve(ctx, protocol.ResolveRequest{Env: env, Flags: flags, IncludeMeta: true})
+}
+
+// ResolveChecksums returns the hex SHA-256 of each name's value without the values
+func (c *Client) ResolveChecksums(ctx context.Context, env map[string]string, flags []string) (map[string]string, error) {
+	resp, err := c.resolve(ctx, protocol.ResolveRequest{Env: env, Flags: flags, ChecksumOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	return resp.ValueSHA256, nil
+}
+
+func (c *Client) resolve(ctx context.Context, req protocol.ResolveRequest) (protocol.ResolveResponse, error) {
+	req.Vars = c.Vars
+	req.RefFlags = c.RefFlags
 	var resp protocol.ResolveResponse
-	if err := c.doJSON(ctx, "POST", "/v1/resolve", protocol.ResolveRequest{Env: env, Flags: flags}, &resp); err != nil {
+	if err := c.doJSON(ctx, "POST", "/v1/resolve", req, &resp); err != nil {
 		return protocol.ResolveResponse{}, err
 	}
 	return resp, nil
 }
 
+// Create asks the daemon to create a new item and returns its ref
+func (c *Client) Create(ctx context.Context, req protocol.CreateRequest) (protocol.CreateResponse, error) {
+	var resp protocol.CreateResponse
+	if err := c.doJSON(ctx, "POST", "/v1/create", req, &resp); err != nil {
+		return protocol.CreateResponse{}, err
+	}
+	return resp, nil
+}
+
+// StreamAudit follows live audit events, calling fn for each until ctx is cancelled or the stream ends
+func (c *Client) StreamAudit(ctx context.Context, fn func(audit.AuditEvent)) error {
+	req, _ := http.NewRequestWithContext(ctx, "GET", c.base+"/v1/audit/stream", nil)
+	if c.token != "" {
+		req.Header.Set("X-OpAuthd-Token", c.token)
+	}
+	r, err := c.stream.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode == 401 {
+		return ErrUnauthorized
+	}
+	if r.StatusCode >= 400 {
+		b, _ := io.ReadAll(r.Body)
+		return fmt.Errorf("server error: %s: %s", r.Status, strings.TrimSpace(string(b)))
+	}
+
+	dec := json.NewDecoder(r.Body)
+	for {
+		var event audit.AuditEvent
+		if err := dec.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		fn(event)
+	}
+}
+
+// Status returns the daemon status
+func (c *Client) Status(ctx context.Context) (protocol.Status, error) {
+	var resp protocol.Status
+	if err := c.doJSON(ctx, "GET", "/v1/status", nil, &resp); err != nil {
+		return protocol.Status{}, err
+	}
+	return resp, nil
+}
+
+// ProbeBackends returns the daemon status with a health check of each sub-backend of a multi-backend daemon
+func (c *Client) ProbeBackends(ctx context.Context) (protocol.Status, error) {
+	var resp protocol.Status
+	if err := c.doJSON(ctx, "GET", "/v1/status?probe=1", nil, &resp); err != nil {
+		return protocol.Status{}, err
+	}
+	return resp, nil
+}
+
+// BackendSummary renders the sub-backends from st for `opx status --backend`
+func BackendSummary(st protocol.Status) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "backend: %s\n", st.Backend)
+	for _, sub := range st.Backends {
+		name := sub.Name
+		if name == "" {
+			name = "-"
+		}
+		fmt.Fprintf(&b, "  %-9s %s", sub.Scheme+"://", name)
+		if sub.Default {
+			b.WriteString(" (default)")
+		}
+		if sub.Health != "" {
+			fmt.Fprintf(&b, " %s", sub.Health)
+		}
+		if sub.Error != "" {
+			fmt.Fprintf(&b, ": %s", sub.Error)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// expiredHitHint is the share of reads finding an expired entry above which `opx status` suggests a longer TTL
+const expiredHitHint = 0.1
+
+// CacheSummary renders the cache counters from st for `opx status`, with the
+// expired-hit ratio as a hint to tune the TTL
+func CacheSummary(st protocol.Status) string {
+	reads := st.Hits + st.Misses
+	ratio := 0.0
+	if reads > 0 {
+		ratio = float64(st.ExpiredHits) / float64(reads)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "cache: %d entries, ttl %ds, %d hits, %d misses\n", st.CacheSize, st.TTLSeconds, st.Hits, st.Misses)
+	if st.MaxValueBytes > 0 {
+		fmt.Fprintf(&b, "cache memory: ~%d bytes, largest value %d bytes (limit %d)\n", st.CacheBytes, st.LargestValueBytes, st.MaxValueBytes)
+	}
+	fmt.Fprintf(&b, "expired hits: %d (%.1f%% of reads), %d removed by cleanup", st.ExpiredHits, ratio*100, st.CleanupRemovedTotal)
+	if st.LastCleanupAt > 0 {
+		fmt.Fprintf(&b, ", last at %s", time.Unix(st.LastCleanupAt, 0).Format(time.RFC3339))
+	}
+	b.WriteString("\n")
+	if ratio >= expiredHitHint {
+		b.WriteString("hint: many reads arrive just after expiry; consider a longer --ttl\n")
+	}
+	return b.String()
+}
+
+// UptimeSummary renders when the daemon started for `opx status`, or "" if it didn't say
+func UptimeSummary(st protocol.Status) string {
+	if st.StartedAt == 0 {
+		return ""
+	}
+	started := time.Unix(st.StartedAt, 0)
+	return fmt.Sprintf("uptime: %s (started %s)\n", time.Duration(st.UptimeSeconds)*time.Second, started.Format(time.RFC3339))
+}
+
+// AuditSummary renders the audit log's health for `opx status`, or "" when audit logging is off
+func AuditSummary(st protocol.Status) string {
+	a := st.Audit
+	if a == nil {
+		return ""
+	}
+	var b strings.Builder
+	if a.Failing {
+		b.WriteString("audit log: FAILING")
+		if a.LastError != "" {
+			fmt.Fprintf(&b, " (%s)", a.LastError)
+		}
+	} else {
+		b.WriteString("audit log: ok")
+	}
+	if a.DroppedEvents > 0 {
+		fmt.Fprintf(&b, ", %d events dropped", a.DroppedEvents)
+	}
+	if a.Failing && a.Required {
+		b.WriteString("; reads are refused until it recovers")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// SessionSummary renders the session state for `opx status`: who the 1Password CLI is
+// signed in as, or why the session is locked. It is empty without session management.
+func SessionSummary(st protocol.Status) string {
+	ss := st.Session
+	if ss == nil {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "session: %s", ss.State)
+	if a := ss.Account; a != nil {
+		name := a.Email
+		if name == "" {
+			name = a.UUID
+		}
+		fmt.Fprintf(&b, " as %s", name)
+		if a.URL != "" {
+			fmt.Fprintf(&b, " (%s)", a.URL)
+		}
+	}
+	if ss.LockReason != "" && ss.State != "authenticated" {
+		fmt.Fprintf(&b, ": %s", ss.LockReason)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// SessionInfo returns the session status, or nil if session management is disabled
+func (c *Client) SessionInfo(ctx context.Context) (*SessionInfo, error) {
+	status, err := c.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if status.Session == nil {
+		return nil, nil
+	}
+	return &SessionInfo{
+		State:         status.Session.State,
+		Enabled:       status.Session.Enabled,
+		IdleTimeout:   time.Duration(status.Session.IdleTimeout) * time.Second,
+		TimeUntilLock: time.Duration(status.Session.TimeUntilLock) * time.Second,
+	}, nil
+}
+
+// ReloadSession has the daemon re-read the session config file and apply its idle timeout
+func (c *Client) ReloadSession(ctx context.Context) (protocol.SessionReloadResponse, error) {
+	var resp protocol.SessionReloadResponse
+	err := c.doJSON(ctx, "POST", "/v1/session/reload", struct{}{}, &resp)
+	var se *StatusError
+	if errors.As(err, &se) && json.Unmarshal([]byte(se.Body), &resp) == nil && resp.Message != "" {
+		return resp, errors.New(resp.Message)
+	}
+	return resp, err
+}
+
+// TouchSession resets the daemon's idle timer and returns the time until the session locks
+func (c *Client) TouchSession(ctx context.Context) (time.Duration, error) {
+	var resp protocol.SessionTouchResponse
+	if err := c.doJSON(ctx, "POST", "/v1/session/touch", struct{}{}, &resp); err != nil {
+		var se *StatusError
+		if errors.As(err, &se) && se.Code == http.StatusConflict {
+			return 0, ErrSessionLocked
+		}
+		return 0, err
+	}
+	return time.Duration(resp.TimeUntilLock) * time.Second, nil
+}
+
+// SessionEvent is a session state reported by WatchSession
+type SessionEvent struct {
+	Seq           uint64
+	State         string
+	TimeUntilLock time.Duration
+}
+
+// sessionPollTimeout is how long each WatchSession long-poll waits on the daemon
+const sessionPollTimeout = 30 * time.Second
+
+// WatchSession calls fn with the current session state and then once per state
+// change, long-polling /v1/session/events until ctx is cancelled. It returns nil
+// on cancellation and the first request error otherwise.
+func (c *Client) WatchSession(ctx context.Context, fn func(SessionEvent)) error {
+	path := "/v1/session/events"
+	for first := true; ; first = false {
+		var resp protocol.SessionEventResponse
+		if err := c.doJSONWith(ctx, c.stream, "GET", path, nil, &resp); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		// The first poll reports the current state; later ones only changes
+		if first || resp.Changed {
+			fn(SessionEvent{Seq: resp.Seq, State: resp.State, TimeUntilLock: time.Duration(resp.TimeUntilLock) * time.Second})
+		}
+		path = fmt.Sprintf("/v1/session/events?since=%d&timeout=%s", resp.Seq, sessionPollTimeout)
+	}
+}
+
+// KeepAlive touches the session every interval until ctx is cancelled.
+// It returns nil on cancellation and the first touch error otherwise.
+func (c *Client) KeepAlive(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if _, err := c.TouchSession(ctx); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+}
+
 func (c *Client) EnsureReady(ctx context.Context) error {
-	return c.ensureDaemon(ctx)
+	if c.Timing == nil {
+		return c.ensureDaemon(ctx)
+	}
+	return c.Timing.measure(&c.Timing.Ensure, func() error {
+		return c.ensureDaemon(ctx)
+	})
 }
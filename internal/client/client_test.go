@@ -0,0 +1,473 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/protocol"
+	"github.com/zach-source/opx/internal/session"
+)
+
+// newTestClient points a Client at an httptest server instead of the Unix socket
+func newTestClient(ts *httptest.Server) *Client {
+	return &Client{http: ts.Client(), stream: ts.Client(), base: ts.URL, token: "test"}
+}
+
+func TestClient_KeepAliveStopsOnCancel(t *testing.T) {
+	var touches int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/session/touch" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		atomic.AddInt32(&touches, 1)
+		_ = json.NewEncoder(w).Encode(protocol.SessionTouchResponse{Success: true, State: "authenticated", TimeUntilLock: 3600})
+	}))
+	defer ts.Close()
+
+	c := newTestClient(ts)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- c.KeepAlive(ctx, 10*time.Millisecond) }()
+
+	time.Sleep(55 * time.Millisecond)
+	// Simulate the child process exiting
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected nil on cancellation, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("KeepAlive did not stop after cancellation")
+	}
+
+	after := atomic.LoadInt32(&touches)
+	if after == 0 {
+		t.Fatal("Expected at least one touch while running")
+	}
+	time.Sleep(40 * time.Millisecond)
+	if atomic.LoadInt32(&touches) != after {
+		t.Error("Expected no touches after KeepAlive stopped")
+	}
+}
+
+func TestClient_KeepAliveLockedSession(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(protocol.SessionTouchResponse{Success: false, State: "locked"})
+	}))
+	defer ts.Close()
+
+	err := newTestClient(ts).KeepAlive(context.Background(), 5*time.Millisecond)
+	if !errors.Is(err, ErrSessionLocked) {
+		t.Errorf("Expected ErrSessionLocked, got %v", err)
+	}
+}
+
+func TestClient_WatchSession(t *testing.T) {
+	manager := session.NewManager(session.DefaultConfig())
+	manager.MarkAuthenticated()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/session/events" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		info := manager.GetInfo()
+		changed := false
+		if v := r.URL.Query().Get("since"); v != "" {
+			since, _ := strconv.ParseUint(v, 10, 64)
+			info = manager.WaitForChange(r.Context(), since)
+			changed = info.Seq != since
+		}
+		_ = json.NewEncoder(w).Encode(protocol.SessionEventResponse{Seq: info.Seq, State: info.State.String(), Changed: changed})
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan SessionEvent, 10)
+	done := make(chan error, 1)
+	go func() { done <- newTestClient(ts).WatchSession(ctx, func(e SessionEvent) { events <- e }) }()
+
+	next := func() SessionEvent {
+		t.Helper()
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for a session event")
+			return SessionEvent{}
+		}
+	}
+
+	if e := next(); e.Seq != 1 || e.State != "authenticated" {
+		t.Errorf("Expected the current state first, got %+v", e)
+	}
+	manager.MarkLocked()
+	if e := next(); e.Seq != 2 || e.State != "locked" {
+		t.Errorf("Expected seq 2 locked, got %+v", e)
+	}
+	manager.MarkAuthenticated()
+	if e := next(); e.Seq != 3 || e.State != "authenticated" {
+		t.Errorf("Expected seq 3 authenticated, got %+v", e)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected nil on cancellation, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("WatchSession did not stop after cancellation")
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected each transition exactly once, got extra %+v", <-events)
+	}
+}
+
+func TestClient_SessionInfoTyped(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(protocol.Status{
+			Backend: "fake",
+			Session: &protocol.SessionStatus{State: "authenticated", IdleTimeout: 7200, TimeUntilLock: 90, Enabled: true},
+		})
+	}))
+	defer ts.Close()
+
+	info, err := newTestClient(ts).SessionInfo(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if info.TimeUntilLock != 90*time.Second || info.IdleTimeout != 2*time.Hour {
+		t.Errorf("Unexpected typed durations: %+v", info)
+	}
+}
+
+func TestCacheSummary(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   protocol.Status
+		contains string
+		hint     bool
+	}{
+		{name: "no reads", status: protocol.Status{TTLSeconds: 300}, contains: "expired hits: 0 (0.0% of reads)"},
+		{name: "low ratio", status: protocol.Status{Hits: 95, Misses: 5, ExpiredHits: 2}, contains: "expired hits: 2 (2.0% of reads)"},
+		{name: "value sizes", status: protocol.Status{CacheBytes: 4096, LargestValueBytes: 2048, MaxValueBytes: 1 << 20}, contains: "cache memory: ~4096 bytes, largest value 2048 bytes (limit 1048576)"},
+		{name: "high ratio", status: protocol.Status{Hits: 6, Misses: 4, ExpiredHits: 3, CleanupRemovedTotal: 7}, contains: "expired hits: 3 (30.0% of reads), 7 removed by cleanup", hint: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CacheSummary(tt.status)
+			if !strings.Contains(got, tt.contains) {
+				t.Errorf("Expected summary to contain %q, got %q", tt.contains, got)
+			}
+			if strings.Contains(got, "hint:") != tt.hint {
+				t.Errorf("Expected hint=%v, got %q", tt.hint, got)
+			}
+		})
+	}
+}
+
+func TestAuditSummary(t *testing.T) {
+	tests := []struct {
+		name     string
+		audit    *protocol.AuditStatus
+		expected string
+	}{
+		{name: "audit off"},
+		{name: "healthy", audit: &protocol.AuditStatus{}, expected: "audit log: ok\n"},
+		{name: "recovered", audit: &protocol.AuditStatus{DroppedEvents: 3}, expected: "audit log: ok, 3 events dropped\n"},
+		{
+			name:     "failing",
+			audit:    &protocol.AuditStatus{Failing: true, DroppedEvents: 2, LastError: "disk full"},
+			expected: "audit log: FAILING (disk full), 2 events dropped\n",
+		},
+		{
+			name:     "failing and required",
+			audit:    &protocol.AuditStatus{Required: true, Failing: true, DroppedEvents: 1},
+			expected: "audit log: FAILING, 1 events dropped; reads are refused until it recovers\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AuditSummary(protocol.Status{Audit: tt.audit}); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestUptimeSummary(t *testing.T) {
+	st := protocol.Status{StartedAt: 1700000000, UptimeSeconds: 3725}
+	expected := "uptime: 1h2m5s (started " + time.Unix(1700000000, 0).Format(time.RFC3339) + ")\n"
+	if got := UptimeSummary(st); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+	if got := UptimeSummary(protocol.Status{}); got != "" {
+		t.Errorf("Expected nothing without a start time, got %q", got)
+	}
+}
+
+func TestSessionSummary(t *testing.T) {
+	tests := []struct {
+		name     string
+		session  *protocol.SessionStatus
+		expected string
+	}{
+		{name: "no session management", expected: ""},
+		{
+			name:     "signed in",
+			session:  &protocol.SessionStatus{State: "authenticated", Account: &protocol.SessionAccount{UUID: "ACCT1", Email: "j***@acme.com", URL: "https://acme.1password.com"}},
+			expected: "session: authenticated as j***@acme.com (https://acme.1password.com)\n",
+		},
+		{
+			name:     "wrong account",
+			session:  &protocol.SessionStatus{State: "locked", Account: &protocol.SessionAccount{UUID: "ACCT1"}, LockReason: "not the expected account"},
+			expected: "session: locked as ACCT1: not the expected account\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SessionSummary(protocol.Status{Session: tt.session}); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestBackendSummary(t *testing.T) {
+	st := protocol.Status{
+		Backend: "multi",
+		Backends: []protocol.BackendStatus{
+			{Scheme: "op", Name: "opcli", Default: true, Health: protocol.HealthUnknown},
+			{Scheme: "vault", Name: "vault", Health: protocol.HealthError, Error: "connection refused"},
+			{Scheme: "bao", Health: protocol.HealthUnconfigured},
+		},
+	}
+
+	expected := "backend: multi\n" +
+		"  op://     opcli (default) unknown\n" +
+		"  vault://  vault error: connection refused\n" +
+		"  bao://    - unconfigured\n"
+	if got := BackendSummary(st); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	if got := BackendSummary(protocol.Status{Backend: "opcli"}); got != "backend: opcli\n" {
+		t.Errorf("Expected single backend line, got %q", got)
+	}
+}
+
+func TestClient_DebugHeader(t *testing.T) {
+	for _, debug := range []bool{false, true} {
+		var got string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header.Get(protocol.DebugHeader)
+			_, _ = w.Write([]byte(`{"ref":"op://v/i/f","value":"x"}`))
+		}))
+		c := newTestClient(ts)
+		c.Debug = debug
+		if _, err := c.Read(context.Background(), "op://v/i/f"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ts.Close()
+
+		expected := ""
+		if debug {
+			expected = "1"
+		}
+		if got != expected {
+			t.Errorf("Debug=%v: expected header %q, got %q", debug, expected, got)
+		}
+	}
+}
+
+func TestDaemonCommand_PassesSocket(t *testing.T) {
+	cmd := daemonCommand(context.Background(), "/usr/local/bin/opx-authd", "/run/custom/opx.sock")
+	expected := []string{"/usr/local/bin/opx-authd", "--sock", "/run/custom/opx.sock"}
+	if strings.Join(cmd.Args, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected %v, got %v", expected, cmd.Args)
+	}
+}
+
+func TestDaemonEnviron(t *testing.T) {
+	environ := []string{"HOME=/home/me", "PATH=/bin", "OPX_SOCKET=/s", "VAULT_ROLE_ID=r", "OP_ACCOUNT=acme", "OP_SESSION_acme=stale", "AWS_SECRET_ACCESS_KEY=x", "AWS_PROFILE=dev"}
+	got := daemonEnviron(environ, []string{"AWS_PROFILE"})
+	expected := []string{"HOME=/home/me", "PATH=/bin", "OPX_SOCKET=/s", "VAULT_ROLE_ID=r", "OP_ACCOUNT=acme", "AWS_PROFILE=dev"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	if got := daemonEnviron(environ, []string{"*"}); got != nil {
+		t.Errorf("Expected * to inherit the whole environment, got %v", got)
+	}
+}
+
+func TestSocketMismatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		reported string
+		mismatch bool
+	}{
+		{name: "same socket", reported: "/run/custom/opx.sock"},
+		{name: "older daemon without socket_path", reported: ""},
+		{name: "different socket", reported: "/home/me/.local/share/op-authd/socket.sock", mismatch: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warning := SocketMismatch(protocol.Status{SocketPath: tt.reported}, "/run/custom/opx.sock")
+			if (warning != "") != tt.mismatch {
+				t.Errorf("Expected mismatch %v, got %q", tt.mismatch, warning)
+			}
+			if tt.mismatch && !strings.Contains(warning, tt.reported) {
+				t.Errorf("Expected warning to name %s, got %q", tt.reported, warning)
+			}
+		})
+	}
+}
+
+func TestDialDaemon_DeadSockets(t *testing.T) {
+	// A socket file left behind by a crashed daemon refuses connections
+	stale := filepath.Join(t.TempDir(), "stale.sock")
+	l, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	// A bound socket whose owner never answers: the kernel accepts the
+	// connection but the TLS handshake gets no reply
+	hung := filepath.Join(t.TempDir(), "hung.sock")
+	hl, err := net.Listen("unix", hung)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer hl.Close()
+
+	for name, sock := range map[string]string{"stale socket file": stale, "unresponsive listener": hung} {
+		t.Run(name, func(t *testing.T) {
+			start := time.Now()
+			_, err := dialDaemon(context.Background(), sock, &tls.Config{ServerName: "op-authd-local"}, 200*time.Millisecond)
+			if !errors.Is(err, ErrDaemonUnreachable) {
+				t.Errorf("Expected ErrDaemonUnreachable, got %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("Expected a prompt failure, took %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestClient_UnresponsiveSocketIsUnreachable(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "hung.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer l.Close()
+	t.Setenv("OPX_AUTOSTART", "0")
+
+	c := &Client{base: "https://unix", sock: sock, SocketTimeout: 100 * time.Millisecond}
+	c.http = &http.Client{Transport: &http.Transport{
+		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialDaemon(ctx, sock, &tls.Config{ServerName: "op-authd-local"}, c.socketTimeout())
+		},
+	}}
+
+	err = c.EnsureReady(context.Background())
+	if !errors.Is(err, ErrDaemonUnreachable) {
+		t.Fatalf("Expected ErrDaemonUnreachable, got %v", err)
+	}
+	if code := ExitCode(err); code != ExitUnreachable {
+		t.Errorf("Expected exit code %d, got %d", ExitUnreachable, code)
+	}
+}
+
+// fakeDaemon serves TLS on a unix socket in its own temp dir, next to a token
+// file, and only accepts /v1/status with that token
+func fakeDaemon(t *testing.T, token string) string {
+	t.Helper()
+	dir := t.TempDir()
+	sock := filepath.Join(dir, "socket.sock")
+	if err := os.WriteFile(filepath.Join(dir, "token"), []byte(token), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/status" && r.Header.Get("X-OpAuthd-Token") != token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		}
+	}))
+	ts.Listener = l
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return sock
+}
+
+func TestClient_EnsureReadyFindsLiveSocket(t *testing.T) {
+	t.Setenv("OPX_AUTOSTART", "0")
+	dead := filepath.Join(t.TempDir(), "socket.sock")
+
+	tests := []struct {
+		name     string
+		primary  string
+		legacy   string
+		expected string // socket the client ends up dialing; "" means unreachable
+		split    bool
+	}{
+		{name: "only legacy alive", primary: dead, legacy: fakeDaemon(t, "legacy-token"), expected: "legacy"},
+		{name: "both alive prefers primary", primary: fakeDaemon(t, "primary-token"), legacy: fakeDaemon(t, "legacy-token"), expected: "primary", split: true},
+		{name: "only primary alive", primary: fakeDaemon(t, "primary-token"), legacy: dead, expected: "primary"},
+		{name: "neither alive", primary: dead, legacy: filepath.Join(t.TempDir(), "socket.sock")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{base: "https://unix", token: "primary-token", sock: tt.primary, SocketTimeout: time.Second,
+				tls: &tls.Config{InsecureSkipVerify: true}, alternates: []string{tt.legacy}}
+			c.http = &http.Client{Transport: &http.Transport{
+				DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					return dialDaemon(ctx, c.sock, c.tls, c.socketTimeout())
+				},
+			}}
+
+			err := c.EnsureReady(context.Background())
+			if tt.expected == "" {
+				if !errors.Is(err, ErrDaemonUnreachable) {
+					t.Fatalf("Expected ErrDaemonUnreachable, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			expected := map[string]string{"primary": tt.primary, "legacy": tt.legacy}[tt.expected]
+			if c.SocketPath() != expected {
+				t.Errorf("Expected socket %s, got %s", expected, c.SocketPath())
+			}
+			warning := c.SplitDaemonsWarning()
+			if (warning != "") != tt.split {
+				t.Errorf("Expected split warning %v, got %q", tt.split, warning)
+			}
+			if tt.split && (!strings.Contains(warning, tt.primary) || !strings.Contains(warning, tt.legacy)) {
+				t.Errorf("Expected warning to name both sockets, got %q", warning)
+			}
+		})
+	}
+}
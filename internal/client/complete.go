@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+// recentCompletionLimit is how many recent refs completion asks the daemon for
+const recentCompletionLimit = 200
+
+// RecentRefs lists up to limit refs clients recently read that this caller may read, most recent first
+func (c *Client) RecentRefs(ctx context.Context, limit int) (protocol.RecentRefsResponse, error) {
+	var resp protocol.RecentRefsResponse
+	if err := c.doJSON(ctx, "GET", fmt.Sprintf("/v1/refs/recent?limit=%d", limit), nil, &resp); err != nil {
+		return protocol.RecentRefsResponse{}, err
+	}
+	return resp, nil
+}
+
+// opOutput runs the op CLI and returns its stdout; tests replace it
+var opOutput = func(ctx context.Context, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, "op", args...).Output()
+}
+
+// CompleteRef returns candidates for a ref being typed: refs this machine read
+// recently, or when none match, op:// vaults and items listed by the op CLI
+func (c *Client) CompleteRef(ctx context.Context, prefix string, opFlags []string) []string {
+	var out []string
+	if recent, err := c.RecentRefs(ctx, recentCompletionLimit); err == nil {
+		for _, ref := range recent.Refs {
+			if strings.HasPrefix(ref, prefix) {
+				out = append(out, ref)
+			}
+		}
+	}
+	if len(out) > 0 {
+		return out
+	}
+	for _, ref := range listOpRefs(ctx, prefix, opFlags) {
+		if strings.HasPrefix(ref, prefix) {
+			out = append(out, ref)
+		}
+	}
+	return out
+}
+
+// listOpRefs lists op://VAULT/ while the vault is being typed and op://VAULT/ITEM/ once it is
+func listOpRefs(ctx context.Context, prefix string, opFlags []string) []string {
+	rest, ok := strings.CutPrefix(prefix, "op://")
+	if !ok {
+		if strings.HasPrefix("op://", prefix) {
+			rest = ""
+		} else {
+			return nil
+		}
+	}
+	vault, item, inItem := strings.Cut(rest, "/")
+	if inItem && strings.Contains(item, "/") {
+		return nil // fields need the item itself; too slow for completion
+	}
+
+	var entries []struct {
+		Name  string `json:"name"`
+		Title string `json:"title"`
+	}
+	args := []string{"vault", "list", "--format", "json"}
+	if inItem {
+		args = []string{"item", "list", "--vault", vault, "--format", "json"}
+	}
+	b, err := opOutput(ctx, append(args, opFlags...)...)
+	if err != nil || json.Unmarshal(b, &entries) != nil {
+		return nil
+	}
+	refs := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if inItem {
+			refs = append(refs, "op://"+vault+"/"+e.Title+"/")
+		} else {
+			refs = append(refs, "op://"+e.Name+"/")
+		}
+	}
+	return refs
+}
+
+// BashCompletion is the script `opx completion bash` prints; it completes
+// subcommands and, for read, refs through `opx __complete-ref`
+const BashCompletion = `# opx bash completion; load with: source <(opx completion bash)
+_opx_complete() {
+	local word=${COMP_WORDS[COMP_CWORD]}
+	if [[ $COMP_CWORD -eq 1 ]]; then
+		COMPREPLY=($(compgen -W "read resolve run create status why cache audit login vault-login doctor paths completion" -- "$word"))
+		return
+	fi
+	[[ ${COMP_WORDS[1]} == read && $word != -* ]] || return
+	# bash splits words at ':', so complete the whole ref and trim what precedes the current word
+	local line=${COMP_LINE:0:COMP_POINT}
+	local cur=${line##*[[:space:]]}
+	local strip=$(( ${#cur} - ${#word} )) i
+	local IFS=$'\n'
+	COMPREPLY=($(opx __complete-ref "$cur" 2>/dev/null))
+	for i in "${!COMPREPLY[@]}"; do
+		COMPREPLY[i]=${COMPREPLY[i]:strip}
+	done
+	compopt -o nospace 2>/dev/null
+}
+complete -F _opx_complete opx
+`
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+func TestClient_CompleteRef(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(protocol.RecentRefsResponse{Refs: []string{"op://dev/api/key", "op://prod/db/password"}})
+	}))
+	defer ts.Close()
+	c := newTestClient(ts)
+
+	saved := opOutput
+	defer func() { opOutput = saved }()
+	opOutput = func(ctx context.Context, args ...string) ([]byte, error) {
+		switch strings.Join(args[:2], " ") {
+		case "vault list":
+			return []byte(`[{"name":"dev"},{"name":"staging"}]`), nil
+		case "item list":
+			return []byte(`[{"title":"web"},{"title":"worker"}]`), nil
+		}
+		return nil, nil
+	}
+
+	tests := []struct {
+		prefix   string
+		expected []string
+	}{
+		{prefix: "op://", expected: []string{"op://dev/api/key", "op://prod/db/password"}},
+		{prefix: "op://prod", expected: []string{"op://prod/db/password"}},
+		{prefix: "op://st", expected: []string{"op://staging/"}},
+		{prefix: "op://staging/w", expected: []string{"op://staging/web/", "op://staging/worker/"}},
+		{prefix: "op://staging/web/", expected: nil},
+		{prefix: "env:", expected: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			if got := c.CompleteRef(context.Background(), tt.prefix, nil); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
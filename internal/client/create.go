@@ -0,0 +1,49 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+// GenerateValue in a FIELD=VALUE assignment asks the backend to generate the value
+const GenerateValue = "op://generate"
+
+// ParseItemFields parses FIELD=VALUE assignments as given to `opx create`
+func ParseItemFields(assignments []string) ([]protocol.CreateField, error) {
+	fields := make([]protocol.CreateField, 0, len(assignments))
+	for _, kv := range assignments {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("bad field: %s", kv)
+		}
+		if value == GenerateValue {
+			fields = append(fields, protocol.CreateField{Name: name, Generate: true})
+			continue
+		}
+		fields = append(fields, protocol.CreateField{Name: name, Value: value})
+	}
+	return fields, nil
+}
+
+// FormatCreatePlan describes what a dry-run create would do, without field values
+func FormatCreatePlan(resp protocol.CreateResponse) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "would create %s", resp.Ref)
+	if resp.Account != "" {
+		fmt.Fprintf(&b, " in account %s", resp.Account)
+	}
+	b.WriteString("\n")
+	for _, f := range resp.Fields {
+		if f.Generate {
+			fmt.Fprintf(&b, "  %s (generated)\n", f.Name)
+		} else {
+			fmt.Fprintf(&b, "  %s\n", f.Name)
+		}
+	}
+	if resp.RequiresApproval {
+		b.WriteString("a policy rule would hold the create until an admin runs opx approve\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+func TestParseItemFields(t *testing.T) {
+	tests := []struct {
+		name        string
+		assignments []string
+		expected    []protocol.CreateField
+		wantErr     bool
+	}{
+		{
+			name:        "literal and generated",
+			assignments: []string{"username=deploy", "password=op://generate"},
+			expected:    []protocol.CreateField{{Name: "username", Value: "deploy"}, {Name: "password", Generate: true}},
+		},
+		{name: "value keeps later equals", assignments: []string{"dsn=a=b"}, expected: []protocol.CreateField{{Name: "dsn", Value: "a=b"}}},
+		{name: "empty value", assignments: []string{"note="}, expected: []protocol.CreateField{{Name: "note"}}},
+		{name: "missing equals", assignments: []string{"password"}, wantErr: true},
+		{name: "missing name", assignments: []string{"=value"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseItemFields(tt.assignments)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseItemFields failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFormatCreatePlan(t *testing.T) {
+	resp := protocol.CreateResponse{
+		Ref:              "op://dev/MyApp",
+		DryRun:           true,
+		Account:          "acme.1password.com",
+		Fields:           []protocol.CreateField{{Name: "username"}, {Name: "password", Generate: true}},
+		RequiresApproval: true,
+	}
+	expected := "would create op://dev/MyApp in account acme.1password.com\n" +
+		"  username\n" +
+		"  password (generated)\n" +
+		"a policy rule would hold the create until an admin runs opx approve\n"
+	if got := FormatCreatePlan(resp); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+// Denial returns the policy_denied error response err carries, or nil
+func Denial(err error) *protocol.ErrorResponse {
+	var se *StatusError
+	if !errors.As(err, &se) {
+		return nil
+	}
+	var body protocol.ErrorResponse
+	if json.Unmarshal([]byte(se.Body), &body) != nil || body.Code != protocol.ErrCodePolicyDenied {
+		return nil
+	}
+	return &body
+}
+
+// FormatDenial renders a policy denial for the CLI with the daemon's hint on a
+// line of its own; verbose adds the denied ref and the audit log to look in.
+// It returns "" when err is not a policy denial.
+func FormatDenial(prefix string, err error, verbose bool, auditLog string) string {
+	d := Denial(err)
+	if d == nil {
+		return ""
+	}
+	var b strings.Builder
+	if prefix != "" {
+		b.WriteString(prefix + ": ")
+	}
+	b.WriteString("access denied by policy\n")
+	hint := d.Hint
+	if hint == "" {
+		// Older daemons only send the hint inside the message
+		hint = strings.TrimPrefix(strings.TrimPrefix(d.Message, "access denied by policy"), ": ")
+	}
+	if hint != "" {
+		fmt.Fprintf(&b, "\n  %s\n\n", hint)
+	}
+	if verbose {
+		if d.Ref != "" {
+			fmt.Fprintf(&b, "ref: %s\n", d.Ref)
+		}
+		if auditLog != "" {
+			fmt.Fprintf(&b, "audit log: %s\n", auditLog)
+		}
+	}
+	return b.String()
+}
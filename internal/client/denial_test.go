@@ -0,0 +1,42 @@
+package client
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFormatDenial(t *testing.T) {
+	denied := &StatusError{Code: 403, Status: "403 Forbidden", Body: `{"code":"policy_denied","message":"access denied by policy: run opx audit --interactive as an admin","ref":"op://prod/db/password","hint":"run opx audit --interactive as an admin"}`}
+
+	out := FormatDenial("read", denied, false, "/data/audit-2026-10-16.log")
+	if !strings.HasPrefix(out, "read: access denied by policy\n") || !strings.Contains(out, "\n  run opx audit --interactive as an admin\n") {
+		t.Errorf("Expected the hint on its own line, got:\n%s", out)
+	}
+	if strings.Contains(out, "ref:") || strings.Contains(out, "audit log:") {
+		t.Errorf("Expected no ref or audit log without verbose, got:\n%s", out)
+	}
+
+	out = FormatDenial("read", denied, true, "/data/audit-2026-10-16.log")
+	for _, want := range []string{"ref: op://prod/db/password\n", "audit log: /data/audit-2026-10-16.log\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected verbose output to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	// Older daemons send the hint only in the message
+	old := &StatusError{Code: 403, Body: `{"code":"policy_denied","message":"access denied by policy: ask in #secrets"}`}
+	if out := FormatDenial("", old, false, ""); !strings.Contains(out, "\n  ask in #secrets\n") {
+		t.Errorf("Expected the hint taken from the message, got:\n%s", out)
+	}
+
+	for _, err := range []error{
+		errors.New("boom"),
+		&StatusError{Code: 404, Body: `{"code":"not_found","message":"not found"}`},
+		&StatusError{Code: 403, Body: "forbidden"},
+	} {
+		if out := FormatDenial("read", err, true, ""); out != "" {
+			t.Errorf("Expected no denial output for %v, got %q", err, out)
+		}
+	}
+}
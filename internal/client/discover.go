@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zach-source/opx/internal/util"
+)
+
+// SocketProbe is one socket a daemon may be serving and whether it answered
+type SocketProbe struct {
+	Path  string
+	Alive bool
+}
+
+// alternateSockets are the default sockets other than sock; with $OPX_SOCKET
+// the client only ever dials that one
+func alternateSockets(sock string) []string {
+	if os.Getenv(util.SocketEnv) != "" {
+		return nil
+	}
+	var out []string
+	for _, p := range util.DefaultSocketPaths() {
+		if p != sock {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// probeReady reports whether a daemon answers GET /readyz on sock. Any HTTP
+// response counts, so a daemon that predates /readyz is found too.
+func probeReady(ctx context.Context, sock string, tlsConfig *tls.Config, timeout time.Duration) bool {
+	if fi, err := os.Stat(sock); err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return false
+	}
+	hc := &http.Client{Timeout: timeout, Transport: &http.Transport{
+		DisableKeepAlives: true,
+		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialDaemon(ctx, sock, tlsConfig, timeout)
+		},
+	}}
+	req, _ := http.NewRequestWithContext(ctx, "GET", "https://unix/readyz", nil)
+	r, err := hc.Do(req)
+	if err != nil {
+		return false
+	}
+	r.Body.Close()
+	return true
+}
+
+// ProbeSockets checks the socket the client dials and the other default sockets
+func (c *Client) ProbeSockets(ctx context.Context) []SocketProbe {
+	probes := []SocketProbe{{Path: c.sock, Alive: probeReady(ctx, c.sock, c.tls, c.socketTimeout())}}
+	for _, sock := range c.alternates {
+		probes = append(probes, SocketProbe{Path: sock, Alive: probeReady(ctx, sock, c.tls, c.socketTimeout())})
+	}
+	return probes
+}
+
+// useLiveSocket points the client at the first responding socket, preferring
+// the one it was configured with (known alive when primaryAlive), and records a
+// warning when more than one responds. It reports whether any did.
+func (c *Client) useLiveSocket(ctx context.Context, primaryAlive bool) bool {
+	var live []string
+	if primaryAlive || probeReady(ctx, c.sock, c.tls, c.socketTimeout()) {
+		live = append(live, c.sock)
+	}
+	for _, sock := range c.alternates {
+		if probeReady(ctx, sock, c.tls, c.socketTimeout()) {
+			live = append(live, sock)
+		}
+	}
+	if len(live) == 0 {
+		return false
+	}
+	if live[0] != c.sock {
+		c.sock = live[0]
+		if tok, err := os.ReadFile(filepath.Join(filepath.Dir(c.sock), "token")); err == nil {
+			c.token = string(tok)
+		}
+	}
+	c.splitWarning = SplitDaemons(live)
+	return true
+}
+
+// SplitDaemonsWarning describes daemons serving more than one socket at once, or "" if there aren't any
+func (c *Client) SplitDaemonsWarning() string {
+	return c.splitWarning
+}
+
+// SplitDaemons describes daemons alive on more than one socket, or "" for fewer than two
+func SplitDaemons(live []string) string {
+	if len(live) < 2 {
+		return ""
+	}
+	return fmt.Sprintf("daemons are running on %s; each keeps its own session, cache and token and the client uses %s. Run opx doctor --sockets to consolidate", strings.Join(live, " and "), live[0])
+}
+
+// ConsolidationAdvice explains how to get from the probed sockets down to one
+// daemon on the XDG socket, or "" when there is nothing to do
+func ConsolidationAdvice(probes []SocketProbe) string {
+	legacy := filepath.Join(util.LegacyDir(), "socket.sock")
+	var live []string
+	legacyLive := false
+	for _, p := range probes {
+		if p.Alive {
+			live = append(live, p.Path)
+			legacyLive = legacyLive || p.Path == legacy
+		}
+	}
+	if len(live) < 2 && !legacyLive {
+		return ""
+	}
+
+	var b strings.Builder
+	if len(live) > 1 {
+		fmt.Fprintf(&b, "%d daemons are running; clients may reach different ones.\n", len(live))
+	} else {
+		fmt.Fprintf(&b, "Only the legacy daemon on %s is running.\n", legacy)
+	}
+	b.WriteString("To consolidate on the XDG directories:\n")
+	b.WriteString("  1. opx-authd migrate   (copies token, TLS files and configs out of ~/.op-authd)\n")
+	b.WriteString("  2. stop every daemon, e.g. pkill -x op-authd; pkill -x opx-authd\n")
+	fmt.Fprintf(&b, "  3. rm -rf %s   (once the copies check out)\n", util.LegacyDir())
+	b.WriteString("  4. opx status   (autostarts a single daemon on the XDG socket)\n")
+	return b.String()
+}
@@ -0,0 +1,180 @@
+package client
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zach-source/opx/internal/protocol"
+	"github.com/zach-source/opx/internal/util"
+)
+
+// ParseEnvMappings parses NAME=REF pairs as given to `opx resolve` and `opx run --env`
+func ParseEnvMappings(mappings []string) (map[string]string, error) {
+	env := make(map[string]string, len(mappings))
+	for _, kv := range mappings {
+		name, ref, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("bad mapping: %s", kv)
+		}
+		env[name] = ref
+	}
+	return env, nil
+}
+
+// EnvNames returns the names of NAME=REF mappings in the order given, each once
+func EnvNames(mappings []string) []string {
+	var names []string
+	for _, kv := range mappings {
+		name, _, _ := strings.Cut(kv, "=")
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// EnvVars returns the process environment as a map, for expanding refs with `opx --expand-env`
+func EnvVars() map[string]string {
+	vars := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if name, value, ok := strings.Cut(kv, "="); ok {
+			vars[name] = value
+		}
+	}
+	return vars
+}
+
+// OnlyMissing drops mappings whose NAME is already set in vars, even to an
+// empty value, for `--only-missing`. It returns the kept mappings and the
+// sorted names left untouched.
+func OnlyMissing(env map[string]string, vars map[string]string) (map[string]string, []string) {
+	kept := make(map[string]string, len(env))
+	var skipped []string
+	for name, ref := range env {
+		if _, set := vars[name]; set {
+			skipped = append(skipped, name)
+			continue
+		}
+		kept[name] = ref
+	}
+	sort.Strings(skipped)
+	return kept, skipped
+}
+
+// ExpandRefs returns refs with ${VAR} and $VAR replaced from vars
+func ExpandRefs(refs []string, vars map[string]string) ([]string, error) {
+	out := make([]string, len(refs))
+	for i, ref := range refs {
+		expanded, err := util.ExpandRefVars(ref, vars)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = expanded
+	}
+	return out, nil
+}
+
+// ExpandEnvMappings returns a copy of env with variables in each ref replaced from vars
+func ExpandEnvMappings(env map[string]string, vars map[string]string) (map[string]string, error) {
+	out := make(map[string]string, len(env))
+	for name, ref := range env {
+		expanded, err := util.ExpandRefVars(ref, vars)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		out[name] = expanded
+	}
+	return out, nil
+}
+
+// argRefSchemes are the ref prefixes `opx run --resolve-args` recognizes in CMD's arguments
+var argRefSchemes = []string{"op://", "vault://", "bao://"}
+
+// ArgRefs returns the arguments of argv that are whole secret refs, keyed by position.
+// argv[0] is the command itself and is never treated as a ref.
+func ArgRefs(argv []string) map[int]string {
+	refs := make(map[int]string)
+	for i := 1; i < len(argv); i++ {
+		for _, scheme := range argRefSchemes {
+			if strings.HasPrefix(argv[i], scheme) {
+				refs[i] = argv[i]
+				break
+			}
+		}
+	}
+	return refs
+}
+
+// SubstituteArgRefs returns a copy of argv with each ref from ArgRefs replaced by
+// its value from a batch read, failing on the first ref the batch couldn't read
+func SubstituteArgRefs(argv []string, refs map[int]string, results map[string]protocol.ReadResponse) ([]string, error) {
+	out := append([]string(nil), argv...)
+	for _, i := range slices.Sorted(maps.Keys(refs)) {
+		ref := refs[i]
+		rr, ok := results[ref]
+		if !ok {
+			return nil, fmt.Errorf("argument %d: %s was not resolved", i, ref)
+		}
+		if rr.Error != "" {
+			return nil, fmt.Errorf("argument %d: %s: %s", i, ref, rr.Error)
+		}
+		out[i] = rr.Value
+	}
+	return out, nil
+}
+
+// FormatRefDump renders env as NAME=REF lines sorted by name, followed by any
+// argument refs as ARGV[i]=REF in position order, for `opx run --dump-refs`
+func FormatRefDump(env map[string]string, args map[int]string) string {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	positions := make([]int, 0, len(args))
+	for i := range args {
+		positions = append(positions, i)
+	}
+	sort.Ints(positions)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s=%s\n", name, env[name])
+	}
+	for _, i := range positions {
+		fmt.Fprintf(&b, "ARGV[%d]=%s\n", i, args[i])
+	}
+	return b.String()
+}
+
+// FormatResolveMeta renders a freshness table for `opx resolve/run --verbose`, sorted by
+// name. It only shows where each value came from, never the value itself.
+func FormatResolveMeta(meta map[string]protocol.ResolveMeta) string {
+	names := make([]string, 0, len(meta))
+	for name := range meta {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSOURCE\tEXPIRES IN\tRESOLVED AT\tBACKEND")
+	for _, name := range names {
+		m := meta[name]
+		source := "backend"
+		if m.FromCache {
+			source = "cache"
+		}
+		resolved := time.Unix(m.ResolvedAt, 0).UTC().Format(time.RFC3339)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", name, source, time.Duration(m.ExpiresIn)*time.Second, resolved, m.Backend)
+	}
+	_ = tw.Flush()
+	return b.String()
+}
@@ -0,0 +1,213 @@
+package client
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+func TestParseEnvMappings(t *testing.T) {
+	tests := []struct {
+		name     string
+		mappings []string
+		expected map[string]string
+		wantErr  bool
+	}{
+		{name: "empty", mappings: nil, expected: map[string]string{}},
+		{
+			name:     "refs",
+			mappings: []string{"DB_PASS=op://prod/db/password", "API_KEY=vault://secret/api#key"},
+			expected: map[string]string{"DB_PASS": "op://prod/db/password", "API_KEY": "vault://secret/api#key"},
+		},
+		{name: "value keeps later equals", mappings: []string{"Q=op://v/i/f?x=1"}, expected: map[string]string{"Q": "op://v/i/f?x=1"}},
+		{name: "last mapping wins", mappings: []string{"A=op://v/one/f", "A=op://v/two/f"}, expected: map[string]string{"A": "op://v/two/f"}},
+		{name: "missing equals", mappings: []string{"DB_PASS"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEnvMappings(tt.mappings)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseEnvMappings failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFormatRefDump(t *testing.T) {
+	env, err := ParseEnvMappings([]string{"DB_PASS=op://prod/db/password", "API_KEY=vault://secret/api#key"})
+	if err != nil {
+		t.Fatalf("ParseEnvMappings failed: %v", err)
+	}
+
+	expected := "API_KEY=vault://secret/api#key\nDB_PASS=op://prod/db/password\n"
+	if got := FormatRefDump(env, nil); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+	if got := FormatRefDump(nil, nil); got != "" {
+		t.Errorf("Expected empty dump, got %q", got)
+	}
+}
+
+func TestFormatRefDump_ArgSource(t *testing.T) {
+	argv := []string{"op://not/a/ref/cmd", "--password", "op://prod/db/password", "--token=vault://secret/api#key", "bao://kv/app#token", "plain"}
+	args := ArgRefs(argv)
+
+	expectedRefs := map[int]string{2: "op://prod/db/password", 4: "bao://kv/app#token"}
+	if !reflect.DeepEqual(args, expectedRefs) {
+		t.Errorf("Expected %v, got %v", expectedRefs, args)
+	}
+
+	env := map[string]string{"DB_USER": "op://prod/db/username"}
+	expected := "DB_USER=op://prod/db/username\nARGV[2]=op://prod/db/password\nARGV[4]=bao://kv/app#token\n"
+	if got := FormatRefDump(env, args); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestSubstituteArgRefs(t *testing.T) {
+	argv := []string{"psql", "--password", "op://prod/db/password", "db"}
+	refs := ArgRefs(argv)
+
+	got, err := SubstituteArgRefs(argv, refs, map[string]protocol.ReadResponse{"op://prod/db/password": {Value: "s3cret"}})
+	if err != nil {
+		t.Fatalf("SubstituteArgRefs failed: %v", err)
+	}
+	expected := []string{"psql", "--password", "s3cret", "db"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	if argv[2] != "op://prod/db/password" {
+		t.Error("Expected argv to be left unchanged")
+	}
+
+	if _, err := SubstituteArgRefs(argv, refs, nil); err == nil {
+		t.Error("Expected error for unresolved ref")
+	}
+
+	// A ref the batch couldn't read fails the substitution instead of passing its error text on
+	argv = []string{"deploy", "op://prod/api/token", "op://prod/db/password"}
+	refs = ArgRefs(argv)
+	results := map[string]protocol.ReadResponse{
+		"op://prod/api/token":   {Value: "tok"},
+		"op://prod/db/password": {Value: "ERROR: access denied by policy", Error: "access denied by policy"},
+	}
+	got, err = SubstituteArgRefs(argv, refs, results)
+	if got != nil || err == nil || err.Error() != "argument 2: op://prod/db/password: access denied by policy" {
+		t.Errorf("Expected the denied ref to fail, got %v (%v)", got, err)
+	}
+}
+
+func TestFormatResolveMeta(t *testing.T) {
+	meta := map[string]protocol.ResolveMeta{
+		"DB_PASS": {FromCache: true, ExpiresIn: 240, ResolvedAt: 1700000000, Backend: "opcli"},
+		"API_KEY": {FromCache: false, ExpiresIn: 300, ResolvedAt: 1700000060, Backend: "vault"},
+	}
+
+	got := FormatResolveMeta(meta)
+	lines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected header and 2 rows, got %q", got)
+	}
+	if fields := strings.Fields(lines[1]); strings.Join(fields, " ") != "API_KEY backend 5m0s 2023-11-14T22:14:20Z vault" {
+		t.Errorf("Unexpected row for API_KEY: %q", lines[1])
+	}
+	if fields := strings.Fields(lines[2]); strings.Join(fields, " ") != "DB_PASS cache 4m0s 2023-11-14T22:13:20Z opcli" {
+		t.Errorf("Unexpected row for DB_PASS: %q", lines[2])
+	}
+}
+
+func TestExpandEnvMappings(t *testing.T) {
+	vars := map[string]string{"APP": "billing", "ENV": "prod"}
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected map[string]string
+		wantErr  string
+	}{
+		{
+			name:     "expands each ref",
+			env:      map[string]string{"DB": "op://${ENV}/${APP}/password", "KEY": "vault://secret/$APP#key"},
+			expected: map[string]string{"DB": "op://prod/billing/password", "KEY": "vault://secret/billing#key"},
+		},
+		{name: "refs without variables are unchanged", env: map[string]string{"DB": "op://v/i/f"}, expected: map[string]string{"DB": "op://v/i/f"}},
+		{name: "unset variable names the mapping", env: map[string]string{"DB": "op://${REGION}/db/password"}, wantErr: "DB: unresolved variable REGION"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandEnvMappings(tt.env, vars)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExpandEnvMappings failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestExpandRefs(t *testing.T) {
+	got, err := ExpandRefs([]string{"op://v/${APP}/a", "op://v/i/b"}, map[string]string{"APP": "web"})
+	if err != nil {
+		t.Fatalf("ExpandRefs failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, []string{"op://v/web/a", "op://v/i/b"}) {
+		t.Errorf("Expected expanded refs in order, got %v", got)
+	}
+	if _, err := ExpandRefs([]string{"op://v/$MISSING/a"}, nil); err == nil {
+		t.Error("Expected an error for an unset variable")
+	}
+}
+
+func TestEnvNames(t *testing.T) {
+	got := EnvNames([]string{"ZED=op://v/i/z", "ALPHA=op://v/i/a", "MID=op://v/i/m", "ALPHA=op://v/i/b"})
+	expected := []string{"ZED", "ALPHA", "MID"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestOnlyMissing(t *testing.T) {
+	env := map[string]string{
+		"DB_PASS":   "op://v/db/password",
+		"API_KEY":   "op://v/api/key",
+		"EMPTY":     "op://v/empty/value",
+		"LOG_TOKEN": "op://v/log/token",
+	}
+	vars := map[string]string{"API_KEY": "from-shell", "EMPTY": "", "HOME": "/home/me"}
+
+	kept, skipped := OnlyMissing(env, vars)
+	expected := map[string]string{"DB_PASS": "op://v/db/password", "LOG_TOKEN": "op://v/log/token"}
+	if !reflect.DeepEqual(kept, expected) {
+		t.Errorf("Expected %v, got %v", expected, kept)
+	}
+	if !reflect.DeepEqual(skipped, []string{"API_KEY", "EMPTY"}) {
+		t.Errorf("Expected set variables, even empty ones, to be skipped in order, got %v", skipped)
+	}
+	if len(env) != 4 {
+		t.Errorf("Expected the input mappings to be left alone, got %v", env)
+	}
+
+	kept, skipped = OnlyMissing(env, nil)
+	if !reflect.DeepEqual(kept, env) || skipped != nil {
+		t.Errorf("Expected every mapping kept with nothing set, got %v and %v", kept, skipped)
+	}
+}
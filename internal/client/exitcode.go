@@ -0,0 +1,108 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os/exec"
+
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+// Exit statuses of the opx CLI. They are stable so scripts can branch on them;
+// `opx run` exits with the child's own status once the child has started.
+const (
+	ExitFailure       = 1 // any error not listed below
+	ExitUsage         = 2 // bad flags or arguments
+	ExitUnreachable   = 3 // the daemon could not be reached or started
+	ExitUnauthorized  = 4 // the daemon rejected the client token
+	ExitPolicyDenied  = 5 // the access policy refused the ref
+	ExitNotFound      = 6 // the secret, item or field does not exist, or was deleted
+	ExitBackend       = 7 // the backend failed or timed out
+	ExitSessionLocked = 8 // the session is locked and could not be unlocked
+)
+
+var (
+	// ErrUnauthorized is returned when the daemon rejects the client token
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrDaemonUnreachable is returned when the daemon is not running and could not be started
+	ErrDaemonUnreachable = errors.New("daemon not reachable")
+)
+
+// ErrorCode returns the structured code of the response body, or "" for plain-text errors
+func (e *StatusError) ErrorCode() string {
+	var body protocol.ErrorResponse
+	if err := json.Unmarshal([]byte(e.Body), &body); err != nil {
+		return ""
+	}
+	return body.Code
+}
+
+// ExitCode maps an opx outcome to a process exit status: the child's own status
+// for `opx run`, ExitSecretChanged after a secret change, one of the Exit
+// constants for typed client errors and daemon error codes, or 1 otherwise
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var changed *SecretsChangedError
+	if errors.As(err, &changed) {
+		return ExitSecretChanged
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	if errors.Is(err, ErrUnauthorized) {
+		return ExitUnauthorized
+	}
+	if errors.Is(err, ErrSessionLocked) {
+		return ExitSessionLocked
+	}
+	if errors.Is(err, ErrDaemonUnreachable) {
+		return ExitUnreachable
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return ExitUnreachable
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return statusExitCode(se)
+	}
+	return ExitFailure
+}
+
+// statusExitCode maps a daemon error response, preferring its structured code over the HTTP status
+func statusExitCode(se *StatusError) int {
+	switch se.ErrorCode() {
+	case protocol.ErrCodePolicyDenied, protocol.ErrCodePeerUnavailable:
+		return ExitPolicyDenied
+	case protocol.ErrCodeNotFound, protocol.ErrCodeDeleted:
+		return ExitNotFound
+	case protocol.ErrCodeSessionLocked:
+		return ExitSessionLocked
+	case protocol.ErrCodeApprovalRequired:
+		// 403 means a policy rule waits on opx approve; 503 the 1Password app
+		if se.Code == http.StatusForbidden {
+			return ExitPolicyDenied
+		}
+		return ExitBackend
+	case protocol.ErrCodeDeadlineExceeded:
+		return ExitBackend
+	}
+	switch se.Code {
+	case http.StatusUnauthorized:
+		return ExitUnauthorized
+	case http.StatusForbidden:
+		return ExitPolicyDenied
+	case http.StatusNotFound, http.StatusGone:
+		return ExitNotFound
+	case http.StatusLocked:
+		return ExitSessionLocked
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return ExitBackend
+	}
+	return ExitFailure
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/zach-source/opx/internal/backend"
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+// Output formats accepted by `opx read --format`
+const (
+	FormatText   = "text"   // value plus a newline unless it already ends with one
+	FormatRaw    = "raw"    // exact bytes, nothing added; single ref only
+	FormatJSON   = "json"   // object per ref, or a map keyed by ref for several
+	FormatBase64 = "base64" // standard base64, one line per ref
+	FormatTSV    = "tsv"    // ref<TAB>value per line, escaped with tsvEscaper
+)
+
+// ReadFormats lists the values accepted by `opx read --format`
+var ReadFormats = []string{FormatText, FormatRaw, FormatJSON, FormatBase64, FormatTSV}
+
+// tsvEscaper backslash-escapes the characters that would break a TSV row
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// readOutput is the `opx read --format json` object for one ref
+type readOutput struct {
+	Ref       string `json:"ref"`
+	Value     string `json:"value"`
+	FromCache bool   `json:"from_cache"`
+	ExpiresIn int    `json:"expires_in"`
+	Age       int    `json:"age"`
+}
+
+// FormatReads renders the results for refs, in order, as `opx read --format` prints them.
+// Text output for several refs, and text or base64 output with labeled, prefixes
+// each value with its ReadLabels label and "="; TSV rows start with the ref, or
+// its label with labeled.
+func FormatReads(format string, labeled bool, refs []string, results map[string]protocol.ReadResponse) ([]byte, error) {
+	var labels map[string]string
+	if labeled || (format == FormatText && len(refs) > 1) {
+		labels = ReadLabels(refs)
+	}
+	var b strings.Builder
+	switch format {
+	case FormatText:
+		for _, ref := range refs {
+			if labels != nil {
+				b.WriteString(labels[ref] + "=")
+			}
+			b.WriteString(results[ref].Value)
+			if !strings.HasSuffix(results[ref].Value, "\n") {
+				b.WriteByte('\n')
+			}
+		}
+	case FormatRaw:
+		if len(refs) != 1 {
+			return nil, errors.New("--format raw takes exactly one ref")
+		}
+		if labeled {
+			return nil, errors.New("--format raw can't be labeled")
+		}
+		b.WriteString(results[refs[0]].Value)
+	case FormatBase64:
+		for _, ref := range refs {
+			if labels != nil {
+				b.WriteString(labels[ref] + "=")
+			}
+			b.WriteString(base64.StdEncoding.EncodeToString([]byte(results[ref].Value)))
+			b.WriteByte('\n')
+		}
+	case FormatTSV:
+		for _, ref := range refs {
+			name := ref
+			if labels != nil {
+				name = labels[ref]
+			}
+			b.WriteString(tsvEscaper.Replace(name) + "\t" + tsvEscaper.Replace(results[ref].Value) + "\n")
+		}
+	case FormatJSON:
+		var v any
+		if len(refs) == 1 {
+			v = toReadOutput(results[refs[0]])
+		} else {
+			byRef := make(map[string]readOutput, len(refs))
+			for _, ref := range refs {
+				byRef[ref] = toReadOutput(results[ref])
+			}
+			v = byRef
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(data)
+		b.WriteByte('\n')
+	default:
+		return nil, fmt.Errorf("unknown --format %q (want %s)", format, strings.Join(ReadFormats, ", "))
+	}
+	return []byte(b.String()), nil
+}
+
+// ReadLabels names each ref for labeled output: the field name when every ref is
+// a field of the same op://vault/item, otherwise the ref itself
+func ReadLabels(refs []string) map[string]string {
+	labels := make(map[string]string, len(refs))
+	var item string
+	for _, ref := range refs {
+		vault, name, field, ok := backend.SplitItemRef(ref)
+		if !ok || (item != "" && item != vault+"/"+name) {
+			for _, ref := range refs {
+				labels[ref] = ref
+			}
+			return labels
+		}
+		item = vault + "/" + name
+		labels[ref] = field
+	}
+	return labels
+}
+
+func toReadOutput(rr protocol.ReadResponse) readOutput {
+	return readOutput{Ref: rr.Ref, Value: rr.Value, FromCache: rr.FromCache, ExpiresIn: rr.ExpiresIn, Age: rr.Age}
+}
@@ -0,0 +1,190 @@
+package client
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+func TestFormatReads(t *testing.T) {
+	results := map[string]protocol.ReadResponse{
+		"op://v/a/f": {Ref: "op://v/a/f", Value: "line\n", FromCache: true, ExpiresIn: 42, Age: 78},
+		"op://v/b/f": {Ref: "op://v/b/f", Value: "two  ", ExpiresIn: 300},
+	}
+
+	tests := []struct {
+		name     string
+		format   string
+		refs     []string
+		expected string
+		wantErr  bool
+	}{
+		{name: "text keeps existing newline", format: FormatText, refs: []string{"op://v/a/f"}, expected: "line\n"},
+		{name: "text adds newline", format: FormatText, refs: []string{"op://v/b/f"}, expected: "two  \n"},
+		{name: "raw preserves trailing newline", format: FormatRaw, refs: []string{"op://v/a/f"}, expected: "line\n"},
+		{name: "raw preserves trailing spaces", format: FormatRaw, refs: []string{"op://v/b/f"}, expected: "two  "},
+		{name: "raw rejects several refs", format: FormatRaw, refs: []string{"op://v/a/f", "op://v/b/f"}, wantErr: true},
+		{name: "base64 per line", format: FormatBase64, refs: []string{"op://v/a/f", "op://v/b/f"}, expected: "bGluZQo=\ndHdvICA=\n"},
+		{
+			name: "json single object", format: FormatJSON, refs: []string{"op://v/a/f"},
+			expected: `{"ref":"op://v/a/f","value":"line\n","from_cache":true,"expires_in":42,"age":78}` + "\n",
+		},
+		{
+			name: "json map for several refs", format: FormatJSON, refs: []string{"op://v/b/f", "op://v/a/f"},
+			expected: `{"op://v/a/f":{"ref":"op://v/a/f","value":"line\n","from_cache":true,"expires_in":42,"age":78},"op://v/b/f":{"ref":"op://v/b/f","value":"two  ","from_cache":false,"expires_in":300,"age":0}}` + "\n",
+		},
+		{name: "unknown format", format: "yaml", refs: []string{"op://v/a/f"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FormatReads(tt.format, false, tt.refs, results)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FormatReads failed: %v", err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFormatReads_BinaryRoundTrip(t *testing.T) {
+	binary := string([]byte{0x00, 0xff, '\n', 0x1b, 0x80, '\r'})
+	results := map[string]protocol.ReadResponse{"op://v/bin/f": {Ref: "op://v/bin/f", Value: binary}}
+
+	out, err := FormatReads(FormatBase64, false, []string{"op://v/bin/f"}, results)
+	if err != nil {
+		t.Fatalf("FormatReads failed: %v", err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(string(out[:len(out)-1]))
+	if err != nil || string(decoded) != binary {
+		t.Errorf("Expected binary value to survive base64, got %q (%v)", decoded, err)
+	}
+}
+
+func TestFormatReads_Labeled(t *testing.T) {
+	results := map[string]protocol.ReadResponse{
+		"op://dev/db/username": {Value: "admin"},
+		"op://dev/db/password": {Value: "s3cret\n"},
+		"op://dev/api/token":   {Value: "tok"},
+	}
+
+	tests := []struct {
+		name     string
+		format   string
+		labeled  bool
+		refs     []string
+		expected string
+		wantErr  bool
+	}{
+		{name: "single ref stays bare", format: FormatText, refs: []string{"op://dev/db/username"}, expected: "admin\n"},
+		{name: "single ref labeled", format: FormatText, labeled: true, refs: []string{"op://dev/db/username"}, expected: "username=admin\n"},
+		{
+			name: "fields of one item", format: FormatText, refs: []string{"op://dev/db/username", "op://dev/db/password"},
+			expected: "username=admin\npassword=s3cret\n",
+		},
+		{
+			name: "refs across items", format: FormatText, refs: []string{"op://dev/db/username", "op://dev/api/token"},
+			expected: "op://dev/db/username=admin\nop://dev/api/token=tok\n",
+		},
+		{
+			name: "base64 labeled", format: FormatBase64, labeled: true, refs: []string{"op://dev/db/username", "op://dev/db/password"},
+			expected: "username=YWRtaW4=\npassword=czNjcmV0Cg==\n",
+		},
+		{name: "raw can't be labeled", format: FormatRaw, labeled: true, refs: []string{"op://dev/db/username"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FormatReads(tt.format, tt.labeled, tt.refs, results)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FormatReads failed: %v", err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestReadLabels(t *testing.T) {
+	tests := []struct {
+		name     string
+		refs     []string
+		expected []string
+	}{
+		{name: "one item", refs: []string{"op://dev/db/username", "op://dev/db/password"}, expected: []string{"username", "password"}},
+		{name: "two items", refs: []string{"op://dev/db/username", "op://dev/api/token"}, expected: []string{"op://dev/db/username", "op://dev/api/token"}},
+		{name: "section ref", refs: []string{"op://dev/db/username", "op://dev/db/admin/password"}, expected: []string{"op://dev/db/username", "op://dev/db/admin/password"}},
+		{name: "other scheme", refs: []string{"vault://secret/db", "vault://secret/api"}, expected: []string{"vault://secret/db", "vault://secret/api"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := ReadLabels(tt.refs)
+			for i, ref := range tt.refs {
+				if labels[ref] != tt.expected[i] {
+					t.Errorf("Expected label %q for %s, got %q", tt.expected[i], ref, labels[ref])
+				}
+			}
+		})
+	}
+}
+
+func TestFormatReads_TSV(t *testing.T) {
+	results := map[string]protocol.ReadResponse{
+		"op://dev/db/password": {Value: "a\tb\nc\\d\r"},
+		"op://dev/db/username": {Value: "admin"},
+		"op://dev/api/token":   {Value: "tok"},
+	}
+
+	tests := []struct {
+		name     string
+		labeled  bool
+		refs     []string
+		expected string
+	}{
+		{
+			name:     "input order",
+			refs:     []string{"op://dev/db/username", "op://dev/api/token", "op://dev/db/password"},
+			expected: "op://dev/db/username\tadmin\nop://dev/api/token\ttok\nop://dev/db/password\ta\\tb\\nc\\\\d\\r\n",
+		},
+		{
+			name:     "reversed order",
+			refs:     []string{"op://dev/db/password", "op://dev/api/token", "op://dev/db/username"},
+			expected: "op://dev/db/password\ta\\tb\\nc\\\\d\\r\nop://dev/api/token\ttok\nop://dev/db/username\tadmin\n",
+		},
+		{
+			name:     "labeled fields",
+			labeled:  true,
+			refs:     []string{"op://dev/db/username", "op://dev/db/password"},
+			expected: "username\tadmin\npassword\ta\\tb\\nc\\\\d\\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FormatReads(FormatTSV, tt.labeled, tt.refs, results)
+			if err != nil {
+				t.Fatalf("FormatReads failed: %v", err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
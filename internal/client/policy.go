@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zach-source/opx/internal/policy"
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+// ReloadPolicy makes the daemon re-read policy.json (needs admin access)
+func (c *Client) ReloadPolicy(ctx context.Context) (protocol.PolicyReloadResponse, error) {
+	var resp protocol.PolicyReloadResponse
+	if err := c.doJSON(ctx, "POST", "/v1/policy/reload", struct{}{}, &resp); err != nil {
+		return protocol.PolicyReloadResponse{}, err
+	}
+	return resp, nil
+}
+
+// PolicyUsage fetches the daemon's read-quota counters (needs admin access)
+func (c *Client) PolicyUsage(ctx context.Context) ([]protocol.QuotaUsage, error) {
+	var resp protocol.PolicyUsageResponse
+	if err := c.doJSON(ctx, "GET", "/v1/policy/usage", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Usage, nil
+}
+
+// FormatPolicyList renders the allow rules for `opx policy list`, numbered like
+// `opx why`. With usage, each max_reads rule is followed by the reads counted
+// against it per binary and ref.
+func FormatPolicyList(pol policy.Policy, usage []protocol.QuotaUsage, withUsage bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "default_deny: %v\n", pol.DefaultDeny)
+	if len(pol.Allow) == 0 {
+		b.WriteString("no allow rules\n")
+	}
+	for i, r := range pol.Allow {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, r)
+		if !withUsage || r.MaxReads <= 0 {
+			continue
+		}
+		counted := false
+		for _, u := range usage {
+			if u.Rule != i+1 {
+				continue
+			}
+			counted = true
+			reset := time.Duration(u.ResetInSeconds) * time.Second
+			fmt.Fprintf(&b, "   %s -> %s: %d/%d reads, next frees in %s\n", u.Path, u.Ref, u.Reads, u.MaxReads, reset)
+		}
+		if !counted {
+			b.WriteString("   no reads in the current window\n")
+		}
+	}
+	return b.String()
+}
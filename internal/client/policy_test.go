@@ -0,0 +1,43 @@
+package client
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zach-source/opx/internal/policy"
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+func TestFormatPolicyList(t *testing.T) {
+	pol := policy.Policy{
+		Allow: []policy.Rule{
+			{Path: "/usr/bin/app", Refs: []string{"op://dev/*"}},
+			{Path: "/usr/bin/app", Refs: []string{"op://prod/*"}, MaxReads: 10, Per: "1h"},
+			{Path: "/usr/bin/cron", Refs: []string{"op://ops/*"}, MaxReads: 5, Per: "24h"},
+		},
+		DefaultDeny: true,
+	}
+	usage := []protocol.QuotaUsage{
+		{Rule: 2, Path: "/usr/bin/app", Ref: "op://prod/db/password", Reads: 3, MaxReads: 10, PerSeconds: 3600, ResetInSeconds: 720},
+	}
+
+	out := FormatPolicyList(pol, usage, true)
+	for _, want := range []string{
+		"default_deny: true\n",
+		"1. path=/usr/bin/app refs=[op://dev/*]\n",
+		"2. path=/usr/bin/app refs=[op://prod/*] max_reads=10 per=1h\n",
+		"   /usr/bin/app -> op://prod/db/password: 3/10 reads, next frees in 12m0s\n",
+		"3. path=/usr/bin/cron refs=[op://ops/*] max_reads=5 per=24h\n   no reads in the current window\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	if out := FormatPolicyList(pol, nil, false); strings.Contains(out, "3/10") || strings.Contains(out, "no reads") {
+		t.Errorf("Expected no usage lines without --usage, got:\n%s", out)
+	}
+	if out := FormatPolicyList(policy.Policy{}, nil, false); !strings.Contains(out, "no allow rules") {
+		t.Errorf("Expected an empty policy to say so, got:\n%s", out)
+	}
+}
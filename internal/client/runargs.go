@@ -0,0 +1,140 @@
+package client
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/zach-source/opx/internal/envfile"
+)
+
+// runExample is shown with errors about the shape of an `opx run` command line
+const runExample = "e.g. opx run --env DB_PASS=op://vault/item/password -- ./app"
+
+// RunOptions are the parsed flags, mappings and command of `opx run`
+type RunOptions struct {
+	Env              map[string]string
+	ExecArgs         []string
+	KeepSessionAlive bool
+	ExitOnChange     bool
+	Poll             time.Duration
+	DumpRefs         bool
+	ResolveArgs      bool
+	Verbose          bool
+	// Mappings are Env in definition order with where each came from, for --print-env
+	Mappings []envfile.Mapping
+	PrintEnv bool
+	// OnlyMissing skips mappings whose NAME is already set in opx's environment
+	OnlyMissing bool
+}
+
+// DropSet removes the mappings whose NAME is set in vars from Env and
+// Mappings, returning the sorted names skipped
+func (o *RunOptions) DropSet(vars map[string]string) []string {
+	var skipped []string
+	o.Env, skipped = OnlyMissing(o.Env, vars)
+	var kept []envfile.Mapping
+	for _, m := range o.Mappings {
+		if _, ok := o.Env[m.Name]; ok {
+			kept = append(kept, m)
+		}
+	}
+	o.Mappings = kept
+	return skipped
+}
+
+// envFlags collects repeated --env values
+type envFlags []string
+
+func (e *envFlags) String() string     { return strings.Join(*e, ",") }
+func (e *envFlags) Set(v string) error { *e = append(*e, v); return nil }
+
+// ParseRunArgs parses the arguments of `opx run`. Mappings come from --env or
+// from NAME=REF positional arguments, in any order, up to the "--" that starts
+// CMD; CMD is optional with --dump-refs and --print-env. --env mappings override
+// those loaded with --inherit-env-file. A -h/--help flag returns flag.ErrHelp.
+func ParseRunArgs(args []string) (RunOptions, error) {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var envs envFlags
+	var opts RunOptions
+	fs.Var(&envs, "env", "NAME=REF mapping (repeatable)")
+	fs.BoolVar(&opts.KeepSessionAlive, "keep-session-alive", false, "keep the daemon session from idling out while CMD runs")
+	fs.BoolVar(&opts.ExitOnChange, "exit-on-secret-change", false, fmt.Sprintf("stop CMD and exit %d when a resolved value changes", ExitSecretChanged))
+	fs.DurationVar(&opts.Poll, "poll", 30*time.Second, "how often --exit-on-secret-change re-resolves")
+	fs.BoolVar(&opts.DumpRefs, "dump-refs", false, "print the NAME=REF mappings CMD would get and exit without resolving or running it")
+	fs.BoolVar(&opts.Verbose, "verbose", false, "print where each value came from (cache or backend) to stderr")
+	fs.BoolVar(&opts.ResolveArgs, "resolve-args", false, "also resolve arguments of CMD that are op://, vault:// or bao:// refs")
+	var envFile string
+	fs.StringVar(&envFile, "inherit-env-file", "", "load NAME=REF mappings from FILE, following its include directives; --env overrides them")
+	fs.BoolVar(&opts.PrintEnv, "print-env", false, "print the final NAME=REF mappings and where each was defined, then exit without resolving or running CMD")
+	fs.BoolVar(&opts.OnlyMissing, "only-missing", false, "skip mappings whose NAME is already set in the environment, keeping its value")
+
+	flagArgs := args
+	sep := -1
+	for i, a := range args {
+		if a == "--" {
+			sep = i
+			break
+		}
+	}
+	if sep != -1 {
+		flagArgs = args[:sep]
+		opts.ExecArgs = args[sep+1:]
+	}
+
+	// flag stops at the first positional argument, so take NAME=REF shorthands
+	// one at a time and keep parsing flags after them
+	rest := flagArgs
+	for {
+		if err := fs.Parse(rest); err != nil {
+			return RunOptions{}, err
+		}
+		rest = fs.Args()
+		if len(rest) == 0 {
+			break
+		}
+		if !strings.Contains(rest[0], "=") {
+			if sep == -1 {
+				return RunOptions{}, fmt.Errorf("missing \"--\" before the command %q; %s", rest[0], runExample)
+			}
+			return RunOptions{}, fmt.Errorf("unexpected argument %q before \"--\": mappings are NAME=REF", rest[0])
+		}
+		envs = append(envs, rest[0])
+		rest = rest[1:]
+	}
+
+	if !opts.DumpRefs && !opts.PrintEnv {
+		if sep == -1 {
+			return RunOptions{}, fmt.Errorf("missing \"--\" and the command to run; %s", runExample)
+		}
+		if len(opts.ExecArgs) == 0 {
+			return RunOptions{}, fmt.Errorf("no command after \"--\"; %s", runExample)
+		}
+	}
+	if opts.ExitOnChange && opts.Poll <= 0 {
+		return RunOptions{}, errors.New("--poll must be positive")
+	}
+
+	env := &envfile.Env{}
+	if envFile != "" {
+		loaded, err := envfile.Load(envFile)
+		if err != nil {
+			return RunOptions{}, err
+		}
+		env = loaded
+	}
+	for _, kv := range envs {
+		name, ref, ok := strings.Cut(kv, "=")
+		if !ok {
+			return RunOptions{}, fmt.Errorf("bad mapping: %s", kv)
+		}
+		env.Set(envfile.Mapping{Name: name, Ref: ref, Source: "--env"})
+	}
+	opts.Env = env.Map()
+	opts.Mappings = env.Mappings()
+	return opts, nil
+}
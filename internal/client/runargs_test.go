@@ -0,0 +1,140 @@
+package client
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRunArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		env      map[string]string
+		execArgs []string
+		err      string
+	}{
+		{
+			name:     "env flags",
+			args:     []string{"--env", "A=op://v/a/f", "--env=B=op://v/b/f", "--", "./app", "-x"},
+			env:      map[string]string{"A": "op://v/a/f", "B": "op://v/b/f"},
+			execArgs: []string{"./app", "-x"},
+		},
+		{
+			name:     "equals in ref",
+			args:     []string{"--env", "URL=vault://secret/db?field=url=primary", "--", "./app"},
+			env:      map[string]string{"URL": "vault://secret/db?field=url=primary"},
+			execArgs: []string{"./app"},
+		},
+		{
+			name:     "positional shorthand",
+			args:     []string{"A=op://v/a/f", "B=op://v/b/f", "--", "./app"},
+			env:      map[string]string{"A": "op://v/a/f", "B": "op://v/b/f"},
+			execArgs: []string{"./app"},
+		},
+		{
+			name:     "env flag after positional mapping",
+			args:     []string{"A=op://v/a/f", "--env", "B=op://v/b/f", "--verbose", "--", "./app"},
+			env:      map[string]string{"A": "op://v/a/f", "B": "op://v/b/f"},
+			execArgs: []string{"./app"},
+		},
+		{
+			name: "dump refs without command",
+			args: []string{"--dump-refs", "A=op://v/a/f"},
+			env:  map[string]string{"A": "op://v/a/f"},
+		},
+		{name: "missing separator before command", args: []string{"--env", "A=op://v/a/f", "./app"}, err: `missing "--" before the command "./app"`},
+		{name: "missing separator and command", args: []string{"--env", "A=op://v/a/f"}, err: `missing "--" and the command to run`},
+		{name: "empty command", args: []string{"--env", "A=op://v/a/f", "--"}, err: `no command after "--"`},
+		{name: "unknown flag", args: []string{"--envv", "A=op://v/a/f", "--", "./app"}, err: "flag provided but not defined: -envv"},
+		{name: "stray argument", args: []string{"A=op://v/a/f", "oops", "--", "./app"}, err: `unexpected argument "oops"`},
+		{name: "bad env mapping", args: []string{"--env", "NOEQUALS", "--", "./app"}, err: "bad mapping: NOEQUALS"},
+		{name: "non-positive poll", args: []string{"--exit-on-secret-change", "--poll=0s", "--", "./app"}, err: "--poll must be positive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := ParseRunArgs(tt.args)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(opts.Env, tt.env) {
+				t.Errorf("Expected env %v, got %v", tt.env, opts.Env)
+			}
+			if !reflect.DeepEqual(opts.ExecArgs, tt.execArgs) {
+				t.Errorf("Expected exec args %v, got %v", tt.execArgs, opts.ExecArgs)
+			}
+		})
+	}
+}
+
+func TestParseRunArgs_Flags(t *testing.T) {
+	opts, err := ParseRunArgs([]string{"--keep-session-alive", "--exit-on-secret-change", "--poll=5s", "--resolve-args", "--", "./app"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !opts.KeepSessionAlive || !opts.ExitOnChange || opts.Poll != 5*time.Second || !opts.ResolveArgs || opts.Verbose || opts.DumpRefs {
+		t.Errorf("Unexpected options: %+v", opts)
+	}
+
+	if _, err := ParseRunArgs([]string{"-h"}); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("Expected flag.ErrHelp for -h, got %v", err)
+	}
+}
+
+func TestParseRunArgs_InheritEnvFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".envrc.opx")
+	if err := os.WriteFile(path, []byte("A=op://v/file/a\nB=op://v/file/b\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	opts, err := ParseRunArgs([]string{"--inherit-env-file", path, "--env", "A=op://v/cli/a", "--print-env"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]string{"A": "op://v/cli/a", "B": "op://v/file/b"}
+	if !reflect.DeepEqual(opts.Env, expected) {
+		t.Errorf("Expected %v, got %v", expected, opts.Env)
+	}
+	if !opts.PrintEnv || len(opts.Mappings) != 2 || opts.Mappings[0].Source != "--env" {
+		t.Errorf("Expected --print-env with A from --env first, got %+v", opts)
+	}
+}
+
+func TestRunOptions_DropSet(t *testing.T) {
+	opts, err := ParseRunArgs([]string{"--only-missing", "--env", "DB_PASS=op://v/db/password", "API_KEY=op://v/api/key", "REGION=op://v/cfg/region", "--", "./app"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !opts.OnlyMissing {
+		t.Fatal("Expected --only-missing to be set")
+	}
+
+	skipped := opts.DropSet(map[string]string{"API_KEY": "override", "UNRELATED": "x"})
+	if !reflect.DeepEqual(skipped, []string{"API_KEY"}) {
+		t.Errorf("Expected API_KEY skipped, got %v", skipped)
+	}
+	expected := map[string]string{"DB_PASS": "op://v/db/password", "REGION": "op://v/cfg/region"}
+	if !reflect.DeepEqual(opts.Env, expected) {
+		t.Errorf("Expected %v, got %v", expected, opts.Env)
+	}
+	var names []string
+	for _, m := range opts.Mappings {
+		names = append(names, m.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"DB_PASS", "REGION"}) {
+		t.Errorf("Expected --print-env mappings in order without API_KEY, got %v", names)
+	}
+}
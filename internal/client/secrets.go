@@ -0,0 +1,233 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+	"unsafe"
+
+	"github.com/zach-source/opx/internal/protocol"
+	"github.com/zach-source/opx/internal/safestring"
+)
+
+// SecretEnv is resolved env held in zeroable buffers: name -> value. Zeroing is
+// best effort; transport buffers and the copies the kernel makes on exec are out of reach.
+type SecretEnv map[string]*safestring.SafeString
+
+// Zero overwrites every value and empties the map
+func (e SecretEnv) Zero() {
+	for name, v := range e {
+		v.Zero()
+		delete(e, name)
+	}
+}
+
+// Fingerprints hashes each value so a watcher can spot rotations without keeping plaintext
+func (e SecretEnv) Fingerprints() map[string][sha256.Size]byte {
+	sums := make(map[string][sha256.Size]byte, len(e))
+	for name, v := range e {
+		v.Use(func(b []byte) { sums[name] = sha256.Sum256(b) })
+	}
+	return sums
+}
+
+// Strings copies the values into plain strings for callers that need them, such as dotenv export
+func (e SecretEnv) Strings() map[string]string {
+	out := make(map[string]string, len(e))
+	for name, v := range e {
+		out[name] = v.String()
+	}
+	return out
+}
+
+// WriteLines writes NAME=value lines for names in order, skipping names that weren't resolved
+func (e SecretEnv) WriteLines(w io.Writer, names []string) error {
+	var err error
+	for _, name := range names {
+		v, ok := e[name]
+		if !ok {
+			continue
+		}
+		v.Use(func(b []byte) {
+			line := make([]byte, 0, len(name)+len(b)+2)
+			line = append(append(append(append(line, name...), '='), b...), '\n')
+			_, err = w.Write(line)
+			safestring.ZeroBytes(line)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Environ appends NAME=value entries to base for exec.Cmd.Env. The entries live
+// in buffers owned here; call the returned func once the child has started to
+// overwrite them.
+func (e SecretEnv) Environ(base []string) ([]string, func()) {
+	env := append([]string(nil), base...)
+	bufs := make([][]byte, 0, len(e))
+	for name, v := range e {
+		v.Use(func(b []byte) {
+			entry := make([]byte, 0, len(name)+1+len(b))
+			entry = append(append(append(entry, name...), '='), b...)
+			bufs = append(bufs, entry)
+			env = append(env, unsafe.String(&entry[0], len(entry)))
+		})
+	}
+	return env, func() {
+		for _, b := range bufs {
+			safestring.ZeroBytes(b)
+		}
+	}
+}
+
+// secretValue decodes a JSON string straight into a SafeString, never making a Go string of it
+type secretValue struct {
+	s *safestring.SafeString
+}
+
+func (v *secretValue) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	if len(data) < 2 || data[0] != '"' || data[len(data)-1] != '"' {
+		return fmt.Errorf("secret value is not a JSON string")
+	}
+	raw := data[1 : len(data)-1]
+	if bytes.IndexByte(raw, '\\') < 0 {
+		v.s = safestring.FromBytes(raw)
+		return nil
+	}
+	buf, err := unescapeJSON(raw)
+	if err != nil {
+		safestring.ZeroBytes(buf)
+		return err
+	}
+	v.s = safestring.FromBytes(buf)
+	safestring.ZeroBytes(buf)
+	return nil
+}
+
+// unescapeJSON decodes the escapes of a JSON string body the way encoding/json does
+func unescapeJSON(raw []byte) ([]byte, error) {
+	out := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c != '\\' {
+			out = append(out, c)
+			continue
+		}
+		i++
+		if i >= len(raw) {
+			return out, fmt.Errorf("secret value has a truncated escape")
+		}
+		switch raw[i] {
+		case '"', '\\', '/':
+			out = append(out, raw[i])
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'u':
+			r, ok := hex4(raw[i+1:])
+			if !ok {
+				return out, fmt.Errorf("secret value has a bad \\u escape")
+			}
+			i += 4
+			if hi := r; utf16.IsSurrogate(hi) {
+				r = utf8.RuneError
+				if i+2 < len(raw) && raw[i+1] == '\\' && raw[i+2] == 'u' {
+					if lo, ok := hex4(raw[i+3:]); ok {
+						if pair := utf16.DecodeRune(hi, lo); pair != utf8.RuneError {
+							r = pair
+							i += 6
+						}
+					}
+				}
+			}
+			out = utf8.AppendRune(out, r)
+		default:
+			return out, fmt.Errorf("secret value has a bad escape \\%c", raw[i])
+		}
+	}
+	return out, nil
+}
+
+// hex4 parses the four hex digits at the start of b
+func hex4(b []byte) (rune, bool) {
+	if len(b) < 4 {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(string(b[:4]), 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	return rune(n), true
+}
+
+// secretResolveResponse is protocol.ResolveResponse with values decoded into SafeStrings
+type secretResolveResponse struct {
+	Env  map[string]secretValue          `json:"env"`
+	Meta map[string]protocol.ResolveMeta `json:"meta,omitempty"`
+}
+
+func (secretResolveResponse) zeroesBody() {}
+
+// zeroingResponse marks responses whose raw body send reads into a buffer it zeroes after decoding
+type zeroingResponse interface {
+	zeroesBody()
+}
+
+// readZeroing reads r to EOF, zeroing every buffer it outgrows
+func readZeroing(r io.Reader) ([]byte, error) {
+	buf := make([]byte, 0, 4096)
+	for {
+		if len(buf) == cap(buf) {
+			grown := make([]byte, len(buf), 2*cap(buf))
+			copy(grown, buf)
+			safestring.ZeroBytes(buf)
+			buf = grown
+		}
+		n, err := r.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err == io.EOF {
+			return buf, nil
+		}
+		if err != nil {
+			return buf, err
+		}
+	}
+}
+
+// ResolveSecrets resolves env like ResolveWithFlags but returns the values as a
+// SecretEnv, decoded without intermediate strings. Meta is set only with includeMeta.
+func (c *Client) ResolveSecrets(ctx context.Context, env map[string]string, flags []string, includeMeta bool) (SecretEnv, map[string]protocol.ResolveMeta, error) {
+	req := protocol.ResolveRequest{Env: env, Flags: flags, RefFlags: c.RefFlags, IncludeMeta: includeMeta, Vars: c.Vars}
+	var resp secretResolveResponse
+	if err := c.doJSON(ctx, "POST", "/v1/resolve", req, &resp); err != nil {
+		for _, v := range resp.Env {
+			v.s.Zero()
+		}
+		return nil, nil, err
+	}
+	secrets := make(SecretEnv, len(resp.Env))
+	for name, v := range resp.Env {
+		if v.s == nil {
+			v.s = safestring.New("")
+		}
+		secrets[name] = v.s
+	}
+	return secrets, resp.Meta, nil
+}
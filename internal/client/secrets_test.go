@@ -0,0 +1,172 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/zach-source/opx/internal/protocol"
+	"github.com/zach-source/opx/internal/safestring"
+)
+
+func TestSecretValue_UnmarshalMatchesEncodingJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+	}{
+		{name: "plain", json: `"hunter2"`},
+		{name: "empty", json: `""`},
+		{name: "escapes", json: `"a\"b\\c\/d\b\f\n\r\te"`},
+		{name: "unicode escape", json: `"caf\u00e9 \u2603"`},
+		{name: "surrogate pair", json: `"smile \ud83d\ude00!"`},
+		{name: "lone high surrogate", json: `"x\ud83dy"`},
+		{name: "lone low surrogate", json: `"x\ude00y"`},
+		{name: "raw utf-8", json: `"пароль 🔑"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var expected string
+			if err := json.Unmarshal([]byte(tt.json), &expected); err != nil {
+				t.Fatalf("encoding/json failed: %v", err)
+			}
+			var v secretValue
+			if err := json.Unmarshal([]byte(tt.json), &v); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := v.s.String(); got != expected {
+				t.Errorf("Expected %q, got %q", expected, got)
+			}
+		})
+	}
+}
+
+func TestSecretValue_UnmarshalRejectsBadInput(t *testing.T) {
+	for _, in := range []string{`42`, `"bad \x escape"`, `"bad \u12 escape"`} {
+		var v secretValue
+		if err := v.UnmarshalJSON([]byte(in)); err == nil {
+			t.Errorf("Expected error for %s", in)
+		}
+	}
+}
+
+func TestSecretEnv_Zero(t *testing.T) {
+	value := safestring.New("secret")
+	secrets := SecretEnv{"A": value}
+	secrets.Zero()
+	if len(secrets) != 0 {
+		t.Errorf("Expected an empty map, got %d entries", len(secrets))
+	}
+	if value.Len() != 0 {
+		t.Errorf("Expected the value to be zeroed, got length %d", value.Len())
+	}
+}
+
+func TestSecretEnv_EnvironZeroesEntries(t *testing.T) {
+	secrets := SecretEnv{"A": safestring.New("one"), "B": safestring.New("two")}
+	env, zero := secrets.Environ([]string{"BASE=x"})
+	if len(env) != 3 || env[0] != "BASE=x" {
+		t.Fatalf("Expected BASE=x plus two entries, got %v", env)
+	}
+	added := env[1:]
+	sorted := slices.Clone(added)
+	slices.Sort(sorted)
+	if got := strings.Join(sorted, ","); got != "A=one,B=two" {
+		t.Fatalf("Expected A=one,B=two, got %s", got)
+	}
+
+	zero()
+	for _, entry := range added {
+		for _, c := range unsafe.Slice(unsafe.StringData(entry), len(entry)) {
+			if c != 0 {
+				t.Fatalf("Expected entry to be zeroed, got %q", entry)
+			}
+		}
+	}
+	if env[0] != "BASE=x" {
+		t.Errorf("Expected base entries untouched, got %q", env[0])
+	}
+}
+
+func TestSecretEnv_EnvironReachesChild(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	const value = "line one\nquote\" 🔑 = end"
+	secrets := SecretEnv{"OPX_TEST_SECRET": safestring.New(value)}
+	env, zero := secrets.Environ(nil)
+
+	var out bytes.Buffer
+	cmd := exec.Command("sh", "-c", `printf %s "$OPX_TEST_SECRET"`)
+	cmd.Env = env
+	cmd.Stdout = &out
+	err := cmd.Start()
+	zero()
+	secrets.Zero()
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if out.String() != value {
+		t.Errorf("Expected %q, got %q", value, out.String())
+	}
+}
+
+func TestSecretEnv_WriteLines(t *testing.T) {
+	secrets := SecretEnv{"A": safestring.New("1"), "B": safestring.New("two words")}
+	var b bytes.Buffer
+	if err := secrets.WriteLines(&b, []string{"B", "MISSING", "A"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := "B=two words\nA=1\n"; b.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, b.String())
+	}
+}
+
+func TestClient_ResolveSecrets(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req protocol.ResolveRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		resp := protocol.ResolveResponse{Env: map[string]string{"DB": "p\"a\\ss\n", "KEY": "☃"}}
+		if req.IncludeMeta {
+			resp.Meta = map[string]protocol.ResolveMeta{"DB": {FromCache: true}}
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer ts.Close()
+
+	c := newTestClient(ts)
+	secrets, meta, err := c.ResolveSecrets(context.Background(), map[string]string{"DB": "op://v/db/p", "KEY": "op://v/k/p"}, nil, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := secrets["DB"].String(); got != "p\"a\\ss\n" {
+		t.Errorf("Expected DB value, got %q", got)
+	}
+	if got := secrets["KEY"].String(); got != "☃" {
+		t.Errorf("Expected KEY value, got %q", got)
+	}
+	if !meta["DB"].FromCache {
+		t.Errorf("Expected meta for DB, got %v", meta)
+	}
+}
+
+func TestReadZeroing(t *testing.T) {
+	body := strings.Repeat("x", 10000)
+	b, err := readZeroing(strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(b) != body {
+		t.Errorf("Expected %d bytes, got %d", len(body), len(b))
+	}
+}
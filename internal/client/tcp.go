@@ -0,0 +1,43 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/zach-source/opx/internal/util"
+)
+
+// newTCP returns a client for a daemon's mutual-TLS TCP listener, such as one on
+// a Windows or VM host that a WSL2 or guest client can't share a socket with.
+// bundlePath is the bundle from `opx-authd issue-client-cert`, which carries
+// the client certificate, the CA the daemon's certificate must chain to and the token.
+func newTCP(endpoint, bundlePath string) (*Client, error) {
+	if bundlePath == "" {
+		return nil, fmt.Errorf("%s needs %s set to a bundle from opx-authd issue-client-cert", util.TCPEndpointEnv, util.ClientCertEnv)
+	}
+	tlsConfig, tok, err := util.LoadClientBundle(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate bundle: %w", err)
+	}
+
+	c := &Client{base: "https://unix", token: tok, tcp: endpoint, tls: tlsConfig}
+	tr := &http.Transport{
+		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			start := time.Now()
+			conn, err := dialEndpoint(ctx, "tcp", c.tcp, tlsConfig, c.socketTimeout())
+			c.Timing.addConnect(time.Since(start))
+			return conn, err
+		},
+	}
+	c.http = &http.Client{Transport: tr, Timeout: 30 * time.Second}
+	c.stream = &http.Client{Transport: tr}
+	return c, nil
+}
+
+// TCPEndpoint returns the TCP endpoint the client dials, or "" when it uses a socket
+func (c *Client) TCPEndpoint() string {
+	return c.tcp
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+// Timing records where an invocation's time went, for opx --timing. Connect
+// is taken out of the phase it happened in, and RTT starts once a request has
+// its connection, so the client phases don't overlap.
+type Timing struct {
+	mu       sync.Mutex
+	Ensure   time.Duration // checking for, or autostarting, the daemon
+	Connect  time.Duration // dialing the socket and the TLS handshake
+	RTT      time.Duration // sending requests and reading their responses
+	Requests int
+	// Server sums what the daemon reported for each request
+	Server protocol.ServerTiming
+}
+
+// addConnect records one dial and handshake
+func (t *Timing) addConnect(d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Connect += d
+}
+
+// connect is the connect time recorded so far
+func (t *Timing) connect() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.Connect
+}
+
+// measure runs fn and adds its duration, less any connect time it included, to *phase
+func (t *Timing) measure(phase *time.Duration, fn func() error) error {
+	before := t.connect()
+	start := time.Now()
+	err := fn()
+	elapsed := time.Since(start)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	*phase += elapsed - (t.Connect - before)
+	return err
+}
+
+// addRoundTrip adds the time since a request got its connection to RTT; a
+// request that never got one adds nothing
+func (t *Timing) addRoundTrip(gotConn time.Time) {
+	if t == nil || gotConn.IsZero() {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.RTT += time.Since(gotConn)
+}
+
+// addResponse counts a request and the daemon's Server-Timing for it, if any
+func (t *Timing) addResponse(h http.Header) {
+	if t == nil {
+		return
+	}
+	st, _ := protocol.ParseServerTiming(h.Get(protocol.ServerTimingHeader))
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Requests++
+	t.Server.Total += st.Total
+	t.Server.Cache += st.Cache
+	t.Server.Queue += st.Queue
+	t.Server.Backend += st.Backend
+}
+
+// Summary renders one line: total wall time split into client phases, with the
+// daemon's share of the round trips split into its phases. Whatever no phase
+// accounts for is shown as "other".
+func (t *Timing) Summary(total time.Duration) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var b strings.Builder
+	fmt.Fprintf(&b, "timing: total %s = ensure %s + connect %s + rtt %s + other %s",
+		ms(total), ms(t.Ensure), ms(t.Connect), ms(t.RTT), ms(total-t.Ensure-t.Connect-t.RTT))
+	if t.Requests > 0 {
+		s := t.Server
+		fmt.Fprintf(&b, "; daemon %s = cache %s + queue %s + backend %s + other %s",
+			ms(s.Total), ms(s.Cache), ms(s.Queue), ms(s.Backend), ms(s.Total-s.Cache-s.Queue-s.Backend))
+	}
+	if t.Requests == 1 {
+		b.WriteString(" (1 request)")
+	} else {
+		fmt.Fprintf(&b, " (%d requests)", t.Requests)
+	}
+	return b.String()
+}
+
+// ms formats d in milliseconds; negative remainders from overlapping concurrent reads show as 0
+func ms(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
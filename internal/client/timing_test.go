@@ -0,0 +1,53 @@
+package client
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+func TestTiming_Summary(t *testing.T) {
+	timing := &Timing{Ensure: 2 * time.Millisecond, Connect: 4 * time.Millisecond, RTT: 130 * time.Millisecond}
+	h := http.Header{}
+	h.Set(protocol.ServerTimingHeader, protocol.ServerTiming{Total: 120 * time.Millisecond, Cache: time.Millisecond, Backend: 110 * time.Millisecond}.String())
+	timing.addResponse(h)
+
+	expected := "timing: total 140.0ms = ensure 2.0ms + connect 4.0ms + rtt 130.0ms + other 4.0ms; daemon 120.0ms = cache 1.0ms + queue 0.0ms + backend 110.0ms + other 9.0ms (1 request)"
+	if got := timing.Summary(140 * time.Millisecond); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	// Before any request only the client side is shown
+	expected = "timing: total 5.0ms = ensure 5.0ms + connect 0.0ms + rtt 0.0ms + other 0.0ms (0 requests)"
+	if got := (&Timing{Ensure: 5 * time.Millisecond}).Summary(5 * time.Millisecond); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestTiming_MeasureExcludesConnect(t *testing.T) {
+	timing := &Timing{}
+	start := time.Now()
+	_ = timing.measure(&timing.RTT, func() error {
+		timing.addConnect(20 * time.Millisecond)
+		time.Sleep(30 * time.Millisecond)
+		return nil
+	})
+	elapsed := time.Since(start)
+	if timing.RTT > elapsed-20*time.Millisecond || timing.RTT < 10*time.Millisecond {
+		t.Errorf("Expected RTT of %v less the 20ms connect, got %v", elapsed, timing.RTT)
+	}
+}
+
+func TestTiming_RoundTripStartsAtConnection(t *testing.T) {
+	timing := &Timing{}
+	timing.addRoundTrip(time.Time{})
+	if timing.RTT != 0 {
+		t.Errorf("Expected no RTT for a request that never got a connection, got %v", timing.RTT)
+	}
+	timing.addRoundTrip(time.Now().Add(-30 * time.Millisecond))
+	if timing.RTT < 30*time.Millisecond || timing.RTT > time.Second {
+		t.Errorf("Expected about 30ms of RTT, got %v", timing.RTT)
+	}
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+// IsSessionLocked reports whether err is the daemon refusing a read because the session is locked
+func IsSessionLocked(err error) bool {
+	if errors.Is(err, ErrSessionLocked) {
+		return true
+	}
+	var se *StatusError
+	if !errors.As(err, &se) {
+		return false
+	}
+	return se.ErrorCode() == protocol.ErrCodeSessionLocked || se.Code == http.StatusLocked
+}
+
+// UnlockSession asks the daemon to check the backend session and unlock it.
+// A refusal wraps ErrSessionLocked with the daemon's reason.
+func (c *Client) UnlockSession(ctx context.Context) error {
+	var resp protocol.SessionUnlockResponse
+	err := c.doJSON(ctx, "POST", "/v1/session/unlock", struct{}{}, &resp)
+	var se *StatusError
+	if errors.As(err, &se) && json.Unmarshal([]byte(se.Body), &resp) == nil && resp.Message != "" {
+		return fmt.Errorf("%w: %s", ErrSessionLocked, resp.Message)
+	}
+	return err
+}
+
+// unlockForRetry unlocks the session after a locked read, running SignIn and
+// trying again when the daemon can't unlock it on its own
+func (c *Client) unlockForRetry(ctx context.Context) error {
+	err := c.UnlockSession(ctx)
+	if err == nil || c.SignIn == nil {
+		return err
+	}
+	if err := c.SignIn(ctx); err != nil {
+		return fmt.Errorf("sign-in failed: %w", err)
+	}
+	return c.UnlockSession(ctx)
+}
+
+// retryOnLock runs read, and with RetryOnLock set unlocks the session and runs
+// it once more if the first attempt found the session locked
+func retryOnLock[T any](ctx context.Context, c *Client, read func() (T, error)) (T, error) {
+	v, err := read()
+	if err == nil || !c.RetryOnLock || !IsSessionLocked(err) {
+		return v, err
+	}
+	if uerr := c.unlockForRetry(ctx); uerr != nil {
+		return v, fmt.Errorf("%w; unlock failed: %w", err, uerr)
+	}
+	return read()
+}
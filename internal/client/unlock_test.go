@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+// lockedDaemon fails reads with session_locked until a successful unlock, which
+// needs unlockable (set up front or by a test's SignIn)
+type lockedDaemon struct {
+	locked, unlockable bool
+	reads, unlocks     int
+}
+
+func (d *lockedDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/v1/read":
+		d.reads++
+		if d.locked {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusLocked)
+			_ = json.NewEncoder(w).Encode(protocol.ErrorResponse{Code: protocol.ErrCodeSessionLocked, Message: "session is locked"})
+			return
+		}
+		var req protocol.ReadRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		_ = json.NewEncoder(w).Encode(protocol.ReadResponse{Ref: req.Ref, Value: "secret"})
+	case "/v1/session/unlock":
+		d.unlocks++
+		if !d.unlockable {
+			w.WriteHeader(http.StatusLocked)
+			_ = json.NewEncoder(w).Encode(protocol.SessionUnlockResponse{State: "locked", Message: "Session unlock failed: not signed in"})
+			return
+		}
+		d.locked = false
+		_ = json.NewEncoder(w).Encode(protocol.SessionUnlockResponse{Success: true, State: "authenticated"})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestClient_ReadRetryOnLock(t *testing.T) {
+	tests := []struct {
+		name        string
+		retry       bool
+		unlockable  bool
+		signIn      bool
+		signInErr   error
+		reads       int
+		unlocks     int
+		expectValue bool
+		errContains string
+	}{
+		{name: "without retry", unlockable: true, reads: 1, errContains: "session is locked"},
+		{name: "daemon unlocks", retry: true, unlockable: true, reads: 2, unlocks: 1, expectValue: true},
+		{name: "sign-in then unlock", retry: true, signIn: true, reads: 2, unlocks: 2, expectValue: true},
+		{name: "no sign-in", retry: true, reads: 1, unlocks: 1, errContains: "not signed in"},
+		{name: "sign-in fails", retry: true, signIn: true, signInErr: errors.New("cancelled"), reads: 1, unlocks: 1, errContains: "sign-in failed: cancelled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &lockedDaemon{locked: true, unlockable: tt.unlockable}
+			ts := httptest.NewServer(d)
+			defer ts.Close()
+
+			c := newTestClient(ts)
+			c.RetryOnLock = tt.retry
+			if tt.signIn {
+				c.SignIn = func(ctx context.Context) error {
+					if tt.signInErr != nil {
+						return tt.signInErr
+					}
+					d.unlockable = true
+					return nil
+				}
+			}
+
+			rr, err := c.Read(context.Background(), "op://v/i/f")
+			if tt.expectValue {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if rr.Value != "secret" {
+					t.Errorf("Expected secret, got %q", rr.Value)
+				}
+			} else {
+				if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errContains, err)
+				}
+				if code := ExitCode(err); code != ExitSessionLocked {
+					t.Errorf("Expected exit code %d, got %d", ExitSessionLocked, code)
+				}
+			}
+			if d.reads != tt.reads || d.unlocks != tt.unlocks {
+				t.Errorf("Expected %d reads and %d unlocks, got %d and %d", tt.reads, tt.unlocks, d.reads, d.unlocks)
+			}
+		})
+	}
+}
+
+func TestIsSessionLocked(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "coded", err: &StatusError{Code: http.StatusLocked, Body: `{"code":"session_locked","message":"session is locked"}`}, expected: true},
+		{name: "plain 423", err: &StatusError{Code: http.StatusLocked, Body: "locked"}, expected: true},
+		{name: "sentinel", err: ErrSessionLocked, expected: true},
+		{name: "not found", err: &StatusError{Code: http.StatusNotFound, Body: `{"code":"not_found"}`}},
+		{name: "other", err: errors.New("boom")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsSessionLocked(tt.err); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
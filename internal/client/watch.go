@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+// ExitSecretChanged is the exit status of `opx run --exit-on-secret-change` when a
+// resolved value changed (EX_TEMPFAIL), so supervisors can restart with fresh env
+const ExitSecretChanged = 75
+
+// SecretsChangedError reports which env names resolved to a new value; values are never included
+type SecretsChangedError struct {
+	Names []string
+}
+
+func (e *SecretsChangedError) Error() string {
+	return fmt.Sprintf("secret value changed for %s", strings.Join(e.Names, ", "))
+}
+
+// fingerprints hashes resolved values so the watcher never keeps plaintext around
+func fingerprints(env map[string]string) map[string][sha256.Size]byte {
+	sums := make(map[string][sha256.Size]byte, len(env))
+	for name, value := range env {
+		sums[name] = sha256.Sum256([]byte(value))
+	}
+	return sums
+}
+
+// changedNames returns the sorted names whose fingerprint differs or disappeared
+func changedNames(before, after map[string][sha256.Size]byte) []string {
+	var names []string
+	for name, sum := range before {
+		if next, ok := after[name]; !ok || next != sum {
+			names = append(names, name)
+		}
+	}
+	for name := range after {
+		if _, ok := before[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WatchSecrets re-resolves env every interval and returns a *SecretsChangedError as
+// soon as any value differs from baseline. It returns nil when ctx is cancelled.
+// Resolve failures are passed to onError (if set) and polling continues.
+func (c *Client) WatchSecrets(ctx context.Context, env map[string]string, flags []string, baseline map[string]string, interval time.Duration, onError func(error)) error {
+	return c.WatchSecretFingerprints(ctx, env, flags, fingerprints(baseline), interval, onError)
+}
+
+// WatchSecretFingerprints is WatchSecrets against SecretEnv.Fingerprints, so the
+// caller can zero the baseline values before watching
+func (c *Client) WatchSecretFingerprints(ctx context.Context, env map[string]string, flags []string, want map[string][sha256.Size]byte, interval time.Duration, onError func(error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			secrets, _, err := c.ResolveSecrets(ctx, env, flags, false)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				if onError != nil {
+					onError(err)
+				}
+				continue
+			}
+			got := secrets.Fingerprints()
+			secrets.Zero()
+			if names := changedNames(want, got); len(names) > 0 {
+				return &SecretsChangedError{Names: names}
+			}
+		}
+	}
+}
+
+// ReadUpdate is one poll of WatchRead
+type ReadUpdate struct {
+	Time     time.Time
+	Response protocol.ReadResponse
+	Err      error
+	// Changed is true when the value differs from the last successful read (never on the first)
+	Changed bool
+}
+
+// WatchRead reads ref immediately and then every interval, passing each result to fn.
+// It stops after count reads (0 = no limit) or when ctx is cancelled, returning nil.
+// Failed reads are reported through ReadUpdate.Err and don't reset change detection.
+func (c *Client) WatchRead(ctx context.Context, ref string, flags []string, interval time.Duration, count int, fn func(ReadUpdate)) error {
+	if interval <= 0 {
+		return fmt.Errorf("watch interval must be positive, got %s", interval)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last string
+	seen := false
+	for n := 0; count <= 0 || n < count; n++ {
+		if n > 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+
+		rr, err := c.ReadWithFlags(ctx, ref, flags)
+		if err != nil && ctx.Err() != nil {
+			return nil
+		}
+		update := ReadUpdate{Time: time.Now(), Response: rr, Err: err}
+		if err == nil {
+			update.Changed = seen && rr.Value != last
+			last, seen = rr.Value, true
+		}
+		fn(update)
+	}
+	return nil
+}
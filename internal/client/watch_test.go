@@ -0,0 +1,215 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+func TestChangedNames(t *testing.T) {
+	base := map[string]string{"DB_PASS": "one", "API_KEY": "key"}
+	tests := []struct {
+		name     string
+		next     map[string]string
+		expected []string
+	}{
+		{name: "unchanged", next: map[string]string{"DB_PASS": "one", "API_KEY": "key"}},
+		{name: "one value", next: map[string]string{"DB_PASS": "two", "API_KEY": "key"}, expected: []string{"DB_PASS"}},
+		{name: "all values", next: map[string]string{"DB_PASS": "two", "API_KEY": "rotated"}, expected: []string{"API_KEY", "DB_PASS"}},
+		{name: "missing name", next: map[string]string{"DB_PASS": "one"}, expected: []string{"API_KEY"}},
+		{name: "new name", next: map[string]string{"DB_PASS": "one", "API_KEY": "key", "EXTRA": "x"}, expected: []string{"EXTRA"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := changedNames(fingerprints(base), fingerprints(tt.next))
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// rotatingServer answers /v1/resolve with DB_PASS=<version>, bumping the version after rotateAfter calls
+func rotatingServer(t *testing.T, rotateAfter int32) (*httptest.Server, *int32) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/resolve" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		n := atomic.AddInt32(&calls, 1)
+		version := "v1"
+		if rotateAfter > 0 && n > rotateAfter {
+			version = "v2"
+		}
+		_ = json.NewEncoder(w).Encode(protocol.ResolveResponse{Env: map[string]string{
+			"DB_PASS": "secret-" + version,
+			"API_KEY": "static",
+		}})
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &calls
+}
+
+func TestClient_WatchSecretsDetectsChange(t *testing.T) {
+	ts, calls := rotatingServer(t, 2)
+	c := newTestClient(ts)
+
+	env := map[string]string{"DB_PASS": "op://v/db/password", "API_KEY": "op://v/api/key"}
+	baseline := map[string]string{"DB_PASS": "secret-v1", "API_KEY": "static"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	err := c.WatchSecrets(ctx, env, nil, baseline, 5*time.Millisecond, nil)
+
+	var changed *SecretsChangedError
+	if !errors.As(err, &changed) {
+		t.Fatalf("Expected SecretsChangedError, got %v", err)
+	}
+	if !reflect.DeepEqual(changed.Names, []string{"DB_PASS"}) {
+		t.Errorf("Expected only DB_PASS to be reported, got %v", changed.Names)
+	}
+	if got := atomic.LoadInt32(calls); got != 3 {
+		t.Errorf("Expected change to be detected on poll 3, got %d polls", got)
+	}
+	if strings.Contains(err.Error(), "secret-v") {
+		t.Errorf("Expected error not to leak values, got %q", err.Error())
+	}
+	if code := ExitCode(err); code != ExitSecretChanged {
+		t.Errorf("Expected exit code %d, got %d", ExitSecretChanged, code)
+	}
+}
+
+func TestClient_WatchSecretsStopsOnCancel(t *testing.T) {
+	ts, _ := rotatingServer(t, 0)
+	c := newTestClient(ts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := c.WatchSecrets(ctx, map[string]string{"DB_PASS": "op://v/db/password"}, nil,
+		map[string]string{"DB_PASS": "secret-v1", "API_KEY": "static"}, 5*time.Millisecond, nil)
+	if err != nil {
+		t.Errorf("Expected nil when nothing changed before cancellation, got %v", err)
+	}
+}
+
+func TestClient_WatchSecretsKeepsPollingOnError(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			http.Error(w, "backend unavailable", http.StatusBadGateway)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(protocol.ResolveResponse{Env: map[string]string{"DB_PASS": "rotated"}})
+	}))
+	defer ts.Close()
+
+	var errs int32
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	err := newTestClient(ts).WatchSecrets(ctx, map[string]string{"DB_PASS": "op://v/db/password"}, nil,
+		map[string]string{"DB_PASS": "original"}, 5*time.Millisecond, func(error) { atomic.AddInt32(&errs, 1) })
+
+	var changed *SecretsChangedError
+	if !errors.As(err, &changed) {
+		t.Fatalf("Expected SecretsChangedError after a failed poll, got %v", err)
+	}
+	if atomic.LoadInt32(&errs) != 1 {
+		t.Errorf("Expected 1 reported error, got %d", atomic.LoadInt32(&errs))
+	}
+}
+
+func TestClient_WatchReadDetectsChanges(t *testing.T) {
+	// The value alternates a, a, b, b, a: only reads 3 and 5 are changes
+	values := []string{"a", "a", "b", "b", "a"}
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/read" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		n := atomic.AddInt32(&calls, 1)
+		_ = json.NewEncoder(w).Encode(protocol.ReadResponse{Ref: "op://v/i/f", Value: values[(n-1)%int32(len(values))]})
+	}))
+	defer ts.Close()
+
+	var changedAt []int
+	var seen []string
+	err := newTestClient(ts).WatchRead(context.Background(), "op://v/i/f", nil, time.Millisecond, len(values), func(u ReadUpdate) {
+		if u.Err != nil {
+			t.Errorf("Unexpected read error: %v", u.Err)
+		}
+		seen = append(seen, u.Response.Value)
+		if u.Changed {
+			changedAt = append(changedAt, len(seen))
+		}
+	})
+	if err != nil {
+		t.Fatalf("WatchRead failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(seen, values) {
+		t.Errorf("Expected reads %v, got %v", values, seen)
+	}
+	if !reflect.DeepEqual(changedAt, []int{3, 5}) {
+		t.Errorf("Expected changes on reads [3 5], got %v", changedAt)
+	}
+}
+
+func TestClient_WatchReadErrorsDontCountAsChanges(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 2 {
+			http.Error(w, "failed to read secret", http.StatusBadGateway)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(protocol.ReadResponse{Value: "same"})
+	}))
+	defer ts.Close()
+
+	var errs, changes int
+	err := newTestClient(ts).WatchRead(context.Background(), "op://v/i/f", nil, time.Millisecond, 3, func(u ReadUpdate) {
+		if u.Err != nil {
+			errs++
+		}
+		if u.Changed {
+			changes++
+		}
+	})
+	if err != nil {
+		t.Fatalf("WatchRead failed: %v", err)
+	}
+	if errs != 1 || changes != 0 {
+		t.Errorf("Expected 1 error and no changes, got %d errors and %d changes", errs, changes)
+	}
+}
+
+func TestClient_WatchReadStopsOnCancel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(protocol.ReadResponse{Value: "v"})
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	reads := 0
+	err := newTestClient(ts).WatchRead(ctx, "op://v/i/f", nil, 5*time.Millisecond, 0, func(ReadUpdate) { reads++ })
+	if err != nil {
+		t.Errorf("Expected nil on cancellation, got %v", err)
+	}
+	if reads == 0 {
+		t.Error("Expected at least the initial read")
+	}
+
+	if err := newTestClient(ts).WatchRead(context.Background(), "op://v/i/f", nil, 0, 1, func(ReadUpdate) {}); err == nil {
+		t.Error("Expected error for non-positive interval")
+	}
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+// ExplainPolicy asks the daemon how its policy decides req (needs admin access)
+func (c *Client) ExplainPolicy(ctx context.Context, req protocol.PolicyExplainRequest) (protocol.PolicyExplainResponse, error) {
+	var resp protocol.PolicyExplainResponse
+	if err := c.doJSON(ctx, "POST", "/v1/policy/explain", req, &resp); err != nil {
+		return protocol.PolicyExplainResponse{}, err
+	}
+	return resp, nil
+}
+
+// FormatExplanation renders a policy trace for `opx why`: the request, each
+// rule considered with its verdict indented below it, then the decision
+func FormatExplanation(e protocol.PolicyExplainResponse) string {
+	var b strings.Builder
+	subject := e.SubjectPath
+	if subject == "" {
+		subject = "(unknown path)"
+	}
+	if e.SubjectContainerPath != "" || e.SubjectContainerID != "" {
+		subject = fmt.Sprintf("container %s path %s", orUnknown(e.SubjectContainerID), orUnknown(e.SubjectContainerPath))
+	}
+	if e.SubjectCertCN != "" {
+		subject = "certificate " + e.SubjectCertCN
+	}
+	if e.SubjectPID != 0 {
+		subject += fmt.Sprintf(", pid %d", e.SubjectPID)
+	}
+	fmt.Fprintf(&b, "%s (%s) for %s\n", e.Ref, e.Action, subject)
+
+	policyPath := e.PolicyPath
+	if policyPath == "" {
+		policyPath = "(no policy file)"
+	}
+	mode := "allow by default"
+	if e.DefaultDeny {
+		mode = "default_deny"
+	}
+	fmt.Fprintf(&b, "  policy: %s, %s\n", policyPath, mode)
+
+	for _, r := range e.Rules {
+		verdict := "no"
+		if r.Matched {
+			verdict = "yes"
+		}
+		fmt.Fprintf(&b, "  rule %d: %s\n", r.Index, r.Rule)
+		fmt.Fprintf(&b, "    %s: %s\n", verdict, r.Reason)
+	}
+
+	decision := "DENY"
+	if e.Allowed {
+		decision = "ALLOW"
+	}
+	fmt.Fprintf(&b, "decision: %s, %s\n", decision, e.Reason)
+	if e.Message != "" {
+		fmt.Fprintf(&b, "  hint: %s\n", e.Message)
+	}
+	return b.String()
+}
+
+// orUnknown returns s, or "(unknown)" when it is empty
+func orUnknown(s string) string {
+	if s == "" {
+		return "(unknown)"
+	}
+	return s
+}
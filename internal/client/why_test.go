@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+func TestFormatExplanation(t *testing.T) {
+	tests := []struct {
+		name     string
+		resp     protocol.PolicyExplainResponse
+		expected string
+	}{
+		{
+			name: "denied with hint",
+			resp: protocol.PolicyExplainResponse{
+				Ref:         "op://prod/db/password",
+				Action:      "read",
+				SubjectPath: "/usr/bin/deploy",
+				SubjectPID:  4242,
+				PolicyPath:  "/home/u/.config/op-authd/policy.json",
+				DefaultDeny: true,
+				Rules: []protocol.PolicyRuleTrace{
+					{Index: 1, Rule: "path=/usr/bin/app refs=[*]", Reason: "path /usr/bin/deploy is not /usr/bin/app"},
+					{Index: 2, Rule: "path=/usr/bin/deploy refs=[op://dev/*]", Reason: "ref matches none of [op://dev/*]"},
+				},
+				Reason:  "no rule matched and the policy has default_deny",
+				Message: "ask #platform for prod access",
+			},
+			expected: `op://prod/db/password (read) for /usr/bin/deploy, pid 4242
+  policy: /home/u/.config/op-authd/policy.json, default_deny
+  rule 1: path=/usr/bin/app refs=[*]
+    no: path /usr/bin/deploy is not /usr/bin/app
+  rule 2: path=/usr/bin/deploy refs=[op://dev/*]
+    no: ref matches none of [op://dev/*]
+decision: DENY, no rule matched and the policy has default_deny
+  hint: ask #platform for prod access
+`,
+		},
+		{
+			name: "allowed by rule",
+			resp: protocol.PolicyExplainResponse{
+				Ref:         "op://dev/db/password",
+				Action:      "write",
+				SubjectPath: "/usr/bin/deploy",
+				PolicyPath:  "/etc/policy.json",
+				DefaultDeny: true,
+				Rules: []protocol.PolicyRuleTrace{
+					{Index: 1, Rule: "path=/usr/bin/deploy refs=[op://dev/*] actions=[read write]", Matched: true, Reason: "matches"},
+				},
+				Allowed: true,
+				Reason:  "allowed by rule 1",
+			},
+			expected: `op://dev/db/password (write) for /usr/bin/deploy
+  policy: /etc/policy.json, default_deny
+  rule 1: path=/usr/bin/deploy refs=[op://dev/*] actions=[read write]
+    yes: matches
+decision: ALLOW, allowed by rule 1
+`,
+		},
+		{
+			name: "container caller",
+			resp: protocol.PolicyExplainResponse{
+				Ref:                  "op://dev/db/password",
+				Action:               "read",
+				SubjectPID:           77,
+				SubjectContainerPath: "/usr/local/bin/app",
+				SubjectContainerID:   "4f1c6a7be4a9",
+				PolicyPath:           "/etc/policy.json",
+				DefaultDeny:          true,
+				Rules: []protocol.PolicyRuleTrace{
+					{Index: 1, Rule: "container_path=/usr/local/bin/app container_id_prefix=4f1c refs=[op://dev/*]", Matched: true, Reason: "matches"},
+				},
+				Allowed: true,
+				Reason:  "allowed by rule 1",
+			},
+			expected: `op://dev/db/password (read) for container 4f1c6a7be4a9 path /usr/local/bin/app, pid 77
+  policy: /etc/policy.json, default_deny
+  rule 1: container_path=/usr/local/bin/app container_id_prefix=4f1c refs=[op://dev/*]
+    yes: matches
+decision: ALLOW, allowed by rule 1
+`,
+		},
+		{
+			name: "no policy file",
+			resp: protocol.PolicyExplainResponse{
+				Ref:     "op://dev/db/password",
+				Action:  "read",
+				Allowed: true,
+				Reason:  "the policy has no rules and allows by default",
+			},
+			expected: `op://dev/db/password (read) for (unknown path)
+  policy: (no policy file), allow by default
+decision: ALLOW, the policy has no rules and allows by default
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatExplanation(tt.resp); got != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestClient_ExplainPolicy(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/v1/policy/explain" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var req protocol.PolicyExplainRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		_ = json.NewEncoder(w).Encode(protocol.PolicyExplainResponse{Ref: req.Ref, Action: req.Action, Allowed: true})
+	}))
+	defer ts.Close()
+
+	resp, err := newTestClient(ts).ExplainPolicy(context.Background(), protocol.PolicyExplainRequest{Ref: "op://v/i/f", Action: "create"})
+	if err != nil {
+		t.Fatalf("ExplainPolicy failed: %v", err)
+	}
+	if resp.Ref != "op://v/i/f" || resp.Action != "create" || !resp.Allowed {
+		t.Errorf("Expected the echoed request, got %+v", resp)
+	}
+}
@@ -0,0 +1,281 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zach-source/opx/internal/security"
+	"github.com/zach-source/opx/internal/session"
+	"github.com/zach-source/opx/internal/util"
+)
+
+// Daemon holds opx-authd settings loaded from daemon.json. Values act as
+// defaults for the matching command-line flags, which still take precedence.
+type Daemon struct {
+	Backend               string `json:"backend"`
+	TTLSeconds            int    `json:"ttl_seconds"`
+	Verbose               bool   `json:"verbose"`
+	SessionTimeoutHours   int    `json:"session_timeout_hours"`
+	EnableSessionLock     bool   `json:"enable_session_lock"`
+	LockOnAuthFailure     bool   `json:"lock_on_auth_failure"`
+	SessionUseCountLimit  int    `json:"session_use_count_limit,omitempty"`
+	EnableAuditLog        bool   `json:"enable_audit_log"`
+	AuditLogRetentionDays int    `json:"audit_log_retention_days"`
+	CompressMinBytes      int    `json:"compress_min_bytes"`
+	MaxRequestBytes       int64  `json:"max_request_bytes"`
+	MaxRefsPerRequest     int    `json:"max_refs_per_request"`
+	MaxValueBytes         int64  `json:"max_value_bytes"`
+	LockFile              string `json:"lock_file,omitempty"`
+	// RefreshIntervalSeconds enables background refresh of hot entries (0 disables)
+	RefreshIntervalSeconds int `json:"refresh_interval_seconds"`
+	RefreshMaxEntries      int `json:"refresh_max_entries"`
+	// AuditIncludeCmdline records redacted peer command lines in audit events
+	AuditIncludeCmdline  bool `json:"audit_include_cmdline"`
+	AuditCmdlineMaxBytes int  `json:"audit_cmdline_max_bytes"`
+	// AuditTamperEvident chains an HMAC through the audit log lines (opx audit verify)
+	AuditTamperEvident bool `json:"audit_tamper_evident"`
+	// AuditLogMaxBytes also rotates the day's audit log at this size (0 rotates daily only)
+	AuditLogMaxBytes int64 `json:"audit_log_max_bytes,omitempty"`
+	// Per-request ceilings for /v1/read, /v1/reads and /v1/resolve (0 disables)
+	ReadTimeoutSeconds    int `json:"read_timeout_seconds"`
+	ReadsTimeoutSeconds   int `json:"reads_timeout_seconds"`
+	ResolveTimeoutSeconds int `json:"resolve_timeout_seconds"`
+	// BackendReadTimeoutSeconds bounds the backend read behind a request, which
+	// outlives a timed-out request so it can fill the cache (0 disables)
+	BackendReadTimeoutSeconds int `json:"backend_read_timeout_seconds"`
+	// OpApprovalTimeoutSeconds fails an op call with approval_required once it
+	// has waited this long on a 1Password app approval prompt (0 disables)
+	OpApprovalTimeoutSeconds int `json:"op_approval_timeout_seconds"`
+	// OpEnvPassthrough names variables op inherits beyond the defaults: exact
+	// names, PREFIX_* or "*" for the daemon's whole environment
+	OpEnvPassthrough []string `json:"op_env_passthrough,omitempty"`
+	// TrackSecretChanges audits SECRET_CHANGED when a refresh reads a new value
+	TrackSecretChanges bool `json:"track_secret_changes"`
+	// AllowDebug lets clients that send the debug header see underlying error details
+	AllowDebug bool `json:"allow_debug"`
+	// TLSKeyType and TLSMinKeyBits are the minimum accepted for the daemon
+	// certificate; weaker certs are regenerated (0 bits = 2048 rsa, 256 ecdsa)
+	TLSKeyType    string `json:"tls_key_type"`
+	TLSMinKeyBits int    `json:"tls_min_key_bits,omitempty"`
+	// PolicyDefaultDeny, when set, overrides default_deny from policy.json
+	PolicyDefaultDeny *bool `json:"policy_default_deny,omitempty"`
+	// AuditRequired refuses secret reads while audit events can't be written
+	AuditRequired bool `json:"audit_required"`
+	// DenialMessage tells denied clients how to request access, unless the
+	// matching rule or the policy's deny_message says otherwise
+	DenialMessage string `json:"denial_message,omitempty"`
+	// PeerInfoRequired, when set, decides whether requests from unidentifiable
+	// callers are rejected; unset, they are whenever the policy has default_deny
+	PeerInfoRequired *bool `json:"peer_info_required,omitempty"`
+	// ExpandRefVars fills ${VAR} in refs from the vars a request sends
+	ExpandRefVars bool `json:"expand_ref_vars"`
+	// VaultAccounts maps op:// vault names to the 1Password account that reads them
+	VaultAccounts map[string]string `json:"vault_accounts,omitempty"`
+	// AllowedOpFlags are the op flags clients may send; unset allows only --account
+	AllowedOpFlags []string `json:"allowed_op_flags,omitempty"`
+	// ExpectedAccount locks the session when `op whoami` reports another account
+	ExpectedAccount string `json:"expected_account,omitempty"`
+	// RedactAccountEmail hides the account email's local part in status and logs
+	RedactAccountEmail bool `json:"redact_account_email"`
+	// ReadyFile is written once the daemon is ready, for supervisors without sd_notify
+	ReadyFile string `json:"ready_file,omitempty"`
+	// ReadyWaitBackend holds readiness until the backend answers a ping
+	ReadyWaitBackend bool `json:"ready_wait_backend"`
+	// RefHistoryDays keeps the refs clients read (never values) for completion,
+	// forgetting refs unused that long; DisableRefHistory keeps none
+	RefHistoryDays    int  `json:"ref_history_days"`
+	DisableRefHistory bool `json:"disable_ref_history"`
+	// ApprovalTimeoutSeconds is how long a request held by a require_approval
+	// rule waits for opx approve, and then for its retry
+	ApprovalTimeoutSeconds int `json:"approval_timeout_seconds"`
+	// ApprovalHook runs via /bin/sh with OPX_APPROVAL_* variables, and
+	// ApprovalWebhook gets the approval as JSON, when a request starts waiting
+	ApprovalHook    string `json:"approval_hook,omitempty"`
+	ApprovalWebhook string `json:"approval_webhook,omitempty"`
+	// PersistApprovals keeps approvals across daemon restarts
+	PersistApprovals bool `json:"persist_approvals"`
+	// ListenTCP also serves the API on this loopback address to clients with a
+	// certificate from `opx-authd issue-client-cert`
+	ListenTCP string `json:"listen_tcp,omitempty"`
+}
+
+// DefaultDaemon returns the settings used when no daemon.json exists
+func DefaultDaemon() Daemon {
+	return Daemon{
+		Backend:                   "opcli",
+		TTLSeconds:                120,
+		Verbose:                   true,
+		SessionTimeoutHours:       int(session.DefaultIdleTimeout.Hours()),
+		EnableSessionLock:         true,
+		LockOnAuthFailure:         true,
+		EnableAuditLog:            false,
+		AuditLogRetentionDays:     30,
+		CompressMinBytes:          8192,
+		MaxRequestBytes:           1 << 20,
+		MaxRefsPerRequest:         1000,
+		MaxValueBytes:             1 << 20,
+		RefreshMaxEntries:         32,
+		AuditCmdlineMaxBytes:      security.DefaultCmdlineMax,
+		ReadTimeoutSeconds:        30,
+		ReadsTimeoutSeconds:       120,
+		ResolveTimeoutSeconds:     120,
+		BackendReadTimeoutSeconds: 120,
+		OpApprovalTimeoutSeconds:  30,
+		TLSKeyType:                util.CertKeyRSA,
+		RefHistoryDays:            30,
+		ApprovalTimeoutSeconds:    300,
+	}
+}
+
+// DaemonPath returns the location of daemon.json in the XDG config directory
+func DaemonPath() (string, error) {
+	configDir, err := util.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "daemon.json"), nil
+}
+
+// Load reads daemon.json if present; otherwise returns defaults.
+func Load() (Daemon, string, error) {
+	p, err := DaemonPath()
+	if err != nil {
+		return Daemon{}, "", err
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return DefaultDaemon(), p, nil
+		}
+		return Daemon{}, p, err
+	}
+	cfg, err := Parse(b)
+	if err != nil {
+		return Daemon{}, p, err
+	}
+	return cfg, p, nil
+}
+
+// Parse decodes daemon config JSON on top of the defaults. Full-line comments
+// starting with '#' or '//' are ignored so generated files can be annotated.
+func Parse(data []byte) (Daemon, error) {
+	cfg := DefaultDaemon()
+	if err := util.DecodeJSON(stripComments(util.TrimBOM(data)), &cfg); err != nil {
+		return Daemon{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return Daemon{}, err
+	}
+	return cfg, nil
+}
+
+// Validate checks the settings for values the daemon cannot start with
+func (d Daemon) Validate() error {
+	switch d.Backend {
+	case "opcli", "fake", "vault", "bao", "multi":
+	default:
+		return fmt.Errorf("unknown backend %q", d.Backend)
+	}
+	if d.TTLSeconds < 0 {
+		return errors.New("ttl_seconds cannot be negative")
+	}
+	if d.SessionTimeoutHours < 0 {
+		return errors.New("session_timeout_hours cannot be negative")
+	}
+	if d.SessionUseCountLimit < 0 {
+		return errors.New("session_use_count_limit cannot be negative")
+	}
+	if d.EnableSessionLock && d.SessionTimeoutHours == 0 {
+		return errors.New("session_timeout_hours must be greater than 0 when enable_session_lock is true")
+	}
+	if d.RefreshIntervalSeconds < 0 || d.RefreshMaxEntries < 0 {
+		return errors.New("refresh_interval_seconds and refresh_max_entries cannot be negative")
+	}
+	if d.AuditRequired && !d.EnableAuditLog {
+		return errors.New("audit_required needs enable_audit_log")
+	}
+	if d.AuditCmdlineMaxBytes < 0 {
+		return errors.New("audit_cmdline_max_bytes cannot be negative")
+	}
+	if d.ReadTimeoutSeconds < 0 || d.ReadsTimeoutSeconds < 0 || d.ResolveTimeoutSeconds < 0 {
+		return errors.New("read_timeout_seconds, reads_timeout_seconds and resolve_timeout_seconds cannot be negative")
+	}
+	if d.BackendReadTimeoutSeconds < 0 {
+		return errors.New("backend_read_timeout_seconds cannot be negative")
+	}
+	if d.OpApprovalTimeoutSeconds < 0 {
+		return errors.New("op_approval_timeout_seconds cannot be negative")
+	}
+	for _, p := range d.OpEnvPassthrough {
+		if !util.ValidEnvPattern(p) {
+			return fmt.Errorf("op_env_passthrough: invalid variable pattern %q", p)
+		}
+	}
+	if d.MaxRequestBytes < 0 {
+		return errors.New("max_request_bytes cannot be negative")
+	}
+	if d.MaxRefsPerRequest < 0 {
+		return errors.New("max_refs_per_request cannot be negative")
+	}
+	if d.MaxValueBytes < 0 {
+		return errors.New("max_value_bytes cannot be negative")
+	}
+	if err := d.CertPolicy().Validate(); err != nil {
+		return fmt.Errorf("tls_key_type/tls_min_key_bits: %w", err)
+	}
+	if d.AuditLogRetentionDays < 0 {
+		return errors.New("audit_log_retention_days cannot be negative")
+	}
+	if d.AuditLogMaxBytes < 0 {
+		return errors.New("audit_log_max_bytes cannot be negative")
+	}
+	if d.RefHistoryDays < 0 {
+		return errors.New("ref_history_days cannot be negative")
+	}
+	if d.ApprovalTimeoutSeconds <= 0 {
+		return errors.New("approval_timeout_seconds must be positive")
+	}
+	if d.ApprovalWebhook != "" {
+		if u, err := url.Parse(d.ApprovalWebhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("approval_webhook: %q is not an http(s) URL", d.ApprovalWebhook)
+		}
+	}
+	if d.ListenTCP != "" {
+		if err := util.CheckLoopbackAddr(d.ListenTCP); err != nil {
+			return fmt.Errorf("listen_tcp: %w", err)
+		}
+	}
+	for vault, account := range d.VaultAccounts {
+		if vault == "" || account == "" {
+			return errors.New("vault_accounts cannot map empty vault names or accounts")
+		}
+	}
+	for _, flag := range d.AllowedOpFlags {
+		if !strings.HasPrefix(flag, "-") || strings.Contains(flag, "=") {
+			return fmt.Errorf("allowed_op_flags entry %q must be a flag name such as --account", flag)
+		}
+	}
+	return nil
+}
+
+// CertPolicy returns the TLS certificate policy for the daemon
+func (d Daemon) CertPolicy() util.CertPolicy {
+	return util.CertPolicy{KeyType: d.TLSKeyType, MinBits: d.TLSMinKeyBits}
+}
+
+// stripComments blanks out full-line '#' and '//' comments, keeping line numbers intact
+func stripComments(data []byte) []byte {
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(string(line))
+		if strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "//") {
+			lines[i] = nil
+		}
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
@@ -0,0 +1,224 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerate_NonInteractiveDefaults(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var out strings.Builder
+	if err := Generate(&out, DefaultDaemon(), now); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	text := out.String()
+
+	if !strings.HasPrefix(text, "# generated by opx-authd generate-config on 2025-01-02T03:04:05Z\n") {
+		t.Errorf("Expected generated header, got %q", strings.SplitN(text, "\n", 2)[0])
+	}
+	if !strings.Contains(text, `#   "lock_file": `) {
+		t.Error("Expected commented-out advanced options")
+	}
+
+	// Advanced options only cover keys the emitted object leaves out
+	body := text[strings.Index(text, "{"):]
+	var emitted map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &emitted); err != nil {
+		t.Fatalf("Generated body is not JSON: %v", err)
+	}
+	for _, opt := range advancedOptions {
+		key := strings.Trim(strings.SplitN(opt, ":", 2)[0], `"`)
+		if _, ok := emitted[key]; ok {
+			t.Errorf("Expected advanced option %q not to duplicate an emitted key", key)
+		}
+	}
+
+	cfg, err := Parse([]byte(text))
+	if err != nil {
+		t.Fatalf("Generated config does not parse: %v", err)
+	}
+	def := DefaultDaemon()
+	if cfg.Backend != def.Backend {
+		t.Errorf("Expected backend %q, got %q", def.Backend, cfg.Backend)
+	}
+	if cfg.TTLSeconds != def.TTLSeconds {
+		t.Errorf("Expected ttl %d, got %d", def.TTLSeconds, cfg.TTLSeconds)
+	}
+	if cfg.SessionTimeoutHours != def.SessionTimeoutHours {
+		t.Errorf("Expected session timeout %d, got %d", def.SessionTimeoutHours, cfg.SessionTimeoutHours)
+	}
+	if cfg.EnableAuditLog {
+		t.Error("Expected audit log disabled by default")
+	}
+	if cfg.PolicyDefaultDeny != nil {
+		t.Error("Expected policy default deny to be unset by default")
+	}
+}
+
+func TestPrompt(t *testing.T) {
+	tests := []struct {
+		name           string
+		input          string
+		backend        string
+		ttl            int
+		timeout        int
+		sessionLock    bool
+		audit          bool
+		strictPolicy   bool
+		expectInOutput string
+	}{
+		{
+			name:        "all defaults",
+			input:       "\n\n\n\n\n",
+			backend:     "opcli",
+			ttl:         120,
+			timeout:     8,
+			sessionLock: true,
+		},
+		{
+			name:         "custom answers",
+			input:        "vault\n300\n0\ny\nstrict\n",
+			backend:      "vault",
+			ttl:          300,
+			timeout:      0,
+			sessionLock:  false,
+			audit:        true,
+			strictPolicy: true,
+		},
+		{
+			name:           "invalid answers are re-asked",
+			input:          "nope\nfake\n-1\n60\n\nmaybe\nn\nloose\npermissive\n",
+			backend:        "fake",
+			ttl:            60,
+			timeout:        8,
+			sessionLock:    true,
+			expectInOutput: "unknown backend",
+		},
+		{
+			name:        "EOF keeps defaults",
+			input:       "bao\n",
+			backend:     "bao",
+			ttl:         120,
+			timeout:     8,
+			sessionLock: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			cfg, err := Prompt(strings.NewReader(tt.input), &out)
+			if err != nil {
+				t.Fatalf("Prompt failed: %v", err)
+			}
+			if cfg.Backend != tt.backend {
+				t.Errorf("Expected backend %q, got %q", tt.backend, cfg.Backend)
+			}
+			if cfg.TTLSeconds != tt.ttl {
+				t.Errorf("Expected ttl %d, got %d", tt.ttl, cfg.TTLSeconds)
+			}
+			if cfg.SessionTimeoutHours != tt.timeout {
+				t.Errorf("Expected timeout %d, got %d", tt.timeout, cfg.SessionTimeoutHours)
+			}
+			if cfg.EnableSessionLock != tt.sessionLock {
+				t.Errorf("Expected session lock %v, got %v", tt.sessionLock, cfg.EnableSessionLock)
+			}
+			if cfg.EnableAuditLog != tt.audit {
+				t.Errorf("Expected audit %v, got %v", tt.audit, cfg.EnableAuditLog)
+			}
+			if strict := cfg.PolicyDefaultDeny != nil && *cfg.PolicyDefaultDeny; strict != tt.strictPolicy {
+				t.Errorf("Expected strict policy %v, got %v", tt.strictPolicy, strict)
+			}
+			if !strings.Contains(out.String(), "[opcli]") {
+				t.Error("Expected defaults shown in brackets")
+			}
+			if tt.expectInOutput != "" && !strings.Contains(out.String(), tt.expectInOutput) {
+				t.Errorf("Expected output to contain %q, got %q", tt.expectInOutput, out.String())
+			}
+		})
+	}
+}
+
+func TestParse_BOM(t *testing.T) {
+	cfg, err := Parse([]byte("\xEF\xBB\xBF// written on Windows\n{\"ttl_seconds\":60}\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.TTLSeconds != 60 {
+		t.Errorf("Expected ttl 60, got %d", cfg.TTLSeconds)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "bad json", data: `{"backend":`},
+		{name: "unknown backend", data: `{"backend":"nope"}`},
+		{name: "negative ttl", data: `{"ttl_seconds":-1}`},
+		{name: "lock without timeout", data: `{"enable_session_lock":true,"session_timeout_hours":0}`},
+		{name: "negative session use count limit", data: `{"session_use_count_limit":-1}`},
+		{name: "negative request timeout", data: `{"reads_timeout_seconds":-1}`},
+		{name: "negative max request bytes", data: `{"max_request_bytes":-1}`},
+		{name: "negative max refs per request", data: `{"max_refs_per_request":-1}`},
+		{name: "negative audit log max bytes", data: `{"audit_log_max_bytes":-1}`},
+		{name: "unknown tls key type", data: `{"tls_key_type":"dsa"}`},
+		{name: "empty vault account", data: `{"vault_accounts":{"Work":""}}`},
+		{name: "allowed op flag with value", data: `{"allowed_op_flags":["--account=acme"]}`},
+		{name: "allowed op flag without dash", data: `{"allowed_op_flags":["account"]}`},
+		{name: "bad env passthrough pattern", data: `{"op_env_passthrough":["AWS*KEY"]}`},
+		{name: "unsupported ecdsa size", data: `{"tls_key_type":"ecdsa","tls_min_key_bits":1024}`},
+		{name: "zero approval timeout", data: `{"approval_timeout_seconds":0}`},
+		{name: "approval webhook not a url", data: `{"approval_webhook":"hooks.example/approve"}`},
+		{name: "audit required without audit log", data: `{"audit_required":true}`},
+		{name: "listen tcp not loopback", data: `{"listen_tcp":"0.0.0.0:7070"}`},
+		{name: "trailing garbage", data: "{\"backend\":\"opcli\"}\n}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.data)); err == nil {
+				t.Error("Expected error but got none")
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+
+	cfg, path, err := Load()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if path != filepath.Join(configHome, "op-authd", "daemon.json") {
+		t.Errorf("Unexpected config path %q", path)
+	}
+	if cfg.Backend != "opcli" {
+		t.Errorf("Expected default backend, got %q", cfg.Backend)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	data := "// local overrides\n{\"backend\":\"fake\",\"ttl_seconds\":30}\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, _, err = Load()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Backend != "fake" || cfg.TTLSeconds != 30 {
+		t.Errorf("Expected file values, got %+v", cfg)
+	}
+	if cfg.CompressMinBytes != 8192 {
+		t.Errorf("Expected unset fields to keep defaults, got %d", cfg.CompressMinBytes)
+	}
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// advancedOptions documents the settings Generate's JSON leaves out because they are unset by default
+var advancedOptions = []string{
+	`"lock_file": "/path/to/opx-authd.lock"   single-instance lockfile location`,
+	`"session_use_count_limit": 100    lock the session after this many reads, so the next one re-authenticates`,
+	`"audit_log_max_bytes": 10485760   also rotate the day's audit log at this size`,
+	`"tls_min_key_bits": 3072          minimum key size (default 2048 for rsa, 256 for ecdsa)`,
+	`"policy_default_deny": true       override default_deny from policy.json`,
+	`"denial_message": "ask #secrets-access"   hint sent to denied clients on how to request access`,
+	`"peer_info_required": true        reject callers the daemon can't identify (default: when default_deny)`,
+	`"ready_file": "/run/user/1000/opx-authd.ready"   written once the daemon is ready`,
+	`"expected_account": "acme.1password.com"   lock the session if op whoami reports another account`,
+	`"op_env_passthrough": ["AWS_PROFILE", "OP_SESSION_*"]   extra variables op inherits ("*" for all)`,
+	`"vault_accounts": OBJECT          vault name -> account for op:// reads, e.g. "Work": "acme.1password.com"`,
+	`"allowed_op_flags": ["--account"]   op flags clients may pass (default: only --account)`,
+	`"approval_hook": "notify-send 'opx approve' $OPX_APPROVAL_ID"   run when a require_approval rule holds a request`,
+	`"approval_webhook": "https://hooks.example/opx"   POST each new approval as JSON`,
+	`"listen_tcp": "127.0.0.1:7070"    also serve mutual-TLS clients (opx-authd issue-client-cert) on this loopback address`,
+}
+
+// Generate writes cfg as an annotated daemon.json
+func Generate(w io.Writer, cfg Daemon, now time.Time) error {
+	body, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# generated by opx-authd generate-config on %s\n", now.Format(time.RFC3339))
+	b.WriteString("# Command-line flags override these values.\n")
+	b.WriteString("#\n")
+	b.WriteString("# Advanced settings (copy into the object below to change):\n")
+	for _, opt := range advancedOptions {
+		b.WriteString("#   " + opt + "\n")
+	}
+	b.Write(body)
+	b.WriteString("\n")
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// Prompt asks for the common settings on out, reading answers from in.
+// Empty answers keep the default shown in brackets.
+func Prompt(in io.Reader, out io.Writer) (Daemon, error) {
+	cfg := DefaultDaemon()
+	scanner := bufio.NewScanner(in)
+
+	ask := func(question, def string) (string, error) {
+		fmt.Fprintf(out, "%s [%s]: ", question, def)
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return "", err
+			}
+			return def, nil // EOF keeps remaining defaults
+		}
+		answer := strings.TrimSpace(scanner.Text())
+		if answer == "" {
+			return def, nil
+		}
+		return answer, nil
+	}
+
+	for {
+		v, err := ask("Backend (opcli|fake|vault|bao|multi)", cfg.Backend)
+		if err != nil {
+			return Daemon{}, err
+		}
+		cfg.Backend = v
+		if cfg.Validate() == nil {
+			break
+		}
+		fmt.Fprintf(out, "  unknown backend %q\n", v)
+	}
+
+	var err error
+	if cfg.TTLSeconds, err = askInt(ask, "Cache TTL in seconds", cfg.TTLSeconds, out); err != nil {
+		return Daemon{}, err
+	}
+	if cfg.SessionTimeoutHours, err = askInt(ask, "Session idle timeout in hours (0 disables session lock)", cfg.SessionTimeoutHours, out); err != nil {
+		return Daemon{}, err
+	}
+	cfg.EnableSessionLock = cfg.SessionTimeoutHours > 0
+	if cfg.EnableAuditLog, err = askBool(ask, "Enable audit log", cfg.EnableAuditLog, out); err != nil {
+		return Daemon{}, err
+	}
+
+	for {
+		v, err := ask("Policy strictness (permissive|strict)", "permissive")
+		if err != nil {
+			return Daemon{}, err
+		}
+		switch v {
+		case "permissive":
+		case "strict":
+			deny := true
+			cfg.PolicyDefaultDeny = &deny
+		default:
+			fmt.Fprintf(out, "  please answer permissive or strict\n")
+			continue
+		}
+		break
+	}
+
+	return cfg, nil
+}
+
+func askInt(ask func(string, string) (string, error), question string, def int, out io.Writer) (int, error) {
+	for {
+		v, err := ask(question, strconv.Itoa(def))
+		if err != nil {
+			return 0, err
+		}
+		n, err := strconv.Atoi(v)
+		if err == nil && n >= 0 {
+			return n, nil
+		}
+		fmt.Fprintf(out, "  please enter a non-negative number\n")
+	}
+}
+
+func askBool(ask func(string, string) (string, error), question string, def bool, out io.Writer) (bool, error) {
+	defStr := "n"
+	if def {
+		defStr = "y"
+	}
+	for {
+		v, err := ask(question+" (y/n)", defStr)
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(v) {
+		case "y", "yes", "true":
+			return true, nil
+		case "n", "no", "false":
+			return false, nil
+		}
+		fmt.Fprintf(out, "  please answer y or n\n")
+	}
+}
@@ -0,0 +1,151 @@
+// Package envfile loads NAME=REF mapping files for opx run and friends. A file
+// holds one NAME=REF per line, # comments, blank lines and `include PATH`
+// directives; PATH is relative to the including file.
+package envfile
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zach-source/opx/internal/util"
+)
+
+// Mapping is one NAME=REF pair and where it was defined, as file:line or a flag name
+type Mapping struct {
+	Name   string
+	Ref    string
+	Source string
+}
+
+// Env is an ordered set of mappings. A name keeps the position of its first
+// definition but takes the ref of its last one.
+type Env struct {
+	mappings []Mapping
+	index    map[string]int
+}
+
+// Set adds m, replacing any earlier mapping of the same name
+func (e *Env) Set(m Mapping) {
+	if e.index == nil {
+		e.index = make(map[string]int)
+	}
+	if i, ok := e.index[m.Name]; ok {
+		e.mappings[i] = m
+		return
+	}
+	e.index[m.Name] = len(e.mappings)
+	e.mappings = append(e.mappings, m)
+}
+
+// Mappings returns the effective mappings in definition order
+func (e *Env) Mappings() []Mapping {
+	return append([]Mapping(nil), e.mappings...)
+}
+
+// Map returns the effective mappings as NAME -> REF
+func (e *Env) Map() map[string]string {
+	out := make(map[string]string, len(e.mappings))
+	for _, m := range e.mappings {
+		out[m.Name] = m.Ref
+	}
+	return out
+}
+
+// Load reads path and everything it includes. Mappings apply in file order
+// with each include expanded where it appears, so a later include or line
+// overrides an earlier one. Including a file that is already being loaded is
+// an error; including the same file twice from different places is not.
+func Load(path string) (*Env, error) {
+	env := &Env{}
+	if err := load(env, path, nil); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// load applies path to env; stack holds the absolute paths of the files including it
+func load(env *Env, path string, stack []string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	for i, p := range stack {
+		if p == abs {
+			return fmt.Errorf("include cycle: %s", strings.Join(append(stack[i:], abs), " -> "))
+		}
+	}
+	stack = append(stack, abs)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open env file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		where := fmt.Sprintf("%s:%d", path, n)
+		if rest, ok := cutDirective(line, "include"); ok {
+			target := unquote(rest)
+			if target == "" {
+				return fmt.Errorf("%s: include needs a path", where)
+			}
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(path), target)
+			}
+			if err := load(env, target, stack); err != nil {
+				return fmt.Errorf("%s: %w", where, err)
+			}
+			continue
+		}
+		if rest, ok := cutDirective(line, "export"); ok {
+			line = rest
+		}
+		name, ref, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !util.ValidEnvName(name) {
+			return fmt.Errorf("%s: bad mapping: %s", where, line)
+		}
+		env.Set(Mapping{Name: name, Ref: unquote(strings.TrimSpace(ref)), Source: where})
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return nil
+}
+
+// cutDirective returns what follows keyword and whitespace at the start of line
+func cutDirective(line, keyword string) (string, bool) {
+	rest, ok := strings.CutPrefix(line, keyword)
+	if !ok || rest == "" || (rest[0] != ' ' && rest[0] != '\t') {
+		return "", false
+	}
+	return strings.TrimSpace(rest), true
+}
+
+// unquote strips one pair of matching single or double quotes
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// Format renders mappings as NAME=REF lines with where each was defined, never resolving them
+func Format(mappings []Mapping) string {
+	var b strings.Builder
+	for _, m := range mappings {
+		fmt.Fprintf(&b, "%s=%s\t# %s\n", m.Name, m.Ref, m.Source)
+	}
+	return b.String()
+}
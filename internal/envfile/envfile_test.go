@@ -0,0 +1,149 @@
+package envfile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates each name -> content under dir, making parent directories
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected map[string]string
+		order    []string
+		err      string
+	}{
+		{
+			name: "plain mappings",
+			files: map[string]string{".envrc.opx": `# comment
+DB_PASS=op://vault/db/password
+
+export API_KEY="vault://secret/api#key"
+`},
+			expected: map[string]string{"DB_PASS": "op://vault/db/password", "API_KEY": "vault://secret/api#key"},
+			order:    []string{"DB_PASS", "API_KEY"},
+		},
+		{
+			name: "nested includes relative to the including file",
+			files: map[string]string{
+				".envrc.opx":             "include shared/base.opx\nAPP=op://v/app/key\n",
+				"shared/base.opx":        "include common/db.opx\nBASE=op://v/base/key\n",
+				"shared/common/db.opx":   "DB=op://v/db/password\n",
+				"unused/common/db.opx":   "DB=op://v/wrong/password\n",
+				"shared/unused/base.opx": "BASE=op://v/wrong/key\n",
+			},
+			expected: map[string]string{"DB": "op://v/db/password", "BASE": "op://v/base/key", "APP": "op://v/app/key"},
+			order:    []string{"DB", "BASE", "APP"},
+		},
+		{
+			name: "later includes and lines win",
+			files: map[string]string{
+				".envrc.opx": "A=op://v/main/a\ninclude first.opx\ninclude second.opx\nC=op://v/main/c\n",
+				"first.opx":  "A=op://v/first/a\nB=op://v/first/b\nC=op://v/first/c\n",
+				"second.opx": "B=op://v/second/b\n",
+			},
+			expected: map[string]string{"A": "op://v/first/a", "B": "op://v/second/b", "C": "op://v/main/c"},
+			order:    []string{"A", "B", "C"},
+		},
+		{
+			name: "same file included twice is not a cycle",
+			files: map[string]string{
+				".envrc.opx": "include a.opx\ninclude b.opx\n",
+				"a.opx":      "include common.opx\n",
+				"b.opx":      "include common.opx\n",
+				"common.opx": "X=op://v/x/y\n",
+			},
+			expected: map[string]string{"X": "op://v/x/y"},
+			order:    []string{"X"},
+		},
+		{
+			name: "self include",
+			files: map[string]string{
+				".envrc.opx": "include .envrc.opx\n",
+			},
+			err: "include cycle",
+		},
+		{
+			name: "indirect cycle",
+			files: map[string]string{
+				".envrc.opx": "include a.opx\n",
+				"a.opx":      "include sub/b.opx\n",
+				"sub/b.opx":  "include ../a.opx\n",
+			},
+			err: "a.opx -> ",
+		},
+		{
+			name:  "missing include",
+			files: map[string]string{".envrc.opx": "include nowhere.opx\n"},
+			err:   ".envrc.opx:1: failed to open env file",
+		},
+		{
+			name:  "bad mapping",
+			files: map[string]string{".envrc.opx": "A=op://v/a/b\nnot a mapping\n"},
+			err:   ".envrc.opx:2: bad mapping",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+
+			env, err := Load(filepath.Join(dir, ".envrc.opx"))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(env.Map(), tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, env.Map())
+			}
+			var order []string
+			for _, m := range env.Mappings() {
+				order = append(order, m.Name)
+			}
+			if !reflect.DeepEqual(order, tt.order) {
+				t.Errorf("Expected order %v, got %v", tt.order, order)
+			}
+		})
+	}
+}
+
+func TestEnv_SetOverridesAndRecordsSource(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".envrc.opx": "include base.opx\n",
+		"base.opx":   "A=op://v/base/a\nB=op://v/base/b\n",
+	})
+	env, err := Load(filepath.Join(dir, ".envrc.opx"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	env.Set(Mapping{Name: "A", Ref: "op://v/cli/a", Source: "--env"})
+
+	expected := "A=op://v/cli/a\t# --env\nB=op://v/base/b\t# " + filepath.Join(dir, "base.opx") + ":2\n"
+	if got := Format(env.Mappings()); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
@@ -5,9 +5,12 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/zach-source/opx/internal/util"
 )
@@ -16,12 +19,90 @@ type Rule struct {
 	Path       string   `json:"path,omitempty"`        // absolute binary path
 	PathSHA256 string   `json:"path_sha256,omitempty"` // sha256 of the path string
 	PID        int      `json:"pid,omitempty"`         // optional exact PID match
+	Scheme     string   `json:"scheme,omitempty"`      // optional ref scheme (op, vault, bao, ...) the rule is confined to
 	Refs       []string `json:"refs"`                  // allowed refs; supports "*" and prefix wildcards
+	Actions    []string `json:"actions,omitempty"`     // actions the rule authorizes; empty means read only
+	// Message is returned to a caller this rule applies to when it doesn't cover the ref
+	Message string `json:"message,omitempty"`
+	// ContainerPath and ContainerIDPrefix match callers inside a container
+	// sharing the socket: the binary's path in the container and its ID's start
+	ContainerPath     string `json:"container_path,omitempty"`
+	ContainerIDPrefix string `json:"container_id_prefix,omitempty"`
+	// CertCN matches clients of the daemon's TCP listener by the common name of
+	// their client certificate. Only rules with it apply to such clients.
+	CertCN string `json:"cert_cn,omitempty"`
+	// ExpiresAt ends a temporary grant: the rule stops matching then and the daemon prunes it
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Schedule confines the rule to recurring windows of the day; empty applies at all times
+	Schedule []Window `json:"schedule,omitempty"`
+	// RequireApproval holds each request the rule grants until an admin approves it with opx approve
+	RequireApproval bool `json:"require_approval,omitempty"`
+	// MaxReads limits how often one binary may read one ref under the rule
+	// within any Per-long window (a duration such as "1h"); 0 is unlimited
+	MaxReads int    `json:"max_reads,omitempty"`
+	Per      string `json:"per,omitempty"`
+}
+
+// Expired reports whether the rule has an expiry at or before now
+func (r Rule) Expired(now time.Time) bool {
+	return r.ExpiresAt != nil && !now.Before(*r.ExpiresAt)
+}
+
+// Actions a rule can authorize
+const (
+	ActionRead   = "read"
+	ActionWrite  = "write"
+	ActionCreate = "create"
+)
+
+// Actions lists the values accepted in Rule.Actions
+var Actions = []string{ActionRead, ActionWrite, ActionCreate}
+
+// authorizes reports whether the rule lists action, treating an empty list as read only
+func (r Rule) authorizes(action string) bool {
+	if len(r.Actions) == 0 {
+		return action == ActionRead
+	}
+	for _, a := range r.Actions {
+		if strings.EqualFold(a, action) {
+			return true
+		}
+	}
+	return false
 }
 
 type Policy struct {
 	Allow       []Rule `json:"allow"`
 	DefaultDeny bool   `json:"default_deny"`
+	// DenyMessage is returned on a denial no matching rule has a message for
+	DenyMessage string `json:"deny_message,omitempty"`
+	// Admin lists the peers that may call admin endpoints; nil keeps the daemon's default
+	Admin *Admin `json:"admin,omitempty"`
+}
+
+// Admin is an allowlist of peers for admin endpoints, by binary path or UID
+type Admin struct {
+	Paths []string `json:"paths,omitempty"` // absolute binary paths
+	UIDs  []uint32 `json:"uids,omitempty"`
+}
+
+// Allows reports whether a peer running path as uid is on the allowlist
+func (a Admin) Allows(path string, uid uint32) bool {
+	return (path != "" && slices.Contains(a.Paths, path)) || slices.Contains(a.UIDs, uid)
+}
+
+// RequiresPeerInfo resolves a peer_info_required setting: unset, callers must be
+// identifiable exactly when the policy denies by default
+func (p Policy) RequiresPeerInfo(setting *bool) bool {
+	if setting != nil {
+		return *setting
+	}
+	return p.DefaultDeny
+}
+
+// FailsOpen reports whether rules exist that unidentified callers would bypass
+func (p Policy) FailsOpen(setting *bool) bool {
+	return (len(p.Allow) > 0 || p.DefaultDeny) && !p.RequiresPeerInfo(setting)
 }
 
 func defaultPolicy() Policy {
@@ -38,18 +119,151 @@ func Load() (Policy, string, error) {
 		return Policy{}, "", err
 	}
 	p := filepath.Join(configDir, "policy.json")
-	b, err := os.ReadFile(p)
+	pol, err := LoadFile(p)
+	return pol, p, err
+}
+
+// LoadFile reads a policy from path, returning the default policy if it doesn't exist
+func LoadFile(path string) (Policy, error) {
+	b, err := os.ReadFile(path)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return defaultPolicy(), p, nil
+			return defaultPolicy(), nil
 		}
-		return Policy{}, p, err
+		return Policy{}, err
 	}
 	var pol Policy
-	if err := json.Unmarshal(b, &pol); err != nil {
-		return Policy{}, p, err
+	if err := util.DecodeJSON(b, &pol); err != nil {
+		return Policy{}, err
+	}
+	if err := pol.validateActions(); err != nil {
+		return Policy{}, err
+	}
+	if err := pol.validateSchedules(); err != nil {
+		return Policy{}, err
+	}
+	if err := pol.validateCertRules(); err != nil {
+		return Policy{}, err
+	}
+	if err := pol.validateQuotas(); err != nil {
+		return Policy{}, err
+	}
+	if pol.Admin != nil {
+		for _, p := range pol.Admin.Paths {
+			if !filepath.IsAbs(p) {
+				return Policy{}, fmt.Errorf("admin path %q must be absolute", p)
+			}
+		}
+	}
+	return pol, nil
+}
+
+// validateActions rejects rules listing an action outside Actions
+func (p Policy) validateActions() error {
+	for i, r := range p.Allow {
+		for _, a := range r.Actions {
+			if !slices.Contains(Actions, strings.ToLower(a)) {
+				return fmt.Errorf("rule %d: unknown action %q (want %s)", i, a, strings.Join(Actions, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// validateCertRules rejects rules that match a certificate client and peer
+// credentials at once, which no caller can satisfy
+func (p Policy) validateCertRules() error {
+	for i, r := range p.Allow {
+		if r.CertCN != "" && (r.Path != "" || r.PathSHA256 != "" || r.PID != 0 || r.ContainerPath != "" || r.ContainerIDPrefix != "") {
+			return fmt.Errorf("rule %d: cert_cn can't be combined with path, path_sha256, pid or container fields", i)
+		}
+	}
+	return nil
+}
+
+// Save atomically writes pol to path. The previous contents are first copied to
+// path+".bak" and that backup path is returned; it is "" when no file existed.
+func Save(path string, pol Policy) (string, error) {
+	data, err := json.MarshalIndent(pol, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal policy: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", err
+	}
+
+	var backup string
+	prev, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		backup = path + ".bak"
+		if err := util.WriteFileAtomic(backup, prev, 0o600); err != nil {
+			return "", fmt.Errorf("failed to back up policy: %w", err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return "", err
+	}
+
+	if err := util.WriteFileAtomic(path, data, 0o600); err != nil {
+		return "", fmt.Errorf("failed to write policy file: %w", err)
+	}
+	return backup, nil
+}
+
+// RestoreBackup undoes a Save: it puts backup back at path, or removes path
+// when backup is "" (there was no policy file before)
+func RestoreBackup(path, backup string) error {
+	if backup == "" {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	data, err := os.ReadFile(backup)
+	if err != nil {
+		return fmt.Errorf("failed to read policy backup: %w", err)
+	}
+	return util.WriteFileAtomic(path, data, 0o600)
+}
+
+// HasExpiring reports whether any rule has an expiry
+func (p Policy) HasExpiring() bool {
+	for _, r := range p.Allow {
+		if r.ExpiresAt != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// WithoutExpired returns a copy of p without the rules expired at now, and how many were dropped
+func (p Policy) WithoutExpired(now time.Time) (Policy, int) {
+	kept := make([]Rule, 0, len(p.Allow))
+	for _, r := range p.Allow {
+		if !r.Expired(now) {
+			kept = append(kept, r)
+		}
+	}
+	removed := len(p.Allow) - len(kept)
+	p.Allow = kept
+	return p, removed
+}
+
+// PruneExpired removes the rules expired at now from the policy file at path,
+// saving it (with a backup) only if any were, and returns how many it removed
+func PruneExpired(path string, now time.Time) (int, error) {
+	pol, err := LoadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pruned, removed := pol.WithoutExpired(now)
+	if removed == 0 {
+		return 0, nil
+	}
+	if _, err := Save(path, pruned); err != nil {
+		return 0, err
 	}
-	return pol, p, nil
+	return removed, nil
 }
 
 func sha256Hex(s string) string {
@@ -73,31 +287,243 @@ func matchRef(allowed []string, ref string) bool {
 	return false
 }
 
+// refScheme returns the URI scheme of ref ("op" for op://...), or "" if it has none
+func refScheme(ref string) string {
+	scheme, _, found := strings.Cut(ref, "://")
+	if !found {
+		return ""
+	}
+	return scheme
+}
+
 type Subject struct {
 	PID  int
 	Path string
+	// ContainerPath and ContainerID are set for callers inside a container
+	ContainerPath string
+	ContainerID   string
+	// CertCN is set for callers on the TCP listener, which have no PID or path
+	CertCN string
 }
 
 // Allowed answers whether the Subject may read the given ref under Policy.
 func Allowed(pol Policy, subj Subject, ref string) bool {
+	return AllowedAction(pol, subj, ref, ActionRead)
+}
+
+// AllowedAction answers whether the Subject may perform action on ref under Policy
+func AllowedAction(pol Policy, subj Subject, ref, action string) bool {
+	return Decide(pol, subj, ref, action).Allowed
+}
+
+// Decision is the outcome of a policy check; Message is the remediation hint for a denial
+type Decision struct {
+	Allowed bool
+	Message string
+	// RequireApproval is set when the rule that allowed the request wants a human to approve it first
+	RequireApproval bool
+	// Quota is the read limit of the rule that allowed the request, if it has one
+	Quota *Quota
+}
+
+// Decide checks whether the Subject may perform action on ref. A denial carries
+// the Message of the first rule that applies to the subject and ref scheme
+// without covering the ref, else the policy's DenyMessage.
+func Decide(pol Policy, subj Subject, ref, action string) Decision {
+	return DecideAt(pol, subj, ref, action, time.Now())
+}
+
+// DecideAt is Decide with expiries and schedules evaluated at now
+func DecideAt(pol Policy, subj Subject, ref, action string, now time.Time) Decision {
+	return ExplainAt(pol, subj, ref, action, now).Decision
+}
+
+// RuleTrace is why one rule did or didn't grant the request
+type RuleTrace struct {
+	Index   int // 1-based position in the allow list
+	Rule    Rule
+	Matched bool
+	Reason  string
+}
+
+// Explanation is a decision with the rules considered on the way to it.
+// Rules after the one that granted access are not considered.
+type Explanation struct {
+	Decision
+	Rules  []RuleTrace
+	Reason string
+	// OutsideWindow is set on a denial only a rule's schedule caused; Reason then
+	// says when the next window opens
+	OutsideWindow bool
+}
+
+// MatchedRule is the 1-based index of the rule that granted access, or 0
+func (e Explanation) MatchedRule() int {
+	for _, t := range e.Rules {
+		if t.Matched {
+			return t.Index
+		}
+	}
+	return 0
+}
+
+// Explain evaluates the policy like Decide and records why each rule did or didn't match
+func Explain(pol Policy, subj Subject, ref, action string) Explanation {
+	return ExplainAt(pol, subj, ref, action, time.Now())
+}
+
+// ExplainAt is Explain with expiries and schedules evaluated at now
+func ExplainAt(pol Policy, subj Subject, ref, action string, now time.Time) Explanation {
 	if len(pol.Allow) == 0 && !pol.DefaultDeny {
-		return true
+		return Explanation{Decision: Decision{Allowed: true}, Reason: "the policy has no rules and allows by default"}
 	}
-	for _, r := range pol.Allow {
-		if r.PID != 0 && r.PID != subj.PID {
-			continue
+	var e Explanation
+	message := ""
+	// scheduled is the first rule that covers the request but for its schedule
+	var scheduled *RuleTrace
+	for i, r := range pol.Allow {
+		trace := RuleTrace{Index: i + 1, Rule: r}
+		trace.Reason = r.mismatch(subj, ref, now)
+		applies := trace.Reason == ""
+		if applies {
+			trace.Reason = r.refMismatch(ref, action)
 		}
-		if r.Path != "" && !samePath(r.Path, subj.Path) {
-			continue
+		if trace.Reason == "" {
+			if trace.Reason = r.scheduleMismatch(now); trace.Reason != "" && scheduled == nil {
+				scheduled = &trace
+			}
 		}
-		if r.PathSHA256 != "" && r.PathSHA256 != sha256Hex(subj.Path) {
-			continue
+		if trace.Reason == "" {
+			trace.Matched = true
+			trace.Reason = "matches"
+			e.Rules = append(e.Rules, trace)
+			e.Allowed = true
+			e.Reason = fmt.Sprintf("allowed by rule %d", trace.Index)
+			if r.RequireApproval {
+				e.RequireApproval = true
+				e.Reason += " once approved"
+			}
+			e.Quota = r.quota(trace.Index)
+			return e
 		}
-		if matchRef(r.Refs, ref) {
-			return true
+		if applies && message == "" {
+			message = r.Message
+		}
+		e.Rules = append(e.Rules, trace)
+	}
+	if !pol.DefaultDeny {
+		e.Allowed = true
+		e.Reason = "no rule matched and the policy allows by default"
+		return e
+	}
+	if scheduled != nil {
+		// Only the clock stands in the way, so say when access opens rather than a generic hint
+		e.OutsideWindow = true
+		e.Message = scheduled.Reason
+		e.Reason = fmt.Sprintf("rule %d is %s", scheduled.Index, scheduled.Reason)
+		return e
+	}
+	if message == "" {
+		message = pol.DenyMessage
+	}
+	e.Message = message
+	e.Reason = "no rule matched and the policy has default_deny"
+	return e
+}
+
+// mismatch says why the rule doesn't apply to subj or the ref's scheme, or "" if it does
+func (r Rule) mismatch(subj Subject, ref string, now time.Time) string {
+	switch {
+	case r.Expired(now):
+		return fmt.Sprintf("expired at %s", r.ExpiresAt.Format(time.RFC3339))
+	case subj.CertCN != "" && r.CertCN == "":
+		return fmt.Sprintf("certificate client %s needs a cert_cn rule", subj.CertCN)
+	case r.CertCN != "" && r.CertCN != subj.CertCN:
+		return fmt.Sprintf("certificate CN %s is not %s", displayPath(subj.CertCN), r.CertCN)
+	case r.PID != 0 && r.PID != subj.PID:
+		return fmt.Sprintf("pid %d is not %d", subj.PID, r.PID)
+	case r.Path != "" && !samePath(r.Path, subj.Path):
+		return fmt.Sprintf("path %s is not %s", displayPath(subj.Path), r.Path)
+	case r.PathSHA256 != "" && r.PathSHA256 != sha256Hex(subj.Path):
+		return fmt.Sprintf("sha256 of path %s is not %s", displayPath(subj.Path), r.PathSHA256)
+	case r.ContainerPath != "" && !samePath(r.ContainerPath, subj.ContainerPath):
+		return fmt.Sprintf("container path %s is not %s", displayPath(subj.ContainerPath), r.ContainerPath)
+	case r.ContainerIDPrefix != "" && (subj.ContainerID == "" || !strings.HasPrefix(subj.ContainerID, strings.ToLower(r.ContainerIDPrefix))):
+		return fmt.Sprintf("container %s does not start with %s", displayPath(subj.ContainerID), r.ContainerIDPrefix)
+	case r.Scheme != "" && !strings.EqualFold(r.Scheme, refScheme(ref)):
+		return fmt.Sprintf("scheme %q is not %q", refScheme(ref), r.Scheme)
+	}
+	return ""
+}
+
+// refMismatch says why a rule that applies doesn't grant action on ref, or "" if it does
+func (r Rule) refMismatch(ref, action string) string {
+	if !r.authorizes(action) {
+		actions := r.Actions
+		if len(actions) == 0 {
+			actions = []string{ActionRead}
 		}
+		return fmt.Sprintf("action %s is not in [%s]", action, strings.Join(actions, " "))
+	}
+	if !matchRef(r.Refs, ref) {
+		return fmt.Sprintf("ref matches none of [%s]", strings.Join(r.Refs, " "))
+	}
+	return ""
+}
+
+// displayPath shows an unknown caller path as such
+func displayPath(p string) string {
+	if p == "" {
+		return "(unknown)"
+	}
+	return p
+}
+
+// String summarizes the rule's conditions, e.g. "path=/usr/bin/app refs=[op://dev/*]"
+func (r Rule) String() string {
+	var parts []string
+	if r.PID != 0 {
+		parts = append(parts, fmt.Sprintf("pid=%d", r.PID))
+	}
+	if r.Path != "" {
+		parts = append(parts, "path="+r.Path)
+	}
+	if r.PathSHA256 != "" {
+		parts = append(parts, "path_sha256="+r.PathSHA256)
+	}
+	if r.ContainerPath != "" {
+		parts = append(parts, "container_path="+r.ContainerPath)
+	}
+	if r.ContainerIDPrefix != "" {
+		parts = append(parts, "container_id_prefix="+r.ContainerIDPrefix)
+	}
+	if r.CertCN != "" {
+		parts = append(parts, "cert_cn="+r.CertCN)
+	}
+	if r.Scheme != "" {
+		parts = append(parts, "scheme="+r.Scheme)
+	}
+	parts = append(parts, "refs=["+strings.Join(r.Refs, " ")+"]")
+	if len(r.Actions) > 0 {
+		parts = append(parts, "actions=["+strings.Join(r.Actions, " ")+"]")
+	}
+	if r.ExpiresAt != nil {
+		parts = append(parts, "expires_at="+r.ExpiresAt.Format(time.RFC3339))
+	}
+	if len(r.Schedule) > 0 {
+		windows := make([]string, len(r.Schedule))
+		for i, w := range r.Schedule {
+			windows[i] = w.String()
+		}
+		parts = append(parts, "schedule=["+strings.Join(windows, "; ")+"]")
+	}
+	if r.RequireApproval {
+		parts = append(parts, "require_approval")
+	}
+	if r.MaxReads > 0 {
+		parts = append(parts, fmt.Sprintf("max_reads=%d per=%s", r.MaxReads, r.Per))
 	}
-	return !pol.DefaultDeny
+	return strings.Join(parts, " ")
 }
 
 func samePath(a, b string) bool {
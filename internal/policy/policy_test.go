@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDefaultPolicy(t *testing.T) {
@@ -188,6 +191,469 @@ func TestAllowed(t *testing.T) {
 	}
 }
 
+func TestAllowed_SchemeScopedRules(t *testing.T) {
+	subject := Subject{PID: 123, Path: "/usr/bin/test"}
+	vaultOnly := Policy{
+		Allow:       []Rule{{Path: "/usr/bin/test", Scheme: "vault", Refs: []string{"*"}}},
+		DefaultDeny: true,
+	}
+	anyScheme := Policy{
+		Allow:       []Rule{{Path: "/usr/bin/test", Refs: []string{"*"}}},
+		DefaultDeny: true,
+	}
+
+	tests := []struct {
+		name     string
+		policy   Policy
+		ref      string
+		expected bool
+	}{
+		{"scheme rule matches its scheme", vaultOnly, "vault://secret/app#password", true},
+		{"scheme match is case-insensitive", vaultOnly, "VAULT://secret/app#password", true},
+		{"wildcard stays within scheme", vaultOnly, "op://vault/item/field", false},
+		{"other backend scheme", vaultOnly, "bao://kv/app#key", false},
+		{"ref without scheme", vaultOnly, "secret/app", false},
+		{"empty scheme spans all schemes", anyScheme, "op://vault/item/field", true},
+		{"empty scheme spans vault too", anyScheme, "vault://secret/app", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := Allowed(test.policy, subject, test.ref)
+			if result != test.expected {
+				t.Errorf("Expected %t, got %t", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestAllowed_ContainerRules(t *testing.T) {
+	const id = "4f1c6a7be4a95dd0c4bd20f4f4b0c63c2f0a5b3a8f2e1d9c7b6a5f4e3d2c1b0a"
+	pol := Policy{
+		Allow: []Rule{
+			{ContainerPath: "/usr/local/bin/app", ContainerIDPrefix: "4F1C6A", Refs: []string{"op://dev/*"}},
+			{ContainerIDPrefix: "9999", Refs: []string{"*"}},
+		},
+		DefaultDeny: true,
+	}
+
+	tests := []struct {
+		name     string
+		subject  Subject
+		ref      string
+		expected bool
+	}{
+		{"container path and id prefix", Subject{PID: 7, ContainerPath: "/usr/local/bin/app", ContainerID: id}, "op://dev/db/password", true},
+		{"ref outside the rule", Subject{PID: 7, ContainerPath: "/usr/local/bin/app", ContainerID: id}, "op://prod/db/password", false},
+		{"other binary in the container", Subject{PID: 7, ContainerPath: "/bin/sh", ContainerID: id}, "op://dev/db/password", false},
+		{"same binary in another container", Subject{PID: 7, ContainerPath: "/usr/local/bin/app", ContainerID: "9999" + id[4:]}, "op://prod/db/password", true},
+		{"host binary at the container path", Subject{PID: 7, Path: "/usr/local/bin/app"}, "op://dev/db/password", false},
+		{"container without an id", Subject{PID: 7, ContainerPath: "/usr/local/bin/app"}, "op://dev/db/password", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Allowed(pol, test.subject, test.ref); got != test.expected {
+				t.Errorf("Expected %t, got %t", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestAllowed_CertRules(t *testing.T) {
+	pol := Policy{
+		Allow: []Rule{
+			{CertCN: "wsl-dev", Refs: []string{"op://dev/*"}},
+			{Refs: []string{"op://shared/*"}},
+		},
+		DefaultDeny: true,
+	}
+
+	tests := []struct {
+		name     string
+		subject  Subject
+		ref      string
+		expected bool
+	}{
+		{"matching common name", Subject{CertCN: "wsl-dev"}, "op://dev/db/password", true},
+		{"ref outside the rule", Subject{CertCN: "wsl-dev"}, "op://prod/db/password", false},
+		{"other common name", Subject{CertCN: "vm-ci"}, "op://dev/db/password", false},
+		{"rule without cert_cn", Subject{CertCN: "wsl-dev"}, "op://shared/api/key", false},
+		{"socket caller", Subject{PID: 7, Path: "/usr/bin/app"}, "op://dev/db/password", false},
+		{"socket caller under a rule without cert_cn", Subject{PID: 7, Path: "/usr/bin/app"}, "op://shared/api/key", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Allowed(pol, test.subject, test.ref); got != test.expected {
+				t.Errorf("Expected %t, got %t", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestAllowedAction_Create(t *testing.T) {
+	subject := Subject{PID: 123, Path: "/usr/bin/provisioner"}
+	pol := Policy{
+		Allow: []Rule{
+			{Path: "/usr/bin/provisioner", Refs: []string{"op://dev/*"}, Actions: []string{"read", "create"}},
+			{Path: "/usr/bin/provisioner", Refs: []string{"op://prod/*"}},
+		},
+		DefaultDeny: true,
+	}
+
+	tests := []struct {
+		name     string
+		ref      string
+		action   string
+		expected bool
+	}{
+		{"create allowed by listed action", "op://dev/MyApp", ActionCreate, true},
+		{"read still allowed", "op://dev/MyApp/password", ActionRead, true},
+		{"rule without actions is read only", "op://prod/MyApp", ActionCreate, false},
+		{"read allowed by rule without actions", "op://prod/MyApp/password", ActionRead, true},
+		{"create outside refs", "op://other/MyApp", ActionCreate, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := AllowedAction(pol, subject, test.ref, test.action); result != test.expected {
+				t.Errorf("Expected %t, got %t", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestAllowedAction_ReadOnlyRuleDeniesWrite(t *testing.T) {
+	subject := Subject{PID: 123, Path: "/usr/bin/app"}
+	ref := "op://prod/db/password"
+
+	tests := []struct {
+		name    string
+		actions []string
+		read    bool
+		write   bool
+	}{
+		{name: "no actions means read only", actions: nil, read: true, write: false},
+		{name: "explicit read", actions: []string{"read"}, read: true, write: false},
+		{name: "write only", actions: []string{"write"}, read: false, write: true},
+		{name: "read and write", actions: []string{"read", "WRITE"}, read: true, write: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := Policy{Allow: []Rule{{Path: subject.Path, Refs: []string{ref}, Actions: tt.actions}}, DefaultDeny: true}
+			if got := AllowedAction(pol, subject, ref, ActionRead); got != tt.read {
+				t.Errorf("Expected read %t, got %t", tt.read, got)
+			}
+			if got := AllowedAction(pol, subject, ref, ActionWrite); got != tt.write {
+				t.Errorf("Expected write %t, got %t", tt.write, got)
+			}
+		})
+	}
+}
+
+func TestDecide_DenyMessage(t *testing.T) {
+	pol := Policy{
+		Allow: []Rule{
+			{Path: "/usr/bin/deploy", Refs: []string{"op://dev/*"}, Message: "contact security to request op://prod/* access"},
+			{Path: "/usr/bin/deploy", Refs: []string{"op://staging/*"}, Message: "second rule's message"},
+			{Path: "/usr/bin/other", Refs: []string{"op://dev/*"}, Message: "not for deploy"},
+		},
+		DefaultDeny: true,
+		DenyMessage: "ask #platform for access",
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		ref      string
+		allowed  bool
+		expected string
+	}{
+		{name: "allowed has no message", path: "/usr/bin/deploy", ref: "op://dev/db/password", allowed: true},
+		{name: "first applicable rule's message", path: "/usr/bin/deploy", ref: "op://prod/db/password", expected: "contact security to request op://prod/* access"},
+		{name: "no applicable rule falls back to the policy", path: "/usr/bin/unknown", ref: "op://prod/db/password", expected: "ask #platform for access"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Decide(pol, Subject{PID: 1, Path: tt.path}, tt.ref, ActionRead)
+			if d.Allowed != tt.allowed {
+				t.Errorf("Expected allowed %t, got %t", tt.allowed, d.Allowed)
+			}
+			if d.Message != tt.expected {
+				t.Errorf("Expected message %q, got %q", tt.expected, d.Message)
+			}
+		})
+	}
+}
+
+func TestExplain(t *testing.T) {
+	pol := Policy{
+		Allow: []Rule{
+			{PID: 42, Refs: []string{"*"}},
+			{Path: "/usr/bin/deploy", Scheme: "vault", Refs: []string{"*"}},
+			{Path: "/usr/bin/deploy", Refs: []string{"op://dev/*"}, Message: "ask for prod"},
+			{Path: "/usr/bin/deploy", Refs: []string{"op://prod/*"}, Actions: []string{ActionWrite}},
+			{Path: "/usr/bin/deploy", Refs: []string{"op://prod/*"}},
+		},
+		DefaultDeny: true,
+	}
+
+	tests := []struct {
+		name    string
+		pol     Policy
+		path    string
+		ref     string
+		action  string
+		allowed bool
+		matched int
+		reasons []string
+		reason  string
+	}{
+		{
+			name:    "stops at the first matching rule",
+			pol:     pol,
+			path:    "/usr/bin/deploy",
+			ref:     "op://prod/db/password",
+			action:  ActionRead,
+			allowed: true,
+			matched: 5,
+			reasons: []string{
+				"pid 1 is not 42",
+				`scheme "op" is not "vault"`,
+				"ref matches none of [op://dev/*]",
+				"action read is not in [write]",
+				"matches",
+			},
+			reason: "allowed by rule 5",
+		},
+		{
+			name:   "default deny",
+			pol:    pol,
+			path:   "/usr/bin/other",
+			ref:    "op://dev/db/password",
+			action: ActionWrite,
+			reasons: []string{
+				"pid 1 is not 42",
+				"path /usr/bin/other is not /usr/bin/deploy",
+				"path /usr/bin/other is not /usr/bin/deploy",
+				"path /usr/bin/other is not /usr/bin/deploy",
+				"path /usr/bin/other is not /usr/bin/deploy",
+			},
+			reason: "no rule matched and the policy has default_deny",
+		},
+		{
+			name:    "permissive fallthrough",
+			pol:     Policy{Allow: []Rule{{Path: "/usr/bin/deploy", Refs: []string{"*"}}}},
+			path:    "",
+			ref:     "op://dev/db/password",
+			action:  ActionRead,
+			allowed: true,
+			reasons: []string{"path (unknown) is not /usr/bin/deploy"},
+			reason:  "no rule matched and the policy allows by default",
+		},
+		{
+			name:    "empty policy",
+			ref:     "op://dev/db/password",
+			action:  ActionRead,
+			allowed: true,
+			reason:  "the policy has no rules and allows by default",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := Explain(tt.pol, Subject{PID: 1, Path: tt.path}, tt.ref, tt.action)
+			if e.Allowed != tt.allowed {
+				t.Errorf("Expected allowed %t, got %t", tt.allowed, e.Allowed)
+			}
+			if e.MatchedRule() != tt.matched {
+				t.Errorf("Expected matched rule %d, got %d", tt.matched, e.MatchedRule())
+			}
+			var reasons []string
+			for _, r := range e.Rules {
+				reasons = append(reasons, r.Reason)
+			}
+			if !reflect.DeepEqual(reasons, tt.reasons) {
+				t.Errorf("Expected reasons %q, got %q", tt.reasons, reasons)
+			}
+			if e.Reason != tt.reason {
+				t.Errorf("Expected reason %q, got %q", tt.reason, e.Reason)
+			}
+			if d := Decide(tt.pol, Subject{PID: 1, Path: tt.path}, tt.ref, tt.action); d != e.Decision {
+				t.Errorf("Expected Decide to agree with Explain, got %+v and %+v", d, e.Decision)
+			}
+		})
+	}
+}
+
+func TestAllowed_ExpiredRule(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	subj := Subject{PID: 1, Path: "/usr/bin/deploy"}
+
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		expected  bool
+	}{
+		{name: "no expiry", expected: true},
+		{name: "not yet expired", expiresAt: &future, expected: true},
+		{name: "expired", expiresAt: &past, expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := Policy{Allow: []Rule{{Path: "/usr/bin/deploy", Refs: []string{"op://prod/*"}, ExpiresAt: tt.expiresAt}}, DefaultDeny: true}
+			if got := Allowed(pol, subj, "op://prod/db/password"); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	pol := Policy{Allow: []Rule{{Path: "/usr/bin/deploy", Refs: []string{"*"}, ExpiresAt: &past}}, DefaultDeny: true}
+	if e := Explain(pol, subj, "op://prod/db/password", ActionRead); len(e.Rules) != 1 || e.Rules[0].Reason != "expired at "+past.Format(time.RFC3339) {
+		t.Errorf("Expected the expiry as the mismatch reason, got %+v", e.Rules)
+	}
+}
+
+func TestExplain_RequireApproval(t *testing.T) {
+	subj := Subject{PID: 1, Path: "/usr/bin/deploy"}
+	pol := Policy{
+		Allow: []Rule{
+			{Path: "/usr/bin/deploy", Refs: []string{"op://breakglass/*"}, RequireApproval: true},
+			{Path: "/usr/bin/deploy", Refs: []string{"*"}},
+		},
+		DefaultDeny: true,
+	}
+
+	e := Explain(pol, subj, "op://breakglass/root/password", ActionRead)
+	if !e.Allowed || !e.RequireApproval || e.Reason != "allowed by rule 1 once approved" {
+		t.Errorf("Expected rule 1 to allow once approved, got %+v", e)
+	}
+	if !strings.HasSuffix(pol.Allow[0].String(), " require_approval") {
+		t.Errorf("Expected require_approval in the rule summary, got %q", pol.Allow[0].String())
+	}
+
+	// The first matching rule decides, so other refs need no approval
+	if d := Decide(pol, subj, "op://dev/api/key", ActionRead); !d.Allowed || d.RequireApproval {
+		t.Errorf("Expected rule 2 to allow without approval, got %+v", d)
+	}
+}
+
+func TestPruneExpired(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	past, future := now.Add(-time.Second), now.Add(time.Hour)
+	path := filepath.Join(t.TempDir(), "policy.json")
+	pol := Policy{
+		Allow: []Rule{
+			{Path: "/usr/bin/app", Refs: []string{"op://dev/*"}},
+			{Path: "/usr/bin/deploy", Refs: []string{"op://prod/*"}, ExpiresAt: &past},
+			{Path: "/usr/bin/oncall", Refs: []string{"op://prod/*"}, ExpiresAt: &future},
+		},
+		DefaultDeny: true,
+	}
+	if _, err := Save(path, pol); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if !pol.HasExpiring() {
+		t.Error("Expected HasExpiring with expiring rules")
+	}
+
+	removed, err := PruneExpired(path, now)
+	if err != nil {
+		t.Fatalf("PruneExpired failed: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("Expected 1 rule removed, got %d", removed)
+	}
+	pruned, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	var paths []string
+	for _, r := range pruned.Allow {
+		paths = append(paths, r.Path)
+	}
+	if expected := []string{"/usr/bin/app", "/usr/bin/oncall"}; !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected rules %v to remain, got %v", expected, paths)
+	}
+	if !pruned.Allow[1].ExpiresAt.Equal(future) {
+		t.Errorf("Expected the unexpired grant to keep its expiry, got %v", pruned.Allow[1].ExpiresAt)
+	}
+	if backup, err := LoadFile(path + ".bak"); err != nil || len(backup.Allow) != 3 {
+		t.Errorf("Expected the previous policy in the backup, got %d rules (%v)", len(backup.Allow), err)
+	}
+
+	// Nothing left to prune leaves the file alone
+	before, _ := os.Stat(path)
+	if removed, err := PruneExpired(path, now); err != nil || removed != 0 {
+		t.Errorf("Expected nothing pruned, got %d (%v)", removed, err)
+	}
+	if after, _ := os.Stat(path); !after.ModTime().Equal(before.ModTime()) {
+		t.Error("Expected the policy file not to be rewritten")
+	}
+}
+
+func TestRule_String(t *testing.T) {
+	r := Rule{Path: "/usr/bin/app", Scheme: "op", Refs: []string{"op://dev/*", "op://ci/*"}, Actions: []string{ActionRead, ActionWrite}}
+	expected := "path=/usr/bin/app scheme=op refs=[op://dev/* op://ci/*] actions=[read write]"
+	if got := r.String(); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	r = Rule{ContainerPath: "/usr/local/bin/app", ContainerIDPrefix: "4f1c", Refs: []string{"*"}}
+	expected = "container_path=/usr/local/bin/app container_id_prefix=4f1c refs=[*]"
+	if got := r.String(); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestLoadFile_RejectsUnknownAction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	data := `{"allow":[{"path":"/usr/bin/app","refs":["*"],"actions":["read","delete"]}],"default_deny":true}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadFile(path); err == nil {
+		t.Error("Expected error for unknown action")
+	}
+}
+
+func TestLoadFile_BOMAndTrailingContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{name: "bom", data: "\xEF\xBB\xBF{\"allow\":[{\"path\":\"/usr/bin/app\",\"refs\":[\"*\"]}],\"default_deny\":true}\n"},
+		{name: "trailing garbage", data: "{\"default_deny\":true}\n}\n", wantErr: "line 2, column 1: unexpected content after the JSON value"},
+		{name: "invalid character", data: "{\n  \"default_deny\": true,\n}\n", wantErr: "line 3, column 1: invalid character"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.json")
+			if err := os.WriteFile(path, []byte(tt.data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			pol, err := LoadFile(path)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if !pol.DefaultDeny || len(pol.Allow) != 1 {
+					t.Errorf("Expected the BOM-prefixed policy to load, got %+v", pol)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error starting with %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
 func TestLoadPolicy(t *testing.T) {
 	// Test loading default policy when file doesn't exist
 	tempDir := t.TempDir()
@@ -306,3 +772,118 @@ func TestLoadPolicy_InvalidJSON(t *testing.T) {
 		t.Error("Expected error loading invalid JSON policy")
 	}
 }
+
+func TestSaveAndRestoreBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+
+	first := Policy{Allow: []Rule{{Path: "/usr/bin/a", Refs: []string{"*"}}}, DefaultDeny: true}
+	backup, err := Save(path, first)
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if backup != "" {
+		t.Errorf("Expected no backup for a new file, got %q", backup)
+	}
+
+	second := first
+	second.Allow = append(second.Allow, Rule{Path: "/usr/bin/b", Refs: []string{"op://x/*"}})
+	backup, err = Save(path, second)
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if backup != path+".bak" {
+		t.Errorf("Expected backup at %s.bak, got %q", path, backup)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected policy file with 0600 permissions, got %v (%v)", info, err)
+	}
+
+	if err := RestoreBackup(path, backup); err != nil {
+		t.Fatalf("RestoreBackup failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	var restored Policy
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatalf("Restored policy does not parse: %v", err)
+	}
+	if len(restored.Allow) != 1 || restored.Allow[0].Path != "/usr/bin/a" {
+		t.Errorf("Expected first policy to be restored, got %+v", restored)
+	}
+
+	// Undoing the very first save removes the file again
+	if err := RestoreBackup(path, ""); err != nil {
+		t.Fatalf("RestoreBackup failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected policy file to be removed")
+	}
+}
+
+func TestAdmin_Allows(t *testing.T) {
+	admin := Admin{Paths: []string{"/usr/local/bin/opx"}, UIDs: []uint32{0}}
+	tests := []struct {
+		path     string
+		uid      uint32
+		expected bool
+	}{
+		{path: "/usr/local/bin/opx", uid: 1000, expected: true},
+		{path: "/usr/bin/tool", uid: 0, expected: true},
+		{path: "/usr/bin/tool", uid: 1000, expected: false},
+		{path: "", uid: 1000, expected: false},
+	}
+	for _, tt := range tests {
+		if got := admin.Allows(tt.path, tt.uid); got != tt.expected {
+			t.Errorf("%s (uid %d): expected %t, got %t", tt.path, tt.uid, tt.expected, got)
+		}
+	}
+}
+
+func TestLoadFile_RejectsRelativeAdminPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	data := `{"allow":[],"default_deny":true,"admin":{"paths":["bin/opx"]}}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadFile(path); err == nil {
+		t.Error("Expected error for relative admin path")
+	}
+}
+
+func TestLoadFile_RejectsCertRuleWithPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	data := `{"allow":[{"cert_cn":"wsl-dev","path":"/usr/bin/app","refs":["*"]}],"default_deny":true}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadFile(path); err == nil {
+		t.Error("Expected error for a rule with cert_cn and path")
+	}
+}
+
+func TestRequiresPeerInfo(t *testing.T) {
+	on, off := true, false
+	rules := []Rule{{Path: "/usr/bin/app", Refs: []string{"*"}}}
+	tests := []struct {
+		name     string
+		policy   Policy
+		setting  *bool
+		requires bool
+		failOpen bool
+	}{
+		{name: "empty policy", policy: Policy{}, requires: false, failOpen: false},
+		{name: "permissive rules", policy: Policy{Allow: rules}, requires: false, failOpen: true},
+		{name: "default deny", policy: Policy{Allow: rules, DefaultDeny: true}, requires: true, failOpen: false},
+		{name: "default deny, explicitly off", policy: Policy{DefaultDeny: true}, setting: &off, requires: false, failOpen: true},
+		{name: "permissive, explicitly on", policy: Policy{Allow: rules}, setting: &on, requires: true, failOpen: false},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.RequiresPeerInfo(tt.setting); got != tt.requires {
+			t.Errorf("%s: expected RequiresPeerInfo %t, got %t", tt.name, tt.requires, got)
+		}
+		if got := tt.policy.FailsOpen(tt.setting); got != tt.failOpen {
+			t.Errorf("%s: expected FailsOpen %t, got %t", tt.name, tt.failOpen, got)
+		}
+	}
+}
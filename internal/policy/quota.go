@@ -0,0 +1,55 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Quota is the read limit of the rule that allowed a request, for the daemon to enforce
+type Quota struct {
+	Rule     int    // 1-based position in the allow list
+	Hash     string // Rule.Hash, so counters outlive reloads that keep the rule
+	MaxReads int
+	Per      time.Duration
+}
+
+// String shows the limit as e.g. "10 reads per 1h0m0s"
+func (q Quota) String() string {
+	return fmt.Sprintf("%d reads per %s", q.MaxReads, q.Per)
+}
+
+// quota returns the rule's read limit at position index, or nil if it has none
+func (r Rule) quota(index int) *Quota {
+	if r.MaxReads <= 0 {
+		return nil
+	}
+	per, err := time.ParseDuration(r.Per)
+	if err != nil || per <= 0 {
+		return nil // LoadFile rejects these; a rule built in code with one has no quota
+	}
+	return &Quota{Rule: index, Hash: r.Hash(), MaxReads: r.MaxReads, Per: per}
+}
+
+// Hash identifies the rule by its content, independent of its position
+func (r Rule) Hash() string {
+	b, _ := json.Marshal(r)
+	return sha256Hex(string(b))
+}
+
+// validateQuotas rejects a negative max_reads, or one without a positive per duration
+func (p Policy) validateQuotas() error {
+	for i, r := range p.Allow {
+		switch {
+		case r.MaxReads < 0:
+			return fmt.Errorf("rule %d: max_reads cannot be negative", i)
+		case r.MaxReads == 0 && r.Per != "":
+			return fmt.Errorf("rule %d: per needs max_reads", i)
+		case r.MaxReads > 0:
+			if per, err := time.ParseDuration(r.Per); err != nil || per <= 0 {
+				return fmt.Errorf("rule %d: max_reads needs per set to a positive duration such as 1h, got %q", i, r.Per)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExplainAt_Quota(t *testing.T) {
+	limited := Rule{Path: "/usr/bin/app", Refs: []string{"op://prod/*"}, MaxReads: 10, Per: "1h"}
+	pol := Policy{
+		Allow: []Rule{
+			{Path: "/usr/bin/app", Refs: []string{"op://dev/*"}},
+			limited,
+		},
+		DefaultDeny: true,
+	}
+	subj := Subject{PID: 1, Path: "/usr/bin/app"}
+	now := mustTime(t, "2026-10-16T12:00:00Z")
+
+	d := DecideAt(pol, subj, "op://prod/db/password", ActionRead, now)
+	if !d.Allowed || d.Quota == nil {
+		t.Fatalf("Expected an allow carrying the rule's quota, got %+v", d)
+	}
+	if d.Quota.Rule != 2 || d.Quota.MaxReads != 10 || d.Quota.Per != time.Hour || d.Quota.Hash != limited.Hash() {
+		t.Errorf("Expected rule 2's quota of 10 per 1h, got %+v", d.Quota)
+	}
+	if d := DecideAt(pol, subj, "op://dev/api/key", ActionRead, now); !d.Allowed || d.Quota != nil {
+		t.Errorf("Expected no quota from an unlimited rule, got %+v", d)
+	}
+	if s := limited.String(); !strings.Contains(s, "max_reads=10 per=1h") {
+		t.Errorf("Expected the rule string to show the quota, got %q", s)
+	}
+}
+
+func TestRule_Hash(t *testing.T) {
+	r := Rule{Path: "/usr/bin/app", Refs: []string{"op://prod/*"}, MaxReads: 10, Per: "1h"}
+	same := Rule{Path: "/usr/bin/app", Refs: []string{"op://prod/*"}, MaxReads: 10, Per: "1h"}
+	if r.Hash() != same.Hash() {
+		t.Error("Expected identical rules to hash the same")
+	}
+	changed := same
+	changed.MaxReads = 20
+	if r.Hash() == changed.Hash() {
+		t.Error("Expected a changed rule to hash differently")
+	}
+}
+
+func TestLoadFile_RejectsBadQuota(t *testing.T) {
+	tests := []struct {
+		name     string
+		quota    string
+		contains string
+	}{
+		{name: "negative", quota: `"max_reads":-1`, contains: "cannot be negative"},
+		{name: "no per", quota: `"max_reads":10`, contains: "needs per"},
+		{name: "bad per", quota: `"max_reads":10,"per":"hourly"`, contains: "positive duration"},
+		{name: "zero per", quota: `"max_reads":10,"per":"0s"`, contains: "positive duration"},
+		{name: "per alone", quota: `"per":"1h"`, contains: "per needs max_reads"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.json")
+			data := `{"allow":[{"path":"/usr/bin/app","refs":["*"],` + tt.quota + `}],"default_deny":true}`
+			if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+				t.Fatalf("WriteFile failed: %v", err)
+			}
+			if _, err := LoadFile(path); err == nil || !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("Expected error containing %q, got %v", tt.contains, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Window is a recurring span of the day during which a scheduled rule applies.
+// An End at or before Start runs past midnight into the next day.
+type Window struct {
+	Days  []string `json:"days,omitempty"` // Mon..Sun the window starts on; empty means every day
+	Start string   `json:"start"`          // HH:MM, inclusive
+	End   string   `json:"end"`            // HH:MM, exclusive
+	TZ    string   `json:"tz,omitempty"`   // IANA time zone; empty means the daemon's local time
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// locations caches loaded time zones, since rules are evaluated on every read
+var locations sync.Map
+
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// parseClock turns HH:MM into minutes after midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("time %q is not HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// window is a Window with its fields parsed
+type window struct {
+	days       map[time.Weekday]bool // nil means every day
+	start, end int
+	loc        *time.Location
+}
+
+func (w Window) parse() (window, error) {
+	var p window
+	var err error
+	if p.start, err = parseClock(w.Start); err != nil {
+		return p, err
+	}
+	if p.end, err = parseClock(w.End); err != nil {
+		return p, err
+	}
+	if p.start == p.end {
+		return p, fmt.Errorf("window %s-%s is empty", w.Start, w.End)
+	}
+	if p.loc, err = loadLocation(w.TZ); err != nil {
+		return p, fmt.Errorf("unknown time zone %q", w.TZ)
+	}
+	for _, d := range w.Days {
+		wd, ok := weekdays[strings.ToLower(d)]
+		if !ok {
+			return p, fmt.Errorf("unknown day %q (want Mon..Sun)", d)
+		}
+		if p.days == nil {
+			p.days = make(map[time.Weekday]bool)
+		}
+		p.days[wd] = true
+	}
+	return p, nil
+}
+
+func (p window) onDay(d time.Weekday) bool {
+	return p.days == nil || p.days[d]
+}
+
+// contains reports whether now falls in the window, going by the wall clock in its time zone
+func (p window) contains(now time.Time) bool {
+	t := now.In(p.loc)
+	m := t.Hour()*60 + t.Minute()
+	if p.start < p.end {
+		return p.onDay(t.Weekday()) && m >= p.start && m < p.end
+	}
+	// Past midnight: the early hours belong to the window that started the day before
+	return (m >= p.start && p.onDay(t.Weekday())) || (m < p.end && p.onDay((t.Weekday()+6)%7))
+}
+
+// nextStart is when the window next opens after now. A start skipped by a DST
+// change opens the window when the clocks jump past it.
+func (p window) nextStart(now time.Time) time.Time {
+	t := now.In(p.loc)
+	for i := 0; i <= 7; i++ {
+		day := time.Date(t.Year(), t.Month(), t.Day()+i, 0, 0, 0, 0, p.loc)
+		if !p.onDay(day.Weekday()) {
+			continue
+		}
+		start := time.Date(day.Year(), day.Month(), day.Day(), p.start/60, p.start%60, 0, 0, p.loc)
+		if start.Hour()*60+start.Minute() != p.start {
+			// time.Date normalized a wall time that doesn't exist that day
+			if _, jump := start.ZoneBounds(); !jump.IsZero() && jump.After(start) {
+				start = jump
+			}
+		}
+		if start.After(now) {
+			return start
+		}
+	}
+	return time.Time{}
+}
+
+// validateSchedules rejects windows with bad days, times or time zones
+func (p Policy) validateSchedules() error {
+	for i, r := range p.Allow {
+		for _, w := range r.Schedule {
+			if _, err := w.parse(); err != nil {
+				return fmt.Errorf("rule %d: schedule: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// scheduleMismatch says why a scheduled rule doesn't apply at now, naming when
+// its next window opens, or "" if it does
+func (r Rule) scheduleMismatch(now time.Time) string {
+	if len(r.Schedule) == 0 {
+		return ""
+	}
+	var next time.Time
+	for _, w := range r.Schedule {
+		p, err := w.parse()
+		if err != nil {
+			continue // LoadFile rejects these; a rule built in code with one never applies
+		}
+		if p.contains(now) {
+			return ""
+		}
+		if n := p.nextStart(now); !n.IsZero() && (next.IsZero() || n.Before(next)) {
+			next = n
+		}
+	}
+	if next.IsZero() {
+		return "outside allowed window"
+	}
+	return "outside allowed window, next window starts at " + next.Format(time.RFC3339)
+}
+
+// String shows the window as e.g. "Mon,Tue 09:00-18:00 America/New_York"
+func (w Window) String() string {
+	days := "daily"
+	if len(w.Days) > 0 {
+		days = strings.Join(w.Days, ",")
+	}
+	s := days + " " + w.Start + "-" + w.End
+	if w.TZ != "" {
+		s += " " + w.TZ
+	}
+	return s
+}
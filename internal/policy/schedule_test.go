@@ -0,0 +1,158 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustTime(t *testing.T, s string) time.Time {
+	t.Helper()
+	ts, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatalf("bad time %q: %v", s, err)
+	}
+	return ts
+}
+
+func TestWindow_Contains(t *testing.T) {
+	tests := []struct {
+		name     string
+		window   Window
+		now      string
+		expected bool
+	}{
+		// Business hours in New York
+		{name: "inside", window: Window{Days: []string{"Mon", "Tue"}, Start: "09:00", End: "18:00", TZ: "America/New_York"}, now: "2026-10-19T13:00:00Z", expected: true},
+		{name: "start is inclusive", window: Window{Start: "09:00", End: "18:00", TZ: "America/New_York"}, now: "2026-10-19T13:00:00Z", expected: true},
+		{name: "end is exclusive", window: Window{Start: "09:00", End: "18:00", TZ: "America/New_York"}, now: "2026-10-19T22:00:00Z", expected: false},
+		{name: "wrong day", window: Window{Days: []string{"Mon", "Tue"}, Start: "09:00", End: "18:00", TZ: "America/New_York"}, now: "2026-10-21T14:00:00Z", expected: false},
+
+		// Timezone boundaries: the day and hour are the window's, not UTC's
+		{name: "monday in los angeles is tuesday in utc", window: Window{Days: []string{"Mon"}, Start: "17:00", End: "23:00", TZ: "America/Los_Angeles"}, now: "2026-10-20T02:00:00Z", expected: true},
+		{name: "monday in utc is tuesday in tokyo", window: Window{Days: []string{"Mon"}, Start: "09:00", End: "17:00", TZ: "Asia/Tokyo"}, now: "2026-10-19T23:30:00Z", expected: false},
+		{name: "day names are case-insensitive", window: Window{Days: []string{"mon"}, Start: "00:00", End: "23:59", TZ: "UTC"}, now: "2026-10-19T12:00:00Z", expected: true},
+
+		// Overnight window starting on Friday
+		{name: "overnight before midnight", window: Window{Days: []string{"Fri"}, Start: "22:00", End: "06:00", TZ: "UTC"}, now: "2026-10-16T23:00:00Z", expected: true},
+		{name: "overnight after midnight", window: Window{Days: []string{"Fri"}, Start: "22:00", End: "06:00", TZ: "UTC"}, now: "2026-10-17T05:59:00Z", expected: true},
+		{name: "overnight end", window: Window{Days: []string{"Fri"}, Start: "22:00", End: "06:00", TZ: "UTC"}, now: "2026-10-17T06:00:00Z", expected: false},
+		{name: "overnight unlisted start day", window: Window{Days: []string{"Fri"}, Start: "22:00", End: "06:00", TZ: "UTC"}, now: "2026-10-17T23:00:00Z", expected: false},
+		{name: "overnight early hours of listed day", window: Window{Days: []string{"Fri"}, Start: "22:00", End: "06:00", TZ: "UTC"}, now: "2026-10-16T05:00:00Z", expected: false},
+
+		// DST: windows follow the wall clock
+		{name: "after spring forward", window: Window{Start: "09:00", End: "18:00", TZ: "America/New_York"}, now: "2026-03-08T13:30:00Z", expected: true},
+		{name: "before spring forward", window: Window{Start: "09:00", End: "18:00", TZ: "America/New_York"}, now: "2026-03-07T13:30:00Z", expected: false},
+		{name: "fall back first 01:30", window: Window{Start: "01:00", End: "02:00", TZ: "America/New_York"}, now: "2026-11-01T05:30:00Z", expected: true},
+		{name: "fall back second 01:30", window: Window{Start: "01:00", End: "02:00", TZ: "America/New_York"}, now: "2026-11-01T06:30:00Z", expected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := tt.window.parse()
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			if got := p.contains(mustTime(t, tt.now)); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestWindow_NextStart(t *testing.T) {
+	tests := []struct {
+		name     string
+		window   Window
+		now      string
+		expected string
+	}{
+		{name: "later today", window: Window{Start: "09:00", End: "18:00", TZ: "UTC"}, now: "2026-10-19T08:00:00Z", expected: "2026-10-19T09:00:00Z"},
+		{name: "skips unlisted days", window: Window{Days: []string{"Mon"}, Start: "09:00", End: "18:00", TZ: "UTC"}, now: "2026-10-16T12:00:00Z", expected: "2026-10-19T09:00:00Z"},
+		{name: "a week away", window: Window{Days: []string{"Mon"}, Start: "09:00", End: "18:00", TZ: "UTC"}, now: "2026-10-19T09:30:00Z", expected: "2026-10-26T09:00:00Z"},
+		{name: "across spring forward", window: Window{Start: "09:00", End: "18:00", TZ: "America/New_York"}, now: "2026-03-08T01:00:00Z", expected: "2026-03-08T13:00:00Z"},
+		{name: "start skipped by spring forward", window: Window{Start: "02:30", End: "04:00", TZ: "America/New_York"}, now: "2026-03-08T06:00:00Z", expected: "2026-03-08T07:00:00Z"},
+		{name: "across fall back", window: Window{Start: "09:00", End: "18:00", TZ: "America/New_York"}, now: "2026-11-01T00:00:00Z", expected: "2026-11-01T14:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := tt.window.parse()
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			if got := p.nextStart(mustTime(t, tt.now)); !got.Equal(mustTime(t, tt.expected)) {
+				t.Errorf("Expected %s, got %s", tt.expected, got.UTC().Format(time.RFC3339))
+			}
+		})
+	}
+}
+
+func TestExplainAt_Schedule(t *testing.T) {
+	subj := Subject{PID: 1, Path: "/usr/bin/deploy"}
+	pol := Policy{
+		Allow: []Rule{
+			{Path: "/usr/bin/deploy", Refs: []string{"op://prod/*"}, Schedule: []Window{
+				{Days: []string{"Mon", "Tue", "Wed", "Thu", "Fri"}, Start: "09:00", End: "18:00", TZ: "America/New_York"},
+				{Days: []string{"Sat"}, Start: "22:00", End: "02:00", TZ: "UTC"},
+			}},
+			{Path: "/usr/bin/deploy", Refs: []string{"op://dev/*"}},
+		},
+		DefaultDeny: true,
+		DenyMessage: "ask security",
+	}
+
+	e := ExplainAt(pol, subj, "op://prod/db/password", ActionRead, mustTime(t, "2026-10-19T14:00:00Z"))
+	if !e.Allowed || e.MatchedRule() != 1 || e.OutsideWindow {
+		t.Errorf("Expected rule 1 to allow inside its window, got %+v", e)
+	}
+
+	// Friday evening in New York: the Saturday window in UTC opens first
+	e = ExplainAt(pol, subj, "op://prod/db/password", ActionRead, mustTime(t, "2026-10-17T00:00:00Z"))
+	expected := "outside allowed window, next window starts at 2026-10-17T22:00:00Z"
+	if e.Allowed || !e.OutsideWindow {
+		t.Fatalf("Expected a schedule denial, got %+v", e)
+	}
+	if e.Message != expected || e.Reason != "rule 1 is "+expected || e.Rules[0].Reason != expected {
+		t.Errorf("Expected %q as the reason, got message %q, reason %q, trace %q", expected, e.Message, e.Reason, e.Rules[0].Reason)
+	}
+	if !strings.Contains(pol.Allow[0].String(), "schedule=[Mon,Tue,Wed,Thu,Fri 09:00-18:00 America/New_York; Sat 22:00-02:00 UTC]") {
+		t.Errorf("Expected the schedule in the rule summary, got %q", pol.Allow[0].String())
+	}
+
+	// Refs the scheduled rule doesn't cover are denied as usual
+	e = ExplainAt(pol, subj, "op://other/x/y", ActionRead, mustTime(t, "2026-10-17T00:00:00Z"))
+	if e.Allowed || e.OutsideWindow || e.Message != "ask security" {
+		t.Errorf("Expected an ordinary denial, got %+v", e)
+	}
+
+	// Unscheduled rules apply at any time
+	if d := DecideAt(pol, subj, "op://dev/api/key", ActionRead, mustTime(t, "2026-10-17T00:00:00Z")); !d.Allowed {
+		t.Error("Expected the unscheduled rule to allow")
+	}
+}
+
+func TestLoadFile_RejectsBadSchedule(t *testing.T) {
+	tests := []struct {
+		name     string
+		window   string
+		contains string
+	}{
+		{name: "time zone", window: `{"start":"09:00","end":"18:00","tz":"Mars/Olympus"}`, contains: "unknown time zone"},
+		{name: "day", window: `{"days":["Someday"],"start":"09:00","end":"18:00"}`, contains: "unknown day"},
+		{name: "time", window: `{"start":"9am","end":"18:00"}`, contains: "not HH:MM"},
+		{name: "empty", window: `{"start":"09:00","end":"09:00"}`, contains: "is empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.json")
+			data := `{"allow":[{"path":"/usr/bin/app","refs":["*"],"schedule":[` + tt.window + `]}],"default_deny":true}`
+			if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+				t.Fatalf("WriteFile failed: %v", err)
+			}
+			if _, err := LoadFile(path); err == nil || !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("Expected error containing %q, got %v", tt.contains, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+// Package preflight validates opx-authd configuration the way startup loads it,
+// without binding the socket, for `opx-authd -check-config` and `opx doctor`
+package preflight
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zach-source/opx/internal/backend"
+	"github.com/zach-source/opx/internal/config"
+	"github.com/zach-source/opx/internal/policy"
+	"github.com/zach-source/opx/internal/session"
+	"github.com/zach-source/opx/internal/util"
+)
+
+// DefaultTimeout bounds each backend health check
+const DefaultTimeout = 5 * time.Second
+
+// Status is the outcome of a single check
+type Status string
+
+const (
+	StatusOK   Status = "ok"
+	StatusWarn Status = "warn" // startup would continue, possibly with defaults
+	StatusFail Status = "fail"
+)
+
+// Check is the result of validating one part of the configuration
+type Check struct {
+	Name   string
+	Status Status
+	Detail string
+}
+
+// Setting is one line of the effective configuration, with secrets redacted
+type Setting struct {
+	Name  string
+	Value string
+}
+
+// Report collects the checks and the effective configuration
+type Report struct {
+	Checks   []Check
+	Settings []Setting
+}
+
+// Options describe the configuration to check
+type Options struct {
+	// Daemon is the effective configuration: daemon.json with any flag overrides
+	Daemon config.Daemon
+	// DaemonPath is where daemon.json was read from; DaemonErr is any error loading it
+	DaemonPath string
+	DaemonErr  error
+	// Timeout bounds each backend health check (0 uses DefaultTimeout)
+	Timeout time.Duration
+	// NewBackend builds the selected backend (nil uses backend.New without a session)
+	NewBackend func(name string, bao backend.BaoConfig) (backend.Backend, error)
+}
+
+// Run loads and validates everything opx-authd startup does: daemon.json,
+// session config, policy.json, backends/bao.json, the TLS certificate and the
+// selected backend, whose health check runs with a short timeout
+func Run(ctx context.Context, opts Options) Report {
+	var r Report
+	if opts.DaemonErr != nil {
+		r.add("daemon config", StatusFail, fmt.Sprintf("%s: %v", opts.DaemonPath, opts.DaemonErr))
+	} else if err := opts.Daemon.Validate(); err != nil {
+		r.add("daemon config", StatusFail, err.Error())
+	} else {
+		r.add("daemon config", StatusOK, opts.DaemonPath)
+	}
+
+	if _, err := session.LoadConfig(); err != nil {
+		r.add("session config", StatusFail, err.Error())
+	} else {
+		r.add("session config", StatusOK, "")
+	}
+
+	if pol, path, err := policy.Load(); err != nil {
+		r.add("policy", StatusFail, fmt.Sprintf("%s: %v", path, err))
+	} else {
+		if opts.Daemon.PolicyDefaultDeny != nil {
+			pol.DefaultDeny = *opts.Daemon.PolicyDefaultDeny
+		}
+		summary := fmt.Sprintf("%s (%d rules, default_deny=%t)", path, len(pol.Allow), pol.DefaultDeny)
+		if pol.FailsOpen(opts.Daemon.PeerInfoRequired) {
+			r.add("policy", StatusWarn, summary+": fail-open, unidentified callers skip the policy; set peer_info_required to reject them")
+		} else {
+			r.add("policy", StatusOK, summary)
+		}
+	}
+
+	switch err := util.CheckCert(opts.Daemon.CertPolicy()); {
+	case err == nil:
+		r.add("tls certificate", StatusOK, "")
+	case errors.Is(err, util.ErrCertRegenerate):
+		r.add("tls certificate", StatusWarn, err.Error())
+	default:
+		r.add("tls certificate", StatusFail, err.Error())
+	}
+
+	bao := backend.DefaultBaoConfig()
+	usesBao := opts.Daemon.Backend == "bao" || opts.Daemon.Backend == "multi"
+	if usesBao {
+		cfg, path, err := backend.LoadBaoConfig()
+		if err != nil {
+			r.add("bao config", StatusFail, fmt.Sprintf("%s: %v", path, err))
+		} else {
+			bao = cfg
+			r.add("bao config", StatusOK, path)
+		}
+	}
+
+	r.checkBackend(ctx, opts, bao)
+
+	r.Settings = daemonSettings(opts.Daemon)
+	if usesBao {
+		r.Settings = append(r.Settings, prefixed("bao.", redactedSettings(bao))...)
+	}
+	return r
+}
+
+// checkBackend builds the selected backend and pings it, or each sub-backend of a multi backend
+func (r *Report) checkBackend(ctx context.Context, opts Options, bao backend.BaoConfig) {
+	newBackend := opts.NewBackend
+	if newBackend == nil {
+		newBackend = func(name string, bao backend.BaoConfig) (backend.Backend, error) {
+			backend.SetOpEnvPassthrough(opts.Daemon.OpEnvPassthrough)
+			return backend.New(name, nil, bao, backend.OpCLI{ApprovalTimeout: time.Duration(opts.Daemon.OpApprovalTimeoutSeconds) * time.Second})
+		}
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	be, err := newBackend(opts.Daemon.Backend, bao)
+	if err != nil {
+		r.add("backend", StatusFail, err.Error())
+		return
+	}
+	multi, ok := backend.As[*backend.MultiBackend](be)
+	if !ok {
+		status, detail := pingStatus(ctx, be, timeout, StatusFail)
+		r.add("backend", status, detail)
+		return
+	}
+	// A multi daemon still serves its other schemes when one sub-backend is down
+	for _, sub := range multi.Backends() {
+		name := "backend " + sub.Scheme + "://"
+		if sub.Backend == nil {
+			r.add(name, StatusWarn, "not configured")
+			continue
+		}
+		status, detail := pingStatus(ctx, sub.Backend, timeout, StatusWarn)
+		r.add(name, status, detail)
+	}
+}
+
+// pingStatus health-checks be, reporting failed on error
+func pingStatus(ctx context.Context, be backend.Backend, timeout time.Duration, failed Status) (Status, string) {
+	pinger, ok := be.(backend.Pinger)
+	if !ok {
+		return StatusOK, be.Name() + " (no health check)"
+	}
+	pctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := pinger.Ping(pctx); err != nil {
+		return failed, fmt.Sprintf("%s: %v", be.Name(), err)
+	}
+	return StatusOK, be.Name() + " is healthy"
+}
+
+func (r *Report) add(name string, status Status, detail string) {
+	r.Checks = append(r.Checks, Check{Name: name, Status: status, Detail: detail})
+}
+
+// OK reports whether no check failed; warnings don't count
+func (r Report) OK() bool {
+	for _, c := range r.Checks {
+		if c.Status == StatusFail {
+			return false
+		}
+	}
+	return true
+}
+
+// Failed returns the checks that failed
+func (r Report) Failed() []Check {
+	var out []Check
+	for _, c := range r.Checks {
+		if c.Status == StatusFail {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Format renders the checks followed by the effective configuration
+func (r Report) Format() string {
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tSTATUS\tDETAIL")
+	for _, c := range r.Checks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Name, c.Status, c.Detail)
+	}
+	_ = tw.Flush()
+
+	b.WriteString("\nEffective configuration:\n")
+	for _, s := range r.Settings {
+		fmt.Fprintf(&b, "  %s = %s\n", s.Name, s.Value)
+	}
+	return b.String()
+}
+
+// secretKeys mark string settings whose values are never printed
+var secretKeys = []string{"token", "password", "secret"}
+
+// daemonSettings lists d by JSON name; vault_accounts keep vault names but hide accounts
+func daemonSettings(d config.Daemon) []Setting {
+	accounts := d.VaultAccounts
+	d.VaultAccounts = nil
+	if d.ExpectedAccount != "" {
+		d.ExpectedAccount = "***"
+	}
+	settings := redactedSettings(d)
+	if len(accounts) > 0 {
+		vaults := make([]string, 0, len(accounts))
+		for vault := range accounts {
+			vaults = append(vaults, vault+"=***")
+		}
+		sort.Strings(vaults)
+		settings = append(settings, Setting{Name: "vault_accounts", Value: strings.Join(vaults, ",")})
+	}
+	return settings
+}
+
+// redactedSettings flattens v's JSON fields into sorted settings, hiding secret-looking keys
+func redactedSettings(v any) []Setting {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]any
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		return nil
+	}
+
+	settings := make([]Setting, 0, len(fields))
+	for name, value := range fields {
+		shown := fmt.Sprint(value)
+		if str, ok := value.(string); ok && str != "" {
+			for _, secret := range secretKeys {
+				if strings.Contains(name, secret) {
+					shown = "***"
+				}
+			}
+		}
+		settings = append(settings, Setting{Name: name, Value: shown})
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Name < settings[j].Name })
+	return settings
+}
+
+func prefixed(prefix string, settings []Setting) []Setting {
+	for i := range settings {
+		settings[i].Name = prefix + settings[i].Name
+	}
+	return settings
+}
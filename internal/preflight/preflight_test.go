@@ -0,0 +1,159 @@
+package preflight
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/backend"
+	"github.com/zach-source/opx/internal/config"
+)
+
+// isolate points every config and data directory at a fresh temp dir, returning the config dir
+func isolate(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "config"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(home, "data"))
+	t.Setenv("XDG_RUNTIME_DIR", filepath.Join(home, "run"))
+	dir := filepath.Join(home, "config", "op-authd")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	return dir
+}
+
+func fakeDaemon() config.Daemon {
+	d := config.DefaultDaemon()
+	d.Backend = "fake"
+	return d
+}
+
+func TestRun(t *testing.T) {
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	tests := []struct {
+		name       string
+		setup      func(t *testing.T, dir string)
+		daemon     config.Daemon
+		newBackend func(name string, bao backend.BaoConfig) (backend.Backend, error)
+		failed     string // the single check expected to fail, "" for none
+		detail     string
+	}{
+		{name: "valid setup", daemon: fakeDaemon()},
+		{
+			name: "broken policy file",
+			setup: func(t *testing.T, dir string) {
+				if err := os.WriteFile(filepath.Join(dir, "policy.json"), []byte(`{"allow": [`), 0o600); err != nil {
+					t.Fatalf("WriteFile failed: %v", err)
+				}
+			},
+			daemon: fakeDaemon(),
+			failed: "policy",
+			detail: "policy.json: line 1, column 12: unexpected EOF",
+		},
+		{
+			name:   "unreachable vault",
+			daemon: func() config.Daemon { d := config.DefaultDaemon(); d.Backend = "vault"; return d }(),
+			newBackend: func(name string, bao backend.BaoConfig) (backend.Backend, error) {
+				return backend.NewVault(backend.VaultConfig{Address: unreachable.URL}), nil
+			},
+			failed: "backend",
+			detail: "vault health check failed",
+		},
+		{
+			name:   "invalid daemon settings",
+			daemon: func() config.Daemon { d := fakeDaemon(); d.TTLSeconds = -1; return d }(),
+			failed: "daemon config",
+			detail: "ttl_seconds cannot be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := isolate(t)
+			if tt.setup != nil {
+				tt.setup(t, dir)
+			}
+			report := Run(context.Background(), Options{
+				Daemon:     tt.daemon,
+				DaemonPath: filepath.Join(dir, "daemon.json"),
+				Timeout:    time.Second,
+				NewBackend: tt.newBackend,
+			})
+
+			failed := report.Failed()
+			if tt.failed == "" {
+				if !report.OK() {
+					t.Errorf("Expected no failures, got %+v", failed)
+				}
+				return
+			}
+			if report.OK() || len(failed) != 1 {
+				t.Fatalf("Expected only %q to fail, got %+v", tt.failed, failed)
+			}
+			if failed[0].Name != tt.failed || !strings.Contains(failed[0].Detail, tt.detail) {
+				t.Errorf("Expected %s failure containing %q, got %+v", tt.failed, tt.detail, failed[0])
+			}
+		})
+	}
+}
+
+func TestRun_MultiSubBackendDownOnlyWarns(t *testing.T) {
+	isolate(t)
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	d := config.DefaultDaemon()
+	d.Backend = "multi"
+	report := Run(context.Background(), Options{
+		Daemon:  d,
+		Timeout: time.Second,
+		NewBackend: func(name string, bao backend.BaoConfig) (backend.Backend, error) {
+			return backend.NewMultiBackend(backend.Fake{}, backend.NewVault(backend.VaultConfig{Address: unreachable.URL}), nil, "op"), nil
+		},
+	})
+	if !report.OK() {
+		t.Errorf("Expected a down sub-backend not to fail the check, got %+v", report.Failed())
+	}
+	var vault Check
+	for _, c := range report.Checks {
+		if c.Name == "backend vault://" {
+			vault = c
+		}
+	}
+	if vault.Status != StatusWarn {
+		t.Errorf("Expected the vault sub-backend to warn, got %+v", vault)
+	}
+}
+
+func TestReport_FormatRedactsSecrets(t *testing.T) {
+	isolate(t)
+	d := fakeDaemon()
+	d.VaultAccounts = map[string]string{"work": "ACME123"}
+	out := Run(context.Background(), Options{Daemon: d}).Format()
+
+	if strings.Contains(out, "ACME123") {
+		t.Errorf("Expected vault accounts to be redacted, got:\n%s", out)
+	}
+	for _, want := range []string{"vault_accounts = work=***", "backend = fake", "ttl_seconds = 120", "max_request_bytes = 1048576", "track_secret_changes = false"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in the summary, got:\n%s", want, out)
+		}
+	}
+
+	settings := redactedSettings(struct {
+		Address  string `json:"address"`
+		SecretID string `json:"secret_id"`
+	}{Address: "http://localhost:8300", SecretID: "s3cr3t"})
+	if settings[1].Name != "secret_id" || settings[1].Value != "***" {
+		t.Errorf("Expected secret_id to be redacted, got %+v", settings)
+	}
+}
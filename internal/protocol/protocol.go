@@ -1,13 +1,36 @@
 package protocol
 
+import "slices"
+
 type ReadRequest struct {
 	Ref   string   `json:"ref"`
 	Flags []string `json:"flags,omitempty"`
+	// SecretType pins the backend when the daemon runs with --backend=multi:
+	// "" (auto, from the URI scheme), "op", "vault", "bao", "awssm", "azurekv" or "gcpsm"
+	SecretType string `json:"secret_type,omitempty"`
+	// Vars fills ${VAR} and $VAR in the ref; the daemon must run with expand_ref_vars
+	Vars map[string]string `json:"vars,omitempty"`
+	// IncludeChecksum adds ValueSHA256 to the response; ChecksumOnly also leaves Value empty
+	IncludeChecksum bool `json:"include_checksum,omitempty"`
+	ChecksumOnly    bool `json:"checksum_only,omitempty"`
+}
+
+// SecretTypes lists the values accepted in ReadRequest.SecretType
+var SecretTypes = []string{"op", "vault", "bao", "awssm", "azurekv", "gcpsm"}
+
+// ValidSecretType reports whether t is "" (auto) or one of SecretTypes
+func ValidSecretType(t string) bool {
+	return t == "" || slices.Contains(SecretTypes, t)
 }
 
 type ReadsRequest struct {
 	Refs  []string `json:"refs"`
 	Flags []string `json:"flags,omitempty"`
+	// Vars fills ${VAR} and $VAR in the refs; results stay keyed by the refs as sent
+	Vars map[string]string `json:"vars,omitempty"`
+	// IncludeChecksum and ChecksumOnly apply to each result as in ReadRequest
+	IncludeChecksum bool `json:"include_checksum,omitempty"`
+	ChecksumOnly    bool `json:"checksum_only,omitempty"`
 }
 
 type ReadResponse struct {
@@ -16,6 +39,17 @@ type ReadResponse struct {
 	FromCache  bool   `json:"from_cache"`
 	ExpiresIn  int    `json:"expires_in_seconds"`
 	ResolvedAt int64  `json:"resolved_at_unix"`
+	// Age is how many seconds ago the value was read from the backend (0 when fresh)
+	Age int `json:"age_seconds"`
+	// Version and UpdatedAt are the value's version and when it was written, for
+	// backends that report them (Vault and OpenBao KV v2)
+	Version   string `json:"version,omitempty"`
+	UpdatedAt int64  `json:"updated_at_unix,omitempty"`
+	// Error says why a /v1/reads entry failed; its Value is then "ERROR: " and a
+	// message for older clients, never a secret
+	Error string `json:"error,omitempty"`
+	// ValueSHA256 is the hex SHA-256 of the value, only with include_checksum or checksum_only
+	ValueSHA256 string `json:"value_sha256,omitempty"`
 }
 
 type ReadsResponse struct {
@@ -25,28 +59,130 @@ type ReadsResponse struct {
 type ResolveRequest struct {
 	Env   map[string]string `json:"env"` // name -> ref
 	Flags []string          `json:"flags,omitempty"`
+	// RefFlags gives refs their own op flags in place of Flags, keyed by the ref
+	// as it appears in Env, so one batch can read from several accounts
+	RefFlags map[string][]string `json:"ref_flags,omitempty"`
+	// IncludeMeta asks for per-name freshness metadata in ResolveResponse.Meta
+	IncludeMeta bool `json:"include_meta,omitempty"`
+	// Vars fills ${VAR} and $VAR in the refs
+	Vars map[string]string `json:"vars,omitempty"`
+	// IncludeChecksum fills ResolveResponse.ValueSHA256; ChecksumOnly also leaves Env empty
+	IncludeChecksum bool `json:"include_checksum,omitempty"`
+	ChecksumOnly    bool `json:"checksum_only,omitempty"`
+}
+
+// FlagsFor returns the op flags ref is read with: its own from RefFlags, else Flags
+func (r ResolveRequest) FlagsFor(ref string) []string {
+	if flags, ok := r.RefFlags[ref]; ok {
+		return flags
+	}
+	return r.Flags
 }
 
 type ResolveResponse struct {
-	Env map[string]string `json:"env"` // name -> value
+	Env  map[string]string      `json:"env"`            // name -> value
+	Meta map[string]ResolveMeta `json:"meta,omitempty"` // name -> freshness, only with include_meta
+	// ValueSHA256 maps each name to the hex SHA-256 of its value, only with include_checksum or checksum_only
+	ValueSHA256 map[string]string `json:"value_sha256,omitempty"`
+}
+
+// ResolveMeta describes where a resolved value came from; it never carries the value
+type ResolveMeta struct {
+	FromCache  bool   `json:"from_cache"`
+	ExpiresIn  int    `json:"expires_in_seconds"`
+	ResolvedAt int64  `json:"resolved_at_unix"`
+	Backend    string `json:"backend"`
 }
 
 type Status struct {
-	Backend    string         `json:"backend"`
-	CacheSize  int            `json:"cache_size"`
-	Hits       int64          `json:"hits"`
-	Misses     int64          `json:"misses"`
-	InFlight   int            `json:"in_flight"`
-	TTLSeconds int            `json:"ttl_seconds"`
-	SocketPath string         `json:"socket_path"`
-	Session    *SessionStatus `json:"session,omitempty"`
+	Backend             string          `json:"backend"`
+	CacheSize           int             `json:"cache_size"`
+	Hits                int64           `json:"hits"`
+	Misses              int64           `json:"misses"`
+	InFlight            int             `json:"in_flight"`
+	ExpiredHits         int64           `json:"expired_hits"`
+	CleanupRemovedTotal int64           `json:"cleanup_removed_total"`
+	LastCleanupAt       int64           `json:"last_cleanup_at_unix,omitempty"`
+	TTLSeconds          int             `json:"ttl_seconds"`
+	SocketPath          string          `json:"socket_path"`
+	Session             *SessionStatus  `json:"session,omitempty"`
+	Backends            []BackendStatus `json:"backends,omitempty"`
+	// Breakdown splits read traffic by ref scheme and by op:// vault
+	Breakdown *StatusBreakdown `json:"breakdown,omitempty"`
+	// StartedAt is when the daemon began serving, and Uptime how long ago that was
+	StartedAt     int64 `json:"started_at_unix,omitempty"`
+	UptimeSeconds int64 `json:"uptime_seconds,omitempty"`
+	// Audit reports whether audit events are reaching the log file, when audit logging is on
+	Audit *AuditStatus `json:"audit,omitempty"`
+	// CacheBytes approximates the memory held by cached keys and values, and
+	// LargestValueBytes is the biggest cached value; MaxValueBytes is the limit
+	CacheBytes        int64 `json:"cache_bytes,omitempty"`
+	LargestValueBytes int   `json:"largest_value_bytes,omitempty"`
+	MaxValueBytes     int64 `json:"max_value_bytes,omitempty"`
 }
 
+// AuditStatus is the health of the daemon's audit log
+type AuditStatus struct {
+	// Required means reads are refused while events can't be written
+	Required bool `json:"required"`
+	// Failing is true from a failed write until the next successful one
+	Failing       bool   `json:"failing"`
+	DroppedEvents uint64 `json:"dropped_events"`
+	LastError     string `json:"last_error,omitempty"`
+}
+
+// BreakdownOther is the bucket that collects schemes or vaults beyond the daemon's cap
+const BreakdownOther = "other"
+
+// StatusBreakdown holds read counters keyed by ref scheme (op, vault, ...) and by op:// vault name
+type StatusBreakdown struct {
+	Schemes map[string]TrafficStats `json:"schemes"`
+	Vaults  map[string]TrafficStats `json:"vaults"`
+}
+
+// TrafficStats counts reads since the daemon started; latencies cover the most recent reads
+type TrafficStats struct {
+	Requests     int64   `json:"requests"`
+	CacheHits    int64   `json:"cache_hits"`
+	Errors       int64   `json:"errors"`
+	LatencyP50Ms float64 `json:"latency_p50_ms"`
+	LatencyP95Ms float64 `json:"latency_p95_ms"`
+}
+
+// BackendStatus describes one sub-backend of a multi-backend daemon. Health is
+// only set when the status request asked for a probe.
+type BackendStatus struct {
+	Scheme  string `json:"scheme"`
+	Name    string `json:"name,omitempty"`
+	Default bool   `json:"default,omitempty"`
+	Health  string `json:"health,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Backend health values reported by a status probe
+const (
+	HealthOK           = "ok"
+	HealthError        = "error"
+	HealthUnknown      = "unknown"
+	HealthUnconfigured = "unconfigured"
+)
+
 type SessionStatus struct {
 	State         string `json:"state"`
 	IdleTimeout   int    `json:"idle_timeout_seconds"`
 	TimeUntilLock int    `json:"time_until_lock_seconds"`
 	Enabled       bool   `json:"enabled"`
+	// Account is who the 1Password CLI is signed in as, once the daemon has checked
+	Account *SessionAccount `json:"account,omitempty"`
+	// LockReason says why the session last failed to unlock, e.g. a wrong account
+	LockReason string `json:"lock_reason,omitempty"`
+}
+
+// SessionAccount identifies a 1Password account; the email may be redacted
+type SessionAccount struct {
+	UUID  string `json:"uuid,omitempty"`
+	Email string `json:"email,omitempty"`
+	URL   string `json:"url,omitempty"`
 }
 
 type SessionUnlockRequest struct {
@@ -58,3 +194,243 @@ type SessionUnlockResponse struct {
 	State   string `json:"state"`
 	Message string `json:"message,omitempty"`
 }
+
+type SessionTouchResponse struct {
+	Success       bool   `json:"success"`
+	State         string `json:"state"`
+	TimeUntilLock int    `json:"time_until_lock_seconds"`
+}
+
+// SessionReloadResponse reports the session settings applied by /v1/session/reload
+type SessionReloadResponse struct {
+	Success     bool   `json:"success"`
+	IdleTimeout int    `json:"idle_timeout_seconds,omitempty"`
+	Message     string `json:"message,omitempty"`
+}
+
+// SessionEventResponse is the session state returned by the /v1/session/events long-poll
+type SessionEventResponse struct {
+	Seq           uint64 `json:"seq"`
+	State         string `json:"state"`
+	Changed       bool   `json:"changed"`
+	TimeUntilLock int    `json:"time_until_lock_seconds"`
+}
+
+// DebugHeader set to "1" asks for underlying error details; the daemon only
+// includes them when started with --allow-debug
+const DebugHeader = "X-OpAuthd-Debug"
+
+// ErrCodeDeleted marks a ref that was soft-deleted from the cache
+const ErrCodeDeleted = "ERR_DELETED"
+
+// ErrCodeDeadlineExceeded marks a request that ran past the daemon's per-request timeout
+const ErrCodeDeadlineExceeded = "deadline_exceeded"
+
+// ErrCodePolicyDenied marks a read the access policy refused
+const ErrCodePolicyDenied = "policy_denied"
+
+// ErrCodeNotFound marks a ref whose secret, item or field does not exist
+const ErrCodeNotFound = "not_found"
+
+// ErrCodeSessionLocked marks a read refused because the session is locked and could not be unlocked
+const ErrCodeSessionLocked = "session_locked"
+
+// ErrCodeApprovalRequired marks a read waiting on approval: in the 1Password app,
+// or, when the response has an approval_id, from an admin running opx approve
+const ErrCodeApprovalRequired = "approval_required"
+
+// ErrCodeNoBackend marks a ref whose scheme has no backend configured in the daemon
+const ErrCodeNoBackend = "no_backend"
+
+// ErrCodeAuditUnavailable marks a read refused because the daemon requires an
+// audit trail and cannot currently write its audit log
+const ErrCodeAuditUnavailable = "audit_unavailable"
+
+// ErrCodeValueTooLarge marks a secret whose value is over the daemon's max_value_bytes
+const ErrCodeValueTooLarge = "value_too_large"
+
+// ErrCodePeerUnavailable marks a request refused because the daemon could not identify the calling process
+const ErrCodePeerUnavailable = "peer_unavailable"
+
+// ErrorResponse is a structured error body for failures clients may act on
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// ApprovalID names the pending approval an approval_required policy rule is waiting on
+	ApprovalID string `json:"approval_id,omitempty"`
+	// Ref and Hint are the ref a policy_denied error refused and how to request access to it
+	Ref  string `json:"ref,omitempty"`
+	Hint string `json:"hint,omitempty"`
+}
+
+// Approval states
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalDenied   = "denied"
+)
+
+// Approval is a request held by a require_approval policy rule. Once approved,
+// the same binary may retry the ref once before ExpiresAt.
+type Approval struct {
+	ID        string `json:"id"`
+	Ref       string `json:"ref"`
+	Action    string `json:"action"`
+	PeerPath  string `json:"peer_path"`
+	PeerPID   int    `json:"peer_pid"`
+	PeerUID   uint32 `json:"peer_uid"`
+	State     string `json:"state"`
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// ApprovalsResponse lists the approvals that haven't expired or been used, oldest first
+type ApprovalsResponse struct {
+	Approvals []Approval `json:"approvals"`
+}
+
+// ApprovalDecisionRequest approves or denies a pending approval
+type ApprovalDecisionRequest struct {
+	ID   string `json:"id"`
+	Deny bool   `json:"deny,omitempty"`
+}
+
+// CreateField is one field of a new item; Generate asks the backend to generate its value
+type CreateField struct {
+	Name     string `json:"name"`
+	Value    string `json:"value,omitempty"`
+	Generate bool   `json:"generate,omitempty"`
+}
+
+type CreateRequest struct {
+	Vault    string        `json:"vault"`
+	Title    string        `json:"title"`
+	Category string        `json:"category,omitempty"`
+	Fields   []CreateField `json:"fields"`
+	Flags    []string      `json:"flags,omitempty"`
+	// DryRun validates the request and checks the policy without creating anything
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+type CreateResponse struct {
+	Ref string `json:"ref"` // op://vault/title of the new item
+	// DryRun is set when nothing was created. Fields then lists the fields that
+	// would be set, without values; Account is the --account the item would be
+	// created with, and RequiresApproval that a rule would hold it for opx approve.
+	DryRun           bool          `json:"dry_run,omitempty"`
+	Fields           []CreateField `json:"fields,omitempty"`
+	Account          string        `json:"account,omitempty"`
+	RequiresApproval bool          `json:"requires_approval,omitempty"`
+}
+
+type CacheDeleteRequest struct {
+	Ref              string `json:"ref"`
+	TombstoneSeconds int    `json:"tombstone_seconds,omitempty"`
+}
+
+// PolicyExplainRequest asks how the policy decides action on Ref for a subject;
+// without Path or PID the subject is the calling peer
+type PolicyExplainRequest struct {
+	Ref    string `json:"ref"`
+	Path   string `json:"path,omitempty"`
+	PID    int    `json:"pid,omitempty"`
+	Action string `json:"action,omitempty"` // default read
+	// ContainerPath and ContainerID explain for a caller inside a container
+	ContainerPath string `json:"container_path,omitempty"`
+	ContainerID   string `json:"container_id,omitempty"`
+	// CertCN explains for a TCP client with this certificate common name
+	CertCN string `json:"cert_cn,omitempty"`
+}
+
+// PolicyRuleTrace is why one allow rule did or didn't match
+type PolicyRuleTrace struct {
+	Index   int    `json:"index"`
+	Rule    string `json:"rule"`
+	Matched bool   `json:"matched"`
+	Reason  string `json:"reason"`
+}
+
+// PolicyExplainResponse is the decision with the trace of every rule considered
+type PolicyExplainResponse struct {
+	Ref         string            `json:"ref"`
+	Action      string            `json:"action"`
+	SubjectPath string            `json:"subject_path"`
+	SubjectPID  int               `json:"subject_pid"`
+	PolicyPath  string            `json:"policy_path,omitempty"`
+	DefaultDeny bool              `json:"default_deny"`
+	Rules       []PolicyRuleTrace `json:"rules"`
+	Allowed     bool              `json:"allowed"`
+	Reason      string            `json:"reason"`
+	Message     string            `json:"message,omitempty"`
+	// SubjectContainerPath and SubjectContainerID are set for a caller inside a container
+	SubjectContainerPath string `json:"subject_container_path,omitempty"`
+	SubjectContainerID   string `json:"subject_container_id,omitempty"`
+	// SubjectCertCN is set for a TCP client identified by its certificate
+	SubjectCertCN string `json:"subject_cert_cn,omitempty"`
+}
+
+// PolicyReloadResponse reports the policy /v1/policy/reload applied and which
+// read-quota counters carried over because their rule was unchanged
+type PolicyReloadResponse struct {
+	PolicyPath    string `json:"policy_path"`
+	Rules         int    `json:"rules"`
+	DefaultDeny   bool   `json:"default_deny"`
+	QuotasKept    int    `json:"quotas_kept"`
+	QuotasDropped int    `json:"quotas_dropped"`
+}
+
+// QuotaUsage is how much of a max_reads rule's quota one binary has used on one ref
+type QuotaUsage struct {
+	Rule       int    `json:"rule"` // 1-based position in the allow list
+	Path       string `json:"path"`
+	Ref        string `json:"ref"`
+	Reads      int    `json:"reads"`
+	MaxReads   int    `json:"max_reads"`
+	PerSeconds int64  `json:"per_seconds"`
+	// ResetInSeconds is when the oldest counted read leaves the window, freeing a read
+	ResetInSeconds int64 `json:"reset_in_seconds"`
+}
+
+// PolicyUsageResponse lists quota usage for every binary and ref with reads in the window
+type PolicyUsageResponse struct {
+	Usage []QuotaUsage `json:"usage"`
+}
+
+type CacheDeleteResponse struct {
+	Ref              string `json:"ref"`
+	Removed          int    `json:"removed"`
+	TombstoneSeconds int    `json:"tombstone_seconds"`
+}
+
+// CacheEntry describes a cached value without the value itself. Key is the
+// cache key: the ref plus, for reads with a secret type or flags, "|" and a
+// SHA-256 of them. Descriptor names the type and flags with values redacted.
+type CacheEntry struct {
+	Key        string `json:"key"`
+	Ref        string `json:"ref"`
+	Descriptor string `json:"descriptor,omitempty"`
+	ExpiresIn  int    `json:"expires_in_seconds"`
+	ResolvedAt int64  `json:"resolved_at_unix"`
+}
+
+type CacheExpiringResponse struct {
+	Entries []CacheEntry `json:"entries"`
+}
+
+// CacheRefreshRequest names refs to re-read, or with WithinSeconds every entry expiring that soon
+type CacheRefreshRequest struct {
+	Refs          []string `json:"refs,omitempty"`
+	WithinSeconds int      `json:"within_seconds,omitempty"`
+}
+
+type CacheRefreshResponse struct {
+	Refreshed []CacheEntry      `json:"refreshed"`
+	Errors    map[string]string `json:"errors,omitempty"` // keyed by entry descriptor
+}
+
+// RecentRefsResponse lists refs clients read recently, most recent first, that the caller may read.
+// Disabled is set when the daemon keeps no ref history.
+type RecentRefsResponse struct {
+	Refs     []string `json:"refs"`
+	Disabled bool     `json:"disabled,omitempty"`
+}
@@ -121,8 +121,9 @@ func TestReadResponse(t *testing.T) {
 				FromCache:  true,
 				ExpiresIn:  300,
 				ResolvedAt: now,
+				Age:        45,
 			},
-			expected: fmt.Sprintf(`{"ref":"op://vault/item/field","value":"secret-value","from_cache":true,"expires_in_seconds":300,"resolved_at_unix":%d}`, now),
+			expected: fmt.Sprintf(`{"ref":"op://vault/item/field","value":"secret-value","from_cache":true,"expires_in_seconds":300,"resolved_at_unix":%d,"age_seconds":45}`, now),
 		},
 		{
 			name: "fresh response",
@@ -133,7 +134,7 @@ func TestReadResponse(t *testing.T) {
 				ExpiresIn:  600,
 				ResolvedAt: now,
 			},
-			expected: fmt.Sprintf(`{"ref":"op://vault/item/password","value":"password123","from_cache":false,"expires_in_seconds":600,"resolved_at_unix":%d}`, now),
+			expected: fmt.Sprintf(`{"ref":"op://vault/item/password","value":"password123","from_cache":false,"expires_in_seconds":600,"resolved_at_unix":%d,"age_seconds":0}`, now),
 		},
 		{
 			name: "zero values",
@@ -144,7 +145,7 @@ func TestReadResponse(t *testing.T) {
 				ExpiresIn:  0,
 				ResolvedAt: 0,
 			},
-			expected: `{"ref":"","value":"","from_cache":false,"expires_in_seconds":0,"resolved_at_unix":0}`,
+			expected: `{"ref":"","value":"","from_cache":false,"expires_in_seconds":0,"resolved_at_unix":0,"age_seconds":0}`,
 		},
 	}
 
@@ -387,8 +388,12 @@ func TestStatus(t *testing.T) {
 				InFlight:   2,
 				TTLSeconds: 300,
 				SocketPath: "/tmp/op-authd.sock",
+
+				ExpiredHits:         4,
+				CleanupRemovedTotal: 12,
+				LastCleanupAt:       1700000000,
 			},
-			expected: `{"backend":"opcli","cache_size":10,"hits":100,"misses":50,"in_flight":2,"ttl_seconds":300,"socket_path":"/tmp/op-authd.sock"}`,
+			expected: `{"backend":"opcli","cache_size":10,"hits":100,"misses":50,"in_flight":2,"expired_hits":4,"cleanup_removed_total":12,"last_cleanup_at_unix":1700000000,"ttl_seconds":300,"socket_path":"/tmp/op-authd.sock"}`,
 		},
 		{
 			name: "fake backend",
@@ -401,7 +406,7 @@ func TestStatus(t *testing.T) {
 				TTLSeconds: 600,
 				SocketPath: "/var/run/op-authd.sock",
 			},
-			expected: `{"backend":"fake","cache_size":0,"hits":0,"misses":0,"in_flight":0,"ttl_seconds":600,"socket_path":"/var/run/op-authd.sock"}`,
+			expected: `{"backend":"fake","cache_size":0,"hits":0,"misses":0,"in_flight":0,"expired_hits":0,"cleanup_removed_total":0,"ttl_seconds":600,"socket_path":"/var/run/op-authd.sock"}`,
 		},
 		{
 			name: "zero values",
@@ -414,7 +419,7 @@ func TestStatus(t *testing.T) {
 				TTLSeconds: 0,
 				SocketPath: "",
 			},
-			expected: `{"backend":"","cache_size":0,"hits":0,"misses":0,"in_flight":0,"ttl_seconds":0,"socket_path":""}`,
+			expected: `{"backend":"","cache_size":0,"hits":0,"misses":0,"in_flight":0,"expired_hits":0,"cleanup_removed_total":0,"ttl_seconds":0,"socket_path":""}`,
 		},
 	}
 
@@ -541,3 +546,19 @@ func BenchmarkStatusMarshal(b *testing.B) {
 		_, _ = json.Marshal(status)
 	}
 }
+
+func TestServerTiming_RoundTrip(t *testing.T) {
+	st := ServerTiming{Total: 125 * time.Millisecond, Cache: 250 * time.Microsecond, Queue: 3 * time.Millisecond, Backend: 120 * time.Millisecond}
+	header := st.String()
+	expected := "total;dur=125.000, cache;dur=0.250, queue;dur=3.000, backend;dur=120.000"
+	if header != expected {
+		t.Errorf("Expected %q, got %q", expected, header)
+	}
+	got, ok := ParseServerTiming(header + `, db;desc="other";dur=9`)
+	if !ok || got != st {
+		t.Errorf("Expected %+v, got %+v (%t)", st, got, ok)
+	}
+	if _, ok := ParseServerTiming(""); ok {
+		t.Error("Expected no timing from an empty header")
+	}
+}
@@ -0,0 +1,68 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimingHeader set to "1" asks the daemon to report where a request's time went
+// in a Server-Timing response header
+const TimingHeader = "X-OpAuthd-Timing"
+
+// ServerTimingHeader is the standard response header carrying ServerTiming
+const ServerTimingHeader = "Server-Timing"
+
+// ServerTiming is how long the daemon spent on a request and its phases. Cache,
+// Queue and Backend are summed over every ref a request read, so for concurrent
+// resolves they can add up to more than Total.
+type ServerTiming struct {
+	Total   time.Duration // handler start to response
+	Cache   time.Duration // cache lookups
+	Queue   time.Duration // waiting for a resolve slot or another request's read of the same ref
+	Backend time.Duration // backend reads
+}
+
+// timingMetric is a Server-Timing metric name and the field it maps to
+type timingMetric struct {
+	name string
+	d    *time.Duration
+}
+
+func (t *ServerTiming) metrics() []timingMetric {
+	return []timingMetric{{"total", &t.Total}, {"cache", &t.Cache}, {"queue", &t.Queue}, {"backend", &t.Backend}}
+}
+
+// String renders t as a Server-Timing value, durations in milliseconds
+func (t ServerTiming) String() string {
+	var parts []string
+	for _, m := range t.metrics() {
+		parts = append(parts, fmt.Sprintf("%s;dur=%.3f", m.name, float64(*m.d)/float64(time.Millisecond)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ParseServerTiming reads the metrics ServerTiming.String writes, ignoring any others
+func ParseServerTiming(header string) (ServerTiming, bool) {
+	var t ServerTiming
+	found := false
+	for _, entry := range strings.Split(header, ",") {
+		params := strings.Split(entry, ";")
+		name := strings.TrimSpace(params[0])
+		for _, m := range t.metrics() {
+			if m.name != name {
+				continue
+			}
+			for _, p := range params[1:] {
+				if v, ok := strings.CutPrefix(strings.TrimSpace(p), "dur="); ok {
+					if ms, err := strconv.ParseFloat(v, 64); err == nil {
+						*m.d = time.Duration(ms * float64(time.Millisecond))
+						found = true
+					}
+				}
+			}
+		}
+	}
+	return t, found
+}
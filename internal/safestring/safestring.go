@@ -42,6 +42,22 @@ func (s *SafeString) Bytes() []byte {
 	return result
 }
 
+// Use passes the underlying bytes to fn without copying them; fn must not keep or modify them
+func (s *SafeString) Use(fn func(b []byte)) {
+	if s == nil {
+		fn(nil)
+		return
+	}
+	fn(s.data)
+}
+
+// ZeroBytes overwrites b with zeros
+func ZeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
 // Len returns the length of the string
 func (s *SafeString) Len() int {
 	if s == nil || s.data == nil {
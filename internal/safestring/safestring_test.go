@@ -255,3 +255,20 @@ func BenchmarkEqual(b *testing.B) {
 		safe1.Equal(safe2)
 	}
 }
+
+func TestUse(t *testing.T) {
+	safe := New("borrowed")
+	var got string
+	safe.Use(func(b []byte) { got = string(b) })
+	if got != "borrowed" {
+		t.Errorf("Expected %q, got %q", "borrowed", got)
+	}
+
+	buf := []byte("secret")
+	ZeroBytes(buf)
+	for _, c := range buf {
+		if c != 0 {
+			t.Fatalf("Expected zeroed bytes, got %q", buf)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package security
+
+import (
+	"crypto/tls"
+	"errors"
+)
+
+// PeerFromTLSConn identifies a TCP client by the common name of the client
+// certificate it was verified with. The handshake must have completed.
+func PeerFromTLSConn(conn *tls.Conn) (PeerInfo, error) {
+	state := conn.ConnectionState()
+	if !state.HandshakeComplete || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return PeerInfo{}, errors.New("no verified client certificate")
+	}
+	cn := state.VerifiedChains[0][0].Subject.CommonName
+	if cn == "" {
+		return PeerInfo{}, errors.New("client certificate has no common name")
+	}
+	return PeerInfo{CertCN: cn}, nil
+}
+
+// NewCertPeer defers PeerFromTLSConn until Get is called, after the HTTP server
+// has completed the handshake. onResolve (optional) runs once after resolution.
+func NewCertPeer(conn *tls.Conn, onResolve func(PeerInfo, error)) *LazyPeer {
+	return &LazyPeer{
+		resolve:   func() (PeerInfo, error) { return PeerFromTLSConn(conn) },
+		onResolve: onResolve,
+	}
+}
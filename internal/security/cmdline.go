@@ -0,0 +1,43 @@
+package security
+
+import (
+	"regexp"
+	"unicode/utf8"
+)
+
+// DefaultCmdlineMax is the default number of bytes of a peer command line kept in audit events
+const DefaultCmdlineMax = 256
+
+// cmdlineSecretPattern matches key=value arguments that commonly carry credentials
+var cmdlineSecretPattern = regexp.MustCompile(`(?i)(password|token|secret)=\S+`)
+
+// Platform lookup, replaceable in tests
+var lookupCmdline = platformCmdline
+
+// RedactCmdline masks the values of password=, token= and secret= style arguments
+func RedactCmdline(cmdline string) string {
+	return cmdlineSecretPattern.ReplaceAllString(cmdline, "${1}=[REDACTED]")
+}
+
+// TruncateCmdline shortens cmdline to at most maxLen bytes (plus "...") without
+// splitting a UTF-8 sequence. maxLen <= 0 leaves it unchanged.
+func TruncateCmdline(cmdline string, maxLen int) string {
+	if maxLen <= 0 || len(cmdline) <= maxLen {
+		return cmdline
+	}
+	cut := maxLen
+	for cut > 0 && !utf8.RuneStart(cmdline[cut]) {
+		cut--
+	}
+	return cmdline[:cut] + "..."
+}
+
+// PeerCmdline returns the redacted command line of pid truncated to maxLen bytes,
+// or "" if it can't be read. Lookups are cached per process like exe paths.
+// Redaction runs first so truncation can't expose a partial secret.
+func PeerCmdline(pid, maxLen int) string {
+	if pid <= 0 {
+		return ""
+	}
+	return TruncateCmdline(RedactCmdline(cmdlineCache.get(pid, lookupCmdline)), maxLen)
+}
@@ -0,0 +1,105 @@
+package security
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRedactCmdline(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"curl https://example.com", "curl https://example.com"},
+		{"tool --password=hunter2 --verbose", "tool --password=[REDACTED] --verbose"},
+		{"tool TOKEN=abc123 SECRET=xyz", "tool TOKEN=[REDACTED] SECRET=[REDACTED]"},
+		{"deploy --db-password=p@ss word", "deploy --db-password=[REDACTED] word"},
+		{"client api_token=t1 client_secret=s1", "client api_token=[REDACTED] client_secret=[REDACTED]"},
+		{"tool --password hunter2", "tool --password hunter2"}, // only key=value forms are recognized
+		{"tool password=", "tool password="},
+	}
+
+	for _, tt := range tests {
+		if got := RedactCmdline(tt.input); got != tt.expected {
+			t.Errorf("RedactCmdline(%q): expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestTruncateCmdline(t *testing.T) {
+	tests := []struct {
+		input    string
+		maxLen   int
+		expected string
+	}{
+		{"short", 10, "short"},
+		{"exactly10!", 10, "exactly10!"},
+		{"this is too long", 7, "this is..."},
+		{"unlimited", 0, "unlimited"},
+		{"héllo", 2, "h..."}, // don't split the two-byte é
+	}
+
+	for _, tt := range tests {
+		if got := TruncateCmdline(tt.input, tt.maxLen); got != tt.expected {
+			t.Errorf("TruncateCmdline(%q, %d): expected %q, got %q", tt.input, tt.maxLen, tt.expected, got)
+		}
+	}
+}
+
+func TestPeerCmdline_RedactsBeforeTruncating(t *testing.T) {
+	stubProcLookups(t, func(int) (uint64, error) { return 1, nil }, func(int) string { return "" })
+	stubCmdline(t, func(int) string { return "app --token=0123456789abcdef --flag" })
+
+	got := PeerCmdline(42, 16)
+	if strings.Contains(got, "0123") {
+		t.Errorf("Expected no part of the token to survive truncation, got %q", got)
+	}
+	if got != "app --token=[RED..." {
+		t.Errorf("Expected %q, got %q", "app --token=[RED...", got)
+	}
+	if PeerCmdline(0, 16) != "" {
+		t.Error("Expected empty cmdline for invalid PID")
+	}
+}
+
+// stubCmdline replaces the platform command line lookup for the duration of a test
+func stubCmdline(t *testing.T, fn func(int) string) {
+	t.Helper()
+	orig := lookupCmdline
+	lookupCmdline = fn
+	t.Cleanup(func() { lookupCmdline = orig })
+}
+
+func TestPeerCmdline_CachedPerProcess(t *testing.T) {
+	var lookups int
+	startTime := uint64(100)
+	stubProcLookups(t, func(int) (uint64, error) { return startTime, nil }, func(int) string { return "" })
+	stubCmdline(t, func(int) string { lookups++; return fmt.Sprintf("app --run %d", lookups) })
+
+	first := PeerCmdline(1234, 64)
+	if again := PeerCmdline(1234, 64); again != first || lookups != 1 {
+		t.Errorf("Expected cached %q after 1 lookup, got %q after %d", first, again, lookups)
+	}
+
+	// A reused PID is a different process
+	startTime = 200
+	if next := PeerCmdline(1234, 64); next == first || lookups != 2 {
+		t.Errorf("Expected a fresh lookup after start time change, got %q after %d lookups", next, lookups)
+	}
+}
+
+func TestPeerCmdline_Self(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("command lines are only collected on Linux and macOS")
+	}
+	got := PeerCmdline(os.Getpid(), 4096)
+	if got == "" {
+		t.Skip("Could not read own command line (may be expected in some environments)")
+	}
+	if !strings.Contains(got, "test") {
+		t.Errorf("Expected test binary in own command line, got %q", got)
+	}
+}
@@ -0,0 +1,96 @@
+package security
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// procReader reads the /proc entries container detection needs, so tests can use fixture layouts
+type procReader interface {
+	Readlink(name string) (string, error)
+	ReadFile(name string) ([]byte, error)
+	Exists(name string) bool
+}
+
+// procDir reads a /proc layout rooted at a directory
+type procDir string
+
+func (d procDir) Readlink(name string) (string, error) {
+	return os.Readlink(filepath.Join(string(d), name))
+}
+
+func (d procDir) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(d), name))
+}
+
+func (d procDir) Exists(name string) bool {
+	_, err := os.Lstat(filepath.Join(string(d), name))
+	return err == nil
+}
+
+// containerIDPattern matches the 64-hex container ID in cgroup paths such as
+// /docker/<id>, docker-<id>.scope, libpod-<id>.scope or cri-containerd-<id>.scope
+var containerIDPattern = regexp.MustCompile(`(?:^|[/\-])([0-9a-f]{64})(?:\.scope)?$`)
+
+// cgroupContainerID returns the container ID named in /proc/<pid>/cgroup content, or ""
+func cgroupContainerID(cgroup []byte) string {
+	id := ""
+	for _, line := range strings.Split(string(cgroup), "\n") {
+		// hierarchy-ID:controllers:path
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, segment := range strings.Split(parts[2], "/") {
+			if m := containerIDPattern.FindStringSubmatch(segment); m != nil {
+				id = m[1]
+			}
+		}
+	}
+	return id
+}
+
+// containerPeer reports whether pid runs inside a container sharing the
+// socket, with its executable's path inside the container and the container ID
+// from its cgroup. A peer counts as containerized when its cgroup names a
+// container and it is in another mount namespace or its exe can't be read, or
+// when it is in another mount namespace and its exe can't be read or only
+// resolves under /proc/<pid>/root. Another mount namespace alone, as with
+// systemd's PrivateTmp, snaps, flatpaks or unshare -m, isn't enough. host is
+// the host's root directory, for checking where the exe resolves.
+func containerPeer(proc procReader, host string, pid int) (path, id string, ok bool) {
+	if pid <= 0 {
+		return "", "", false
+	}
+	dir := strconv.Itoa(pid)
+	exe, exeErr := proc.Readlink(dir + "/exe")
+	if cgroup, err := proc.ReadFile(dir + "/cgroup"); err == nil {
+		id = cgroupContainerID(cgroup)
+	}
+
+	self, selfErr := proc.Readlink("self/ns/mnt")
+	peer, peerErr := proc.Readlink(dir + "/ns/mnt")
+	otherNS := selfErr == nil && peerErr == nil && self != peer
+	switch {
+	case id != "" && (otherNS || exeErr != nil):
+	case otherNS && (exeErr != nil || containerOnlyPath(proc, host, dir, exe)):
+	default:
+		return "", "", false
+	}
+	if exeErr != nil {
+		exe = ""
+	}
+	return exe, id, true
+}
+
+// containerOnlyPath reports whether exe is missing on the host but present
+// under the peer's root, so it can only name a file inside the peer's mount namespace
+func containerOnlyPath(proc procReader, host, dir, exe string) bool {
+	if _, err := os.Lstat(filepath.Join(host, exe)); err == nil {
+		return false
+	}
+	return proc.Exists(dir + "/root" + exe)
+}
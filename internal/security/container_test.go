@@ -0,0 +1,205 @@
+package security
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testContainerID = "4f1c6a7be4a95dd0c4bd20f4f4b0c63c2f0a5b3a8f2e1d9c7b6a5f4e3d2c1b0a"
+
+// procFixture lays out a fake /proc: "name -> target" entries become symlinks,
+// the rest regular files
+func procFixture(t *testing.T, links, files map[string]string) procDir {
+	t.Helper()
+	root := t.TempDir()
+	for name, target := range links {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := os.Symlink(target, path); err != nil {
+			t.Fatalf("Symlink failed: %v", err)
+		}
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+	return procDir(root)
+}
+
+func TestCgroupContainerID(t *testing.T) {
+	tests := []struct {
+		name     string
+		cgroup   string
+		expected string
+	}{
+		{name: "cgroup v2 docker scope", cgroup: "0::/system.slice/docker-" + testContainerID + ".scope\n", expected: testContainerID},
+		{name: "cgroup v1 docker", cgroup: "12:memory:/docker/" + testContainerID + "\n11:cpu:/docker/" + testContainerID + "\n", expected: testContainerID},
+		{name: "podman", cgroup: "0::/user.slice/user-1000.slice/user@1000.service/user.slice/libpod-" + testContainerID + ".scope/container\n", expected: testContainerID},
+		{name: "kubernetes containerd", cgroup: "0::/kubepods.slice/kubepods-pod1.slice/cri-containerd-" + testContainerID + ".scope\n", expected: testContainerID},
+		{name: "host session", cgroup: "0::/user.slice/user-1000.slice/session-2.scope\n"},
+		{name: "short hex is not an id", cgroup: "0::/docker/abc123\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cgroupContainerID([]byte(tt.cgroup)); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// hostFixture lays out a fake host root holding empty files at paths
+func hostFixture(t *testing.T, paths ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, path := range paths {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0o700); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := os.WriteFile(full, nil, 0o700); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+	return root
+}
+
+func TestContainerPeer(t *testing.T) {
+	const hostNS, containerNS = "mnt:[4026531841]", "mnt:[4026532999]"
+	dockerCgroup := "0::/system.slice/docker-" + testContainerID + ".scope\n"
+	serviceCgroup := "0::/system.slice/app.service\n"
+	tests := []struct {
+		name      string
+		links     map[string]string
+		files     map[string]string
+		host      []string
+		container bool
+		path, id  string
+	}{
+		{
+			name:  "host process",
+			links: map[string]string{"self/ns/mnt": hostNS, "42/ns/mnt": hostNS, "42/exe": "/usr/bin/curl"},
+			files: map[string]string{"42/cgroup": "0::/user.slice/session-2.scope\n"},
+			host:  []string{"/usr/bin/curl"},
+		},
+		{
+			name:      "container in another mount namespace",
+			links:     map[string]string{"self/ns/mnt": hostNS, "42/ns/mnt": containerNS, "42/exe": "/usr/local/bin/app"},
+			files:     map[string]string{"42/cgroup": dockerCgroup},
+			host:      []string{"/usr/local/bin/app"},
+			container: true, path: "/usr/local/bin/app", id: testContainerID,
+		},
+		{
+			name:      "unreadable exe and namespace with a container cgroup",
+			links:     map[string]string{"self/ns/mnt": hostNS},
+			files:     map[string]string{"42/cgroup": dockerCgroup},
+			container: true, id: testContainerID,
+		},
+		{
+			name:  "unreadable exe on the host",
+			links: map[string]string{"self/ns/mnt": hostNS},
+			files: map[string]string{"42/cgroup": serviceCgroup},
+		},
+		{
+			name:  "private mount namespace with the exe on the host",
+			links: map[string]string{"self/ns/mnt": hostNS, "42/ns/mnt": containerNS, "42/exe": "/usr/bin/app"},
+			files: map[string]string{"42/cgroup": serviceCgroup, "42/root/usr/bin/app": ""},
+			host:  []string{"/usr/bin/app"},
+		},
+		{
+			name:  "private mount namespace with the exe in neither root",
+			links: map[string]string{"self/ns/mnt": hostNS, "42/ns/mnt": containerNS, "42/exe": "/tmp/app"},
+			files: map[string]string{"42/cgroup": serviceCgroup},
+		},
+		{
+			name:  "exe only under the peer's root in the same mount namespace",
+			links: map[string]string{"self/ns/mnt": hostNS, "42/ns/mnt": hostNS, "42/exe": "/app/bin/tool"},
+			files: map[string]string{"42/cgroup": serviceCgroup, "42/root/app/bin/tool": ""},
+		},
+		{
+			name:      "another namespace with the exe only under the peer's root",
+			links:     map[string]string{"self/ns/mnt": hostNS, "42/ns/mnt": containerNS, "42/exe": "/app/bin/tool"},
+			files:     map[string]string{"42/cgroup": serviceCgroup, "42/root/app/bin/tool": ""},
+			container: true, path: "/app/bin/tool",
+		},
+		{
+			name:      "another namespace with an unreadable exe",
+			links:     map[string]string{"self/ns/mnt": hostNS, "42/ns/mnt": containerNS},
+			files:     map[string]string{"42/cgroup": serviceCgroup},
+			container: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proc := procFixture(t, tt.links, tt.files)
+			path, id, ok := containerPeer(proc, hostFixture(t, tt.host...), 42)
+			if ok != tt.container || path != tt.path || id != tt.id {
+				t.Errorf("Expected (%q, %q, %v), got (%q, %q, %v)", tt.path, tt.id, tt.container, path, id, ok)
+			}
+		})
+	}
+}
+
+func TestPeerFromUnixConn_Container(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("peer credentials unsupported on this platform")
+	}
+	orig := lookupContainer
+	defer func() { lookupContainer = orig }()
+	lookupContainer = func(pid int) (string, string, bool) { return "/usr/local/bin/app", testContainerID, true }
+
+	server, client := unixConnPair(t)
+	defer server.Close()
+	defer client.Close()
+
+	pi, err := PeerFromUnixConn(server)
+	if err != nil {
+		t.Fatalf("PeerFromUnixConn failed: %v", err)
+	}
+	if pi.Path != "" || pi.ContainerPath != "/usr/local/bin/app" || pi.ContainerID != testContainerID {
+		t.Errorf("Expected only the container path and ID, got %+v", pi)
+	}
+	if !strings.Contains(pi.String(), "Container:"+testContainerID) {
+		t.Errorf("Expected the container in %q", pi.String())
+	}
+}
+
+func TestPeerFromUnixConn_PrivateMountNamespaceKeepsPath(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("peer credentials unsupported on this platform")
+	}
+	pid := strconv.Itoa(os.Getpid())
+	proc := procFixture(t,
+		map[string]string{"self/ns/mnt": "mnt:[4026531841]", pid + "/ns/mnt": "mnt:[4026532999]", pid + "/exe": "/usr/bin/app"},
+		map[string]string{pid + "/cgroup": "0::/system.slice/app.service\n"})
+	host := hostFixture(t, "/usr/bin/app")
+	stubProcLookups(t, func(int) (uint64, error) { return 1, nil }, func(int) string { return "/usr/bin/app" })
+	orig := lookupContainer
+	defer func() { lookupContainer = orig }()
+	lookupContainer = func(pid int) (string, string, bool) { return containerPeer(proc, host, pid) }
+
+	server, client := unixConnPair(t)
+	defer server.Close()
+	defer client.Close()
+
+	pi, err := PeerFromUnixConn(server)
+	if err != nil {
+		t.Fatalf("PeerFromUnixConn failed: %v", err)
+	}
+	if pi.Path != "/usr/bin/app" || pi.ContainerPath != "" || pi.ContainerID != "" {
+		t.Errorf("Expected only the host path, got %+v", pi)
+	}
+}
@@ -3,14 +3,8 @@ package security
 import (
 	"fmt"
 	"net"
-	"os"
-	"os/exec"
-	"path/filepath"
-	"runtime"
-	"strconv"
-	"strings"
-
-	"golang.org/x/sys/unix"
+	"sync"
+	"time"
 )
 
 type PeerInfo struct {
@@ -18,6 +12,18 @@ type PeerInfo struct {
 	UID  uint32
 	GID  uint32
 	Path string // best-effort executable path
+	// ContainerPath and ContainerID describe a peer inside a container sharing
+	// the socket: its executable's path inside the container and the ID from its
+	// cgroup. Path is empty for such peers; a peer that is merely in a private
+	// mount namespace keeps its host Path.
+	ContainerPath string `json:",omitempty"`
+	ContainerID   string `json:",omitempty"`
+	// CertCN is the client certificate's common name for a peer on the TCP
+	// listener, which has no PID, UID or path
+	CertCN string `json:",omitempty"`
+	// Cmdline is the redacted, truncated command line, only collected when audit
+	// events include it; it is emitted as AuditEvent.PeerCmdline instead
+	Cmdline string `json:"-"`
 }
 
 // PeerFromUnixConn extracts peer credentials from a *net.UnixConn.
@@ -30,27 +36,7 @@ func PeerFromUnixConn(conn *net.UnixConn) (PeerInfo, error) {
 	var serr error
 
 	err = raw.Control(func(fd uintptr) {
-		switch runtime.GOOS {
-		case "linux":
-			// Get peer PID using SO_PEERCRED on Linux
-			// For now, just get PID - UID/GID can be added later with more complex syscalls
-			const SO_PEERCRED = 17
-			pid, e := unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, SO_PEERCRED)
-			if e != nil {
-				serr = e
-				return
-			}
-			pi = PeerInfo{PID: pid}
-		case "darwin":
-			pid, e := unix.GetsockoptInt(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERPID)
-			if e != nil {
-				serr = e
-				return
-			}
-			pi = PeerInfo{PID: pid}
-		default:
-			serr = fmt.Errorf("peer creds unsupported on %s", runtime.GOOS)
-		}
+		pi, serr = peerCredentials(int(fd))
 	})
 	if err != nil {
 		return PeerInfo{}, err
@@ -59,33 +45,155 @@ func PeerFromUnixConn(conn *net.UnixConn) (PeerInfo, error) {
 		return PeerInfo{}, serr
 	}
 
-	// Best-effort executable path
+	// Best-effort executable path; a container's path means nothing on the host
 	pi.Path = exePathForPID(pi.PID)
+	if path, id, ok := lookupContainer(pi.PID); ok {
+		pi.Path, pi.ContainerPath, pi.ContainerID = "", path, id
+	}
 	return pi, nil
 }
 
-func exePathForPID(pid int) string {
+// LazyPeer resolves peer credentials for a connection on first use and memoizes the result
+type LazyPeer struct {
+	once      sync.Once
+	resolve   func() (PeerInfo, error)
+	onResolve func(PeerInfo, error)
+	info      PeerInfo
+	err       error
+}
+
+// NewLazyPeer defers PeerFromUnixConn until Get is called. onResolve (optional) runs once after resolution.
+func NewLazyPeer(conn *net.UnixConn, onResolve func(PeerInfo, error)) *LazyPeer {
+	return NewLazyPeerWithCmdline(conn, 0, onResolve)
+}
+
+// NewLazyPeerWithCmdline is NewLazyPeer that also captures the peer's command line,
+// redacted and truncated to cmdlineMax bytes (0 skips it)
+func NewLazyPeerWithCmdline(conn *net.UnixConn, cmdlineMax int, onResolve func(PeerInfo, error)) *LazyPeer {
+	return &LazyPeer{
+		resolve: func() (PeerInfo, error) {
+			pi, err := PeerFromUnixConn(conn)
+			if err == nil && cmdlineMax > 0 {
+				pi.Cmdline = PeerCmdline(pi.PID, cmdlineMax)
+			}
+			return pi, err
+		},
+		onResolve: onResolve,
+	}
+}
+
+// Get returns the peer credentials, resolving them on the first call. Safe for concurrent use.
+func (lp *LazyPeer) Get() (PeerInfo, error) {
+	lp.once.Do(func() {
+		lp.info, lp.err = lp.resolve()
+		if lp.onResolve != nil {
+			lp.onResolve(lp.info, lp.err)
+		}
+	})
+	return lp.info, lp.err
+}
+
+// procCacheTTL bounds how long a PID+start-time -> value mapping is reused
+const procCacheTTL = 30 * time.Second
+
+// procKey identifies a process instance; the start time guards against PID reuse
+type procKey struct {
+	pid   int
+	start uint64
+}
+
+type procCacheEntry struct {
+	value   string
+	expires time.Time
+}
+
+// procCache memoizes per-process lookups across connections. Empty results
+// are not cached so transient failures are retried.
+type procCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	entries map[procKey]procCacheEntry
+}
+
+func newProcCache() *procCache {
+	return &procCache{ttl: procCacheTTL, entries: make(map[procKey]procCacheEntry)}
+}
+
+var (
+	exePathCache = newProcCache()
+	cmdlineCache = newProcCache()
+)
+
+// Platform lookups, replaceable in tests
+var (
+	lookupExePath   = platformExePath
+	lookupStartTime = processStartTime
+	lookupContainer = platformContainer
+)
+
+// get returns the cached value for pid, calling fetch on a miss
+func (c *procCache) get(pid int, fetch func(int) string) string {
 	if pid <= 0 {
 		return ""
 	}
-	switch runtime.GOOS {
-	case "linux":
-		p := fmt.Sprintf("/proc/%d/exe", pid)
-		if target, err := os.Readlink(p); err == nil {
-			return target
-		}
-	case "darwin":
-		out, err := exec.Command("/bin/ps", "-o", "comm=", "-p", strconv.Itoa(pid)).Output()
-		if err == nil {
-			s := string(out)
-			return filepath.Clean(strings.TrimSpace(s))
+	start, err := lookupStartTime(pid)
+	if err != nil {
+		// Without a start time we can't safely key the cache
+		return fetch(pid)
+	}
+	key := procKey{pid: pid, start: start}
+	now := time.Now()
+
+	c.Lock()
+	if e, ok := c.entries[key]; ok && now.Before(e.expires) {
+		c.Unlock()
+		return e.value
+	}
+	c.Unlock()
+
+	value := fetch(pid)
+	if value == "" {
+		return ""
+	}
+
+	c.Lock()
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
 		}
 	}
-	return ""
+	c.entries[key] = procCacheEntry{value: value, expires: now.Add(c.ttl)}
+	c.Unlock()
+	return value
+}
+
+// reset drops all cached entries
+func (c *procCache) reset() {
+	c.Lock()
+	c.entries = make(map[procKey]procCacheEntry)
+	c.Unlock()
+}
+
+func exePathForPID(pid int) string {
+	return exePathCache.get(pid, lookupExePath)
+}
+
+// Label names the peer's binary, or cert:CN for a TCP client
+func (pi PeerInfo) Label() string {
+	if pi.CertCN != "" {
+		return "cert:" + pi.CertCN
+	}
+	return pi.Path
 }
 
 // String returns a human-readable representation of PeerInfo
 func (pi PeerInfo) String() string {
+	if pi.CertCN != "" {
+		return "Cert:" + pi.CertCN
+	}
+	if pi.ContainerPath != "" || pi.ContainerID != "" {
+		return fmt.Sprintf("PID:%d Container:%s ContainerPath:%s UID:%d GID:%d", pi.PID, pi.ContainerID, pi.ContainerPath, pi.UID, pi.GID)
+	}
 	if pi.Path != "" {
 		return fmt.Sprintf("PID:%d Path:%s UID:%d GID:%d", pi.PID, pi.Path, pi.UID, pi.GID)
 	}
@@ -0,0 +1,66 @@
+//go:build darwin
+
+package security
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerCredentials reads the peer's PID using LOCAL_PEERPID and its UID/GID using LOCAL_PEERCRED
+func peerCredentials(fd int) (PeerInfo, error) {
+	pid, err := unix.GetsockoptInt(fd, unix.SOL_LOCAL, unix.LOCAL_PEERPID)
+	if err != nil {
+		return PeerInfo{}, err
+	}
+	pi := PeerInfo{PID: pid}
+	if cred, err := unix.GetsockoptXucred(fd, unix.SOL_LOCAL, unix.LOCAL_PEERCRED); err == nil {
+		pi.UID = cred.Uid
+		if cred.Ngroups > 0 {
+			pi.GID = cred.Groups[0]
+		}
+	}
+	return pi, nil
+}
+
+// platformExePath resolves the executable path by asking ps (expensive; callers cache the result)
+func platformExePath(pid int) string {
+	out, err := exec.Command("/bin/ps", "-o", "comm=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return ""
+	}
+	s := strings.TrimSpace(string(out))
+	if s == "" {
+		return ""
+	}
+	return filepath.Clean(s)
+}
+
+// platformContainer never reports containers: they run in a Linux VM whose
+// processes reach the socket through a proxy, not as peers
+func platformContainer(pid int) (string, string, bool) {
+	return "", "", false
+}
+
+// processStartTime returns the process start time in microseconds since the epoch
+func processStartTime(pid int) (uint64, error) {
+	kp, err := unix.SysctlKinfoProc("kern.proc.pid", pid)
+	if err != nil {
+		return 0, err
+	}
+	tv := kp.Proc.P_starttime
+	return uint64(tv.Sec)*1e6 + uint64(tv.Usec), nil
+}
+
+// platformCmdline asks ps for the full argument list
+func platformCmdline(pid int) string {
+	out, err := exec.Command("/bin/ps", "-o", "args=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
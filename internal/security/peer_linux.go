@@ -0,0 +1,63 @@
+//go:build linux
+
+package security
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerCredentials reads the peer's PID, UID and GID using SO_PEERCRED
+func peerCredentials(fd int) (PeerInfo, error) {
+	cred, err := unix.GetsockoptUcred(fd, unix.SOL_SOCKET, unix.SO_PEERCRED)
+	if err != nil {
+		return PeerInfo{}, err
+	}
+	return PeerInfo{PID: int(cred.Pid), UID: cred.Uid, GID: cred.Gid}, nil
+}
+
+// platformExePath resolves the executable path via /proc/<pid>/exe
+func platformExePath(pid int) string {
+	if target, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid)); err == nil {
+		return target
+	}
+	return ""
+}
+
+// platformContainer detects peers inside containers through /proc
+func platformContainer(pid int) (string, string, bool) {
+	return containerPeer(procDir("/proc"), "/", pid)
+}
+
+// processStartTime returns the process start time in clock ticks since boot (field 22 of /proc/<pid>/stat)
+func processStartTime(pid int) (uint64, error) {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	// The command name may contain spaces and parentheses, so skip past the last ')'
+	s := string(b)
+	idx := strings.LastIndexByte(s, ')')
+	if idx < 0 {
+		return 0, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	fields := strings.Fields(s[idx+1:])
+	// fields[0] is the state (field 3), so starttime (field 22) is fields[19]
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("short stat for pid %d", pid)
+	}
+	return strconv.ParseUint(fields[19], 10, 64)
+}
+
+// platformCmdline reads /proc/<pid>/cmdline, joining the NUL-separated arguments with spaces
+func platformCmdline(pid int) string {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return ""
+	}
+	return strings.Join(strings.Split(strings.TrimRight(string(b), "\x00"), "\x00"), " ")
+}
@@ -0,0 +1,28 @@
+//go:build !linux && !darwin
+
+package security
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func peerCredentials(fd int) (PeerInfo, error) {
+	return PeerInfo{}, fmt.Errorf("peer creds unsupported on %s", runtime.GOOS)
+}
+
+func platformExePath(pid int) string {
+	return ""
+}
+
+func platformContainer(pid int) (string, string, bool) {
+	return "", "", false
+}
+
+func processStartTime(pid int) (uint64, error) {
+	return 0, fmt.Errorf("process start time unsupported on %s", runtime.GOOS)
+}
+
+func platformCmdline(pid int) string {
+	return ""
+}
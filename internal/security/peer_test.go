@@ -1,11 +1,17 @@
 package security
 
 import (
+	"errors"
+	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestPeerInfo_String(t *testing.T) {
@@ -81,6 +87,259 @@ func TestPeerInfo_PlatformSupport(t *testing.T) {
 	}
 }
 
+func TestLazyPeer_ResolvesOnce(t *testing.T) {
+	var resolves, callbacks int32
+	lp := &LazyPeer{
+		resolve: func() (PeerInfo, error) {
+			atomic.AddInt32(&resolves, 1)
+			return PeerInfo{PID: 42, Path: "/usr/bin/example"}, nil
+		},
+		onResolve: func(PeerInfo, error) { atomic.AddInt32(&callbacks, 1) },
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pi, err := lp.Get()
+			if err != nil || pi.PID != 42 {
+				t.Errorf("Unexpected result: %v, %v", pi, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if resolves != 1 {
+		t.Errorf("Expected 1 resolution, got %d", resolves)
+	}
+	if callbacks != 1 {
+		t.Errorf("Expected 1 onResolve callback, got %d", callbacks)
+	}
+}
+
+func TestLazyPeer_NotResolvedUntilGet(t *testing.T) {
+	resolved := false
+	lp := &LazyPeer{resolve: func() (PeerInfo, error) {
+		resolved = true
+		return PeerInfo{}, errors.New("boom")
+	}}
+	if resolved {
+		t.Fatal("Expected no resolution before Get")
+	}
+	if _, err := lp.Get(); err == nil {
+		t.Error("Expected memoized error")
+	}
+	if _, err := lp.Get(); err == nil {
+		t.Error("Expected memoized error on second call")
+	}
+}
+
+// stubProcLookups replaces the platform lookups for the duration of a test
+func stubProcLookups(t *testing.T, start func(int) (uint64, error), exe func(int) string) {
+	t.Helper()
+	origStart, origExe := lookupStartTime, lookupExePath
+	lookupStartTime, lookupExePath = start, exe
+	exePathCache.reset()
+	cmdlineCache.reset()
+	t.Cleanup(func() {
+		lookupStartTime, lookupExePath = origStart, origExe
+		exePathCache.reset()
+		cmdlineCache.reset()
+	})
+}
+
+func TestExePathForPID_Memoized(t *testing.T) {
+	var lookups int
+	startTime := uint64(100)
+	stubProcLookups(t,
+		func(int) (uint64, error) { return startTime, nil },
+		func(int) string { lookups++; return "/usr/bin/client" },
+	)
+
+	for i := 0; i < 5; i++ {
+		if p := exePathForPID(1234); p != "/usr/bin/client" {
+			t.Fatalf("Unexpected path %q", p)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("Expected 1 lookup for repeated PID, got %d", lookups)
+	}
+
+	// A reused PID with a different start time must not hit the cache
+	startTime = 200
+	exePathForPID(1234)
+	if lookups != 2 {
+		t.Errorf("Expected new lookup after PID reuse, got %d lookups", lookups)
+	}
+}
+
+func TestExePathForPID_FailuresNotCached(t *testing.T) {
+	var lookups int
+	stubProcLookups(t,
+		func(int) (uint64, error) { return 1, nil },
+		func(int) string { lookups++; return "" },
+	)
+
+	exePathForPID(1234)
+	exePathForPID(1234)
+	if lookups != 2 {
+		t.Errorf("Expected failed lookups to be retried, got %d lookups", lookups)
+	}
+}
+
+func TestExePathForPID_ExpiresAfterTTL(t *testing.T) {
+	var lookups int
+	stubProcLookups(t,
+		func(int) (uint64, error) { return 1, nil },
+		func(int) string { lookups++; return "/usr/bin/client" },
+	)
+	exePathCache.ttl = 20 * time.Millisecond
+	t.Cleanup(func() { exePathCache.ttl = procCacheTTL })
+
+	exePathForPID(1234)
+	exePathForPID(1234)
+	if lookups != 1 {
+		t.Fatalf("Expected 1 lookup within TTL, got %d", lookups)
+	}
+	time.Sleep(30 * time.Millisecond)
+	exePathForPID(1234)
+	if lookups != 2 {
+		t.Errorf("Expected a new lookup after TTL, got %d lookups", lookups)
+	}
+}
+
+func TestExePathForPID_ConsistentAcrossConnections(t *testing.T) {
+	var lookups int32
+	stubProcLookups(t,
+		func(int) (uint64, error) { return 1, nil },
+		func(pid int) string { atomic.AddInt32(&lookups, 1); return fmt.Sprintf("/usr/bin/client-%d", pid) },
+	)
+
+	// Concurrent lookups (as from many short-lived connections) agree on the path
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(pid int) {
+			defer wg.Done()
+			if got, want := exePathForPID(pid), fmt.Sprintf("/usr/bin/client-%d", pid); got != want {
+				t.Errorf("Expected %q, got %q", want, got)
+			}
+		}(100 + i%2)
+	}
+	wg.Wait()
+
+	// Racing misses may each look up once, but never more than the callers
+	if n := atomic.LoadInt32(&lookups); n < 2 || n > 50 {
+		t.Errorf("Expected between 2 and 50 lookups, got %d", n)
+	}
+	before := atomic.LoadInt32(&lookups)
+	exePathForPID(100)
+	exePathForPID(101)
+	if atomic.LoadInt32(&lookups) != before {
+		t.Error("Expected warm cache to serve both PIDs")
+	}
+}
+
+func TestPeerFromUnixConn_Self(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("peer credentials unsupported on this platform")
+	}
+	server, client := unixConnPair(t)
+	defer server.Close()
+	defer client.Close()
+
+	pi, err := PeerFromUnixConn(server)
+	if err != nil {
+		t.Fatalf("PeerFromUnixConn failed: %v", err)
+	}
+	if pi.PID != os.Getpid() {
+		t.Errorf("Expected PID %d, got %d", os.Getpid(), pi.PID)
+	}
+	if pi.UID != uint32(os.Getuid()) {
+		t.Errorf("Expected UID %d, got %d", os.Getuid(), pi.UID)
+	}
+}
+
+// unixConnPair returns both ends of a connected Unix socket
+func unixConnPair(tb testing.TB) (*net.UnixConn, *net.UnixConn) {
+	tb.Helper()
+	sock := filepath.Join(tb.TempDir(), "peer.sock")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: sock, Net: "unix"})
+	if err != nil {
+		tb.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+
+	client, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: sock, Net: "unix"})
+	if err != nil {
+		tb.Fatalf("dial: %v", err)
+	}
+	server, err := l.AcceptUnix()
+	if err != nil {
+		tb.Fatalf("accept: %v", err)
+	}
+	return server, client
+}
+
+// BenchmarkConnSetup_Eager measures the old per-connection cost of resolving peer info up front
+func BenchmarkConnSetup_Eager(b *testing.B) {
+	server, client := unixConnPair(b)
+	defer server.Close()
+	defer client.Close()
+
+	for i := 0; i < b.N; i++ {
+		exePathCache.reset()
+		if _, err := PeerFromUnixConn(server); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkConnSetup_Lazy measures connection setup when peer info is never consumed
+func BenchmarkConnSetup_Lazy(b *testing.B) {
+	server, client := unixConnPair(b)
+	defer server.Close()
+	defer client.Close()
+
+	for i := 0; i < b.N; i++ {
+		_ = NewLazyPeer(server, nil)
+	}
+}
+
+// BenchmarkConnSetup_LazyResolvedCached measures resolution when the exe path is already cached
+func BenchmarkConnSetup_LazyResolvedCached(b *testing.B) {
+	server, client := unixConnPair(b)
+	defer server.Close()
+	defer client.Close()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := NewLazyPeer(server, nil).Get(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkExePathForPID_Uncached measures a /proc (or ps) lookup for every connection
+func BenchmarkExePathForPID_Uncached(b *testing.B) {
+	pid := os.Getpid()
+	for i := 0; i < b.N; i++ {
+		exePathCache.reset()
+		exePathForPID(pid)
+	}
+}
+
+// BenchmarkExePathForPID_Cached measures a lookup served from the PID+start-time cache
+func BenchmarkExePathForPID_Cached(b *testing.B) {
+	pid := os.Getpid()
+	exePathCache.reset()
+	exePathForPID(pid)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		exePathForPID(pid)
+	}
+}
+
 // Helper function for string contains check
 func contains(s, substr string) bool {
 	return len(s) > 0 && len(substr) > 0 && (s == substr || len(s) > len(substr) &&
@@ -0,0 +1,55 @@
+package server
+
+import "strings"
+
+// hasAccountFlag reports whether flags already choose a 1Password account
+func hasAccountFlag(flags []string) bool {
+	for _, f := range flags {
+		if f == "--account" || strings.HasPrefix(f, "--account=") {
+			return true
+		}
+	}
+	return false
+}
+
+// accountFlag returns the account flags choose, or ""
+func accountFlag(flags []string) string {
+	for i, f := range flags {
+		if account, ok := strings.CutPrefix(f, "--account="); ok {
+			return account
+		}
+		if f == "--account" && i+1 < len(flags) {
+			return flags[i+1]
+		}
+	}
+	return ""
+}
+
+// withVaultAccount appends --account for an op:// ref whose vault has a mapped
+// account, unless the request already passed one
+func (a *api) withVaultAccount(ref string, flags []string) []string {
+	if len(a.vaultAccounts) == 0 || hasAccountFlag(flags) {
+		return flags
+	}
+	vault, ok := opVault(ref)
+	if !ok {
+		return flags
+	}
+	account, ok := a.vaultAccounts[vault]
+	if !ok {
+		return flags
+	}
+	out := make([]string, 0, len(flags)+1)
+	out = append(out, flags...)
+	return append(out, "--account="+account)
+}
+
+// opVault returns the vault of an op:// ref
+func opVault(ref string) (string, bool) {
+	rest, ok := strings.CutPrefix(ref, "op://")
+	if !ok {
+		return "", false
+	}
+	vault, _, _ := strings.Cut(rest, "/")
+	return vault, true
+}
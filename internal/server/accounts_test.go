@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/cache"
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+// flagsBackend records the flags each ref was read with
+type flagsBackend struct {
+	mu    sync.Mutex
+	flags map[string][]string
+}
+
+func (b *flagsBackend) Name() string { return "flags" }
+
+func (b *flagsBackend) ReadRef(ctx context.Context, ref string) (string, error) {
+	return b.ReadRefWithFlags(ctx, ref, nil)
+}
+
+func (b *flagsBackend) ReadRefWithFlags(ctx context.Context, ref string, flags []string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flags[ref] = flags
+	return "value:" + strings.Join(flags, " "), nil
+}
+
+func TestWithVaultAccount(t *testing.T) {
+	a := &api{vaultAccounts: map[string]string{"Work": "acme.1password.com"}}
+
+	tests := []struct {
+		name     string
+		ref      string
+		flags    []string
+		expected []string
+	}{
+		{name: "mapped vault", ref: "op://Work/db/password", expected: []string{"--account=acme.1password.com"}},
+		{name: "mapped vault keeps other flags", ref: "op://Work/db/password", flags: []string{"--cache"}, expected: []string{"--cache", "--account=acme.1password.com"}},
+		{name: "explicit account wins", ref: "op://Work/db/password", flags: []string{"--account=my.1password.com"}, expected: []string{"--account=my.1password.com"}},
+		{name: "unmapped vault", ref: "op://Private/db/password"},
+		{name: "vault names are exact", ref: "op://work/db/password"},
+		{name: "non-op ref", ref: "vault://Work/db"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := a.withVaultAccount(tt.ref, tt.flags)
+			if len(got) == 0 && len(tt.expected) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestAccountFlag(t *testing.T) {
+	tests := []struct {
+		flags    []string
+		expected string
+	}{
+		{flags: []string{"--cache", "--account=acme.1password.com"}, expected: "acme.1password.com"},
+		{flags: []string{"--account", "my.1password.com"}, expected: "my.1password.com"},
+		{flags: []string{"--account"}},
+		{},
+	}
+	for _, tt := range tests {
+		if got := accountFlag(tt.flags); got != tt.expected {
+			t.Errorf("%v: expected %q, got %q", tt.flags, tt.expected, got)
+		}
+	}
+}
+
+func TestAPI_VaultAccountMapping(t *testing.T) {
+	be := &flagsBackend{flags: map[string][]string{}}
+	a := &api{
+		backend:       be,
+		cache:         cache.New(time.Minute),
+		vaultAccounts: map[string]string{"Work": "acme.1password.com"},
+	}
+	ctx := context.Background()
+
+	mapped, err := a.readOneWithFlags(ctx, "op://Work/db/password", nil)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if mapped.Value != "value:--account=acme.1password.com" {
+		t.Errorf("Expected the mapped account to be injected, got %q", mapped.Value)
+	}
+
+	override, err := a.readOneWithFlags(ctx, "op://Work/db/password", []string{"--account=my.1password.com"})
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if override.FromCache || override.Value != "value:--account=my.1password.com" {
+		t.Errorf("Expected an uncached read with the explicit account, got %+v", override)
+	}
+
+	again, err := a.readOneWithFlags(ctx, "op://Work/db/password", nil)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if !again.FromCache || again.Value != mapped.Value {
+		t.Errorf("Expected the mapped read to be cached separately, got %+v", again)
+	}
+}
+
+func TestAPI_ResolveRefFlags(t *testing.T) {
+	be := &flagsBackend{flags: map[string][]string{}}
+	a := &api{backend: be, cache: cache.New(time.Minute)}
+	resolve := func(req protocol.ResolveRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		a.handleResolve(w, httptest.NewRequest("POST", "/v1/resolve", strings.NewReader(string(body))))
+		return w
+	}
+
+	w := resolve(protocol.ResolveRequest{
+		Env: map[string]string{
+			"WORK_DB":   "op://Work/db/password",
+			"PERSONAL":  "op://Private/github/token",
+			"SHARED_DB": "op://Work/db/password",
+		},
+		Flags:    []string{"--account=acme.1password.com"},
+		RefFlags: map[string][]string{"op://Private/github/token": {"--account=my.1password.com"}},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the mixed-account batch to resolve, got %d %s", w.Code, w.Body.String())
+	}
+	expected := map[string][]string{
+		"op://Work/db/password":     {"--account=acme.1password.com"},
+		"op://Private/github/token": {"--account=my.1password.com"},
+	}
+	if !reflect.DeepEqual(be.flags, expected) {
+		t.Errorf("Expected each ref read with its account's flags %v, got %v", expected, be.flags)
+	}
+	var resp protocol.ResolveResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Env["PERSONAL"] != "value:--account=my.1password.com" || resp.Env["SHARED_DB"] != "value:--account=acme.1password.com" {
+		t.Errorf("Expected values from each account, got %v", resp.Env)
+	}
+
+	w = resolve(protocol.ResolveRequest{
+		Env:      map[string]string{"WORK_DB": "op://Work/db/password"},
+		RefFlags: map[string][]string{"op://Work/api/key": {"--account=acme.1password.com"}},
+	})
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "op://Work/api/key") {
+		t.Errorf("Expected 400 naming a ref_flags ref env doesn't resolve, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/zach-source/opx/internal/policy"
+)
+
+// DefaultAdminPaths allows the opx binary installed next to the running daemon
+func DefaultAdminPaths() []string {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return []string{filepath.Join(filepath.Dir(exe), "opx")}
+}
+
+// adminAllowlist is the policy's admin section, or the daemon's default paths without one
+func (a *api) adminAllowlist() policy.Admin {
+	if admin := a.currentPolicy().Admin; admin != nil {
+		return *admin
+	}
+	return policy.Admin{Paths: a.adminPaths}
+}
+
+// authAdmin guards admin endpoints: after the token, the peer must be on the
+// admin allowlist. A peer that can't be identified, or that connected over TCP,
+// is denied.
+func (a *api) authAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return a.auth(func(w http.ResponseWriter, r *http.Request) {
+		peerInfo, hasPeer := peerFromContext(r.Context())
+		allowed := hasPeer && peerInfo.CertCN == "" && a.adminAllowlist().Allows(peerInfo.Path, peerInfo.UID)
+
+		if a.audit != nil {
+			details := map[string]string{"subject_uid": fmt.Sprintf("%d", peerInfo.UID)}
+			if !hasPeer {
+				details = map[string]string{"reason": "peer information unavailable"}
+			} else if peerInfo.CertCN != "" {
+				details = map[string]string{"subject_cert_cn": peerInfo.CertCN, "reason": "admin endpoints are not served over TCP"}
+			}
+			a.audit.LogAdminDecision(requestIDFromContext(r.Context()), peerInfo, r.URL.Path, allowed, a.policyPath, details)
+		}
+		if !allowed {
+			if a.verbose {
+				log.Printf("[security] admin denied: %s -> %s", peerInfo.String(), r.URL.Path)
+			}
+			http.Error(w, "admin access denied", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
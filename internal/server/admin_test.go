@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/audit"
+	"github.com/zach-source/opx/internal/backend"
+	"github.com/zach-source/opx/internal/cache"
+	"github.com/zach-source/opx/internal/policy"
+	"github.com/zach-source/opx/internal/safestring"
+	"github.com/zach-source/opx/internal/security"
+)
+
+func TestAPI_AuthAdmin(t *testing.T) {
+	opx := security.PeerInfo{PID: 7, UID: 1000, Path: "/usr/local/bin/opx"}
+	other := security.PeerInfo{PID: 8, UID: 1000, Path: "/usr/bin/tool"}
+	root := security.PeerInfo{PID: 9, UID: 0, Path: "/usr/bin/tool"}
+
+	tests := []struct {
+		name   string
+		policy policy.Policy
+		peer   *security.PeerInfo
+		code   int
+	}{
+		{name: "default path allowed", peer: &opx, code: http.StatusOK},
+		{name: "other binary denied", peer: &other, code: http.StatusForbidden},
+		{name: "no peer info denied", code: http.StatusForbidden},
+		{name: "policy uid allowed", policy: policy.Policy{Admin: &policy.Admin{UIDs: []uint32{0}}}, peer: &root, code: http.StatusOK},
+		{name: "policy replaces default paths", policy: policy.Policy{Admin: &policy.Admin{UIDs: []uint32{0}}}, peer: &opx, code: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &api{
+				token:      safestring.New("tok"),
+				backend:    backend.Fake{},
+				cache:      cache.New(5 * time.Minute),
+				policy:     tt.policy,
+				adminPaths: []string{opx.Path},
+			}
+			req := httptest.NewRequest("POST", "/v1/cache/delete", strings.NewReader(`{"ref":"op://v/i/f"}`))
+			req.Header.Set("X-OpAuthd-Token", "tok")
+			if tt.peer != nil {
+				req = req.WithContext(context.WithValue(req.Context(), peerInfoKey, *tt.peer))
+			}
+			w := httptest.NewRecorder()
+			a.handler().ServeHTTP(w, req)
+			if w.Code != tt.code {
+				t.Errorf("Expected status %d, got %d: %s", tt.code, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAPI_AuthAdminAudit(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	logger, err := audit.NewLoggerWithConfig(true, audit.RollerConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create audit logger: %v", err)
+	}
+	defer logger.Close()
+	sub := logger.Subscribe(4)
+	defer logger.Unsubscribe(sub)
+
+	a := &api{
+		token:   safestring.New("tok"),
+		backend: backend.Fake{},
+		cache:   cache.New(5 * time.Minute),
+		audit:   logger,
+	}
+	peer := security.PeerInfo{PID: 7, UID: 1000, Path: "/usr/bin/tool"}
+	req := httptest.NewRequest("POST", "/v1/cache/delete", strings.NewReader(`{"ref":"op://v/i/f"}`))
+	req.Header.Set("X-OpAuthd-Token", "tok")
+	req = req.WithContext(context.WithValue(req.Context(), peerInfoKey, peer))
+	w := httptest.NewRecorder()
+	a.handler().ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected status 403, got %d", w.Code)
+	}
+
+	select {
+	case event := <-sub.C:
+		if event.Event != "ADMIN_ACCESS" || event.Decision != "DENY" || event.Reference != "/v1/cache/delete" {
+			t.Errorf("Unexpected event: %+v", event)
+		}
+		if event.Details["subject_uid"] != "1000" {
+			t.Errorf("Expected subject_uid 1000, got %q", event.Details["subject_uid"])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected an ADMIN_ACCESS audit event")
+	}
+}
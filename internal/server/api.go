@@ -0,0 +1,1465 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/zach-source/opx/internal/audit"
+	"github.com/zach-source/opx/internal/backend"
+	"github.com/zach-source/opx/internal/cache"
+	"github.com/zach-source/opx/internal/policy"
+	"github.com/zach-source/opx/internal/protocol"
+	"github.com/zach-source/opx/internal/safestring"
+	"github.com/zach-source/opx/internal/security"
+	"github.com/zach-source/opx/internal/session"
+	"github.com/zach-source/opx/internal/util"
+)
+
+// SecretCache is the cache surface the API reads through; *cache.Cache implements it
+type SecretCache interface {
+	GetMeta(key string) (string, cache.Meta, bool)
+	Checksum(key string) (string, bool)
+	Set(key, val string) error
+	SetFrom(key, val string, src cache.Source) error
+	Refresh(key, val string) (refreshed, changed bool)
+	Has(key string) bool
+	HotKeys(accessedSince, expiresBefore time.Time, limit int) []string
+	Expiring(expiresBefore time.Time) []cache.ExpiringEntry
+	RemovePrefix(prefix string) int
+	SoftDelete(key string, tombstoneTTL time.Duration)
+	Tombstoned(key string) bool
+	Stats() (size int, hits, misses int64, inflight int)
+	ValueStats() (largest int, total int64)
+	MaxValueBytes() int64
+	ExpiryStats() (expiredHits, cleanupRemoved int64, lastCleanup time.Time)
+	IncHit()
+	IncMiss()
+	IncInFlight()
+	DecInFlight()
+	TTL() time.Duration
+}
+
+// SessionManager is the session surface used by the API; *session.Manager implements it
+type SessionManager interface {
+	GetInfo() session.SessionInfo
+	ValidateSession(ctx context.Context) error
+	Touch() bool
+	WaitForChange(ctx context.Context, since uint64) session.SessionInfo
+	SetIdleTimeout(d time.Duration)
+}
+
+// AuditSink records access decisions and streams events; *audit.Logger implements it
+type AuditSink interface {
+	Enabled() bool
+	LogAccessDecisionForRequest(requestID string, peerInfo security.PeerInfo, reference, action string, allowed bool, policyPath string, details map[string]string)
+	LogResolve(requestID, operationID string, peerInfo security.PeerInfo, env map[string]string, failed string)
+	LogAdminDecision(requestID string, peerInfo security.PeerInfo, endpoint string, allowed bool, policyPath string, details map[string]string)
+	LogPeerUnavailable(requestID, endpoint, policyPath string)
+	LogSecretChanged(reference string, details map[string]string)
+	LogAuditUnavailable(requestID string, peerInfo security.PeerInfo, reference string) error
+	Health() audit.Health
+	Subscribe(buffer int) *audit.Subscription
+	Unsubscribe(sub *audit.Subscription)
+}
+
+// api serves the /v1 endpoints. Server owns the socket, TLS and daemon lifecycle and mounts it.
+type api struct {
+	token      *safestring.SafeString
+	cache      SecretCache
+	backend    backend.Backend
+	session    SessionManager // nil when session management is disabled
+	audit      AuditSink      // nil when audit logging is disabled
+	policy     policy.Policy  // read through currentPolicy; /v1/policy/reload replaces it
+	policyPath string
+	sockPath   string
+	verbose    bool
+	// refreshInterval and refreshMaxEntries configure the hot-entry refresher (see Server)
+	refreshInterval   time.Duration
+	refreshMaxEntries int
+	compressMinBytes  int
+	// maxRequestBytes bounds JSON request bodies; 0 uses defaultMaxRequestBytes
+	maxRequestBytes int64
+	// maxRefsPerRequest bounds the refs of a batch; 0 uses defaultMaxRefsPerRequest
+	maxRefsPerRequest int
+	// Per-handler ceilings; 0 leaves the request bounded only by the client
+	readTimeout    time.Duration
+	readsTimeout   time.Duration
+	resolveTimeout time.Duration
+	// backendReadTimeout bounds a backend read shared through singleflight, independent
+	// of the caller that started it; 0 leaves it unbounded
+	backendReadTimeout time.Duration
+	// clock overrides time.Now for TTL and timestamp fields in tests
+	clock func() time.Time
+	// allowDebug lets requests with the debug header see underlying error details
+	allowDebug bool
+	// accessLog collapses repeated verbose access-decision lines; nil logs every line
+	accessLog *logThrottle
+	// vaultAccounts maps op:// vault names to the --account their reads use
+	vaultAccounts map[string]string
+	// expandRefVars fills ${VAR} in refs from a request's vars
+	expandRefVars bool
+	// allowedOpFlags are the op flag names requests may pass (nil = DefaultAllowedOpFlags)
+	allowedOpFlags []string
+	// adminPaths may call admin endpoints when the policy has no admin section
+	adminPaths []string
+	// peerInfoRequired overrides whether policy endpoints reject unidentified peers; nil follows default_deny
+	peerInfoRequired *bool
+	// breakdown counts reads per scheme and vault for status; nil tracks nothing
+	breakdown *breakdown
+	// recentRefs remembers refs read successfully for completion; nil keeps no history
+	recentRefs *recentRefs
+	// approvals holds requests require_approval rules park; nil denies them outright
+	approvals *approvals
+	// quotas counts reads under max_reads rules; nil enforces no quotas
+	quotas *quotas
+	// policyDefaultDeny, when set, overrides default_deny in a reloaded policy
+	policyDefaultDeny *bool
+	policyMu          sync.RWMutex
+	// startedAt is when the daemon began serving; zero leaves uptime out of status
+	startedAt time.Time
+	// denialMessage is the hint for denials neither a rule nor the policy has a message for
+	denialMessage string
+	// auditRequired refuses reads while audit events can't be written
+	auditRequired bool
+
+	sf singleflight.Group
+	mu sync.Mutex
+	// refreshSources maps cache keys to the request that produced them (guarded by mu)
+	refreshSources map[string]refreshSource
+	// sourcesPruneAt is the size at which refreshSources next drops keys that left the cache
+	sourcesPruneAt int
+}
+
+// now returns the current time from clock, or time.Now when unset
+func (a *api) now() time.Time {
+	if a.clock != nil {
+		return a.clock()
+	}
+	return time.Now()
+}
+
+// currentPolicy returns the access policy in effect
+func (a *api) currentPolicy() policy.Policy {
+	a.policyMu.RLock()
+	defer a.policyMu.RUnlock()
+	return a.policy
+}
+
+// setPolicy replaces the access policy for requests that start after it returns
+func (a *api) setPolicy(pol policy.Policy) {
+	a.policyMu.Lock()
+	defer a.policyMu.Unlock()
+	a.policy = pol
+}
+
+// withTimeout bounds ctx by d, or only makes it cancellable when d is 0
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// handler routes the /v1 endpoints through auth, policy and compression middleware
+func (a *api) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/readyz", handleReadyz)
+	mux.HandleFunc("/v1/status", a.auth(a.handleStatus))
+	mux.HandleFunc("/v1/read", a.authWithPolicy(a.compress(a.timed(a.handleRead))))
+	mux.HandleFunc("/v1/reads", a.authWithPolicy(a.compress(a.timed(a.handleReads))))
+	mux.HandleFunc("/v1/resolve", a.authWithPolicy(a.compress(a.timed(a.handleResolve))))
+	mux.HandleFunc("/v1/session/unlock", a.auth(a.handleSessionUnlock))
+	mux.HandleFunc("/v1/session/touch", a.auth(a.handleSessionTouch))
+	mux.HandleFunc("/v1/session/events", a.auth(a.handleSessionEvents))
+	mux.HandleFunc("/v1/session/reload", a.authAdmin(a.handleSessionReload))
+	mux.HandleFunc("/v1/audit/stream", a.auth(a.handleAuditStream))
+	mux.HandleFunc("/v1/cache/delete", a.authAdmin(a.handleCacheDelete))
+	mux.HandleFunc("/v1/policy/explain", a.authAdmin(a.handlePolicyExplain))
+	mux.HandleFunc("/v1/policy/reload", a.authAdmin(a.handlePolicyReload))
+	mux.HandleFunc("/v1/policy/usage", a.authAdmin(a.handlePolicyUsage))
+	mux.HandleFunc("/v1/cache/expiring", a.authWithPolicy(a.handleCacheExpiring))
+	mux.HandleFunc("/v1/cache/refresh", a.authWithPolicy(a.handleCacheRefresh))
+	mux.HandleFunc("/v1/create", a.authWithPolicy(a.handleCreate))
+	mux.HandleFunc("/v1/refs/recent", a.authWithPolicy(a.handleRecentRefs))
+	mux.HandleFunc("/v1/approvals", a.authAdmin(a.handleApprovals))
+	mux.HandleFunc("/v1/approvals/decide", a.authAdmin(a.handleApprovalDecide))
+	return mux
+}
+
+// peerFromContext returns the peer information for a request, resolving it if necessary
+func peerFromContext(ctx context.Context) (security.PeerInfo, bool) {
+	switch v := ctx.Value(peerInfoKey).(type) {
+	case *security.LazyPeer:
+		peerInfo, err := v.Get()
+		return peerInfo, err == nil
+	case security.PeerInfo:
+		return v, true
+	}
+	return security.PeerInfo{}, false
+}
+
+// needsPeerInfo reports whether policy or audit logging will consume peer information
+func (a *api) needsPeerInfo() bool {
+	pol := a.currentPolicy()
+	return len(pol.Allow) > 0 || pol.DefaultDeny || (a.audit != nil && a.audit.Enabled())
+}
+
+func (a *api) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tok := r.Header.Get("X-OpAuthd-Token")
+		if tok == "" || !a.token.EqualString(tok) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("unauthorized"))
+			return
+		}
+		id := newRequestID()
+		w.Header().Set("X-Request-ID", id)
+		next(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	}
+}
+
+// requestIDKey holds the per-request ID echoed in X-Request-ID and audit events
+const requestIDKey = contextKey("requestID")
+
+// newRequestID returns a short random ID for correlating a request with its audit events
+func newRequestID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// requestIDFromContext returns the ID assigned by auth, or "" outside a request
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// operationIDKey holds the ID shared by the audit events of one /v1/resolve
+const operationIDKey = contextKey("operationID")
+
+// logAccessDecision audits a decision, tagged with the request and, inside a
+// resolve, the operation it belongs to
+func (a *api) logAccessDecision(ctx context.Context, peerInfo security.PeerInfo, ref, action string, allowed bool, details map[string]string) {
+	if id, _ := ctx.Value(operationIDKey).(string); id != "" {
+		details[audit.OperationIDDetail] = id
+	}
+	a.audit.LogAccessDecisionForRequest(requestIDFromContext(ctx), peerInfo, ref, action, allowed, a.policyPath, details)
+}
+
+// authWithPolicy combines token auth with policy-based access control.
+// Policy is evaluated per reference in readOneWithFlags, which resolves peer info on demand;
+// when peer info is required, a caller that can't be identified is rejected up front.
+func (a *api) authWithPolicy(next http.HandlerFunc) http.HandlerFunc {
+	return a.auth(func(w http.ResponseWriter, r *http.Request) {
+		if a.requirePeerInfo() {
+			if _, hasPeer := peerFromContext(r.Context()); !hasPeer {
+				if a.audit != nil {
+					a.audit.LogPeerUnavailable(requestIDFromContext(r.Context()), r.URL.Path, a.policyPath)
+				}
+				if a.verbose {
+					log.Printf("[security] denied %s: no peer information available", r.URL.Path)
+				}
+				writeCodedError(w, http.StatusForbidden, protocol.ErrCodePeerUnavailable, "peer information unavailable")
+				return
+			}
+		}
+		next(w, r)
+	})
+}
+
+// requirePeerInfo reports whether policy endpoints reject callers without peer
+// information; by default they do under a default_deny policy
+func (a *api) requirePeerInfo() bool {
+	return a.currentPolicy().RequiresPeerInfo(a.peerInfoRequired)
+}
+
+// subjectOf is the policy subject for a peer, including where it runs in a container
+func subjectOf(peerInfo security.PeerInfo) policy.Subject {
+	return policy.Subject{
+		PID:           peerInfo.PID,
+		Path:          peerInfo.Path,
+		ContainerPath: peerInfo.ContainerPath,
+		ContainerID:   peerInfo.ContainerID,
+		CertCN:        peerInfo.CertCN,
+	}
+}
+
+// validateAccess checks if peer is allowed to perform action on the given reference
+func (a *api) validateAccess(ctx context.Context, peerInfo security.PeerInfo, ref, action string) policy.Decision {
+	subject := subjectOf(peerInfo)
+
+	explanation := policy.ExplainAt(a.currentPolicy(), subject, ref, action, a.now())
+	decision := explanation.Decision
+	allowed := decision.Allowed
+	if !allowed && decision.Message == "" {
+		decision.Message = a.denialMessage
+	}
+
+	// Audit log the access decision
+	if a.audit != nil {
+		details := map[string]string{
+			"subject_pid":  fmt.Sprintf("%d", subject.PID),
+			"subject_path": subject.Path,
+		}
+		if subject.CertCN != "" {
+			details["subject_cert_cn"] = subject.CertCN
+		}
+		if rule := explanation.MatchedRule(); rule > 0 {
+			details["matched_rule"] = strconv.Itoa(rule)
+		}
+		if decision.Message != "" {
+			details["deny_message"] = decision.Message
+		}
+		if explanation.OutsideWindow {
+			details["deny_reason"] = "schedule"
+		}
+		if decision.RequireApproval {
+			details["require_approval"] = "true"
+		}
+		a.logAccessDecision(ctx, peerInfo, ref, action, allowed, details)
+	}
+
+	if a.verbose {
+		verdict := "granted"
+		if !allowed {
+			verdict = "denied"
+		}
+		line := fmt.Sprintf("[security] %s %s: %s -> %s", action, verdict, peerInfo.String(), ref)
+		if a.accessLog != nil {
+			a.accessLog.Log(line)
+		} else {
+			log.Printf("%s", line)
+		}
+	}
+
+	return decision
+}
+
+// handleReadyz answers without a token so clients can tell which socket has a live daemon
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok\n"))
+}
+
+func (a *api) handleStatus(w http.ResponseWriter, r *http.Request) {
+	size, hits, misses, inflight := a.cache.Stats()
+	expiredHits, cleanupRemoved, lastCleanup := a.cache.ExpiryStats()
+	resp := protocol.Status{
+		Backend:             a.backend.Name(),
+		CacheSize:           size,
+		Hits:                hits,
+		Misses:              misses,
+		InFlight:            inflight,
+		ExpiredHits:         expiredHits,
+		CleanupRemovedTotal: cleanupRemoved,
+		TTLSeconds:          int(a.cache.TTL().Seconds()),
+		SocketPath:          a.sockPath,
+		Breakdown:           a.breakdown.snapshot(),
+		MaxValueBytes:       a.cache.MaxValueBytes(),
+	}
+	resp.LargestValueBytes, resp.CacheBytes = a.cache.ValueStats()
+	if !lastCleanup.IsZero() {
+		resp.LastCleanupAt = lastCleanup.Unix()
+	}
+	if a.audit != nil && a.audit.Enabled() {
+		h := a.audit.Health()
+		resp.Audit = &protocol.AuditStatus{Required: a.auditRequired, Failing: h.Failing, DroppedEvents: h.Dropped, LastError: h.LastError}
+	}
+	if !a.startedAt.IsZero() {
+		resp.StartedAt = a.startedAt.Unix()
+		resp.UptimeSeconds = int64(max(0, a.now().Sub(a.startedAt)).Seconds())
+	}
+
+	if multi, ok := backend.As[*backend.MultiBackend](a.backend); ok {
+		resp.Backends = backendStatuses(r.Context(), multi, r.URL.Query().Get("probe") == "1")
+	}
+
+	// Add session information if session manager is available
+	if a.session != nil {
+		sessionInfo := a.session.GetInfo()
+		resp.Session = &protocol.SessionStatus{
+			State:         sessionInfo.State.String(),
+			IdleTimeout:   int(sessionInfo.IdleTimeout.Seconds()),
+			TimeUntilLock: int(sessionInfo.TimeUntilLock().Seconds()),
+			Enabled:       sessionInfo.IdleTimeout > 0,
+			LockReason:    sessionInfo.LockReason,
+		}
+		if acct := sessionInfo.Account; acct != (session.Account{}) {
+			resp.Session.Account = &protocol.SessionAccount{UUID: acct.UUID, Email: acct.Email, URL: acct.URL}
+		}
+	}
+
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// backendProbeTimeout bounds each sub-backend health check in a status probe
+const backendProbeTimeout = 2 * time.Second
+
+// backendStatuses describes the sub-backends of multi, checking reachability when probe is set
+func backendStatuses(ctx context.Context, multi *backend.MultiBackend, probe bool) []protocol.BackendStatus {
+	var out []protocol.BackendStatus
+	for _, sub := range multi.Backends() {
+		st := protocol.BackendStatus{Scheme: sub.Scheme, Default: sub.Default}
+		if sub.Backend != nil {
+			st.Name = sub.Backend.Name()
+		}
+		if probe {
+			switch pinger, ok := sub.Backend.(backend.Pinger); {
+			case sub.Backend == nil:
+				st.Health = protocol.HealthUnconfigured
+			case !ok:
+				st.Health = protocol.HealthUnknown
+			default:
+				pctx, cancel := context.WithTimeout(ctx, backendProbeTimeout)
+				if err := pinger.Ping(pctx); err != nil {
+					st.Health = protocol.HealthError
+					st.Error = err.Error()
+				} else {
+					st.Health = protocol.HealthOK
+				}
+				cancel()
+			}
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+func (a *api) handleSessionUnlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if a.session == nil {
+		resp := protocol.SessionUnlockResponse{
+			Success: false,
+			State:   "disabled",
+			Message: "Session management is disabled",
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	// Attempt to validate/unlock the session
+	err := a.session.ValidateSession(r.Context())
+	sessionInfo := a.session.GetInfo()
+
+	resp := protocol.SessionUnlockResponse{
+		Success: err == nil,
+		State:   sessionInfo.State.String(),
+	}
+
+	if err != nil {
+		// 423 rather than 401, which clients take to mean their token was rejected
+		resp.Message = fmt.Sprintf("Session unlock failed: %v", err)
+		w.WriteHeader(http.StatusLocked)
+	} else {
+		resp.Message = "Session unlocked successfully"
+	}
+
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// handleSessionTouch extends an authenticated session's idle timer. It never unlocks a locked session.
+func (a *api) handleSessionTouch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if a.session == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(protocol.SessionTouchResponse{Success: false, State: "disabled"})
+		return
+	}
+
+	touched := a.session.Touch()
+	sessionInfo := a.session.GetInfo()
+	resp := protocol.SessionTouchResponse{
+		Success:       touched,
+		State:         sessionInfo.State.String(),
+		TimeUntilLock: int(sessionInfo.TimeUntilLock().Seconds()),
+	}
+	if !touched {
+		w.WriteHeader(http.StatusConflict)
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// handleSessionReload re-reads the session config file and applies its idle timeout
+func (a *api) handleSessionReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if a.session == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(protocol.SessionReloadResponse{Message: "Session management is disabled"})
+		return
+	}
+
+	cfg, err := session.LoadConfig()
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_ = json.NewEncoder(w).Encode(protocol.SessionReloadResponse{Message: fmt.Sprintf("Session config not reloaded: %v", err)})
+		return
+	}
+	a.session.SetIdleTimeout(cfg.SessionIdleTimeout)
+	_ = json.NewEncoder(w).Encode(protocol.SessionReloadResponse{
+		Success:     true,
+		IdleTimeout: int(cfg.SessionIdleTimeout.Seconds()),
+	})
+}
+
+// Long-poll bounds for /v1/session/events
+const (
+	defaultSessionEventsTimeout = 30 * time.Second
+	maxSessionEventsTimeout     = 5 * time.Minute
+)
+
+// handleSessionEvents long-polls for a session state change. Without since it
+// returns the current state at once; with since it waits until the sequence
+// moves past it or timeout (default 30s) elapses.
+func (a *api) handleSessionEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.session == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(protocol.SessionEventResponse{State: "disabled"})
+		return
+	}
+
+	timeout := defaultSessionEventsTimeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "timeout must be a positive duration", http.StatusBadRequest)
+			return
+		}
+		timeout = min(d, maxSessionEventsTimeout)
+	}
+
+	var info session.SessionInfo
+	changed := false
+	if v := r.URL.Query().Get("since"); v != "" {
+		since, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			http.Error(w, "since must be a sequence number", http.StatusBadRequest)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		info = a.session.WaitForChange(ctx, since)
+		changed = info.Seq != since
+	} else {
+		info = a.session.GetInfo()
+	}
+
+	_ = json.NewEncoder(w).Encode(protocol.SessionEventResponse{
+		Seq:           info.Seq,
+		State:         info.State.String(),
+		Changed:       changed,
+		TimeUntilLock: int(info.TimeUntilLock().Seconds()),
+	})
+}
+
+// handleAuditStream streams audit events as newline-delimited JSON until the client disconnects
+func (a *api) handleAuditStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var sub *audit.Subscription
+	if a.audit != nil {
+		sub = a.audit.Subscribe(64)
+	}
+	if sub == nil {
+		http.Error(w, "audit logging disabled (start opx-authd with --enable-audit-log)", http.StatusServiceUnavailable)
+		return
+	}
+	defer a.audit.Unsubscribe(sub)
+
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				// Dropped for falling behind
+				return
+			}
+			if err := enc.Encode(event); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// defaultMaxRequestBytes bounds request bodies when maxRequestBytes is unset
+const defaultMaxRequestBytes = 1 << 20
+
+// defaultMaxValueBytes bounds cached secret values when Server.MaxValueBytes is unset
+const defaultMaxValueBytes = 1 << 20
+
+// decodeJSON decodes a request body of at most maxRequestBytes into v, replying
+// 413 when it is larger and 400 when it isn't valid JSON
+func (a *api) decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	limit := a.maxRequestBytes
+	if limit <= 0 {
+		limit = defaultMaxRequestBytes
+	}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit)).Decode(v)
+	if err == nil {
+		return true
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("request body larger than %d bytes", limit), http.StatusRequestEntityTooLarge)
+		return false
+	}
+	http.Error(w, "bad json", http.StatusBadRequest)
+	return false
+}
+
+// defaultMaxRefsPerRequest bounds batch sizes when maxRefsPerRequest is unset
+const defaultMaxRefsPerRequest = 1000
+
+// allowRefCount rejects a batch of n refs over maxRefsPerRequest with 400
+// before any backend work starts
+func (a *api) allowRefCount(w http.ResponseWriter, n int) bool {
+	limit := a.maxRefsPerRequest
+	if limit <= 0 {
+		limit = defaultMaxRefsPerRequest
+	}
+	if n > limit {
+		http.Error(w, fmt.Sprintf("too many refs: %d is over the daemon's max_refs_per_request of %d", n, limit), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (a *api) handleRead(w http.ResponseWriter, r *http.Request) {
+	var req protocol.ReadRequest
+	if !a.decodeJSON(w, r, &req) {
+		return
+	}
+	ref := strings.TrimSpace(req.Ref)
+	if ref == "" {
+		http.Error(w, "ref required", http.StatusBadRequest)
+		return
+	}
+	if !a.allowVars(w, req.Vars) || !a.allowFlags(w, req.Flags) {
+		return
+	}
+	ref, err := a.expandRef(ref, req.Vars)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !protocol.ValidSecretType(req.SecretType) {
+		http.Error(w, "unknown secret_type", http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := withTimeout(backend.WithSecretType(r.Context(), req.SecretType), a.readTimeout)
+	defer cancel()
+	rr, err := a.readOneWithFlags(ctx, ref, req.Flags)
+	if err != nil {
+		if a.verbose {
+			log.Printf("read error for ref %q: %v", ref, err)
+		}
+		a.writeReadError(w, r, "", err)
+		return
+	}
+	if req.IncludeChecksum || req.ChecksumOnly {
+		a.addChecksum(ctx, &rr, req.Flags, req.ChecksumOnly)
+	}
+	_ = json.NewEncoder(w).Encode(rr)
+}
+
+func (a *api) handleReads(w http.ResponseWriter, r *http.Request) {
+	var req protocol.ReadsRequest
+	if !a.decodeJSON(w, r, &req) || !a.allowRefCount(w, len(req.Refs)) {
+		return
+	}
+	if !a.allowVars(w, req.Vars) || !a.allowFlags(w, req.Flags) {
+		return
+	}
+	ctx, cancel := withTimeout(r.Context(), a.readsTimeout)
+	defer cancel()
+	result := make(map[string]protocol.ReadResponse, len(req.Refs))
+
+	// Results stay keyed by the ref as sent; everything else sees the expanded ref.
+	// Access is checked for every ref before any is read, so approvals, quotas
+	// and audit_required cover refs read together with others of their item.
+	expanded := make(map[string]string, len(req.Refs))
+	refused := make(map[string]error)
+	var toRead []string
+	for _, ref := range req.Refs {
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			continue
+		}
+		exp, err := a.expandRef(ref, req.Vars)
+		if err != nil {
+			result[ref] = protocol.ReadResponse{Ref: ref, Value: "ERROR: " + err.Error(), Error: err.Error(), ResolvedAt: a.now().Unix()}
+			continue
+		}
+		if err := a.checkReadAccess(ctx, exp); err != nil {
+			refused[ref] = err
+			continue
+		}
+		expanded[ref] = exp
+		toRead = append(toRead, exp)
+	}
+	prefetched := a.prefetchItems(ctx, toRead, req.Flags)
+	for _, ref := range req.Refs {
+		ref = strings.TrimSpace(ref)
+		var rr protocol.ReadResponse
+		err, isRefused := refused[ref]
+		if !isRefused {
+			exp, ok := expanded[ref]
+			if !ok {
+				continue
+			}
+			if p, ok := prefetched[exp]; ok {
+				rr, err = p.rr, p.err
+			} else {
+				rr, err = a.readAllowed(ctx, exp, req.Flags)
+			}
+		}
+		if err != nil {
+			if a.verbose {
+				log.Printf("batch read error for ref %q: %v", ref, err)
+			}
+			// The batch deadline applies to every remaining ref, so fail it as a whole
+			if errors.Is(err, context.DeadlineExceeded) {
+				writeDeadlineError(w)
+				return
+			}
+			// record the error in Error, and in Value for older clients; caller decides
+			msg := a.errorDetail(r, "failed to read secret", err)
+			if errors.Is(err, cache.ErrTombstone) {
+				msg = "ref has been deleted"
+			}
+			if errors.Is(err, errAccessDenied) || errors.Is(err, errApprovalRequired) || errors.Is(err, backend.ErrNoBackend) || errors.Is(err, cache.ErrValueTooLarge) {
+				msg = err.Error()
+			}
+			result[ref] = protocol.ReadResponse{Ref: ref, Value: "ERROR: " + msg, Error: msg, FromCache: false, ExpiresIn: 0, ResolvedAt: a.now().Unix()}
+			continue
+		}
+		if req.IncludeChecksum || req.ChecksumOnly {
+			a.addChecksum(ctx, &rr, req.Flags, req.ChecksumOnly)
+		}
+		result[ref] = rr
+	}
+	if a.verbose {
+		fromCache := util.ReduceMap(result, 0, func(acc int, _ string, rr protocol.ReadResponse) int {
+			if rr.FromCache {
+				acc++
+			}
+			return acc
+		})
+		log.Printf("batch read: %d refs, %d from cache", len(result), fromCache)
+	}
+	_ = json.NewEncoder(w).Encode(protocol.ReadsResponse{Results: result})
+}
+
+func (a *api) handleResolve(w http.ResponseWriter, r *http.Request) {
+	var req protocol.ResolveRequest
+	if !a.decodeJSON(w, r, &req) || !a.allowRefCount(w, len(req.Env)) {
+		return
+	}
+	if !a.allowVars(w, req.Vars) || !a.allowFlags(w, req.Flags) {
+		return
+	}
+	resolved := make(map[string]bool, len(req.Env))
+	for _, ref := range req.Env {
+		resolved[ref] = true
+	}
+	for ref, refFlags := range req.RefFlags {
+		if !resolved[ref] {
+			http.Error(w, fmt.Sprintf("ref_flags names %q, which env does not resolve", ref), http.StatusBadRequest)
+			return
+		}
+		if !a.allowFlags(w, refFlags) {
+			return
+		}
+	}
+	// Expand every ref before reading any, so a missing variable fails the request up front
+	refs := make(map[string]string, len(req.Env))
+	flags := make(map[string][]string, len(req.Env))
+	for name, ref := range req.Env {
+		exp, err := a.expandRef(ref, req.Vars)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("resolve %s: %v", name, err), http.StatusBadRequest)
+			return
+		}
+		refs[name] = exp
+		flags[name] = req.FlagsFor(ref)
+	}
+	// Every read's audit event carries the operation ID, as does the RESOLVE summary
+	opID := newRequestID()
+	w.Header().Set("X-Operation-ID", opID)
+	ctx, cancel := withTimeout(context.WithValue(r.Context(), operationIDKey, opID), a.resolveTimeout)
+	defer cancel()
+	out := make(map[string]string, len(req.Env))
+	var meta map[string]protocol.ResolveMeta
+	if req.IncludeMeta {
+		meta = make(map[string]protocol.ResolveMeta, len(req.Env))
+	}
+	var checksums map[string]string
+	if req.IncludeChecksum || req.ChecksumOnly {
+		checksums = make(map[string]string, len(req.Env))
+	}
+	results := a.readConcurrently(ctx, refs, flags)
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	failed := ""
+	for _, name := range names {
+		if results[name].err != nil {
+			failed = name
+			break
+		}
+	}
+	if a.audit != nil {
+		peerInfo, _ := peerFromContext(r.Context())
+		a.audit.LogResolve(requestIDFromContext(r.Context()), opID, peerInfo, refs, failed)
+	}
+	for _, name := range names {
+		rr, err := results[name].rr, results[name].err
+		if err != nil {
+			if a.verbose {
+				log.Printf("resolve error for %s (ref %q): %v", name, refs[name], err)
+			}
+			a.writeReadError(w, r, fmt.Sprintf("resolve %s: ", name), err)
+			return
+		}
+		if checksums != nil {
+			checksums[name] = a.valueChecksum(ctx, refs[name], flags[name], rr.Value)
+		}
+		if !req.ChecksumOnly {
+			out[name] = rr.Value
+		}
+		if meta != nil {
+			meta[name] = protocol.ResolveMeta{FromCache: rr.FromCache, ExpiresIn: rr.ExpiresIn, ResolvedAt: rr.ResolvedAt, Backend: a.backendLabel(refs[name])}
+		}
+	}
+	_ = json.NewEncoder(w).Encode(protocol.ResolveResponse{Env: out, Meta: meta, ValueSHA256: checksums})
+}
+
+// resolveConcurrency bounds the backend reads a single /v1/resolve runs at once
+const resolveConcurrency = 8
+
+// readResult is the outcome of one read in a concurrent batch
+type readResult struct {
+	rr  protocol.ReadResponse
+	err error
+}
+
+// readConcurrently reads every ref of a NAME -> REF map at once, each with the
+// op flags given for its name, at most resolveConcurrency at a time, so a
+// resolve costs about one backend round trip
+func (a *api) readConcurrently(ctx context.Context, refs map[string]string, flags map[string][]string) map[string]readResult {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]readResult, len(refs))
+	)
+	sem := make(chan struct{}, resolveConcurrency)
+	for name, ref := range refs {
+		wg.Add(1)
+		go func(name, ref string) {
+			defer wg.Done()
+			waitStart := time.Now()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			timingFromContext(ctx).addQueue(waitStart)
+
+			rr, err := a.readOneWithFlags(ctx, ref, flags[name])
+			mu.Lock()
+			defer mu.Unlock()
+			results[name] = readResult{rr: rr, err: err}
+		}(name, ref)
+	}
+	wg.Wait()
+	return results
+}
+
+// errorDetail returns msg, with err appended when both the daemon allows debug
+// output and the request asked for it
+func (a *api) errorDetail(r *http.Request, msg string, err error) string {
+	if !a.allowDebug || r.Header.Get(protocol.DebugHeader) != "1" {
+		return msg
+	}
+	return msg + ": " + err.Error()
+}
+
+// backendLabel names the backend serving ref, narrowing a multi backend to the ref's scheme
+func (a *api) backendLabel(ref string) string {
+	name := a.backend.Name()
+	if _, ok := backend.As[*backend.MultiBackend](a.backend); ok {
+		if scheme, _, found := strings.Cut(ref, "://"); found {
+			return scheme
+		}
+	}
+	return name
+}
+
+// handleCacheDelete zeroes cached values for a ref and optionally tombstones it
+func (a *api) handleCacheDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req protocol.CacheDeleteRequest
+	if !a.decodeJSON(w, r, &req) {
+		return
+	}
+	ref := strings.TrimSpace(req.Ref)
+	if ref == "" {
+		http.Error(w, "ref required", http.StatusBadRequest)
+		return
+	}
+	if req.TombstoneSeconds < 0 {
+		http.Error(w, "tombstone_seconds cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	// Only peers allowed to read a ref may delete it
+	if a.needsPeerInfo() {
+		if peerInfo, hasPeer := peerFromContext(r.Context()); hasPeer {
+			if d := a.validateAccess(r.Context(), peerInfo, ref, policy.ActionRead); !d.Allowed {
+				writeDenialError(w, "", &policyDenial{ref: ref, hint: d.Message})
+				return
+			}
+		}
+	}
+
+	// Drop type- and flag-scoped variants, then tombstone the ref itself
+	removed := a.cache.RemovePrefix(ref + "|")
+	if a.cache.Has(ref) {
+		removed++
+	}
+	a.cache.SoftDelete(ref, time.Duration(req.TombstoneSeconds)*time.Second)
+
+	if a.verbose {
+		log.Printf("cache delete: ref %q removed=%d tombstone=%ds", ref, removed, req.TombstoneSeconds)
+	}
+
+	_ = json.NewEncoder(w).Encode(protocol.CacheDeleteResponse{
+		Ref:              ref,
+		Removed:          removed,
+		TombstoneSeconds: req.TombstoneSeconds,
+	})
+}
+
+func (a *api) handleCacheExpiring(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	within, err := strconv.Atoi(r.URL.Query().Get("within"))
+	if err != nil || within <= 0 {
+		http.Error(w, "within must be a positive number of seconds", http.StatusBadRequest)
+		return
+	}
+
+	// List only refs the peer could read; listing isn't an access, so it isn't audited
+	peerInfo, hasPeer := security.PeerInfo{}, false
+	if a.needsPeerInfo() {
+		peerInfo, hasPeer = peerFromContext(r.Context())
+	}
+	resp := protocol.CacheExpiringResponse{Entries: []protocol.CacheEntry{}}
+	for _, e := range a.cache.Expiring(a.now().Add(time.Duration(within) * time.Second)) {
+		src, _ := a.keySource(e.Key)
+		if hasPeer && !policy.AllowedAction(a.currentPolicy(), subjectOf(peerInfo), src.ref, policy.ActionRead) {
+			continue
+		}
+		resp.Entries = append(resp.Entries, a.cacheEntry(e.Key, src, e.ExpiresAt, e.CachedAt))
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (a *api) handleCacheRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req protocol.CacheRefreshRequest
+	if !a.decodeJSON(w, r, &req) {
+		return
+	}
+	if len(req.Refs) == 0 && req.WithinSeconds <= 0 {
+		http.Error(w, "refs or a positive within_seconds required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := withTimeout(r.Context(), a.readsTimeout)
+	defer cancel()
+
+	sources := a.refreshTargets(req.Refs, time.Duration(req.WithinSeconds)*time.Second)
+	resp := protocol.CacheRefreshResponse{Refreshed: []protocol.CacheEntry{}, Errors: map[string]string{}}
+
+	// Policy is checked per ref with the requesting peer, like any other read
+	if a.needsPeerInfo() {
+		if peerInfo, hasPeer := peerFromContext(ctx); hasPeer {
+			for key, src := range sources {
+				if d := a.validateAccess(ctx, peerInfo, src.ref, policy.ActionRead); !d.Allowed {
+					resp.Errors[src.descriptor()] = deniedMessage(d.Message)
+					delete(sources, key)
+				}
+			}
+		}
+	}
+
+	refreshed, errs := a.refreshKeys(ctx, sources)
+	resp.Refreshed = append(resp.Refreshed, refreshed...)
+	for key, err := range errs {
+		if a.verbose {
+			log.Printf("cache refresh: failed to refresh %q: %v", key, err)
+		}
+		resp.Errors[sources[key].descriptor()] = a.errorDetail(r, "failed to read secret", err)
+	}
+	if len(resp.Errors) == 0 {
+		resp.Errors = nil
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (a *api) handleCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req protocol.CreateRequest
+	if !a.decodeJSON(w, r, &req) {
+		return
+	}
+	vault, title := strings.TrimSpace(req.Vault), strings.TrimSpace(req.Title)
+	if vault == "" || title == "" {
+		http.Error(w, "vault and title required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Fields) == 0 {
+		http.Error(w, "at least one field required", http.StatusBadRequest)
+		return
+	}
+	if !a.allowFlags(w, req.Flags) {
+		return
+	}
+	seen := make(map[string]bool, len(req.Fields))
+	for _, f := range req.Fields {
+		if f.Name == "" {
+			http.Error(w, "field name required", http.StatusBadRequest)
+			return
+		}
+		if seen[f.Name] {
+			http.Error(w, fmt.Sprintf("duplicate field %q", f.Name), http.StatusBadRequest)
+			return
+		}
+		seen[f.Name] = true
+	}
+	creator, ok := a.backend.(backend.ItemCreator)
+	if !ok {
+		http.Error(w, backend.ErrCreateUnsupported.Error(), http.StatusNotImplemented)
+		return
+	}
+
+	// Creating is authorized separately from reading the same ref
+	ref := "op://" + vault + "/" + title
+	flags := a.withVaultAccount(ref, req.Flags)
+	if a.needsPeerInfo() {
+		if peerInfo, hasPeer := peerFromContext(r.Context()); hasPeer {
+			d := a.validateAccess(r.Context(), peerInfo, ref, policy.ActionCreate)
+			if !d.Allowed {
+				writeDenialError(w, "", &policyDenial{ref: ref, hint: d.Message})
+				return
+			}
+			if req.DryRun {
+				writeCreatePlan(w, ref, req.Fields, flags, d.RequireApproval)
+				return
+			}
+			if d.RequireApproval {
+				if err := a.checkApproval(r.Context(), peerInfo, ref, policy.ActionCreate); err != nil {
+					a.writeReadError(w, r, "", err)
+					return
+				}
+			}
+		}
+	}
+
+	if req.DryRun {
+		writeCreatePlan(w, ref, req.Fields, flags, false)
+		return
+	}
+
+	item := backend.NewItem{Vault: vault, Title: title, Category: req.Category}
+	for _, f := range req.Fields {
+		item.Fields = append(item.Fields, backend.ItemField{Name: f.Name, Value: f.Value, Generate: f.Generate})
+	}
+	ctx, cancel := withTimeout(r.Context(), a.readTimeout)
+	defer cancel()
+	created, err := creator.CreateItem(ctx, item, flags)
+	if err != nil {
+		if a.verbose {
+			log.Printf("create error for %q: %v", ref, err)
+		}
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			writeDeadlineError(w)
+		case errors.Is(err, backend.ErrCreateUnsupported):
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+		case errors.Is(err, backend.ErrApprovalRequired):
+			writeCodedError(w, http.StatusServiceUnavailable, protocol.ErrCodeApprovalRequired, a.errorDetail(r, approvalRequiredMessage, err))
+		default:
+			http.Error(w, a.errorDetail(r, "failed to create item", err), http.StatusBadGateway)
+		}
+		return
+	}
+	_ = json.NewEncoder(w).Encode(protocol.CreateResponse{Ref: created})
+}
+
+// approvalRequiredMessage tells clients how to get past a 1Password app approval prompt
+const approvalRequiredMessage = "approval required in the 1Password app: unlock the app and approve its prompt, then retry"
+
+// writeReadError reports a failed single read; prefix names what was being read.
+// Failures clients can act on get a status and structured code, the rest are 502s.
+func (a *api) writeReadError(w http.ResponseWriter, r *http.Request, prefix string, err error) {
+	var pending *approvalPending
+	var denial *policyDenial
+	switch {
+	case errors.As(err, &pending):
+		writeApprovalError(w, prefix, pending)
+	case errors.As(err, &denial):
+		writeDenialError(w, prefix, denial)
+	case errors.Is(err, context.DeadlineExceeded):
+		writeDeadlineError(w)
+	case errors.Is(err, cache.ErrTombstone):
+		writeDeletedError(w)
+	case errors.Is(err, errAccessDenied):
+		writeCodedError(w, http.StatusForbidden, protocol.ErrCodePolicyDenied, prefix+err.Error())
+	case errors.Is(err, errAuditUnavailable):
+		writeCodedError(w, http.StatusServiceUnavailable, protocol.ErrCodeAuditUnavailable, prefix+err.Error())
+	case errors.Is(err, cache.ErrValueTooLarge):
+		writeCodedError(w, http.StatusBadGateway, protocol.ErrCodeValueTooLarge, prefix+err.Error())
+	case errors.Is(err, backend.ErrSessionInvalid):
+		writeCodedError(w, http.StatusLocked, protocol.ErrCodeSessionLocked, a.errorDetail(r, prefix+"session is locked", err))
+	case errors.Is(err, backend.ErrNotFound):
+		writeCodedError(w, http.StatusNotFound, protocol.ErrCodeNotFound, a.errorDetail(r, prefix+"secret not found", err))
+	case errors.Is(err, backend.ErrApprovalRequired):
+		writeCodedError(w, http.StatusServiceUnavailable, protocol.ErrCodeApprovalRequired, a.errorDetail(r, prefix+approvalRequiredMessage, err))
+	case errors.Is(err, backend.ErrNoBackend):
+		// The daemon's configuration, not the backend, refused it: name the scheme
+		writeCodedError(w, http.StatusBadRequest, protocol.ErrCodeNoBackend, prefix+err.Error())
+	default:
+		http.Error(w, a.errorDetail(r, prefix+"failed to read secret", err), http.StatusBadGateway)
+	}
+}
+
+// writeCodedError writes status with a structured ErrorResponse body
+func writeCodedError(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(protocol.ErrorResponse{Code: code, Message: msg})
+}
+
+// writeDenialError reports a policy denial as 403 policy_denied, with the hint
+// and ref also set on their own so clients can show them prominently
+func writeDenialError(w http.ResponseWriter, prefix string, denial *policyDenial) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	_ = json.NewEncoder(w).Encode(protocol.ErrorResponse{Code: protocol.ErrCodePolicyDenied, Message: prefix + denial.Error(), Ref: denial.ref, Hint: denial.hint})
+}
+
+// writeDeletedError reports a soft-deleted ref as 410 Gone with a structured body
+func writeDeletedError(w http.ResponseWriter) {
+	writeCodedError(w, http.StatusGone, protocol.ErrCodeDeleted, "ref has been deleted")
+}
+
+// writeDeadlineError reports a request that exceeded its handler timeout as 504 with a structured body
+func writeDeadlineError(w http.ResponseWriter) {
+	writeCodedError(w, http.StatusGatewayTimeout, protocol.ErrCodeDeadlineExceeded, "request timed out")
+}
+
+// cachedResponse builds the response for a cache hit, measuring ExpiresIn and Age from the same instant
+func (a *api) cachedResponse(ref, v string, meta cache.Meta) protocol.ReadResponse {
+	now := a.now()
+	return protocol.ReadResponse{
+		Ref:        ref,
+		Value:      v,
+		FromCache:  true,
+		ExpiresIn:  max(0, int(meta.ExpiresAt.Sub(now).Seconds())),
+		ResolvedAt: meta.CachedAt.Unix(),
+		Age:        max(0, int(now.Sub(meta.CachedAt).Seconds())),
+		Version:    meta.Version,
+		UpdatedAt:  unixOrZero(meta.UpdatedAt),
+	}
+}
+
+// freshResponse builds the response for a value just read from the backend,
+// expiring when the cache entry does
+func (a *api) freshResponse(ref string, result backend.SecretResult) protocol.ReadResponse {
+	ttl := a.cache.TTL()
+	if result.TTL > 0 {
+		ttl = min(ttl, result.TTL)
+	}
+	return protocol.ReadResponse{
+		Ref:        ref,
+		Value:      result.Value,
+		ExpiresIn:  int(ttl.Seconds()),
+		ResolvedAt: a.now().Unix(),
+		Version:    result.Version,
+		UpdatedAt:  unixOrZero(result.UpdatedAt),
+	}
+}
+
+// unixOrZero is t in Unix seconds, or 0 for the zero time
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// valueChecksum is the hex SHA-256 of value as read for ref, taken from its
+// cache entry so each cached value is hashed once
+func (a *api) valueChecksum(ctx context.Context, ref string, flags []string, value string) string {
+	key := cacheKeyFor(ref, backend.SecretTypeFromContext(ctx), a.withVaultAccount(ref, flags))
+	if sum, ok := a.cache.Checksum(key); ok {
+		return sum
+	}
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// addChecksum sets rr's ValueSHA256, leaving its value out when only the checksum was asked for
+func (a *api) addChecksum(ctx context.Context, rr *protocol.ReadResponse, flags []string, checksumOnly bool) {
+	rr.ValueSHA256 = a.valueChecksum(ctx, rr.Ref, flags, rr.Value)
+	if checksumOnly {
+		rr.Value = ""
+	}
+}
+
+// writeCreatePlan answers a dry-run create with what would be created, leaving out field values
+func writeCreatePlan(w http.ResponseWriter, ref string, fields []protocol.CreateField, flags []string, requiresApproval bool) {
+	resp := protocol.CreateResponse{Ref: ref, DryRun: true, Account: accountFlag(flags), RequiresApproval: requiresApproval}
+	for _, f := range fields {
+		resp.Fields = append(resp.Fields, protocol.CreateField{Name: f.Name, Generate: f.Generate})
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// errAccessDenied is returned by readOneWithFlags when the access policy refuses the ref
+var errAccessDenied = errors.New("access denied by policy")
+
+// valueTooLargeError is a backend value over the cache's size limit; it is a cache.ErrValueTooLarge
+type valueTooLargeError struct {
+	ref   string
+	size  int
+	limit int64
+}
+
+func (e *valueTooLargeError) Error() string {
+	return fmt.Sprintf("value of %s is %d bytes, over the daemon's max_value_bytes of %d; read large payloads with `op document get` instead", e.ref, e.size, e.limit)
+}
+
+func (e *valueTooLargeError) Is(target error) bool { return target == cache.ErrValueTooLarge }
+
+// checkValueSize rejects a backend value for ref the cache would refuse to store
+func (a *api) checkValueSize(ref, v string) error {
+	if limit := a.cache.MaxValueBytes(); limit > 0 && int64(len(v)) > limit {
+		return &valueTooLargeError{ref: ref, size: len(v), limit: limit}
+	}
+	return nil
+}
+
+// errAuditUnavailable is returned by readOneWithFlags when audit_required is set and the audit log can't be written
+var errAuditUnavailable = errors.New("audit log unavailable; reads are refused until audit events can be written")
+
+// policyDenial is errAccessDenied carrying the denied ref and the policy's remediation hint
+type policyDenial struct {
+	ref  string
+	hint string
+}
+
+func (e *policyDenial) Error() string { return deniedMessage(e.hint) }
+
+func (e *policyDenial) Is(target error) bool { return target == errAccessDenied }
+
+// deniedMessage is the denial text clients see, followed by the policy's hint if it has one
+func deniedMessage(hint string) string {
+	if hint == "" {
+		return errAccessDenied.Error()
+	}
+	return errAccessDenied.Error() + ": " + hint
+}
+
+func (a *api) readOne(ctx context.Context, ref string) (protocol.ReadResponse, error) {
+	return a.readOneWithFlags(ctx, ref, nil)
+}
+
+// checkReadAccess applies the access policy to a read of ref when peer information is available
+func (a *api) checkReadAccess(ctx context.Context, ref string) error {
+	if !a.needsPeerInfo() {
+		return nil
+	}
+	if peerInfo, hasPeer := peerFromContext(ctx); hasPeer {
+		d := a.validateAccess(ctx, peerInfo, ref, policy.ActionRead)
+		if !d.Allowed {
+			return &policyDenial{ref: ref, hint: d.Message}
+		}
+		if d.RequireApproval {
+			if err := a.checkApproval(ctx, peerInfo, ref, policy.ActionRead); err != nil {
+				return err
+			}
+		}
+		if err := a.requireAudit(ctx, ref); err != nil {
+			return err
+		}
+		return a.checkQuota(ctx, peerInfo, ref, d.Quota)
+	} else if a.verbose {
+		// If we can't get peer info, fall back to basic auth (for backward compatibility)
+		log.Printf("[security] no peer information available for policy check")
+	}
+	return a.requireAudit(ctx, ref)
+}
+
+// requireAudit refuses a read while audit_required is set and events aren't
+// reaching the audit log. The refusal is itself audited, so the first read
+// after the log becomes writable again goes through.
+func (a *api) requireAudit(ctx context.Context, ref string) error {
+	if !a.auditRequired || a.audit == nil || !a.audit.Health().Failing {
+		return nil
+	}
+	peerInfo, _ := peerFromContext(ctx)
+	if err := a.audit.LogAuditUnavailable(requestIDFromContext(ctx), peerInfo, ref); err == nil {
+		return nil
+	}
+	if a.verbose {
+		log.Printf("[security] read refused, audit log unavailable: %s", ref)
+	}
+	return errAuditUnavailable
+}
+
+func (a *api) readOneWithFlags(ctx context.Context, ref string, flags []string) (protocol.ReadResponse, error) {
+	if err := a.checkReadAccess(ctx, ref); err != nil {
+		return protocol.ReadResponse{}, err
+	}
+	return a.readAllowed(ctx, ref, flags)
+}
+
+// readAllowed reads ref through the cache once checkReadAccess has let it through
+func (a *api) readAllowed(ctx context.Context, ref string, flags []string) (resp protocol.ReadResponse, err error) {
+	start := time.Now()
+	defer func() {
+		a.breakdown.record(ref, resp.FromCache, err, time.Since(start))
+		if err == nil {
+			a.recentRefs.record(ref)
+		}
+	}()
+
+	flags = a.withVaultAccount(ref, flags)
+	cacheKey := cacheKeyFor(ref, backend.SecretTypeFromContext(ctx), flags)
+
+	// Soft-deleted refs stay gone until their tombstone expires
+	if a.cache.Tombstoned(ref) {
+		return protocol.ReadResponse{}, cache.ErrTombstone
+	}
+
+	// Cache check
+	timing := timingFromContext(ctx)
+	lookupStart := time.Now()
+	v, meta, ok := a.cache.GetMeta(cacheKey)
+	timing.addCache(lookupStart)
+	if ok {
+		a.cache.IncHit()
+		return a.cachedResponse(ref, v, meta), nil
+	}
+	a.cache.IncMiss()
+	a.cache.IncInFlight()
+	defer a.cache.DecInFlight()
+
+	// Callers wait on the flight only as long as their own context allows; the
+	// flight itself keeps going so a cancelled caller can't fail the others
+	// A caller whose function doesn't run waited on another request's read: queue time
+	led := false
+	waitStart := time.Now()
+	ch := a.sf.DoChan(cacheKey, func() (interface{}, error) {
+		led = true
+		// Re-check inside singleflight to avoid thundering herd
+		lookupStart := time.Now()
+		v, meta, ok := a.cache.GetMeta(cacheKey)
+		timing.addCache(lookupStart)
+		if ok {
+			a.cache.IncHit()
+			return a.cachedResponse(ref, v, meta), nil
+		}
+		// Read via backend, detached from the caller that happened to lead the flight
+		ctx2, cancel := withTimeout(context.WithoutCancel(ctx), a.backendReadTimeout)
+		defer cancel()
+		backendStart := time.Now()
+		result, err := backend.ReadResult(ctx2, a.backend, ref, flags)
+		timing.addBackend(backendStart)
+		if err != nil {
+			return nil, err
+		}
+		if err := a.checkValueSize(ref, result.Value); err != nil {
+			return nil, err
+		}
+		if err := a.cache.SetFrom(cacheKey, result.Value, cache.Source{TTL: result.TTL, Version: result.Version, UpdatedAt: result.UpdatedAt}); err != nil {
+			return nil, err
+		}
+		a.rememberRefreshSource(cacheKey, refreshSource{ref: ref, flags: flags, secretType: backend.SecretTypeFromContext(ctx)})
+		return a.freshResponse(ref, result), nil
+	})
+	var res singleflight.Result
+	select {
+	case res = <-ch:
+	case <-ctx.Done():
+		return protocol.ReadResponse{}, ctx.Err()
+	}
+	if !led {
+		timing.addQueue(waitStart)
+	}
+	if res.Err != nil {
+		return protocol.ReadResponse{}, res.Err
+	}
+	rr, ok := res.Val.(protocol.ReadResponse)
+	if !ok {
+		return protocol.ReadResponse{}, errors.New("internal type assertion failed")
+	}
+	return rr, nil
+}
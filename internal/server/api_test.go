@@ -0,0 +1,1648 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/audit"
+	"github.com/zach-source/opx/internal/backend"
+	"github.com/zach-source/opx/internal/cache"
+	"github.com/zach-source/opx/internal/client"
+	"github.com/zach-source/opx/internal/config"
+	"github.com/zach-source/opx/internal/policy"
+	"github.com/zach-source/opx/internal/protocol"
+	"github.com/zach-source/opx/internal/safestring"
+	"github.com/zach-source/opx/internal/security"
+	"github.com/zach-source/opx/internal/session"
+)
+
+// fakeEntry is a value held by fakeCache
+type fakeEntry struct {
+	value     string
+	expiresAt time.Time
+	cachedAt  time.Time
+	version   string
+	updatedAt time.Time
+}
+
+// fakeCache is an in-memory SecretCache whose entries never expire on their own
+type fakeCache struct {
+	mu         sync.Mutex
+	entries    map[string]fakeEntry
+	tombstones map[string]bool
+	ttl        time.Duration
+	now        func() time.Time
+	hits       int64
+	misses     int64
+	inflight   int
+}
+
+func newFakeCache(ttl time.Duration, now func() time.Time) *fakeCache {
+	return &fakeCache{entries: make(map[string]fakeEntry), tombstones: make(map[string]bool), ttl: ttl, now: now}
+}
+
+func (c *fakeCache) GetMeta(key string) (string, cache.Meta, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	return e.value, cache.Meta{CachedAt: e.cachedAt, ExpiresAt: e.expiresAt, Version: e.version, UpdatedAt: e.updatedAt}, ok
+}
+
+func (c *fakeCache) Checksum(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	sum := sha256.Sum256([]byte(e.value))
+	return hex.EncodeToString(sum[:]), true
+}
+
+func (c *fakeCache) Set(key, val string) error { return c.SetFrom(key, val, cache.Source{}) }
+
+func (c *fakeCache) SetFrom(key, val string, src cache.Source) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ttl := c.ttl
+	if src.TTL > 0 {
+		ttl = min(ttl, src.TTL)
+	}
+	c.entries[key] = fakeEntry{value: val, expiresAt: c.now().Add(ttl), cachedAt: c.now(), version: src.Version, updatedAt: src.UpdatedAt}
+	return nil
+}
+
+func (c *fakeCache) Refresh(key, val string) (bool, bool) {
+	old, _, ok := c.GetMeta(key)
+	if !ok {
+		return false, false
+	}
+	return c.Set(key, val) == nil, old != val
+}
+
+func (c *fakeCache) Expiring(expiresBefore time.Time) []cache.ExpiringEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []cache.ExpiringEntry
+	for key, e := range c.entries {
+		if e.expiresAt.Before(expiresBefore) {
+			out = append(out, cache.ExpiringEntry{Key: key, ExpiresAt: e.expiresAt, CachedAt: e.cachedAt})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+func (c *fakeCache) Has(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.entries[key]
+	return ok
+}
+
+func (c *fakeCache) ExpiryStats() (int64, int64, time.Time) { return 0, 0, time.Time{} }
+
+func (c *fakeCache) ValueStats() (int, int64) { return 0, 0 }
+
+func (c *fakeCache) MaxValueBytes() int64 { return 0 }
+
+func (c *fakeCache) HotKeys(accessedSince, expiresBefore time.Time, limit int) []string { return nil }
+
+func (c *fakeCache) RemovePrefix(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.entries, key)
+			n++
+		}
+	}
+	return n
+}
+
+func (c *fakeCache) SoftDelete(key string, tombstoneTTL time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+	c.tombstones[key] = true
+}
+
+func (c *fakeCache) Tombstoned(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tombstones[key]
+}
+
+func (c *fakeCache) Stats() (int, int64, int64, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries), c.hits, c.misses, c.inflight
+}
+
+// The counters change under c.mu since resolve reads refs concurrently
+func (c *fakeCache) IncHit()      { c.locked(func() { c.hits++ }) }
+func (c *fakeCache) IncMiss()     { c.locked(func() { c.misses++ }) }
+func (c *fakeCache) IncInFlight() { c.locked(func() { c.inflight++ }) }
+func (c *fakeCache) DecInFlight() { c.locked(func() { c.inflight-- }) }
+
+func (c *fakeCache) locked(f func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f()
+}
+
+func (c *fakeCache) TTL() time.Duration { return c.ttl }
+
+// failingBackend fails every read
+type failingBackend struct{}
+
+func (failingBackend) Name() string { return "failing" }
+
+func (failingBackend) ReadRef(ctx context.Context, ref string) (string, error) {
+	return "", errors.New("backend unavailable")
+}
+
+func (failingBackend) ReadRefWithFlags(ctx context.Context, ref string, flags []string) (string, error) {
+	return "", errors.New("backend unavailable")
+}
+
+// fakeClock is a settable time source for api.clock
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestAPI_ReadTTLWithFakeClock(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	c := newFakeCache(5*time.Minute, clock.now)
+	a := &api{backend: backend.Fake{}, cache: c, clock: clock.now}
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		advance    time.Duration
+		fromCache  bool
+		expiresIn  int
+		resolvedAt int64
+		age        int
+	}{
+		{name: "miss", fromCache: false, expiresIn: 300, resolvedAt: 1700000000, age: 0},
+		{name: "hit", advance: 0, fromCache: true, expiresIn: 300, resolvedAt: 1700000000, age: 0},
+		{name: "hit after 90s", advance: 90 * time.Second, fromCache: true, expiresIn: 210, resolvedAt: 1700000000, age: 90},
+		{name: "hit near expiry", advance: 209 * time.Second, fromCache: true, expiresIn: 1, resolvedAt: 1700000000, age: 299},
+	}
+
+	for _, tt := range tests {
+		clock.advance(tt.advance)
+		rr, err := a.readOne(ctx, "op://vault/item/field")
+		if err != nil {
+			t.Fatalf("%s: read failed: %v", tt.name, err)
+		}
+		if rr.FromCache != tt.fromCache || rr.ExpiresIn != tt.expiresIn || rr.ResolvedAt != tt.resolvedAt || rr.Age != tt.age {
+			t.Errorf("%s: expected from_cache=%v expires_in=%d resolved_at=%d age=%d, got %+v",
+				tt.name, tt.fromCache, tt.expiresIn, tt.resolvedAt, tt.age, rr)
+		}
+		if rr.FromCache && rr.Age+rr.ExpiresIn != 300 {
+			t.Errorf("%s: expected age and expires_in to add up to the TTL, got %d+%d", tt.name, rr.Age, rr.ExpiresIn)
+		}
+		if rr.ResolvedAt+int64(rr.Age) != clock.now().Unix() {
+			t.Errorf("%s: expected resolved_at+age to be now, got %d+%d", tt.name, rr.ResolvedAt, rr.Age)
+		}
+	}
+
+	if _, hits, misses, _ := c.Stats(); hits != 3 || misses != 1 {
+		t.Errorf("Expected 3 hits and 1 miss, got %d and %d", hits, misses)
+	}
+}
+
+// metadataBackend reports a lease and version with every read
+type metadataBackend struct{ result backend.SecretResult }
+
+func (metadataBackend) Name() string { return "metadata" }
+
+func (b metadataBackend) ReadRef(ctx context.Context, ref string) (string, error) {
+	return b.result.Value, nil
+}
+
+func (b metadataBackend) ReadRefWithFlags(ctx context.Context, ref string, flags []string) (string, error) {
+	return b.result.Value, nil
+}
+
+func (b metadataBackend) ReadRefWithContext(ctx context.Context, ref string, flags []string) (backend.SecretResult, error) {
+	return b.result, nil
+}
+
+func TestAPI_ReadBackendMetadata(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	updated := time.Unix(1690000000, 0)
+	be := metadataBackend{result: backend.SecretResult{Value: "pw", TTL: time.Minute, Version: "7", UpdatedAt: updated}}
+	a := &api{backend: be, cache: newFakeCache(5*time.Minute, clock.now), clock: clock.now}
+	ctx := context.Background()
+
+	rr, err := a.readOne(ctx, "vault://secret/app#password")
+	if err != nil {
+		t.Fatalf("Unexpected read error: %v", err)
+	}
+	if rr.FromCache || rr.ExpiresIn != 60 || rr.Version != "7" || rr.UpdatedAt != updated.Unix() {
+		t.Errorf("Expected a fresh read expiring with the lease at version 7, got %+v", rr)
+	}
+
+	clock.advance(20 * time.Second)
+	rr, err = a.readOne(ctx, "vault://secret/app#password")
+	if err != nil {
+		t.Fatalf("Unexpected read error: %v", err)
+	}
+	if !rr.FromCache || rr.ExpiresIn != 40 || rr.Version != "7" || rr.UpdatedAt != updated.Unix() {
+		t.Errorf("Expected a cached read keeping the lease and version, got %+v", rr)
+	}
+}
+
+func TestAPI_HandlerWireFormat(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	newAPI := func(be backend.Backend) *api {
+		return &api{token: safestring.New("tok"), backend: be, cache: newFakeCache(time.Minute, clock.now), clock: clock.now, sockPath: "/tmp/opx.sock"}
+	}
+	fake, _ := backend.Fake{}.ReadRef(context.Background(), "op://v/i/f")
+
+	tests := []struct {
+		name     string
+		backend  backend.Backend
+		path     string
+		token    string
+		body     string
+		code     int
+		expected string
+	}{
+		{
+			name: "unauthorized", backend: backend.Fake{}, path: "/v1/read", token: "wrong", body: `{"ref":"op://v/i/f"}`,
+			code: http.StatusUnauthorized, expected: "unauthorized",
+		},
+		{
+			name: "read", backend: backend.Fake{}, path: "/v1/read", token: "tok", body: `{"ref":"op://v/i/f"}`,
+			code:     http.StatusOK,
+			expected: `{"ref":"op://v/i/f","value":"` + fake + `","from_cache":false,"expires_in_seconds":60,"resolved_at_unix":1700000000,"age_seconds":0}` + "\n",
+		},
+		{
+			name: "read missing ref", backend: backend.Fake{}, path: "/v1/read", token: "tok", body: `{"ref":" "}`,
+			code: http.StatusBadRequest, expected: "ref required\n",
+		},
+		{
+			name: "read backend failure", backend: failingBackend{}, path: "/v1/read", token: "tok", body: `{"ref":"op://v/i/f"}`,
+			code: http.StatusBadGateway, expected: "failed to read secret\n",
+		},
+		{
+			name: "reads backend failure", backend: failingBackend{}, path: "/v1/reads", token: "tok", body: `{"refs":["op://v/i/f"]}`,
+			code:     http.StatusOK,
+			expected: `{"results":{"op://v/i/f":{"ref":"op://v/i/f","value":"ERROR: failed to read secret","from_cache":false,"expires_in_seconds":0,"resolved_at_unix":1700000000,"age_seconds":0,"error":"failed to read secret"}}}` + "\n",
+		},
+		{
+			name: "resolve", backend: backend.Fake{}, path: "/v1/resolve", token: "tok", body: `{"env":{"X":"op://v/i/f"}}`,
+			code: http.StatusOK, expected: `{"env":{"X":"` + fake + `"}}` + "\n",
+		},
+		{
+			name: "status", backend: backend.Fake{}, path: "/v1/status", token: "tok",
+			code:     http.StatusOK,
+			expected: `{"backend":"fake","cache_size":0,"hits":0,"misses":0,"in_flight":0,"expired_hits":0,"cleanup_removed_total":0,"ttl_seconds":60,"socket_path":"/tmp/opx.sock"}` + "\n",
+		},
+		{
+			name: "readyz without token", backend: backend.Fake{}, path: "/readyz", token: "",
+			code: http.StatusOK, expected: "ok\n",
+		},
+		{
+			name: "session touch disabled", backend: backend.Fake{}, path: "/v1/session/touch", token: "tok",
+			code: http.StatusBadRequest, expected: `{"success":false,"state":"disabled","time_until_lock_seconds":0}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("X-OpAuthd-Token", tt.token)
+			w := httptest.NewRecorder()
+			newAPI(tt.backend).handler().ServeHTTP(w, req)
+
+			if w.Code != tt.code {
+				t.Errorf("Expected status %d, got %d", tt.code, w.Code)
+			}
+			if got := w.Body.String(); got != tt.expected {
+				t.Errorf("Expected body:\n%s\ngot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestAPI_CacheDeleteWithMockCache(t *testing.T) {
+	c := newFakeCache(time.Minute, time.Now)
+	_ = c.Set("op://v/i/f", "plain")
+	_ = c.Set(cacheKeyFor("op://v/i/f", "", []string{"--reveal"}), "flagged")
+	_ = c.Set("op://v/other/f", "kept")
+	a := &api{backend: backend.Fake{}, cache: c}
+
+	w := httptest.NewRecorder()
+	a.handleCacheDelete(w, httptest.NewRequest("POST", "/v1/cache/delete", strings.NewReader(`{"ref":"op://v/i/f","tombstone_seconds":60}`)))
+
+	if expected := `{"ref":"op://v/i/f","removed":2,"tombstone_seconds":60}` + "\n"; w.Body.String() != expected {
+		t.Errorf("Expected body %s, got %s", expected, w.Body.String())
+	}
+	if !c.Tombstoned("op://v/i/f") || !c.Has("op://v/other/f") {
+		t.Error("Expected the ref tombstoned and other refs kept")
+	}
+	if _, err := a.readOne(context.Background(), "op://v/i/f"); !errors.Is(err, cache.ErrTombstone) {
+		t.Errorf("Expected ErrTombstone, got %v", err)
+	}
+}
+
+func TestServer_NewAPIKeepsDisabledDependenciesNil(t *testing.T) {
+	a := (&Server{Backend: backend.Fake{}, Cache: cache.New(time.Minute)}).newAPI()
+	if a.session != nil || a.audit != nil {
+		t.Errorf("Expected nil session and audit interfaces, got %v and %v", a.session, a.audit)
+	}
+
+	logger, _ := audit.NewLogger(false)
+	mgr := session.NewManager(&session.Config{SessionIdleTimeout: time.Hour, CheckInterval: time.Minute})
+	a = (&Server{Backend: backend.Fake{}, Cache: cache.New(time.Minute), Session: mgr, AuditLogger: logger}).newAPI()
+	if a.session == nil || a.audit == nil {
+		t.Error("Expected configured session and audit to be passed through")
+	}
+}
+
+// slowBackend blocks each read until release is closed or the read's context ends
+type slowBackend struct {
+	started chan struct{}
+	release chan struct{}
+	reads   int32
+}
+
+func newSlowBackend() *slowBackend {
+	return &slowBackend{started: make(chan struct{}, 16), release: make(chan struct{})}
+}
+
+func (b *slowBackend) Name() string { return "slow" }
+
+func (b *slowBackend) ReadRef(ctx context.Context, ref string) (string, error) {
+	return b.ReadRefWithFlags(ctx, ref, nil)
+}
+
+func (b *slowBackend) ReadRefWithFlags(ctx context.Context, ref string, flags []string) (string, error) {
+	atomic.AddInt32(&b.reads, 1)
+	b.started <- struct{}{}
+	select {
+	case <-b.release:
+		return "value-of-" + ref, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// waitForCache polls until key is cached or fails the test after a second
+func waitForCache(t *testing.T, c SecretCache, key string) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if c.Has(key) {
+			return
+		}
+	}
+	t.Fatalf("Expected %q to be cached by the leader", key)
+}
+
+func TestAPI_HandlerTimeouts(t *testing.T) {
+	deadline := `{"code":"deadline_exceeded","message":"request timed out"}` + "\n"
+	tests := []struct {
+		name  string
+		path  string
+		body  string
+		setup func(a *api)
+	}{
+		{name: "read", path: "/v1/read", body: `{"ref":"op://v/i/f"}`, setup: func(a *api) { a.readTimeout = 20 * time.Millisecond }},
+		{name: "reads", path: "/v1/reads", body: `{"refs":["op://v/i/f"]}`, setup: func(a *api) { a.readsTimeout = 20 * time.Millisecond }},
+		{name: "resolve", path: "/v1/resolve", body: `{"env":{"X":"op://v/i/f"}}`, setup: func(a *api) { a.resolveTimeout = 20 * time.Millisecond }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			be := newSlowBackend()
+			a := &api{token: safestring.New("tok"), backend: be, cache: cache.New(time.Minute)}
+			tt.setup(a)
+
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("X-OpAuthd-Token", "tok")
+			w := httptest.NewRecorder()
+			a.handler().ServeHTTP(w, req)
+
+			if w.Code != http.StatusGatewayTimeout {
+				t.Errorf("Expected status 504, got %d", w.Code)
+			}
+			if w.Body.String() != deadline {
+				t.Errorf("Expected body %s, got %s", deadline, w.Body.String())
+			}
+
+			// The backend read outlives the request and still fills the cache
+			close(be.release)
+			waitForCache(t, a.cache, "op://v/i/f")
+			rr, err := a.readOne(context.Background(), "op://v/i/f")
+			if err != nil || !rr.FromCache || rr.Value != "value-of-op://v/i/f" {
+				t.Errorf("Expected cached value after timeout, got %+v (%v)", rr, err)
+			}
+			if n := atomic.LoadInt32(&be.reads); n != 1 {
+				t.Errorf("Expected 1 backend read, got %d", n)
+			}
+		})
+	}
+}
+
+// errBackend fails every read with err
+type errBackend struct{ err error }
+
+func (b errBackend) Name() string { return "err" }
+
+func (b errBackend) ReadRef(ctx context.Context, ref string) (string, error) {
+	return "", b.err
+}
+
+func (b errBackend) ReadRefWithFlags(ctx context.Context, ref string, flags []string) (string, error) {
+	return "", b.err
+}
+
+func TestAPI_ReadErrorCodes(t *testing.T) {
+	sessionErr := fmt.Errorf("%w: session is locked", backend.ErrSessionInvalid)
+	tests := []struct {
+		name         string
+		be           backend.Backend
+		path         string
+		body         string
+		expectStatus int
+		expectBody   string
+	}{
+		{
+			name:         "not found",
+			be:           backend.NewFake(backend.WithError("*", backend.FakeNotFound)),
+			path:         "/v1/read",
+			body:         `{"ref":"op://v/i/f"}`,
+			expectStatus: http.StatusNotFound,
+			expectBody:   `{"code":"not_found","message":"secret not found"}` + "\n",
+		},
+		{
+			name:         "session locked",
+			be:           errBackend{err: sessionErr},
+			path:         "/v1/read",
+			body:         `{"ref":"op://v/i/f"}`,
+			expectStatus: http.StatusLocked,
+			expectBody:   `{"code":"session_locked","message":"session is locked"}` + "\n",
+		},
+		{
+			name:         "approval required",
+			be:           errBackend{err: fmt.Errorf("%w: authorization timeout", backend.ErrApprovalRequired)},
+			path:         "/v1/read",
+			body:         `{"ref":"op://v/i/f"}`,
+			expectStatus: http.StatusServiceUnavailable,
+			expectBody:   `{"code":"approval_required","message":"approval required in the 1Password app: unlock the app and approve its prompt, then retry"}` + "\n",
+		},
+		{
+			name:         "resolve not found",
+			be:           backend.NewFake(backend.WithError("*", backend.FakeNotFound)),
+			path:         "/v1/resolve",
+			body:         `{"env":{"X":"op://v/i/f"}}`,
+			expectStatus: http.StatusNotFound,
+			expectBody:   `{"code":"not_found","message":"resolve X: secret not found"}` + "\n",
+		},
+		{
+			name:         "other backend error",
+			be:           failingBackend{},
+			path:         "/v1/read",
+			body:         `{"ref":"op://v/i/f"}`,
+			expectStatus: http.StatusBadGateway,
+			expectBody:   "failed to read secret\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &api{token: safestring.New("tok"), backend: tt.be, cache: cache.New(time.Minute)}
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("X-OpAuthd-Token", "tok")
+			w := httptest.NewRecorder()
+			a.handler().ServeHTTP(w, req)
+
+			if w.Code != tt.expectStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectStatus, w.Code)
+			}
+			if w.Body.String() != tt.expectBody {
+				t.Errorf("Expected body %q, got %q", tt.expectBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAPI_BackendReadTimeout(t *testing.T) {
+	be := newSlowBackend()
+	a := &api{backend: be, cache: cache.New(time.Minute), backendReadTimeout: 20 * time.Millisecond}
+
+	_, err := a.readOne(context.Background(), "op://v/i/f")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected backend read to hit its own deadline, got %v", err)
+	}
+	if a.cache.Has("op://v/i/f") {
+		t.Error("Expected nothing cached after a timed-out backend read")
+	}
+}
+
+func TestAPI_CancelledCallerDoesNotPoisonFlight(t *testing.T) {
+	tests := []struct {
+		name string
+		// cancelLeader cancels the first caller instead of the second
+		cancelLeader bool
+	}{
+		{name: "cancelled follower"},
+		{name: "cancelled leader", cancelLeader: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			be := newSlowBackend()
+			a := &api{backend: be, cache: cache.New(time.Minute)}
+			ref := "op://v/shared/f"
+
+			leaderCtx, cancelLeader := context.WithCancel(context.Background())
+			defer cancelLeader()
+			leader := make(chan error, 1)
+			go func() {
+				_, err := a.readOne(leaderCtx, ref)
+				leader <- err
+			}()
+			<-be.started
+
+			followerCtx, cancelFollower := context.WithCancel(context.Background())
+			defer cancelFollower()
+			follower := make(chan error, 1)
+			go func() {
+				_, err := a.readOne(followerCtx, ref)
+				follower <- err
+			}()
+
+			cancelled, survivor := follower, leader
+			if tt.cancelLeader {
+				cancelLeader()
+				cancelled, survivor = leader, follower
+			} else {
+				cancelFollower()
+			}
+			if err := <-cancelled; !errors.Is(err, context.Canceled) {
+				t.Errorf("Expected cancelled caller to get context.Canceled, got %v", err)
+			}
+
+			close(be.release)
+			if err := <-survivor; err != nil {
+				t.Errorf("Expected the remaining caller to get the shared value, got %v", err)
+			}
+			if !a.cache.Has(ref) {
+				t.Error("Expected the flight to populate the cache")
+			}
+			if n := atomic.LoadInt32(&be.reads); n != 1 {
+				t.Errorf("Expected 1 backend read, got %d", n)
+			}
+		})
+	}
+}
+
+// creatingBackend is a fake backend that records the items it is asked to create
+type creatingBackend struct {
+	backend.Fake
+	created []backend.NewItem
+}
+
+func (b *creatingBackend) CreateItem(ctx context.Context, item backend.NewItem, flags []string) (string, error) {
+	b.created = append(b.created, item)
+	return "op://" + item.Vault + "/" + item.Title, nil
+}
+
+func TestAPI_Create(t *testing.T) {
+	peer := security.PeerInfo{PID: 1, Path: "/usr/bin/provisioner"}
+	body := `{"vault":"dev","title":"MyApp","fields":[{"name":"username","value":"deploy"},{"name":"password","generate":true}]}`
+	dryRun := `{"vault":"dev","title":"MyApp","fields":[{"name":"username","value":"deploy"},{"name":"password","generate":true}],"dry_run":true}`
+
+	tests := []struct {
+		name     string
+		backend  backend.Backend
+		rules    []policy.Rule
+		body     string
+		code     int
+		expected string
+		created  int
+	}{
+		{name: "no policy", backend: &creatingBackend{}, body: body, code: http.StatusOK, expected: `{"ref":"op://dev/MyApp"}` + "\n", created: 1},
+		{
+			name: "rule grants create", backend: &creatingBackend{}, body: body,
+			rules: []policy.Rule{{Path: peer.Path, Refs: []string{"op://dev/*"}, Actions: []string{"create"}}},
+			code:  http.StatusOK, expected: `{"ref":"op://dev/MyApp"}` + "\n", created: 1,
+		},
+		{
+			name: "read-only rule denies create", backend: &creatingBackend{}, body: body,
+			rules: []policy.Rule{{Path: peer.Path, Refs: []string{"op://dev/*"}}},
+			code:  http.StatusForbidden, expected: `{"code":"policy_denied","message":"access denied by policy","ref":"op://dev/MyApp"}` + "\n",
+		},
+		{name: "backend cannot create", backend: backend.Fake{}, body: body, code: http.StatusNotImplemented, expected: "backend does not support creating items\n"},
+		{name: "missing title", backend: &creatingBackend{}, body: `{"vault":"dev","fields":[{"name":"a","value":"b"}]}`, code: http.StatusBadRequest, expected: "vault and title required\n"},
+		{name: "no fields", backend: &creatingBackend{}, body: `{"vault":"dev","title":"MyApp"}`, code: http.StatusBadRequest, expected: "at least one field required\n"},
+		{name: "duplicate field", backend: &creatingBackend{}, body: `{"vault":"dev","title":"MyApp","fields":[{"name":"a","value":"b"},{"name":"a","value":"c"}]}`, code: http.StatusBadRequest, expected: "duplicate field \"a\"\n"},
+		{
+			name: "dry run creates nothing", backend: &creatingBackend{}, body: dryRun,
+			rules: []policy.Rule{{Path: peer.Path, Refs: []string{"op://dev/*"}, Actions: []string{"create"}}},
+			code:  http.StatusOK, expected: `{"ref":"op://dev/MyApp","dry_run":true,"fields":[{"name":"username"},{"name":"password","generate":true}]}` + "\n",
+		},
+		{
+			name: "dry run reports approval", backend: &creatingBackend{}, body: dryRun,
+			rules: []policy.Rule{{Path: peer.Path, Refs: []string{"op://dev/*"}, Actions: []string{"create"}, RequireApproval: true}},
+			code:  http.StatusOK, expected: `{"ref":"op://dev/MyApp","dry_run":true,"fields":[{"name":"username"},{"name":"password","generate":true}],"requires_approval":true}` + "\n",
+		},
+		{
+			name: "dry run checks the policy", backend: &creatingBackend{}, body: dryRun,
+			rules: []policy.Rule{{Path: peer.Path, Refs: []string{"op://dev/*"}}},
+			code:  http.StatusForbidden, expected: `{"code":"policy_denied","message":"access denied by policy","ref":"op://dev/MyApp"}` + "\n",
+		},
+		{name: "dry run validates", backend: &creatingBackend{}, body: `{"vault":"dev","title":"MyApp","dry_run":true}`, code: http.StatusBadRequest, expected: "at least one field required\n"},
+		{name: "dry run needs a creating backend", backend: backend.Fake{}, body: dryRun, code: http.StatusNotImplemented, expected: "backend does not support creating items\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &api{token: safestring.New("tok"), backend: tt.backend, cache: cache.New(time.Minute)}
+			if tt.rules != nil {
+				a.policy = policy.Policy{Allow: tt.rules, DefaultDeny: true}
+			}
+
+			req := httptest.NewRequest("POST", "/v1/create", strings.NewReader(tt.body))
+			req.Header.Set("X-OpAuthd-Token", "tok")
+			req = req.WithContext(context.WithValue(req.Context(), peerInfoKey, peer))
+			w := httptest.NewRecorder()
+			a.handler().ServeHTTP(w, req)
+
+			if w.Code != tt.code {
+				t.Errorf("Expected status %d, got %d", tt.code, w.Code)
+			}
+			if w.Body.String() != tt.expected {
+				t.Errorf("Expected body %q, got %q", tt.expected, w.Body.String())
+			}
+			if cb, ok := tt.backend.(*creatingBackend); ok {
+				if len(cb.created) != tt.created {
+					t.Fatalf("Expected %d created items, got %d", tt.created, len(cb.created))
+				}
+				if tt.created > 0 {
+					item := cb.created[0]
+					expected := []backend.ItemField{{Name: "username", Value: "deploy"}, {Name: "password", Generate: true}}
+					if item.Vault != "dev" || item.Title != "MyApp" || !reflect.DeepEqual(item.Fields, expected) {
+						t.Errorf("Expected dev/MyApp with %v, got %+v", expected, item)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAPI_ResolveMeta(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	a := &api{token: safestring.New("tok"), backend: backend.Fake{}, cache: newFakeCache(5*time.Minute, clock.now), clock: clock.now}
+	fake, _ := backend.Fake{}.ReadRef(context.Background(), "op://v/i/f")
+
+	resolve := func(body string) string {
+		req := httptest.NewRequest("POST", "/v1/resolve", strings.NewReader(body))
+		req.Header.Set("X-OpAuthd-Token", "tok")
+		w := httptest.NewRecorder()
+		a.handler().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		return w.Body.String()
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		advance  time.Duration
+		expected string
+	}{
+		{
+			name:     "meta omitted by default",
+			body:     `{"env":{"X":"op://v/i/f"}}`,
+			expected: `{"env":{"X":"` + fake + `"}}` + "\n",
+		},
+		{
+			name:     "cached value attributed to the cache",
+			body:     `{"env":{"X":"op://v/i/f"},"include_meta":true}`,
+			advance:  time.Minute,
+			expected: `{"env":{"X":"` + fake + `"},"meta":{"X":{"from_cache":true,"expires_in_seconds":240,"resolved_at_unix":1700000000,"backend":"fake"}}}` + "\n",
+		},
+		{
+			name:     "new mapping read from the backend",
+			body:     `{"env":{"Y":"op://v/other/f"},"include_meta":true}`,
+			expected: `"meta":{"Y":{"from_cache":false,"expires_in_seconds":300,"resolved_at_unix":1700000060,"backend":"fake"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		clock.advance(tt.advance)
+		got := resolve(tt.body)
+		if !strings.Contains(got, tt.expected) {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestAPI_ResolveOperationID(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	logger, err := audit.NewLoggerWithConfig(true, audit.RollerConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create audit logger: %v", err)
+	}
+	defer logger.Close()
+	sub := logger.Subscribe(16)
+	defer logger.Unsubscribe(sub)
+
+	peer := security.PeerInfo{PID: 1, Path: "/usr/bin/deploy"}
+	a := &api{
+		token:   safestring.New("tok"),
+		backend: backend.Fake{},
+		cache:   cache.New(5 * time.Minute),
+		audit:   logger,
+		policy: policy.Policy{
+			Allow:       []policy.Rule{{Path: peer.Path, Refs: []string{"op://dev/*"}}},
+			DefaultDeny: true,
+		},
+	}
+	resolve := func(body string) (*httptest.ResponseRecorder, []audit.AuditEvent) {
+		req := httptest.NewRequest("POST", "/v1/resolve", strings.NewReader(body))
+		req.Header.Set("X-OpAuthd-Token", "tok")
+		req = req.WithContext(context.WithValue(req.Context(), peerInfoKey, peer))
+		w := httptest.NewRecorder()
+		a.handler().ServeHTTP(w, req)
+		var events []audit.AuditEvent
+		for {
+			select {
+			case event := <-sub.C:
+				events = append(events, event)
+				if event.Event == "RESOLVE" {
+					return w, events
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Expected a RESOLVE audit event, got %+v", events)
+			}
+		}
+	}
+
+	w, events := resolve(`{"env":{"DB_PASSWORD":"op://dev/db/password","API_TOKEN":"op://dev/api/token"}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d %s", w.Code, w.Body.String())
+	}
+	opID := w.Header().Get("X-Operation-ID")
+	if opID == "" || opID == w.Header().Get("X-Request-ID") {
+		t.Fatalf("Expected an operation ID of its own, got %q", opID)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expected two decisions and a summary, got %+v", events)
+	}
+	refs := map[string]bool{}
+	for _, event := range events {
+		if event.Details[audit.OperationIDDetail] != opID {
+			t.Errorf("Expected operation_id %s, got %+v", opID, event)
+		}
+		if event.Event == "ACCESS_DECISION" {
+			refs[event.Reference] = true
+		}
+	}
+	if !refs["op://dev/db/password"] || !refs["op://dev/api/token"] {
+		t.Errorf("Expected a decision for each ref, got %+v", events)
+	}
+	summary := events[2]
+	expectedEnv := map[string]string{"DB_PASSWORD": "op://dev/db/password", "API_TOKEN": "op://dev/api/token"}
+	if summary.Decision != "SUCCESS" || !reflect.DeepEqual(summary.Env, expectedEnv) || summary.PeerInfo.Path != peer.Path {
+		t.Errorf("Expected a SUCCESS summary of the mappings, got %+v", summary)
+	}
+	if strings.Contains(fmt.Sprintf("%+v", summary), "fake_") {
+		t.Errorf("Expected no values in the summary, got %+v", summary)
+	}
+
+	// Each resolve is its own operation, and the summary names what failed it
+	w, events = resolve(`{"env":{"DB_PASSWORD":"op://dev/db/password","PROD":"op://prod/db/password"}}`)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected status 403, got %d %s", w.Code, w.Body.String())
+	}
+	next := w.Header().Get("X-Operation-ID")
+	if next == "" || next == opID {
+		t.Errorf("Expected a new operation ID, got %q", next)
+	}
+	for _, event := range events {
+		if event.Details[audit.OperationIDDetail] != next {
+			t.Errorf("Expected operation_id %s, got %+v", next, event)
+		}
+	}
+	if summary := events[len(events)-1]; summary.Decision != "FAILURE" || summary.Details["failed_var"] != "PROD" {
+		t.Errorf("Expected a FAILURE summary naming PROD, got %+v", summary)
+	}
+}
+
+func TestAPI_Checksums(t *testing.T) {
+	peer := security.PeerInfo{PID: 1, Path: "/usr/bin/deploy"}
+	a := &api{
+		token:   safestring.New("tok"),
+		backend: backend.Fake{},
+		cache:   cache.New(5 * time.Minute),
+		policy: policy.Policy{
+			Allow:       []policy.Rule{{Path: peer.Path, Refs: []string{"op://dev/*"}}},
+			DefaultDeny: true,
+		},
+	}
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("X-OpAuthd-Token", "tok")
+		req = req.WithContext(context.WithValue(req.Context(), peerInfoKey, peer))
+		w := httptest.NewRecorder()
+		a.handler().ServeHTTP(w, req)
+		return w
+	}
+	value, _ := backend.Fake{}.ReadRef(context.Background(), "op://dev/db/password")
+	sum := sha256.Sum256([]byte(value))
+	checksum := hex.EncodeToString(sum[:])
+
+	// The first read hashes the value from the backend, the second the cached entry
+	for i := 0; i < 2; i++ {
+		w := post("/v1/read", `{"ref":"op://dev/db/password","include_checksum":true}`)
+		var rr protocol.ReadResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &rr); err != nil {
+			t.Fatalf("Failed to decode %s: %v", w.Body.String(), err)
+		}
+		if rr.Value != value || rr.ValueSHA256 != checksum {
+			t.Errorf("Read %d: expected the value and checksum %s, got %+v", i, checksum, rr)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		expected string
+	}{
+		{name: "read", path: "/v1/read", body: `{"ref":"op://dev/db/password","checksum_only":true}`, expected: `"value":"",`},
+		{name: "reads", path: "/v1/reads", body: `{"refs":["op://dev/db/password"],"checksum_only":true}`, expected: `"value":"",`},
+		{name: "resolve", path: "/v1/resolve", body: `{"env":{"DB":"op://dev/db/password"},"checksum_only":true}`, expected: `{"env":{},"value_sha256":{"DB":"` + checksum + `"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := post(tt.path, tt.body)
+			body := w.Body.String()
+			if w.Code != http.StatusOK || !strings.Contains(body, tt.expected) || !strings.Contains(body, checksum) {
+				t.Errorf("Expected %d with %s and the checksum, got %d %s", http.StatusOK, tt.expected, w.Code, body)
+			}
+			if strings.Contains(body, value) {
+				t.Errorf("Expected no value in a checksum-only response, got %s", body)
+			}
+		})
+	}
+
+	// Policy still applies to checksums
+	w := post("/v1/read", `{"ref":"op://prod/db/password","checksum_only":true}`)
+	if w.Code != http.StatusForbidden || strings.Contains(w.Body.String(), "value_sha256") {
+		t.Errorf("Expected 403 without a checksum, got %d %s", w.Code, w.Body.String())
+	}
+	w = post("/v1/reads", `{"refs":["op://prod/db/password"],"checksum_only":true}`)
+	if !strings.Contains(w.Body.String(), "ERROR: access denied by policy") || strings.Contains(w.Body.String(), "value_sha256") {
+		t.Errorf("Expected a denied result without a checksum, got %s", w.Body.String())
+	}
+}
+
+func TestAPI_ValueTooLarge(t *testing.T) {
+	value, _ := backend.Fake{}.ReadRef(context.Background(), "op://dev/db/password")
+	c := cache.New(5 * time.Minute)
+	c.SetMaxValueBytes(int64(len(value)))
+	a := &api{token: safestring.New("tok"), backend: backend.Fake{}, cache: c}
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("X-OpAuthd-Token", "tok")
+		w := httptest.NewRecorder()
+		a.handler().ServeHTTP(w, req)
+		return w
+	}
+
+	// A value exactly at the limit is returned and cached
+	if w := post("/v1/read", `{"ref":"op://dev/db/password"}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), value) {
+		t.Fatalf("Expected the value at the limit, got %d %s", w.Code, w.Body.String())
+	}
+	req := httptest.NewRequest("GET", "/v1/status", nil)
+	req.Header.Set("X-OpAuthd-Token", "tok")
+	w := httptest.NewRecorder()
+	a.handler().ServeHTTP(w, req)
+	var st protocol.Status
+	if err := json.Unmarshal(w.Body.Bytes(), &st); err != nil {
+		t.Fatalf("Failed to decode status: %v", err)
+	}
+	key := cacheKeyFor("op://dev/db/password", "", nil)
+	if st.LargestValueBytes != len(value) || st.CacheBytes != int64(len(key)+len(value)) || st.MaxValueBytes != int64(len(value)) {
+		t.Errorf("Expected largest %d, %d cache bytes and limit %d, got %+v", len(value), len(key)+len(value), len(value), st)
+	}
+
+	// Lowering the limit evicts the entry, and the backend's value is refused
+	c.SetMaxValueBytes(int64(len(value) - 1))
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		code     int
+		expected string
+	}{
+		{name: "read", path: "/v1/read", body: `{"ref":"op://dev/db/password"}`, code: http.StatusBadGateway, expected: `"code":"value_too_large"`},
+		{name: "reads", path: "/v1/reads", body: `{"refs":["op://dev/db/password"]}`, code: http.StatusOK, expected: "ERROR: value of op://dev/db/password is 21 bytes"},
+		{name: "resolve", path: "/v1/resolve", body: `{"env":{"DB":"op://dev/db/password"}}`, code: http.StatusBadGateway, expected: `resolve DB: value of op://dev/db/password is 21 bytes, over the daemon's max_value_bytes of 20`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := post(tt.path, tt.body)
+			if w.Code != tt.code || !strings.Contains(w.Body.String(), tt.expected) {
+				t.Errorf("Expected %d with %s, got %d %s", tt.code, tt.expected, w.Code, w.Body.String())
+			}
+		})
+	}
+	if c.Has(key) {
+		t.Error("Expected the over-limit value not to be cached")
+	}
+}
+
+// pingingBackend is a Fake backend whose health check returns err
+type pingingBackend struct {
+	backend.Fake
+	err error
+}
+
+func (p pingingBackend) Ping(ctx context.Context) error { return p.err }
+
+func TestAPI_StatusBackends(t *testing.T) {
+	multi := backend.NewMultiBackend(backend.Fake{}, pingingBackend{err: errors.New("connection refused")}, nil, "op")
+
+	tests := []struct {
+		name     string
+		backend  backend.Backend
+		path     string
+		expected string
+	}{
+		{name: "single backend", backend: backend.Fake{}, path: "/v1/status"},
+		{
+			name: "multi", backend: multi, path: "/v1/status",
+			expected: `"backends":[{"scheme":"op","name":"fake","default":true},{"scheme":"vault","name":"fake"},{"scheme":"bao"}]`,
+		},
+		{
+			name: "multi probe", backend: multi, path: "/v1/status?probe=1",
+			expected: `"backends":[{"scheme":"op","name":"fake","default":true,"health":"unknown"},{"scheme":"vault","name":"fake","health":"error","error":"connection refused"},{"scheme":"bao","health":"unconfigured"}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &api{token: safestring.New("tok"), backend: tt.backend, cache: newFakeCache(time.Minute, time.Now)}
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("X-OpAuthd-Token", "tok")
+			w := httptest.NewRecorder()
+			a.handler().ServeHTTP(w, req)
+
+			got := w.Body.String()
+			if tt.expected == "" {
+				if strings.Contains(got, `"backends"`) {
+					t.Errorf("Expected no sub-backends for a single backend, got %s", got)
+				}
+				return
+			}
+			if !strings.Contains(got, tt.expected) {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestAPI_CacheExpiring(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	c := newFakeCache(5*time.Minute, clock.now)
+	a := &api{token: safestring.New("tok"), backend: backend.Fake{}, cache: c, clock: clock.now}
+	_ = c.Set("op://v/old/f", "a")
+	clock.advance(3 * time.Minute)
+	newKey := cacheKeyFor("op://v/new/f", "", []string{"--account=acme"})
+	_ = c.Set(newKey, "b")
+	a.rememberRefreshSource(newKey, refreshSource{ref: "op://v/new/f", flags: []string{"--account=acme"}})
+
+	tests := []struct {
+		name     string
+		within   string
+		code     int
+		expected string
+	}{
+		{name: "missing window", within: "", code: http.StatusBadRequest, expected: "within must be a positive number of seconds\n"},
+		{
+			name: "only the older entry", within: "300", code: http.StatusOK,
+			expected: `{"entries":[{"key":"op://v/old/f","ref":"op://v/old/f","descriptor":"op://v/old/f","expires_in_seconds":120,"resolved_at_unix":1700000000}]}` + "\n",
+		},
+		{
+			name: "both entries", within: "301", code: http.StatusOK,
+			expected: `{"entries":[{"key":"` + newKey + `","ref":"op://v/new/f","descriptor":"op://v/new/f (flags=--account=***)","expires_in_seconds":300,"resolved_at_unix":1700000180},` +
+				`{"key":"op://v/old/f","ref":"op://v/old/f","descriptor":"op://v/old/f","expires_in_seconds":120,"resolved_at_unix":1700000000}]}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v1/cache/expiring?within="+tt.within, nil)
+			req.Header.Set("X-OpAuthd-Token", "tok")
+			w := httptest.NewRecorder()
+			a.handler().ServeHTTP(w, req)
+			if w.Code != tt.code {
+				t.Errorf("Expected status %d, got %d", tt.code, w.Code)
+			}
+			if got := w.Body.String(); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestAPI_CacheRefresh(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	c := newFakeCache(5*time.Minute, clock.now)
+	peer := security.PeerInfo{PID: 7, Path: "/usr/bin/tool"}
+	a := &api{
+		token:   safestring.New("tok"),
+		backend: backend.Fake{},
+		cache:   c,
+		clock:   clock.now,
+		policy:  policy.Policy{Allow: []policy.Rule{{Path: peer.Path, Refs: []string{"op://dev/*"}}}, DefaultDeny: true},
+	}
+	_ = c.Set("op://dev/db/password", "stale")
+	revealKey := cacheKeyFor("op://dev/db/password", "", []string{"--reveal"})
+	_ = c.Set(revealKey, "stale")
+	a.rememberRefreshSource(revealKey, refreshSource{ref: "op://dev/db/password", flags: []string{"--reveal"}})
+	_ = c.Set("op://prod/db/password", "stale")
+	clock.advance(4 * time.Minute)
+
+	refresh := func(body string) string {
+		req := httptest.NewRequest("POST", "/v1/cache/refresh", strings.NewReader(body))
+		req.Header.Set("X-OpAuthd-Token", "tok")
+		req = req.WithContext(context.WithValue(req.Context(), peerInfoKey, peer))
+		w := httptest.NewRecorder()
+		a.handler().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	// Every variant of a named ref is re-read and gets a new ResolvedAt
+	got := refresh(`{"refs":["op://dev/db/password"]}`)
+	expected := `{"refreshed":[{"key":"op://dev/db/password","ref":"op://dev/db/password","descriptor":"op://dev/db/password","expires_in_seconds":300,"resolved_at_unix":1700000240},` +
+		`{"key":"` + revealKey + `","ref":"op://dev/db/password","descriptor":"op://dev/db/password (flags=--reveal)","expires_in_seconds":300,"resolved_at_unix":1700000240}]}` + "\n"
+	if got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+	if v, meta, _ := c.GetMeta("op://dev/db/password"); v == "stale" || meta.CachedAt.Unix() != 1700000240 {
+		t.Errorf("Expected a fresh value resolved at 1700000240, got %q at %d", v, meta.CachedAt.Unix())
+	}
+
+	// A window refresh still enforces policy per ref
+	clock.advance(2 * time.Minute)
+	got = refresh(`{"within_seconds":60}`)
+	expected = `{"refreshed":[],"errors":{"op://prod/db/password":"access denied by policy"}}` + "\n"
+	if got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+	if v, _, _ := c.GetMeta("op://prod/db/password"); v != "stale" {
+		t.Errorf("Expected denied ref to keep its cached value, got %q", v)
+	}
+}
+
+func TestAPI_DebugErrorDetail(t *testing.T) {
+	tests := []struct {
+		name       string
+		allowDebug bool
+		header     bool
+		detail     bool
+	}{
+		{name: "neither"},
+		{name: "client only", header: true},
+		{name: "daemon only", allowDebug: true},
+		{name: "both", allowDebug: true, header: true, detail: true},
+	}
+
+	requests := []struct {
+		path, body string
+	}{
+		{"/v1/read", `{"ref":"op://v/i/f"}`},
+		{"/v1/reads", `{"refs":["op://v/i/f"]}`},
+		{"/v1/resolve", `{"env":{"X":"op://v/i/f"}}`},
+	}
+
+	for _, tt := range tests {
+		for _, rq := range requests {
+			a := &api{token: safestring.New("tok"), backend: failingBackend{}, cache: newFakeCache(time.Minute, time.Now), allowDebug: tt.allowDebug}
+			req := httptest.NewRequest("POST", rq.path, strings.NewReader(rq.body))
+			req.Header.Set("X-OpAuthd-Token", "tok")
+			if tt.header {
+				req.Header.Set(protocol.DebugHeader, "1")
+			}
+			w := httptest.NewRecorder()
+			a.handler().ServeHTTP(w, req)
+
+			body := w.Body.String()
+			if !strings.Contains(body, "failed to read secret") {
+				t.Errorf("%s %s: expected generic error, got %q", tt.name, rq.path, body)
+			}
+			if got := strings.Contains(body, "backend unavailable"); got != tt.detail {
+				t.Errorf("%s %s: expected detail=%v, got %q", tt.name, rq.path, tt.detail, body)
+			}
+		}
+	}
+}
+
+func TestAPI_MaxRequestBytes(t *testing.T) {
+	// A batch of refs well past the byte limit, within the default ref limit
+	var refs []string
+	for i := 0; i < defaultMaxRefsPerRequest; i++ {
+		refs = append(refs, fmt.Sprintf(`"op://vault/item-%04d/password"`, i))
+	}
+	oversized := `{"refs":[` + strings.Join(refs, ",") + `]}`
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		limit    int64
+		code     int
+		expected string
+	}{
+		{name: "oversized batch", path: "/v1/reads", body: oversized, limit: 4096, code: http.StatusRequestEntityTooLarge, expected: "request body larger than 4096 bytes\n"},
+		{name: "oversized resolve", path: "/v1/resolve", body: `{"env":{"X":"` + strings.Repeat("a", 5000) + `"}}`, limit: 4096, code: http.StatusRequestEntityTooLarge, expected: "request body larger than 4096 bytes\n"},
+		{name: "within limit", path: "/v1/read", body: `{"ref":"op://v/i/f"}`, limit: 4096, code: http.StatusOK},
+		{name: "default limit", path: "/v1/reads", body: oversized, code: http.StatusOK},
+		{name: "bad json still 400", path: "/v1/read", body: `{"ref":`, limit: 4096, code: http.StatusBadRequest, expected: "bad json\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &api{token: safestring.New("tok"), backend: backend.Fake{}, cache: newFakeCache(time.Minute, time.Now), maxRequestBytes: tt.limit}
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("X-OpAuthd-Token", "tok")
+			w := httptest.NewRecorder()
+			a.handler().ServeHTTP(w, req)
+
+			if w.Code != tt.code {
+				t.Errorf("Expected status %d, got %d", tt.code, w.Code)
+			}
+			if tt.expected != "" && w.Body.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, w.Body.String())
+			}
+		})
+	}
+}
+
+// countingBackend serves fake values and counts backend reads
+type countingBackend struct {
+	backend.Fake
+	reads int32
+}
+
+func (b *countingBackend) ReadRefWithFlags(ctx context.Context, ref string, flags []string) (string, error) {
+	atomic.AddInt32(&b.reads, 1)
+	return b.Fake.ReadRefWithFlags(ctx, ref, flags)
+}
+
+func TestAPI_MaxRefsPerRequest(t *testing.T) {
+	batch := func(n int) (reads, resolve string) {
+		refs := make([]string, n)
+		env := make([]string, n)
+		for i := range n {
+			refs[i] = fmt.Sprintf(`"op://vault/item-%d/password"`, i)
+			env[i] = fmt.Sprintf(`"VAR_%d":"op://vault/item-%d/password"`, i, i)
+		}
+		return `{"refs":[` + strings.Join(refs, ",") + `]}`, `{"env":{` + strings.Join(env, ",") + `}}`
+	}
+	readsAt, resolveAt := batch(3)
+	readsOver, resolveOver := batch(4)
+	readsDefault, _ := batch(defaultMaxRefsPerRequest + 1)
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		limit    int
+		code     int
+		expected string
+	}{
+		{name: "reads at limit", path: "/v1/reads", body: readsAt, limit: 3, code: http.StatusOK},
+		{name: "reads over limit", path: "/v1/reads", body: readsOver, limit: 3, code: http.StatusBadRequest, expected: "too many refs: 4 is over the daemon's max_refs_per_request of 3\n"},
+		{name: "resolve at limit", path: "/v1/resolve", body: resolveAt, limit: 3, code: http.StatusOK},
+		{name: "resolve over limit", path: "/v1/resolve", body: resolveOver, limit: 3, code: http.StatusBadRequest, expected: "too many refs: 4 is over the daemon's max_refs_per_request of 3\n"},
+		{name: "over default limit", path: "/v1/reads", body: readsDefault, code: http.StatusBadRequest, expected: fmt.Sprintf("too many refs: %d is over the daemon's max_refs_per_request of %d\n", defaultMaxRefsPerRequest+1, defaultMaxRefsPerRequest)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			be := &countingBackend{}
+			a := &api{token: safestring.New("tok"), backend: be, cache: newFakeCache(time.Minute, time.Now), maxRefsPerRequest: tt.limit}
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("X-OpAuthd-Token", "tok")
+			w := httptest.NewRecorder()
+			a.handler().ServeHTTP(w, req)
+
+			if w.Code != tt.code {
+				t.Errorf("Expected status %d, got %d: %s", tt.code, w.Code, w.Body.String())
+			}
+			if tt.expected != "" && w.Body.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, w.Body.String())
+			}
+			if n := atomic.LoadInt32(&be.reads); tt.code == http.StatusBadRequest && n != 0 {
+				t.Errorf("Expected no backend reads for a rejected batch, got %d", n)
+			}
+		})
+	}
+}
+
+func TestAPI_PeerInfoRequired(t *testing.T) {
+	peer := security.PeerInfo{PID: 7, Path: "/usr/bin/tool"}
+	denyByDefault := policy.Policy{Allow: []policy.Rule{{Path: peer.Path, Refs: []string{"*"}}}, DefaultDeny: true}
+	permissive := policy.Policy{Allow: []policy.Rule{{Path: peer.Path, Refs: []string{"op://dev/*"}}}}
+	on, off := true, false
+
+	tests := []struct {
+		name     string
+		policy   policy.Policy
+		setting  *bool
+		withPeer bool
+		code     int
+	}{
+		{name: "default_deny requires peer", policy: denyByDefault, code: http.StatusForbidden},
+		{name: "default_deny with peer", policy: denyByDefault, withPeer: true, code: http.StatusOK},
+		{name: "permissive fails open", policy: permissive, code: http.StatusOK},
+		{name: "permissive with setting on", policy: permissive, setting: &on, code: http.StatusForbidden},
+		{name: "default_deny with setting off", policy: denyByDefault, setting: &off, code: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &api{
+				token:            safestring.New("tok"),
+				backend:          backend.Fake{},
+				cache:            cache.New(5 * time.Minute),
+				policy:           tt.policy,
+				peerInfoRequired: tt.setting,
+			}
+			req := httptest.NewRequest("POST", "/v1/read", strings.NewReader(`{"ref":"op://prod/db/password"}`))
+			req.Header.Set("X-OpAuthd-Token", "tok")
+			if tt.withPeer {
+				req = req.WithContext(context.WithValue(req.Context(), peerInfoKey, peer))
+			}
+			w := httptest.NewRecorder()
+			a.handler().ServeHTTP(w, req)
+			if w.Code != tt.code {
+				t.Fatalf("Expected status %d, got %d: %s", tt.code, w.Code, w.Body.String())
+			}
+			if tt.code == http.StatusForbidden {
+				var body protocol.ErrorResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != protocol.ErrCodePeerUnavailable {
+					t.Errorf("Expected a %s error body, got %s", protocol.ErrCodePeerUnavailable, w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestAPI_PeerInfoRequiredAudit(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	logger, err := audit.NewLoggerWithConfig(true, audit.RollerConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create audit logger: %v", err)
+	}
+	defer logger.Close()
+	sub := logger.Subscribe(4)
+	defer logger.Unsubscribe(sub)
+
+	a := &api{
+		token:   safestring.New("tok"),
+		backend: backend.Fake{},
+		cache:   cache.New(5 * time.Minute),
+		audit:   logger,
+		policy:  policy.Policy{DefaultDeny: true},
+	}
+	req := httptest.NewRequest("POST", "/v1/reads", strings.NewReader(`{"refs":["op://v/i/f"]}`))
+	req.Header.Set("X-OpAuthd-Token", "tok")
+	w := httptest.NewRecorder()
+	a.handler().ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected status 403, got %d", w.Code)
+	}
+
+	select {
+	case event := <-sub.C:
+		if event.Event != "PEER_INFO_UNAVAILABLE" || event.Decision != "DENY" || event.Reference != "/v1/reads" {
+			t.Errorf("Unexpected event: %+v", event)
+		}
+		if event.RequestID != w.Header().Get("X-Request-ID") {
+			t.Errorf("Expected request_id %q, got %q", w.Header().Get("X-Request-ID"), event.RequestID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a PEER_INFO_UNAVAILABLE audit event")
+	}
+}
+
+func TestAPI_DenyMessage(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	logger, err := audit.NewLoggerWithConfig(true, audit.RollerConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create audit logger: %v", err)
+	}
+	defer logger.Close()
+	sub := logger.Subscribe(4)
+	defer logger.Unsubscribe(sub)
+
+	peer := security.PeerInfo{PID: 1, Path: "/usr/bin/deploy"}
+	hint := "contact security to request op://prod/* access"
+	a := &api{
+		token:   safestring.New("tok"),
+		backend: backend.Fake{},
+		cache:   cache.New(5 * time.Minute),
+		audit:   logger,
+		policy: policy.Policy{
+			Allow:       []policy.Rule{{Path: peer.Path, Refs: []string{"op://dev/*"}, Message: hint}},
+			DefaultDeny: true,
+		},
+	}
+
+	tests := []struct {
+		path     string
+		body     string
+		expected string
+	}{
+		{path: "/v1/read", body: `{"ref":"op://prod/db/password"}`, expected: `{"code":"policy_denied","message":"access denied by policy: ` + hint + `","ref":"op://prod/db/password","hint":"` + hint + `"}` + "\n"},
+		{path: "/v1/reads", body: `{"refs":["op://prod/db/password"]}`, expected: `"value":"ERROR: access denied by policy: ` + hint + `"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("X-OpAuthd-Token", "tok")
+			req = req.WithContext(context.WithValue(req.Context(), peerInfoKey, peer))
+			w := httptest.NewRecorder()
+			a.handler().ServeHTTP(w, req)
+			if !strings.Contains(w.Body.String(), tt.expected) {
+				t.Errorf("Expected body containing %s, got %s", tt.expected, w.Body.String())
+			}
+
+			select {
+			case event := <-sub.C:
+				if event.Event != "ACCESS_DECISION" || event.Decision != "DENY" || event.Details["deny_message"] != hint {
+					t.Errorf("Expected a DENY event with the hint, got %+v", event)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Expected an ACCESS_DECISION audit event")
+			}
+		})
+	}
+}
+
+func TestAPI_DaemonDenialMessage(t *testing.T) {
+	cfg, err := config.Parse([]byte(`{"denial_message":"run opx audit --interactive as an admin"}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	peer := security.PeerInfo{PID: 1, Path: "/usr/bin/deploy"}
+	ruleHint := "ask the prod on-call for op://prod access"
+	a := &api{
+		token:         safestring.New("tok"),
+		backend:       backend.Fake{},
+		cache:         cache.New(5 * time.Minute),
+		denialMessage: cfg.DenialMessage,
+		policy: policy.Policy{
+			Allow: []policy.Rule{
+				{Path: peer.Path, Refs: []string{"op://dev/*"}},
+				{Path: "/usr/bin/other", Refs: []string{"*"}},
+			},
+			DefaultDeny: true,
+		},
+	}
+
+	tests := []struct {
+		name     string
+		rules    []policy.Rule
+		expected string
+	}{
+		{name: "daemon message", expected: cfg.DenialMessage},
+		{name: "rule message wins", rules: []policy.Rule{{Path: peer.Path, Refs: []string{"op://dev/*"}, Message: ruleHint}}, expected: ruleHint},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.rules != nil {
+				a.setPolicy(policy.Policy{Allow: tt.rules, DefaultDeny: true})
+			}
+			req := httptest.NewRequest("POST", "/v1/read", strings.NewReader(`{"ref":"op://prod/db/password"}`))
+			req.Header.Set("X-OpAuthd-Token", "tok")
+			req = req.WithContext(context.WithValue(req.Context(), peerInfoKey, peer))
+			w := httptest.NewRecorder()
+			a.handler().ServeHTTP(w, req)
+
+			var e protocol.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil || w.Code != http.StatusForbidden {
+				t.Fatalf("Expected a 403 error response, got %d %s", w.Code, w.Body.String())
+			}
+			if e.Code != protocol.ErrCodePolicyDenied || e.Hint != tt.expected || e.Ref != "op://prod/db/password" {
+				t.Errorf("Expected policy_denied with hint %q and the ref, got %+v", tt.expected, e)
+			}
+
+			out := client.FormatDenial("read", &client.StatusError{Code: w.Code, Body: w.Body.String()}, true, "")
+			if !strings.Contains(out, "\n  "+tt.expected+"\n") || !strings.Contains(out, "ref: op://prod/db/password\n") {
+				t.Errorf("Expected the CLI to print the hint and ref, got:\n%s", out)
+			}
+		})
+	}
+}
+
+// blockAuditDir stops audit files being created under XDG_DATA_HOME until the
+// returned func restores it: a read-only directory, or for root, who ignores
+// permissions, a file in its place
+func blockAuditDir(t *testing.T, dataHome string) func() {
+	t.Helper()
+	dir := filepath.Join(dataHome, "op-authd")
+	if os.Geteuid() != 0 {
+		if err := os.Chmod(dir, 0o500); err != nil {
+			t.Fatal(err)
+		}
+		return func() { os.Chmod(dir, 0o700) }
+	}
+	moved := dir + ".moved"
+	if err := os.Rename(dir, moved); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dir, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		os.Remove(dir)
+		os.Rename(moved, dir)
+	}
+}
+
+func TestAPI_AuditRequired(t *testing.T) {
+	peer := security.PeerInfo{PID: 1, Path: "/usr/bin/app"}
+	tests := []struct {
+		name     string
+		required bool
+		code     int
+	}{
+		{name: "required", required: true, code: http.StatusServiceUnavailable},
+		{name: "not required", code: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataHome := t.TempDir()
+			t.Setenv("XDG_DATA_HOME", dataHome)
+			logger, err := audit.NewLoggerWithConfig(true, audit.RollerConfig{})
+			if err != nil {
+				t.Fatalf("Failed to create audit logger: %v", err)
+			}
+			defer logger.Close()
+			a := &api{
+				token:         safestring.New("tok"),
+				backend:       backend.Fake{},
+				cache:         cache.New(5 * time.Minute),
+				audit:         logger,
+				auditRequired: tt.required,
+				policy:        policy.Policy{Allow: []policy.Rule{{Path: peer.Path, Refs: []string{"*"}}}, DefaultDeny: true},
+			}
+			do := func(method, path, body string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(method, path, strings.NewReader(body))
+				req.Header.Set("X-OpAuthd-Token", "tok")
+				req = req.WithContext(context.WithValue(req.Context(), peerInfoKey, peer))
+				w := httptest.NewRecorder()
+				a.handler().ServeHTTP(w, req)
+				return w
+			}
+			read := func() *httptest.ResponseRecorder { return do("POST", "/v1/read", `{"ref":"op://v/i/f"}`) }
+			status := func() protocol.AuditStatus {
+				var st protocol.Status
+				if err := json.Unmarshal(do("GET", "/v1/status", "").Body.Bytes(), &st); err != nil || st.Audit == nil {
+					t.Fatalf("Expected audit health in status, got %+v (%v)", st, err)
+				}
+				return *st.Audit
+			}
+
+			restore := blockAuditDir(t, dataHome)
+			w := read()
+			if w.Code != tt.code {
+				t.Fatalf("Expected %d with an unwritable audit log, got %d %s", tt.code, w.Code, w.Body.String())
+			}
+			if tt.required {
+				var e protocol.ErrorResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil || e.Code != protocol.ErrCodeAuditUnavailable {
+					t.Errorf("Expected an audit_unavailable error, got %s", w.Body.String())
+				}
+			}
+			if st := status(); !st.Failing || st.DroppedEvents == 0 || st.Required != tt.required {
+				t.Errorf("Expected status to report the failing audit log, got %+v", st)
+			}
+
+			restore()
+			if w := read(); w.Code != http.StatusOK {
+				t.Errorf("Expected reads to work once the audit log is writable, got %d %s", w.Code, w.Body.String())
+			}
+			if st := status(); st.Failing || st.DroppedEvents == 0 {
+				t.Errorf("Expected a recovered audit log that still counts dropped events, got %+v", st)
+			}
+		})
+	}
+}
+
+func TestAPI_ScheduleDenial(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	logger, err := audit.NewLoggerWithConfig(true, audit.RollerConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create audit logger: %v", err)
+	}
+	defer logger.Close()
+	sub := logger.Subscribe(4)
+	defer logger.Unsubscribe(sub)
+
+	// Friday 20:00 in New York, after the change window closed
+	clock := &fakeClock{t: time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)}
+	peer := security.PeerInfo{PID: 1, Path: "/usr/bin/deploy"}
+	a := &api{
+		token:   safestring.New("tok"),
+		backend: backend.Fake{},
+		cache:   cache.New(5 * time.Minute),
+		audit:   logger,
+		clock:   clock.now,
+		policy: policy.Policy{
+			Allow: []policy.Rule{{Path: peer.Path, Refs: []string{"op://prod/*"}, Schedule: []policy.Window{
+				{Days: []string{"Mon", "Tue", "Wed", "Thu", "Fri"}, Start: "09:00", End: "18:00", TZ: "America/New_York"},
+			}}},
+			DefaultDeny: true,
+		},
+	}
+	read := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/read", strings.NewReader(`{"ref":"op://prod/db/password"}`))
+		req.Header.Set("X-OpAuthd-Token", "tok")
+		req = req.WithContext(context.WithValue(req.Context(), peerInfoKey, peer))
+		w := httptest.NewRecorder()
+		a.handler().ServeHTTP(w, req)
+		return w
+	}
+
+	reason := "outside allowed window, next window starts at 2026-10-19T09:00:00-04:00"
+	w := read()
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), reason) {
+		t.Errorf("Expected 403 naming the next window, got %d %s", w.Code, w.Body.String())
+	}
+	select {
+	case event := <-sub.C:
+		if event.Decision != "DENY" || event.Details["deny_reason"] != "schedule" || event.Details["deny_message"] != reason {
+			t.Errorf("Expected a schedule DENY event, got %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected an ACCESS_DECISION audit event")
+	}
+
+	clock.advance(61 * time.Hour) // Monday 09:00 in New York
+	if w := read(); w.Code != http.StatusOK {
+		t.Errorf("Expected the read to be allowed inside the window, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAPI_ReadUnconfiguredScheme(t *testing.T) {
+	a := &api{
+		token:   safestring.New("tok"),
+		backend: backend.NewMultiBackend(backend.Fake{}, nil, nil, "op"),
+		cache:   cache.New(5 * time.Minute),
+	}
+	tests := []struct {
+		path     string
+		body     string
+		code     int
+		expected string
+	}{
+		{path: "/v1/read", body: `{"ref":"vault://secret/app#key"}`, code: http.StatusBadRequest, expected: `{"code":"no_backend","message":"no backend configured for scheme \"vault\""}`},
+		{path: "/v1/reads", body: `{"refs":["bao://secret/app#key"]}`, code: http.StatusOK, expected: `"value":"ERROR: no backend configured for scheme \"bao\""`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("X-OpAuthd-Token", "tok")
+			w := httptest.NewRecorder()
+			a.handler().ServeHTTP(w, req)
+			if w.Code != tt.code || !strings.Contains(w.Body.String(), tt.expected) {
+				t.Errorf("Expected %d with %s, got %d %s", tt.code, tt.expected, w.Code, w.Body.String())
+			}
+		})
+	}
+}
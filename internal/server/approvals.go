@@ -0,0 +1,374 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zach-source/opx/internal/protocol"
+	"github.com/zach-source/opx/internal/security"
+	"github.com/zach-source/opx/internal/util"
+)
+
+// DefaultApprovalTimeout is how long an approval waits for an admin, and then for the retry it allows
+const DefaultApprovalTimeout = 5 * time.Minute
+
+// approvalNotifyTimeout bounds the approval hook and webhook
+const approvalNotifyTimeout = 30 * time.Second
+
+// errApprovalRequired is returned for a request a require_approval rule holds until an admin approves it
+var errApprovalRequired = errors.New("approval required")
+
+// approvalPending is errApprovalRequired naming the approval to approve
+type approvalPending struct {
+	id string
+}
+
+func (e *approvalPending) Error() string {
+	return fmt.Sprintf("%s: ask an admin to run `opx approve %s`, then retry", errApprovalRequired, e.id)
+}
+
+func (e *approvalPending) Is(target error) bool { return target == errApprovalRequired }
+
+var (
+	errApprovalNotFound = errors.New("no such approval (it may have expired or been used)")
+	errApprovalDecided  = errors.New("approval was already decided")
+)
+
+// approvals holds requests parked by require_approval rules until an admin
+// approves or denies them. An approval covers one binary, uid, ref and action;
+// once approved it lets exactly one retry through.
+type approvals struct {
+	path    string // where approvals persist; "" keeps them in memory
+	timeout time.Duration
+	now     func() time.Time
+	notify  func(protocol.Approval) // announces new approvals; nil announces nothing
+
+	mu   sync.Mutex
+	byID map[string]*protocol.Approval
+}
+
+// approvalsFile is the on-disk form of the approvals
+type approvalsFile struct {
+	Approvals []protocol.Approval `json:"approvals"`
+}
+
+func newApprovals(path string, timeout time.Duration) *approvals {
+	if timeout <= 0 {
+		timeout = DefaultApprovalTimeout
+	}
+	return &approvals{path: path, timeout: timeout, now: time.Now, byID: make(map[string]*protocol.Approval)}
+}
+
+// load reads the persisted approvals; a missing file means there are none
+func (s *approvals) load() error {
+	if s.path == "" {
+		return nil
+	}
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var f approvalsFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", s.path, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range f.Approvals {
+		s.byID[f.Approvals[i].ID] = &f.Approvals[i]
+	}
+	s.expire()
+	return nil
+}
+
+// expire drops approvals past their deadline, reporting whether any were; callers hold mu
+func (s *approvals) expire() bool {
+	now := s.now().Unix()
+	expired := false
+	for id, ap := range s.byID {
+		if now >= ap.ExpiresAt {
+			delete(s.byID, id)
+			expired = true
+		}
+	}
+	return expired
+}
+
+// save writes the approvals to path, logging failures; callers hold mu
+func (s *approvals) save() {
+	if s.path == "" {
+		return
+	}
+	f := approvalsFile{Approvals: s.sorted()}
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err == nil {
+		err = util.WriteFileAtomic(s.path, b, 0o600)
+	}
+	if err != nil {
+		log.Printf("Warning: failed to save approvals: %v", err)
+	}
+}
+
+// sorted returns copies of the approvals, oldest first; callers hold mu
+func (s *approvals) sorted() []protocol.Approval {
+	list := make([]protocol.Approval, 0, len(s.byID))
+	for _, ap := range s.byID {
+		list = append(list, *ap)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CreatedAt != list[j].CreatedAt {
+			return list[i].CreatedAt < list[j].CreatedAt
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// gate decides a request a require_approval rule allowed. An approved approval
+// for the same caller and ref is used up and the request allowed; otherwise
+// the caller waits on the pending or denied one, or on a new one announced
+// through notify.
+func (s *approvals) gate(peerInfo security.PeerInfo, ref, action string) (protocol.Approval, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := s.expire()
+	defer func() {
+		if changed {
+			s.save()
+		}
+	}()
+
+	for id, ap := range s.byID {
+		if ap.PeerPath != peerInfo.Label() || ap.PeerUID != peerInfo.UID || ap.Ref != ref || ap.Action != action {
+			continue
+		}
+		if ap.State == protocol.ApprovalApproved {
+			delete(s.byID, id)
+			changed = true
+			return *ap, true
+		}
+		return *ap, false
+	}
+
+	now := s.now()
+	ap := &protocol.Approval{
+		ID:        newApprovalID(),
+		Ref:       ref,
+		Action:    action,
+		PeerPath:  peerInfo.Label(),
+		PeerPID:   peerInfo.PID,
+		PeerUID:   peerInfo.UID,
+		State:     protocol.ApprovalPending,
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(s.timeout).Unix(),
+	}
+	s.byID[ap.ID] = ap
+	changed = true
+	if s.notify != nil {
+		go s.notify(*ap)
+	}
+	return *ap, false
+}
+
+// decide approves or denies a pending approval. An approved one then waits
+// another timeout for the retry it allows.
+func (s *approvals) decide(id string, deny bool) (protocol.Approval, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.expire() {
+		defer s.save()
+	}
+	ap, ok := s.byID[id]
+	if !ok {
+		return protocol.Approval{}, errApprovalNotFound
+	}
+	if ap.State != protocol.ApprovalPending {
+		return *ap, errApprovalDecided
+	}
+	if deny {
+		ap.State = protocol.ApprovalDenied
+	} else {
+		ap.State = protocol.ApprovalApproved
+		ap.ExpiresAt = s.now().Add(s.timeout).Unix()
+	}
+	s.save()
+	return *ap, nil
+}
+
+// list returns the approvals that haven't expired or been used, oldest first
+func (s *approvals) list() []protocol.Approval {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.expire() {
+		s.save()
+	}
+	return s.sorted()
+}
+
+// newApprovalID returns a short random ID an admin can type into opx approve
+func newApprovalID() string {
+	var b [5]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// approvalNotifier runs hook with the approval in OPX_APPROVAL_* variables and
+// posts it as JSON to webhook; either may be empty. Failures are only logged.
+func approvalNotifier(hook, webhook string) func(protocol.Approval) {
+	if hook == "" && webhook == "" {
+		return nil
+	}
+	return func(ap protocol.Approval) {
+		ctx, cancel := context.WithTimeout(context.Background(), approvalNotifyTimeout)
+		defer cancel()
+		if hook != "" {
+			cmd := exec.CommandContext(ctx, "/bin/sh", "-c", hook)
+			cmd.Env = append(os.Environ(),
+				"OPX_APPROVAL_ID="+ap.ID,
+				"OPX_APPROVAL_REF="+ap.Ref,
+				"OPX_APPROVAL_ACTION="+ap.Action,
+				"OPX_APPROVAL_PEER_PATH="+ap.PeerPath,
+				"OPX_APPROVAL_PEER_PID="+strconv.Itoa(ap.PeerPID),
+				"OPX_APPROVAL_EXPIRES_AT="+time.Unix(ap.ExpiresAt, 0).UTC().Format(time.RFC3339),
+			)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				log.Printf("Warning: approval hook failed for %s: %v: %s", ap.ID, err, strings.TrimSpace(string(out)))
+			}
+		}
+		if webhook != "" {
+			if err := postApproval(ctx, webhook, ap); err != nil {
+				log.Printf("Warning: approval webhook failed for %s: %v", ap.ID, err)
+			}
+		}
+	}
+}
+
+// postApproval sends ap as JSON to url, failing on any non-2xx response
+func postApproval(ctx context.Context, url string, ap protocol.Approval) error {
+	body, err := json.Marshal(ap)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// checkApproval holds a request a require_approval rule allowed until an admin
+// approves it; each approval lets one retry through. Denied approvals are
+// policy denials until they expire.
+func (a *api) checkApproval(ctx context.Context, peerInfo security.PeerInfo, ref, action string) error {
+	if a.approvals == nil {
+		// Nothing can approve the request, so don't let it through
+		return &policyDenial{ref: ref, hint: "approval required, but this daemon takes no approvals"}
+	}
+	ap, allowed := a.approvals.gate(peerInfo, ref, action)
+
+	outcome := ap.State
+	if allowed {
+		outcome = "used"
+	}
+	if a.audit != nil {
+		details := map[string]string{
+			"subject_pid":  fmt.Sprintf("%d", peerInfo.PID),
+			"subject_path": peerInfo.Label(),
+			"approval_id":  ap.ID,
+			"approval":     outcome,
+		}
+		a.logAccessDecision(ctx, peerInfo, ref, action, allowed, details)
+	}
+	if a.verbose {
+		log.Printf("[security] %s approval %s %s: %s -> %s", action, ap.ID, outcome, peerInfo.String(), ref)
+	}
+
+	switch {
+	case allowed:
+		return nil
+	case ap.State == protocol.ApprovalDenied:
+		return &policyDenial{ref: ref, hint: "approval " + ap.ID + " was denied"}
+	}
+	return &approvalPending{id: ap.ID}
+}
+
+// writeApprovalError reports a request held for approval as 403 approval_required with the approval's ID
+func writeApprovalError(w http.ResponseWriter, prefix string, pending *approvalPending) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	_ = json.NewEncoder(w).Encode(protocol.ErrorResponse{Code: protocol.ErrCodeApprovalRequired, Message: prefix + pending.Error(), ApprovalID: pending.id})
+}
+
+// handleApprovals lists approvals waiting on an admin or on their retry
+func (a *api) handleApprovals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	resp := protocol.ApprovalsResponse{Approvals: []protocol.Approval{}}
+	if a.approvals != nil {
+		resp.Approvals = a.approvals.list()
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// handleApprovalDecide approves or denies a pending approval
+func (a *api) handleApprovalDecide(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req protocol.ApprovalDecisionRequest
+	if !a.decodeJSON(w, r, &req) {
+		return
+	}
+	id := strings.TrimSpace(req.ID)
+	if id == "" {
+		http.Error(w, "id required", http.StatusBadRequest)
+		return
+	}
+	if a.approvals == nil {
+		http.Error(w, errApprovalNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	ap, err := a.approvals.decide(id, req.Deny)
+	switch {
+	case errors.Is(err, errApprovalNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, errApprovalDecided):
+		http.Error(w, fmt.Sprintf("approval %s was already %s", id, ap.State), http.StatusConflict)
+		return
+	}
+	if a.verbose {
+		log.Printf("[security] approval %s %s: %s -> %s", ap.ID, ap.State, ap.PeerPath, ap.Ref)
+	}
+	_ = json.NewEncoder(w).Encode(ap)
+}
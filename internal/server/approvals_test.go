@@ -0,0 +1,246 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/backend"
+	"github.com/zach-source/opx/internal/cache"
+	"github.com/zach-source/opx/internal/policy"
+	"github.com/zach-source/opx/internal/protocol"
+	"github.com/zach-source/opx/internal/safestring"
+	"github.com/zach-source/opx/internal/security"
+)
+
+func TestApprovals_Gate(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	s := newApprovals("", time.Minute)
+	s.now = clock.now
+	notified := make(chan protocol.Approval, 4)
+	s.notify = func(ap protocol.Approval) { notified <- ap }
+	peer := security.PeerInfo{PID: 1, UID: 1000, Path: "/usr/bin/deploy"}
+	ref := "op://breakglass/root/password"
+
+	first, allowed := s.gate(peer, ref, policy.ActionRead)
+	if allowed || first.State != protocol.ApprovalPending || first.ID == "" {
+		t.Fatalf("Expected a new pending approval, got %+v allowed=%v", first, allowed)
+	}
+	select {
+	case ap := <-notified:
+		if ap.ID != first.ID || ap.Ref != ref || ap.PeerPath != peer.Path {
+			t.Errorf("Expected the new approval to be announced, got %+v", ap)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the new approval to be announced")
+	}
+
+	// A retry from another process of the same binary waits on the same approval
+	peer.PID = 2
+	if again, allowed := s.gate(peer, ref, policy.ActionRead); allowed || again.ID != first.ID {
+		t.Errorf("Expected the retry to wait on %s, got %+v allowed=%v", first.ID, again, allowed)
+	}
+	if other, _ := s.gate(peer, "op://breakglass/other/password", policy.ActionRead); other.ID == first.ID {
+		t.Error("Expected another ref to need its own approval")
+	}
+
+	// Grant: the next retry goes through, exactly once
+	if ap, err := s.decide(first.ID, false); err != nil || ap.State != protocol.ApprovalApproved {
+		t.Fatalf("Expected the approval to be approved, got %+v %v", ap, err)
+	}
+	if _, err := s.decide(first.ID, true); !errors.Is(err, errApprovalDecided) {
+		t.Errorf("Expected errApprovalDecided, got %v", err)
+	}
+	if ap, allowed := s.gate(peer, ref, policy.ActionRead); !allowed || ap.ID != first.ID {
+		t.Errorf("Expected the approved retry to be allowed, got %+v allowed=%v", ap, allowed)
+	}
+	second, allowed := s.gate(peer, ref, policy.ActionRead)
+	if allowed || second.ID == first.ID {
+		t.Errorf("Expected the approval to be used up, got %+v allowed=%v", second, allowed)
+	}
+	if _, err := s.decide(first.ID, false); !errors.Is(err, errApprovalNotFound) {
+		t.Errorf("Expected a used approval to be gone, got %v", err)
+	}
+
+	// Deny: retries stay denied until the approval expires
+	if _, err := s.decide(second.ID, true); err != nil {
+		t.Fatalf("decide failed: %v", err)
+	}
+	if ap, allowed := s.gate(peer, ref, policy.ActionRead); allowed || ap.State != protocol.ApprovalDenied {
+		t.Errorf("Expected the retry to be denied, got %+v allowed=%v", ap, allowed)
+	}
+
+	// Expiry: after the timeout a request starts a fresh approval
+	clock.advance(time.Minute)
+	third, allowed := s.gate(peer, ref, policy.ActionRead)
+	if allowed || third.ID == second.ID || third.State != protocol.ApprovalPending {
+		t.Errorf("Expected a fresh approval after expiry, got %+v allowed=%v", third, allowed)
+	}
+
+	// An approval granted but not retried within the timeout is gone too
+	if _, err := s.decide(third.ID, false); err != nil {
+		t.Fatalf("decide failed: %v", err)
+	}
+	clock.advance(time.Minute)
+	if ap, allowed := s.gate(peer, ref, policy.ActionRead); allowed || ap.ID == third.ID {
+		t.Errorf("Expected the expired approval not to allow, got %+v allowed=%v", ap, allowed)
+	}
+}
+
+func TestApprovals_Persist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "approvals.json")
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	peer := security.PeerInfo{PID: 1, UID: 1000, Path: "/usr/bin/deploy"}
+
+	s := newApprovals(path, time.Minute)
+	s.now = clock.now
+	ap, _ := s.gate(peer, "op://breakglass/root/password", policy.ActionRead)
+	if _, err := s.decide(ap.ID, false); err != nil {
+		t.Fatalf("decide failed: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("Expected approvals saved with mode 0600, got %v %v", info, err)
+	}
+
+	// A restarted daemon still honors the approval, once
+	restarted := newApprovals(path, time.Minute)
+	restarted.now = clock.now
+	if err := restarted.load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if got, allowed := restarted.gate(peer, ap.Ref, policy.ActionRead); !allowed || got.ID != ap.ID {
+		t.Errorf("Expected the loaded approval to allow, got %+v allowed=%v", got, allowed)
+	}
+
+	empty := newApprovals(filepath.Join(t.TempDir(), "missing.json"), time.Minute)
+	if err := empty.load(); err != nil || len(empty.list()) != 0 {
+		t.Errorf("Expected no approvals from a missing file, got %v", err)
+	}
+}
+
+func TestApprovalNotifier(t *testing.T) {
+	var body protocol.Approval
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(b, &body)
+	}))
+	defer ts.Close()
+
+	out := filepath.Join(t.TempDir(), "hook.out")
+	notify := approvalNotifier(`echo "$OPX_APPROVAL_ID $OPX_APPROVAL_REF $OPX_APPROVAL_EXPIRES_AT" > `+out, ts.URL)
+	ap := protocol.Approval{ID: "abc123", Ref: "op://breakglass/root/password", ExpiresAt: 1700000060}
+	notify(ap)
+
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Expected the hook to run: %v", err)
+	}
+	if expected := "abc123 op://breakglass/root/password 2023-11-14T22:14:20Z\n"; string(got) != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+	if body.ID != ap.ID || body.Ref != ap.Ref {
+		t.Errorf("Expected the webhook to receive the approval, got %+v", body)
+	}
+	if approvalNotifier("", "") != nil {
+		t.Error("Expected no notifier without a hook or webhook")
+	}
+}
+
+func TestAPI_ApprovalRequired(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	deploy := security.PeerInfo{PID: 1, UID: 1000, Path: "/usr/bin/deploy"}
+	admin := security.PeerInfo{PID: 2, UID: 1000, Path: "/usr/local/bin/opx"}
+	a := &api{
+		token:      safestring.New("tok"),
+		backend:    backend.Fake{},
+		cache:      cache.New(5 * time.Minute),
+		clock:      clock.now,
+		adminPaths: []string{admin.Path},
+		approvals:  newApprovals("", time.Minute),
+		policy: policy.Policy{
+			Allow: []policy.Rule{
+				{Path: deploy.Path, Refs: []string{"op://breakglass/*"}, RequireApproval: true},
+				{Path: deploy.Path, Refs: []string{"op://dev/*"}},
+			},
+			DefaultDeny: true,
+		},
+	}
+	a.approvals.now = clock.now
+	do := func(peer security.PeerInfo, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-OpAuthd-Token", "tok")
+		req = req.WithContext(context.WithValue(req.Context(), peerInfoKey, peer))
+		w := httptest.NewRecorder()
+		a.handler().ServeHTTP(w, req)
+		return w
+	}
+	read := func() (*httptest.ResponseRecorder, protocol.ErrorResponse) {
+		w := do(deploy, "POST", "/v1/read", `{"ref":"op://breakglass/root/password"}`)
+		var e protocol.ErrorResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &e)
+		return w, e
+	}
+
+	w, e := read()
+	if w.Code != http.StatusForbidden || e.Code != protocol.ErrCodeApprovalRequired || e.ApprovalID == "" {
+		t.Fatalf("Expected 403 approval_required with an ID, got %d %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(e.Message, "opx approve "+e.ApprovalID) {
+		t.Errorf("Expected the message to say how to approve, got %q", e.Message)
+	}
+	id := e.ApprovalID
+
+	// Refs under a rule without require_approval read as usual
+	if w := do(deploy, "POST", "/v1/read", `{"ref":"op://dev/api/key"}`); w.Code != http.StatusOK {
+		t.Errorf("Expected an ordinary read to succeed, got %d %s", w.Code, w.Body.String())
+	}
+	// Batch reads report the approval inline
+	w = do(deploy, "POST", "/v1/reads", `{"refs":["op://breakglass/root/password"]}`)
+	if !strings.Contains(w.Body.String(), "ERROR: approval required") || !strings.Contains(w.Body.String(), id) {
+		t.Errorf("Expected the batch read to name approval %s, got %s", id, w.Body.String())
+	}
+
+	// Listing and deciding are admin-only
+	if w := do(deploy, "GET", "/v1/approvals", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected non-admins to be refused, got %d", w.Code)
+	}
+	w = do(admin, "GET", "/v1/approvals", "")
+	var list protocol.ApprovalsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list.Approvals) != 1 || list.Approvals[0].ID != id || list.Approvals[0].State != protocol.ApprovalPending {
+		t.Fatalf("Expected approval %s pending, got %s", id, w.Body.String())
+	}
+	if w := do(admin, "POST", "/v1/approvals/decide", `{"id":"nope"}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown approval, got %d", w.Code)
+	}
+	if w := do(admin, "POST", "/v1/approvals/decide", `{"id":"`+id+`"}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected the approval to succeed, got %d %s", w.Code, w.Body.String())
+	}
+	if w := do(admin, "POST", "/v1/approvals/decide", `{"id":"`+id+`","deny":true}`); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 deciding twice, got %d", w.Code)
+	}
+
+	// One retry succeeds, the next needs a new approval
+	if w, _ := read(); w.Code != http.StatusOK {
+		t.Errorf("Expected the approved retry to succeed, got %d %s", w.Code, w.Body.String())
+	}
+	w, e = read()
+	if w.Code != http.StatusForbidden || e.ApprovalID == "" || e.ApprovalID == id {
+		t.Fatalf("Expected a new approval for the next read, got %d %s", w.Code, w.Body.String())
+	}
+
+	// A denied approval is a policy denial
+	if w := do(admin, "POST", "/v1/approvals/decide", `{"id":"`+e.ApprovalID+`","deny":true}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected the denial to succeed, got %d %s", w.Code, w.Body.String())
+	}
+	if w, e := read(); w.Code != http.StatusForbidden || e.Code != protocol.ErrCodePolicyDenied || !strings.Contains(e.Message, "was denied") {
+		t.Errorf("Expected 403 policy_denied, got %d %s", w.Code, w.Body.String())
+	}
+}
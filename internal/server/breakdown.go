@@ -0,0 +1,138 @@
+package server
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+// maxBreakdownKeys caps the distinct schemes and vaults tracked each; the rest share protocol.BreakdownOther
+const maxBreakdownKeys = 64
+
+// latencyWindow is how many recent reads per bucket the latency quantiles are estimated from
+const latencyWindow = 256
+
+// latencySamples keeps the most recent latencyWindow read durations in a ring
+type latencySamples struct {
+	ring  [latencyWindow]time.Duration
+	count int
+}
+
+func (l *latencySamples) add(d time.Duration) {
+	l.ring[l.count%latencyWindow] = d
+	l.count++
+}
+
+// quantile returns the nearest-rank q-quantile of the samples, or 0 without any
+func (l *latencySamples) quantile(q float64) time.Duration {
+	n := min(l.count, latencyWindow)
+	if n == 0 {
+		return 0
+	}
+	sorted := slices.Clone(l.ring[:n])
+	slices.Sort(sorted)
+	rank := int(math.Ceil(q*float64(n))) - 1
+	return sorted[max(0, min(rank, n-1))]
+}
+
+// trafficBucket accumulates the reads of one scheme or vault
+type trafficBucket struct {
+	requests, cacheHits, errors int64
+	latency                     latencySamples
+}
+
+func (b *trafficBucket) stats() protocol.TrafficStats {
+	return protocol.TrafficStats{
+		Requests:     b.requests,
+		CacheHits:    b.cacheHits,
+		Errors:       b.errors,
+		LatencyP50Ms: float64(b.latency.quantile(0.5)) / float64(time.Millisecond),
+		LatencyP95Ms: float64(b.latency.quantile(0.95)) / float64(time.Millisecond),
+	}
+}
+
+// breakdown counts reads per ref scheme and per op:// vault for /v1/status. A nil
+// breakdown records nothing.
+type breakdown struct {
+	maxKeys int
+
+	mu      sync.Mutex
+	schemes map[string]*trafficBucket
+	vaults  map[string]*trafficBucket
+}
+
+// newBreakdown tracks up to maxKeys schemes and maxKeys vaults before falling back to the other bucket
+func newBreakdown(maxKeys int) *breakdown {
+	return &breakdown{
+		maxKeys: maxKeys,
+		schemes: make(map[string]*trafficBucket),
+		vaults:  make(map[string]*trafficBucket),
+	}
+}
+
+// bucket returns the bucket for key, or the other bucket once maxKeys are taken; callers hold mu
+func (b *breakdown) bucket(m map[string]*trafficBucket, key string) *trafficBucket {
+	if t, ok := m[key]; ok {
+		return t
+	}
+	if len(m) >= b.maxKeys {
+		key = protocol.BreakdownOther
+		if t, ok := m[key]; ok {
+			return t
+		}
+	}
+	t := &trafficBucket{}
+	m[key] = t
+	return t
+}
+
+// record counts one read of ref that took d
+func (b *breakdown) record(ref string, fromCache bool, err error, d time.Duration) {
+	if b == nil {
+		return
+	}
+	scheme, _, found := strings.Cut(ref, "://")
+	if !found {
+		scheme = protocol.BreakdownOther
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	buckets := []*trafficBucket{b.bucket(b.schemes, scheme)}
+	if vault, ok := opVault(ref); ok {
+		buckets = append(buckets, b.bucket(b.vaults, vault))
+	}
+	for _, t := range buckets {
+		t.requests++
+		if err != nil {
+			t.errors++
+		} else if fromCache {
+			t.cacheHits++
+		}
+		t.latency.add(d)
+	}
+}
+
+// snapshot returns the counters for a status response, or nil when nothing is tracked
+func (b *breakdown) snapshot() *protocol.StatusBreakdown {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := &protocol.StatusBreakdown{
+		Schemes: make(map[string]protocol.TrafficStats, len(b.schemes)),
+		Vaults:  make(map[string]protocol.TrafficStats, len(b.vaults)),
+	}
+	for key, t := range b.schemes {
+		out.Schemes[key] = t.stats()
+	}
+	for key, t := range b.vaults {
+		out.Vaults[key] = t.stats()
+	}
+	return out
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/backend"
+	"github.com/zach-source/opx/internal/cache"
+	"github.com/zach-source/opx/internal/protocol"
+	"github.com/zach-source/opx/internal/safestring"
+)
+
+func TestBreakdown_Accounting(t *testing.T) {
+	b := newBreakdown(maxBreakdownKeys)
+	b.record("op://Prod/db/password", false, nil, 10*time.Millisecond)
+	b.record("op://Prod/db/password", true, nil, time.Millisecond)
+	b.record("op://Dev/api/key", false, errors.New("boom"), 5*time.Millisecond)
+	b.record("vault://secret/app#key", true, nil, time.Millisecond)
+
+	snap := b.snapshot()
+	tests := []struct {
+		name     string
+		got      protocol.TrafficStats
+		expected protocol.TrafficStats
+	}{
+		{name: "op scheme", got: snap.Schemes["op"], expected: protocol.TrafficStats{Requests: 3, CacheHits: 1, Errors: 1, LatencyP50Ms: 5, LatencyP95Ms: 10}},
+		{name: "vault scheme", got: snap.Schemes["vault"], expected: protocol.TrafficStats{Requests: 1, CacheHits: 1, LatencyP50Ms: 1, LatencyP95Ms: 1}},
+		{name: "Prod vault", got: snap.Vaults["Prod"], expected: protocol.TrafficStats{Requests: 2, CacheHits: 1, LatencyP50Ms: 1, LatencyP95Ms: 10}},
+		{name: "Dev vault", got: snap.Vaults["Dev"], expected: protocol.TrafficStats{Requests: 1, Errors: 1, LatencyP50Ms: 5, LatencyP95Ms: 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, tt.got)
+			}
+		})
+	}
+	if len(snap.Vaults) != 2 {
+		t.Errorf("Expected only op:// refs to count toward vaults, got %v", snap.Vaults)
+	}
+}
+
+func TestBreakdown_CardinalityCap(t *testing.T) {
+	b := newBreakdown(3)
+	for i := range 10 {
+		b.record(fmt.Sprintf("op://vault-%d/item/field", i), false, nil, time.Millisecond)
+	}
+	b.record("op://vault-0/item/field", false, nil, time.Millisecond)
+
+	snap := b.snapshot()
+	if len(snap.Vaults) != 4 {
+		t.Fatalf("Expected 3 vaults plus %q, got %v", protocol.BreakdownOther, snap.Vaults)
+	}
+	if got := snap.Vaults["vault-0"].Requests; got != 2 {
+		t.Errorf("Expected a tracked vault to keep counting after the cap, got %d", got)
+	}
+	if got := snap.Vaults[protocol.BreakdownOther].Requests; got != 7 {
+		t.Errorf("Expected 7 reads in the other bucket, got %d", got)
+	}
+	if got := snap.Schemes["op"].Requests; got != 11 {
+		t.Errorf("Expected 11 op reads, got %d", got)
+	}
+}
+
+func TestLatencySamples_Quantile(t *testing.T) {
+	var l latencySamples
+	if got := l.quantile(0.5); got != 0 {
+		t.Errorf("Expected 0 without samples, got %v", got)
+	}
+	for i := 100; i >= 1; i-- {
+		l.add(time.Duration(i) * time.Millisecond)
+	}
+	if got := l.quantile(0.5); got != 50*time.Millisecond {
+		t.Errorf("Expected p50 50ms, got %v", got)
+	}
+	if got := l.quantile(0.95); got != 95*time.Millisecond {
+		t.Errorf("Expected p95 95ms, got %v", got)
+	}
+
+	// Only the most recent window counts
+	for range latencyWindow {
+		l.add(time.Second)
+	}
+	if got := l.quantile(0.5); got != time.Second {
+		t.Errorf("Expected old samples to age out, got p50 %v", got)
+	}
+}
+
+func TestAPI_StatusBreakdown(t *testing.T) {
+	a := &api{token: safestring.New("tok"), backend: backend.Fake{}, cache: cache.New(time.Minute), breakdown: newBreakdown(maxBreakdownKeys)}
+	for range 2 {
+		if _, err := a.readOne(context.Background(), "op://Prod/db/password"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/v1/status", nil)
+	req.Header.Set("X-OpAuthd-Token", "tok")
+	w := httptest.NewRecorder()
+	a.handler().ServeHTTP(w, req)
+
+	var st protocol.Status
+	if err := json.Unmarshal(w.Body.Bytes(), &st); err != nil {
+		t.Fatalf("Failed to decode status: %v", err)
+	}
+	if st.Breakdown == nil {
+		t.Fatal("Expected a breakdown in status")
+	}
+	for name, stats := range map[string]protocol.TrafficStats{"scheme op": st.Breakdown.Schemes["op"], "vault Prod": st.Breakdown.Vaults["Prod"]} {
+		if stats.Requests != 2 || stats.CacheHits != 1 || stats.Errors != 0 {
+			t.Errorf("%s: expected 2 requests with 1 cache hit, got %+v", name, stats)
+		}
+	}
+}
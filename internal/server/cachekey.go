@@ -0,0 +1,85 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"slices"
+	"strings"
+)
+
+// cacheKeyFor builds the cache key for a read. A plain ref is its own key; a
+// read with a secret type or flags gets "|" and a SHA-256 of the type and the
+// sorted flags appended, so flag values never appear in keys and can't collide.
+// Refs containing "|" are always hashed so they can't mimic a suffixed key.
+func cacheKeyFor(ref, secretType string, flags []string) string {
+	if secretType == "" && len(flags) == 0 && !strings.Contains(ref, "|") {
+		return ref
+	}
+	return ref + "|" + keySignature(ref, secretType, flags)
+}
+
+// keySignature hashes ref, secretType and the sorted flags, each length-prefixed
+func keySignature(ref, secretType string, flags []string) string {
+	sorted := slices.Clone(flags)
+	slices.Sort(sorted)
+
+	h := sha256.New()
+	var n [8]byte
+	for _, part := range append([]string{ref, secretType}, sorted...) {
+		binary.BigEndian.PutUint64(n[:], uint64(len(part)))
+		h.Write(n[:])
+		h.Write([]byte(part))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// keyRef returns the ref a key built by cacheKeyFor was read from
+func keyRef(key string) string {
+	if i := strings.LastIndexByte(key, '|'); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+// descriptor renders src for listings with flag values redacted, e.g.
+// "op://v/i/f (type=vault, flags=--account=***,--reveal)"
+func (src refreshSource) descriptor() string {
+	var attrs []string
+	if src.secretType != "" {
+		attrs = append(attrs, "type="+src.secretType)
+	}
+	if len(src.flags) > 0 {
+		redacted := make([]string, len(src.flags))
+		for i, f := range src.flags {
+			switch name, _, hasValue := strings.Cut(f, "="); {
+			case hasValue:
+				redacted[i] = name + "=***"
+			case strings.HasPrefix(f, "-"):
+				redacted[i] = f
+			default:
+				redacted[i] = "***" // a flag's value passed as its own argument
+			}
+		}
+		attrs = append(attrs, "flags="+strings.Join(redacted, ","))
+	}
+	if len(attrs) == 0 {
+		return src.ref
+	}
+	return src.ref + " (" + strings.Join(attrs, ", ") + ")"
+}
+
+// keySource returns the read that produced key. Plain-ref keys describe
+// themselves; hashed keys are known only if rememberRefreshSource saw them.
+func (a *api) keySource(key string) (refreshSource, bool) {
+	a.mu.Lock()
+	src, ok := a.refreshSources[key]
+	a.mu.Unlock()
+	if ok {
+		return src, true
+	}
+	if !strings.Contains(key, "|") {
+		return refreshSource{ref: key}, true
+	}
+	return refreshSource{ref: keyRef(key)}, false
+}
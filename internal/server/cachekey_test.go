@@ -0,0 +1,85 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/cache"
+)
+
+func TestCacheKeyFor(t *testing.T) {
+	plain := cacheKeyFor("op://v/i/f", "", nil)
+	if plain != "op://v/i/f" {
+		t.Errorf("Expected a plain ref to be its own key, got %q", plain)
+	}
+
+	withAccount := cacheKeyFor("op://v/i/f", "", []string{"--account=acme-corp"})
+	if strings.Contains(withAccount, "acme-corp") {
+		t.Errorf("Expected flag values to stay out of the key, got %q", withAccount)
+	}
+	if keyRef(withAccount) != "op://v/i/f" {
+		t.Errorf("Expected the key to start with its ref, got %q", withAccount)
+	}
+
+	if cacheKeyFor("op://v/i/f", "", []string{"--a", "--b"}) != cacheKeyFor("op://v/i/f", "", []string{"--b", "--a"}) {
+		t.Error("Expected flag order not to change the key")
+	}
+}
+
+func TestCacheKeyFor_AdversarialFlags(t *testing.T) {
+	flagged := cacheKeyFor("op://v/i/f", "", []string{"--reveal"})
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{name: "comma inside a flag", a: cacheKeyFor("op://v/i/f", "", []string{"--x=1,--y=2"}), b: cacheKeyFor("op://v/i/f", "", []string{"--x=1", "--y=2"})},
+		{name: "separator inside a flag", a: cacheKeyFor("op://v/i/f", "", []string{"a|flags:b"}), b: cacheKeyFor("op://v/i/f", "", []string{"a", "b"})},
+		{name: "flag mimics the type", a: cacheKeyFor("op://v/i/f", "vault", nil), b: cacheKeyFor("op://v/i/f", "", []string{"vault"})},
+		{name: "empty flag", a: cacheKeyFor("op://v/i/f", "", []string{""}), b: cacheKeyFor("op://v/i/f", "", nil)},
+		{name: "length boundaries", a: cacheKeyFor("op://v/i/f", "", []string{"ab", "c"}), b: cacheKeyFor("op://v/i/f", "", []string{"a", "bc"})},
+		{name: "ref carries a suffix", a: flagged, b: cacheKeyFor(flagged, "", nil)},
+		{name: "ref mimics a flag", a: cacheKeyFor("op://v/i/f|--reveal", "", nil), b: flagged},
+	}
+
+	for _, tt := range tests {
+		if tt.a == tt.b {
+			t.Errorf("%s: expected distinct keys, both are %q", tt.name, tt.a)
+		}
+	}
+}
+
+func TestRefreshSource_Descriptor(t *testing.T) {
+	tests := []struct {
+		src      refreshSource
+		expected string
+	}{
+		{src: refreshSource{ref: "op://v/i/f"}, expected: "op://v/i/f"},
+		{src: refreshSource{ref: "secret/app", secretType: "vault"}, expected: "secret/app (type=vault)"},
+		{src: refreshSource{ref: "op://v/i/f", flags: []string{"--account=acme", "--reveal"}}, expected: "op://v/i/f (flags=--account=***,--reveal)"},
+		{src: refreshSource{ref: "op://v/i/f", flags: []string{"--account", "acme"}}, expected: "op://v/i/f (flags=--account,***)"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.src.descriptor(); got != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, got)
+		}
+	}
+}
+
+func TestAPI_KeySource(t *testing.T) {
+	a := &api{cache: cache.New(time.Minute)}
+	flagged := cacheKeyFor("op://v/i/f", "", []string{"--account=acme"})
+	a.rememberRefreshSource(flagged, refreshSource{ref: "op://v/i/f", flags: []string{"--account=acme"}})
+
+	if src, ok := a.keySource("op://v/i/f"); !ok || src.ref != "op://v/i/f" {
+		t.Errorf("Expected a plain key to describe itself, got %+v %t", src, ok)
+	}
+	if src, ok := a.keySource(flagged); !ok || len(src.flags) != 1 || src.flags[0] != "--account=acme" {
+		t.Errorf("Expected the remembered flags, got %+v %t", src, ok)
+	}
+	unknown := cacheKeyFor("op://v/i/g", "", []string{"--reveal"})
+	if src, ok := a.keySource(unknown); ok || src.ref != "op://v/i/g" {
+		t.Errorf("Expected an unknown hashed key to report only its ref, got %+v %t", src, ok)
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// bufferedResponseWriter captures a handler's response so its size can be inspected
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	buf    bytes.Buffer
+	status int
+}
+
+func (b *bufferedResponseWriter) Write(p []byte) (int, error) {
+	return b.buf.Write(p)
+}
+
+func (b *bufferedResponseWriter) WriteHeader(code int) {
+	b.status = code
+}
+
+// compress gzips responses of at least CompressMinBytes when the client sends Accept-Encoding: gzip.
+// Small responses are passed through untouched to avoid the compression overhead.
+func (a *api) compress(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.compressMinBytes <= 0 || !acceptsGzip(r) {
+			next(w, r)
+			return
+		}
+
+		bw := &bufferedResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next(bw, r)
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		body := bw.buf.Bytes()
+		if len(body) < a.compressMinBytes {
+			w.WriteHeader(bw.status)
+			_, _ = w.Write(body)
+			return
+		}
+
+		var gz bytes.Buffer
+		zw := gzip.NewWriter(&gz)
+		if _, err := zw.Write(body); err != nil || zw.Close() != nil {
+			// Fall back to the uncompressed body
+			w.WriteHeader(bw.status)
+			_, _ = w.Write(body)
+			return
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Del("Content-Length")
+		w.WriteHeader(bw.status)
+		_, _ = w.Write(gz.Bytes())
+	}
+}
+
+// acceptsGzip reports whether the request advertises gzip support (with a non-zero q-value)
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(part, ";")
+		if strings.TrimSpace(params[0]) != "gzip" {
+			continue
+		}
+		for _, p := range params[1:] {
+			if q, ok := strings.CutPrefix(strings.TrimSpace(p), "q="); ok {
+				if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
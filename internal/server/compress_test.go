@@ -0,0 +1,141 @@
+package server
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/backend"
+	"github.com/zach-source/opx/internal/cache"
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+// batchBody builds a reads request for n distinct refs
+func batchBody(n int) string {
+	refs := make([]string, n)
+	for i := range refs {
+		refs[i] = "op://vault/item" + strings.Repeat("x", i%7) + "/field" + string(rune('a'+i%26))
+	}
+	b, _ := json.Marshal(protocol.ReadsRequest{Refs: refs})
+	return string(b)
+}
+
+func newCompressServer(minBytes int) *httptest.Server {
+	srv := &api{
+		backend:          backend.Fake{},
+		cache:            cache.New(5 * time.Minute),
+		compressMinBytes: minBytes,
+	}
+	return httptest.NewServer(srv.compress(srv.handleReads))
+}
+
+func TestCompress_RoundTripLargeResponse(t *testing.T) {
+	ts := newCompressServer(256)
+	defer ts.Close()
+
+	// The default transport adds Accept-Encoding: gzip and transparently decompresses
+	resp, err := http.Post(ts.URL, "application/json", strings.NewReader(batchBody(50)))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if !resp.Uncompressed {
+		t.Error("Expected response to have been gzip-compressed and decompressed by the transport")
+	}
+	var reads protocol.ReadsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&reads); err != nil {
+		t.Fatalf("Failed to decode decompressed response: %v", err)
+	}
+	if len(reads.Results) == 0 {
+		t.Error("Expected results in decompressed response")
+	}
+}
+
+func TestCompress_RawGzipEncoding(t *testing.T) {
+	ts := newCompressServer(256)
+	defer ts.Close()
+
+	req, _ := http.NewRequest("POST", ts.URL, strings.NewReader(batchBody(50)))
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := (&http.Client{Transport: &http.Transport{DisableCompression: true}}).Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected gzip Content-Encoding, got %q", resp.Header.Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("Invalid gzip body: %v", err)
+	}
+	body, _ := io.ReadAll(zr)
+	if !json.Valid(body) {
+		t.Error("Expected valid JSON after decompression")
+	}
+}
+
+func TestCompress_BelowThreshold(t *testing.T) {
+	ts := newCompressServer(1 << 20)
+	defer ts.Close()
+
+	req, _ := http.NewRequest("POST", ts.URL, strings.NewReader(batchBody(2)))
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := (&http.Client{Transport: &http.Transport{DisableCompression: true}}).Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Content-Encoding") != "" {
+		t.Error("Expected small response to be sent uncompressed")
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !json.Valid(body) {
+		t.Error("Expected plain JSON body")
+	}
+}
+
+func TestCompress_WithoutAcceptEncoding(t *testing.T) {
+	ts := newCompressServer(1)
+	defer ts.Close()
+
+	req, _ := http.NewRequest("POST", ts.URL, strings.NewReader(batchBody(50)))
+	resp, err := (&http.Client{Transport: &http.Transport{DisableCompression: true}}).Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Content-Encoding") != "" {
+		t.Error("Expected no compression when client does not accept gzip")
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip", true},
+		{"gzip;q=0.5", true},
+		{"gzip;q=0", false},
+		{"br", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", tt.header)
+		if got := acceptsGzip(r); got != tt.expected {
+			t.Errorf("acceptsGzip(%q) = %v, expected %v", tt.header, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/zach-source/opx/internal/util"
+)
+
+// errExpansionDisabled is returned when a request sends vars to a daemon that doesn't expand refs
+var errExpansionDisabled = errors.New("ref variable expansion is disabled on this daemon (expand_ref_vars)")
+
+// allowVars rejects a request that sends vars while expansion is disabled
+func (a *api) allowVars(w http.ResponseWriter, vars map[string]string) bool {
+	if len(vars) > 0 && !a.expandRefVars {
+		http.Error(w, errExpansionDisabled.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// expandRef fills ${VAR} and $VAR in ref from the request's vars when the daemon
+// expands refs, and returns ref unchanged otherwise. The daemon's own environment
+// is never consulted; policy, cache and backend all see the expanded ref.
+func (a *api) expandRef(ref string, vars map[string]string) (string, error) {
+	if !a.expandRefVars {
+		return ref, nil
+	}
+	return util.ExpandRefVars(ref, vars)
+}
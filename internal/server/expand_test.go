@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/backend"
+	"github.com/zach-source/opx/internal/cache"
+	"github.com/zach-source/opx/internal/protocol"
+	"github.com/zach-source/opx/internal/safestring"
+)
+
+func TestAPI_ExpandRefVars(t *testing.T) {
+	billing, _ := backend.Fake{}.ReadRef(nil, "op://dev/billing/password")
+
+	tests := []struct {
+		name         string
+		expand       bool
+		path         string
+		body         string
+		expectStatus int
+		expectBody   string
+	}{
+		{
+			name: "read expands", expand: true, path: "/v1/read",
+			body:         `{"ref":"op://dev/${APP}/password","vars":{"APP":"billing"}}`,
+			expectStatus: http.StatusOK, expectBody: `"value":"` + billing + `"`,
+		},
+		{
+			name: "reads keep the ref as sent", expand: true, path: "/v1/reads",
+			body:         `{"refs":["op://dev/$APP/password"],"vars":{"APP":"billing"}}`,
+			expectStatus: http.StatusOK, expectBody: `"op://dev/$APP/password":{"ref":"op://dev/billing/password","value":"` + billing + `"`,
+		},
+		{
+			name: "resolve expands", expand: true, path: "/v1/resolve",
+			body:         `{"env":{"DB":"op://dev/${APP}/password"},"vars":{"APP":"billing"}}`,
+			expectStatus: http.StatusOK, expectBody: `"DB":"` + billing + `"`,
+		},
+		{
+			name: "read missing var", expand: true, path: "/v1/read",
+			body:         `{"ref":"op://dev/${APP}/password"}`,
+			expectStatus: http.StatusBadRequest, expectBody: "unresolved variable APP",
+		},
+		{
+			name: "reads missing var", expand: true, path: "/v1/reads",
+			body:         `{"refs":["op://dev/${APP}/password"],"vars":{"OTHER":"x"}}`,
+			expectStatus: http.StatusOK, expectBody: `"value":"ERROR: unresolved variable APP`,
+		},
+		{
+			name: "resolve missing var", expand: true, path: "/v1/resolve",
+			body:         `{"env":{"DB":"op://dev/${APP}/password"}}`,
+			expectStatus: http.StatusBadRequest, expectBody: "resolve DB: unresolved variable APP",
+		},
+		{
+			name: "off by default leaves refs alone", path: "/v1/read",
+			body:         `{"ref":"op://dev/${APP}/password"}`,
+			expectStatus: http.StatusOK, expectBody: `"ref":"op://dev/${APP}/password"`,
+		},
+		{
+			name: "off by default rejects vars", path: "/v1/resolve",
+			body:         `{"env":{"DB":"op://dev/${APP}/password"},"vars":{"APP":"billing"}}`,
+			expectStatus: http.StatusBadRequest, expectBody: "expansion is disabled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &api{token: safestring.New("tok"), backend: backend.Fake{}, cache: cache.New(time.Minute), expandRefVars: tt.expand}
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("X-OpAuthd-Token", "tok")
+			w := httptest.NewRecorder()
+			a.handler().ServeHTTP(w, req)
+
+			if w.Code != tt.expectStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectStatus, w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.expectBody) {
+				t.Errorf("Expected body containing %s, got %s", tt.expectBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAPI_ExpandedRefIsCached(t *testing.T) {
+	a := &api{backend: backend.Fake{}, cache: cache.New(time.Minute), expandRefVars: true}
+	req := httptest.NewRequest("POST", "/v1/read", strings.NewReader(`{"ref":"op://dev/${APP}/password","vars":{"APP":"billing"}}`))
+	w := httptest.NewRecorder()
+	a.handleRead(w, req)
+
+	var rr protocol.ReadResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &rr); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if rr.Ref != "op://dev/billing/password" {
+		t.Errorf("Expected the expanded ref in the response, got %q", rr.Ref)
+	}
+	if !a.cache.Has("op://dev/billing/password") {
+		t.Error("Expected the cache to be keyed by the expanded ref")
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/zach-source/opx/internal/policy"
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+// handlePolicyExplain evaluates the policy for a subject and ref without reading
+// anything, returning each rule's verdict; admin-gated since it reveals the rules
+func (a *api) handlePolicyExplain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req protocol.PolicyExplainRequest
+	if !a.decodeJSON(w, r, &req) {
+		return
+	}
+	ref := strings.TrimSpace(req.Ref)
+	if ref == "" {
+		http.Error(w, "ref required", http.StatusBadRequest)
+		return
+	}
+	action := strings.ToLower(req.Action)
+	if action == "" {
+		action = policy.ActionRead
+	}
+	if !slices.Contains(policy.Actions, action) {
+		http.Error(w, "unknown action "+req.Action, http.StatusBadRequest)
+		return
+	}
+
+	subject := policy.Subject{PID: req.PID, Path: req.Path, ContainerPath: req.ContainerPath, ContainerID: req.ContainerID, CertCN: req.CertCN}
+	if subject == (policy.Subject{}) {
+		peerInfo, _ := peerFromContext(r.Context())
+		subject = subjectOf(peerInfo)
+	}
+
+	pol := a.currentPolicy()
+	e := policy.ExplainAt(pol, subject, ref, action, a.now())
+	resp := protocol.PolicyExplainResponse{
+		Ref:         ref,
+		Action:      action,
+		SubjectPath: subject.Path,
+		SubjectPID:  subject.PID,
+		PolicyPath:  a.policyPath,
+		DefaultDeny: pol.DefaultDeny,
+		Rules:       make([]protocol.PolicyRuleTrace, 0, len(e.Rules)),
+		Allowed:     e.Allowed,
+		Reason:      e.Reason,
+		Message:     e.Message,
+	}
+	resp.SubjectContainerPath, resp.SubjectContainerID = subject.ContainerPath, subject.ContainerID
+	resp.SubjectCertCN = subject.CertCN
+	for _, t := range e.Rules {
+		resp.Rules = append(resp.Rules, protocol.PolicyRuleTrace{Index: t.Index, Rule: t.Rule.String(), Matched: t.Matched, Reason: t.Reason})
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
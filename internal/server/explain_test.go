@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/backend"
+	"github.com/zach-source/opx/internal/cache"
+	"github.com/zach-source/opx/internal/policy"
+	"github.com/zach-source/opx/internal/protocol"
+	"github.com/zach-source/opx/internal/safestring"
+	"github.com/zach-source/opx/internal/security"
+)
+
+func TestAPI_PolicyExplain(t *testing.T) {
+	opx := security.PeerInfo{PID: 7, UID: 1000, Path: "/usr/local/bin/opx"}
+	other := security.PeerInfo{PID: 8, UID: 1000, Path: "/usr/bin/tool"}
+	pol := policy.Policy{
+		Allow: []policy.Rule{
+			{Path: "/usr/bin/tool", Refs: []string{"op://dev/*"}},
+			{Path: "/usr/bin/deploy", Refs: []string{"op://prod/*"}, Message: "ask for prod"},
+		},
+		DefaultDeny: true,
+	}
+
+	tests := []struct {
+		name    string
+		peer    security.PeerInfo
+		body    string
+		code    int
+		allowed bool
+		path    string
+		rules   int
+		message string
+	}{
+		{name: "defaults to the caller", peer: opx, body: `{"ref":"op://dev/db/password"}`, code: http.StatusOK, path: opx.Path, rules: 2},
+		{name: "explicit subject allowed", peer: opx, body: `{"ref":"op://dev/db/password","path":"/usr/bin/tool"}`, code: http.StatusOK, allowed: true, path: "/usr/bin/tool", rules: 1},
+		{name: "hint for applicable rule", peer: opx, body: `{"ref":"op://dev/db/password","path":"/usr/bin/deploy"}`, code: http.StatusOK, path: "/usr/bin/deploy", rules: 2, message: "ask for prod"},
+		{name: "missing ref", peer: opx, body: `{}`, code: http.StatusBadRequest},
+		{name: "unknown action", peer: opx, body: `{"ref":"op://dev/db/password","action":"delete"}`, code: http.StatusBadRequest},
+		{name: "non-admin denied", peer: other, body: `{"ref":"op://dev/db/password"}`, code: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &api{
+				token:      safestring.New("tok"),
+				backend:    backend.Fake{},
+				cache:      cache.New(5 * time.Minute),
+				policy:     pol,
+				policyPath: "/etc/opx/policy.json",
+				adminPaths: []string{opx.Path},
+			}
+			req := httptest.NewRequest("POST", "/v1/policy/explain", strings.NewReader(tt.body))
+			req.Header.Set("X-OpAuthd-Token", "tok")
+			req = req.WithContext(context.WithValue(req.Context(), peerInfoKey, tt.peer))
+			w := httptest.NewRecorder()
+			a.handler().ServeHTTP(w, req)
+			if w.Code != tt.code {
+				t.Fatalf("Expected status %d, got %d: %s", tt.code, w.Code, w.Body.String())
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+
+			var resp protocol.PolicyExplainResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Allowed != tt.allowed {
+				t.Errorf("Expected allowed %t, got %t", tt.allowed, resp.Allowed)
+			}
+			if resp.SubjectPath != tt.path {
+				t.Errorf("Expected subject path %q, got %q", tt.path, resp.SubjectPath)
+			}
+			if len(resp.Rules) != tt.rules {
+				t.Errorf("Expected %d rule traces, got %d", tt.rules, len(resp.Rules))
+			}
+			if resp.Message != tt.message {
+				t.Errorf("Expected message %q, got %q", tt.message, resp.Message)
+			}
+			if resp.Action != policy.ActionRead || resp.PolicyPath != "/etc/opx/policy.json" || !resp.DefaultDeny {
+				t.Errorf("Unexpected response header fields: %+v", resp)
+			}
+		})
+	}
+}
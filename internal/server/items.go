@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/zach-source/opx/internal/backend"
+)
+
+// itemGroup is the uncached refs of a batch that name fields of the same item
+type itemGroup struct {
+	vault, item string
+	flags       []string
+	fields      []string
+	refs        map[string]string // field -> ref
+}
+
+// prefetchItems reads uncached op:// refs that share an item with one backend call
+// per item and returns results for the refs it read. Callers pass only refs that
+// checkReadAccess already let through. Refs it skips, and fields the backend
+// didn't return, are left to readAllowed.
+func (a *api) prefetchItems(ctx context.Context, refs, flags []string) map[string]readResult {
+	reader, ok := a.backend.(backend.ItemFieldsReader)
+	if !ok {
+		return nil
+	}
+	groups := a.itemGroups(refs, flags)
+	if len(groups) == 0 {
+		return nil
+	}
+
+	out := make(map[string]readResult)
+	timing := timingFromContext(ctx)
+	for _, g := range groups {
+		ctx2, cancel := withTimeout(ctx, a.backendReadTimeout)
+		start := time.Now()
+		values, err := reader.ReadItemFields(ctx2, g.vault, g.item, g.fields, g.flags)
+		elapsed := time.Since(start)
+		timing.addBackend(start)
+		cancel()
+		if err != nil {
+			if a.verbose {
+				log.Printf("batch read of op://%s/%s fields failed, reading them one by one: %v", g.vault, g.item, err)
+			}
+			continue
+		}
+		for field, v := range values {
+			if ref, ok := g.refs[field]; ok {
+				out[ref] = a.storeItemField(ref, g.flags, v, elapsed)
+			}
+		}
+	}
+	return out
+}
+
+// storeItemField caches one field of an item read and records it as a single
+// backend read of ref would be, including the value size limit
+func (a *api) storeItemField(ref string, flags []string, v string, elapsed time.Duration) (res readResult) {
+	defer func() {
+		a.breakdown.record(ref, false, res.err, elapsed)
+		if res.err == nil {
+			a.recentRefs.record(ref)
+		}
+	}()
+	a.cache.IncMiss()
+	if err := a.checkValueSize(ref, v); err != nil {
+		return readResult{err: err}
+	}
+	key := cacheKeyFor(ref, "", flags)
+	if err := a.cache.Set(key, v); err != nil {
+		return readResult{err: err}
+	}
+	a.rememberRefreshSource(key, refreshSource{ref: ref, flags: flags})
+	return readResult{rr: a.freshResponse(ref, backend.SecretResult{Value: v})}
+}
+
+// itemGroups collects uncached op://vault/item/field refs by item, keeping
+// only items with at least two fields to read
+func (a *api) itemGroups(refs, flags []string) []*itemGroup {
+	byItem := make(map[string]*itemGroup)
+	var order []string
+	for _, ref := range refs {
+		ref = strings.TrimSpace(ref)
+		vault, item, field, ok := backend.SplitItemRef(ref)
+		if !ok {
+			continue
+		}
+		refFlags := a.withVaultAccount(ref, flags)
+		if a.cache.Tombstoned(ref) || a.cache.Has(cacheKeyFor(ref, "", refFlags)) {
+			continue
+		}
+		id := cacheKeyFor("op://"+vault+"/"+item, "", refFlags)
+		g, ok := byItem[id]
+		if !ok {
+			g = &itemGroup{vault: vault, item: item, flags: refFlags, refs: make(map[string]string)}
+			byItem[id] = g
+			order = append(order, id)
+		}
+		if _, dup := g.refs[field]; !dup {
+			g.refs[field] = ref
+			g.fields = append(g.fields, field)
+		}
+	}
+
+	var groups []*itemGroup
+	for _, id := range order {
+		if g := byItem[id]; len(g.fields) >= 2 {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/backend"
+	"github.com/zach-source/opx/internal/cache"
+	"github.com/zach-source/opx/internal/policy"
+	"github.com/zach-source/opx/internal/protocol"
+	"github.com/zach-source/opx/internal/safestring"
+	"github.com/zach-source/opx/internal/security"
+)
+
+// itemsBackend records single reads and item field reads on top of a Fake
+type itemsBackend struct {
+	backend.Fake
+	mu          sync.Mutex
+	reads       []string
+	itemReads   []string
+	missingItem string // ReadItemFields returns nothing for this item
+}
+
+func (b *itemsBackend) ReadRefWithFlags(ctx context.Context, ref string, flags []string) (string, error) {
+	b.mu.Lock()
+	b.reads = append(b.reads, ref)
+	b.mu.Unlock()
+	return b.Fake.ReadRefWithFlags(ctx, ref, flags)
+}
+
+func (b *itemsBackend) ReadItemFields(ctx context.Context, vault, item string, fields []string, flags []string) (map[string]string, error) {
+	b.mu.Lock()
+	b.itemReads = append(b.itemReads, vault+"/"+item+":"+strings.Join(fields, ","))
+	b.mu.Unlock()
+	if item == b.missingItem {
+		return map[string]string{}, nil
+	}
+	return b.Fake.ReadItemFields(ctx, vault, item, fields, flags)
+}
+
+func postReads(t *testing.T, a *api, refs []string, peer *security.PeerInfo) protocol.ReadsResponse {
+	t.Helper()
+	body, _ := json.Marshal(protocol.ReadsRequest{Refs: refs})
+	req := httptest.NewRequest("POST", "/v1/reads", strings.NewReader(string(body)))
+	if peer != nil {
+		req = req.WithContext(context.WithValue(req.Context(), peerInfoKey, *peer))
+	}
+	w := httptest.NewRecorder()
+	a.handleReads(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp protocol.ReadsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return resp
+}
+
+func TestAPI_ReadsCombinesFieldsOfOneItem(t *testing.T) {
+	be := &itemsBackend{}
+	a := &api{token: safestring.New("tok"), backend: be, cache: cache.New(time.Minute)}
+	refs := []string{"op://dev/db/username", "op://dev/db/password", "op://dev/api/token", "op://dev/db/username"}
+
+	resp := postReads(t, a, refs, nil)
+
+	if len(be.itemReads) != 1 || be.itemReads[0] != "dev/db:username,password" {
+		t.Errorf("Expected one item read of dev/db, got %v", be.itemReads)
+	}
+	if len(be.reads) != 1 || be.reads[0] != "op://dev/api/token" {
+		t.Errorf("Expected a single read only for the lone field, got %v", be.reads)
+	}
+	for _, ref := range refs {
+		want, _ := backend.Fake{}.ReadRef(context.Background(), ref)
+		if got := resp.Results[ref]; got.Value != want || got.FromCache {
+			t.Errorf("%s: expected fresh value %q, got %+v", ref, want, got)
+		}
+	}
+
+	// The combined read fills the cache like single reads do
+	resp = postReads(t, a, refs[:2], nil)
+	if len(be.itemReads) != 1 || len(be.reads) != 1 {
+		t.Errorf("Expected the second batch to come from the cache, got item reads %v and reads %v", be.itemReads, be.reads)
+	}
+	if !resp.Results["op://dev/db/password"].FromCache {
+		t.Error("Expected a cache hit for a field read by the combined call")
+	}
+}
+
+func TestAPI_ReadsFallsBackForMissingFields(t *testing.T) {
+	be := &itemsBackend{missingItem: "db"}
+	a := &api{token: safestring.New("tok"), backend: be, cache: cache.New(time.Minute)}
+
+	resp := postReads(t, a, []string{"op://dev/db/username", "op://dev/db/password"}, nil)
+
+	if len(be.reads) != 2 {
+		t.Errorf("Expected single reads for fields the item read didn't return, got %v", be.reads)
+	}
+	if strings.HasPrefix(resp.Results["op://dev/db/password"].Value, "ERROR") {
+		t.Errorf("Expected a value, got %q", resp.Results["op://dev/db/password"].Value)
+	}
+}
+
+func TestAPI_ReadsCombinedReadHonorsPolicy(t *testing.T) {
+	be := &itemsBackend{}
+	a := &api{
+		token:   safestring.New("tok"),
+		backend: be,
+		cache:   cache.New(time.Minute),
+		policy: policy.Policy{
+			Allow:       []policy.Rule{{Path: "/usr/bin/app", Refs: []string{"op://dev/db/username", "op://dev/db/password"}}},
+			DefaultDeny: true,
+		},
+	}
+	peer := security.PeerInfo{PID: 7, Path: "/usr/bin/app"}
+
+	resp := postReads(t, a, []string{"op://dev/db/username", "op://dev/db/password", "op://dev/db/otp"}, &peer)
+
+	if len(be.itemReads) != 1 || be.itemReads[0] != "dev/db:username,password" {
+		t.Errorf("Expected the denied field to stay out of the item read, got %v", be.itemReads)
+	}
+	if got := resp.Results["op://dev/db/otp"]; !strings.Contains(got.Value, "access denied by policy") || !strings.Contains(got.Error, "access denied by policy") {
+		t.Errorf("Expected the denied ref to fail, got %+v", got)
+	}
+}
+
+func TestAPI_ReadsCombinedReadHonorsQuota(t *testing.T) {
+	be := &itemsBackend{}
+	c := cache.New(time.Minute)
+	a := &api{
+		token:   safestring.New("tok"),
+		backend: be,
+		cache:   c,
+		policy: policy.Policy{
+			Allow: []policy.Rule{
+				{Path: "/usr/bin/app", Refs: []string{"op://dev/db/username", "op://dev/db/password"}},
+				{Path: "/usr/bin/app", Refs: []string{"op://dev/db/otp"}, MaxReads: 1, Per: "1h"},
+			},
+			DefaultDeny: true,
+		},
+		quotas: newQuotas(),
+	}
+	peer := security.PeerInfo{PID: 7, Path: "/usr/bin/app"}
+	refs := []string{"op://dev/db/username", "op://dev/db/password", "op://dev/db/otp"}
+
+	resp := postReads(t, a, refs, &peer)
+	if len(be.itemReads) != 1 || be.itemReads[0] != "dev/db:username,password,otp" {
+		t.Fatalf("Expected one item read of all three fields, got %v", be.itemReads)
+	}
+	if got := resp.Results["op://dev/db/otp"].Value; strings.HasPrefix(got, "ERROR") {
+		t.Fatalf("Expected the first otp read within its quota, got %q", got)
+	}
+
+	// With the quota used up, the otp field stays out of the item read and its cache entry
+	c.Clear()
+	resp = postReads(t, a, refs, &peer)
+	if len(be.itemReads) != 2 || be.itemReads[1] != "dev/db:username,password" {
+		t.Errorf("Expected the over-quota field to stay out of the item read, got %v", be.itemReads)
+	}
+	if len(be.reads) != 0 {
+		t.Errorf("Expected no single reads, got %v", be.reads)
+	}
+	if got := resp.Results["op://dev/db/otp"].Value; !strings.Contains(got, "quota exceeded") {
+		t.Errorf("Expected the otp read to exceed its quota, got %q", got)
+	}
+	if a.cache.Has("op://dev/db/otp") {
+		t.Error("Expected the over-quota ref not to be cached")
+	}
+	if got := resp.Results["op://dev/db/password"].Value; strings.HasPrefix(got, "ERROR") {
+		t.Errorf("Expected the other fields to be read, got %q", got)
+	}
+}
+
+func TestAPI_ReadsCombinedReadBookkeeping(t *testing.T) {
+	be := &itemsBackend{}
+	c := cache.New(time.Minute)
+	a := &api{token: safestring.New("tok"), backend: be, cache: c, breakdown: newBreakdown(8), recentRefs: newRecentRefs("", 8, time.Hour)}
+	refs := []string{"op://dev/db/username", "op://dev/db/password"}
+
+	postReads(t, a, refs, nil)
+	if got := a.breakdown.snapshot().Vaults["dev"]; got.Requests != 2 || got.Errors != 0 {
+		t.Errorf("Expected two reads of vault dev in the breakdown, got %+v", got)
+	}
+	if got := a.recentRefs.list(10, func(string) bool { return true }); len(got) != 2 {
+		t.Errorf("Expected both fields among recent refs, got %v", got)
+	}
+
+	// Fields over max_value_bytes fail like single reads do, without a second backend read
+	c.Clear()
+	c.SetMaxValueBytes(4)
+	resp := postReads(t, a, refs, nil)
+	for _, ref := range refs {
+		if got := resp.Results[ref].Value; !strings.Contains(got, "max_value_bytes") {
+			t.Errorf("%s: expected a value too large error, got %q", ref, got)
+		}
+		if a.cache.Has(ref) {
+			t.Errorf("%s: expected an oversized value not to be cached", ref)
+		}
+	}
+	if len(be.itemReads) != 2 || len(be.reads) != 0 {
+		t.Errorf("Expected only item reads, got item reads %v and reads %v", be.itemReads, be.reads)
+	}
+	if got := a.breakdown.snapshot().Vaults["dev"]; got.Errors != 2 {
+		t.Errorf("Expected the oversized fields counted as errors, got %+v", got)
+	}
+}
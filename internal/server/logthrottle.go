@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// accessLogWindow is how long identical access-decision log lines are collapsed into one
+const accessLogWindow = time.Minute
+
+// logThrottle writes the first of a run of identical log lines per window and
+// summarises the rest. Only the human log is throttled; audit events are not.
+type logThrottle struct {
+	window time.Duration
+	now    func() time.Time
+	logf   func(format string, args ...any)
+
+	mu      sync.Mutex
+	entries map[string]*throttleEntry
+}
+
+// throttleEntry tracks one distinct log line within its current window
+type throttleEntry struct {
+	line       string
+	start      time.Time
+	suppressed int
+}
+
+// newLogThrottle creates a throttle writing through log.Printf
+func newLogThrottle(window time.Duration) *logThrottle {
+	return &logThrottle{
+		window:  window,
+		now:     time.Now,
+		logf:    log.Printf,
+		entries: make(map[string]*throttleEntry),
+	}
+}
+
+// Log writes line unless it was already written within the window, in which case it is counted
+func (t *logThrottle) Log(line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if e, ok := t.entries[line]; ok {
+		if now.Sub(e.start) < t.window {
+			e.suppressed++
+			return
+		}
+		t.summarise(e)
+	}
+	t.entries[line] = &throttleEntry{line: line, start: now}
+	t.logf("%s", line)
+}
+
+// Flush summarises and forgets every line whose window has ended
+func (t *logThrottle) Flush() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	for line, e := range t.entries {
+		if now.Sub(e.start) < t.window {
+			continue
+		}
+		t.summarise(e)
+		delete(t.entries, line)
+	}
+}
+
+// summarise logs how many copies of e were suppressed, if any
+func (t *logThrottle) summarise(e *throttleEntry) {
+	if e.suppressed == 0 {
+		return
+	}
+	t.logf("%s (%d more suppressed in the last %s)", e.line, e.suppressed, t.window)
+}
+
+// run flushes the throttle every window until ctx is done
+func (t *logThrottle) run(ctx context.Context) {
+	ticker := time.NewTicker(t.window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			t.Flush()
+			return
+		case <-ticker.C:
+			t.Flush()
+		}
+	}
+}
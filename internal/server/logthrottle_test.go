@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// recordingThrottle returns a throttle on a fake clock that records what it logs
+func recordingThrottle(window time.Duration) (*logThrottle, *fakeClock, *[]string) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	var lines []string
+	t := newLogThrottle(window)
+	t.now = clock.now
+	t.logf = func(format string, args ...any) { lines = append(lines, fmt.Sprintf(format, args...)) }
+	return t, clock, &lines
+}
+
+func TestLogThrottle_SuppressesRepeats(t *testing.T) {
+	throttle, clock, lines := recordingThrottle(time.Minute)
+	denied := "[security] read denied: pid=1 -> op://v/i/f"
+	other := "[security] read denied: pid=2 -> op://v/i/f"
+
+	for i := 0; i < 5; i++ {
+		throttle.Log(denied)
+	}
+	throttle.Log(other)
+
+	expected := []string{denied, other}
+	if !reflect.DeepEqual(*lines, expected) {
+		t.Fatalf("Expected %v, got %v", expected, *lines)
+	}
+	if got := throttle.entries[denied].suppressed; got != 4 {
+		t.Errorf("Expected 4 suppressed lines, got %d", got)
+	}
+
+	// The next copy after the window logs the summary, then starts a new window
+	clock.advance(time.Minute)
+	throttle.Log(denied)
+	expected = append(expected, denied+" (4 more suppressed in the last 1m0s)", denied)
+	if !reflect.DeepEqual(*lines, expected) {
+		t.Errorf("Expected %v, got %v", expected, *lines)
+	}
+	if got := throttle.entries[denied].suppressed; got != 0 {
+		t.Errorf("Expected counter reset in the new window, got %d", got)
+	}
+}
+
+func TestLogThrottle_FlushEmitsSummaries(t *testing.T) {
+	throttle, clock, lines := recordingThrottle(time.Minute)
+	denied := "[security] read denied: pid=1 -> op://v/i/f"
+	once := "[security] read granted: pid=1 -> op://v/i/g"
+
+	throttle.Log(denied)
+	throttle.Log(denied)
+	throttle.Log(denied)
+	throttle.Log(once)
+
+	// Nothing is summarised before the window ends
+	throttle.Flush()
+	if len(*lines) != 2 {
+		t.Fatalf("Expected no summary inside the window, got %v", *lines)
+	}
+
+	clock.advance(time.Minute)
+	throttle.Flush()
+	expected := []string{denied, once, denied + " (2 more suppressed in the last 1m0s)"}
+	if !reflect.DeepEqual(*lines, expected) {
+		t.Errorf("Expected %v, got %v", expected, *lines)
+	}
+	if len(throttle.entries) != 0 {
+		t.Errorf("Expected flushed entries to be forgotten, got %d", len(throttle.entries))
+	}
+
+	// A line after the flush is logged again without a stale summary
+	throttle.Log(denied)
+	if got := (*lines)[len(*lines)-1]; got != denied {
+		t.Errorf("Expected %q, got %q", denied, got)
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// DefaultAllowedOpFlags are the op global flags clients may send when the
+// daemon doesn't configure allowed_op_flags
+var DefaultAllowedOpFlags = []string{"--account"}
+
+// checkOpFlags returns an error naming the first flag whose name (the part
+// before any "=") isn't in allowed
+func checkOpFlags(flags, allowed []string) error {
+	for _, flag := range flags {
+		if flag == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(flag, "=")
+		if !slices.Contains(allowed, name) {
+			if len(allowed) == 0 {
+				return fmt.Errorf("op flag %s is not allowed: this daemon accepts no op flags (allowed_op_flags)", name)
+			}
+			return fmt.Errorf("op flag %s is not allowed on this daemon (allowed_op_flags: %s)", name, strings.Join(allowed, ", "))
+		}
+	}
+	return nil
+}
+
+// allowFlags rejects a request whose op flags aren't all in the daemon's allowlist
+func (a *api) allowFlags(w http.ResponseWriter, flags []string) bool {
+	allowed := a.allowedOpFlags
+	if allowed == nil {
+		allowed = DefaultAllowedOpFlags
+	}
+	if err := checkOpFlags(flags, allowed); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/backend"
+	"github.com/zach-source/opx/internal/cache"
+	"github.com/zach-source/opx/internal/safestring"
+)
+
+func TestCheckOpFlags(t *testing.T) {
+	tests := []struct {
+		name        string
+		flags       []string
+		allowed     []string
+		expectError string
+	}{
+		{name: "no flags", allowed: DefaultAllowedOpFlags},
+		{name: "account with value", flags: []string{"--account=acme"}, allowed: DefaultAllowedOpFlags},
+		{name: "bare account", flags: []string{"--account"}, allowed: DefaultAllowedOpFlags},
+		{name: "empty flags are skipped", flags: []string{""}, allowed: nil},
+		{name: "unlisted flag", flags: []string{"--account=acme", "--config=/tmp/evil"}, allowed: DefaultAllowedOpFlags, expectError: "op flag --config is not allowed on this daemon (allowed_op_flags: --account)"},
+		{name: "prefix of an allowed flag", flags: []string{"--acc=acme"}, allowed: DefaultAllowedOpFlags, expectError: "op flag --acc is not allowed"},
+		{name: "configured flag", flags: []string{"--cache"}, allowed: []string{"--account", "--cache"}},
+		{name: "empty allowlist", flags: []string{"--account=acme"}, allowed: []string{}, expectError: "accepts no op flags"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkOpFlags(tt.flags, tt.allowed)
+			if tt.expectError == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestAPI_AllowedOpFlags(t *testing.T) {
+	tests := []struct {
+		name         string
+		allowed      []string
+		path         string
+		body         string
+		expectStatus int
+	}{
+		{name: "read with account", path: "/v1/read", body: `{"ref":"op://dev/app/password","flags":["--account=acme"]}`, expectStatus: http.StatusOK},
+		{name: "read with other flag", path: "/v1/read", body: `{"ref":"op://dev/app/password","flags":["--config=/tmp"]}`, expectStatus: http.StatusBadRequest},
+		{name: "reads with other flag", path: "/v1/reads", body: `{"refs":["op://dev/app/password"],"flags":["--session=x"]}`, expectStatus: http.StatusBadRequest},
+		{name: "resolve with account", path: "/v1/resolve", body: `{"env":{"DB":"op://dev/app/password"},"flags":["--account=acme"]}`, expectStatus: http.StatusOK},
+		{name: "resolve with other flag", path: "/v1/resolve", body: `{"env":{"DB":"op://dev/app/password"},"flags":["--cache"]}`, expectStatus: http.StatusBadRequest},
+		{name: "resolve with other per-ref flag", path: "/v1/resolve", body: `{"env":{"DB":"op://dev/app/password"},"ref_flags":{"op://dev/app/password":["--config=/tmp"]}}`, expectStatus: http.StatusBadRequest},
+		{name: "configured flag", allowed: []string{"--cache"}, path: "/v1/resolve", body: `{"env":{"DB":"op://dev/app/password"},"flags":["--cache"]}`, expectStatus: http.StatusOK},
+		{name: "account not configured", allowed: []string{"--cache"}, path: "/v1/read", body: `{"ref":"op://dev/app/password","flags":["--account=acme"]}`, expectStatus: http.StatusBadRequest},
+		{name: "create with other flag", path: "/v1/create", body: `{"vault":"dev","title":"app","fields":[{"name":"password","generate":true}],"flags":["--config=/tmp"]}`, expectStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &api{token: safestring.New("tok"), backend: backend.Fake{}, cache: cache.New(time.Minute), allowedOpFlags: tt.allowed}
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("X-OpAuthd-Token", "tok")
+			w := httptest.NewRecorder()
+			a.handler().ServeHTTP(w, req)
+
+			if w.Code != tt.expectStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectStatus, w.Code, w.Body.String())
+			}
+			if tt.expectStatus == http.StatusBadRequest && !strings.Contains(w.Body.String(), "is not allowed") {
+				t.Errorf("Expected the rejected flag to be named, got %s", w.Body.String())
+			}
+		})
+	}
+}
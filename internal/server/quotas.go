@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zach-source/opx/internal/policy"
+	"github.com/zach-source/opx/internal/protocol"
+	"github.com/zach-source/opx/internal/security"
+)
+
+// quotaKey identifies one binary reading one ref under one rule. The rule is
+// named by its content hash so a reload that keeps it keeps its counters.
+type quotaKey struct {
+	rule string
+	path string
+	ref  string
+}
+
+// quotaWindow is a sliding log of the reads counted against a quota
+type quotaWindow struct {
+	quota policy.Quota
+	reads []time.Time // oldest first, all within quota.Per of the last check
+}
+
+// slide drops reads that have left the window at now
+func (w *quotaWindow) slide(now time.Time) {
+	cutoff := now.Add(-w.quota.Per)
+	i := 0
+	for i < len(w.reads) && !w.reads[i].After(cutoff) {
+		i++
+	}
+	w.reads = w.reads[i:]
+}
+
+// resetIn is how long until the oldest read leaves the window
+func (w *quotaWindow) resetIn(now time.Time) time.Duration {
+	if len(w.reads) == 0 {
+		return 0
+	}
+	return w.reads[0].Add(w.quota.Per).Sub(now)
+}
+
+// quotas counts reads under max_reads rules
+type quotas struct {
+	now     func() time.Time
+	mu      sync.Mutex
+	windows map[quotaKey]*quotaWindow
+}
+
+func newQuotas() *quotas {
+	return &quotas{now: time.Now, windows: make(map[quotaKey]*quotaWindow)}
+}
+
+// take counts a read of ref by path against q, returning the reads in the window
+// including this one. Once the quota is used up the read is refused and not
+// counted, and retryIn says when the next read will be allowed.
+func (s *quotas) take(q policy.Quota, path, ref string) (count int, allowed bool, retryIn time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	key := quotaKey{rule: q.Hash, path: path, ref: ref}
+	w := s.windows[key]
+	if w == nil {
+		w = &quotaWindow{}
+		s.windows[key] = w
+	}
+	w.quota = q
+	w.slide(now)
+	if len(w.reads) >= q.MaxReads {
+		return len(w.reads), false, w.resetIn(now)
+	}
+	w.reads = append(w.reads, now)
+	return len(w.reads), true, 0
+}
+
+// retain drops the counters of rules pol no longer has and renumbers the rest,
+// returning how many counters were kept and dropped
+func (s *quotas) retain(pol policy.Policy) (kept, dropped int) {
+	index := make(map[string]int)
+	for i, r := range pol.Allow {
+		if h := r.Hash(); index[h] == 0 {
+			index[h] = i + 1
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, w := range s.windows {
+		if i, ok := index[key.rule]; ok {
+			w.quota.Rule = i
+			kept++
+		} else {
+			delete(s.windows, key)
+			dropped++
+		}
+	}
+	return kept, dropped
+}
+
+// usage reports every counter with reads still in its window, forgetting the rest
+func (s *quotas) usage() []protocol.QuotaUsage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	list := []protocol.QuotaUsage{}
+	for key, w := range s.windows {
+		w.slide(now)
+		if len(w.reads) == 0 {
+			delete(s.windows, key)
+			continue
+		}
+		list = append(list, protocol.QuotaUsage{
+			Rule:           w.quota.Rule,
+			Path:           key.path,
+			Ref:            key.ref,
+			Reads:          len(w.reads),
+			MaxReads:       w.quota.MaxReads,
+			PerSeconds:     int64(w.quota.Per.Seconds()),
+			ResetInSeconds: int64(w.resetIn(now).Round(time.Second).Seconds()),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Rule != list[j].Rule {
+			return list[i].Rule < list[j].Rule
+		}
+		if list[i].Path != list[j].Path {
+			return list[i].Path < list[j].Path
+		}
+		return list[i].Ref < list[j].Ref
+	})
+	return list
+}
+
+// checkQuota counts a read the policy allowed against its rule's max_reads,
+// auditing the count, and refuses the read once the quota is used up
+func (a *api) checkQuota(ctx context.Context, peerInfo security.PeerInfo, ref string, q *policy.Quota) error {
+	if q == nil || a.quotas == nil {
+		return nil
+	}
+	count, allowed, retryIn := a.quotas.take(*q, peerInfo.Label(), ref)
+
+	if a.audit != nil {
+		details := map[string]string{
+			"subject_pid":  fmt.Sprintf("%d", peerInfo.PID),
+			"subject_path": peerInfo.Label(),
+			"matched_rule": strconv.Itoa(q.Rule),
+			"quota_count":  strconv.Itoa(count),
+			"quota_max":    strconv.Itoa(q.MaxReads),
+			"quota_per":    q.Per.String(),
+		}
+		if !allowed {
+			details["deny_reason"] = "quota_exceeded"
+		}
+		a.logAccessDecision(ctx, peerInfo, ref, policy.ActionRead, allowed, details)
+	}
+	if allowed {
+		return nil
+	}
+	if a.verbose {
+		log.Printf("[security] read quota exceeded (%d/%d per %s): %s -> %s", count, q.MaxReads, q.Per, peerInfo.String(), ref)
+	}
+	return &policyDenial{ref: ref, hint: fmt.Sprintf("quota exceeded: rule %d allows %s, next read in %s", q.Rule, q, retryIn.Round(time.Second))}
+}
+
+// handlePolicyUsage reports read-quota usage per rule, binary and ref
+func (a *api) handlePolicyUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	resp := protocol.PolicyUsageResponse{Usage: []protocol.QuotaUsage{}}
+	if a.quotas != nil {
+		resp.Usage = a.quotas.usage()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// handlePolicyReload re-reads the policy file and applies it, keeping the quota
+// counters of rules that didn't change
+func (a *api) handlePolicyReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.policyPath == "" {
+		http.Error(w, "daemon has no policy file to reload", http.StatusConflict)
+		return
+	}
+	pol, err := policy.LoadFile(a.policyPath)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("policy not reloaded: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+	if a.policyDefaultDeny != nil {
+		pol.DefaultDeny = *a.policyDefaultDeny
+	}
+	a.setPolicy(pol)
+	var kept, dropped int
+	if a.quotas != nil {
+		kept, dropped = a.quotas.retain(pol)
+	}
+	if a.verbose {
+		log.Printf("Reloaded access policy from %s: %d rules, kept %d quota counters", a.policyPath, len(pol.Allow), kept)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(protocol.PolicyReloadResponse{
+		PolicyPath:    a.policyPath,
+		Rules:         len(pol.Allow),
+		DefaultDeny:   pol.DefaultDeny,
+		QuotasKept:    kept,
+		QuotasDropped: dropped,
+	})
+}
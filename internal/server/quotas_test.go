@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/audit"
+	"github.com/zach-source/opx/internal/backend"
+	"github.com/zach-source/opx/internal/cache"
+	"github.com/zach-source/opx/internal/policy"
+	"github.com/zach-source/opx/internal/protocol"
+	"github.com/zach-source/opx/internal/safestring"
+	"github.com/zach-source/opx/internal/security"
+)
+
+func TestQuotas_SlidingWindow(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	s := newQuotas()
+	s.now = clock.now
+	q := policy.Quota{Rule: 1, Hash: "h", MaxReads: 3, Per: time.Hour}
+	take := func() (int, bool, time.Duration) { return s.take(q, "/usr/bin/app", "op://prod/db/password") }
+
+	// Reads at 0, 20 and 40 minutes use up the quota
+	for i := 1; i <= 3; i++ {
+		if count, allowed, _ := take(); !allowed || count != i {
+			t.Fatalf("Expected read %d to be allowed, got count=%d allowed=%v", i, count, allowed)
+		}
+		clock.advance(20 * time.Minute)
+	}
+	clock.advance(-20 * time.Minute)
+	count, allowed, retryIn := take()
+	if allowed || count != 3 || retryIn != 20*time.Minute {
+		t.Errorf("Expected a denial until the first read leaves the window in 20m, got count=%d allowed=%v retryIn=%s", count, allowed, retryIn)
+	}
+	if _, allowed, _ := s.take(q, "/usr/bin/app", "op://prod/api/key"); !allowed {
+		t.Error("Expected another ref to have its own counter")
+	}
+
+	// The window slides: once the first read is an hour old one read frees up
+	clock.advance(20 * time.Minute)
+	if count, allowed, _ := take(); !allowed || count != 3 {
+		t.Errorf("Expected the slid window to allow one read, got count=%d allowed=%v", count, allowed)
+	}
+	if _, allowed, _ := take(); allowed {
+		t.Error("Expected the quota to be used up again")
+	}
+
+	// After a full interval with no reads the counter resets
+	clock.advance(time.Hour)
+	if count, allowed, _ := take(); !allowed || count != 1 {
+		t.Errorf("Expected a reset counter, got count=%d allowed=%v", count, allowed)
+	}
+	usage := s.usage()
+	if len(usage) != 1 || usage[0].Ref != "op://prod/db/password" || usage[0].Reads != 1 || usage[0].ResetInSeconds != 3600 {
+		t.Errorf("Expected only the read ref in usage, got %+v", usage)
+	}
+}
+
+func TestQuotas_Retain(t *testing.T) {
+	s := newQuotas()
+	kept := policy.Rule{Path: "/usr/bin/app", Refs: []string{"op://prod/*"}, MaxReads: 2, Per: "1h"}
+	changed := policy.Rule{Path: "/usr/bin/app", Refs: []string{"op://dev/*"}, MaxReads: 2, Per: "1h"}
+	s.take(policy.Quota{Rule: 1, Hash: kept.Hash(), MaxReads: 2, Per: time.Hour}, "/usr/bin/app", "op://prod/x")
+	s.take(policy.Quota{Rule: 2, Hash: changed.Hash(), MaxReads: 2, Per: time.Hour}, "/usr/bin/app", "op://dev/x")
+
+	changed.MaxReads = 5
+	reloaded := policy.Policy{Allow: []policy.Rule{changed, {Path: "/usr/bin/other", Refs: []string{"*"}}, kept}}
+	if k, d := s.retain(reloaded); k != 1 || d != 1 {
+		t.Errorf("Expected 1 counter kept and 1 dropped, got %d and %d", k, d)
+	}
+	usage := s.usage()
+	if len(usage) != 1 || usage[0].Ref != "op://prod/x" || usage[0].Rule != 3 {
+		t.Errorf("Expected the unchanged rule's counter renumbered to rule 3, got %+v", usage)
+	}
+}
+
+func TestAPI_ReadQuota(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	logger, err := audit.NewLoggerWithConfig(true, audit.RollerConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create audit logger: %v", err)
+	}
+	defer logger.Close()
+	sub := logger.Subscribe(32)
+	defer logger.Unsubscribe(sub)
+
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	app := security.PeerInfo{PID: 1, UID: 1000, Path: "/usr/bin/app"}
+	admin := security.PeerInfo{PID: 2, UID: 1000, Path: "/usr/local/bin/opx"}
+	limited := policy.Rule{Path: app.Path, Refs: []string{"op://prod/*"}, MaxReads: 2, Per: "1h"}
+	pol := policy.Policy{Allow: []policy.Rule{limited}, DefaultDeny: true}
+	policyPath := filepath.Join(t.TempDir(), "policy.json")
+	if _, err := policy.Save(policyPath, pol); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	a := &api{
+		token:      safestring.New("tok"),
+		backend:    backend.Fake{},
+		cache:      cache.New(5 * time.Minute),
+		clock:      clock.now,
+		audit:      logger,
+		adminPaths: []string{admin.Path},
+		policy:     pol,
+		policyPath: policyPath,
+		quotas:     newQuotas(),
+	}
+	a.quotas.now = clock.now
+	do := func(peer security.PeerInfo, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-OpAuthd-Token", "tok")
+		req = req.WithContext(context.WithValue(req.Context(), peerInfoKey, peer))
+		w := httptest.NewRecorder()
+		a.handler().ServeHTTP(w, req)
+		return w
+	}
+	read := func() *httptest.ResponseRecorder {
+		return do(app, "POST", "/v1/read", `{"ref":"op://prod/db/password"}`)
+	}
+	quotaEvents := func() []audit.AuditEvent {
+		var events []audit.AuditEvent
+		for {
+			select {
+			case e := <-sub.C:
+				if e.Details["quota_count"] != "" {
+					events = append(events, e)
+				}
+			case <-time.After(100 * time.Millisecond):
+				return events
+			}
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := read(); w.Code != http.StatusOK {
+			t.Fatalf("Expected read %d within the quota to succeed, got %d %s", i+1, w.Code, w.Body.String())
+		}
+	}
+	w := read()
+	var e protocol.ErrorResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &e)
+	if w.Code != http.StatusForbidden || e.Code != protocol.ErrCodePolicyDenied || !strings.Contains(e.Message, "quota exceeded") {
+		t.Errorf("Expected 403 policy_denied for quota exceeded, got %d %s", w.Code, w.Body.String())
+	}
+	events := quotaEvents()
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 quota audit events, got %+v", events)
+	}
+	if last := events[2]; last.Decision != "DENY" || last.Details["deny_reason"] != "quota_exceeded" || last.Details["quota_count"] != "2" || last.Details["quota_max"] != "2" {
+		t.Errorf("Expected a quota_exceeded denial at 2/2, got %+v", last)
+	}
+	if events[0].Details["quota_count"] != "1" || events[0].Decision != "ALLOW" {
+		t.Errorf("Expected the first read counted as 1, got %+v", events[0])
+	}
+
+	// Reloading an unchanged rule keeps its counter
+	pol.Allow = append([]policy.Rule{{Path: app.Path, Refs: []string{"op://dev/*"}}}, limited)
+	if _, err := policy.Save(policyPath, pol); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	w = do(admin, "POST", "/v1/policy/reload", "")
+	var reload protocol.PolicyReloadResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &reload); err != nil || reload.Rules != 2 || reload.QuotasKept != 1 || reload.QuotasDropped != 0 {
+		t.Fatalf("Expected the reload to keep 1 counter, got %d %s", w.Code, w.Body.String())
+	}
+	if w := read(); w.Code != http.StatusForbidden {
+		t.Errorf("Expected the quota to stay used up across the reload, got %d", w.Code)
+	}
+	if w := do(app, "POST", "/v1/read", `{"ref":"op://dev/api/key"}`); w.Code != http.StatusOK {
+		t.Errorf("Expected the reloaded policy's new rule to apply, got %d", w.Code)
+	}
+
+	w = do(admin, "GET", "/v1/policy/usage", "")
+	var usage protocol.PolicyUsageResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &usage); err != nil || len(usage.Usage) != 1 || usage.Usage[0].Rule != 2 || usage.Usage[0].Reads != 2 {
+		t.Errorf("Expected usage of 2 reads under rule 2, got %s", w.Body.String())
+	}
+	if w := do(app, "GET", "/v1/policy/usage", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected non-admins to be refused usage, got %d", w.Code)
+	}
+
+	// Changing the rule starts its count afresh
+	pol.Allow[1].MaxReads = 3
+	if _, err := policy.Save(policyPath, pol); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if w := do(admin, "POST", "/v1/policy/reload", ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected the reload to succeed, got %d %s", w.Code, w.Body.String())
+	}
+	if w := read(); w.Code != http.StatusOK {
+		t.Errorf("Expected a changed rule to reset its quota, got %d", w.Code)
+	}
+
+	// A broken policy file leaves the current policy in place
+	if err := os.WriteFile(policyPath, []byte(`{"allow":[{"refs":["*"],"max_reads":-1}]}`), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if w := do(admin, "POST", "/v1/policy/reload", ""); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for an invalid policy, got %d", w.Code)
+	}
+	if w := do(app, "POST", "/v1/read", `{"ref":"op://dev/api/key"}`); w.Code != http.StatusOK {
+		t.Errorf("Expected the previous policy to stay in effect, got %d", w.Code)
+	}
+}
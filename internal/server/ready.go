@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/zach-source/opx/internal/backend"
+	"github.com/zach-source/opx/internal/util"
+)
+
+// readyRetry is how long readiness waits between backend pings that failed
+const readyRetry = time.Second
+
+// ReadyInfo is the JSON written to Server.ReadyFile
+type ReadyInfo struct {
+	PID     int       `json:"pid"`
+	Socket  string    `json:"socket"`
+	Backend string    `json:"backend"`
+	ReadyAt time.Time `json:"ready_at"`
+}
+
+// backendReady pings the backends that can be pinged; the opcli backend can't
+// be checked without prompting, so it always counts as ready
+func backendReady(ctx context.Context, b backend.Backend) error {
+	if multi, ok := backend.As[*backend.MultiBackend](b); ok {
+		for _, sub := range multi.Backends() {
+			if pinger, ok := sub.Backend.(backend.Pinger); ok {
+				if err := pinger.Ping(ctx); err != nil {
+					return fmt.Errorf("%s backend: %w", sub.Scheme, err)
+				}
+			}
+		}
+		return nil
+	}
+	if pinger, ok := backend.As[backend.Pinger](b); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// signalReady reports readiness once the socket is listening (and, with
+// ReadyWaitBackend, the backend answers): it writes ReadyFile and tells systemd
+// READY=1, then sends WATCHDOG=1 until ctx ends if a watchdog is configured
+func (s *Server) signalReady(ctx context.Context) {
+	if s.ReadyWaitBackend {
+		for {
+			pctx, cancel := context.WithTimeout(ctx, backendProbeTimeout)
+			err := backendReady(pctx, s.Backend)
+			cancel()
+			if err == nil {
+				break
+			}
+			if s.Verbose {
+				log.Printf("Readiness: waiting for the backend: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(readyRetry):
+			}
+		}
+	}
+
+	if s.ReadyFile != "" {
+		info, _ := json.Marshal(ReadyInfo{PID: os.Getpid(), Socket: s.SockPath, Backend: s.Backend.Name(), ReadyAt: time.Now().UTC()})
+		if err := util.WriteFileAtomic(s.ReadyFile, append(info, '\n'), 0o600); err != nil {
+			log.Printf("Warning: failed to write readiness file %s: %v", s.ReadyFile, err)
+		}
+	}
+	if _, err := util.SdNotify("READY=1\nSTATUS=listening on " + s.SockPath); err != nil {
+		log.Printf("Warning: failed to notify systemd: %v", err)
+	}
+
+	interval := util.SdWatchdogInterval()
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, _ = util.SdNotify("WATCHDOG=1")
+		}
+	}
+}
+
+// signalStopping withdraws readiness on shutdown
+func (s *Server) signalStopping() {
+	if s.ReadyFile != "" {
+		_ = os.Remove(s.ReadyFile)
+	}
+	_, _ = util.SdNotify("STOPPING=1")
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/backend"
+	"github.com/zach-source/opx/internal/cache"
+	"github.com/zach-source/opx/internal/util"
+)
+
+// waitForFile polls until path exists or a few seconds pass
+func waitForFile(t *testing.T, path string) []byte {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if b, err := os.ReadFile(path); err == nil {
+			return b
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s was not written", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// readyServer returns a Server on a temporary socket that writes a readiness file
+func readyServer(t *testing.T, be backend.Backend) *Server {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	dir := t.TempDir()
+	return &Server{
+		SockPath:  filepath.Join(dir, "opx.sock"),
+		LockPath:  filepath.Join(dir, "opx-authd.lock"),
+		Backend:   be,
+		Cache:     cache.New(time.Minute),
+		ReadyFile: filepath.Join(dir, "opx-authd.ready"),
+	}
+}
+
+func TestServer_ReadyFileAndNotify(t *testing.T) {
+	notifyPath := filepath.Join(t.TempDir(), "notify.sock")
+	notify, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: notifyPath, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("ListenUnixgram failed: %v", err)
+	}
+	defer notify.Close()
+	t.Setenv(util.NotifySocketEnv, notifyPath)
+	t.Setenv("WATCHDOG_USEC", "")
+
+	srv := readyServer(t, backend.NewFake())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ctx) }()
+
+	var info ReadyInfo
+	if err := json.Unmarshal(waitForFile(t, srv.ReadyFile), &info); err != nil {
+		t.Fatalf("Readiness file is not JSON: %v", err)
+	}
+	if info.PID != os.Getpid() || info.Socket != srv.SockPath || info.Backend != "fake" {
+		t.Errorf("Expected pid %d, socket %s and backend fake, got %+v", os.Getpid(), srv.SockPath, info)
+	}
+	if _, err := os.Stat(srv.SockPath); err != nil {
+		t.Errorf("Expected the socket to be listening before readiness, got %v", err)
+	}
+	if fi, err := os.Stat(srv.ReadyFile); err == nil && fi.Mode().Perm() != 0o600 {
+		t.Errorf("Expected readiness file mode 0600, got %v", fi.Mode().Perm())
+	}
+
+	buf := make([]byte, 256)
+	_ = notify.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := notify.Read(buf)
+	if err != nil {
+		t.Fatalf("Expected a systemd notification, got %v", err)
+	}
+	if got := string(buf[:n]); !strings.HasPrefix(got, "READY=1\n") {
+		t.Errorf("Expected READY=1, got %q", got)
+	}
+
+	cancel()
+	<-done
+	if _, err := os.Stat(srv.ReadyFile); !os.IsNotExist(err) {
+		t.Errorf("Expected the readiness file removed on shutdown, got %v", err)
+	}
+}
+
+// flakyPinger fails its first pings
+type flakyPinger struct {
+	backend.Backend
+	failures atomic.Int32
+}
+
+func (f *flakyPinger) Ping(ctx context.Context) error {
+	if f.failures.Add(-1) >= 0 {
+		return errors.New("sealed")
+	}
+	return nil
+}
+
+func TestServer_ReadyWaitsForBackend(t *testing.T) {
+	t.Setenv(util.NotifySocketEnv, "")
+	be := &flakyPinger{Backend: backend.NewFake()}
+	be.failures.Store(1)
+	srv := readyServer(t, be)
+	srv.ReadyWaitBackend = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ctx) }()
+	defer func() { cancel(); <-done }()
+
+	waitForFile(t, srv.ReadyFile)
+	if left := be.failures.Load(); left >= 0 {
+		t.Errorf("Expected readiness only after the failing ping, %d failures left", left+1)
+	}
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zach-source/opx/internal/policy"
+	"github.com/zach-source/opx/internal/protocol"
+	"github.com/zach-source/opx/internal/security"
+	"github.com/zach-source/opx/internal/util"
+)
+
+// maxRecentRefs bounds the ref history; the least recently read ref is dropped first
+const maxRecentRefs = 1000
+
+// recentRefsSaveInterval is how often a changed ref history is written to disk
+const recentRefsSaveInterval = time.Minute
+
+// Limits of GET /v1/refs/recent
+const (
+	defaultRecentLimit = 50
+	maxRecentLimit     = maxRecentRefs
+)
+
+// recentRefs remembers which refs were read successfully and when, never their
+// values, so completion can offer refs this machine actually uses. A nil
+// recentRefs keeps no history.
+type recentRefs struct {
+	path   string        // where the history persists; "" keeps it in memory
+	max    int           // refs kept at most
+	maxAge time.Duration // refs unused this long are forgotten; 0 keeps them until evicted
+	now    func() time.Time
+
+	mu    sync.Mutex
+	used  map[string]time.Time
+	dirty bool
+}
+
+// recentRefsFile is the on-disk form of the history
+type recentRefsFile struct {
+	Refs []recentRefEntry `json:"refs"`
+}
+
+type recentRefEntry struct {
+	Ref      string `json:"ref"`
+	LastUsed int64  `json:"last_used_unix"`
+}
+
+func newRecentRefs(path string, maxRefs int, maxAge time.Duration) *recentRefs {
+	return &recentRefs{path: path, max: maxRefs, maxAge: maxAge, now: time.Now, used: make(map[string]time.Time)}
+}
+
+// load reads the persisted history; a missing file is an empty history
+func (h *recentRefs) load() error {
+	if h.path == "" {
+		return nil
+	}
+	b, err := os.ReadFile(h.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var f recentRefsFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", h.path, err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range f.Refs {
+		h.used[e.Ref] = time.Unix(e.LastUsed, 0)
+	}
+	h.expire()
+	return nil
+}
+
+// record notes a successful read of ref
+func (h *recentRefs) record(ref string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.used[ref] = h.now()
+	h.dirty = true
+	if len(h.used) > h.max {
+		oldest, oldestAt := "", time.Time{}
+		for r, at := range h.used {
+			if oldest == "" || at.Before(oldestAt) {
+				oldest, oldestAt = r, at
+			}
+		}
+		delete(h.used, oldest)
+	}
+}
+
+// expire forgets refs older than maxAge; callers hold mu
+func (h *recentRefs) expire() {
+	if h.maxAge <= 0 {
+		return
+	}
+	cutoff := h.now().Add(-h.maxAge)
+	for r, at := range h.used {
+		if at.Before(cutoff) {
+			delete(h.used, r)
+			h.dirty = true
+		}
+	}
+}
+
+// list returns the refs most recently read first, passing each through keep
+func (h *recentRefs) list(limit int, keep func(ref string) bool) []string {
+	type used struct {
+		ref string
+		at  time.Time
+	}
+	h.mu.Lock()
+	h.expire()
+	entries := make([]used, 0, len(h.used))
+	for r, at := range h.used {
+		entries = append(entries, used{ref: r, at: at})
+	}
+	h.mu.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].at.Equal(entries[j].at) {
+			return entries[i].at.After(entries[j].at)
+		}
+		return entries[i].ref < entries[j].ref
+	})
+	refs := []string{}
+	for _, e := range entries {
+		if len(refs) == limit {
+			break
+		}
+		if keep(e.ref) {
+			refs = append(refs, e.ref)
+		}
+	}
+	return refs
+}
+
+// save writes the history if it changed since the last save
+func (h *recentRefs) save() error {
+	h.mu.Lock()
+	if h.path == "" || !h.dirty {
+		h.mu.Unlock()
+		return nil
+	}
+	h.expire()
+	f := recentRefsFile{Refs: make([]recentRefEntry, 0, len(h.used))}
+	for r, at := range h.used {
+		f.Refs = append(f.Refs, recentRefEntry{Ref: r, LastUsed: at.Unix()})
+	}
+	h.dirty = false
+	h.mu.Unlock()
+
+	sort.Slice(f.Refs, func(i, j int) bool { return f.Refs[i].Ref < f.Refs[j].Ref })
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err == nil {
+		err = util.WriteFileAtomic(h.path, b, 0o600)
+	}
+	if err != nil {
+		h.mu.Lock()
+		h.dirty = true // try again on the next save
+		h.mu.Unlock()
+	}
+	return err
+}
+
+// run saves the history every interval until ctx is done; Serve saves it a last time on shutdown
+func (h *recentRefs) run(ctx context.Context, interval time.Duration, verbose bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := h.save(); err != nil && verbose {
+				log.Printf("ref history: %v", err)
+			}
+		}
+	}
+}
+
+// handleRecentRefs lists recently read refs the peer could read, for completion
+func (a *api) handleRecentRefs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	limit := defaultRecentLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxRecentLimit)
+	}
+	if a.recentRefs == nil {
+		_ = json.NewEncoder(w).Encode(protocol.RecentRefsResponse{Refs: []string{}, Disabled: true})
+		return
+	}
+
+	// Like cache listings, offering a ref isn't an access, so it isn't audited
+	peerInfo, hasPeer := security.PeerInfo{}, false
+	if a.needsPeerInfo() {
+		peerInfo, hasPeer = peerFromContext(r.Context())
+	}
+	refs := a.recentRefs.list(limit, func(ref string) bool {
+		return !hasPeer || policy.AllowedAction(a.currentPolicy(), subjectOf(peerInfo), ref, policy.ActionRead)
+	})
+	_ = json.NewEncoder(w).Encode(protocol.RecentRefsResponse{Refs: refs})
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/backend"
+	"github.com/zach-source/opx/internal/cache"
+	"github.com/zach-source/opx/internal/policy"
+	"github.com/zach-source/opx/internal/protocol"
+	"github.com/zach-source/opx/internal/security"
+)
+
+func keepAll(string) bool { return true }
+
+func TestRecentRefs_PersistsAcrossRestarts(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	path := filepath.Join(t.TempDir(), "recent-refs.json")
+
+	h := newRecentRefs(path, 3, 24*time.Hour)
+	h.now = clock.now
+	for _, ref := range []string{"op://a/x/p", "op://b/x/p", "op://c/x/p", "op://a/x/p", "op://d/x/p"} {
+		clock.advance(time.Second)
+		h.record(ref)
+	}
+	if got, expected := h.list(10, keepAll), []string{"op://d/x/p", "op://a/x/p", "op://c/x/p"}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected the least recently read ref evicted, got %v", got)
+	}
+	if err := h.save(); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("Expected a 0600 history file, got %v (%v)", fi, err)
+	}
+	b, _ := os.ReadFile(path)
+	if strings.Contains(string(b), "value") {
+		t.Errorf("Expected only refs and times on disk, got %s", b)
+	}
+
+	restarted := newRecentRefs(path, 3, 24*time.Hour)
+	restarted.now = clock.now
+	if err := restarted.load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if got, expected := restarted.list(2, keepAll), []string{"op://d/x/p", "op://a/x/p"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v after restart, got %v", expected, got)
+	}
+
+	clock.advance(25 * time.Hour)
+	if got := restarted.list(10, keepAll); len(got) != 0 {
+		t.Errorf("Expected refs older than the max age to be forgotten, got %v", got)
+	}
+}
+
+func TestRecentRefs_LoadMissingFile(t *testing.T) {
+	h := newRecentRefs(filepath.Join(t.TempDir(), "none.json"), maxRecentRefs, 0)
+	if err := h.load(); err != nil {
+		t.Fatalf("Expected a missing file to be an empty history, got %v", err)
+	}
+	if got := h.list(10, keepAll); len(got) != 0 {
+		t.Errorf("Expected no refs, got %v", got)
+	}
+}
+
+func TestAPI_RecentRefsRecordsReadsAndFiltersByPolicy(t *testing.T) {
+	a := &api{
+		backend: backend.Fake{},
+		cache:   cache.New(time.Minute),
+		policy: policy.Policy{
+			Allow: []policy.Rule{
+				{Path: "/usr/bin/deploy", Refs: []string{"op://prod/*", "op://dev/*"}},
+				{Path: "/usr/bin/dev", Refs: []string{"op://dev/*"}},
+			},
+			DefaultDeny: true,
+		},
+		recentRefs: newRecentRefs("", maxRecentRefs, 0),
+	}
+	deploy := security.PeerInfo{PID: 1, Path: "/usr/bin/deploy"}
+	for _, ref := range []string{"op://dev/api/key", "op://prod/db/password", "op://prod/missing/field"} {
+		_, _ = a.readOne(context.WithValue(context.Background(), peerInfoKey, deploy), ref)
+	}
+	// A denied read is not history
+	_, _ = a.readOne(context.WithValue(context.Background(), peerInfoKey, security.PeerInfo{PID: 2, Path: "/usr/bin/dev"}), "op://prod/other/field")
+
+	tests := []struct {
+		name     string
+		peer     *security.PeerInfo
+		expected []string
+	}{
+		{name: "deploy sees both vaults", peer: &deploy, expected: []string{"op://dev/api/key", "op://prod/db/password", "op://prod/missing/field"}},
+		{name: "dev sees only dev", peer: &security.PeerInfo{PID: 2, Path: "/usr/bin/dev"}, expected: []string{"op://dev/api/key"}},
+		{name: "unknown binary sees nothing", peer: &security.PeerInfo{PID: 3, Path: "/usr/bin/other"}, expected: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v1/refs/recent?limit=10", nil)
+			req = req.WithContext(context.WithValue(req.Context(), peerInfoKey, *tt.peer))
+			w := httptest.NewRecorder()
+			a.handleRecentRefs(w, req)
+
+			var resp protocol.RecentRefsResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response %q: %v", w.Body.String(), err)
+			}
+			got := resp.Refs
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestServer_DisableRefHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recent-refs.json")
+	if err := os.WriteFile(path, []byte(`{"refs":[{"ref":"op://v/i/f","last_used_unix":1}]}`), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	s := &Server{Backend: backend.Fake{}, Cache: cache.New(time.Minute), RefHistoryPath: path, DisableRefHistory: true}
+	a := s.newAPI()
+	if err := s.setupRefHistory(a); err != nil {
+		t.Fatalf("setupRefHistory failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the saved history to be deleted, got %v", err)
+	}
+	if _, err := a.readOne(context.Background(), "op://v/i/f"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	a.handleRecentRefs(w, httptest.NewRequest("GET", "/v1/refs/recent", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if expected := `{"refs":[],"disabled":true}` + "\n"; w.Body.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, w.Body.String())
+	}
+}
@@ -0,0 +1,276 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zach-source/opx/internal/backend"
+	"github.com/zach-source/opx/internal/cache"
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+// defaultRefreshMaxEntries bounds refresh work when refreshMaxEntries is unset
+const defaultRefreshMaxEntries = 32
+
+// refreshSource is the request needed to re-read a cached key from the backend
+type refreshSource struct {
+	ref        string
+	flags      []string
+	secretType string
+}
+
+// minSourcesPrune is the smallest refreshSources size that triggers pruning
+const minSourcesPrune = 64
+
+// rememberRefreshSource records how key was produced so the refresher and the
+// cache endpoints can re-read it. Without the refresher only hashed keys need
+// recording; a plain ref is its own source.
+func (a *api) rememberRefreshSource(key string, src refreshSource) {
+	if a.refreshInterval <= 0 && key == src.ref {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.refreshSources == nil {
+		a.refreshSources = make(map[string]refreshSource)
+	}
+	a.refreshSources[key] = src
+
+	// Keep the map proportional to the cache when no refresher prunes it
+	if len(a.refreshSources) >= max(a.sourcesPruneAt, minSourcesPrune) {
+		for k := range a.refreshSources {
+			if !a.cache.Has(k) {
+				delete(a.refreshSources, k)
+			}
+		}
+		a.sourcesPruneAt = 2 * len(a.refreshSources)
+	}
+}
+
+// startRefresher re-reads hot entries every refreshInterval until ctx is done
+func (a *api) startRefresher(ctx context.Context) {
+	ticker := time.NewTicker(a.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			refreshed := a.refreshHotEntries(ctx)
+			if a.verbose && refreshed > 0 {
+				log.Printf("cache refresh: refreshed %d hot entries", refreshed)
+			}
+		}
+	}
+}
+
+// refreshHotEntries re-reads entries read during the last interval that would
+// expire before the next pass, most-read first. Returns how many were replaced.
+func (a *api) refreshHotEntries(ctx context.Context) int {
+	// Never refresh into a locked session; refreshes also must not keep it alive
+	if a.session != nil && !a.session.GetInfo().State.IsActive() {
+		return 0
+	}
+
+	now := a.now()
+	limit := a.refreshMaxEntries
+	if limit <= 0 {
+		limit = defaultRefreshMaxEntries
+	}
+	// Refresh one interval early so the value is replaced before the next tick could miss it
+	keys := a.cache.HotKeys(now.Add(-a.refreshInterval), now.Add(2*a.refreshInterval), limit)
+
+	a.mu.Lock()
+	sources := make(map[string]refreshSource, len(keys))
+	for _, key := range keys {
+		if src, ok := a.refreshSources[key]; ok {
+			sources[key] = src
+		}
+	}
+	// Forget keys that have left the cache
+	for key := range a.refreshSources {
+		if !a.cache.Has(key) {
+			delete(a.refreshSources, key)
+		}
+	}
+	a.mu.Unlock()
+
+	refreshed := 0
+	for _, key := range keys {
+		src, ok := sources[key]
+		if !ok {
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		// Share the singleflight slot with client misses for the same key
+		_, err, _ := a.sf.Do(key, func() (interface{}, error) {
+			readCtx, cancel := withTimeout(backend.WithBackgroundRead(backend.WithSecretType(ctx, src.secretType)), a.backendReadTimeout)
+			defer cancel()
+			v, err := a.backend.ReadRefWithFlags(readCtx, src.ref, src.flags)
+			if err != nil {
+				return nil, err
+			}
+			if err := a.checkValueSize(src.ref, v); err != nil {
+				return nil, err
+			}
+			if ok, changed := a.cache.Refresh(key, v); ok {
+				refreshed++
+				if changed {
+					a.secretChanged(key, src.ref, "background_refresh")
+				}
+			}
+			// Client reads that join this flight expect a ReadResponse
+			return protocol.ReadResponse{Ref: src.ref, Value: v, FromCache: false, ExpiresIn: int(a.cache.TTL().Seconds()), ResolvedAt: a.now().Unix()}, nil
+		})
+		if err != nil && a.verbose {
+			log.Printf("cache refresh: failed to refresh %q: %v", src.ref, err)
+		}
+	}
+	return refreshed
+}
+
+// cacheRefreshConcurrency bounds the backend reads a single /v1/cache/refresh runs at once
+const cacheRefreshConcurrency = 4
+
+// cacheEntry describes a cached key for the cache endpoints
+func (a *api) cacheEntry(key string, src refreshSource, expiresAt, cachedAt time.Time) protocol.CacheEntry {
+	return protocol.CacheEntry{
+		Key:        key,
+		Ref:        src.ref,
+		Descriptor: src.descriptor(),
+		ExpiresIn:  int(expiresAt.Sub(a.now()).Seconds()),
+		ResolvedAt: cachedAt.Unix(),
+	}
+}
+
+// refreshTargets picks the cache keys to refresh: every cached variant of refs
+// (or the bare ref when none is cached) plus every entry expiring within within
+func (a *api) refreshTargets(refs []string, within time.Duration) map[string]refreshSource {
+	now := a.now()
+	targets := make(map[string]refreshSource)
+	if within > 0 {
+		for _, e := range a.cache.Expiring(now.Add(within)) {
+			// A hashed key whose flags were forgotten can't be re-read faithfully
+			if src, ok := a.keySource(e.Key); ok {
+				targets[e.Key] = src
+			}
+		}
+	}
+	if len(refs) == 0 {
+		return targets
+	}
+
+	// Every live entry expires within one TTL
+	live := a.cache.Expiring(now.Add(a.cache.TTL() + time.Second))
+	for _, ref := range refs {
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			continue
+		}
+		found := false
+		for _, e := range live {
+			if src, ok := a.keySource(e.Key); ok && src.ref == ref {
+				targets[e.Key] = src
+				found = true
+			}
+		}
+		if !found {
+			targets[ref] = refreshSource{ref: ref}
+		}
+	}
+	return targets
+}
+
+// refreshKeys re-reads sources from the backend, bypassing the cached values,
+// and stores the results. Returns the refreshed entries sorted by key and the
+// failures keyed by cache key.
+func (a *api) refreshKeys(ctx context.Context, sources map[string]refreshSource) ([]protocol.CacheEntry, map[string]error) {
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		refreshed []protocol.CacheEntry
+		errs      = make(map[string]error)
+	)
+	sem := make(chan struct{}, cacheRefreshConcurrency)
+	for key, src := range sources {
+		wg.Add(1)
+		go func(key string, src refreshSource) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			rr, err := a.refreshKey(ctx, key, src)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[key] = err
+				return
+			}
+			refreshed = append(refreshed, protocol.CacheEntry{Key: key, Ref: src.ref, Descriptor: src.descriptor(), ExpiresIn: rr.ExpiresIn, ResolvedAt: rr.ResolvedAt})
+		}(key, src)
+	}
+	wg.Wait()
+
+	sort.Slice(refreshed, func(i, j int) bool { return refreshed[i].Key < refreshed[j].Key })
+	return refreshed, errs
+}
+
+// refreshKey reads src from the backend and replaces key, sharing the
+// singleflight slot with client misses for the same key
+func (a *api) refreshKey(ctx context.Context, key string, src refreshSource) (protocol.ReadResponse, error) {
+	if a.cache.Tombstoned(src.ref) {
+		return protocol.ReadResponse{}, cache.ErrTombstone
+	}
+	ch := a.sf.DoChan(key, func() (interface{}, error) {
+		readCtx, cancel := withTimeout(backend.WithSecretType(context.WithoutCancel(ctx), src.secretType), a.backendReadTimeout)
+		defer cancel()
+		v, err := a.backend.ReadRefWithFlags(readCtx, src.ref, src.flags)
+		if err != nil {
+			return nil, err
+		}
+		if err := a.checkValueSize(src.ref, v); err != nil {
+			return nil, err
+		}
+		if ok, changed := a.cache.Refresh(key, v); ok {
+			if changed {
+				a.secretChanged(key, src.ref, "cache_refresh")
+			}
+		} else if err := a.cache.Set(key, v); err != nil {
+			return nil, err
+		}
+		a.rememberRefreshSource(key, src)
+		return protocol.ReadResponse{Ref: src.ref, Value: v, FromCache: false, ExpiresIn: int(a.cache.TTL().Seconds()), ResolvedAt: a.now().Unix()}, nil
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return protocol.ReadResponse{}, res.Err
+		}
+		rr, ok := res.Val.(protocol.ReadResponse)
+		if !ok {
+			return protocol.ReadResponse{}, errors.New("internal type assertion failed")
+		}
+		return rr, nil
+	case <-ctx.Done():
+		return protocol.ReadResponse{}, ctx.Err()
+	}
+}
+
+// secretChanged reports that a refresh replaced key with a different value
+func (a *api) secretChanged(key, ref, source string) {
+	if a.verbose {
+		log.Printf("cache refresh: value of %q changed", key)
+	}
+	if a.audit != nil {
+		a.audit.LogSecretChanged(ref, map[string]string{"cache_key": key, "source": source})
+	}
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/audit"
+	"github.com/zach-source/opx/internal/backend"
+	"github.com/zach-source/opx/internal/cache"
+	"github.com/zach-source/opx/internal/session"
+)
+
+// versionedBackend returns a new value for every backend read
+type versionedBackend struct {
+	mu    sync.Mutex
+	reads map[string]int
+}
+
+func (b *versionedBackend) Name() string { return "versioned" }
+
+func (b *versionedBackend) ReadRef(ctx context.Context, ref string) (string, error) {
+	return b.ReadRefWithFlags(ctx, ref, nil)
+}
+
+func (b *versionedBackend) ReadRefWithFlags(ctx context.Context, ref string, flags []string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.reads == nil {
+		b.reads = make(map[string]int)
+	}
+	b.reads[ref]++
+	return fmt.Sprintf("%s@v%d", ref, b.reads[ref]), nil
+}
+
+func TestServer_RefreshHotEntries(t *testing.T) {
+	srv := &api{
+		backend:           &versionedBackend{},
+		cache:             cache.New(time.Second),
+		refreshInterval:   time.Second,
+		refreshMaxEntries: 1,
+	}
+	ctx := context.Background()
+
+	// "hot" is read three times, "warm" once
+	for i := 0; i < 3; i++ {
+		if _, err := srv.readOneWithFlags(ctx, "op://v/hot/f", nil); err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+	}
+	if _, err := srv.readOneWithFlags(ctx, "op://v/warm/f", nil); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	if refreshed := srv.refreshHotEntries(ctx); refreshed != 1 {
+		t.Fatalf("Expected only the hottest entry to be refreshed, got %d", refreshed)
+	}
+
+	rr, err := srv.readOneWithFlags(ctx, "op://v/hot/f", nil)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if !rr.FromCache || rr.Value != "op://v/hot/f@v2" {
+		t.Errorf("Expected refreshed cached value v2, got %q (from cache %v)", rr.Value, rr.FromCache)
+	}
+	rr, _ = srv.readOneWithFlags(ctx, "op://v/warm/f", nil)
+	if rr.Value != "op://v/warm/f@v1" {
+		t.Errorf("Expected warm entry to keep v1, got %q", rr.Value)
+	}
+
+	_, _, misses, _ := srv.cache.Stats()
+	if misses != 2 {
+		t.Errorf("Expected only the two initial misses, got %d", misses)
+	}
+}
+
+func TestServer_RefresherAvoidsColdMiss(t *testing.T) {
+	srv := &api{
+		backend:         &versionedBackend{},
+		cache:           cache.New(300 * time.Millisecond),
+		refreshInterval: 50 * time.Millisecond,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.startRefresher(ctx)
+
+	ref := "op://v/item/f"
+	first, err := srv.readOneWithFlags(ctx, ref, nil)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	// Keep the entry hot for well past its TTL
+	var last string
+	for end := time.Now().Add(time.Second); time.Now().Before(end); time.Sleep(20 * time.Millisecond) {
+		rr, err := srv.readOneWithFlags(ctx, ref, nil)
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		if !rr.FromCache {
+			t.Fatalf("Expected hot entry to stay cached, got a miss")
+		}
+		last = rr.Value
+	}
+
+	if last == first.Value {
+		t.Errorf("Expected value to be refreshed in the background, still %q", last)
+	}
+	_, _, misses, _ := srv.cache.Stats()
+	if misses != 1 {
+		t.Errorf("Expected a single cold miss, got %d", misses)
+	}
+}
+
+func TestServer_RefreshDisabled(t *testing.T) {
+	srv := &api{backend: &versionedBackend{}, cache: cache.New(time.Second)}
+	if _, err := srv.readOneWithFlags(context.Background(), "op://v/item/f", nil); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if len(srv.refreshSources) != 0 {
+		t.Error("Expected no refresh bookkeeping when refresh is disabled")
+	}
+}
+
+func TestServer_RefreshRespectsSession(t *testing.T) {
+	mgr := session.NewManager(session.DefaultConfig())
+	mgr.MarkAuthenticated()
+	srv := &api{
+		backend:         backend.Instrument(backend.NewSessionAwareBackend(&versionedBackend{}, mgr), backend.SessionActivityHooks(mgr)),
+		cache:           cache.New(time.Second),
+		session:         mgr,
+		refreshInterval: time.Second,
+	}
+	ctx := context.Background()
+
+	if _, err := srv.readOneWithFlags(ctx, "op://v/hot/f", nil); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	lastActivity := mgr.GetInfo().LastActivity
+	time.Sleep(10 * time.Millisecond)
+
+	if refreshed := srv.refreshHotEntries(ctx); refreshed != 1 {
+		t.Fatalf("Expected the hot entry to be refreshed, got %d", refreshed)
+	}
+	if !mgr.GetInfo().LastActivity.Equal(lastActivity) {
+		t.Error("Expected refresh not to count as session activity")
+	}
+
+	unlocks := 0
+	mgr.SetCallbacks(func() error { return nil }, func(ctx context.Context) error {
+		unlocks++
+		return nil
+	})
+	mgr.MarkLocked()
+	if refreshed := srv.refreshHotEntries(ctx); refreshed != 0 {
+		t.Errorf("Expected no refresh while the session is locked, got %d", refreshed)
+	}
+	if unlocks != 0 || mgr.GetInfo().State != session.SessionLocked {
+		t.Errorf("Expected refresh to leave the session locked, got %s after %d unlocks", mgr.GetInfo().State, unlocks)
+	}
+}
+
+func TestServer_RefreshAuditsSecretChanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend backend.Backend
+		changed bool
+	}{
+		{name: "rotated value", backend: &versionedBackend{}, changed: true},
+		{name: "same value", backend: backend.Fake{}, changed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_DATA_HOME", t.TempDir())
+			logger, err := audit.NewLoggerWithConfig(true, audit.RollerConfig{})
+			if err != nil {
+				t.Fatalf("Failed to create audit logger: %v", err)
+			}
+			defer logger.Close()
+			sub := logger.Subscribe(4)
+			defer logger.Unsubscribe(sub)
+
+			c := cache.New(time.Second)
+			c.SetTrackChanges(true)
+			srv := &api{backend: tt.backend, cache: c, audit: logger, refreshInterval: time.Second}
+			ctx := context.Background()
+			if _, err := srv.readOneWithFlags(ctx, "op://v/item/f", nil); err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+
+			if refreshed := srv.refreshHotEntries(ctx); refreshed != 1 {
+				t.Fatalf("Expected 1 refreshed entry, got %d", refreshed)
+			}
+
+			select {
+			case event := <-sub.C:
+				if !tt.changed {
+					t.Fatalf("Expected no event for an unchanged value, got %+v", event)
+				}
+				if event.Event != "SECRET_CHANGED" || event.Reference != "op://v/item/f" || event.Details["source"] != "background_refresh" {
+					t.Errorf("Unexpected event: %+v", event)
+				}
+				for _, v := range event.Details {
+					if strings.Contains(v, "@v") {
+						t.Errorf("Expected no secret value in the event, got %+v", event.Details)
+					}
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.changed {
+					t.Fatal("Expected a SECRET_CHANGED event")
+				}
+			}
+		})
+	}
+}
@@ -2,9 +2,7 @@ package server
 
 import (
 	"context"
-	"crypto/subtle"
 	"crypto/tls"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -12,17 +10,13 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
-	"sync"
 	"time"
 
-	"golang.org/x/sync/singleflight"
-
 	"github.com/zach-source/opx/internal/audit"
 	"github.com/zach-source/opx/internal/backend"
 	"github.com/zach-source/opx/internal/cache"
 	"github.com/zach-source/opx/internal/policy"
-	"github.com/zach-source/opx/internal/protocol"
+	"github.com/zach-source/opx/internal/safestring"
 	"github.com/zach-source/opx/internal/security"
 	"github.com/zach-source/opx/internal/session"
 	"github.com/zach-source/opx/internal/util"
@@ -35,7 +29,7 @@ const peerInfoKey = contextKey("peerInfo")
 
 type Server struct {
 	SockPath    string
-	Token       string
+	Token       *safestring.SafeString // loaded by Serve and zeroed when it returns
 	Cache       *cache.Cache
 	Backend     backend.Backend
 	Session     *session.Manager
@@ -43,19 +37,134 @@ type Server struct {
 	PolicyPath  string
 	AuditLogger *audit.Logger
 	Verbose     bool
-
-	sf singleflight.Group
-	mu sync.Mutex
+	// LockPath is the single-instance lockfile (default: opx-authd.lock in RuntimeDir)
+	LockPath string
+	// RefreshInterval enables background refresh of hot entries shortly before
+	// they expire (0 disables); RefreshMaxEntries bounds how many are refreshed per pass
+	RefreshInterval   time.Duration
+	RefreshMaxEntries int
+	// CompressMinBytes gzips read/resolve responses at least this large when the
+	// client accepts gzip (0 disables compression)
+	CompressMinBytes int
+	// MaxRequestBytes bounds JSON request bodies; larger ones get 413 (0 uses 1 MiB)
+	MaxRequestBytes int64
+	// MaxRefsPerRequest bounds the refs of one /v1/reads or /v1/resolve; more get 400 (0 uses 1000)
+	MaxRefsPerRequest int
+	// MaxValueBytes bounds the secret values the daemon caches and returns;
+	// larger ones fail with value_too_large (0 uses 1 MiB)
+	MaxValueBytes int64
+	// AuditCmdlineMax records peer command lines (redacted, truncated to this many
+	// bytes) in audit events; 0 leaves them out
+	AuditCmdlineMax int
+	// ReadTimeout, ReadsTimeout and ResolveTimeout bound /v1/read, /v1/reads and
+	// /v1/resolve; expired requests get 504 deadline_exceeded (0 disables)
+	ReadTimeout    time.Duration
+	ReadsTimeout   time.Duration
+	ResolveTimeout time.Duration
+	// BackendReadTimeout bounds the backend read behind a request, which keeps
+	// running after the request times out so it can fill the cache (0 disables)
+	BackendReadTimeout time.Duration
+	// TrackSecretChanges hashes cached values and audits SECRET_CHANGED when a
+	// refresh reads a different value
+	TrackSecretChanges bool
+	// AllowDebug returns underlying error details to clients that ask for them
+	// with the debug header; without it clients only see generic errors
+	AllowDebug bool
+	// VaultAccounts maps op:// vault names to the 1Password account used to read
+	// them; a request's own --account flag takes precedence
+	VaultAccounts map[string]string
+	// ExpandRefVars fills ${VAR} and $VAR in refs from the vars a request sends,
+	// never from the daemon's environment; off by default
+	ExpandRefVars bool
+	// AllowedOpFlags are the op global flags (names, without "=value") clients
+	// may pass; nil allows DefaultAllowedOpFlags and empty allows none
+	AllowedOpFlags []string
+	// AdminPaths are the peer binaries allowed to call admin endpoints such as
+	// /v1/cache/delete when the policy has no admin section (see DefaultAdminPaths)
+	AdminPaths []string
+	// ExpectedAccount locks the 1Password session when `op whoami` reports any
+	// other account (UUID, email or sign-in URL); empty accepts any account
+	ExpectedAccount string
+	// RedactAccountEmail hides the local part of the account email in status and logs
+	RedactAccountEmail bool
+	// PeerInfoRequired rejects policy-checked requests whose caller can't be
+	// identified; nil requires it exactly when the policy has default_deny
+	PeerInfoRequired *bool
+	// CertPolicy is the minimum key type/size and identity for the TLS
+	// certificate; the zero value is util.DefaultCertPolicy
+	CertPolicy util.CertPolicy
+	// ReadyFile, when set, is written atomically once the daemon is ready and
+	// removed on shutdown; ReadyWaitBackend holds readiness (the file and
+	// systemd's READY=1) until the backend answers a ping
+	ReadyFile        string
+	ReadyWaitBackend bool
+	// RefHistoryPath persists the refs clients read, never their values, so
+	// `opx __complete-ref` can offer them ("" keeps them in memory only);
+	// RefHistoryMaxAge forgets refs unused that long (0 keeps them until evicted)
+	RefHistoryPath   string
+	RefHistoryMaxAge time.Duration
+	// DisableRefHistory keeps no ref history and deletes any at RefHistoryPath
+	DisableRefHistory bool
+	// ApprovalTimeout is how long a request held by a require_approval rule
+	// waits for `opx approve`, and then for its retry (0 uses DefaultApprovalTimeout)
+	ApprovalTimeout time.Duration
+	// ApprovalHook is a shell command run with OPX_APPROVAL_* variables, and
+	// ApprovalWebhook a URL the approval is posted to, whenever a request starts waiting
+	ApprovalHook    string
+	ApprovalWebhook string
+	// ApprovalsPath persists approvals across restarts ("" keeps them in memory only)
+	ApprovalsPath string
+	// PolicyDefaultDeny, when set, overrides default_deny in policies loaded by
+	// /v1/policy/reload, as it did for Policy
+	PolicyDefaultDeny *bool
+	// AuditRequired refuses reads with audit_unavailable while AuditLogger
+	// can't write events, instead of only counting them as dropped
+	AuditRequired bool
+	// DenialMessage is the hint sent with policy_denied errors that neither the
+	// matching rule nor the policy has a message for
+	DenialMessage string
+	// ListenTCP, when set, also serves the API on this loopback address to
+	// clients presenting a certificate from `opx-authd issue-client-cert`;
+	// policy matches them by cert_cn instead of peer credentials
+	ListenTCP string
+
+	// startedAt is when Serve began, reported by /v1/status
+	startedAt time.Time
 }
 
+// Transport limits for slow or idle connections
+const (
+	readHeaderTimeout = 10 * time.Second
+	idleTimeout       = 2 * time.Minute
+)
+
 func (s *Server) Serve(ctx context.Context) error {
+	s.startedAt = time.Now()
 	if s.SockPath == "" {
-		p, err := util.SocketPath()
+		p, err := util.ListenSocketPath()
 		if err != nil {
 			return err
 		}
 		s.SockPath = p
+	} else if err := util.CheckSocketPath(s.SockPath); err != nil {
+		return err
 	}
+	if s.LockPath == "" {
+		p, err := util.LockPath()
+		if err != nil {
+			return err
+		}
+		s.LockPath = p
+	}
+
+	// Hold the lock for the life of the server so a second instance can't
+	// remove our socket as "stale"
+	lock, err := util.AcquireLock(s.LockPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
 	// Prepare socket
 	if err := os.MkdirAll(filepath.Dir(s.SockPath), 0o700); err != nil {
 		return err
@@ -63,7 +172,7 @@ func (s *Server) Serve(ctx context.Context) error {
 	_ = os.Remove(s.SockPath) // remove stale
 
 	// Setup TLS configuration
-	tlsConfig, err := util.TLSConfig()
+	tlsConfig, err := util.TLSConfigWithPolicy(s.CertPolicy)
 	if err != nil {
 		return fmt.Errorf("failed to setup TLS: %w", err)
 	}
@@ -75,32 +184,76 @@ func (s *Server) Serve(ctx context.Context) error {
 	if err := os.Chmod(s.SockPath, 0o700); err != nil {
 		return err
 	}
+	// Point clients at a socket other than the default one
+	if err := util.RecordSocketPath(s.SockPath); err != nil {
+		log.Printf("Warning: clients may not find %s: %v", s.SockPath, err)
+	}
 
 	// Wrap listener with TLS
 	tlsListener := tls.NewListener(l, tlsConfig)
 
+	var tcpListener net.Listener
+	if s.ListenTCP != "" {
+		if tcpListener, err = s.listenTCP(); err != nil {
+			_ = l.Close()
+			return err
+		}
+	}
+
 	// Token
 	tokPath, _ := util.TokenPath()
 	tok, err := util.EnsureToken(tokPath)
 	if err != nil {
 		return err
 	}
-	s.Token = tok
-
-	mux := http.NewServeMux()
-	mux.HandleFunc("/v1/status", s.auth(s.handleStatus))
-	mux.HandleFunc("/v1/read", s.authWithPolicy(s.handleRead))
-	mux.HandleFunc("/v1/reads", s.authWithPolicy(s.handleReads))
-	mux.HandleFunc("/v1/resolve", s.authWithPolicy(s.handleResolve))
-	mux.HandleFunc("/v1/session/unlock", s.auth(s.handleSessionUnlock))
+	s.Token = safestring.New(tok)
+	cache.ZeroizeString(&tok)
+	defer s.zeroize()
 
+	if s.TrackSecretChanges {
+		s.Cache.SetTrackChanges(true)
+	}
+	maxValueBytes := s.MaxValueBytes
+	if maxValueBytes == 0 {
+		maxValueBytes = defaultMaxValueBytes
+	}
+	s.Cache.SetMaxValueBytes(maxValueBytes)
+	a := s.newAPI()
 	srv := &http.Server{
-		Handler:     mux,
-		ConnContext: s.peerConnContext,
+		Handler:           a.handler(),
+		ConnContext:       s.peerConnContext,
+		ReadHeaderTimeout: readHeaderTimeout,
+		IdleTimeout:       idleTimeout,
 	}
 
 	// Start periodic cache cleanup
 	go s.startCacheCleanup(ctx)
+	if s.RefreshInterval > 0 {
+		go a.startRefresher(ctx)
+	}
+	if a.accessLog != nil {
+		go a.accessLog.run(ctx)
+	}
+	if err := s.setupRefHistory(a); err != nil {
+		log.Printf("Warning: ref history: %v", err)
+	}
+	if a.recentRefs != nil && a.recentRefs.path != "" {
+		go a.recentRefs.run(ctx, recentRefsSaveInterval, s.Verbose)
+		defer func() {
+			if err := a.recentRefs.save(); err != nil {
+				log.Printf("Warning: failed to save ref history: %v", err)
+			}
+		}()
+	}
+
+	if err := a.approvals.load(); err != nil {
+		log.Printf("Warning: approvals: %v", err)
+	}
+
+	if s.PolicyPath != "" && s.Policy.HasExpiring() {
+		s.pruneExpiredRules()
+		go s.sweepExpiredRules(ctx, policySweepInterval)
+	}
 
 	// Session management
 	if s.Session != nil {
@@ -112,19 +265,126 @@ func (s *Server) Serve(ctx context.Context) error {
 
 	go func() {
 		<-ctx.Done()
+		s.signalStopping()
 		_ = srv.Close()
 		_ = tlsListener.Close()
 		_ = l.Close()
 		_ = os.Remove(s.SockPath)
 	}()
 
+	if s.Policy.FailsOpen(s.PeerInfoRequired) {
+		log.Printf("WARNING: access policy is FAIL-OPEN: requests whose caller can't be identified skip the policy entirely (set peer_info_required to close this)")
+	}
 	if s.Verbose {
 		log.Printf("op-authd listening on unix+tls://%s backend=%s ttl=%s", s.SockPath, s.Backend.Name(), s.CacheTTL())
 	}
 
+	if tcpListener != nil {
+		if s.Verbose {
+			log.Printf("op-authd listening on tcp+mtls://%s", tcpListener.Addr())
+		}
+		go func() {
+			if err := srv.Serve(tcpListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("TCP listener stopped: %v", err)
+			}
+		}()
+	}
+
+	go s.signalReady(ctx)
 	return srv.Serve(tlsListener)
 }
 
+// listenTCP opens the mutual-TLS listener on ListenTCP, which must be a loopback address
+func (s *Server) listenTCP() (net.Listener, error) {
+	if err := util.CheckLoopbackAddr(s.ListenTCP); err != nil {
+		return nil, fmt.Errorf("listen tcp: %w", err)
+	}
+	ca, err := util.LoadClientCA()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := ca.ServerTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("tcp", s.ListenTCP)
+	if err != nil {
+		return nil, fmt.Errorf("listen tcp %s: %w", s.ListenTCP, err)
+	}
+	return tls.NewListener(l, tlsConfig), nil
+}
+
+// zeroize wipes cached secrets and the token from memory on shutdown
+func (s *Server) zeroize() {
+	removed := s.Cache.Clear()
+	s.Token.Zero()
+	if s.Verbose {
+		log.Printf("Shutdown: zeroized %d cached values and the auth token", removed)
+	}
+}
+
+// newAPI builds the HTTP API from the server's configuration. Nil session and
+// audit pointers stay nil interfaces so the API sees them as disabled.
+func (s *Server) newAPI() *api {
+	a := &api{
+		token:              s.Token,
+		cache:              s.Cache,
+		backend:            s.Backend,
+		policy:             s.Policy,
+		policyPath:         s.PolicyPath,
+		sockPath:           s.SockPath,
+		verbose:            s.Verbose,
+		refreshInterval:    s.RefreshInterval,
+		refreshMaxEntries:  s.RefreshMaxEntries,
+		compressMinBytes:   s.CompressMinBytes,
+		maxRequestBytes:    s.MaxRequestBytes,
+		maxRefsPerRequest:  s.MaxRefsPerRequest,
+		readTimeout:        s.ReadTimeout,
+		readsTimeout:       s.ReadsTimeout,
+		resolveTimeout:     s.ResolveTimeout,
+		backendReadTimeout: s.BackendReadTimeout,
+		allowDebug:         s.AllowDebug,
+		vaultAccounts:      s.VaultAccounts,
+		expandRefVars:      s.ExpandRefVars,
+		allowedOpFlags:     s.AllowedOpFlags,
+		adminPaths:         s.AdminPaths,
+		peerInfoRequired:   s.PeerInfoRequired,
+		policyDefaultDeny:  s.PolicyDefaultDeny,
+		startedAt:          s.startedAt,
+		denialMessage:      s.DenialMessage,
+		auditRequired:      s.AuditRequired,
+	}
+	a.breakdown = newBreakdown(maxBreakdownKeys)
+	a.approvals = newApprovals(s.ApprovalsPath, s.ApprovalTimeout)
+	a.approvals.notify = approvalNotifier(s.ApprovalHook, s.ApprovalWebhook)
+	a.quotas = newQuotas()
+	if s.Verbose {
+		a.accessLog = newLogThrottle(accessLogWindow)
+	}
+	if s.Session != nil {
+		a.session = s.Session
+	}
+	if s.AuditLogger != nil {
+		a.audit = s.AuditLogger
+	}
+	return a
+}
+
+// setupRefHistory loads the ref history into a, or with DisableRefHistory deletes it.
+// A history that can't be loaded is started afresh.
+func (s *Server) setupRefHistory(a *api) error {
+	if s.DisableRefHistory {
+		if s.RefHistoryPath != "" {
+			if err := os.Remove(s.RefHistoryPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		return nil
+	}
+	a.recentRefs = newRecentRefs(s.RefHistoryPath, maxRecentRefs, s.RefHistoryMaxAge)
+	return a.recentRefs.load()
+}
+
 // setupSessionLockCallback configures the session manager to clear cache on lock
 func (s *Server) setupSessionLockCallback() {
 	// Create lock callback that clears cache for security
@@ -137,30 +397,40 @@ func (s *Server) setupSessionLockCallback() {
 		return nil
 	}
 
-	// Set up session validation callback
-	unlockCallback := func(ctx context.Context) error {
-		// Validate session using CLI directly
-		return backend.ValidateCurrentSession(ctx)
-	}
-
-	s.Session.SetCallbacks(lockCallback, unlockCallback)
+	// Validate the session with the CLI directly, recording its account
+	s.Session.SetRedactEmails(s.RedactAccountEmail)
+	s.Session.SetCallbacks(lockCallback, backend.SessionValidator(s.Session, s.ExpectedAccount))
 }
 
-// peerConnContext extracts peer information from Unix socket connections
+// peerConnContext attaches lazily-resolved peer information to Unix socket
+// connections, and the client certificate's identity to TCP ones. Either is
+// only looked up when a handler actually needs it.
 func (s *Server) peerConnContext(ctx context.Context, conn net.Conn) context.Context {
-	if unixConn, ok := conn.(*net.UnixConn); ok {
-		if peerInfo, err := security.PeerFromUnixConn(unixConn); err == nil {
-			ctx = context.WithValue(ctx, peerInfoKey, peerInfo)
-			if s.Verbose {
-				log.Printf("[security] peer connection: %s", peerInfo.String())
-			}
-		} else if s.Verbose {
-			log.Printf("[security] failed to get peer info: %v", err)
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if _, isTCP := tlsConn.NetConn().(*net.TCPConn); isTCP {
+			return context.WithValue(ctx, peerInfoKey, security.NewCertPeer(tlsConn, s.logPeer))
 		}
+		conn = tlsConn.NetConn()
+	}
+	if unixConn, ok := conn.(*net.UnixConn); ok {
+		lazy := security.NewLazyPeerWithCmdline(unixConn, s.AuditCmdlineMax, s.logPeer)
+		ctx = context.WithValue(ctx, peerInfoKey, lazy)
 	}
 	return ctx
 }
 
+// logPeer reports a resolved peer when verbose
+func (s *Server) logPeer(peerInfo security.PeerInfo, err error) {
+	if !s.Verbose {
+		return
+	}
+	if err != nil {
+		log.Printf("[security] failed to get peer info: %v", err)
+		return
+	}
+	log.Printf("[security] peer connection: %s", peerInfo.String())
+}
+
 func (s *Server) CacheTTL() time.Duration {
 	return s.Cache.TTL()
 }
@@ -188,248 +458,33 @@ func (s *Server) startCacheCleanup(ctx context.Context) {
 	}
 }
 
-func (s *Server) auth(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		tok := r.Header.Get("X-OpAuthd-Token")
-		if tok == "" || subtle.ConstantTimeCompare([]byte(tok), []byte(s.Token)) != 1 {
-			w.WriteHeader(http.StatusUnauthorized)
-			_, _ = w.Write([]byte("unauthorized"))
-			return
-		}
-		next(w, r)
-	}
-}
+// policySweepInterval is how often expired rules are pruned from the policy file
+const policySweepInterval = time.Minute
 
-// authWithPolicy combines token auth with policy-based access control
-func (s *Server) authWithPolicy(next http.HandlerFunc) http.HandlerFunc {
-	return s.auth(func(w http.ResponseWriter, r *http.Request) {
-		// Extract peer information from context
-		peerInfo, hasPeer := r.Context().Value(peerInfoKey).(security.PeerInfo)
-		if !hasPeer {
-			if s.Verbose {
-				log.Printf("[security] no peer information available for policy check")
-			}
-			// If we can't get peer info, fall back to basic auth (for backward compatibility)
-			next(w, r)
-			return
-		}
-
-		// Store peer info in request context for use by handlers
-		ctx := context.WithValue(r.Context(), peerInfoKey, peerInfo)
-		r = r.WithContext(ctx)
-		next(w, r)
-	})
-}
-
-// validateAccess checks if peer is allowed to access the given reference
-func (s *Server) validateAccess(peerInfo security.PeerInfo, ref string) bool {
-	subject := policy.Subject{
-		PID:  peerInfo.PID,
-		Path: peerInfo.Path,
-	}
-
-	allowed := policy.Allowed(s.Policy, subject, ref)
-
-	// Audit log the access decision
-	if s.AuditLogger != nil {
-		details := map[string]string{
-			"subject_pid":  fmt.Sprintf("%d", subject.PID),
-			"subject_path": subject.Path,
-		}
-		s.AuditLogger.LogAccessDecision(peerInfo, ref, allowed, s.PolicyPath, details)
-	}
-
-	if s.Verbose {
-		if allowed {
-			log.Printf("[security] access granted: %s -> %s", peerInfo.String(), ref)
-		} else {
-			log.Printf("[security] access denied: %s -> %s", peerInfo.String(), ref)
-		}
-	}
-
-	return allowed
-}
-
-func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
-	size, hits, misses, inflight := s.Cache.Stats()
-	resp := protocol.Status{
-		Backend:    s.Backend.Name(),
-		CacheSize:  size,
-		Hits:       hits,
-		Misses:     misses,
-		InFlight:   inflight,
-		TTLSeconds: int(s.CacheTTL().Seconds()),
-		SocketPath: s.SockPath,
-	}
-
-	// Add session information if session manager is available
-	if s.Session != nil {
-		sessionInfo := s.Session.GetInfo()
-		resp.Session = &protocol.SessionStatus{
-			State:         sessionInfo.State.String(),
-			IdleTimeout:   int(sessionInfo.IdleTimeout.Seconds()),
-			TimeUntilLock: int(sessionInfo.TimeUntilLock().Seconds()),
-			Enabled:       sessionInfo.IdleTimeout > 0,
-		}
-	}
-
-	_ = json.NewEncoder(w).Encode(resp)
-}
-
-func (s *Server) handleSessionUnlock(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	if s.Session == nil {
-		resp := protocol.SessionUnlockResponse{
-			Success: false,
-			State:   "disabled",
-			Message: "Session management is disabled",
-		}
-		w.WriteHeader(http.StatusBadRequest)
-		_ = json.NewEncoder(w).Encode(resp)
-		return
-	}
-
-	// Attempt to validate/unlock the session
-	err := s.Session.ValidateSession(r.Context())
-	sessionInfo := s.Session.GetInfo()
-
-	resp := protocol.SessionUnlockResponse{
-		Success: err == nil,
-		State:   sessionInfo.State.String(),
-	}
-
-	if err != nil {
-		resp.Message = fmt.Sprintf("Session unlock failed: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
-	} else {
-		resp.Message = "Session unlocked successfully"
-	}
-
-	_ = json.NewEncoder(w).Encode(resp)
-}
-
-func (s *Server) handleRead(w http.ResponseWriter, r *http.Request) {
-	var req protocol.ReadRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "bad json", http.StatusBadRequest)
-		return
-	}
-	ref := strings.TrimSpace(req.Ref)
-	if ref == "" {
-		http.Error(w, "ref required", http.StatusBadRequest)
-		return
-	}
-	rr, err := s.readOneWithFlags(r.Context(), ref, req.Flags)
-	if err != nil {
-		if s.Verbose {
-			log.Printf("read error for ref %q: %v", ref, err)
-		}
-		http.Error(w, "failed to read secret", http.StatusBadGateway)
-		return
-	}
-	_ = json.NewEncoder(w).Encode(rr)
-}
-
-func (s *Server) handleReads(w http.ResponseWriter, r *http.Request) {
-	var req protocol.ReadsRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "bad json", http.StatusBadRequest)
-		return
-	}
-	result := make(map[string]protocol.ReadResponse, len(req.Refs))
-	for _, ref := range req.Refs {
-		ref = strings.TrimSpace(ref)
-		if ref == "" {
-			continue
-		}
-		rr, err := s.readOneWithFlags(r.Context(), ref, req.Flags)
-		if err != nil {
-			if s.Verbose {
-				log.Printf("batch read error for ref %q: %v", ref, err)
-			}
-			// record the error in Value to return something; caller decides
-			result[ref] = protocol.ReadResponse{Ref: ref, Value: "ERROR: failed to read secret", FromCache: false, ExpiresIn: 0, ResolvedAt: time.Now().Unix()}
-			continue
-		}
-		result[ref] = rr
-	}
-	_ = json.NewEncoder(w).Encode(protocol.ReadsResponse{Results: result})
-}
+// sweepExpiredRules prunes expired rules from the policy file until ctx is done.
+// Expired rules already grant nothing; this keeps temporary grants from piling up.
+func (s *Server) sweepExpiredRules(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-func (s *Server) handleResolve(w http.ResponseWriter, r *http.Request) {
-	var req protocol.ResolveRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "bad json", http.StatusBadRequest)
-		return
-	}
-	out := make(map[string]string, len(req.Env))
-	for name, ref := range req.Env {
-		rr, err := s.readOneWithFlags(r.Context(), ref, req.Flags)
-		if err != nil {
-			if s.Verbose {
-				log.Printf("resolve error for %s (ref %q): %v", name, ref, err)
-			}
-			http.Error(w, fmt.Sprintf("resolve %s: failed to read secret", name), http.StatusBadGateway)
+	for {
+		select {
+		case <-ctx.Done():
 			return
+		case <-ticker.C:
+			s.pruneExpiredRules()
 		}
-		out[name] = rr.Value
 	}
-	_ = json.NewEncoder(w).Encode(protocol.ResolveResponse{Env: out})
 }
 
-func (s *Server) readOne(ctx context.Context, ref string) (protocol.ReadResponse, error) {
-	return s.readOneWithFlags(ctx, ref, nil)
-}
-
-func (s *Server) readOneWithFlags(ctx context.Context, ref string, flags []string) (protocol.ReadResponse, error) {
-	// Check access policy if peer information is available
-	if peerInfo, hasPeer := ctx.Value(peerInfoKey).(security.PeerInfo); hasPeer {
-		if !s.validateAccess(peerInfo, ref) {
-			return protocol.ReadResponse{}, fmt.Errorf("access denied by policy")
-		}
-	}
-
-	// Create cache key that includes flags for proper cache isolation
-	cacheKey := ref
-	if len(flags) > 0 {
-		cacheKey = ref + "|flags:" + strings.Join(flags, ",")
-	}
-
-	// Cache check
-	if v, ok, exp, cached := s.Cache.Get(cacheKey); ok {
-		s.Cache.IncHit()
-		return protocol.ReadResponse{Ref: ref, Value: v, FromCache: true, ExpiresIn: int(time.Until(exp).Seconds()), ResolvedAt: cached.Unix()}, nil
-	}
-	s.Cache.IncMiss()
-	s.Cache.IncInFlight()
-	defer s.Cache.DecInFlight()
-
-	vIF, err, _ := s.sf.Do(cacheKey, func() (interface{}, error) {
-		// Re-check inside singleflight to avoid thundering herd
-		if v, ok, exp, cached := s.Cache.Get(cacheKey); ok {
-			s.Cache.IncHit()
-			return protocol.ReadResponse{Ref: ref, Value: v, FromCache: true, ExpiresIn: int(time.Until(exp).Seconds()), ResolvedAt: cached.Unix()}, nil
-		}
-		// Read via backend
-		ctx2, cancel := context.WithTimeout(ctx, 20*time.Second)
-		defer cancel()
-		v, err := s.Backend.ReadRefWithFlags(ctx2, ref, flags)
-		if err != nil {
-			return nil, err
-		}
-		s.Cache.Set(cacheKey, v)
-		return protocol.ReadResponse{Ref: ref, Value: v, FromCache: false, ExpiresIn: int(s.CacheTTL().Seconds()), ResolvedAt: time.Now().Unix()}, nil
-	})
+// pruneExpiredRules removes expired rules from the policy file once
+func (s *Server) pruneExpiredRules() {
+	removed, err := policy.PruneExpired(s.PolicyPath, time.Now())
 	if err != nil {
-		return protocol.ReadResponse{}, err
+		log.Printf("Warning: failed to prune expired policy rules: %v", err)
+		return
 	}
-	rr, ok := vIF.(protocol.ReadResponse)
-	if !ok {
-		return protocol.ReadResponse{}, errors.New("internal type assertion failed")
+	if removed > 0 {
+		log.Printf("Removed %d expired rule(s) from %s", removed, s.PolicyPath)
 	}
-	return rr, nil
 }
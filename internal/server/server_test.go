@@ -1,26 +1,39 @@
 package server
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/zach-source/opx/internal/audit"
 	"github.com/zach-source/opx/internal/backend"
 	"github.com/zach-source/opx/internal/cache"
+	"github.com/zach-source/opx/internal/client"
+	"github.com/zach-source/opx/internal/policy"
 	"github.com/zach-source/opx/internal/protocol"
+	"github.com/zach-source/opx/internal/safestring"
+	"github.com/zach-source/opx/internal/security"
 	"github.com/zach-source/opx/internal/session"
+	"github.com/zach-source/opx/internal/util"
 )
 
 func TestServer_StatusHandler(t *testing.T) {
 	// Test status handler without session management
-	srv := &Server{
-		Backend: backend.Fake{},
-		Cache:   cache.New(5 * time.Minute),
-		Verbose: false,
+	srv := &api{
+		backend: backend.Fake{},
+		cache:   cache.New(5 * time.Minute),
+		verbose: false,
 	}
 
 	req := httptest.NewRequest("GET", "/v1/status", nil)
@@ -46,6 +59,38 @@ func TestServer_StatusHandler(t *testing.T) {
 	}
 }
 
+func TestServer_StatusUptime(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	srv := &api{
+		backend:   backend.Fake{},
+		cache:     cache.New(5 * time.Minute),
+		clock:     clock.now,
+		startedAt: clock.now(),
+	}
+	status := func() protocol.Status {
+		w := httptest.NewRecorder()
+		srv.handleStatus(w, httptest.NewRequest("GET", "/v1/status", nil))
+		var st protocol.Status
+		if err := json.NewDecoder(w.Body).Decode(&st); err != nil {
+			t.Fatalf("Failed to decode status: %v", err)
+		}
+		return st
+	}
+
+	first := status()
+	if first.StartedAt != 1700000000 || first.UptimeSeconds < 0 {
+		t.Errorf("Expected start 1700000000 and a non-negative uptime, got %d and %d", first.StartedAt, first.UptimeSeconds)
+	}
+	clock.advance(90 * time.Second)
+	second := status()
+	if second.UptimeSeconds <= first.UptimeSeconds || second.UptimeSeconds != 90 {
+		t.Errorf("Expected uptime to grow to 90s, got %d then %d", first.UptimeSeconds, second.UptimeSeconds)
+	}
+	if second.StartedAt != first.StartedAt {
+		t.Errorf("Expected the start time to stay %d, got %d", first.StartedAt, second.StartedAt)
+	}
+}
+
 func TestServer_StatusHandlerWithSessionManagement(t *testing.T) {
 	// Create session manager with proper configuration
 	sessionConfig := &session.Config{
@@ -60,11 +105,11 @@ func TestServer_StatusHandlerWithSessionManagement(t *testing.T) {
 	be := backend.NewSessionAwareFake(sessionManager)
 
 	// Create server
-	srv := &Server{
-		Backend: be,
-		Cache:   cache.New(5 * time.Minute),
-		Session: sessionManager,
-		Verbose: false,
+	srv := &api{
+		backend: be,
+		cache:   cache.New(5 * time.Minute),
+		session: sessionManager,
+		verbose: false,
 	}
 
 	req := httptest.NewRequest("GET", "/v1/status", nil)
@@ -117,11 +162,11 @@ func TestServer_SessionUnlockHandler(t *testing.T) {
 	)
 
 	// Create server
-	srv := &Server{
-		Backend: backend.Fake{},
-		Cache:   cache.New(5 * time.Minute),
-		Session: sessionManager,
-		Verbose: false,
+	srv := &api{
+		backend: backend.Fake{},
+		cache:   cache.New(5 * time.Minute),
+		session: sessionManager,
+		verbose: false,
 	}
 
 	// Test session unlock endpoint directly (without auth middleware for now)
@@ -148,11 +193,11 @@ func TestServer_SessionUnlockHandler(t *testing.T) {
 
 func TestServer_SessionUnlockHandlerWithoutSessionManager(t *testing.T) {
 	// Test server behavior when no session manager is configured
-	srv := &Server{
-		Backend: backend.Fake{},
-		Cache:   cache.New(5 * time.Minute),
-		Session: nil, // No session manager
-		Verbose: false,
+	srv := &api{
+		backend: backend.Fake{},
+		cache:   cache.New(5 * time.Minute),
+		session: nil, // No session manager
+		verbose: false,
 	}
 
 	// Test unlock endpoint - should return error
@@ -179,3 +224,812 @@ func TestServer_SessionUnlockHandlerWithoutSessionManager(t *testing.T) {
 		t.Errorf("Expected state 'disabled', got %q", unlockResp.State)
 	}
 }
+
+func TestServer_SessionReloadAppliesSavedIdleTimeout(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("OPX_SESSION_IDLE_TIMEOUT", "")
+	mgr := session.NewManager(session.DefaultConfig())
+	srv := &api{backend: backend.Fake{}, cache: cache.New(5 * time.Minute), session: mgr}
+
+	saved := session.DefaultConfig()
+	saved.SessionIdleTimeout = 4 * time.Hour
+	if err := saved.SaveConfig(); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	srv.handleSessionReload(w, httptest.NewRequest("POST", "/v1/session/reload", strings.NewReader("{}")))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp protocol.SessionReloadResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode reload response: %v", err)
+	}
+	if !resp.Success || resp.IdleTimeout != int((4*time.Hour).Seconds()) {
+		t.Errorf("Expected a 4h idle timeout applied, got %+v", resp)
+	}
+	if got := mgr.GetInfo().IdleTimeout; got != 4*time.Hour {
+		t.Errorf("Expected the manager's idle timeout to be 4h, got %v", got)
+	}
+
+	// Without session management there is nothing to reload
+	srv.session = nil
+	w = httptest.NewRecorder()
+	srv.handleSessionReload(w, httptest.NewRequest("POST", "/v1/session/reload", strings.NewReader("{}")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 with session management disabled, got %d", w.Code)
+	}
+}
+
+func TestServer_ReadEnforcesPolicyWithPeerInfo(t *testing.T) {
+	srv := &api{
+		backend: backend.Fake{},
+		cache:   cache.New(5 * time.Minute),
+		policy: policy.Policy{
+			Allow:       []policy.Rule{{Path: "/usr/bin/allowed", Refs: []string{"op://vault/*"}}},
+			DefaultDeny: true,
+		},
+	}
+
+	tests := []struct {
+		name       string
+		peer       security.PeerInfo
+		ref        string
+		expectCode int
+	}{
+		{"allowed peer", security.PeerInfo{PID: 1, Path: "/usr/bin/allowed"}, "op://vault/item/field", http.StatusOK},
+		{"denied peer", security.PeerInfo{PID: 2, Path: "/usr/bin/other"}, "op://vault/item/field", http.StatusForbidden},
+		{"denied ref", security.PeerInfo{PID: 1, Path: "/usr/bin/allowed"}, "op://other/item/field", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/read", strings.NewReader(`{"ref":"`+tt.ref+`"}`))
+			req = req.WithContext(context.WithValue(req.Context(), peerInfoKey, tt.peer))
+			w := httptest.NewRecorder()
+
+			srv.handleRead(w, req)
+
+			if w.Code != tt.expectCode {
+				t.Errorf("Expected status %d, got %d. Body: %s", tt.expectCode, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestServer_NeedsPeerInfo(t *testing.T) {
+	srv := &api{}
+	if srv.needsPeerInfo() {
+		t.Error("Expected peer info to be unnecessary with empty policy and no audit log")
+	}
+
+	srv.policy = policy.Policy{DefaultDeny: true}
+	if !srv.needsPeerInfo() {
+		t.Error("Expected peer info to be required with default_deny policy")
+	}
+}
+
+func TestServer_PeerInfoMemoizedPerConnection(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "peer.sock")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: sock, Net: "unix"})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	clientConn, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: sock, Net: "unix"})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer clientConn.Close()
+	serverConn, err := l.AcceptUnix()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	defer serverConn.Close()
+
+	// ConnContext runs once per connection; every request on it shares the LazyPeer
+	srv := &Server{}
+	ctx := srv.peerConnContext(context.Background(), serverConn)
+	lazy, ok := ctx.Value(peerInfoKey).(*security.LazyPeer)
+	if !ok {
+		t.Fatal("Expected a LazyPeer attached to the connection context")
+	}
+
+	first, ok := peerFromContext(ctx)
+	if !ok {
+		t.Skip("peer credentials unavailable on this platform")
+	}
+	second, _ := peerFromContext(ctx)
+	if first != second || first.PID != os.Getpid() {
+		t.Errorf("Expected consistent peer info for pid %d, got %+v and %+v", os.Getpid(), first, second)
+	}
+	if again, _ := lazy.Get(); again != first {
+		t.Errorf("Expected memoized peer info, got %+v", again)
+	}
+}
+
+func TestServer_TCPListenerMutualTLS(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	ca, err := util.LoadClientCA()
+	if err != nil {
+		t.Fatalf("LoadClientCA failed: %v", err)
+	}
+	tlsConfig, err := ca.ServerTLSConfig()
+	if err != nil {
+		t.Fatalf("ServerTLSConfig failed: %v", err)
+	}
+
+	a := &api{
+		token:   safestring.New("tok"),
+		backend: backend.Fake{},
+		cache:   cache.New(time.Minute),
+		policy: policy.Policy{
+			Allow:       []policy.Rule{{CertCN: "wsl-dev", Refs: []string{"op://dev/*"}}},
+			DefaultDeny: true,
+		},
+		adminPaths: []string{"/usr/bin/opx"},
+	}
+	ts := httptest.NewUnstartedServer(a.handler())
+	ts.TLS = tlsConfig
+	ts.Config.ConnContext = (&Server{}).peerConnContext
+	ts.StartTLS()
+	defer ts.Close()
+
+	bundleDir := t.TempDir()
+	writeBundle := func(issuer *util.ClientCA, cn string) string {
+		bundle, err := issuer.ClientBundle(cn, time.Hour, "tok")
+		if err != nil {
+			t.Fatalf("ClientBundle failed: %v", err)
+		}
+		// Trust the daemon's CA too, so only the client certificate can be at fault
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Cert.Raw})...)
+		path := filepath.Join(bundleDir, cn+".pem")
+		if err := os.WriteFile(path, bundle, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	newClient := func(bundle string) *client.Client {
+		t.Setenv(util.TCPEndpointEnv, ts.Listener.Addr().String())
+		t.Setenv(util.ClientCertEnv, bundle)
+		cli, err := client.New()
+		if err != nil {
+			t.Fatalf("client.New failed: %v", err)
+		}
+		return cli
+	}
+	ctx := context.Background()
+
+	wsl := newClient(writeBundle(ca, "wsl-dev"))
+	if _, err := wsl.Read(ctx, "op://dev/db/password"); err != nil {
+		t.Errorf("Expected the cert_cn rule to allow wsl-dev, got %v", err)
+	}
+	var se *client.StatusError
+	if _, err := wsl.Read(ctx, "op://prod/db/password"); !errors.As(err, &se) || se.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a ref outside the rule, got %v", err)
+	}
+	if _, err := wsl.ExplainPolicy(ctx, protocol.PolicyExplainRequest{Ref: "op://dev/db/password"}); !errors.As(err, &se) || se.Code != http.StatusForbidden {
+		t.Errorf("Expected admin endpoints to refuse TCP clients, got %v", err)
+	}
+
+	other := newClient(writeBundle(ca, "vm-ci"))
+	if _, err := other.Read(ctx, "op://dev/db/password"); !errors.As(err, &se) || se.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for another common name, got %v", err)
+	}
+
+	// A certificate from a CA the daemon didn't create never gets to the API
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	rogueCA, err := util.LoadClientCA()
+	if err != nil {
+		t.Fatalf("LoadClientCA failed: %v", err)
+	}
+	rogue := newClient(writeBundle(rogueCA, "rogue"))
+	if _, err := rogue.Read(ctx, "op://dev/db/password"); err == nil || errors.As(err, &se) {
+		t.Errorf("Expected the TLS handshake to reject an unknown client, got %v", err)
+	}
+}
+
+func TestServer_AuditStreamDisabled(t *testing.T) {
+	logger, _ := audit.NewLogger(false)
+	srv := &api{
+		backend: backend.Fake{},
+		cache:   cache.New(5 * time.Minute),
+		audit:   logger,
+	}
+
+	req := httptest.NewRequest("GET", "/v1/audit/stream", nil)
+	w := httptest.NewRecorder()
+	srv.handleAuditStream(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 when audit logging disabled, got %d", w.Code)
+	}
+}
+
+func TestServer_AuditStream(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	logger, err := audit.NewLoggerWithConfig(true, audit.RollerConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create audit logger: %v", err)
+	}
+	defer logger.Close()
+
+	srv := &api{
+		backend: backend.Fake{},
+		cache:   cache.New(5 * time.Minute),
+		audit:   logger,
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(srv.handleAuditStream))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Stream request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Expected ndjson content type, got %q", ct)
+	}
+
+	// Headers are flushed after subscribing, so this event is delivered
+	logger.LogAccessDecision(security.PeerInfo{PID: 9, Path: "/usr/bin/tool"}, "op://vault/item/field", false, "", nil)
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read event: %v", err)
+	}
+	var event audit.AuditEvent
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		t.Fatalf("Failed to decode event: %v", err)
+	}
+	if event.Decision != "DENY" || event.Reference != "op://vault/item/field" {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+}
+
+func TestServer_AuditEventRequestIDAndCmdline(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	logger, err := audit.NewLoggerWithConfig(true, audit.RollerConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create audit logger: %v", err)
+	}
+	defer logger.Close()
+	sub := logger.Subscribe(4)
+	defer logger.Unsubscribe(sub)
+
+	srv := &api{
+		token:   safestring.New("tok"),
+		backend: backend.Fake{},
+		cache:   cache.New(5 * time.Minute),
+		audit:   logger,
+		policy:  policy.Policy{DefaultDeny: true},
+	}
+
+	peer := security.PeerInfo{PID: 7, Path: "/usr/bin/tool", Cmdline: "tool --token=[REDACTED] run"}
+	req := httptest.NewRequest("POST", "/v1/read", strings.NewReader(`{"ref":"op://vault/item/field"}`))
+	req.Header.Set("X-OpAuthd-Token", "tok")
+	req = req.WithContext(context.WithValue(req.Context(), peerInfoKey, peer))
+	w := httptest.NewRecorder()
+	srv.auth(srv.handleRead)(w, req)
+
+	id := w.Header().Get("X-Request-ID")
+	if id == "" {
+		t.Fatal("Expected X-Request-ID response header")
+	}
+
+	select {
+	case event := <-sub.C:
+		if event.RequestID != id {
+			t.Errorf("Expected request_id %q, got %q", id, event.RequestID)
+		}
+		if event.PeerCmdline != peer.Cmdline {
+			t.Errorf("Expected peer_cmdline %q, got %q", peer.Cmdline, event.PeerCmdline)
+		}
+		if event.Action != policy.ActionRead {
+			t.Errorf("Expected action %q, got %q", policy.ActionRead, event.Action)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected an access decision event")
+	}
+}
+
+func TestServer_AuditRecordsCreateAction(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	logger, err := audit.NewLoggerWithConfig(true, audit.RollerConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create audit logger: %v", err)
+	}
+	defer logger.Close()
+	sub := logger.Subscribe(4)
+	defer logger.Unsubscribe(sub)
+
+	// The peer may read the vault but was never granted create
+	peer := security.PeerInfo{PID: 7, Path: "/usr/bin/tool"}
+	srv := &api{
+		token:   safestring.New("tok"),
+		backend: &creatingBackend{},
+		cache:   cache.New(5 * time.Minute),
+		audit:   logger,
+		policy:  policy.Policy{Allow: []policy.Rule{{Path: peer.Path, Refs: []string{"op://dev/*"}}}, DefaultDeny: true},
+	}
+
+	req := httptest.NewRequest("POST", "/v1/create", strings.NewReader(`{"vault":"dev","title":"MyApp","fields":[{"name":"password","generate":true}]}`))
+	req.Header.Set("X-OpAuthd-Token", "tok")
+	req = req.WithContext(context.WithValue(req.Context(), peerInfoKey, peer))
+	w := httptest.NewRecorder()
+	srv.handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", w.Code)
+	}
+	select {
+	case event := <-sub.C:
+		if event.Action != policy.ActionCreate || event.Decision != "DENY" || event.Reference != "op://dev/MyApp" {
+			t.Errorf("Expected denied create of op://dev/MyApp, got %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected an access decision event")
+	}
+}
+
+func TestServer_CacheDeleteTombstone(t *testing.T) {
+	srv := &api{
+		backend: backend.Fake{},
+		cache:   cache.New(5 * time.Minute),
+	}
+	ref := "op://vault/item/field"
+
+	// Populate cache
+	w := httptest.NewRecorder()
+	srv.handleRead(w, httptest.NewRequest("POST", "/v1/read", strings.NewReader(`{"ref":"`+ref+`"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected initial read to succeed, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	srv.handleCacheDelete(w, httptest.NewRequest("POST", "/v1/cache/delete", strings.NewReader(`{"ref":"`+ref+`","tombstone_seconds":3600}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected delete to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	var delResp protocol.CacheDeleteResponse
+	if err := json.NewDecoder(w.Body).Decode(&delResp); err != nil {
+		t.Fatalf("Failed to decode delete response: %v", err)
+	}
+	if delResp.Removed != 1 {
+		t.Errorf("Expected 1 removed entry, got %d", delResp.Removed)
+	}
+
+	// Subsequent reads are 410 Gone with a structured body
+	w = httptest.NewRecorder()
+	srv.handleRead(w, httptest.NewRequest("POST", "/v1/read", strings.NewReader(`{"ref":"`+ref+`"}`)))
+	if w.Code != http.StatusGone {
+		t.Fatalf("Expected 410 for tombstoned ref, got %d", w.Code)
+	}
+	var errResp protocol.ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&errResp); err != nil {
+		t.Fatalf("Failed to decode error response: %v", err)
+	}
+	if errResp.Code != "ERR_DELETED" || errResp.Message != "ref has been deleted" {
+		t.Errorf("Unexpected error body: %+v", errResp)
+	}
+}
+
+func TestServer_SessionTouch(t *testing.T) {
+	sessionManager := session.NewManager(&session.Config{
+		SessionIdleTimeout: 1 * time.Hour,
+		EnableSessionLock:  true,
+		CheckInterval:      1 * time.Minute,
+	})
+	srv := &api{
+		backend: backend.Fake{},
+		cache:   cache.New(5 * time.Minute),
+		session: sessionManager,
+	}
+
+	touch := func() (int, protocol.SessionTouchResponse) {
+		w := httptest.NewRecorder()
+		srv.handleSessionTouch(w, httptest.NewRequest("POST", "/v1/session/touch", nil))
+		var resp protocol.SessionTouchResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode touch response: %v", err)
+		}
+		return w.Code, resp
+	}
+
+	sessionManager.MarkAuthenticated()
+	code, resp := touch()
+	if code != http.StatusOK || !resp.Success {
+		t.Errorf("Expected touch to succeed on authenticated session, got %d %+v", code, resp)
+	}
+	if resp.TimeUntilLock <= 0 {
+		t.Errorf("Expected positive time until lock, got %d", resp.TimeUntilLock)
+	}
+
+	// A locked session must not be resurrected by touch
+	sessionManager.MarkLocked()
+	code, resp = touch()
+	if code != http.StatusConflict || resp.Success {
+		t.Errorf("Expected touch to be refused for locked session, got %d %+v", code, resp)
+	}
+	if sessionManager.GetInfo().State != session.SessionLocked {
+		t.Error("Expected session to remain locked")
+	}
+}
+
+func TestServer_SessionEvents(t *testing.T) {
+	sessionManager := session.NewManager(&session.Config{
+		SessionIdleTimeout: 1 * time.Hour,
+		EnableSessionLock:  true,
+		CheckInterval:      1 * time.Minute,
+	})
+	srv := &api{
+		backend: backend.Fake{},
+		cache:   cache.New(5 * time.Minute),
+		session: sessionManager,
+	}
+
+	poll := func(query string) (int, protocol.SessionEventResponse) {
+		w := httptest.NewRecorder()
+		srv.handleSessionEvents(w, httptest.NewRequest("GET", "/v1/session/events"+query, nil))
+		var resp protocol.SessionEventResponse
+		_ = json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+
+	sessionManager.MarkAuthenticated()
+	if code, resp := poll(""); code != http.StatusOK || resp.Seq != 1 || resp.State != "authenticated" || resp.Changed {
+		t.Errorf("Expected current state seq 1 without waiting, got %d %+v", code, resp)
+	}
+
+	// Polling at the current sequence times out unchanged
+	start := time.Now()
+	if _, resp := poll("?since=1&timeout=30ms"); resp.Changed || resp.Seq != 1 {
+		t.Errorf("Expected unchanged seq 1 after timeout, got %+v", resp)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Expected the poll to wait for the timeout, returned after %v", elapsed)
+	}
+
+	// A transition wakes a waiting poll
+	done := make(chan protocol.SessionEventResponse, 1)
+	go func() {
+		_, resp := poll("?since=1&timeout=5s")
+		done <- resp
+	}()
+	time.Sleep(20 * time.Millisecond)
+	sessionManager.MarkLocked()
+	select {
+	case resp := <-done:
+		if !resp.Changed || resp.Seq != 2 || resp.State != "locked" {
+			t.Errorf("Expected changed seq 2 locked, got %+v", resp)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the poll to return after the session locked")
+	}
+
+	for _, query := range []string{"?since=x", "?since=1&timeout=soon", "?since=1&timeout=-1s"} {
+		if code, _ := poll(query); code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, code)
+		}
+	}
+}
+
+func TestServer_SingleInstanceLock(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	dir := t.TempDir()
+	lockPath := filepath.Join(dir, "opx-authd.lock")
+	newServer := func(sock string) *Server {
+		return &Server{
+			SockPath: filepath.Join(dir, sock),
+			LockPath: lockPath,
+			Backend:  backend.Fake{},
+			Cache:    cache.New(time.Minute),
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := newServer("first.sock")
+	done := make(chan error, 1)
+	go func() { done <- first.Serve(ctx) }()
+
+	// Wait for the first instance to be listening
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(first.SockPath); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			cancel()
+			t.Fatal("First server did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	err := newServer("second.sock").Serve(context.Background())
+	var running *util.AlreadyRunningError
+	if !errors.As(err, &running) {
+		cancel()
+		t.Fatalf("Expected second Serve to fail with AlreadyRunningError, got %v", err)
+	}
+	if running.PID != os.Getpid() {
+		t.Errorf("Expected holder pid %d, got %d", os.Getpid(), running.PID)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("First server did not shut down")
+	}
+
+	// Lock is released on shutdown
+	lock, err := util.AcquireLock(lockPath)
+	if err != nil {
+		t.Fatalf("Expected lock to be free after shutdown: %v", err)
+	}
+	_ = lock.Release()
+}
+
+func TestServer_ReadSecretTypeHint(t *testing.T) {
+	srv := &api{
+		backend: backend.NewMultiBackend(backend.Fake{}, backend.Fake{}, nil, "op"),
+		cache:   cache.New(5 * time.Minute),
+	}
+
+	read := func(body string) (int, protocol.ReadResponse) {
+		w := httptest.NewRecorder()
+		srv.handleRead(w, httptest.NewRequest("POST", "/v1/read", strings.NewReader(body)))
+		var rr protocol.ReadResponse
+		if w.Code == http.StatusOK {
+			_ = json.NewDecoder(w.Body).Decode(&rr)
+		}
+		return w.Code, rr
+	}
+
+	code, auto := read(`{"ref":"some/path"}`)
+	if code != http.StatusOK {
+		t.Fatalf("Expected auto read to succeed, got %d", code)
+	}
+	code, vault := read(`{"ref":"some/path","secret_type":"vault"}`)
+	if code != http.StatusOK {
+		t.Fatalf("Expected vault read to succeed, got %d", code)
+	}
+
+	want, _ := backend.Fake{}.ReadRef(context.Background(), "vault://some/path")
+	if vault.Value != want {
+		t.Errorf("Expected value from vault backend %q, got %q", want, vault.Value)
+	}
+	if vault.FromCache || vault.Value == auto.Value {
+		t.Error("Expected secret type to be part of the cache key")
+	}
+
+	if code, _ := read(`{"ref":"some/path","secret_type":"nope"}`); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unknown secret type, got %d", code)
+	}
+	if code, _ := read(`{"ref":"some/path","secret_type":"bao"}`); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unconfigured backend, got %d", code)
+	}
+}
+
+func TestServer_ThrottledDenialsStillAudited(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	logger, err := audit.NewLoggerWithConfig(true, audit.RollerConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create audit logger: %v", err)
+	}
+	defer logger.Close()
+	sub := logger.Subscribe(8)
+	defer logger.Unsubscribe(sub)
+
+	var logged []string
+	throttle := newLogThrottle(time.Minute)
+	throttle.logf = func(format string, args ...any) { logged = append(logged, fmt.Sprintf(format, args...)) }
+
+	peer := security.PeerInfo{PID: 7, Path: "/usr/bin/tool"}
+	srv := &api{
+		token:     safestring.New("tok"),
+		backend:   backend.Fake{},
+		cache:     cache.New(5 * time.Minute),
+		audit:     logger,
+		verbose:   true,
+		accessLog: throttle,
+		policy:    policy.Policy{DefaultDeny: true},
+	}
+
+	const denials = 3
+	for i := 0; i < denials; i++ {
+		req := httptest.NewRequest("POST", "/v1/read", strings.NewReader(`{"ref":"op://vault/item/field"}`))
+		req.Header.Set("X-OpAuthd-Token", "tok")
+		req = req.WithContext(context.WithValue(req.Context(), peerInfoKey, peer))
+		srv.handler().ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if len(logged) != 1 {
+		t.Errorf("Expected 1 logged denial, got %v", logged)
+	}
+	for i := 0; i < denials; i++ {
+		select {
+		case event := <-sub.C:
+			if event.Decision != "DENY" {
+				t.Errorf("Expected DENY event, got %+v", event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected %d audit events, got %d", denials, i)
+		}
+	}
+}
+
+func TestServer_ShutdownZeroizes(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	dir := t.TempDir()
+	c := cache.New(time.Minute)
+	srv := &Server{
+		SockPath: filepath.Join(dir, "opx.sock"),
+		LockPath: filepath.Join(dir, "opx-authd.lock"),
+		Backend:  backend.Fake{},
+		Cache:    c,
+	}
+	for _, key := range []string{"op://v/a/f", "op://v/b/f|flags:--reveal"} {
+		if err := c.Set(key, "secret"); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(srv.SockPath); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			cancel()
+			t.Fatal("Server did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not shut down")
+	}
+
+	if size, _, _, _ := c.Stats(); size != 0 {
+		t.Errorf("Expected an empty cache after shutdown, got %d entries", size)
+	}
+	if srv.Token == nil {
+		t.Fatal("Expected Serve to load the token")
+	}
+	if !srv.Token.IsEmpty() {
+		t.Error("Expected the token to be zeroized after shutdown")
+	}
+}
+
+// serveWithClient runs a Server over be on a temporary socket until the test
+// ends and returns a client connected to it
+func serveWithClient(t *testing.T, be backend.Backend) *client.Client {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	t.Setenv("OPX_AUTOSTART", "0")
+
+	dir := t.TempDir()
+	srv := &Server{
+		SockPath: filepath.Join(dir, "opx.sock"),
+		LockPath: filepath.Join(dir, "opx-authd.lock"),
+		Backend:  be,
+		Cache:    cache.New(time.Minute),
+		// Readiness comes after the token is written, unlike the socket
+		ReadyFile: filepath.Join(dir, "opx-authd.ready"),
+	}
+	t.Setenv(util.SocketEnv, srv.SockPath)
+	t.Setenv(util.NotifySocketEnv, "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ctx) }()
+	t.Cleanup(func() { cancel(); <-done })
+	waitForFile(t, srv.ReadyFile)
+
+	cli, err := client.New()
+	if err != nil {
+		t.Fatalf("client.New failed: %v", err)
+	}
+	return cli
+}
+
+func TestServer_ResolveReadsConcurrently(t *testing.T) {
+	const latency = 100 * time.Millisecond
+	// The same single batch opx run sends for a child needing 15 secrets
+	cli := serveWithClient(t, backend.NewFake(backend.WithLatency("*", latency)))
+	env := make(map[string]string)
+	for i := range 15 {
+		env[fmt.Sprintf("SECRET_%d", i)] = fmt.Sprintf("op://vault/item%d/password", i)
+	}
+
+	start := time.Now()
+	resp, err := cli.ResolveWithFlags(context.Background(), env, nil)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if len(resp.Env) != len(env) {
+		t.Fatalf("Expected %d values, got %d", len(env), len(resp.Env))
+	}
+	// Sequential reads would take 15x the latency; concurrent ones about 2x
+	if elapsed >= 5*latency {
+		t.Errorf("Expected the resolve to take well under %v, took %v", 15*latency, elapsed)
+	}
+}
+
+func TestServer_TimingBreakdown(t *testing.T) {
+	const latency = 80 * time.Millisecond
+	cli := serveWithClient(t, backend.NewFake(backend.WithLatency("*", latency)))
+	ctx := context.Background()
+
+	// Without --timing nothing is recorded or requested
+	if err := cli.EnsureReady(ctx); err != nil {
+		t.Fatalf("EnsureReady failed: %v", err)
+	}
+	if _, err := cli.Read(ctx, "op://vault/untimed/password"); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if cli.Timing != nil {
+		t.Fatal("Expected no timing without opting in")
+	}
+
+	timing := &client.Timing{}
+	cli.Timing = timing
+	start := time.Now()
+	if err := cli.EnsureReady(ctx); err != nil {
+		t.Fatalf("EnsureReady failed: %v", err)
+	}
+	if _, err := cli.Read(ctx, "op://vault/timed/password"); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	total := time.Since(start)
+
+	s := timing.Server
+	if timing.Requests != 1 {
+		t.Errorf("Expected 1 timed request, got %d", timing.Requests)
+	}
+	if s.Backend < latency {
+		t.Errorf("Expected backend time of at least %v, got %v", latency, s.Backend)
+	}
+	if s.Cache+s.Queue+s.Backend > s.Total {
+		t.Errorf("Expected daemon phases within its total %v, got %+v", s.Total, s)
+	}
+	if s.Total > timing.RTT {
+		t.Errorf("Expected daemon total %v within the round trip %v", s.Total, timing.RTT)
+	}
+	if sum := timing.Ensure + timing.Connect + timing.RTT; sum > total {
+		t.Errorf("Expected client phases %v within the wall time %v", sum, total)
+	}
+	if !strings.HasPrefix(timing.Summary(total), "timing: total ") {
+		t.Errorf("Unexpected summary %q", timing.Summary(total))
+	}
+
+	// A cached read spends no backend time
+	before := timing.Server.Backend
+	if _, err := cli.Read(ctx, "op://vault/timed/password"); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if timing.Server.Backend != before {
+		t.Errorf("Expected no backend time for a cached read, got %v more", timing.Server.Backend-before)
+	}
+}
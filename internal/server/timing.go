@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/zach-source/opx/internal/protocol"
+)
+
+// timingKey holds the *requestTiming of a request that asked for Server-Timing
+const timingKey = contextKey("timing")
+
+// requestTiming accumulates the phases of one request; concurrent reads add to it
+type requestTiming struct {
+	start                 time.Time
+	cache, queue, backend atomic.Int64 // nanoseconds
+}
+
+// timingFromContext returns the request's timing, or nil when it didn't ask for one
+func timingFromContext(ctx context.Context) *requestTiming {
+	t, _ := ctx.Value(timingKey).(*requestTiming)
+	return t
+}
+
+// addCache, addQueue and addBackend record time spent since start; all are no-ops on nil
+func (t *requestTiming) addCache(start time.Time) {
+	if t != nil {
+		t.cache.Add(int64(time.Since(start)))
+	}
+}
+
+func (t *requestTiming) addQueue(start time.Time) {
+	if t != nil {
+		t.queue.Add(int64(time.Since(start)))
+	}
+}
+
+func (t *requestTiming) addBackend(start time.Time) {
+	if t != nil {
+		t.backend.Add(int64(time.Since(start)))
+	}
+}
+
+// serverTiming snapshots the phases so far
+func (t *requestTiming) serverTiming() protocol.ServerTiming {
+	return protocol.ServerTiming{
+		Total:   time.Since(t.start),
+		Cache:   time.Duration(t.cache.Load()),
+		Queue:   time.Duration(t.queue.Load()),
+		Backend: time.Duration(t.backend.Load()),
+	}
+}
+
+// timingResponseWriter sets the Server-Timing header just before the response starts
+type timingResponseWriter struct {
+	http.ResponseWriter
+	timing  *requestTiming
+	written bool
+}
+
+func (w *timingResponseWriter) WriteHeader(code int) {
+	if !w.written {
+		w.written = true
+		w.Header().Set(protocol.ServerTimingHeader, w.timing.serverTiming().String())
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *timingResponseWriter) Write(p []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// timed reports cache, queue, backend and total time in a Server-Timing header
+// to clients that send the timing header (opx --timing)
+func (a *api) timed(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(protocol.TimingHeader) != "1" {
+			next(w, r)
+			return
+		}
+		t := &requestTiming{start: time.Now()}
+		next(&timingResponseWriter{ResponseWriter: w, timing: t}, r.WithContext(context.WithValue(r.Context(), timingKey, t)))
+	}
+}
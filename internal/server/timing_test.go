@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zach-source/opx/internal/backend"
+	"github.com/zach-source/opx/internal/cache"
+	"github.com/zach-source/opx/internal/protocol"
+	"github.com/zach-source/opx/internal/safestring"
+)
+
+func TestAPI_ServerTimingOnlyWhenAsked(t *testing.T) {
+	const latency = 30 * time.Millisecond
+	for _, path := range []string{"/v1/read", "/v1/reads", "/v1/resolve"} {
+		body := map[string]string{
+			"/v1/read":    `{"ref":"op://v/i/f"}`,
+			"/v1/reads":   `{"refs":["op://v/i/f"]}`,
+			"/v1/resolve": `{"env":{"X":"op://v/i/f"}}`,
+		}[path]
+		for _, asked := range []bool{false, true} {
+			a := &api{token: safestring.New("tok"), backend: backend.NewFake(backend.WithLatency("*", latency)), cache: cache.New(time.Minute)}
+			req := httptest.NewRequest("POST", path, strings.NewReader(body))
+			req.Header.Set("X-OpAuthd-Token", "tok")
+			if asked {
+				req.Header.Set(protocol.TimingHeader, "1")
+			}
+			w := httptest.NewRecorder()
+			a.handler().ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s: expected status 200, got %d: %s", path, w.Code, w.Body.String())
+			}
+
+			header := w.Header().Get(protocol.ServerTimingHeader)
+			if !asked {
+				if header != "" {
+					t.Errorf("%s: expected no Server-Timing header, got %q", path, header)
+				}
+				continue
+			}
+			st, ok := protocol.ParseServerTiming(header)
+			if !ok {
+				t.Fatalf("%s: expected a Server-Timing header, got %q", path, header)
+			}
+			if st.Backend < latency || st.Total < st.Backend {
+				t.Errorf("%s: expected backend >= %v and total >= backend, got %+v", path, latency, st)
+			}
+		}
+	}
+}
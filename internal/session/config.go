@@ -3,8 +3,10 @@ package session
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/zach-source/opx/internal/util"
@@ -21,6 +23,9 @@ type Config struct {
 	EnableSessionLock bool `json:"enable_session_lock"`
 	// LockOnAuthFailure locks the session when authentication failures occur
 	LockOnAuthFailure bool `json:"lock_on_auth_failure"`
+	// UseCountLimit locks the session once it has served this many reads since
+	// it was unlocked, so the next read must re-authenticate (0 = no limit)
+	UseCountLimit int `json:"use_count_limit,omitempty"`
 	// CheckInterval is how often to check for idle timeout (internal use)
 	CheckInterval time.Duration `json:"check_interval,omitempty"`
 }
@@ -61,18 +66,20 @@ func LoadConfig() (*Config, error) {
 
 // loadFromFile loads configuration from XDG config directory
 func (c *Config) loadFromFile() error {
-	configDir, err := util.ConfigDir()
+	path, err := configPath()
 	if err != nil {
 		return err
 	}
 
-	configPath := filepath.Join(configDir, "config.json")
-	data, err := os.ReadFile(configPath)
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return err
 	}
 
-	return json.Unmarshal(data, c)
+	if err := util.DecodeJSON(data, c); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
 }
 
 // loadFromEnv loads configuration from environment variables
@@ -90,6 +97,12 @@ func (c *Config) loadFromEnv() {
 	if lockOnFail := os.Getenv("OPX_LOCK_ON_AUTH_FAILURE"); lockOnFail != "" {
 		c.LockOnAuthFailure = lockOnFail == "true" || lockOnFail == "1"
 	}
+
+	if limit := os.Getenv("OPX_SESSION_USE_COUNT_LIMIT"); limit != "" {
+		if n, err := strconv.Atoi(limit); err == nil {
+			c.UseCountLimit = n
+		}
+	}
 }
 
 // validate ensures the configuration is valid
@@ -98,6 +111,10 @@ func (c *Config) validate() error {
 		return errors.New("session idle timeout cannot be negative")
 	}
 
+	if c.UseCountLimit < 0 {
+		return errors.New("session use count limit cannot be negative")
+	}
+
 	if c.EnableSessionLock && c.SessionIdleTimeout == 0 {
 		return errors.New("session idle timeout must be greater than 0 when session lock is enabled")
 	}
@@ -109,18 +126,52 @@ func (c *Config) validate() error {
 	return nil
 }
 
-// SaveConfig saves the configuration to XDG config directory
-func (c *Config) SaveConfig() error {
+// configPath returns the path of config.json in the XDG config directory
+func configPath() (string, error) {
 	configDir, err := util.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "config.json"), nil
+}
+
+// LoadFileConfig loads config.json over the defaults without environment overrides;
+// a missing file is an error wrapping os.ErrNotExist
+func LoadFileConfig() (*Config, error) {
+	config := DefaultConfig()
+	if err := config.loadFromFile(); err != nil {
+		return nil, fmt.Errorf("failed to load session config: %w", err)
+	}
+	return config, nil
+}
+
+// SaveConfig validates the configuration and saves it to the XDG config directory,
+// keeping the previous file as config.json.bak
+func (c *Config) SaveConfig() error {
+	path, err := configPath()
 	if err != nil {
 		return err
 	}
+	return c.saveTo(path)
+}
 
-	configPath := filepath.Join(configDir, "config.json")
+// saveTo writes the configuration to path atomically so a crash leaves either the old or the new file
+func (c *Config) saveTo(path string) error {
+	if err := c.validate(); err != nil {
+		return fmt.Errorf("invalid session config: %w", err)
+	}
 	data, err := json.MarshalIndent(c, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(configPath, data, 0o600)
+	prev, err := os.ReadFile(path)
+	if err == nil {
+		if err := util.WriteFileAtomic(path+".bak", prev, 0o600); err != nil {
+			return fmt.Errorf("failed to back up %s: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return util.WriteFileAtomic(path, data, 0o600)
 }
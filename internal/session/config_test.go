@@ -2,8 +2,10 @@ package session
 
 import (
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -47,6 +49,15 @@ func TestConfig_validate(t *testing.T) {
 			},
 			expectErr: true,
 		},
+		{
+			name: "negative use count limit",
+			config: &Config{
+				SessionIdleTimeout: 1 * time.Hour,
+				EnableSessionLock:  true,
+				UseCountLimit:      -1,
+			},
+			expectErr: true,
+		},
 		{
 			name: "session lock enabled but zero timeout",
 			config: &Config{
@@ -264,3 +275,110 @@ func setEnv(key, value string) {
 		os.Setenv(key, value)
 	}
 }
+
+func TestConfig_saveTo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	first := DefaultConfig()
+	if err := first.saveTo(path); err != nil {
+		t.Fatalf("saveTo failed: %v", err)
+	}
+	if _, err := os.Stat(path + ".bak"); !os.IsNotExist(err) {
+		t.Errorf("Expected no backup for a new file, got %v", err)
+	}
+	original, _ := os.ReadFile(path)
+
+	// An invalid config is rejected and leaves the saved one alone
+	invalid := DefaultConfig()
+	invalid.SessionIdleTimeout = 0
+	if err := invalid.saveTo(path); err == nil {
+		t.Fatal("Expected an error saving a zero timeout with session lock enabled")
+	}
+	if b, _ := os.ReadFile(path); string(b) != string(original) {
+		t.Errorf("Expected the saved config unchanged, got %s", b)
+	}
+
+	second := DefaultConfig()
+	second.SessionIdleTimeout = 4 * time.Hour
+	if err := second.saveTo(path); err != nil {
+		t.Fatalf("saveTo failed: %v", err)
+	}
+	var loaded Config
+	b, _ := os.ReadFile(path)
+	if err := json.Unmarshal(b, &loaded); err != nil || loaded.SessionIdleTimeout != 4*time.Hour {
+		t.Errorf("Expected the new timeout saved, got %s (%v)", b, err)
+	}
+	if b, _ := os.ReadFile(path + ".bak"); string(b) != string(original) {
+		t.Errorf("Expected the previous config in the backup, got %s", b)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Errorf("Expected a 0600 config file, got %v (%v)", fi, err)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 2 {
+		t.Errorf("Expected only config.json and its backup, got %d files", len(entries))
+	}
+}
+
+func TestLoadFileConfig(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("OPX_SESSION_IDLE_TIMEOUT", "1h")
+
+	if _, err := LoadFileConfig(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected ErrNotExist without a config file, got %v", err)
+	}
+
+	config := DefaultConfig()
+	config.SessionIdleTimeout = 4 * time.Hour
+	if err := config.SaveConfig(); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+	loaded, err := LoadFileConfig()
+	if err != nil {
+		t.Fatalf("LoadFileConfig failed: %v", err)
+	}
+	if loaded.SessionIdleTimeout != 4*time.Hour {
+		t.Errorf("Expected the file's timeout without env overrides, got %v", loaded.SessionIdleTimeout)
+	}
+}
+
+func TestLoadFileConfig_BOMAndTrailingContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{name: "bom", data: "\xEF\xBB\xBF{\"session_idle_timeout\":3600000000000,\"enable_session_lock\":true}\n"},
+		{name: "trailing garbage", data: "{\"enable_session_lock\":true}\nxyz", wantErr: "line 2, column 1: unexpected content after the JSON value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+			path, err := configPath()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(tt.data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			config, err := LoadFileConfig()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if config.SessionIdleTimeout != time.Hour {
+					t.Errorf("Expected timeout 1h, got %v", config.SessionIdleTimeout)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -3,9 +3,12 @@ package session
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"sync"
 	"time"
+
+	"github.com/zach-source/opx/internal/util"
 )
 
 // LockCallback is called when the session needs to be locked
@@ -26,6 +29,24 @@ type Manager struct {
 	stopCh         chan struct{}
 	doneCh         chan struct{}
 	verbose        bool
+	// account is who the CLI is signed in as; lockReason why it was locked by
+	// the use count limit or last failed to unlock
+	account      Account
+	lockReason   string
+	redactEmails bool
+	// useCount is how many reads the session has served since it was unlocked
+	useCount int
+	// clock measures idleness; tests swap in a util.ManualClock
+	clock util.Clock
+
+	// Transitions: seq counts state changes, changed is closed and replaced on
+	// each one, and pending holds changes not yet delivered to observers
+	seq       uint64
+	changed   chan struct{}
+	pending   []Transition
+	notifyMu  sync.Mutex // serializes delivery so observers see transitions in order
+	observers map[int]func(Transition)
+	nextObs   int
 }
 
 // NewManager creates a new session manager with the given configuration
@@ -40,6 +61,79 @@ func NewManager(config *Config) *Manager {
 		lastActivity: time.Now(),
 		stopCh:       make(chan struct{}),
 		doneCh:       make(chan struct{}),
+		changed:      make(chan struct{}),
+		observers:    make(map[int]func(Transition)),
+		clock:        util.RealClock{},
+	}
+}
+
+// SetClock replaces the time source used for activity and idle timeout, restarting
+// the idle period from the new clock's current time
+func (m *Manager) SetClock(clock util.Clock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clock = clock
+	m.lastActivity = clock.Now()
+}
+
+// Subscribe calls fn once for every later state transition, in order, until the
+// returned func is called. fn runs without the manager's lock held but must not
+// change the session state itself.
+func (m *Manager) Subscribe(fn func(Transition)) (unsubscribe func()) {
+	m.notifyMu.Lock()
+	defer m.notifyMu.Unlock()
+	id := m.nextObs
+	m.nextObs++
+	m.observers[id] = fn
+	return func() {
+		m.notifyMu.Lock()
+		defer m.notifyMu.Unlock()
+		delete(m.observers, id)
+	}
+}
+
+// WaitForChange returns the current session information once its Seq differs
+// from since, or when ctx is done, whichever comes first
+func (m *Manager) WaitForChange(ctx context.Context, since uint64) SessionInfo {
+	m.mu.RLock()
+	seq, changed := m.seq, m.changed
+	m.mu.RUnlock()
+	if seq == since {
+		select {
+		case <-changed:
+		case <-ctx.Done():
+		}
+	}
+	return m.GetInfo()
+}
+
+// setState moves to state, recording a transition if it differs; callers hold mu
+// and call notify after releasing it
+func (m *Manager) setState(state SessionState) {
+	if state == m.state {
+		return
+	}
+	m.seq++
+	m.pending = append(m.pending, Transition{Seq: m.seq, From: m.state, To: state, At: m.clock.Now()})
+	m.state = state
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+// notify delivers pending transitions to observers in sequence order
+func (m *Manager) notify() {
+	m.notifyMu.Lock()
+	defer m.notifyMu.Unlock()
+
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = nil
+	m.mu.Unlock()
+
+	for _, t := range pending {
+		for _, fn := range m.observers {
+			fn(t)
+		}
 	}
 }
 
@@ -58,6 +152,48 @@ func (m *Manager) SetVerbose(verbose bool) {
 	m.verbose = verbose
 }
 
+// SetRedactEmails hides the local part of account emails in GetInfo and log lines
+func (m *Manager) SetRedactEmails(on bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.redactEmails = on
+}
+
+// SetIdleTimeout changes the idle timeout of a running manager; time already idle counts toward it
+func (m *Manager) SetIdleTimeout(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.config.SessionIdleTimeout = d
+	if m.verbose {
+		log.Printf("[session] idle timeout set to %s", d)
+	}
+}
+
+// SetAccount records the account the CLI session is signed in as
+func (m *Manager) SetAccount(account Account) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.account = account
+	if m.verbose {
+		log.Printf("[session] signed in as %s", m.visibleAccount())
+	}
+}
+
+// visibleAccount is the account as shown outside the daemon; callers hold mu
+func (m *Manager) visibleAccount() Account {
+	if m.redactEmails {
+		return m.account.Redacted()
+	}
+	return m.account
+}
+
+// setLockReason records why the session could not be unlocked
+func (m *Manager) setLockReason(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lockReason = err.Error()
+}
+
 // Start begins the session manager's background monitoring
 func (m *Manager) Start(ctx context.Context) {
 	if !m.config.EnableSessionLock {
@@ -85,6 +221,9 @@ func (m *Manager) GetInfo() SessionInfo {
 		LastActivity: m.lastActivity,
 		IdleTimeout:  m.config.SessionIdleTimeout,
 		LockedAt:     m.lockedAt,
+		Seq:          m.seq,
+		Account:      m.visibleAccount(),
+		LockReason:   m.lockReason,
 	}
 }
 
@@ -94,13 +233,29 @@ func (m *Manager) UpdateActivity() {
 	defer m.mu.Unlock()
 
 	if m.state == SessionAuthenticated {
-		m.lastActivity = time.Now()
+		m.lastActivity = m.clock.Now()
 		if m.verbose {
 			log.Printf("[session] activity updated")
 		}
 	}
 }
 
+// Touch records activity for an authenticated session and reports whether it did.
+// Unlike ValidateSession it never unlocks or initializes a session.
+func (m *Manager) Touch() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.state != SessionAuthenticated {
+		return false
+	}
+	m.lastActivity = m.clock.Now()
+	if m.verbose {
+		log.Printf("[session] touched by keep-alive")
+	}
+	return true
+}
+
 // ValidateSession checks if the session is in a valid state for operations
 func (m *Manager) ValidateSession(ctx context.Context) error {
 	m.mu.RLock()
@@ -129,12 +284,13 @@ func (m *Manager) ValidateSession(ctx context.Context) error {
 
 // MarkLocked manually locks the session (e.g., on auth failure)
 func (m *Manager) MarkLocked() {
+	defer m.notify()
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if m.state != SessionLocked {
-		m.state = SessionLocked
-		m.lockedAt = time.Now()
+		m.setState(SessionLocked)
+		m.lockedAt = m.clock.Now()
 		if m.verbose {
 			log.Printf("[session] marked as locked")
 		}
@@ -142,14 +298,41 @@ func (m *Manager) MarkLocked() {
 	}
 }
 
-// MarkAuthenticated marks the session as authenticated
+// CountReads adds n reads served by an authenticated session and locks it,
+// running the lock callback, once they reach the configured use count limit
+func (m *Manager) CountReads(n int) {
+	defer m.notify()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	limit := m.config.UseCountLimit
+	if limit <= 0 || m.state != SessionAuthenticated {
+		return
+	}
+	m.useCount += n
+	if m.useCount < limit {
+		return
+	}
+	if m.verbose {
+		log.Printf("[session] use count limit of %d reads reached, locking session", limit)
+	}
+	m.setState(SessionLocked)
+	m.lockedAt = m.clock.Now()
+	m.lockReason = fmt.Sprintf("use count limit of %d reads reached", limit)
+	m.executeLockCallback()
+}
+
+// MarkAuthenticated marks the session as authenticated, starting a new use count
 func (m *Manager) MarkAuthenticated() {
+	defer m.notify()
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.state = SessionAuthenticated
-	m.lastActivity = time.Now()
+	m.setState(SessionAuthenticated)
+	m.lastActivity = m.clock.Now()
 	m.lockedAt = time.Time{} // Clear lock time
+	m.lockReason = ""
+	m.useCount = 0
 	if m.verbose {
 		log.Printf("[session] marked as authenticated")
 	}
@@ -176,6 +359,7 @@ func (m *Manager) monitor(ctx context.Context) {
 
 // checkIdleTimeout checks if the session should be locked due to idle timeout
 func (m *Manager) checkIdleTimeout() {
+	defer m.notify()
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -185,12 +369,12 @@ func (m *Manager) checkIdleTimeout() {
 	}
 
 	// Check if idle timeout has been exceeded
-	if m.config.SessionIdleTimeout > 0 && time.Since(m.lastActivity) > m.config.SessionIdleTimeout {
+	if m.config.SessionIdleTimeout > 0 && m.clock.Now().Sub(m.lastActivity) > m.config.SessionIdleTimeout {
 		if m.verbose {
 			log.Printf("[session] idle timeout exceeded, locking session")
 		}
-		m.state = SessionLocked
-		m.lockedAt = time.Now()
+		m.setState(SessionLocked)
+		m.lockedAt = m.clock.Now()
 		m.executeLockCallback()
 	}
 }
@@ -222,6 +406,7 @@ func (m *Manager) attemptUnlock(ctx context.Context) error {
 		if m.verbose {
 			log.Printf("[session] unlock failed: %v", err)
 		}
+		m.setLockReason(err)
 		return err
 	}
 
@@ -238,9 +423,10 @@ func (m *Manager) determineInitialState(ctx context.Context) error {
 	if m.unlockCallback == nil {
 		// No way to determine state, assume locked
 		m.mu.Lock()
-		m.state = SessionLocked
-		m.lockedAt = time.Now()
+		m.setState(SessionLocked)
+		m.lockedAt = m.clock.Now()
 		m.mu.Unlock()
+		m.notify()
 		return errors.New("session state unknown and no unlock callback configured")
 	}
 
@@ -248,9 +434,11 @@ func (m *Manager) determineInitialState(ctx context.Context) error {
 	if err := m.unlockCallback(ctx); err != nil {
 		// Validation failed, session is locked/expired
 		m.mu.Lock()
-		m.state = SessionLocked
-		m.lockedAt = time.Now()
+		m.setState(SessionLocked)
+		m.lockedAt = m.clock.Now()
+		m.lockReason = err.Error()
 		m.mu.Unlock()
+		m.notify()
 		return err
 	}
 
@@ -6,6 +6,8 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/zach-source/opx/internal/util"
 )
 
 func TestNewManager(t *testing.T) {
@@ -48,8 +50,10 @@ func TestManager_UpdateActivity(t *testing.T) {
 	}
 
 	// Mark as authenticated and update activity
+	clock := util.NewManualClock(initialTime)
+	manager.SetClock(clock)
 	manager.MarkAuthenticated()
-	time.Sleep(10 * time.Millisecond) // Ensure different timestamp
+	clock.Advance(time.Second)
 	manager.UpdateActivity()
 
 	if manager.lastActivity.Equal(initialTime) {
@@ -81,6 +85,57 @@ func TestManager_MarkLocked(t *testing.T) {
 	}
 }
 
+func TestManager_CountReads(t *testing.T) {
+	config := DefaultConfig()
+	config.UseCountLimit = 3
+	manager := NewManager(config)
+	locks := 0
+	manager.SetCallbacks(func() error {
+		locks++
+		return nil
+	}, nil)
+	manager.MarkAuthenticated()
+
+	manager.CountReads(1)
+	manager.CountReads(1)
+	if manager.state != SessionAuthenticated || locks != 0 {
+		t.Fatalf("Expected the session to stay authenticated below the limit, got %v with %d locks", manager.state, locks)
+	}
+	manager.CountReads(1)
+	if manager.state != SessionLocked || locks != 1 {
+		t.Fatalf("Expected the third read to lock the session once, got %v with %d locks", manager.state, locks)
+	}
+	if info := manager.GetInfo(); info.LockReason != "use count limit of 3 reads reached" || info.LockedAt.IsZero() {
+		t.Errorf("Expected the lock reason and time to be set, got %+v", info)
+	}
+
+	// Reads against a locked session don't lock it again
+	manager.CountReads(1)
+	if locks != 1 {
+		t.Errorf("Expected no further lock callbacks, got %d", locks)
+	}
+
+	// Unlocking starts a new count
+	manager.MarkAuthenticated()
+	manager.CountReads(2)
+	if manager.state != SessionAuthenticated {
+		t.Errorf("Expected the count to reset on unlock, got %v", manager.state)
+	}
+	manager.CountReads(2)
+	if manager.state != SessionLocked || locks != 2 {
+		t.Errorf("Expected a batch crossing the limit to lock, got %v with %d locks", manager.state, locks)
+	}
+}
+
+func TestManager_CountReadsWithoutLimit(t *testing.T) {
+	manager := NewManager(DefaultConfig())
+	manager.MarkAuthenticated()
+	manager.CountReads(1000)
+	if manager.state != SessionAuthenticated {
+		t.Errorf("Expected no limit by default, got %v", manager.state)
+	}
+}
+
 func TestManager_MarkAuthenticated(t *testing.T) {
 	manager := NewManager(DefaultConfig())
 	manager.MarkLocked() // Start in locked state
@@ -236,6 +291,39 @@ func TestManager_IdleTimeout(t *testing.T) {
 	}
 }
 
+func TestManager_IdleTimeoutWithClock(t *testing.T) {
+	clock := util.NewManualClock(time.Now())
+	manager := NewManager(&Config{SessionIdleTimeout: 15 * time.Minute, EnableSessionLock: true})
+	manager.SetClock(clock)
+	locks := 0
+	manager.SetCallbacks(func() error {
+		locks++
+		return nil
+	}, nil)
+	manager.MarkAuthenticated()
+
+	clock.Advance(10 * time.Minute)
+	manager.UpdateActivity()
+	clock.Advance(15 * time.Minute)
+	manager.checkIdleTimeout()
+	if state := manager.GetInfo().State; state != SessionAuthenticated {
+		t.Fatalf("Expected session to stay authenticated at exactly the timeout, got %v", state)
+	}
+
+	clock.Advance(time.Second)
+	manager.checkIdleTimeout()
+	info := manager.GetInfo()
+	if info.State != SessionLocked {
+		t.Fatalf("Expected session to be locked after the idle timeout, got %v", info.State)
+	}
+	if !info.LockedAt.Equal(clock.Now()) {
+		t.Errorf("Expected locked at %v, got %v", clock.Now(), info.LockedAt)
+	}
+	if locks != 1 {
+		t.Errorf("Expected lock callback once, got %d", locks)
+	}
+}
+
 func TestManager_ConcurrentAccess(t *testing.T) {
 	manager := NewManager(DefaultConfig())
 	manager.MarkAuthenticated()
@@ -301,3 +389,118 @@ func TestManager_DisabledSessionLock(t *testing.T) {
 		t.Errorf("Expected state to remain Unknown when session lock disabled, got %v", info.State)
 	}
 }
+
+func TestManager_Touch(t *testing.T) {
+	manager := NewManager(&Config{SessionIdleTimeout: time.Hour, EnableSessionLock: true})
+
+	if manager.Touch() {
+		t.Error("Expected Touch to refuse an unknown session")
+	}
+
+	clock := util.NewManualClock(time.Now())
+	manager.SetClock(clock)
+	manager.MarkAuthenticated()
+	before := manager.GetInfo().LastActivity
+	clock.Advance(time.Second)
+	if !manager.Touch() {
+		t.Fatal("Expected Touch to succeed on authenticated session")
+	}
+	if !manager.GetInfo().LastActivity.After(before) {
+		t.Error("Expected Touch to update last activity")
+	}
+
+	manager.MarkLocked()
+	if manager.Touch() {
+		t.Error("Expected Touch to refuse a locked session")
+	}
+	if manager.GetInfo().State != SessionLocked {
+		t.Error("Expected session to remain locked after Touch")
+	}
+}
+
+func TestManager_SubscribeSeesEveryTransitionInOrder(t *testing.T) {
+	config := &Config{SessionIdleTimeout: 20 * time.Millisecond, EnableSessionLock: true, CheckInterval: 5 * time.Millisecond}
+	manager := NewManager(config)
+
+	var mu sync.Mutex
+	var seen []Transition
+	unsubscribe := manager.Subscribe(func(tr Transition) {
+		mu.Lock()
+		seen = append(seen, tr)
+		mu.Unlock()
+	})
+
+	manager.MarkAuthenticated()
+	manager.MarkAuthenticated() // no change, no transition
+	manager.MarkLocked()
+	manager.MarkLocked()
+	manager.MarkAuthenticated()
+
+	// The idle timeout locks the session from the monitor goroutine
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager.Start(ctx)
+	defer manager.Stop()
+	deadline := time.Now().Add(2 * time.Second)
+	for manager.GetInfo().State != SessionLocked && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	unsubscribe()
+	manager.MarkAuthenticated() // not observed after unsubscribing
+
+	expected := []struct{ from, to SessionState }{
+		{SessionUnknown, SessionAuthenticated},
+		{SessionAuthenticated, SessionLocked},
+		{SessionLocked, SessionAuthenticated},
+		{SessionAuthenticated, SessionLocked},
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seen) != len(expected) {
+		t.Fatalf("Expected %d transitions, got %+v", len(expected), seen)
+	}
+	for i, e := range expected {
+		if seen[i].Seq != uint64(i+1) || seen[i].From != e.from || seen[i].To != e.to {
+			t.Errorf("Transition %d: expected #%d %s->%s, got #%d %s->%s", i, i+1, e.from, e.to, seen[i].Seq, seen[i].From, seen[i].To)
+		}
+	}
+	if info := manager.GetInfo(); info.Seq != 5 {
+		t.Errorf("Expected seq 5, got %d", info.Seq)
+	}
+}
+
+func TestManager_WaitForChange(t *testing.T) {
+	manager := NewManager(DefaultConfig())
+	manager.MarkAuthenticated()
+
+	// A stale sequence returns immediately
+	if info := manager.WaitForChange(context.Background(), 0); info.Seq != 1 || info.State != SessionAuthenticated {
+		t.Errorf("Expected seq 1 authenticated, got %d %s", info.Seq, info.State)
+	}
+
+	// The current sequence blocks until the next transition
+	done := make(chan SessionInfo, 1)
+	go func() { done <- manager.WaitForChange(context.Background(), 1) }()
+	select {
+	case info := <-done:
+		t.Fatalf("Expected to block, got %+v", info)
+	case <-time.After(20 * time.Millisecond):
+	}
+	manager.MarkLocked()
+	select {
+	case info := <-done:
+		if info.Seq != 2 || info.State != SessionLocked {
+			t.Errorf("Expected seq 2 locked, got %d %s", info.Seq, info.State)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected WaitForChange to return after the transition")
+	}
+
+	// Without a change it returns the unchanged state when ctx ends
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if info := manager.WaitForChange(ctx, 2); info.Seq != 2 {
+		t.Errorf("Expected unchanged seq 2 on timeout, got %d", info.Seq)
+	}
+}
@@ -1,6 +1,9 @@
 package session
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 // SessionState represents the current state of the 1Password CLI session
 type SessionState int
@@ -48,6 +51,49 @@ type SessionInfo struct {
 	LastActivity time.Time     `json:"last_activity,omitempty"`
 	IdleTimeout  time.Duration `json:"idle_timeout"`
 	LockedAt     time.Time     `json:"locked_at,omitempty"`
+	// Seq counts state transitions since the manager was created
+	Seq uint64 `json:"seq"`
+	// Account is who the CLI session is signed in as, if known
+	Account Account `json:"account,omitzero"`
+	// LockReason says why the last unlock or validation failed
+	LockReason string `json:"lock_reason,omitempty"`
+}
+
+// Account is the 1Password account a CLI session is signed in to
+type Account struct {
+	UUID  string `json:"uuid,omitempty"`
+	Email string `json:"email,omitempty"`
+	URL   string `json:"url,omitempty"`
+}
+
+// String names the account by email, else UUID, with its sign-in URL
+func (a Account) String() string {
+	name := a.Email
+	if name == "" {
+		name = a.UUID
+	}
+	if a.URL != "" {
+		return name + " (" + a.URL + ")"
+	}
+	return name
+}
+
+// Redacted returns a with the email's local part reduced to its first character
+func (a Account) Redacted() Account {
+	if local, domain, ok := strings.Cut(a.Email, "@"); ok && local != "" {
+		a.Email = local[:1] + "***@" + domain
+	} else if a.Email != "" {
+		a.Email = "***"
+	}
+	return a
+}
+
+// Transition is one change of session state; Seq increases by one per transition
+type Transition struct {
+	Seq  uint64
+	From SessionState
+	To   SessionState
+	At   time.Time
 }
 
 // TimeUntilLock returns the duration until the session will be locked
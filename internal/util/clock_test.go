@@ -0,0 +1,18 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManualClock(t *testing.T) {
+	start := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	c := NewManualClock(start)
+	if !c.Now().Equal(start) {
+		t.Errorf("Expected %v, got %v", start, c.Now())
+	}
+	c.Advance(90 * time.Second)
+	if expected := start.Add(90 * time.Second); !c.Now().Equal(expected) {
+		t.Errorf("Expected %v, got %v", expected, c.Now())
+	}
+}
@@ -0,0 +1,49 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidEnvName reports whether name is usable as an environment variable name
+func ValidEnvName(name string) bool {
+	return envNamePattern.MatchString(name)
+}
+
+// QuoteDotenvValue double-quotes a value, escaping $ and backtick so shell-style loaders don't expand them
+func QuoteDotenvValue(v string) string {
+	r := strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		"$", `\$`,
+		"`", "\\`",
+		"\n", `\n`,
+		"\r", `\r`,
+	)
+	return `"` + r.Replace(v) + `"`
+}
+
+// FormatDotenv renders env as a dotenv file with one quoted NAME="value" per line, sorted by name
+func FormatDotenv(env map[string]string) (string, error) {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		if !ValidEnvName(name) {
+			return "", fmt.Errorf("invalid variable name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(QuoteDotenvValue(env[name]))
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
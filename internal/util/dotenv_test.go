@@ -0,0 +1,88 @@
+package util
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestQuoteDotenvValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{"plain", "secret", `"secret"`},
+		{"empty", "", `""`},
+		{"spaces", "hello world", `"hello world"`},
+		{"double quote", `pa"ss`, `"pa\"ss"`},
+		{"backslash", `a\b`, `"a\\b"`},
+		{"newline", "line1\nline2", `"line1\nline2"`},
+		{"carriage return", "a\r\nb", `"a\r\nb"`},
+		{"single quote and dollar", `it's $HOME`, `"it's \$HOME"`},
+		{"braced variable", "${USER}x", `"\${USER}x"`},
+		{"backtick", "a`id`b", "\"a\\`id\\`b\""},
+		{"hash", "abc#def", `"abc#def"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := QuoteDotenvValue(tt.value); got != tt.expected {
+				t.Errorf("QuoteDotenvValue(%q) = %s, expected %s", tt.value, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFormatDotenv(t *testing.T) {
+	out, err := FormatDotenv(map[string]string{
+		"B_VAR": "two",
+		"A_VAR": "one\nline",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "A_VAR=\"one\\nline\"\nB_VAR=\"two\"\n"
+	if out != expected {
+		t.Errorf("Expected %q, got %q", expected, out)
+	}
+}
+
+func TestFormatDotenv_InvalidName(t *testing.T) {
+	for _, name := range []string{"", "1ABC", "A-B", "A B", "A=B"} {
+		if _, err := FormatDotenv(map[string]string{name: "v"}); err == nil {
+			t.Errorf("Expected error for invalid name %q", name)
+		}
+	}
+}
+
+func TestFormatDotenv_ShellRoundTrip(t *testing.T) {
+	values := []string{
+		`it's $HOME`,
+		"${USER}-${PATH:-x}",
+		"a`id`b $(id)",
+		`back\slash "quoted"`,
+		"tab\there",
+	}
+
+	for _, value := range values {
+		out, err := FormatDotenv(map[string]string{"SECRET": value})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		path := filepath.Join(t.TempDir(), "env")
+		if err := os.WriteFile(path, []byte(out), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := exec.Command("sh", "-c", `. "$0" && printf '%s' "$SECRET"`, path).Output()
+		if err != nil {
+			t.Fatalf("Sourcing %q failed: %v", out, err)
+		}
+		if string(got) != value {
+			t.Errorf("Expected %q to survive sourcing, got %q", value, got)
+		}
+	}
+}
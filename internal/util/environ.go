@@ -0,0 +1,57 @@
+package util
+
+import "strings"
+
+// BaseEnvPassthrough is what any subprocess opx starts keeps from its parent's
+// environment: home, search path, user, temp dir, time zone, locale and XDG dirs
+var BaseEnvPassthrough = []string{"HOME", "PATH", "USER", "LOGNAME", "TMPDIR", "TZ", "LANG", "LANGUAGE", "LC_*", "XDG_*"}
+
+// OpEnvPassthrough is BaseEnvPassthrough plus the OP_* settings the 1Password
+// CLI reads. OP_SESSION_* tokens are deliberately not on it.
+var OpEnvPassthrough = append(append([]string(nil), BaseEnvPassthrough...),
+	"OP_ACCOUNT", "OP_BIOMETRIC_UNLOCK_ENABLED", "OP_CACHE", "OP_CONFIG_DIR",
+	"OP_CONNECT_HOST", "OP_CONNECT_TOKEN", "OP_SERVICE_ACCOUNT_TOKEN")
+
+// ValidEnvPattern reports whether p is a variable name, a name prefix followed by *, or * alone
+func ValidEnvPattern(p string) bool {
+	if p == "*" {
+		return true
+	}
+	return ValidEnvName(strings.TrimSuffix(p, "*"))
+}
+
+// EnvPassesAll reports whether patterns contain *, which keeps the whole environment
+func EnvPassesAll(patterns []string) bool {
+	for _, p := range patterns {
+		if p == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// EnvAllowed reports whether name matches one of patterns
+func EnvAllowed(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == p {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterEnv keeps the NAME=value entries of environ whose names patterns allow
+func FilterEnv(environ, patterns []string) []string {
+	out := make([]string, 0, len(environ))
+	for _, kv := range environ {
+		name, _, _ := strings.Cut(kv, "=")
+		if EnvAllowed(name, patterns) {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
@@ -0,0 +1,37 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilterEnv(t *testing.T) {
+	environ := []string{"HOME=/home/me", "PATH=/bin", "LC_ALL=C", "AWS_SECRET_ACCESS_KEY=x", "OP_SESSION_acme=tok", "OPX_SOCKET=/s", "EMPTY="}
+	tests := []struct {
+		name     string
+		patterns []string
+		expected []string
+	}{
+		{name: "exact names", patterns: []string{"HOME", "PATH"}, expected: []string{"HOME=/home/me", "PATH=/bin"}},
+		{name: "prefix", patterns: []string{"LC_*", "OPX_*"}, expected: []string{"LC_ALL=C", "OPX_SOCKET=/s"}},
+		{name: "prefix does not match a longer name", patterns: []string{"OP_*"}, expected: []string{"OP_SESSION_acme=tok"}},
+		{name: "empty value kept", patterns: []string{"EMPTY"}, expected: []string{"EMPTY="}},
+		{name: "nothing allowed", patterns: nil, expected: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FilterEnv(environ, tt.patterns); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestValidEnvPattern(t *testing.T) {
+	for p, expected := range map[string]bool{"*": true, "HOME": true, "OP_SESSION_*": true, "": false, "A*B": false, "**": false, "1X": false} {
+		if got := ValidEnvPattern(p); got != expected {
+			t.Errorf("ValidEnvPattern(%q): expected %v, got %v", p, expected, got)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrUnresolvedVar is returned when a ref names a variable the environment map doesn't set
+var ErrUnresolvedVar = errors.New("unresolved variable")
+
+// ExpandRefVars replaces ${VAR} and $VAR in ref with values from vars, in a
+// single pass. Only vars is consulted, never the process environment. A $ not
+// followed by a variable name is kept as is.
+func ExpandRefVars(ref string, vars map[string]string) (string, error) {
+	if !strings.Contains(ref, "$") {
+		return ref, nil
+	}
+	var b strings.Builder
+	missing := map[string]bool{}
+	for i := 0; i < len(ref); i++ {
+		if ref[i] != '$' || i+1 == len(ref) {
+			b.WriteByte(ref[i])
+			continue
+		}
+		var name string
+		if ref[i+1] == '{' {
+			end := strings.IndexByte(ref[i+2:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated ${ in %q", ref)
+			}
+			name = ref[i+2 : i+2+end]
+			if !ValidEnvName(name) {
+				return "", fmt.Errorf("invalid variable name %q in %q", name, ref)
+			}
+			i += 2 + end
+		} else {
+			j := i + 1
+			for j < len(ref) && (ref[j] == '_' || isAlnum(ref[j])) {
+				j++
+			}
+			name = ref[i+1 : j]
+			if !ValidEnvName(name) {
+				b.WriteByte('$')
+				continue
+			}
+			i = j - 1
+		}
+		v, ok := vars[name]
+		if !ok {
+			missing[name] = true
+			continue
+		}
+		b.WriteString(v)
+	}
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("%w %s in %q", ErrUnresolvedVar, strings.Join(names, ", "), ref)
+	}
+	return b.String(), nil
+}
+
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
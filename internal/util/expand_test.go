@@ -0,0 +1,60 @@
+package util
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExpandRefVars(t *testing.T) {
+	vars := map[string]string{"APP_NAME": "billing", "ENV": "prod", "EMPTY": "", "NESTED": "${ENV}"}
+
+	tests := []struct {
+		name        string
+		ref         string
+		expected    string
+		wantErrText string
+	}{
+		{name: "no variables", ref: "op://vault/item/password", expected: "op://vault/item/password"},
+		{name: "braced", ref: "op://vault/${APP_NAME}/password", expected: "op://vault/billing/password"},
+		{name: "bare", ref: "op://vault/$APP_NAME/password", expected: "op://vault/billing/password"},
+		{name: "several", ref: "op://${ENV}/${APP_NAME}-db/password", expected: "op://prod/billing-db/password"},
+		{name: "empty value", ref: "op://vault/app${EMPTY}/password", expected: "op://vault/app/password"},
+		{name: "lone dollar kept", ref: "op://vault/price$/field", expected: "op://vault/price$/field"},
+		{name: "dollar before non-name", ref: "op://vault/$1/field", expected: "op://vault/$1/field"},
+		{name: "values are not re-expanded", ref: "op://vault/${NESTED}/x", expected: "op://vault/${ENV}/x"},
+		{name: "missing", ref: "op://vault/${NOPE}/password", wantErrText: `unresolved variable NOPE in "op://vault/${NOPE}/password"`},
+		{name: "all missing listed", ref: "op://$ZED/${AAA}/f", wantErrText: "unresolved variable AAA, ZED"},
+		{name: "unterminated", ref: "op://vault/${APP_NAME/f", wantErrText: "unterminated ${"},
+		{name: "invalid name", ref: "op://vault/${APP-NAME}/f", wantErrText: `invalid variable name "APP-NAME"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandRefVars(tt.ref, vars)
+			if tt.wantErrText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrText) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantErrText, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	if _, err := ExpandRefVars("op://v/${X}/f", nil); !errors.Is(err, ErrUnresolvedVar) {
+		t.Errorf("Expected ErrUnresolvedVar, got %v", err)
+	}
+}
+
+func TestExpandRefVars_IgnoresProcessEnvironment(t *testing.T) {
+	t.Setenv("OPX_EXPAND_TEST", "leaked")
+	if _, err := ExpandRefVars("op://v/${OPX_EXPAND_TEST}/f", map[string]string{}); !errors.Is(err, ErrUnresolvedVar) {
+		t.Errorf("Expected the process environment to be ignored, got %v", err)
+	}
+}
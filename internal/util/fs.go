@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 )
@@ -17,17 +18,34 @@ func HomeDir() string {
 	return h
 }
 
-// DataDir returns the XDG-compliant data directory for op-authd
-func DataDir() (string, error) {
-	var dir string
+// LegacyDir returns the pre-XDG ~/.op-authd directory (which may not exist)
+func LegacyDir() string {
+	return filepath.Join(HomeDir(), ".op-authd")
+}
 
+// xdgDataPath returns the XDG data directory path without creating it
+func xdgDataPath() string {
 	// Check XDG_DATA_HOME first
 	if xdgDataHome := os.Getenv("XDG_DATA_HOME"); xdgDataHome != "" {
-		dir = filepath.Join(xdgDataHome, "op-authd")
-	} else {
-		// Fallback to ~/.local/share/op-authd
-		dir = filepath.Join(HomeDir(), ".local", "share", "op-authd")
+		return filepath.Join(xdgDataHome, "op-authd")
+	}
+	// Fallback to ~/.local/share/op-authd
+	return filepath.Join(HomeDir(), ".local", "share", "op-authd")
+}
+
+// xdgConfigPath returns the XDG config directory path without creating it
+func xdgConfigPath() string {
+	// Check XDG_CONFIG_HOME first
+	if xdgConfigHome := os.Getenv("XDG_CONFIG_HOME"); xdgConfigHome != "" {
+		return filepath.Join(xdgConfigHome, "op-authd")
 	}
+	// Fallback to ~/.config/op-authd
+	return filepath.Join(HomeDir(), ".config", "op-authd")
+}
+
+// DataDir returns the XDG-compliant data directory for op-authd
+func DataDir() (string, error) {
+	dir := xdgDataPath()
 
 	if err := os.MkdirAll(dir, 0o700); err != nil {
 		return "", fmt.Errorf("mkdir %s: %w", dir, err)
@@ -40,15 +58,7 @@ func DataDir() (string, error) {
 
 // ConfigDir returns the XDG-compliant config directory for op-authd
 func ConfigDir() (string, error) {
-	var dir string
-
-	// Check XDG_CONFIG_HOME first
-	if xdgConfigHome := os.Getenv("XDG_CONFIG_HOME"); xdgConfigHome != "" {
-		dir = filepath.Join(xdgConfigHome, "op-authd")
-	} else {
-		// Fallback to ~/.config/op-authd
-		dir = filepath.Join(HomeDir(), ".config", "op-authd")
-	}
+	dir := xdgConfigPath()
 
 	if err := os.MkdirAll(dir, 0o700); err != nil {
 		return "", fmt.Errorf("mkdir %s: %w", dir, err)
@@ -62,7 +72,7 @@ func ConfigDir() (string, error) {
 // RuntimeDir returns the XDG-compliant runtime directory for op-authd
 func RuntimeDir() (string, error) {
 	// For backward compatibility, check if old ~/.op-authd directory exists
-	oldDir := filepath.Join(HomeDir(), ".op-authd")
+	oldDir := LegacyDir()
 	if _, err := os.Stat(oldDir); err == nil {
 		// Old directory exists, use it for runtime files too
 		if err := os.Chmod(oldDir, 0o700); err != nil {
@@ -93,7 +103,7 @@ func RuntimeDir() (string, error) {
 // StateDir maintains backward compatibility (now an alias for DataDir)
 func StateDir() (string, error) {
 	// For backward compatibility, check if old ~/.op-authd directory exists
-	oldDir := filepath.Join(HomeDir(), ".op-authd")
+	oldDir := LegacyDir()
 	if _, err := os.Stat(oldDir); err == nil {
 		// Old directory exists, continue using it for backward compatibility
 		if err := os.Chmod(oldDir, 0o700); err != nil {
@@ -106,36 +116,94 @@ func StateDir() (string, error) {
 	return DataDir()
 }
 
-func SocketPath() (string, error) {
+func TokenPath() (string, error) {
 	dir, err := StateDir()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(dir, "socket.sock"), nil
+	return filepath.Join(dir, "token"), nil
 }
 
-func TokenPath() (string, error) {
-	dir, err := StateDir()
+// AuditKeyPath is the secret that keys the tamper-evident audit log MAC chain
+func AuditKeyPath() (string, error) {
+	dir, err := DataDir()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(dir, "token"), nil
+	return filepath.Join(dir, "audit.key"), nil
+}
+
+// RecentRefsPath holds the refs clients recently read, never their values, for completion
+func RecentRefsPath() (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "recent-refs.json"), nil
+}
+
+// ApprovalsPath holds approvals for require_approval policy rules across daemon restarts
+func ApprovalsPath() (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "approvals.json"), nil
 }
 
+// tokenBytes is the random length of a token, which is stored hex encoded
+const tokenBytes = 32
+
+// checkToken rejects token file contents EnsureToken could not have written,
+// such as a file left empty or truncated by a crash mid-write
+func checkToken(tok string) error {
+	if tok == "" {
+		return errors.New("file is empty")
+	}
+	if len(tok) != 2*tokenBytes {
+		return fmt.Errorf("token is %d bytes, want %d", len(tok), 2*tokenBytes)
+	}
+	if _, err := hex.DecodeString(tok); err != nil {
+		return errors.New("token is not hex")
+	}
+	return nil
+}
+
+func newToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// EnsureToken returns the token stored at path, creating it on first use. A
+// corrupt token file is replaced with a new token, logging a warning.
 func EnsureToken(path string) (string, error) {
 	// Try to read existing token first
 	if b, err := os.ReadFile(path); err == nil {
-		return string(b), nil
+		tok := string(b)
+		problem := checkToken(tok)
+		if problem == nil {
+			return tok, nil
+		}
+		log.Printf("Regenerating token file %s: %v", path, problem)
+		if tok, err = newToken(); err != nil {
+			return "", err
+		}
+		if err := WriteFileAtomic(path, []byte(tok), 0o600); err != nil {
+			return "", fmt.Errorf("failed to replace token file: %w", err)
+		}
+		return tok, nil
 	} else if !errors.Is(err, os.ErrNotExist) {
 		return "", err
 	}
 
 	// Generate new token
-	b := make([]byte, 32)
-	if _, err := rand.Read(b); err != nil {
+	tok, err := newToken()
+	if err != nil {
 		return "", err
 	}
-	tok := hex.EncodeToString(b)
 
 	// Use atomic file creation: write to temp file, then rename
 	tempPath := path + ".tmp"
@@ -164,7 +232,7 @@ func EnsureToken(path string) (string, error) {
 		os.Remove(tempPath) // Clean up temp file on rename error
 
 		// If rename failed due to existing file, try to read it (race condition recovery)
-		if b, readErr := os.ReadFile(path); readErr == nil {
+		if b, readErr := os.ReadFile(path); readErr == nil && checkToken(string(b)) == nil {
 			return string(b), nil
 		}
 
@@ -173,3 +241,43 @@ func EnsureToken(path string) (string, error) {
 
 	return tok, nil
 }
+
+// WriteFileAtomic writes data to a temp file in the target directory and renames it into place,
+// so readers never observe a partial file. The final file always has the given permissions.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tempPath := f.Name()
+
+	// CreateTemp uses 0600; tighten/adjust before any data is written
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+
+	_, writeErr := f.Write(data)
+	syncErr := f.Sync()
+	closeErr := f.Close()
+
+	if writeErr != nil {
+		os.Remove(tempPath) // Clean up temp file on write error
+		return fmt.Errorf("failed to write file: %w", writeErr)
+	}
+	if syncErr != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to sync file: %w", syncErr)
+	}
+	if closeErr != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to close file: %w", closeErr)
+	}
+
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to rename file: %w", err)
+	}
+	return nil
+}
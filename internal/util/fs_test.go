@@ -271,6 +271,51 @@ func TestEnsureToken_ExistingToken(t *testing.T) {
 	}
 }
 
+func TestEnsureToken_CorruptToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"empty", ""},
+		{"short", "abcdef1234567890abcdef12"},
+		{"non-hex", "zzzzzz1234567890abcdef1234567890abcdef1234567890abcdef1234567890"},
+		{"trailing newline", "abcdef1234567890abcdef1234567890abcdef1234567890abcdef1234567890\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenPath := filepath.Join(t.TempDir(), "token")
+			if err := os.WriteFile(tokenPath, []byte(tt.content), 0o600); err != nil {
+				t.Fatalf("Failed to create token file: %v", err)
+			}
+
+			token, err := EnsureToken(tokenPath)
+			if err != nil {
+				t.Fatalf("EnsureToken failed: %v", err)
+			}
+			if token == tt.content || checkToken(token) != nil {
+				t.Errorf("Expected a new valid token, got %q", token)
+			}
+			content, err := os.ReadFile(tokenPath)
+			if err != nil {
+				t.Fatalf("Failed to read token file: %v", err)
+			}
+			if string(content) != token {
+				t.Errorf("Expected the file to hold the new token %q, got %q", token, content)
+			}
+			if info, _ := os.Stat(tokenPath); info.Mode().Perm() != 0o600 {
+				t.Errorf("Expected the token file to be 0600, got %o", info.Mode().Perm())
+			}
+
+			// The replacement is kept
+			again, err := EnsureToken(tokenPath)
+			if err != nil || again != token {
+				t.Errorf("Expected %q on the next call, got %q (%v)", token, again, err)
+			}
+		})
+	}
+}
+
 func TestEnsureToken_ReadError(t *testing.T) {
 	// Create a temporary directory
 	tempDir := t.TempDir()
@@ -578,3 +623,54 @@ func TestStateDir_XDGWhenNoOldDir(t *testing.T) {
 		t.Errorf("Expected StateDir to use XDG path %q when no old dir exists, got %q", expected, dir)
 	}
 }
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secrets.env")
+
+	// Pre-existing world-readable file must end up 0600
+	if err := os.WriteFile(path, []byte("OLD=1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFileAtomic(path, []byte("NEW=\"2\"\n"), 0o600); err != nil {
+		t.Fatalf("WriteFileAtomic failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "NEW=\"2\"\n" {
+		t.Errorf("Unexpected content %q", data)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected 0600 permissions, got %o", info.Mode().Perm())
+	}
+
+	// No temp files left behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the final file in dir, found %d entries", len(entries))
+	}
+}
+
+func TestWriteFileAtomic_MissingDir(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "missing", "secrets.env")
+
+	if err := WriteFileAtomic(path, []byte("X=1\n"), 0o600); err == nil {
+		t.Fatal("Expected error for missing directory")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected no file to be created on failure")
+	}
+}
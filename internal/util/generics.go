@@ -50,3 +50,22 @@ func GroupBy[T any, K comparable](slice []T, keyFn func(T) K) map[K][]T {
 	}
 	return result
 }
+
+// Reduce folds a slice into a single value, starting from initial
+func Reduce[T any, A any](slice []T, initial A, fn func(A, T) A) A {
+	acc := initial
+	for _, item := range slice {
+		acc = fn(acc, item)
+	}
+	return acc
+}
+
+// ReduceMap folds a map into a single value, starting from initial. Iteration
+// order is unspecified, so fn should be order-independent.
+func ReduceMap[K comparable, V any, A any](m map[K]V, initial A, fn func(A, K, V) A) A {
+	acc := initial
+	for k, v := range m {
+		acc = fn(acc, k, v)
+	}
+	return acc
+}
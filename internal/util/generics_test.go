@@ -104,3 +104,46 @@ func TestGroupBy(t *testing.T) {
 		t.Errorf("Expected 1 word of length 9, got %d", len(grouped[9]))
 	}
 }
+
+func TestReduce(t *testing.T) {
+	// Empty slice returns the initial value untouched
+	sum := Reduce([]int{}, 10, func(acc, n int) int {
+		return acc + n
+	})
+	if sum != 10 {
+		t.Errorf("Expected initial value 10 for empty slice, got %d", sum)
+	}
+
+	// Non-empty slice folds left to right
+	sum = Reduce([]int{1, 2, 3, 4}, 0, func(acc, n int) int {
+		return acc + n
+	})
+	if sum != 10 {
+		t.Errorf("Expected sum 10, got %d", sum)
+	}
+
+	joined := Reduce([]int{1, 2, 3}, "", func(acc string, n int) string {
+		return acc + strconv.Itoa(n)
+	})
+	if joined != "123" {
+		t.Errorf("Expected fold order \"123\", got %q", joined)
+	}
+}
+
+func TestReduceMap(t *testing.T) {
+	// Empty map returns the initial value untouched
+	count := ReduceMap(map[string]int{}, 7, func(acc int, _ string, v int) int {
+		return acc + v
+	})
+	if count != 7 {
+		t.Errorf("Expected initial value 7 for empty map, got %d", count)
+	}
+
+	m := map[string]int{"a": 1, "bb": 2, "ccc": 3}
+	total := ReduceMap(m, 0, func(acc int, k string, v int) int {
+		return acc + len(k)*v
+	})
+	if total != 14 {
+		t.Errorf("Expected weighted sum 14, got %d", total)
+	}
+}
@@ -0,0 +1,63 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// utf8BOM is the byte order mark some editors put at the start of UTF-8 files
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// TrimBOM drops a leading UTF-8 byte order mark
+func TrimBOM(data []byte) []byte {
+	return bytes.TrimPrefix(data, utf8BOM)
+}
+
+// DecodeJSON decodes a JSON file's contents into v, ignoring a leading UTF-8
+// BOM. Errors name the line and column they were found at, and anything but
+// whitespace after the JSON value is an error.
+func DecodeJSON(data []byte, v any) error {
+	data = TrimBOM(data)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(v); err != nil {
+		return jsonError(data, dec, err)
+	}
+	end := dec.InputOffset()
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		rest := data[end:]
+		line, col := lineColumn(data, end+int64(len(rest)-len(bytes.TrimLeft(rest, " \t\r\n"))))
+		return fmt.Errorf("line %d, column %d: unexpected content after the JSON value", line, col)
+	}
+	return nil
+}
+
+// jsonError adds the position of a decode error
+func jsonError(data []byte, dec *json.Decoder, err error) error {
+	offset := dec.InputOffset()
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset - 1 // Offset is just past the bad byte
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset - 1
+	case errors.Is(err, io.EOF):
+		return errors.New("empty file, expected a JSON object")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		offset = int64(len(data))
+	}
+	line, col := lineColumn(data, offset)
+	return fmt.Errorf("line %d, column %d: %w", line, col, err)
+}
+
+// lineColumn returns the 1-based line and column of the byte at offset in data
+func lineColumn(data []byte, offset int64) (line, col int) {
+	offset = min(max(offset, 0), int64(len(data)))
+	before := data[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	col = len(before) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
@@ -0,0 +1,45 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{name: "plain", data: `{"name":"opx"}`},
+		{name: "trailing newline", data: "{\"name\":\"opx\"}\n\n"},
+		{name: "bom", data: "\xEF\xBB\xBF{\"name\":\"opx\"}\n"},
+		{name: "syntax error", data: "{\n  \"name\": \"opx\",\n}", wantErr: "line 3, column 1: invalid character '}'"},
+		{name: "wrong type", data: "{\n  \"name\": 42\n}", wantErr: "line 2, column 12: json: cannot unmarshal number"},
+		{name: "truncated", data: "{\n  \"name\":", wantErr: "line 2, column 10: unexpected EOF"},
+		{name: "trailing garbage", data: "{\"name\":\"opx\"}\n}\n", wantErr: "line 2, column 1: unexpected content after the JSON value"},
+		{name: "second value", data: "{\"name\":\"opx\"} {}", wantErr: "line 1, column 16: unexpected content after the JSON value"},
+		{name: "empty", data: "\xEF\xBB\xBF", wantErr: "empty file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v struct {
+				Name string `json:"name"`
+			}
+			err := DecodeJSON([]byte(tt.data), &v)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if v.Name != "opx" {
+					t.Errorf("Expected name opx, got %q", v.Name)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error starting with %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
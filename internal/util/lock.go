@@ -0,0 +1,117 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// AlreadyRunningError reports that another daemon instance holds the lockfile
+type AlreadyRunningError struct {
+	Path string
+	PID  int // 0 if the holder's PID could not be read
+}
+
+func (e *AlreadyRunningError) Error() string {
+	if e.PID > 0 {
+		return fmt.Sprintf("opx-authd already running (pid %d, lock %s)", e.PID, e.Path)
+	}
+	return fmt.Sprintf("opx-authd already running (lock %s)", e.Path)
+}
+
+// Lockfile is an exclusive advisory lock held for the lifetime of the daemon
+type Lockfile struct {
+	path string
+	f    *os.File
+}
+
+// LockPath returns the default daemon lockfile location in RuntimeDir
+func LockPath() (string, error) {
+	dir, err := RuntimeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "opx-authd.lock"), nil
+}
+
+// AcquireLock takes an exclusive, non-blocking lock on path and records our PID in it.
+// The kernel drops the lock when the holder exits, so a file left behind by a crashed
+// process is simply re-locked.
+func AcquireLock(path string) (*Lockfile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("open lockfile %s: %w", path, err)
+		}
+
+		held, err := tryLock(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("lock %s: %w", path, err)
+		}
+		if held {
+			pid := readLockPID(f)
+			_ = f.Close()
+			return nil, &AlreadyRunningError{Path: path, PID: pid}
+		}
+
+		// The previous holder may have removed the file between our open and lock;
+		// only trust the lock if it is still on the file at path.
+		if !sameFile(f, path) {
+			_ = unlock(f)
+			_ = f.Close()
+			continue
+		}
+
+		if err := f.Truncate(0); err == nil {
+			_, _ = f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+			_ = f.Sync()
+		}
+		return &Lockfile{path: path, f: f}, nil
+	}
+}
+
+// Path returns the lockfile location
+func (l *Lockfile) Path() string {
+	return l.path
+}
+
+// Release removes the lockfile and drops the lock. Safe to call more than once.
+func (l *Lockfile) Release() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	// Remove before unlocking so a new instance never deletes a file it just locked
+	_ = os.Remove(l.path)
+	_ = unlock(l.f)
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+func readLockPID(f *os.File) int {
+	buf := make([]byte, 32)
+	n, _ := f.ReadAt(buf, 0)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(buf[:n])))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+func sameFile(f *os.File, path string) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	pi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(fi, pi)
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package util
+
+import "os"
+
+// Advisory locking is not implemented here; the stale-socket check still applies
+func tryLock(f *os.File) (held bool, err error) {
+	return false, nil
+}
+
+func unlock(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,77 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAcquireLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "opx-authd.lock")
+
+	first, err := AcquireLock(path)
+	if err != nil {
+		t.Fatalf("Unexpected error acquiring lock: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read lockfile: %v", err)
+	}
+	if strings.TrimSpace(string(data)) != strconv.Itoa(os.Getpid()) {
+		t.Errorf("Expected lockfile to contain our pid, got %q", data)
+	}
+
+	// flock locks are per open file description, so a second acquire in the
+	// same process conflicts just like another daemon would
+	_, err = AcquireLock(path)
+	var running *AlreadyRunningError
+	if !errors.As(err, &running) {
+		t.Fatalf("Expected AlreadyRunningError, got %v", err)
+	}
+	if running.PID != os.Getpid() {
+		t.Errorf("Expected holder pid %d, got %d", os.Getpid(), running.PID)
+	}
+	if !strings.Contains(err.Error(), "already running (pid") {
+		t.Errorf("Expected clear already-running message, got %q", err.Error())
+	}
+
+	if err := first.Release(); err != nil {
+		t.Fatalf("Unexpected error releasing lock: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected lockfile to be removed on release")
+	}
+	if err := first.Release(); err != nil {
+		t.Errorf("Expected second release to be a no-op, got %v", err)
+	}
+
+	second, err := AcquireLock(path)
+	if err != nil {
+		t.Fatalf("Expected lock to be available after release: %v", err)
+	}
+	defer second.Release()
+}
+
+func TestAcquireLock_StaleFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "opx-authd.lock")
+
+	// A crashed daemon leaves its file behind but no longer holds the lock
+	if err := os.WriteFile(path, []byte("999999\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := AcquireLock(path)
+	if err != nil {
+		t.Fatalf("Expected stale lockfile to be reclaimed, got %v", err)
+	}
+	defer lock.Release()
+
+	data, _ := os.ReadFile(path)
+	if strings.TrimSpace(string(data)) != strconv.Itoa(os.Getpid()) {
+		t.Errorf("Expected stale pid to be replaced, got %q", data)
+	}
+}
@@ -0,0 +1,113 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrNoLegacyDir is returned by PlanMigration when ~/.op-authd does not exist
+var ErrNoLegacyDir = errors.New("no legacy ~/.op-authd directory found")
+
+// Files copied from the legacy directory, by destination
+var (
+	legacyDataFiles   = []string{"token", "tls.crt", "tls.key", "socket.sock"}
+	legacyConfigFiles = []string{"policy.json", "config.json"}
+)
+
+// MigrationStep is one file copy from the legacy layout to XDG directories
+type MigrationStep struct {
+	Src  string
+	Dst  string
+	Skip string // reason the copy won't happen; empty means it will
+}
+
+// MigrationPlan describes copying ~/.op-authd into the XDG data and config dirs
+type MigrationPlan struct {
+	Source    string
+	DataDir   string
+	ConfigDir string
+	Steps     []MigrationStep
+}
+
+// PlanMigration works out what Apply would copy without touching the filesystem.
+// Existing destination files are skipped unless force is set.
+func PlanMigration(force bool) (MigrationPlan, error) {
+	src := LegacyDir()
+	if info, err := os.Stat(src); err != nil || !info.IsDir() {
+		return MigrationPlan{}, ErrNoLegacyDir
+	}
+
+	plan := MigrationPlan{
+		Source:    src,
+		DataDir:   xdgDataPath(),
+		ConfigDir: xdgConfigPath(),
+	}
+	for _, name := range legacyDataFiles {
+		plan.Steps = append(plan.Steps, planStep(filepath.Join(src, name), filepath.Join(plan.DataDir, name), force))
+	}
+	for _, name := range legacyConfigFiles {
+		plan.Steps = append(plan.Steps, planStep(filepath.Join(src, name), filepath.Join(plan.ConfigDir, name), force))
+	}
+	return plan, nil
+}
+
+func planStep(src, dst string, force bool) MigrationStep {
+	step := MigrationStep{Src: src, Dst: dst}
+
+	info, err := os.Lstat(src)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		step.Skip = "not present"
+	case err != nil:
+		step.Skip = err.Error()
+	case info.Mode()&os.ModeSocket != 0:
+		step.Skip = "socket is recreated when the daemon starts"
+	case !info.Mode().IsRegular():
+		step.Skip = "not a regular file"
+	}
+	if step.Skip != "" {
+		return step
+	}
+
+	if _, err := os.Lstat(dst); err == nil && !force {
+		step.Skip = "destination exists (use --force to overwrite)"
+	}
+	return step
+}
+
+// Apply creates the XDG directories and copies every non-skipped file, keeping
+// its permissions. The legacy directory is left untouched.
+func (p MigrationPlan) Apply() error {
+	for _, dir := range []string{p.DataDir, p.ConfigDir} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return fmt.Errorf("mkdir %s: %w", dir, err)
+		}
+		if err := os.Chmod(dir, 0o700); err != nil {
+			return err
+		}
+	}
+
+	for _, step := range p.Steps {
+		if step.Skip != "" {
+			continue
+		}
+		if err := copyFile(step.Src, step.Dst); err != nil {
+			return fmt.Errorf("copy %s: %w", step.Src, err)
+		}
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(dst, data, info.Mode().Perm())
+}
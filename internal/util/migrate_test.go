@@ -0,0 +1,153 @@
+package util
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupLegacyLayout points HOME and XDG dirs at temp dirs and creates ~/.op-authd files
+func setupLegacyLayout(t *testing.T, files map[string]string) (home, dataDir, configDir string) {
+	t.Helper()
+	home = t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_DATA_HOME", filepath.Join(home, "xdg-data"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "xdg-config"))
+
+	legacy := filepath.Join(home, ".op-authd")
+	if err := os.MkdirAll(legacy, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(legacy, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return home, filepath.Join(home, "xdg-data", "op-authd"), filepath.Join(home, "xdg-config", "op-authd")
+}
+
+func TestPlanMigration_NoLegacyDir(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if _, err := PlanMigration(false); !errors.Is(err, ErrNoLegacyDir) {
+		t.Errorf("Expected ErrNoLegacyDir, got %v", err)
+	}
+}
+
+func TestMigration_DryRunAndApply(t *testing.T) {
+	home, dataDir, configDir := setupLegacyLayout(t, map[string]string{
+		"token":       "tok",
+		"tls.crt":     "cert",
+		"tls.key":     "key",
+		"policy.json": `{"allow":[]}`,
+	})
+
+	plan, err := PlanMigration(false)
+	if err != nil {
+		t.Fatalf("PlanMigration failed: %v", err)
+	}
+	if plan.Source != filepath.Join(home, ".op-authd") {
+		t.Errorf("Unexpected source %q", plan.Source)
+	}
+
+	// Planning alone must not create anything (dry run)
+	if _, err := os.Stat(dataDir); !os.IsNotExist(err) {
+		t.Error("Expected planning not to create the data dir")
+	}
+
+	skipped := map[string]string{}
+	for _, step := range plan.Steps {
+		skipped[filepath.Base(step.Src)] = step.Skip
+	}
+	if skipped["token"] != "" || skipped["policy.json"] != "" {
+		t.Errorf("Expected token and policy.json to be copied, got %v", skipped)
+	}
+	if skipped["config.json"] == "" || skipped["socket.sock"] == "" {
+		t.Errorf("Expected missing files to be skipped, got %v", skipped)
+	}
+
+	if err := plan.Apply(); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	for path, want := range map[string]string{
+		filepath.Join(dataDir, "token"):         "tok",
+		filepath.Join(dataDir, "tls.crt"):       "cert",
+		filepath.Join(dataDir, "tls.key"):       "key",
+		filepath.Join(configDir, "policy.json"): `{"allow":[]}`,
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("Expected %s to be copied: %v", path, err)
+			continue
+		}
+		if string(data) != want {
+			t.Errorf("%s: expected %q, got %q", path, want, data)
+		}
+		if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+			t.Errorf("%s: expected 0600 permissions, got %v", path, info.Mode().Perm())
+		}
+	}
+
+	// Copies, not moves
+	if _, err := os.Stat(filepath.Join(home, ".op-authd", "token")); err != nil {
+		t.Error("Expected legacy files to be left in place")
+	}
+}
+
+func TestMigration_DoesNotOverwriteWithoutForce(t *testing.T) {
+	_, dataDir, _ := setupLegacyLayout(t, map[string]string{"token": "old-layout"})
+	if err := os.MkdirAll(dataDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(dataDir, "token")
+	if err := os.WriteFile(dst, []byte("new-layout"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := PlanMigration(false)
+	if err != nil {
+		t.Fatalf("PlanMigration failed: %v", err)
+	}
+	if err := plan.Apply(); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "new-layout" {
+		t.Errorf("Expected existing destination to be kept, got %q", data)
+	}
+
+	plan, err = PlanMigration(true)
+	if err != nil {
+		t.Fatalf("PlanMigration failed: %v", err)
+	}
+	if err := plan.Apply(); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "old-layout" {
+		t.Errorf("Expected --force to overwrite the destination, got %q", data)
+	}
+}
+
+func TestMigration_SkipsSocket(t *testing.T) {
+	home, _, _ := setupLegacyLayout(t, nil)
+	sock := filepath.Join(home, ".op-authd", "socket.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer l.Close()
+
+	plan, err := PlanMigration(false)
+	if err != nil {
+		t.Fatalf("PlanMigration failed: %v", err)
+	}
+	for _, step := range plan.Steps {
+		if filepath.Base(step.Src) == "socket.sock" && step.Skip == "" {
+			t.Error("Expected live socket not to be copied")
+		}
+	}
+	if err := plan.Apply(); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+package util
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TCPEndpointEnv and ClientCertEnv point opx at a daemon's TCP listener and
+// the bundle from `opx-authd issue-client-cert` it authenticates with
+const (
+	TCPEndpointEnv = "OPX_TCP_ENDPOINT"
+	ClientCertEnv  = "OPX_CLIENT_CERT"
+)
+
+// tokenBlockType is the PEM block a client bundle carries the daemon token in
+const tokenBlockType = "OPX TOKEN"
+
+// CheckLoopbackAddr rejects TCP listen addresses other than a loopback host and port
+func CheckLoopbackAddr(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if port == "" {
+		return fmt.Errorf("%s has no port", addr)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("%s is not a loopback address", addr)
+	}
+	return nil
+}
+
+// ClientCA issues the certificates clients present on the TCP listener, and
+// the listener's own certificate, so both sides trust only each other
+type ClientCA struct {
+	Cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func clientCAPaths() (certPath, keyPath string, err error) {
+	dir, err := getStateDir()
+	if err != nil {
+		return "", "", err
+	}
+	return filepath.Join(dir, "client-ca.crt"), filepath.Join(dir, "client-ca.key"), nil
+}
+
+// LoadClientCA reads the client CA from the state dir, creating it on first use.
+// Deleting client-ca.crt and client-ca.key revokes every issued bundle.
+func LoadClientCA() (*ClientCA, error) {
+	certPath, keyPath, err := clientCAPaths()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := loadExistingCert(certPath, keyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := generateClientCA(certPath, keyPath); err != nil {
+			return nil, fmt.Errorf("failed to generate client CA: %w", err)
+		}
+		cert, err = loadExistingCert(certPath, keyPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client CA: %w", err)
+	}
+	if !cert.Leaf.IsCA || time.Now().After(cert.Leaf.NotAfter) {
+		return nil, fmt.Errorf("%s is not a valid CA certificate; remove it and %s to start over", certPath, keyPath)
+	}
+	key, ok := cert.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported client CA key type %T", cert.PrivateKey)
+	}
+	return &ClientCA{Cert: cert.Leaf, key: key}, nil
+}
+
+func generateClientCA(certPath, keyPath string) error {
+	key, keyBlock, err := generatePrivateKey(CertPolicy{KeyType: CertKeyECDSA, MinBits: 256})
+	if err != nil {
+		return err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"op-authd"}, CommonName: "op-authd client CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(5 * 365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, key.Public(), key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(certPath), 0o700); err != nil {
+		return err
+	}
+	if err := WriteFileAtomic(keyPath, pem.EncodeToMemory(keyBlock), 0o600); err != nil {
+		return err
+	}
+	return WriteFileAtomic(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+}
+
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// issue signs a fresh ECDSA key into a certificate for template
+func (ca *ClientCA) issue(template *x509.Certificate) (tls.Certificate, *pem.Block, error) {
+	key, keyBlock, err := generatePrivateKey(CertPolicy{KeyType: CertKeyECDSA, MinBits: 256})
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	if template.SerialNumber, err = randomSerial(); err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, key.Public(), ca.key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, keyBlock, nil
+}
+
+// pool is a cert pool trusting only the CA
+func (ca *ClientCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+	return pool
+}
+
+// ServerTLSConfig is the TCP listener's TLS config: a certificate the CA issues
+// for this run, and a verified client certificate from the CA required of every peer
+func (ca *ClientCA) ServerTLSConfig() (*tls.Config, error) {
+	cert, _, err := ca.issue(&x509.Certificate{
+		Subject:     pkix.Name{Organization: []string{"op-authd"}, CommonName: defaultCertIdentity},
+		NotBefore:   time.Now(),
+		NotAfter:    time.Now().Add(365 * 24 * time.Hour),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		DNSNames:    []string{"localhost", defaultCertIdentity},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue TCP server certificate: %w", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.pool(),
+		MinVersion:   tls.VersionTLS13,
+	}, nil
+}
+
+// ClientBundle issues a client certificate with common name cn and returns it
+// as PEM together with its key, the CA certificate and the daemon token. The
+// bundle is a credential: anyone holding it can connect as cn.
+func (ca *ClientCA) ClientBundle(cn string, validity time.Duration, token string) ([]byte, error) {
+	if strings.TrimSpace(cn) == "" {
+		return nil, errors.New("client certificate needs a common name")
+	}
+	cert, keyBlock, err := ca.issue(&x509.Certificate{
+		Subject:     pkix.Name{Organization: []string{"op-authd"}, CommonName: cn},
+		NotBefore:   time.Now(),
+		NotAfter:    time.Now().Add(validity),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue client certificate: %w", err)
+	}
+	var out []byte
+	out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})...)
+	out = append(out, pem.EncodeToMemory(keyBlock)...)
+	out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Cert.Raw})...)
+	out = append(out, pem.EncodeToMemory(&pem.Block{Type: tokenBlockType, Bytes: []byte(token)})...)
+	return out, nil
+}
+
+// LoadClientBundle reads a bundle written by ClientBundle, returning client TLS
+// config that presents its certificate and trusts only its CA, and its token
+func LoadClientBundle(path string) (*tls.Config, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	var leafPEM, keyPEM []byte
+	var token string
+	roots := x509.NewCertPool()
+	hasCA := false
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			break
+		}
+		switch {
+		case block.Type == tokenBlockType:
+			token = string(block.Bytes)
+		case block.Type == "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, "", fmt.Errorf("%s: %w", path, err)
+			}
+			if cert.IsCA {
+				roots.AddCert(cert)
+				hasCA = true
+			} else {
+				leafPEM = pem.EncodeToMemory(block)
+			}
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			keyPEM = pem.EncodeToMemory(block)
+		}
+	}
+	if leafPEM == nil || keyPEM == nil || !hasCA {
+		return nil, "", fmt.Errorf("%s is not a client bundle from opx-authd issue-client-cert", path)
+	}
+	cert, err := tls.X509KeyPair(leafPEM, keyPEM)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", path, err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      roots,
+		ServerName:   defaultCertIdentity,
+		MinVersion:   tls.VersionTLS13,
+	}, token, nil
+}
@@ -0,0 +1,196 @@
+package util
+
+import (
+	"crypto/tls"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckLoopbackAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		wantErr bool
+	}{
+		{"127.0.0.1:7070", false},
+		{"[::1]:7070", false},
+		{"localhost:7070", false},
+		{"0.0.0.0:7070", true},
+		{"192.168.1.10:7070", true},
+		{":7070", true},
+		{"example.com:7070", true},
+		{"127.0.0.1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if err := CheckLoopbackAddr(tt.addr); (err != nil) != tt.wantErr {
+				t.Errorf("CheckLoopbackAddr(%q) error = %v, wantErr %v", tt.addr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// useStateDir points the client CA at dir for the rest of the test
+func useStateDir(t *testing.T, dir string) {
+	original := getStateDir
+	getStateDir = func() (string, error) { return dir, nil }
+	t.Cleanup(func() { getStateDir = original })
+}
+
+func TestLoadClientCA(t *testing.T) {
+	dir := t.TempDir()
+	useStateDir(t, dir)
+
+	ca, err := LoadClientCA()
+	if err != nil {
+		t.Fatalf("LoadClientCA failed: %v", err)
+	}
+	if !ca.Cert.IsCA {
+		t.Error("Expected a CA certificate")
+	}
+	for _, name := range []string{"client-ca.crt", "client-ca.key"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Expected %s to be written: %v", name, err)
+		}
+		if info.Mode().Perm() != 0o600 {
+			t.Errorf("Expected %s to be 0600, got %o", name, info.Mode().Perm())
+		}
+	}
+
+	again, err := LoadClientCA()
+	if err != nil {
+		t.Fatalf("LoadClientCA failed on reload: %v", err)
+	}
+	if !again.Cert.Equal(ca.Cert) {
+		t.Error("Expected the existing CA to be reused")
+	}
+}
+
+// handshake runs a TLS handshake between the two configs over a loopback TCP
+// connection and returns the server side's result
+func handshake(t *testing.T, serverConfig, clientConfig *tls.Config) (tls.ConnectionState, error) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+
+	type result struct {
+		state tls.ConnectionState
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		defer conn.Close()
+		tlsConn := tls.Server(conn, serverConfig)
+		_ = tlsConn.SetDeadline(time.Now().Add(5 * time.Second))
+		err = tlsConn.Handshake()
+		done <- result{tlsConn.ConnectionState(), err}
+	}()
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), clientConfig)
+	if err == nil {
+		// TLS 1.3 clients learn of a rejected certificate on their first read
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		_, _ = conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	r := <-done
+	return r.state, r.err
+}
+
+func TestClientBundle_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	useStateDir(t, dir)
+	ca, err := LoadClientCA()
+	if err != nil {
+		t.Fatalf("LoadClientCA failed: %v", err)
+	}
+	serverConfig, err := ca.ServerTLSConfig()
+	if err != nil {
+		t.Fatalf("ServerTLSConfig failed: %v", err)
+	}
+
+	bundle, err := ca.ClientBundle("wsl-dev", time.Hour, "secret-token")
+	if err != nil {
+		t.Fatalf("ClientBundle failed: %v", err)
+	}
+	bundlePath := filepath.Join(dir, "bundle.pem")
+	if err := os.WriteFile(bundlePath, bundle, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	clientConfig, token, err := LoadClientBundle(bundlePath)
+	if err != nil {
+		t.Fatalf("LoadClientBundle failed: %v", err)
+	}
+	if token != "secret-token" {
+		t.Errorf("Expected the bundle's token, got %q", token)
+	}
+
+	state, err := handshake(t, serverConfig, clientConfig)
+	if err != nil {
+		t.Fatalf("Expected the issued client to be accepted, got %v", err)
+	}
+	if len(state.VerifiedChains) == 0 || state.VerifiedChains[0][0].Subject.CommonName != "wsl-dev" {
+		t.Errorf("Expected a verified chain for wsl-dev, got %+v", state.VerifiedChains)
+	}
+
+	// A certificate from another CA is refused
+	useStateDir(t, t.TempDir())
+	rogue, err := LoadClientCA()
+	if err != nil {
+		t.Fatalf("LoadClientCA failed: %v", err)
+	}
+	rogueBundle, err := rogue.ClientBundle("wsl-dev", time.Hour, "secret-token")
+	if err != nil {
+		t.Fatalf("ClientBundle failed: %v", err)
+	}
+	roguePath := filepath.Join(dir, "rogue.pem")
+	if err := os.WriteFile(roguePath, rogueBundle, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rogueConfig, _, err := LoadClientBundle(roguePath)
+	if err != nil {
+		t.Fatalf("LoadClientBundle failed: %v", err)
+	}
+	// Trust the real daemon so only the client certificate is at fault
+	rogueConfig.RootCAs = clientConfig.RootCAs
+	if _, err := handshake(t, serverConfig, rogueConfig); err == nil {
+		t.Error("Expected a client certificate from another CA to be rejected")
+	}
+
+	// So is a client without any certificate
+	noCert := clientConfig.Clone()
+	noCert.Certificates = nil
+	if _, err := handshake(t, serverConfig, noCert); err == nil {
+		t.Error("Expected a client without a certificate to be rejected")
+	}
+}
+
+func TestLoadClientBundle_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	useStateDir(t, dir)
+	if _, err := TLSConfig(); err != nil {
+		t.Fatalf("TLSConfig failed: %v", err)
+	}
+	// The daemon's socket certificate and key aren't a client bundle
+	certPEM, _ := os.ReadFile(filepath.Join(dir, "tls.crt"))
+	keyPEM, _ := os.ReadFile(filepath.Join(dir, "tls.key"))
+	path := filepath.Join(dir, "bundle.pem")
+	if err := os.WriteFile(path, append(certPEM, keyPEM...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := LoadClientBundle(path); err == nil {
+		t.Error("Expected an error for a bundle without a CA certificate")
+	}
+}
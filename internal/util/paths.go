@@ -0,0 +1,90 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ResolvedPath is one path opx uses and the rule that chose it
+type ResolvedPath struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Source string `json:"source"`
+}
+
+// ResolvePaths returns the state, data, config and runtime dirs and the socket
+// and token paths as opx and opx-authd resolve them, each with the rule that
+// chose it. Like the lookups it reuses, it creates missing directories.
+func ResolvePaths() ([]ResolvedPath, error) {
+	legacy := false
+	if _, err := os.Stat(LegacyDir()); err == nil {
+		legacy = true
+	}
+	legacySource := "legacy " + LegacyDir() + " exists"
+
+	stateDir, err := StateDir()
+	if err != nil {
+		return nil, err
+	}
+	dataDir, err := DataDir()
+	if err != nil {
+		return nil, err
+	}
+	configDir, err := ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	runtimeDir, err := RuntimeDir()
+	if err != nil {
+		return nil, err
+	}
+	socket, socketSource, err := resolveSocketPath()
+	if err != nil {
+		return nil, err
+	}
+	token, err := TokenPath()
+	if err != nil {
+		return nil, err
+	}
+
+	dataSource := xdgSource("XDG_DATA_HOME", "~/.local/share")
+	stateSource, runtimeSource := dataSource, legacySource
+	if legacy {
+		stateSource = legacySource
+	} else if os.Getenv("XDG_RUNTIME_DIR") != "" {
+		runtimeSource = "XDG: $XDG_RUNTIME_DIR"
+	} else {
+		runtimeSource = "data dir, $XDG_RUNTIME_DIR unset"
+	}
+	return []ResolvedPath{
+		{Name: "state dir", Path: stateDir, Source: stateSource},
+		{Name: "data dir", Path: dataDir, Source: dataSource},
+		{Name: "config dir", Path: configDir, Source: xdgSource("XDG_CONFIG_HOME", "~/.config")},
+		{Name: "runtime dir", Path: runtimeDir, Source: runtimeSource},
+		{Name: "socket", Path: socket, Source: socketSource},
+		{Name: "token", Path: token, Source: "state dir"},
+	}, nil
+}
+
+// xdgSource describes the XDG base directory rule for env
+func xdgSource(env, fallback string) string {
+	if os.Getenv(env) != "" {
+		return "XDG: $" + env
+	}
+	return "XDG default " + filepath.Join(fallback, "op-authd") + ", $" + env + " unset"
+}
+
+// FormatPaths renders resolved paths one per line with the rule that chose each
+func FormatPaths(paths []ResolvedPath) string {
+	width := 0
+	for _, p := range paths {
+		width = max(width, len(p.Name))
+	}
+	var b strings.Builder
+	for _, p := range paths {
+		fmt.Fprintf(&b, "%-*s  %s  (%s)\n", width+1, p.Name+":", p.Path, p.Source)
+	}
+	return b.String()
+}
@@ -0,0 +1,87 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolvePaths(t *testing.T) {
+	home, data, config, runtime := t.TempDir(), t.TempDir(), t.TempDir(), t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_DATA_HOME", data)
+	t.Setenv("XDG_CONFIG_HOME", config)
+	t.Setenv("XDG_RUNTIME_DIR", runtime)
+	t.Setenv(SocketEnv, "")
+
+	paths, err := ResolvePaths()
+	if err != nil {
+		t.Fatalf("ResolvePaths failed: %v", err)
+	}
+	dataDir := filepath.Join(data, "op-authd")
+	expected := []ResolvedPath{
+		{Name: "state dir", Path: dataDir, Source: "XDG: $XDG_DATA_HOME"},
+		{Name: "data dir", Path: dataDir, Source: "XDG: $XDG_DATA_HOME"},
+		{Name: "config dir", Path: filepath.Join(config, "op-authd"), Source: "XDG: $XDG_CONFIG_HOME"},
+		{Name: "runtime dir", Path: filepath.Join(runtime, "op-authd"), Source: "XDG: $XDG_RUNTIME_DIR"},
+		{Name: "socket", Path: filepath.Join(dataDir, "socket.sock"), Source: "state dir"},
+		{Name: "token", Path: filepath.Join(dataDir, "token"), Source: "state dir"},
+	}
+	if len(paths) != len(expected) {
+		t.Fatalf("Expected %d paths, got %+v", len(expected), paths)
+	}
+	for i, want := range expected {
+		if paths[i] != want {
+			t.Errorf("Expected %+v, got %+v", want, paths[i])
+		}
+	}
+
+	out := FormatPaths(paths)
+	for _, want := range expected {
+		if !strings.Contains(out, want.Name+":") || !strings.Contains(out, want.Path+"  ("+want.Source+")") {
+			t.Errorf("Expected output to list %s at %s, got:\n%s", want.Name, want.Path, out)
+		}
+	}
+}
+
+func TestResolvePaths_LegacyAndSocketOverride(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	legacy := filepath.Join(home, ".op-authd")
+	if err := os.MkdirAll(legacy, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	sock := filepath.Join(home, "custom.sock")
+	t.Setenv(SocketEnv, sock)
+
+	paths, err := ResolvePaths()
+	if err != nil {
+		t.Fatalf("ResolvePaths failed: %v", err)
+	}
+	got := make(map[string]ResolvedPath)
+	for _, p := range paths {
+		got[p.Name] = p
+	}
+	if p := got["state dir"]; p.Path != legacy || !strings.HasPrefix(p.Source, "legacy") {
+		t.Errorf("Expected the legacy state dir, got %+v", p)
+	}
+	if p := got["runtime dir"]; p.Path != legacy || !strings.HasPrefix(p.Source, "legacy") {
+		t.Errorf("Expected the legacy runtime dir, got %+v", p)
+	}
+	if p := got["data dir"]; p.Path != filepath.Join(home, ".local", "share", "op-authd") || !strings.Contains(p.Source, "$XDG_DATA_HOME unset") {
+		t.Errorf("Expected the default data dir, got %+v", p)
+	}
+	if p := got["config dir"]; p.Path != filepath.Join(home, ".config", "op-authd") || !strings.HasPrefix(p.Source, "XDG default") {
+		t.Errorf("Expected the default config dir, got %+v", p)
+	}
+	if p := got["socket"]; p.Path != sock || p.Source != "$"+SocketEnv {
+		t.Errorf("Expected the $OPX_SOCKET socket, got %+v", p)
+	}
+	if p := got["token"]; p.Path != filepath.Join(legacy, "token") {
+		t.Errorf("Expected the token in the legacy dir, got %+v", p)
+	}
+}
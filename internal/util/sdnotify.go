@@ -0,0 +1,47 @@
+package util
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NotifySocketEnv names the datagram socket systemd gives Type=notify services
+const NotifySocketEnv = "NOTIFY_SOCKET"
+
+// SdNotify sends state, such as "READY=1", to systemd. sent is false without
+// NOTIFY_SOCKET, i.e. when the process isn't a Type=notify service.
+func SdNotify(state string) (sent bool, err error) {
+	path := os.Getenv(NotifySocketEnv)
+	if path == "" {
+		return false, nil
+	}
+	// A leading @ is a socket in the abstract namespace
+	if strings.HasPrefix(path, "@") {
+		path = "\x00" + path[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SdWatchdogInterval returns how often to send WATCHDOG=1, half of systemd's
+// WatchdogSec, or 0 when no watchdog is configured for this process
+func SdWatchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
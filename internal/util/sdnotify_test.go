@@ -0,0 +1,63 @@
+package util
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSdNotify(t *testing.T) {
+	t.Setenv(NotifySocketEnv, "")
+	if sent, err := SdNotify("READY=1"); sent || err != nil {
+		t.Fatalf("Expected nothing sent without %s, got sent=%v err=%v", NotifySocketEnv, sent, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("ListenUnixgram failed: %v", err)
+	}
+	defer conn.Close()
+	t.Setenv(NotifySocketEnv, path)
+
+	if sent, err := SdNotify("READY=1"); !sent || err != nil {
+		t.Fatalf("Expected READY=1 sent, got sent=%v err=%v", sent, err)
+	}
+	buf := make([]byte, 64)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if got := string(buf[:n]); got != "READY=1" {
+		t.Errorf("Expected READY=1, got %q", got)
+	}
+}
+
+func TestSdWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		usec     string
+		pid      string
+		expected time.Duration
+	}{
+		{name: "unset", expected: 0},
+		{name: "half the timeout", usec: "10000000", expected: 5 * time.Second},
+		{name: "this process", usec: "2000000", pid: strconv.Itoa(os.Getpid()), expected: time.Second},
+		{name: "another process", usec: "2000000", pid: "1", expected: 0},
+		{name: "garbage", usec: "soon", expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+			if got := SdWatchdogInterval(); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// MaxSocketPathLen is the longest unix socket path that binds everywhere we
+// run; macOS allows 104 bytes of sun_path including the trailing NUL
+const MaxSocketPathLen = 103
+
+// socketPointerName is the state-dir file naming a relocated socket
+const socketPointerName = "socket.path"
+
+// shortSocketBase is where over-long socket paths are relocated; a var for tests
+var shortSocketBase = "/tmp"
+
+// SocketPathTooLongError reports a socket path that the kernel would refuse to bind
+type SocketPathTooLongError struct {
+	Path string
+}
+
+func (e *SocketPathTooLongError) Error() string {
+	return fmt.Sprintf("socket path %s is %d bytes, over the %d-byte unix socket limit", e.Path, len(e.Path), MaxSocketPathLen)
+}
+
+// CheckSocketPath returns a *SocketPathTooLongError if p is too long to bind
+func CheckSocketPath(p string) error {
+	if len(p) > MaxSocketPathLen {
+		return &SocketPathTooLongError{Path: p}
+	}
+	return nil
+}
+
+// SocketEnv overrides the socket path for both opx and opx-authd
+const SocketEnv = "OPX_SOCKET"
+
+// SocketPath returns the socket clients dial: $OPX_SOCKET, else the path the
+// daemon recorded in the pointer file, else socket.sock in the state dir (or
+// its short fallback when that is too long)
+func SocketPath() (string, error) {
+	p, _, err := resolveSocketPath()
+	return p, err
+}
+
+// resolveSocketPath is SocketPath that also says which rule chose the path
+func resolveSocketPath() (path, source string, err error) {
+	if p := os.Getenv(SocketEnv); p != "" {
+		if err := CheckSocketPath(p); err != nil {
+			return "", "", err
+		}
+		return p, "$" + SocketEnv, nil
+	}
+	dir, err := StateDir()
+	if err != nil {
+		return "", "", err
+	}
+	if p, ok := readSocketPointer(dir); ok {
+		return p, "recorded by opx-authd in " + filepath.Join(dir, socketPointerName), nil
+	}
+	p := filepath.Join(dir, "socket.sock")
+	if CheckSocketPath(p) != nil {
+		return fallbackSocketPath(), "short fallback: " + p + " is too long", nil
+	}
+	return p, "state dir", nil
+}
+
+// ListenSocketPath returns the socket the daemon binds without --sock:
+// $OPX_SOCKET, else socket.sock in the state dir, moved to a short 0700
+// per-user directory when that path is too long
+func ListenSocketPath() (string, error) {
+	if p := os.Getenv(SocketEnv); p != "" {
+		if err := CheckSocketPath(p); err != nil {
+			return "", err
+		}
+		return p, nil
+	}
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	p := filepath.Join(dir, "socket.sock")
+	if CheckSocketPath(p) == nil {
+		return p, nil
+	}
+
+	short := fallbackSocketPath()
+	if err := CheckSocketPath(short); err != nil {
+		return "", err
+	}
+	if err := ensurePrivateDir(filepath.Dir(short)); err != nil {
+		return "", fmt.Errorf("%w; fallback directory: %v", &SocketPathTooLongError{Path: p}, err)
+	}
+	return short, nil
+}
+
+// RecordSocketPath writes p to the pointer file so clients dial the socket the
+// daemon actually bound, or removes the pointer when p is the default socket
+func RecordSocketPath(p string) error {
+	dir, err := StateDir()
+	if err != nil {
+		return err
+	}
+	pointer := filepath.Join(dir, socketPointerName)
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return err
+	}
+	if abs == filepath.Join(dir, "socket.sock") {
+		if err := os.Remove(pointer); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove socket pointer: %w", err)
+		}
+		return nil
+	}
+	if err := WriteFileAtomic(pointer, []byte(abs+"\n"), 0o600); err != nil {
+		return fmt.Errorf("write socket pointer: %w", err)
+	}
+	return nil
+}
+
+// fallbackSocketPath is the relocated socket, /tmp/opx-$UID/socket.sock
+func fallbackSocketPath() string {
+	return filepath.Join(shortSocketBase, "opx-"+strconv.Itoa(os.Getuid()), "socket.sock")
+}
+
+// readSocketPointer returns the absolute socket path recorded in dir, if any
+func readSocketPointer(dir string) (string, bool) {
+	b, err := os.ReadFile(filepath.Join(dir, socketPointerName))
+	if err != nil {
+		return "", false
+	}
+	p := strings.TrimSpace(string(b))
+	if !filepath.IsAbs(p) {
+		return "", false
+	}
+	return p, true
+}
+
+// ensurePrivateDir creates dir as 0700, refusing symlinks; chmod fails on
+// directories owned by another user
+func ensurePrivateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return os.Chmod(dir, 0o700)
+}
+
+// DefaultSocketPaths are the sockets a daemon binds without --sock or
+// $OPX_SOCKET: the XDG data dir's and the legacy ~/.op-authd one
+func DefaultSocketPaths() []string {
+	return []string{filepath.Join(xdgDataPath(), "socket.sock"), filepath.Join(LegacyDir(), "socket.sock")}
+}
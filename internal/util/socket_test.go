@@ -0,0 +1,158 @@
+package util
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckSocketPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		tooLong bool
+	}{
+		{name: "short", path: "/tmp/opx-501/socket.sock"},
+		{name: "at limit", path: "/" + strings.Repeat("a", MaxSocketPathLen-1)},
+		{name: "over limit", path: "/" + strings.Repeat("a", MaxSocketPathLen), tooLong: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckSocketPath(tt.path)
+			var tooLong *SocketPathTooLongError
+			if got := errors.As(err, &tooLong); got != tt.tooLong {
+				t.Errorf("Expected too long %v, got %v (%v)", tt.tooLong, got, err)
+			}
+			if tt.tooLong && !strings.Contains(err.Error(), "103-byte") {
+				t.Errorf("Expected error to name the limit, got %q", err)
+			}
+		})
+	}
+}
+
+func TestListenSocketPath_LongHomeFallback(t *testing.T) {
+	longHome := filepath.Join(t.TempDir(), strings.Repeat("deep", 20))
+	if err := os.MkdirAll(longHome, 0o700); err != nil {
+		t.Fatalf("Failed to create home: %v", err)
+	}
+	t.Setenv("HOME", longHome)
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv(SocketEnv, "")
+	base, err := os.MkdirTemp("/tmp", "s")
+	if err != nil {
+		t.Fatalf("Failed to create fallback base: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(base) })
+	original := shortSocketBase
+	shortSocketBase = base
+	t.Cleanup(func() { shortSocketBase = original })
+
+	listenPath, err := ListenSocketPath()
+	if err != nil {
+		t.Fatalf("ListenSocketPath failed: %v", err)
+	}
+	if !strings.HasPrefix(listenPath, base+string(filepath.Separator)+"opx-") {
+		t.Fatalf("Expected socket relocated under %s, got %s", base, listenPath)
+	}
+	fi, err := os.Stat(filepath.Dir(listenPath))
+	if err != nil {
+		t.Fatalf("Fallback dir missing: %v", err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0o700 {
+		t.Errorf("Expected fallback dir mode 0700, got %o", perm)
+	}
+
+	// Clients find the relocated socket through the pointer file
+	if err := RecordSocketPath(listenPath); err != nil {
+		t.Fatalf("RecordSocketPath failed: %v", err)
+	}
+	dialPath, err := SocketPath()
+	if err != nil {
+		t.Fatalf("SocketPath failed: %v", err)
+	}
+	if dialPath != listenPath {
+		t.Errorf("Expected client path %q, got %q", listenPath, dialPath)
+	}
+
+	l, err := net.Listen("unix", listenPath)
+	if err != nil {
+		t.Fatalf("Listen on fallback failed: %v", err)
+	}
+	defer l.Close()
+	conn, err := net.Dial("unix", dialPath)
+	if err != nil {
+		t.Fatalf("Dial through pointer failed: %v", err)
+	}
+	conn.Close()
+}
+
+func TestRecordSocketPath_DefaultClearsPointer(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv(SocketEnv, "")
+
+	dir, err := StateDir()
+	if err != nil {
+		t.Fatalf("StateDir failed: %v", err)
+	}
+	pointer := filepath.Join(dir, socketPointerName)
+	if err := os.WriteFile(pointer, []byte("/tmp/opx-stale/socket.sock\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write pointer: %v", err)
+	}
+
+	if p, _ := SocketPath(); p != "/tmp/opx-stale/socket.sock" {
+		t.Errorf("Expected client to follow the pointer, got %q", p)
+	}
+
+	listenPath, err := ListenSocketPath()
+	if err != nil {
+		t.Fatalf("ListenSocketPath failed: %v", err)
+	}
+	if expected := filepath.Join(dir, "socket.sock"); listenPath != expected {
+		t.Errorf("Expected %q, got %q", expected, listenPath)
+	}
+	if err := RecordSocketPath(listenPath); err != nil {
+		t.Fatalf("RecordSocketPath failed: %v", err)
+	}
+	if _, err := os.Stat(pointer); !os.IsNotExist(err) {
+		t.Error("Expected stale pointer to be removed")
+	}
+	if p, _ := SocketPath(); p != listenPath {
+		t.Errorf("Expected client path %q, got %q", listenPath, p)
+	}
+}
+
+func TestRecordSocketPath_CustomSocket(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv(SocketEnv, "")
+	custom := filepath.Join(t.TempDir(), "custom.sock")
+
+	// A daemon started with --sock records where it listens
+	if err := RecordSocketPath(custom); err != nil {
+		t.Fatalf("RecordSocketPath failed: %v", err)
+	}
+	if p, err := SocketPath(); err != nil || p != custom {
+		t.Errorf("Expected client to discover %q, got %q (%v)", custom, p, err)
+	}
+
+	// OPX_SOCKET wins in both binaries
+	override := filepath.Join(t.TempDir(), "env.sock")
+	t.Setenv(SocketEnv, override)
+	if p, err := SocketPath(); err != nil || p != override {
+		t.Errorf("Expected client to use %s=%q, got %q (%v)", SocketEnv, override, p, err)
+	}
+	if p, err := ListenSocketPath(); err != nil || p != override {
+		t.Errorf("Expected daemon to use %s=%q, got %q (%v)", SocketEnv, override, p, err)
+	}
+
+	t.Setenv(SocketEnv, "/"+strings.Repeat("a", MaxSocketPathLen))
+	var tooLong *SocketPathTooLongError
+	if _, err := SocketPath(); !errors.As(err, &tooLong) {
+		t.Errorf("Expected an over-long %s to be rejected, got %v", SocketEnv, err)
+	}
+}
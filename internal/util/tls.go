@@ -1,13 +1,18 @@
 package util
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"log"
 	"math/big"
 	"net"
 	"os"
@@ -15,40 +20,181 @@ import (
 	"time"
 )
 
+// defaultCertIdentity is the name the daemon certificate is issued for
+const defaultCertIdentity = "op-authd-local"
+
+// Supported CertPolicy key types
+const (
+	CertKeyRSA   = "rsa"
+	CertKeyECDSA = "ecdsa"
+)
+
+// CertPolicy is the minimum the daemon accepts from a certificate on disk.
+// Zero fields take the defaults: RSA, 2048 bits (256 for ECDSA), op-authd-local.
+type CertPolicy struct {
+	KeyType  string
+	MinBits  int
+	Identity string
+}
+
+// DefaultCertPolicy returns the policy used by TLSConfig
+func DefaultCertPolicy() CertPolicy {
+	return CertPolicy{}.withDefaults()
+}
+
+// withDefaults fills unset fields
+func (p CertPolicy) withDefaults() CertPolicy {
+	if p.KeyType == "" {
+		p.KeyType = CertKeyRSA
+	}
+	if p.MinBits == 0 {
+		p.MinBits = 2048
+		if p.KeyType == CertKeyECDSA {
+			p.MinBits = 256
+		}
+	}
+	if p.Identity == "" {
+		p.Identity = defaultCertIdentity
+	}
+	return p
+}
+
+// Validate reports policies no generated certificate could satisfy
+func (p CertPolicy) Validate() error {
+	p = p.withDefaults()
+	switch p.KeyType {
+	case CertKeyRSA:
+		if p.MinBits > 8192 {
+			return fmt.Errorf("rsa key size %d exceeds 8192 bits", p.MinBits)
+		}
+	case CertKeyECDSA:
+		if ecdsaCurve(p.MinBits) == nil {
+			return fmt.Errorf("no ecdsa curve provides %d bits", p.MinBits)
+		}
+	default:
+		return fmt.Errorf("unknown key type %q (want %s or %s)", p.KeyType, CertKeyRSA, CertKeyECDSA)
+	}
+	return nil
+}
+
+// check rejects a certificate whose key is the wrong type, too small, or whose SAN lacks the identity
+func (p CertPolicy) check(cert *x509.Certificate) error {
+	p = p.withDefaults()
+	var keyType string
+	var bits int
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		keyType, bits = CertKeyRSA, pub.N.BitLen()
+	case *ecdsa.PublicKey:
+		keyType, bits = CertKeyECDSA, pub.Curve.Params().BitSize
+	default:
+		return fmt.Errorf("unsupported key type %T", cert.PublicKey)
+	}
+	if keyType != p.KeyType {
+		return fmt.Errorf("key type %s, want %s", keyType, p.KeyType)
+	}
+	if bits < p.MinBits {
+		return fmt.Errorf("%s key is %d bits, want at least %d", keyType, bits, p.MinBits)
+	}
+	if err := cert.VerifyHostname(p.Identity); err != nil {
+		return fmt.Errorf("certificate SAN does not include %q", p.Identity)
+	}
+	return nil
+}
+
+// ecdsaCurve returns the smallest supported curve of at least bits, or nil
+func ecdsaCurve(bits int) elliptic.Curve {
+	for _, c := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		if c.Params().BitSize >= bits {
+			return c
+		}
+	}
+	return nil
+}
+
 // TLSConfig generates or loads TLS configuration for Unix socket encryption
 func TLSConfig() (*tls.Config, error) {
+	return TLSConfigWithPolicy(DefaultCertPolicy())
+}
+
+// TLSConfigWithPolicy is TLSConfig with a certificate policy. An existing
+// certificate that is expiring or fails the policy is replaced.
+func TLSConfigWithPolicy(p CertPolicy) (*tls.Config, error) {
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid certificate policy: %w", err)
+	}
+	p = p.withDefaults()
+
 	certPath, keyPath, err := getCertPaths()
 	if err != nil {
 		return nil, err
 	}
 
 	// Check if cert and key already exist and are valid
-	if cert, err := loadExistingCert(certPath, keyPath); err == nil {
-		if cert.Leaf != nil && cert.Leaf.NotAfter.After(time.Now().Add(24*time.Hour)) {
-			// Certificate is valid and has >24 hours remaining
-			return &tls.Config{
-				Certificates: []tls.Certificate{cert},
-				ServerName:   "op-authd-local", // For client verification
-			}, nil
-		}
+	cert, err := usableCert(certPath, keyPath, p)
+	if err == nil {
+		return &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			ServerName:   p.Identity, // For client verification
+		}, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Regenerating TLS certificate %s: %v", certPath, err)
 	}
 
 	// Generate new certificate if needed
-	if err := generateSelfSignedCert(certPath, keyPath); err != nil {
+	if err := generateSelfSignedCertWithPolicy(certPath, keyPath, p); err != nil {
 		return nil, fmt.Errorf("failed to generate TLS certificate: %w", err)
 	}
 
-	cert, err := loadExistingCert(certPath, keyPath)
+	cert, err = loadExistingCert(certPath, keyPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load newly generated certificate: %w", err)
 	}
 
 	return &tls.Config{
 		Certificates: []tls.Certificate{cert},
-		ServerName:   "op-authd-local",
+		ServerName:   p.Identity,
 	}, nil
 }
 
+// ErrCertRegenerate is returned by CheckCert when startup would replace the certificate on disk
+var ErrCertRegenerate = errors.New("certificate will be regenerated at startup")
+
+// CheckCert reports whether the certificate on disk satisfies p without
+// generating or replacing anything, as TLSConfigWithPolicy would at startup
+func CheckCert(p CertPolicy) error {
+	if err := p.Validate(); err != nil {
+		return fmt.Errorf("invalid certificate policy: %w", err)
+	}
+	certPath, keyPath, err := getCertPaths()
+	if err != nil {
+		return err
+	}
+	if _, err := usableCert(certPath, keyPath, p.withDefaults()); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s does not exist", ErrCertRegenerate, certPath)
+	} else if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrCertRegenerate, certPath, err)
+	}
+	return nil
+}
+
+// usableCert loads the certificate at certPath if it meets p and has more than
+// 24 hours left; a missing pair is reported as os.ErrNotExist
+func usableCert(certPath, keyPath string, p CertPolicy) (tls.Certificate, error) {
+	cert, err := loadExistingCert(certPath, keyPath)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if cert.Leaf == nil || !cert.Leaf.NotAfter.After(time.Now().Add(24*time.Hour)) {
+		return tls.Certificate{}, errors.New("certificate expires within 24 hours")
+	}
+	if err := p.check(cert.Leaf); err != nil {
+		return tls.Certificate{}, err
+	}
+	return cert, nil
+}
+
 // ClientTLSConfig returns TLS config for client connections
 func ClientTLSConfig() (*tls.Config, error) {
 	certPath, keyPath, err := getCertPaths()
@@ -63,7 +209,7 @@ func ClientTLSConfig() (*tls.Config, error) {
 
 	return &tls.Config{
 		Certificates:       []tls.Certificate{cert},
-		ServerName:         "op-authd-local",
+		ServerName:         defaultCertIdentity,
 		InsecureSkipVerify: true, // Self-signed cert, but we verify via token auth
 	}, nil
 }
@@ -101,8 +247,34 @@ func loadExistingCert(certPath, keyPath string) (tls.Certificate, error) {
 }
 
 func generateSelfSignedCert(certPath, keyPath string) error {
+	return generateSelfSignedCertWithPolicy(certPath, keyPath, DefaultCertPolicy())
+}
+
+// generatePrivateKey creates a key meeting p, returning it with its PEM encoding
+func generatePrivateKey(p CertPolicy) (crypto.Signer, *pem.Block, error) {
+	if p.KeyType == CertKeyECDSA {
+		key, err := ecdsa.GenerateKey(ecdsaCurve(p.MinBits), rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}, nil
+	}
+	key, err := rsa.GenerateKey(rand.Reader, max(p.MinBits, 2048))
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}, nil
+}
+
+func generateSelfSignedCertWithPolicy(certPath, keyPath string, p CertPolicy) error {
+	p = p.withDefaults()
+
 	// Generate private key
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	privateKey, keyBlock, err := generatePrivateKey(p)
 	if err != nil {
 		return fmt.Errorf("failed to generate private key: %w", err)
 	}
@@ -117,18 +289,23 @@ func generateSelfSignedCert(certPath, keyPath string) error {
 			Locality:      []string{""},
 			StreetAddress: []string{""},
 			PostalCode:    []string{""},
-			CommonName:    "op-authd-local",
+			CommonName:    p.Identity,
 		},
 		NotBefore:   time.Now(),
 		NotAfter:    time.Now().Add(365 * 24 * time.Hour), // Valid for 1 year
-		KeyUsage:    x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
 		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
 		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
-		DNSNames:    []string{"localhost", "op-authd-local"},
+		DNSNames:    []string{"localhost", p.Identity},
+	}
+
+	// Only RSA keys encrypt the key exchange
+	if p.KeyType == CertKeyRSA {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
 	}
 
 	// Generate the certificate
-	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &privateKey.PublicKey, privateKey)
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, privateKey.Public(), privateKey)
 	if err != nil {
 		return fmt.Errorf("failed to create certificate: %w", err)
 	}
@@ -159,12 +336,7 @@ func generateSelfSignedCert(certPath, keyPath string) error {
 	}
 	defer keyFile.Close()
 
-	privateKeyDER := x509.MarshalPKCS1PrivateKey(privateKey)
-
-	if err := pem.Encode(keyFile, &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: privateKeyDER,
-	}); err != nil {
+	if err := pem.Encode(keyFile, keyBlock); err != nil {
 		return fmt.Errorf("failed to write private key: %w", err)
 	}
 
@@ -1,8 +1,16 @@
 package util
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
 	"os"
 	"path/filepath"
 	"testing"
@@ -247,3 +255,149 @@ func TestGetCertPaths(t *testing.T) {
 		t.Errorf("Expected key path %q, got %q", expectedKey, keyPath)
 	}
 }
+
+// writeTestCert writes a self-signed cert for key with the given SAN DNS names
+func writeTestCert(t *testing.T, certPath, keyPath string, key crypto.Signer, dnsNames []string) {
+	t.Helper()
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(30 * 24 * time.Hour),
+		DNSNames:     dnsNames,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLSConfigWithPolicy_ReplacesCertsBelowPolicy(t *testing.T) {
+	weakRSA, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate weak key: %v", err)
+	}
+	rsa2048, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	identity := []string{"localhost", "op-authd-local"}
+
+	tests := []struct {
+		name        string
+		key         crypto.Signer
+		dnsNames    []string
+		policy      CertPolicy
+		regenerated bool
+		keyType     string
+		bits        int
+	}{
+		{name: "weak rsa key", key: weakRSA, dnsNames: identity, regenerated: true, keyType: CertKeyRSA, bits: 2048},
+		{name: "wrong key type", key: p256, dnsNames: identity, regenerated: true, keyType: CertKeyRSA, bits: 2048},
+		{name: "missing identity", key: rsa2048, dnsNames: []string{"localhost"}, regenerated: true, keyType: CertKeyRSA, bits: 2048},
+		{name: "meets default policy", key: rsa2048, dnsNames: identity, keyType: CertKeyRSA, bits: 2048},
+		{name: "meets ecdsa policy", key: p256, dnsNames: identity, policy: CertPolicy{KeyType: CertKeyECDSA}, keyType: CertKeyECDSA, bits: 256},
+		{name: "ecdsa below minimum", key: p256, dnsNames: identity, policy: CertPolicy{KeyType: CertKeyECDSA, MinBits: 384}, regenerated: true, keyType: CertKeyECDSA, bits: 384},
+		{name: "custom identity", key: rsa2048, dnsNames: identity, policy: CertPolicy{Identity: "opx-test"}, regenerated: true, keyType: CertKeyRSA, bits: 2048},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			originalGetStateDir := getStateDir
+			getStateDir = func() (string, error) { return tmpDir, nil }
+			defer func() { getStateDir = originalGetStateDir }()
+
+			certPath := filepath.Join(tmpDir, "tls.crt")
+			writeTestCert(t, certPath, filepath.Join(tmpDir, "tls.key"), tt.key, tt.dnsNames)
+			before, _ := os.ReadFile(certPath)
+
+			config, err := TLSConfigWithPolicy(tt.policy)
+			if err != nil {
+				t.Fatalf("TLSConfigWithPolicy failed: %v", err)
+			}
+			after, _ := os.ReadFile(certPath)
+			if regenerated := string(before) != string(after); regenerated != tt.regenerated {
+				t.Errorf("Expected regenerated=%v, got %v", tt.regenerated, regenerated)
+			}
+
+			leaf := config.Certificates[0].Leaf
+			if err := tt.policy.check(leaf); err != nil {
+				t.Errorf("Expected served certificate to meet policy: %v", err)
+			}
+			switch pub := leaf.PublicKey.(type) {
+			case *rsa.PublicKey:
+				if tt.keyType != CertKeyRSA || pub.N.BitLen() != tt.bits {
+					t.Errorf("Expected %s/%d key, got rsa/%d", tt.keyType, tt.bits, pub.N.BitLen())
+				}
+			case *ecdsa.PublicKey:
+				if tt.keyType != CertKeyECDSA || pub.Curve.Params().BitSize != tt.bits {
+					t.Errorf("Expected %s/%d key, got ecdsa/%d", tt.keyType, tt.bits, pub.Curve.Params().BitSize)
+				}
+			}
+		})
+	}
+}
+
+func TestCertPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  CertPolicy
+		wantErr bool
+	}{
+		{name: "defaults", policy: CertPolicy{}},
+		{name: "rsa 4096", policy: CertPolicy{KeyType: CertKeyRSA, MinBits: 4096}},
+		{name: "ecdsa p521", policy: CertPolicy{KeyType: CertKeyECDSA, MinBits: 521}},
+		{name: "unknown type", policy: CertPolicy{KeyType: "dsa"}, wantErr: true},
+		{name: "ecdsa too large", policy: CertPolicy{KeyType: CertKeyECDSA, MinBits: 1024}, wantErr: true},
+		{name: "rsa too large", policy: CertPolicy{KeyType: CertKeyRSA, MinBits: 16384}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCheckCert(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalGetStateDir := getStateDir
+	getStateDir = func() (string, error) { return tmpDir, nil }
+	defer func() { getStateDir = originalGetStateDir }()
+	certPath, keyPath := filepath.Join(tmpDir, "tls.crt"), filepath.Join(tmpDir, "tls.key")
+
+	if err := CheckCert(CertPolicy{}); !errors.Is(err, ErrCertRegenerate) {
+		t.Errorf("Expected ErrCertRegenerate for a missing certificate, got %v", err)
+	}
+	if _, err := os.Stat(certPath); !os.IsNotExist(err) {
+		t.Error("Expected CheckCert not to generate a certificate")
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	writeTestCert(t, certPath, keyPath, key, []string{"op-authd-local"})
+	if err := CheckCert(CertPolicy{}); err != nil {
+		t.Errorf("Expected the certificate to pass, got %v", err)
+	}
+	if err := CheckCert(CertPolicy{KeyType: CertKeyECDSA}); !errors.Is(err, ErrCertRegenerate) {
+		t.Errorf("Expected ErrCertRegenerate for the wrong key type, got %v", err)
+	}
+	if err := CheckCert(CertPolicy{KeyType: "dsa"}); err == nil || errors.Is(err, ErrCertRegenerate) {
+		t.Errorf("Expected an invalid policy error, got %v", err)
+	}
+}